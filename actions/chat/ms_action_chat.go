@@ -1,8 +1,8 @@
 /**
- * Provides an action for posting a message to a chat application. Currently
- * supporting posting to Rocket Chat via a webhook.
+ * Provides an action for posting a message to a chat application via a
+ * webhook. Currently supporting Rocket.Chat, Mattermost and Slack.
  *
- * @I Architect a generic chat plugin that supports Slack and HipChat as well
+ * @I Support posting messages to HipChat
  */
 
 package msActionChat
@@ -10,21 +10,51 @@ package msActionChat
 import (
 	// Utilities.
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	// Internal dependencies.
 	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
 )
 
 /**
  * Constants.
  */
 
+// The chat applications that messages can be posted to.
+const (
+	ProviderRocketChat = "rocketchat"
+	ProviderMattermost = "mattermost"
+	ProviderSlack      = "slack"
+)
+
+// The headers that signed requests carry. The signature header holds the
+// HMAC-SHA256 of the timestamp header's value and the request body, joined by a
+// dot, in the form "sha256=<hex digest>". The timestamp header holds the time
+// the request was signed as a Unix timestamp in seconds.
+//
+// Receivers verify a request by computing the same HMAC with the shared secret
+// over "<timestamp>.<body>", using the raw body as received, and comparing it
+// with the signature header in constant time e.g. via hmac.Equal. Since the
+// timestamp is signed together with the body, receivers should also reject
+// requests whose timestamp is too far from their own clock, such as by more than
+// 5 minutes, so that captured requests cannot be replayed later on.
+const (
+	SignatureHeader          = "X-Mantis-Signature"
+	SignatureTimestampHeader = "X-Mantis-Timestamp"
+)
+
 // chatMessageActionTimeout defines the HTTP Client's timeout duration in
 // seconds for all Chat Message Actions.
 // @I Make the timeout for Chat Message actions configurable per Action
@@ -38,21 +68,36 @@ const chatMessageActionTimeout = 30
 // HTTP client that makes the request to the Action's URL. Dependency injection
 // is necessary for testing purposes.
 type HTTPClient interface {
-	Post(string, string, io.Reader) (*http.Response, error)
+	Do(*http.Request) (*http.Response, error)
 }
 
 // Action implements the common.Action interface. It provides an Action that
-// posts a message to a chat application such as Rocket.Chat, Mattermost, Slack
-// or HipChat. Rocket.Chat-style message payload via a webhook is supported at
-// the moment.
+// posts a message to a chat application such as Rocket.Chat, Mattermost or
+// Slack. The message is defined in the structure required by Rocket.Chat and it
+// is converted to the structure required by the chat application when posted.
 type Action struct {
 	// Common fields and functions for all Actions.
 	common.ActionBase
 
+	// The chat application that the message is posted to; one of "rocketchat",
+	// "mattermost" or "slack". Defaults to "rocketchat".
+	Provider string `json:"provider"`
 	// Webhook where the message will be posted. Provided by the chat application.
 	URL string `json:"url"`
+	// The channels that the message is posted to, given as a single channel or
+	// as an array of channels e.g. "#alerts" or "@username". The message is
+	// posted to each channel separately via the same webhook. When empty, the
+	// message is posted once to the webhook's default channel.
+	Channels common.Targets `json:"channel,omitempty"`
 	// The message that will be posted.
 	Message Message `json:"message"`
+	// The User-Agent header sent with the request. Defaults to the User-Agent of
+	// all Actions e.g. "mantis-shrimp/action/1.0.0".
+	UserAgent string `json:"user_agent,omitempty"`
+	// The secret shared with the receiver of the webhook, used for signing the
+	// requests so that the receiver can verify that they were made by the
+	// Action. Requests are not signed when empty.
+	SigningSecret string `json:"signing_secret,omitempty"`
 
 	// The HTTP client used to make the request to the URL.
 	httpClient HTTPClient
@@ -63,26 +108,83 @@ type Action struct {
 // done with the corresponding setter function.
 func NewAction(name string, URL string, message Message) *Action {
 	return &Action{
-		common.ActionBase{
+		ActionBase: common.ActionBase{
 			Name: name,
 		},
-		URL,
-		message,
-		nil,
+		URL:     URL,
+		Message: message,
 	}
 }
 
+// TargetURL implements common.URLTarget.TargetURL(). It returns the webhook
+// URL that the message is posted to.
+func (action Action) TargetURL() string {
+	return action.URL
+}
+
 // Do Implements common.Action.Do().
 // It executes the Chat Action by posting the message to the chat application.
-func (action Action) Do() error {
-	// Convert the message to JSON.
-	body, err := json.Marshal(action.Message)
+// When the Action is triggered by a Watch, the details of the Watch are posted
+// as an attachment to the message. When posting fails for some channels, the
+// returned error reports all of them. The requests are aborted if the given
+// context is cancelled.
+func (action Action) Do(ctx context.Context, actionContext common.ActionContext) error {
+	message := action.message(actionContext)
+	if len(action.Channels) == 0 {
+		return action.post(ctx, message)
+	}
+
+	return action.Channels.Do(func(channel string) error {
+		message.Channel = &channel
+		return action.post(ctx, message)
+	})
+}
+
+// Signature returns the signature of a request with the given body, signed with
+// the given secret at the given Unix timestamp, as sent in the signature header.
+// Receivers written in Go can use it for verifying the requests.
+func Signature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetHTTPClient allows to inject an HTTP client into the corresponding field.
+func (action *Action) SetHTTPClient(client HTTPClient) {
+	action.httpClient = client
+}
+
+// post posts the given message to the chat application.
+func (action Action) post(ctx context.Context, message Message) error {
+	// Convert the message to the chat application's structure and to JSON.
+	payload, err := action.payload(message)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
 	// Create and send the request.
-	res, err := action.httpClient.Post(action.URL, "application/json", bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, action.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	userAgent := action.UserAgent
+	if userAgent == "" {
+		userAgent = util.UserAgent("action")
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if action.SigningSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(SignatureTimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Signature(action.SigningSecret, timestamp, body))
+	}
+	res, err := action.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -90,23 +192,85 @@ func (action Action) Do() error {
 
 	if res.StatusCode != http.StatusOK {
 		resBody, _ := ioutil.ReadAll(res.Body)
-		fmt.Println("Status:", res.Status)
-		fmt.Println("Headers:", res.Header)
-		fmt.Println("Body:", string(resBody))
+		log.Warn(
+			"the chat application did not accept the message",
+			"action", action.Name,
+			"status", res.Status,
+			"body", string(resBody),
+		)
 	}
 
 	return nil
 }
 
-// SetHTTPClient allows to inject an HTTP client into the corresponding field.
-func (action *Action) SetHTTPClient(client HTTPClient) {
-	action.httpClient = client
+// message returns the message that will be posted, including an attachment
+// with the details of the Watch that triggered the Action, if any. The
+// Action's own message is not modified.
+func (action Action) message(actionContext common.ActionContext) Message {
+	message := action.Message
+	if actionContext.WatchName == "" {
+		return message
+	}
+
+	title := actionContext.WatchName
+	text := "Status: " + actionContext.Status
+	ts := actionContext.Timestamp.Format(time.RFC3339)
+	attachment := Attachment{
+		Title: &title,
+		Text:  &text,
+		Ts:    &ts,
+	}
+
+	// Add any further details as fields, sorted so that they are always posted
+	// in the same order.
+	if len(actionContext.Values) != 0 {
+		keys := make([]string, 0, len(actionContext.Values))
+		for key := range actionContext.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := make([]Field, len(keys))
+		for index, key := range keys {
+			short := true
+			title := key
+			value := actionContext.Values[key]
+			fields[index] = Field{Short: &short, Title: &title, Value: &value}
+		}
+		attachment.Fields = &fields
+	}
+
+	var attachments []Attachment
+	if message.Attachments != nil {
+		attachments = append(attachments, *message.Attachments...)
+	}
+	attachments = append(attachments, attachment)
+	message.Attachments = &attachments
+
+	return message
+}
+
+// payload converts the given message to the structure required by the Action's
+// chat application.
+func (action Action) payload(message Message) (interface{}, error) {
+	switch action.Provider {
+	case "", ProviderRocketChat:
+		return message, nil
+	case ProviderMattermost:
+		// Mattermost does not support attachment timestamps.
+		return slackMessage(message, false), nil
+	case ProviderSlack:
+		return slackMessage(message, true), nil
+	}
+
+	return nil, fmt.Errorf("unknown chat provider \"%s\"", action.Provider)
 }
 
 // Message holds a chat message. Implements the structure required by
 // Rocket.Chat.
 // @see https://rocket.chat/docs/developer-guides/rest-api/chat/postmessage
 type Message struct {
+	Channel     *string       `json:"channel,omitempty"`
 	Text        *string       `json:"text,omitempty"`
 	Alias       *string       `json:"alias,omitempty"`
 	Emoji       *string       `json:"emoji,omitempty"`
@@ -155,6 +319,12 @@ var NewChatMessageAction = func(jsonAction *json.RawMessage) (common.Action, err
 		return nil, err
 	}
 
+	switch action.Provider {
+	case "", ProviderRocketChat, ProviderMattermost, ProviderSlack:
+	default:
+		return nil, fmt.Errorf("unknown chat provider \"%s\"", action.Provider)
+	}
+
 	// Inject an HTTP client with the Action's timeout.
 	client := &http.Client{
 		Timeout: chatMessageActionTimeout * time.Second,
@@ -163,3 +333,82 @@ var NewChatMessageAction = func(jsonAction *json.RawMessage) (common.Action, err
 
 	return action, nil
 }
+
+/**
+ * Slack-compatible messages.
+ */
+
+// SlackMessage holds a chat message. Implements the structure required by
+// Slack's incoming webhooks, which is also supported by Mattermost.
+// @see https://api.slack.com/incoming-webhooks
+// @see https://docs.mattermost.com/developer/webhooks-incoming.html
+type SlackMessage struct {
+	Channel     *string            `json:"channel,omitempty"`
+	Text        *string            `json:"text,omitempty"`
+	Username    *string            `json:"username,omitempty"`
+	IconEmoji   *string            `json:"icon_emoji,omitempty"`
+	IconURL     *string            `json:"icon_url,omitempty"`
+	Attachments *[]SlackAttachment `json:"attachments,omitempty"`
+}
+
+// SlackAttachment holds chat message attachments. Implements the structure
+// required by Slack.
+// @see https://api.slack.com/docs/message-attachments
+type SlackAttachment struct {
+	Color      *string  `json:"color,omitempty"`
+	Text       *string  `json:"text,omitempty"`
+	Ts         *int64   `json:"ts,omitempty"`
+	ThumbURL   *string  `json:"thumb_url,omitempty"`
+	AuthorName *string  `json:"author_name,omitempty"`
+	AuthorLink *string  `json:"author_link,omitempty"`
+	AuthorIcon *string  `json:"author_icon,omitempty"`
+	Title      *string  `json:"title,omitempty"`
+	TitleLink  *string  `json:"title_link,omitempty"`
+	ImageURL   *string  `json:"image_url,omitempty"`
+	Fields     *[]Field `json:"fields,omitempty"`
+}
+
+// slackMessage converts the given message to the structure required by Slack.
+// Attachment timestamps are converted from RFC 3339 to Unix time; they are
+// omitted when not wanted or when they cannot be parsed. Rocket.Chat-specific
+// fields that have no equivalent, such as collapsed attachments, are dropped.
+func slackMessage(message Message, timestamps bool) SlackMessage {
+	slack := SlackMessage{
+		Channel:   message.Channel,
+		Text:      message.Text,
+		Username:  message.Alias,
+		IconEmoji: message.Emoji,
+		IconURL:   message.Avatar,
+	}
+	if message.Attachments == nil {
+		return slack
+	}
+
+	attachments := make([]SlackAttachment, len(*message.Attachments))
+	for index, attachment := range *message.Attachments {
+		attachments[index] = SlackAttachment{
+			Color:      attachment.Color,
+			Text:       attachment.Text,
+			ThumbURL:   attachment.ThumbURL,
+			AuthorName: attachment.AuthorName,
+			AuthorLink: attachment.AuthorLink,
+			AuthorIcon: attachment.AuthorIcon,
+			Title:      attachment.Title,
+			TitleLink:  attachment.TitleLink,
+			ImageURL:   attachment.ImageURL,
+			Fields:     attachment.Fields,
+		}
+		if !timestamps || attachment.Ts == nil {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, *attachment.Ts)
+		if err != nil {
+			continue
+		}
+		unix := ts.Unix()
+		attachments[index].Ts = &unix
+	}
+	slack.Attachments = &attachments
+
+	return slack
+}
@@ -1,17 +1,226 @@
 package msActionCommon
 
-// Action is an interface that should be implemented by all Watch types.
+import (
+	// Utilities.
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Action is an interface that should be implemented by all Action types.
 // It simply defines a Do() function that does whatever the Action is meant to
-// do.
+// do. It is given the context in which the Action was triggered, so that the
+// Action can make use of it e.g. to include the triggering Watch's name in a
+// message. It is also given a context.Context; Actions should stop what they
+// are doing, such as an outbound request, and return an error when it is
+// cancelled.
 type Action interface {
-	Do() error
+	Do(context.Context, ActionContext) error
+}
+
+// URLTarget is an optional interface implemented by Action types that make
+// requests to a URL given as part of the Action, such as a webhook. It allows
+// the URL to be validated without knowing the Action's type.
+type URLTarget interface {
+	TargetURL() string
+}
+
+// ActionContext holds details about the event that triggered an Action. When
+// an Action is triggered directly rather than by a Watch, only the timestamp is
+// available.
+type ActionContext struct {
+	// The name of the Watch whose evaluation triggered the Action.
+	WatchName string `json:"watch_name"`
+	// The status of the Watch's Result e.g. "success" or "inaccessible".
+	Status string `json:"status"`
+	// When the Action was triggered.
+	Timestamp time.Time `json:"timestamp"`
+	// Any further details provided by the Watch, such as the URL that was
+	// checked.
+	Values map[string]string `json:"values,omitempty"`
+	// The response headers captured by the Watch, if any. They are kept in the
+	// history of the Watch's Results, but they are not sent to the Actions.
+	Headers http.Header `json:"-"`
+	// The response body captured by the Watch, if any, and whether the Watch
+	// truncated it when capturing it. Like the headers, they are kept in the
+	// history of the Watch's Results but they are not sent to the Actions.
+	Body          string `json:"-"`
+	BodyTruncated bool   `json:"-"`
+}
+
+// Targets holds the targets that an Action is executed for, such as the
+// recipients of an email message or the channels that a chat message is posted
+// to. It is given in JSON either as a single string or as an array of strings;
+// a single target is encoded as a string so that Actions given with a string
+// are stored as they were given.
+type Targets []string
+
+// MarshalJSON implements json.Marshaler.
+func (targets Targets) MarshalJSON() ([]byte, error) {
+	if len(targets) == 1 {
+		return json.Marshal(targets[0])
+	}
+
+	return json.Marshal([]string(targets))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (targets *Targets) UnmarshalJSON(data []byte) error {
+	var target string
+	err := json.Unmarshal(data, &target)
+	if err == nil {
+		*targets = Targets{target}
+		return nil
+	}
+
+	var list []string
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return fmt.Errorf("the targets must be given as a string or as an array of strings")
+	}
+	*targets = Targets(list)
+
+	return nil
+}
+
+// Do calls the given function for each target, in order. It does not stop when
+// the function fails for a target; it returns a TargetsError reporting all
+// targets that the function failed for, or nil if it succeeded for all of them.
+func (targets Targets) Do(fn func(target string) error) error {
+	errs := make(map[string]error)
+	for _, target := range targets {
+		err := fn(target)
+		if err != nil {
+			errs[target] = err
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return TargetsError{Total: len(targets), Errors: errs}
+}
+
+// TargetsError is returned when an Action fails for some or all of its targets.
+// It holds the error that occurred for each target that failed, keyed by the
+// target.
+type TargetsError struct {
+	// The number of targets that the Action was executed for.
+	Total int
+	// The errors that occurred, keyed by the target that they occurred for.
+	Errors map[string]error
+}
+
+// Error implements the error interface. The targets are reported sorted so
+// that the message is always the same for the same errors.
+func (err TargetsError) Error() string {
+	targets := err.targets()
+	messages := make([]string, len(targets))
+	for index, target := range targets {
+		messages[index] = fmt.Sprintf("\"%s\": %s", target, err.Errors[target].Error())
+	}
+
+	return fmt.Sprintf(
+		"the Action failed for %d of %d targets: %s",
+		len(targets),
+		err.Total,
+		strings.Join(messages, "; "),
+	)
+}
+
+// Unwrap returns the errors that occurred for the targets, sorted by target, so
+// that errors.Is() and errors.As() can be used on them e.g. for finding out
+// whether the Action was cancelled.
+func (err TargetsError) Unwrap() []error {
+	targets := err.targets()
+	errs := make([]error, len(targets))
+	for index, target := range targets {
+		errs[index] = err.Errors[target]
+	}
+
+	return errs
+}
+
+// targets returns the targets that failed, sorted.
+func (err TargetsError) targets() []string {
+	targets := make([]string, 0, len(err.Errors))
+	for target := range err.Errors {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	return targets
 }
 
 // ActionBase should be included by all Action types as an embedded struct
 // (anonymous field). It provides all fields that should be present in all
 // Action implementations.
 type ActionBase struct {
-	// @I Add CreatedAt and UpdatedAt fields in Actions
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// Base returns a copy of the ActionBase embedded in the given Action. It
+// returns an error if the Action type does not embed an ActionBase.
+func Base(action Action) (*ActionBase, error) {
+	field, err := baseField(reflect.ValueOf(action))
+	if err != nil {
+		return nil, err
+	}
+
+	base := field.Interface().(ActionBase)
+	return &base, nil
+}
+
+// SetBase replaces the ActionBase embedded in the Action that the given pointer
+// points to. Actions are usually held in the Action interface by value, which
+// cannot be modified in place; in that case the Action is replaced by a copy
+// that contains the given ActionBase.
+func SetBase(actionPointer *Action, base ActionBase) error {
+	value := reflect.ValueOf(*actionPointer)
+
+	// Actions held by pointer can be modified in place.
+	if value.Kind() == reflect.Ptr {
+		field, err := baseField(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(base))
+		return nil
+	}
+
+	copyValue := reflect.New(value.Type()).Elem()
+	copyValue.Set(value)
+	field, err := baseField(copyValue)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(base))
+
+	*actionPointer = copyValue.Interface().(Action)
+	return nil
+}
+
+// baseField returns the ActionBase field of the given Action value.
+func baseField(value reflect.Value) (reflect.Value, error) {
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("the Action of type \"%s\" is not a struct", value.Type())
+	}
+
+	field := value.FieldByName("ActionBase")
+	if !field.IsValid() || field.Type() != reflect.TypeOf(ActionBase{}) {
+		return reflect.Value{}, fmt.Errorf("the Action of type \"%s\" does not embed an ActionBase", value.Type())
+	}
 
-	Name string `json:"name"`
+	return field, nil
 }
@@ -5,14 +5,209 @@
 package msActionConfig
 
 import (
+	// Utilities.
+	"fmt"
+	"strings"
+	"time"
+
 	// Internal dependencies.
 	wrapper "github.com/krystalcode/go-mantis-shrimp/actions/wrapper"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	metrics "github.com/krystalcode/go-mantis-shrimp/util/metrics"
 )
 
+// CircuitBreakerThresholdDefault holds the number of consecutive failures of an
+// Action after which its executions are stopped, if no threshold is given in
+// the configuration.
+const CircuitBreakerThresholdDefault = 5
+
+// CircuitBreakerCoolDownDefault holds the time for which executions of an
+// Action are stopped after it keeps failing, if no cool-down is given in the
+// configuration.
+const CircuitBreakerCoolDownDefault = time.Minute
+
+// CircuitBreakerCoolDownMaxDefault holds the maximum time for which executions
+// of an Action are stopped, if no maximum is given in the configuration.
+const CircuitBreakerCoolDownMaxDefault = 10 * time.Minute
+
+// ExecutionTimeoutDefault holds the maximum time that an execution of an Action
+// can take before it is cancelled, if no timeout is given in the configuration.
+const ExecutionTimeoutDefault = time.Minute
+
 // Config holds the configuration required for the Action API.
 type Config struct {
+	// @I Add a MaxStoredBodyBytes option truncating stored bodies, as the Watch
+	//    API does, once the Results of Action executions are persisted
+
+	// Whether Actions that run local commands ("exec" type) are allowed. Running
+	// commands is dangerous, so they are not allowed by default.
+	AllowExecActions bool `json:"allow_exec_actions"`
+	// Regular expressions that the URLs which Actions make requests to, such as
+	// the webhooks of Chat Message Actions, must match for the Actions to be
+	// created. All URLs are allowed when empty.
+	AllowedURLPatterns []string `json:"allowed_url_patterns"`
+	// The token that callers of the API must provide as a bearer token for
+	// authentication. Authentication is disabled when empty.
+	AuthToken string `json:"auth_token"`
+	// The configuration of the circuit breakers that stop executing Actions that
+	// keep failing.
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
+	// The maximum time that each execution of an Action can take before it is
+	// cancelled, as a duration string e.g. "30s". Defaults to 1 minute.
+	ExecutionTimeout string `json:"execution_timeout"`
+	// The time given to the service to finish any work in progress when asked to
+	// shut down, as a duration string e.g. "30s". Defaults to 10 seconds.
+	ShutdownGracePeriod string `json:"shutdown_grace_period"`
+	// The logging configuration.
+	Log log.Config `json:"log"`
+	// The configuration for exposing metrics.
+	Metrics metrics.Config `json:"metrics"`
+	// The configuration for limiting the rate of the requests that create
+	// Actions made by each client. Requests are not limited by default.
+	RateLimit api.RateLimitConfig `json:"rate_limit"`
+	// The configuration for the HTTP server that serves the API, such as the
+	// maximum size of the request bodies. Defaults are used when not given.
+	Server api.ServerConfig `json:"server"`
 	// The Storage configuration.
 	Storage map[string]interface{} `json:"storage"`
 	// Actions to be loaded in the case of using ephemeral storage.
 	ActionWrappers []wrapper.ActionWrapper `json:"actions"`
 }
+
+// Validate checks that all required configuration options are given. All
+// problems found are reported together in the returned error.
+func (config Config) Validate() error {
+	var errs []string
+
+	if storageType, ok := config.Storage["type"].(string); !ok || storageType == "" {
+		errs = append(errs, "the \"storage.type\" option is required")
+	}
+	if err := config.Metrics.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"metrics\" options are not valid: %s", err.Error()))
+	}
+	if err := config.Log.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"log\" options are not valid: %s", err.Error()))
+	}
+	if err := config.RateLimit.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"rate_limit\" options are not valid: %s", err.Error()))
+	}
+	if err := config.Server.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"server\" options are not valid: %s", err.Error()))
+	}
+	if _, err := util.NewURLAllowList(config.AllowedURLPatterns); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"allowed_url_patterns\" option is not valid: %s", err.Error()),
+		)
+	}
+	if _, _, _, err := config.CircuitBreaker.Parse(); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"circuit_breaker\" options are not valid: %s", err.Error()),
+		)
+	}
+	if _, err := config.ParseExecutionTimeout(); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"execution_timeout\" option is not valid: %s", err.Error()),
+		)
+	}
+	if _, err := util.ParseGracePeriod(config.ShutdownGracePeriod); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"shutdown_grace_period\" option is not valid: %s", err.Error()),
+		)
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid Action API configuration: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// ParseExecutionTimeout returns the execution timeout given in the
+// configuration, or its default if it is not given.
+func (config Config) ParseExecutionTimeout() (time.Duration, error) {
+	if config.ExecutionTimeout == "" {
+		return ExecutionTimeoutDefault, nil
+	}
+
+	timeout, err := time.ParseDuration(config.ExecutionTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("the timeout \"%s\" should be positive", config.ExecutionTimeout)
+	}
+
+	return timeout, nil
+}
+
+// CircuitBreakerConfig holds the configuration of the circuit breakers that
+// stop executing an Action after it fails a number of consecutive times, for
+// example while the webhook that it posts to is down. After a cool-down period
+// one execution is allowed as a trial; the executions resume if it succeeds,
+// otherwise they are stopped again for double the previous cool-down period.
+type CircuitBreakerConfig struct {
+	// The number of consecutive failures after which the executions of an Action
+	// are stopped. Defaults to 5.
+	Threshold int `json:"threshold"`
+	// The time for which the executions are stopped, as a duration string e.g.
+	// "30s". Defaults to 1 minute.
+	CoolDown string `json:"cool_down"`
+	// The maximum time for which the executions are stopped while trial
+	// executions keep failing, as a duration string e.g. "1h". Defaults to 10
+	// minutes.
+	CoolDownMax string `json:"cool_down_max"`
+}
+
+// Parse returns the threshold, the cool-down and the maximum cool-down given in
+// the configuration, or their defaults if they are not given.
+func (config CircuitBreakerConfig) Parse() (int, time.Duration, time.Duration, error) {
+	threshold := config.Threshold
+	if threshold < 0 {
+		return 0, 0, 0, fmt.Errorf("the threshold cannot be negative")
+	}
+	if threshold == 0 {
+		threshold = CircuitBreakerThresholdDefault
+	}
+
+	coolDown, err := parseCoolDown(config.CoolDown, CircuitBreakerCoolDownDefault)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	coolDownMax, err := parseCoolDown(config.CoolDownMax, CircuitBreakerCoolDownMaxDefault)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if coolDownMax < coolDown {
+		return 0, 0, 0, fmt.Errorf("the maximum cool-down %s is shorter than the cool-down %s", coolDownMax, coolDown)
+	}
+
+	return threshold, coolDown, coolDownMax, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// parseCoolDown converts a cool-down, as given in the configuration, to a
+// duration. The given default is returned if none is given.
+func parseCoolDown(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	coolDown, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if coolDown <= 0 {
+		return 0, fmt.Errorf("the cool-down \"%s\" should be positive", value)
+	}
+
+	return coolDown, nil
+}
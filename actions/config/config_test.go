@@ -0,0 +1,125 @@
+/**
+ * Tests for the msActionConfig module.
+ */
+
+package msActionConfig
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"time"
+
+	// Internal dependencies.
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+)
+
+/**
+ * Tests.
+ */
+
+func TestValidate_Success(t *testing.T) {
+	config := Config{
+		Storage: map[string]interface{}{"type": "redis"},
+	}
+	assert.Nil(t, config.Validate())
+}
+
+func TestValidate_MissingStorageType(t *testing.T) {
+	config := Config{
+		Storage: map[string]interface{}{"dsn": "redis:6379"},
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Action API configuration: the \"storage.type\" option is required")
+}
+
+func TestValidate_InvalidAllowedURLPattern(t *testing.T) {
+	config := Config{
+		AllowedURLPatterns: []string{"^https://hooks\\.slack\\.com/", "(unclosed"},
+		Storage:            map[string]interface{}{"type": "redis"},
+	}
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "allowed_url_patterns")
+}
+
+func TestValidate_InvalidRateLimit(t *testing.T) {
+	config := Config{
+		RateLimit: api.RateLimitConfig{RequestsPerSecond: 10, Burst: -1},
+		Storage:   map[string]interface{}{"type": "redis"},
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Action API configuration: the \"rate_limit\" options are not valid: the burst cannot be negative")
+}
+
+func TestValidate_InvalidServer(t *testing.T) {
+	config := Config{
+		Server:  api.ServerConfig{ReadTimeout: "soon"},
+		Storage: map[string]interface{}{"type": "redis"},
+	}
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid Action API configuration: the \"server\" options are not valid: the read timeout is not valid")
+}
+
+func TestParseExecutionTimeout(t *testing.T) {
+	timeout, err := Config{}.ParseExecutionTimeout()
+	assert.Nil(t, err)
+	assert.Equal(t, ExecutionTimeoutDefault, timeout)
+
+	timeout, err = Config{ExecutionTimeout: "30s"}.ParseExecutionTimeout()
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, timeout)
+
+	for _, value := range []string{"soon", "0s", "-1m"} {
+		_, err = Config{ExecutionTimeout: value}.ParseExecutionTimeout()
+		assert.NotNil(t, err, value)
+	}
+
+	err = Config{
+		ExecutionTimeout: "0s",
+		Storage:          map[string]interface{}{"type": "redis"},
+	}.Validate()
+	assert.EqualError(t, err, "invalid Action API configuration: the \"execution_timeout\" option is not valid: the timeout \"0s\" should be positive")
+}
+
+func TestCircuitBreakerConfig_Parse(t *testing.T) {
+	threshold, coolDown, coolDownMax, err := CircuitBreakerConfig{}.Parse()
+	assert.Nil(t, err)
+	assert.Equal(t, CircuitBreakerThresholdDefault, threshold)
+	assert.Equal(t, CircuitBreakerCoolDownDefault, coolDown)
+	assert.Equal(t, CircuitBreakerCoolDownMaxDefault, coolDownMax)
+
+	threshold, coolDown, coolDownMax, err = CircuitBreakerConfig{
+		Threshold:   3,
+		CoolDown:    "30s",
+		CoolDownMax: "1h",
+	}.Parse()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, threshold)
+	assert.Equal(t, 30*time.Second, coolDown)
+	assert.Equal(t, time.Hour, coolDownMax)
+}
+
+func TestCircuitBreakerConfig_ParseInvalid(t *testing.T) {
+	configs := []CircuitBreakerConfig{
+		{Threshold: -1},
+		{CoolDown: "soon"},
+		{CoolDown: "-1m"},
+		{CoolDownMax: "0s"},
+		{CoolDown: "1h", CoolDownMax: "1m"},
+	}
+	for index, config := range configs {
+		_, _, _, err := config.Parse()
+		assert.NotNil(t, err, "case %d", index)
+	}
+
+	err := Config{
+		CircuitBreaker: CircuitBreakerConfig{Threshold: -1},
+		Storage:        map[string]interface{}{"type": "redis"},
+	}.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "circuit_breaker")
+}
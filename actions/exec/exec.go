@@ -0,0 +1,150 @@
+/**
+ * Provides an action for running a local command, such as a script that tries
+ * to recover a failed service.
+ *
+ * Running commands is dangerous; Exec Actions therefore have to be explicitly
+ * allowed, otherwise they cannot be created or executed.
+ */
+
+package msActionExec
+
+import (
+	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+)
+
+/**
+ * Constants.
+ */
+
+// OutputLimit holds the maximum number of bytes of the command's standard
+// output and standard error that are included in the error returned when the
+// command fails.
+const OutputLimit = 4096
+
+/**
+ * Public API.
+ */
+
+// ErrNotAllowed is returned when trying to create or execute an Exec Action
+// while they are not allowed.
+var ErrNotAllowed = fmt.Errorf("Exec Actions are not allowed; they have to be enabled with the \"allow_exec_actions\" option")
+
+// Allow sets whether Exec Actions are allowed. They are not allowed by default.
+func Allow(allow bool) {
+	var value int32
+	if allow {
+		value = 1
+	}
+	atomic.StoreInt32(&allowed, value)
+}
+
+// Allowed returns whether Exec Actions are allowed.
+func Allowed() bool {
+	return atomic.LoadInt32(&allowed) == 1
+}
+
+/**
+ * Types and their methods.
+ */
+
+// Action implements the common.Action interface. It provides an Action that
+// runs a local command.
+type Action struct {
+	// Common fields and functions for all Actions.
+	common.ActionBase
+
+	// The command that will be run; either a path or the name of an executable
+	// in the PATH. It is run directly, not via a shell.
+	Command string `json:"command"`
+	// The arguments given to the command.
+	Args []string `json:"args"`
+	// How much to wait for the command to finish before killing it. The command
+	// is not killed when no timeout is given.
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Do Implements common.Action.Do().
+// It executes the Exec Action by running the command. It returns an error that
+// includes the command's output if the command cannot be run, if it exits with
+// a non-zero status or if it does not finish within the timeout. The command is
+// killed if the given context is cancelled.
+func (action Action) Do(ctx context.Context, actionContext common.ActionContext) error {
+	if !Allowed() {
+		return ErrNotAllowed
+	}
+
+	if action.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, action.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, action.Command, action.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if action.Timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", action.Timeout)
+	}
+	if err != nil {
+		return fmt.Errorf(
+			"the command \"%s\" failed: %s; stdout: %s; stderr: %s",
+			action.Command,
+			err.Error(),
+			truncate(stdout.Bytes()),
+			truncate(stderr.Bytes()),
+		)
+	}
+
+	return nil
+}
+
+// NewExecAction implements the ActionFactory function type. It creates an Exec
+// Action based on the given JSON-object. It refuses to create the Action if
+// Exec Actions are not allowed.
+var NewExecAction = func(jsonAction *json.RawMessage) (common.Action, error) {
+	if !Allowed() {
+		return nil, ErrNotAllowed
+	}
+
+	// Create an Action object from JSON.
+	var action Action
+	err := json.Unmarshal(*jsonAction, &action)
+	if err != nil {
+		return nil, err
+	}
+
+	if action.Command == "" {
+		return nil, fmt.Errorf("an Exec Action requires a command")
+	}
+
+	return action, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// allowed holds whether Exec Actions are allowed; 1 if they are, 0 otherwise.
+var allowed int32
+
+// truncate returns the given output as a string, truncated to the output limit.
+func truncate(output []byte) string {
+	if len(output) <= OutputLimit {
+		return string(output)
+	}
+
+	return string(output[:OutputLimit]) + "... (truncated)"
+}
@@ -0,0 +1,127 @@
+/**
+ * Tests for the Exec Action.
+ */
+
+package msActionExec
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+)
+
+/**
+ * Helper types and functions reused in various tests.
+ */
+
+// testAction generates an Action object that runs the given command.
+func testAction(command string, args ...string) Action {
+	action := Action{
+		ActionBase: common.ActionBase{
+			Name: "Test Command",
+		},
+		Command: command,
+		Args:    args,
+	}
+	return action
+}
+
+// testAllow allows Exec Actions for the duration of a test.
+func testAllow() func() {
+	Allow(true)
+	return func() { Allow(false) }
+}
+
+/**
+ * Tests.
+ */
+
+func TestExec_Success(t *testing.T) {
+	defer testAllow()()
+
+	action := testAction("sh", "-c", "echo restarted")
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.Nil(t, err)
+}
+
+func TestExec_NonZeroExit(t *testing.T) {
+	defer testAllow()()
+
+	action := testAction("sh", "-c", "echo trying; echo service not found >&2; exit 3")
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "stdout: trying")
+	assert.Contains(t, err.Error(), "stderr: service not found")
+}
+
+func TestExec_Timeout(t *testing.T) {
+	defer testAllow()()
+
+	action := testAction("sleep", "5")
+	action.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out after 50ms")
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestExec_CommandNotFound(t *testing.T) {
+	defer testAllow()()
+
+	action := testAction("/nonexistent/command")
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.NotNil(t, err)
+}
+
+func TestExec_OutputTruncated(t *testing.T) {
+	defer testAllow()()
+
+	action := testAction("sh", "-c", "head -c 10000 /dev/zero | tr '\\0' x; exit 1")
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), strings.Repeat("x", OutputLimit)+"... (truncated)")
+	assert.NotContains(t, err.Error(), strings.Repeat("x", OutputLimit+1))
+}
+
+func TestExec_NotAllowed(t *testing.T) {
+	action := testAction("sh", "-c", "echo restarted")
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.Equal(t, ErrNotAllowed, err)
+}
+
+func TestNewExecAction(t *testing.T) {
+	jsonAction := json.RawMessage(`{"name":"Restart","command":"systemctl","args":["restart","nginx"],"timeout":1000000000}`)
+
+	// Exec Actions cannot be created unless they are allowed.
+	_, err := NewExecAction(&jsonAction)
+	assert.Equal(t, ErrNotAllowed, err)
+
+	defer testAllow()()
+
+	action, err := NewExecAction(&jsonAction)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"restart", "nginx"}, action.(Action).Args)
+	assert.Equal(t, time.Second, action.(Action).Timeout)
+
+	jsonAction = json.RawMessage(`{"name":"Restart"}`)
+	_, err = NewExecAction(&jsonAction)
+	assert.NotNil(t, err)
+}
@@ -6,7 +6,13 @@ package msActionMailgun
 
 import (
 	// Utilities.
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
 
 	// Mailgun.
 	mailgun "gopkg.in/mailgun/mailgun-go.v1"
@@ -15,6 +21,10 @@ import (
 	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
 )
 
+// mailgunActionTimeout defines the HTTP Client's timeout duration in seconds
+// for all Mailgun Message Actions.
+const mailgunActionTimeout = 30
+
 /**
  * Types and their methods.
  */
@@ -26,10 +36,10 @@ type MailgunClient interface {
 	Send(m *mailgun.Message) (string, string, error)
 }
 
-// Action implements the common.Action interface. It provides an Action that
-// sends an email message via Mailgun. The details of the message are hardcoded
-// per action at the moment, but template capabilities will be provided in the
-// future.
+// Action implements the common.Action interface. It provides an Action that sends an email message via Mailgun. The subject and
+// the body of the message are text templates, rendered against the
+// common.ActionContext that the Action is triggered with e.g.
+// "{{.WatchName}} failed with status {{.Status}} at {{.Timestamp}}".
 type Action struct {
 	// Common fields and functions for all Actions.
 	common.ActionBase
@@ -39,31 +49,50 @@ type Action struct {
 	MailgunAPIKey       string `json:"mailgun_api_key"`
 	MailgunPublicAPIKey string `json:"mailgun_public_api_key"`
 
-	// Message details.
-	MessageFrom    string `json:"message_from"`
-	MessageTo      string `json:"message_to"`
-	MessageSubject string `json:"message_subject"`
-	MessageBody    string `json:"message_body"`
+	// Message details. The subject and the body are text templates.
+	// @see https://golang.org/pkg/text/template/
+	MessageFrom string `json:"message_from"`
+	// The recipients, given as a single address or as an array of addresses. A
+	// separate message is sent to each recipient so that recipients do not see
+	// each other's addresses, and so that a failure to send to one recipient
+	// does not prevent sending to the others.
+	MessageTo      common.Targets `json:"message_to"`
+	MessageSubject string         `json:"message_subject"`
+	MessageBody    string         `json:"message_body"`
 
 	// The client used to make the request to the Mailgun API.
 	mailgunClient MailgunClient
 }
 
 // Do Implements common.Action.Do().
-// It executes the Mailgun Action by sending the email message via Mailgun.
-func (action Action) Do() error {
-	message := mailgun.NewMessage(
-		action.MessageFrom,
-		action.MessageSubject,
-		action.MessageBody,
-		action.MessageTo,
-	)
-	_, _, err := action.mailgunClient.Send(message)
+// It executes the Mailgun Action by rendering the message templates against the
+// given context and sending the email message via Mailgun to each recipient.
+// When sending fails for some recipients, the returned error reports all of
+// them. No further messages are sent once the given context is cancelled.
+// @I Abort in-flight requests to the Mailgun API when the context is cancelled
+func (action Action) Do(ctx context.Context, actionContext common.ActionContext) error {
+	subject, body, err := action.render(actionContext)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return action.MessageTo.Do(func(recipient string) error {
+		// The Mailgun client does not accept a context so we can only check
+		// whether it was cancelled before sending each message.
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		message := mailgun.NewMessage(
+			action.MessageFrom,
+			subject,
+			body,
+			recipient,
+		)
+		_, _, err = action.mailgunClient.Send(message)
+		return err
+	})
 }
 
 // SetMailgunClient allows to inject a Mailgun client into the corresponding
@@ -83,13 +112,62 @@ var NewMailgunMessageAction = func(jsonAction *json.RawMessage) (common.Action,
 		return nil, err
 	}
 
+	// Make sure that the templates are valid so that errors are reported when
+	// the Action is created rather than when it is triggered.
+	_, err = template.New("message_subject").Parse(action.MessageSubject)
+	if err != nil {
+		return nil, err
+	}
+	_, err = template.New("message_body").Parse(action.MessageBody)
+	if err != nil {
+		return nil, err
+	}
+
 	// Inject a Mailgun client with the Action's timeout.
 	client := mailgun.NewMailgun(
 		action.MailgunDomain,
 		action.MailgunAPIKey,
 		action.MailgunPublicAPIKey,
 	)
+	client.SetClient(&http.Client{
+		Timeout: mailgunActionTimeout * time.Second,
+	})
 	action.SetMailgunClient(client)
 
 	return action, nil
 }
+
+/**
+ * For internal use.
+ */
+
+// render renders the subject and the body of the message against the given
+// context.
+func (action Action) render(actionContext common.ActionContext) (string, string, error) {
+	subject, err := renderTemplate("message_subject", action.MessageSubject, actionContext)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := renderTemplate("message_body", action.MessageBody, actionContext)
+	if err != nil {
+		return "", "", err
+	}
+
+	return subject, body, nil
+}
+
+// renderTemplate renders the given template text against the given context.
+func renderTemplate(name string, text string, actionContext common.ActionContext) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var output bytes.Buffer
+	err = tmpl.Execute(&output, actionContext)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the \"%s\" template: %s", name, err.Error())
+	}
+
+	return output.String(), nil
+}
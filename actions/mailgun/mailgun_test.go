@@ -13,7 +13,11 @@ import (
 	mailgun "gopkg.in/mailgun/mailgun-go.v1"
 
 	// Utilities.
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	// Internal dependencies.
 	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
@@ -27,13 +31,13 @@ import (
 func testAction() Action {
 	action := Action{
 		common.ActionBase{
-			"Test Message",
+			Name: "Test Message",
 		},
 		"example.com",
 		"test-api-key",
 		"test-public-api-key",
 		"sender@example.com",
-		"recipient@example.com",
+		common.Targets{"recipient@example.com"},
 		"Test email subject",
 		"Test email body",
 		nil,
@@ -55,6 +59,25 @@ func (client MockMailgunClientFailure) Send(m *mailgun.Message) (string, string,
 	return "", "", fmt.Errorf("there has been an error while sending the email message")
 }
 
+// MockMailgunClientCount counts the email messages sent, and simulates failure
+// while sending the messages at the given positions, starting from 0. The
+// recipients of a message are not accessible via the Mailgun message so the
+// messages are identified by the order in which they are sent.
+type MockMailgunClientCount struct {
+	count    int
+	failures map[int]bool
+}
+
+func (client *MockMailgunClientCount) Send(m *mailgun.Message) (string, string, error) {
+	index := client.count
+	client.count++
+	if client.failures[index] {
+		return "", "", fmt.Errorf("there has been an error while sending the email message")
+	}
+
+	return "Email message successfully send", "id.example.mailgun.com", nil
+}
+
 /**
  * Tests.
  */
@@ -63,7 +86,7 @@ func TestMailgunMessage_Success(t *testing.T) {
 	action := testAction()
 	client := MockMailgunClientSuccess{}
 	action.SetMailgunClient(client)
-	err := action.Do()
+	err := action.Do(context.Background(), common.ActionContext{})
 
 	assert.Nil(t, err)
 }
@@ -72,7 +95,123 @@ func TestMailgunMessage_Failure(t *testing.T) {
 	action := testAction()
 	client := MockMailgunClientFailure{}
 	action.SetMailgunClient(client)
-	err := action.Do()
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.NotNil(t, err)
+}
+
+func TestMailgunMessage_SingleRecipient(t *testing.T) {
+	jsonAction := json.RawMessage(`{"name":"Test Message","message_to":"recipient@example.com"}`)
+	action, err := NewMailgunMessageAction(&jsonAction)
+	assert.Nil(t, err)
+	assert.Equal(t, common.Targets{"recipient@example.com"}, action.(Action).MessageTo)
+
+	client := &MockMailgunClientCount{}
+	mailgunAction := action.(Action)
+	mailgunAction.SetMailgunClient(client)
+	err = mailgunAction.Do(context.Background(), common.ActionContext{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, client.count)
+
+	// A single recipient is stored as it was given.
+	jsonMailgunAction, err := json.Marshal(mailgunAction)
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonMailgunAction), `"message_to":"recipient@example.com"`)
+}
+
+func TestMailgunMessage_MultipleRecipients(t *testing.T) {
+	jsonAction := json.RawMessage(`{"name":"Test Message","message_to":["one@example.com","two@example.com","three@example.com"]}`)
+	action, err := NewMailgunMessageAction(&jsonAction)
+	assert.Nil(t, err)
+	assert.Equal(t, common.Targets{"one@example.com", "two@example.com", "three@example.com"}, action.(Action).MessageTo)
+
+	client := &MockMailgunClientCount{}
+	mailgunAction := action.(Action)
+	mailgunAction.SetMailgunClient(client)
+	err = mailgunAction.Do(context.Background(), common.ActionContext{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, client.count)
+
+	jsonAction = json.RawMessage(`{"name":"Test Message","message_to":5}`)
+	_, err = NewMailgunMessageAction(&jsonAction)
+	assert.NotNil(t, err)
+}
+
+func TestMailgunMessage_PartialFailure(t *testing.T) {
+	action := testAction()
+	action.MessageTo = common.Targets{"one@example.com", "two@example.com", "three@example.com"}
+	client := &MockMailgunClientCount{failures: map[int]bool{0: true, 2: true}}
+	action.SetMailgunClient(client)
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	// Messages are sent to the remaining recipients after a failure, and all
+	// recipients that failed are reported.
+	assert.Equal(t, 3, client.count)
+	assert.EqualError(
+		t,
+		err,
+		"the Action failed for 2 of 3 targets: "+
+			"\"one@example.com\": there has been an error while sending the email message; "+
+			"\"three@example.com\": there has been an error while sending the email message",
+	)
+	targetsErr, ok := err.(common.TargetsError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, targetsErr.Total)
+	assert.Len(t, targetsErr.Errors, 2)
+}
+
+func TestMailgunMessage_Cancel(t *testing.T) {
+	action := testAction()
+	action.MessageTo = common.Targets{"one@example.com", "two@example.com"}
+	client := &MockMailgunClientCount{}
+	action.SetMailgunClient(client)
+
+	// No messages are sent once the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := action.Do(ctx, common.ActionContext{})
+	assert.Equal(t, 0, client.count)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+}
+
+func TestMailgunMessage_Render(t *testing.T) {
+	action := testAction()
+	action.MessageSubject = "[{{.Status}}] {{.WatchName}}"
+	action.MessageBody = "The Watch \"{{.WatchName}}\" reported \"{{.Status}}\" at {{.Timestamp.Format \"2006-01-02 15:04\"}}."
+
+	actionContext := common.ActionContext{
+		WatchName: "example.com health",
+		Status:    "inaccessible",
+		Timestamp: time.Date(2017, 5, 1, 10, 30, 0, 0, time.UTC),
+	}
+	subject, body, err := action.render(actionContext)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "[inaccessible] example.com health", subject)
+	assert.Equal(t, "The Watch \"example.com health\" reported \"inaccessible\" at 2017-05-01 10:30.", body)
+
+	// Messages without template actions are sent as they are.
+	subject, body, err = testAction().render(actionContext)
+	assert.Nil(t, err)
+	assert.Equal(t, "Test email subject", subject)
+	assert.Equal(t, "Test email body", body)
+}
+
+func TestMailgunMessage_RenderFailure(t *testing.T) {
+	action := testAction()
+	action.MessageBody = "{{.Unknown}}"
+	action.SetMailgunClient(MockMailgunClientSuccess{})
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.NotNil(t, err)
+}
+
+func TestNewMailgunMessageAction(t *testing.T) {
+	jsonAction := json.RawMessage(`{"name":"Test Message","message_subject":"{{.WatchName}} is down","message_body":"Status: {{.Status}}"}`)
+	_, err := NewMailgunMessageAction(&jsonAction)
+	assert.Nil(t, err)
 
+	jsonAction = json.RawMessage(`{"name":"Test Message","message_subject":"{{.WatchName","message_body":""}`)
+	_, err = NewMailgunMessageAction(&jsonAction)
 	assert.NotNil(t, err)
 }
@@ -0,0 +1,185 @@
+/**
+ * Provides an action for triggering an incident in PagerDuty via the Events API
+ * v2.
+ */
+
+package msActionPagerDuty
+
+import (
+	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+)
+
+/**
+ * Constants.
+ */
+
+// EventsURL holds the URL of the PagerDuty Events API v2 endpoint that events
+// are sent to.
+const EventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// SeverityDefault holds the severity of the events when no severity is given.
+const SeverityDefault = "error"
+
+// pagerDutyActionTimeout defines the HTTP Client's timeout duration in seconds
+// for all PagerDuty Actions.
+const pagerDutyActionTimeout = 30
+
+/**
+ * Types and their methods.
+ */
+
+// HTTPClient is an interface that is used to allow dependency injection of the
+// HTTP client that makes the request to the Events API. Dependency injection is
+// necessary for testing purposes.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Action implements the common.Action interface. It provides an Action that
+// triggers an incident in PagerDuty by sending a "trigger" event to the Events
+// API v2.
+type Action struct {
+	// Common fields and functions for all Actions.
+	common.ActionBase
+
+	// The integration key of the PagerDuty service that the event is sent to.
+	RoutingKey string `json:"routing_key"`
+	// A brief description of the problem, used as the incident's title.
+	Summary string `json:"summary"`
+	// The severity of the problem; one of "critical", "error", "warning" or
+	// "info". Defaults to "error".
+	Severity string `json:"severity"`
+	// The affected system e.g. a hostname.
+	Source string `json:"source"`
+	// Identifies the incident that the event belongs to. Events with the same key
+	// are grouped into the same open incident, so that triggering the Action
+	// repeatedly does not open a new incident every time. PagerDuty generates a
+	// new key for every event when not given.
+	DedupKey string `json:"dedup_key,omitempty"`
+	// The User-Agent header sent with the request. Defaults to the User-Agent of
+	// all Actions e.g. "mantis-shrimp/action/1.0.0".
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// The HTTP client used to make the request to the Events API.
+	httpClient HTTPClient
+}
+
+// Do Implements common.Action.Do().
+// It executes the PagerDuty Action by sending a "trigger" event to the Events
+// API. PagerDuty accepts events asynchronously; any response other than 202
+// Accepted is considered a failure. The request is aborted if the given context
+// is cancelled.
+func (action Action) Do(ctx context.Context, actionContext common.ActionContext) error {
+	body, err := json.Marshal(action.event())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, EventsURL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	userAgent := action.UserAgent
+	if userAgent == "" {
+		userAgent = util.UserAgent("action")
+	}
+	req.Header.Set("User-Agent", userAgent)
+	res, err := action.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf(
+			"PagerDuty responded with status \"%s\" to the event: %s",
+			res.Status,
+			string(resBody),
+		)
+	}
+
+	return nil
+}
+
+// SetHTTPClient allows to inject an HTTP client into the corresponding field.
+func (action *Action) SetHTTPClient(client HTTPClient) {
+	action.httpClient = client
+}
+
+// event builds the event that is sent to the Events API.
+func (action Action) event() Event {
+	severity := action.Severity
+	if severity == "" {
+		severity = SeverityDefault
+	}
+
+	return Event{
+		RoutingKey:  action.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    action.DedupKey,
+		Payload: EventPayload{
+			Summary:  action.Summary,
+			Source:   action.Source,
+			Severity: severity,
+		},
+	}
+}
+
+// Event holds an event as required by the PagerDuty Events API v2.
+// @see https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+type Event struct {
+	RoutingKey  string       `json:"routing_key"`
+	EventAction string       `json:"event_action"`
+	DedupKey    string       `json:"dedup_key,omitempty"`
+	Payload     EventPayload `json:"payload"`
+}
+
+// EventPayload holds the details of the problem that an event is about.
+type EventPayload struct {
+	Summary  string `json:"summary"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+// NewPagerDutyAction implements the ActionFactory function type. It creates a
+// PagerDuty Action based on the given JSON-object, and initializes it by
+// injecting the required HTTP client.
+var NewPagerDutyAction = func(jsonAction *json.RawMessage) (common.Action, error) {
+	// Create an Action object from JSON.
+	var action Action
+	err := json.Unmarshal(*jsonAction, &action)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Events API rejects events without these fields.
+	if action.RoutingKey == "" || action.Summary == "" || action.Source == "" {
+		return nil, fmt.Errorf("a PagerDuty Action requires a routing key, a summary and a source")
+	}
+	switch action.Severity {
+	case "", "critical", "error", "warning", "info":
+	default:
+		return nil, fmt.Errorf("unknown PagerDuty severity \"%s\"", action.Severity)
+	}
+
+	// Inject an HTTP client with the Action's timeout.
+	client := &http.Client{
+		Timeout: pagerDutyActionTimeout * time.Second,
+	}
+	action.SetHTTPClient(client)
+
+	return action, nil
+}
@@ -0,0 +1,163 @@
+/**
+ * Tests for the PagerDuty Action.
+ */
+
+package msActionPagerDuty
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+)
+
+/**
+ * Helper types and functions reused in various tests.
+ */
+
+// testAction generates an Action object with some defaults.
+func testAction() Action {
+	action := Action{
+		ActionBase: common.ActionBase{
+			Name: "Test Incident",
+		},
+		RoutingKey: "test-routing-key",
+		Summary:    "example.com is down",
+		Severity:   "critical",
+		Source:     "example.com",
+		DedupKey:   "example.com-down",
+	}
+	return action
+}
+
+// MockHTTPClient records the request made to it and responds with the given
+// status.
+type MockHTTPClient struct {
+	status      int
+	URL         string
+	contentType string
+	userAgent   string
+	body        []byte
+}
+
+func (client *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	client.URL = req.URL.String()
+	client.contentType = req.Header.Get("Content-Type")
+	client.userAgent = req.Header.Get("User-Agent")
+	client.body, _ = ioutil.ReadAll(req.Body)
+
+	response := &http.Response{
+		StatusCode: client.status,
+		Status:     fmt.Sprintf("%d %s", client.status, http.StatusText(client.status)),
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"status":"success"}`)),
+	}
+
+	return response, nil
+}
+
+// MockHTTPClientError simulates a network error.
+type MockHTTPClientError struct{}
+
+func (client MockHTTPClientError) Do(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("cannot reach the Events API")
+}
+
+/**
+ * Tests.
+ */
+
+func TestPagerDuty_Success(t *testing.T) {
+	action := testAction()
+	client := &MockHTTPClient{status: http.StatusAccepted}
+	action.SetHTTPClient(client)
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, EventsURL, client.URL)
+	assert.Equal(t, "application/json", client.contentType)
+	assert.Equal(t, util.UserAgent("action"), client.userAgent)
+	assert.JSONEq(
+		t,
+		`{
+			"routing_key": "test-routing-key",
+			"event_action": "trigger",
+			"dedup_key": "example.com-down",
+			"payload": {
+				"summary": "example.com is down",
+				"source": "example.com",
+				"severity": "critical"
+			}
+		}`,
+		string(client.body),
+	)
+}
+
+func TestPagerDuty_Defaults(t *testing.T) {
+	action := testAction()
+	action.Severity = ""
+	action.DedupKey = ""
+	client := &MockHTTPClient{status: http.StatusAccepted}
+	action.SetHTTPClient(client)
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	// The dedup key should be omitted so that PagerDuty generates one.
+	assert.Nil(t, err)
+	assert.JSONEq(
+		t,
+		`{
+			"routing_key": "test-routing-key",
+			"event_action": "trigger",
+			"payload": {
+				"summary": "example.com is down",
+				"source": "example.com",
+				"severity": "error"
+			}
+		}`,
+		string(client.body),
+	)
+}
+
+func TestPagerDuty_StatusFailure(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest, http.StatusTooManyRequests} {
+		action := testAction()
+		action.SetHTTPClient(&MockHTTPClient{status: status})
+		err := action.Do(context.Background(), common.ActionContext{})
+
+		assert.NotNil(t, err, "%d", status)
+	}
+}
+
+func TestPagerDuty_Error(t *testing.T) {
+	action := testAction()
+	action.SetHTTPClient(MockHTTPClientError{})
+	err := action.Do(context.Background(), common.ActionContext{})
+
+	assert.NotNil(t, err)
+}
+
+func TestNewPagerDutyAction(t *testing.T) {
+	jsonAction := json.RawMessage(`{"name":"Test Incident","routing_key":"key","summary":"Down","source":"example.com","severity":"warning"}`)
+	action, err := NewPagerDutyAction(&jsonAction)
+	assert.Nil(t, err)
+	assert.Equal(t, "warning", action.(Action).Severity)
+	assert.NotNil(t, action.(Action).httpClient)
+
+	jsonAction = json.RawMessage(`{"routing_key":"key","summary":"Down"}`)
+	_, err = NewPagerDutyAction(&jsonAction)
+	assert.NotNil(t, err)
+
+	jsonAction = json.RawMessage(`{"routing_key":"key","summary":"Down","source":"example.com","severity":"fatal"}`)
+	_, err = NewPagerDutyAction(&jsonAction)
+	assert.EqualError(t, err, "unknown PagerDuty severity \"fatal\"")
+}
@@ -7,29 +7,110 @@ package msActionSDK
 import (
 	// Utilities.
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/actions/wrapper"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
 )
 
+// HTTPClient is an interface that is used to allow dependency injection of the
+// HTTP client that makes the requests to the Action API. Dependency injection
+// is necessary for testing purposes.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
 // Config holds any configuration required to perform calls to the Action API.
 type Config struct {
 	BaseURL string
 	Version string
+	// The token used to authenticate with the API, if it requires
+	// authentication.
+	AuthToken string
+	// The User-Agent header sent with the requests, identifying the component
+	// that makes them e.g. "mantis-shrimp/cron/1.0.0". Defaults to the
+	// User-Agent of the SDK.
+	UserAgent string
+	// The HTTP client that makes the requests. Defaults to the default client of
+	// the net/http package.
+	HTTPClient HTTPClient
+}
+
+// Create makes a POST request that creates the Action held in the given
+// ActionWrapper, and it returns the ID of the new Action.
+func Create(actionWrapper wrapper.ActionWrapper, config Config) (int, error) {
+	// Prepare the URL and the request body.
+	url := config.BaseURL + "/v" + config.Version + "/"
+	body, err := json.Marshal(actionWrapper)
+	if err != nil {
+		return 0, err
+	}
+
+	// Make the request.
+	req, err := request("POST", url, body, config)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client(config).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Response status should always be 200.
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf(
+			"response Status not \"200 OK\" when creating an Action; Status: \"%d\", Headers: \"%s\", Body: \"%s\"",
+			res.StatusCode,
+			res.Header,
+			resBody,
+		)
+		return 0, err
+	}
+
+	var response struct {
+		ID *int `json:"id"`
+	}
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.ID == nil {
+		return 0, fmt.Errorf("the response does not contain the ID of the created Action; Body: \"%s\"", resBody)
+	}
+
+	return *response.ID, nil
 }
 
 // TriggerByID makes a POST request that triggers the Action that corresponds to
-// the given ID.
-func TriggerByID(id int, config Config) error {
+// the given ID. The given context is passed on to the Action.
+func TriggerByID(id int, actionContext common.ActionContext, config Config) error {
 	// Prepare the URL and the request body.
 	idString := strconv.Itoa(id)
 	url := config.BaseURL + "/v" + config.Version + "/" + idString + "/trigger"
-	body := []byte{}
+	body, err := json.Marshal(actionContext)
+	if err != nil {
+		return err
+	}
 
 	// Make the request.
-	client := &http.Client{}
-	res, err := client.Post(url, "application/json", bytes.NewBuffer(body))
+	req, err := request("POST", url, body, config)
+	if err != nil {
+		return err
+	}
+	res, err := client(config).Do(req)
 	if err != nil {
 		return err
 	}
@@ -58,3 +139,114 @@ func TriggerByID(id int, config Config) error {
 
 	return nil
 }
+
+// GetByID makes a GET request that retrieves the Action that corresponds to the
+// given ID. It returns the Action together with its type, as a JSON-encoded
+// ActionWrapper that can be given to wrapper.Create() or decoded into an
+// ActionWrapper. The returned error wraps errorsUtil.ErrNotFound if there is no
+// Action with such ID.
+func GetByID(id int, config Config) (json.RawMessage, error) {
+	url := config.BaseURL + "/v" + config.Version + "/" + strconv.Itoa(id)
+
+	// Make the request.
+	req, err := request("GET", url, nil, config)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client(config).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("the Action with ID \"%d\" was %w", id, errorsUtil.ErrNotFound)
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf(
+			"response Status not \"200 OK\" when getting an Action by its ID; Status: \"%d\", Headers: \"%s\", Body: \"%s\"",
+			res.StatusCode,
+			res.Header,
+			resBody,
+		)
+		return nil, err
+	}
+
+	// The Action is returned together with its type, in the same structure as
+	// the ActionWrapper.
+	var response struct {
+		Type   *string          `json:"type"`
+		Action *json.RawMessage `json:"action"`
+	}
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the response when getting an Action by its ID: %s", err.Error())
+	}
+	if response.Type == nil || response.Action == nil {
+		return nil, fmt.Errorf("the response does not contain the requested Action; Body: \"%s\"", resBody)
+	}
+
+	return json.Marshal(struct {
+		Type   string          `json:"type"`
+		Action json.RawMessage `json:"action"`
+	}{*response.Type, *response.Action})
+}
+
+// GetMulti makes concurrent GET requests that retrieve the Actions that
+// correspond to the given IDs, in the same way as GetByID(). It returns the
+// JSON-encoded ActionWrappers and the errors in the order of the given IDs; for
+// each ID, either the Action or the error is nil.
+func GetMulti(ids []int, config Config) ([]json.RawMessage, []error) {
+	jsonActions := make([]json.RawMessage, len(ids))
+	errs := make([]error, len(ids))
+
+	var wg sync.WaitGroup
+	for index, id := range ids {
+		wg.Add(1)
+		go func(index int, id int) {
+			defer wg.Done()
+			jsonActions[index], errs[index] = GetByID(id, config)
+		}(index, id)
+	}
+	wg.Wait()
+
+	return jsonActions, errs
+}
+
+/**
+ * For internal use.
+ */
+
+// request builds a request to the Action API with the given JSON body and the
+// headers required by the given configuration.
+func request(method string, url string, body []byte, config Config) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.AuthToken)
+	}
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = util.UserAgent("sdk")
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	return req, nil
+}
+
+// client returns the HTTP client given in the configuration, or the default
+// client if none is given.
+func client(config Config) HTTPClient {
+	if config.HTTPClient != nil {
+		return config.HTTPClient
+	}
+
+	return &http.Client{}
+}
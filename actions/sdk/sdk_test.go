@@ -0,0 +1,202 @@
+/**
+ * Tests for the msActionSDK module.
+ */
+
+package msActionSDK
+
+import (
+	// Utilities.
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	chat "github.com/krystalcode/go-mantis-shrimp/actions/chat"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/actions/wrapper"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+)
+
+/**
+ * Tests.
+ */
+
+func TestCreate(t *testing.T) {
+	var method, path, authorization string
+	var decoded wrapper.ActionWrapper
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &decoded)
+		w.Write([]byte(`{"status":200,"id":3}`))
+	}))
+	defer server.Close()
+
+	config := testConfig(server.URL)
+	id, err := Create(testActionWrapper(), config)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, id)
+	assert.Equal(t, "POST", method)
+	assert.Equal(t, "/v1/", path)
+	assert.Equal(t, "Bearer secret", authorization)
+	assert.Equal(t, "chat_message", decoded.Type)
+	assert.Equal(t, "https://hooks.example.com/abc", decoded.Action.(chat.Action).URL)
+}
+
+func TestCreate_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":400}`))
+	}))
+	defer server.Close()
+
+	_, err := Create(testActionWrapper(), testConfig(server.URL))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Status: \"400\"")
+}
+
+func TestCreate_MissingID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":200}`))
+	}))
+	defer server.Close()
+
+	_, err := Create(testActionWrapper(), testConfig(server.URL))
+	assert.NotNil(t, err)
+}
+
+func TestGetByID(t *testing.T) {
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		if path != "/v1/3" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status":404}`))
+			return
+		}
+		w.Write([]byte(`{"status":200,"id":3,"type":"chat_message","action":{"url":"https://hooks.example.com/abc"}}`))
+	}))
+	defer server.Close()
+
+	jsonAction, err := GetByID(3, testConfig(server.URL))
+	assert.Nil(t, err)
+	assert.Equal(t, "GET", method)
+	assert.JSONEq(t, `{"type":"chat_message","action":{"url":"https://hooks.example.com/abc"}}`, string(jsonAction))
+
+	action, err := wrapper.Create(jsonAction)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://hooks.example.com/abc", action.(chat.Action).URL)
+
+	_, err = GetByID(4, testConfig(server.URL))
+	assert.True(t, errors.Is(err, errorsUtil.ErrNotFound))
+}
+
+func TestGetByID_InvalidResponse(t *testing.T) {
+	responses := map[string]int{
+		`{"status":200`:                   http.StatusOK,
+		`{"status":200,"id":3}`:           http.StatusOK,
+		`{"status":200,"type":"unknown"}`: http.StatusOK,
+		`{"status":500}`:                  http.StatusInternalServerError,
+	}
+
+	for body, status := range responses {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+
+		jsonAction, err := GetByID(3, testConfig(server.URL))
+		assert.Nil(t, jsonAction, body)
+		assert.NotNil(t, err, body)
+		assert.False(t, errors.Is(err, errorsUtil.ErrNotFound), body)
+		server.Close()
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/3":
+			w.Write([]byte(`{"status":200,"id":3,"type":"chat_message","action":{"url":"https://hooks.example.com/3"}}`))
+		case "/v1/5":
+			w.Write([]byte(`{"status":200,"id":5,"type":"chat_message","action":{"url":"https://hooks.example.com/5"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status":404}`))
+		}
+	}))
+	defer server.Close()
+
+	// The Actions and the errors are returned in the order of the IDs.
+	jsonActions, errs := GetMulti([]int{5, 4, 3}, testConfig(server.URL))
+	assert.Len(t, jsonActions, 3)
+	assert.Len(t, errs, 3)
+	assert.Nil(t, errs[0])
+	assert.JSONEq(t, `{"type":"chat_message","action":{"url":"https://hooks.example.com/5"}}`, string(jsonActions[0]))
+	assert.Nil(t, jsonActions[1])
+	assert.True(t, errors.Is(errs[1], errorsUtil.ErrNotFound))
+	assert.Nil(t, errs[2])
+	assert.JSONEq(t, `{"type":"chat_message","action":{"url":"https://hooks.example.com/3"}}`, string(jsonActions[2]))
+
+	jsonActions, errs = GetMulti(nil, testConfig(server.URL))
+	assert.Empty(t, jsonActions)
+	assert.Empty(t, errs)
+}
+
+func TestCreate_HTTPClient(t *testing.T) {
+	client := &testHTTPClient{}
+	config := testConfig("http://ms-action-api:8888")
+	config.HTTPClient = client
+
+	id, err := Create(testActionWrapper(), config)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "http://ms-action-api:8888/v1/", client.url)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testHTTPClient is an HTTP client that records the URL of the request and
+// responds with the ID of a created Action, without making the request.
+type testHTTPClient struct {
+	url string
+}
+
+func (client *testHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	client.url = req.URL.String()
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(`{"status":200,"id":1}`)),
+	}
+
+	return response, nil
+}
+
+// testConfig returns the configuration for the Action API at the given URL.
+func testConfig(baseURL string) Config {
+	return Config{
+		BaseURL:   baseURL,
+		Version:   "1",
+		AuthToken: "secret",
+	}
+}
+
+// testActionWrapper returns an ActionWrapper holding a Chat Message Action.
+func testActionWrapper() wrapper.ActionWrapper {
+	return wrapper.ActionWrapper{
+		Type:   "chat_message",
+		Action: chat.Action{URL: "https://hooks.example.com/abc"},
+	}
+}
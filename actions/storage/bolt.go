@@ -0,0 +1,324 @@
+/**
+ * Provides a BoltDB storage adapter for storing and retrieving actions.
+ *
+ * It stores Actions in a file on the local filesystem, and it is intended for
+ * single-node deployments where running a Redis server is not necessary.
+ */
+
+package msActionStorage
+
+import (
+	// Utilities
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// BoltDB.
+	bolt "go.etcd.io/bbolt"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/actions/wrapper"
+	boltUtil "github.com/krystalcode/go-mantis-shrimp/util/bolt"
+)
+
+/**
+ * Constants.
+ */
+
+// boltActionsBucket holds the name of the bucket that Actions are stored in,
+// keyed by their IDs.
+var boltActionsBucket = []byte("actions")
+
+// boltIdempotencyKeysBucket holds the name of the bucket that the IDs of the
+// Actions created with idempotency keys are stored in, keyed by the idempotency
+// keys.
+var boltIdempotencyKeysBucket = []byte("action_idempotency_keys")
+
+/**
+ * Bolt storage provider.
+ */
+
+// Bolt implements the Storage interface, allowing to use BoltDB as a Storage
+// engine.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// Make sure that the Bolt storage engine conforms to the Storage interface.
+var _ Storage = Bolt{}
+
+// Get implements Storage.Get(). It retrieves from Storage and returns the
+// Action for the given ID, or ErrNotFound if there is no Action with such ID.
+func (storage Bolt) Get(id int) (*common.Action, error) {
+	var jsonAction []byte
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltActionsBucket).Get(boltUtil.Key(id))
+		if value == nil {
+			return ErrNotFound
+		}
+
+		// Values are only valid during the transaction.
+		jsonAction = append([]byte{}, value...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create and initialize an Action object based on the given JSON object.
+	action, err := wrapper.Create(jsonAction)
+	if err != nil {
+		return nil, err
+	}
+
+	return &action, nil
+}
+
+// Exists implements Storage.Exists(). It returns whether an Action with the
+// given ID exists in the Storage, without loading it.
+func (storage Bolt) Exists(id int) (bool, error) {
+	exists := false
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(boltActionsBucket).Get(boltUtil.Key(id)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Create implements Storage.Create(). It stores the given Action object in the
+// Bolt Storage and it returns an automatically generated ID.
+func (storage Bolt) Create(action common.Action) (*int, error) {
+	// Set the CreatedAt field, if not yet set.
+	base, err := common.Base(action)
+	if err != nil {
+		return nil, err
+	}
+	if base.CreatedAt == nil {
+		now := time.Now()
+		base.CreatedAt = &now
+		err = common.SetBase(&action, *base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Generate the ID and store the Action in the same transaction, so that no
+	// ID is used up if the Action cannot be stored.
+	var id int
+	err = storage.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		id, err = storage.create(tx.Bucket(boltActionsBucket), action)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+// CreateWithKey implements Storage.CreateWithKey(). The idempotency key is
+// looked up and the Action is created in the same transaction, so that
+// concurrent requests with the same key do not create more than one Action.
+func (storage Bolt) CreateWithKey(key string, ttl time.Duration, action common.Action) (*int, bool, error) {
+	// @I Remove expired idempotency keys from the Bolt Storage
+
+	// Set the CreatedAt field, if not yet set.
+	base, err := common.Base(action)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	if base.CreatedAt == nil {
+		base.CreatedAt = &now
+		err = common.SetBase(&action, *base)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	var id int
+	created := false
+	err = storage.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(boltIdempotencyKeysBucket)
+		if value := keys.Get([]byte(key)); value != nil {
+			var record boltIdempotencyKey
+			err := json.Unmarshal(value, &record)
+			if err != nil {
+				return err
+			}
+			if now.Before(record.ExpiresAt) {
+				id = record.ID
+				return nil
+			}
+		}
+
+		var err error
+		id, err = storage.create(tx.Bucket(boltActionsBucket), action)
+		if err != nil {
+			return err
+		}
+		created = true
+
+		value, err := json.Marshal(boltIdempotencyKey{ID: id, ExpiresAt: now.Add(ttl)})
+		if err != nil {
+			return err
+		}
+		return keys.Put([]byte(key), value)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &id, created, nil
+}
+
+// Update implements Storage.Update(). It stores the given Action object in the
+// Bolt Storage, overriding the existing value with the given ID.
+func (storage Bolt) Update(id int, action common.Action) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		return storage.set(tx.Bucket(boltActionsBucket), id, action)
+	})
+}
+
+// ListSince implements Storage.ListSince(). It retrieves from Storage and
+// returns up to the given number of Actions (limit) with IDs greater than the
+// given ID (since), in the order of their IDs, seeking directly to the first of
+// them. It also returns the ID to be given as the cursor for the next page, or
+// 0 if there are no more Actions. Actions that cannot be loaded, such as when
+// their stored value is corrupted, do not abort the listing; they are skipped
+// and the corresponding errors are returned in the third slice.
+func (storage Bolt) ListSince(since int, limit int) ([]*common.Action, int, []error, error) {
+	if limit < 1 {
+		return []*common.Action{}, 0, nil, nil
+	}
+
+	jsonActions := map[int][]byte{}
+	var ids []int
+	more := false
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltActionsBucket).Cursor()
+		for key, value := cursor.Seek(boltUtil.Key(since + 1)); key != nil; key, value = cursor.Next() {
+			if len(ids) == limit {
+				more = true
+				break
+			}
+
+			id := boltUtil.ID(key)
+			ids = append(ids, id)
+			jsonActions[id] = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	actions := make([]*common.Action, 0, len(ids))
+	var errs []error
+	for _, id := range ids {
+		action, err := wrapper.Create(jsonActions[id])
+		if err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("failed to load the Action with ID \"%d\": %s", id, err.Error()),
+			)
+			continue
+		}
+
+		actions = append(actions, &action)
+	}
+
+	next := 0
+	if more {
+		next = ids[len(ids)-1]
+	}
+
+	return actions, next, errs, nil
+}
+
+// Ping implements Storage.Ping(). It checks whether the database is still open
+// by starting a read-only transaction.
+func (storage Bolt) Ping() error {
+	return storage.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// create stores an Action object in the given bucket with a newly generated
+// ID, and it returns the ID.
+func (storage Bolt) create(bucket *bolt.Bucket, action common.Action) (int, error) {
+	sequence, err := bucket.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	id := int(sequence)
+
+	return id, storage.set(bucket, id, action)
+}
+
+// set stores an Action object in the given bucket at the key corresponding to
+// the given ID.
+func (storage Bolt) set(bucket *bolt.Bucket, id int, action common.Action) error {
+	// Update the UpdatedAt field.
+	base, err := common.Base(action)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	base.UpdatedAt = &now
+	err = common.SetBase(&action, *base)
+	if err != nil {
+		return err
+	}
+
+	// We'll be storing an ActionWrapper which contains the Action type as well.
+	actionWrapper, err := wrapper.Wrapper(action)
+	if err != nil {
+		return err
+	}
+	jsonAction, err := json.Marshal(actionWrapper)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(boltUtil.Key(id), jsonAction)
+}
+
+// NewBoltStorage implements the StorageFactory function type. It opens the Bolt
+// database stored at the file defined in the given configuration, and it
+// returns the Storage engine object. The Storage engine can be shared by
+// concurrent requests.
+var NewBoltStorage = func(config map[string]interface{}) (Storage, error) {
+	db, err := boltUtil.Open(config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = boltUtil.CreateBucket(db, boltActionsBucket)
+	if err != nil {
+		return nil, err
+	}
+	err = boltUtil.CreateBucket(db, boltIdempotencyKeysBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return Bolt{db: db}, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// boltIdempotencyKey holds the ID of the Action created with an idempotency
+// key, together with the time that the key expires.
+type boltIdempotencyKey struct {
+	ID        int       `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,150 @@
+/**
+ * Tests for the Bolt Action Storage API.
+ */
+
+package msActionStorage
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	// Internal dependencies.
+	chat "github.com/krystalcode/go-mantis-shrimp/actions/chat"
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+)
+
+/**
+ * Tests.
+ */
+
+func TestNewBoltStorage_MissingPath(t *testing.T) {
+	_, err := Create(map[string]interface{}{"type": "bolt"})
+	assert.NotNil(t, err)
+}
+
+func TestBolt_CRUD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ms_action_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage, err := Create(map[string]interface{}{
+		"type": "bolt",
+		"path": filepath.Join(dir, "actions.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, storage.Ping())
+
+	// Create.
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *id)
+
+	// Get.
+	pAction, err := storage.Get(*id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Chat webhook", (*pAction).(chat.Action).URL)
+	base, err := common.Base(*pAction)
+	assert.Nil(t, err)
+	assert.NotNil(t, base.CreatedAt)
+	assert.NotNil(t, base.UpdatedAt)
+
+	// Exists.
+	exists, err := storage.Exists(*id)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = storage.Exists(2)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	// Update.
+	chatAction := (*pAction).(chat.Action)
+	chatAction.URL = "Other chat webhook"
+	err = storage.Update(*id, chatAction)
+	assert.Nil(t, err)
+	pAction, err = storage.Get(*id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Other chat webhook", (*pAction).(chat.Action).URL)
+
+	// Not found.
+	_, err = storage.Get(2)
+	assert.Equal(t, ErrNotFound, err)
+
+	// IDs keep incrementing.
+	id, err = storage.Create(*action)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *id)
+}
+
+func TestBolt_CreateWithKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ms_action_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage, err := Create(map[string]interface{}{
+		"type": "bolt",
+		"path": filepath.Join(dir, "actions.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+	id, created, err := storage.CreateWithKey("key-1", time.Hour, *action)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 1, *id)
+
+	// The same key yields the same Action.
+	repeatedID, created, err := storage.CreateWithKey("key-1", time.Hour, *action)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, *id, *repeatedID)
+
+	// A different key yields a new Action.
+	otherID, created, err := storage.CreateWithKey("key-2", time.Hour, *action)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 2, *otherID)
+
+	// An expired key yields a new Action.
+	_, _, err = storage.CreateWithKey("key-3", -time.Second, *action)
+	assert.Nil(t, err)
+	expiredID, created, err := storage.CreateWithKey("key-3", time.Hour, *action)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 4, *expiredID)
+}
+
+func TestBolt_ListSince(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ms_action_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage, err := Create(map[string]interface{}{
+		"type": "bolt",
+		"path": filepath.Join(dir, "actions.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testListSince(t, storage)
+}
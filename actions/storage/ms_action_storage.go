@@ -7,20 +7,42 @@ package msActionStorage
 import (
 	// Utilities.
 	"fmt"
+	"sync"
+	"time"
 
 	// Internal dependencies.
 	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
 )
 
 /**
  * Public API.
  */
 
+// ErrNotFound is returned when trying to get an Action that does not exist
+// in the Storage.
+var ErrNotFound = fmt.Errorf("the Action was %w", errorsUtil.ErrNotFound)
+
+// ErrKeyInUse is returned when trying to create an Action with an idempotency
+// key while the Action for the same key is still being created.
+var ErrKeyInUse = fmt.Errorf("an Action is still being created for the idempotency key")
+
 // Storage is an interface that should be implemented by all Storage engines.
-// It defines an API for storing and retrieving Action objects.
+// It defines an API for storing, retrieving and listing Action objects, and for
+// checking whether the Storage is available.
+//
+// CreateWithKey creates an Action the same way as Create, but only if no Action
+// has been created with the same idempotency key within the given time
+// (TTL). Otherwise, it returns the ID of the Action previously created for the
+// key. The returned boolean indicates whether a new Action was created.
 type Storage interface {
+	Create(common.Action) (*int, error)
+	CreateWithKey(string, time.Duration, common.Action) (*int, bool, error)
 	Get(int) (*common.Action, error)
-	Set(common.Action) (*int, error)
+	Exists(int) (bool, error)
+	Update(int, common.Action) error
+	ListSince(int, int) ([]*common.Action, int, []error, error)
+	Ping() error
 }
 
 // StorageFactory is a function type that should be implemented by all Storage
@@ -33,28 +55,21 @@ type StorageFactory func(confing map[string]interface{}) (Storage, error)
 // Create creates and returns a Storage provider, given the configuration that
 // includes configuration required by the provider.
 func Create(config map[string]interface{}) (Storage, error) {
-	// Register providers the first time we create a storage. We may create a more
-	// generic registration mechanism when we support more storage providers that
-	// may also be registered independently, but for now this is sufficient.
-	if len(storageFactories) == 0 {
-		storageFactories["redis"] = NewRedisStorage
-	}
-
 	storageType, ok := config["type"]
 	if !ok {
-		err := fmt.Errorf("the \"type\" configuration option is required for defining the storage engine")
+		err := fmt.Errorf("the \"type\" configuration option is required for defining the storage engine: %w", errorsUtil.ErrInvalidConfig)
 		return nil, err
 	}
 
 	sStorageType := storageType.(string)
 	if sStorageType == "" {
-		err := fmt.Errorf("no storage engine provided")
+		err := fmt.Errorf("no storage engine provided: %w", errorsUtil.ErrInvalidConfig)
 		return nil, err
 	}
 
-	factory, ok := storageFactories[sStorageType]
+	factory, ok := storageFactory(sStorageType)
 	if !ok {
-		err := fmt.Errorf("unknown storage engine \"%s\"", sStorageType)
+		err := fmt.Errorf("unknown storage engine \"%s\": %w", sStorageType, errorsUtil.ErrUnknownType)
 		return nil, err
 	}
 
@@ -66,9 +81,38 @@ func Create(config map[string]interface{}) (Storage, error) {
 	return storage, nil
 }
 
+// RegisterStorageFactory registers the given factory for creating Storage
+// engines of the given type, replacing any factory already registered for it.
+// It allows Storage engines defined outside of this package to be created via
+// Create(), and it is safe to call concurrently with Create().
+func RegisterStorageFactory(storageType string, factory StorageFactory) {
+	storageFactoriesMutex.Lock()
+	defer storageFactoriesMutex.Unlock()
+	storageFactories[storageType] = factory
+}
+
 /**
  * For internal use.
  */
 
-// storageFactories holds a map of all known Storage factories.
+// storageFactories holds a map of all known Storage factories, keyed by their
+// type. It is only accessed while holding storageFactoriesMutex.
 var storageFactories = make(map[string]StorageFactory)
+
+// storageFactoriesMutex guards storageFactories so that factories can be
+// registered while others are looked up concurrently.
+var storageFactoriesMutex sync.RWMutex
+
+// Register the factories provided by this application.
+func init() {
+	RegisterStorageFactory("redis", NewRedisStorage)
+	RegisterStorageFactory("bolt", NewBoltStorage)
+}
+
+// storageFactory returns the factory registered for the given type, if any.
+func storageFactory(storageType string) (StorageFactory, bool) {
+	storageFactoriesMutex.RLock()
+	defer storageFactoriesMutex.RUnlock()
+	factory, ok := storageFactories[storageType]
+	return factory, ok
+}
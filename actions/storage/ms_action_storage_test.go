@@ -0,0 +1,98 @@
+/**
+ * Tests for the msActionStorage module.
+ */
+
+package msActionStorage
+
+import (
+	// Utilities.
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+)
+
+/**
+ * Tests.
+ */
+
+func TestCreate_Concurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ms_action_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Storage engines are created, and factories are registered, at the same
+	// time, such as by concurrent requests.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			storage, err := Create(map[string]interface{}{
+				"type": "bolt",
+				"path": filepath.Join(dir, fmt.Sprintf("%d_actions.db", i)),
+			})
+			if assert.Nil(t, err) {
+				storage.(Bolt).db.Close()
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := Create(map[string]interface{}{"type": "mysql"})
+			assert.EqualError(t, err, "unknown storage engine \"mysql\": unknown type")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			RegisterStorageFactory(fmt.Sprintf("test_%d", i), NewBoltStorage)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCreate_SentinelErrors(t *testing.T) {
+	_, err := Create(map[string]interface{}{})
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+	_, err = Create(map[string]interface{}{"type": "mysql"})
+	assert.True(t, errors.Is(err, errorsUtil.ErrUnknownType))
+	_, err = Create(map[string]interface{}{"type": "redis"})
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+	_, err = Create(map[string]interface{}{"type": "bolt"})
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+}
+
+func TestStorage_SentinelErrors(t *testing.T) {
+	// Redis clients that have not been initialized.
+	uninitialized := Redis{}
+	_, err := uninitialized.Get(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrStorageUninitialized))
+	_, err = uninitialized.Exists(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrStorageUninitialized))
+
+	// Actions that do not exist.
+	dir, err := ioutil.TempDir("", "ms_action_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storage, err := Create(map[string]interface{}{
+		"type": "bolt",
+		"path": filepath.Join(dir, "actions.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.Get(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrNotFound))
+	assert.EqualError(t, err, "the Action was not found")
+}
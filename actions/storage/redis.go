@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	// Redis.
 	"github.com/mediocregopher/radix.v2/redis"
@@ -16,8 +17,26 @@ import (
 	// Internal dependencies.
 	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
 	wrapper "github.com/krystalcode/go-mantis-shrimp/actions/wrapper"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	redisUtil "github.com/krystalcode/go-mantis-shrimp/util/redis"
 )
 
+/**
+ * Constants.
+ */
+
+// redisActionIDCounter holds the key of the counter that is incremented to
+// generate the IDs of new Actions.
+const redisActionIDCounter = "actions_next_id"
+
+// redisIdempotencyKeyPending holds the value that an idempotency key is set to
+// while the Action for the key is being created.
+const redisIdempotencyKeyPending = "pending"
+
+// errRedisUninitialized is returned when the Storage is used before its Redis
+// client has been initialized.
+var errRedisUninitialized = fmt.Errorf("the Redis client has not been initialized yet: %w", errorsUtil.ErrStorageUninitialized)
+
 /**
  * Redis storage provider.
  */
@@ -34,13 +53,16 @@ type RedisClient interface {
 type Redis struct {
 	dsn    string
 	client RedisClient
+	// Whether the Actions are compressed when they are stored. Actions stored
+	// compressed or not can be read either way.
+	compress bool
 }
 
 // Get implements Storage.Get(). It retrieves from Storage and returns the
-// Action for the given ID.
+// Action for the given ID, or ErrNotFound if there is no Action with such ID.
 func (storage Redis) Get(id int) (*common.Action, error) {
 	if storage.client == nil {
-		return nil, fmt.Errorf("the Redis client has not been initialized yet")
+		return nil, errRedisUninitialized
 	}
 
 	key := redisKey(id)
@@ -50,6 +72,11 @@ func (storage Redis) Get(id int) (*common.Action, error) {
 		return nil, r.Err
 	}
 
+	// There is no Action stored for the given ID.
+	if r.IsType(redis.Nil) {
+		return nil, ErrNotFound
+	}
+
 	jsonAction, err := r.Bytes()
 	// If an error happens here, it should be because there is no value for this
 	// key. It could be the case that the data is corrupted or the wrong data is
@@ -58,6 +85,10 @@ func (storage Redis) Get(id int) (*common.Action, error) {
 	if err != nil {
 		return nil, err
 	}
+	jsonAction, err = redisUtil.DecompressValue(jsonAction)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create and initialize an Action object based on the given JSON object.
 	action, err := wrapper.Create(jsonAction)
@@ -68,86 +99,293 @@ func (storage Redis) Get(id int) (*common.Action, error) {
 	return &action, nil
 }
 
-// Set implements Storage.Set(). It stores the given Action object to the Redis
-// Storage.
-func (storage Redis) Set(action common.Action) (*int, error) {
+// Exists implements Storage.Exists(). It returns whether an Action with the
+// given ID exists in the Storage, without loading it.
+func (storage Redis) Exists(id int) (bool, error) {
+	if storage.client == nil {
+		return false, errRedisUninitialized
+	}
+
+	exists, err := storage.client.Cmd("EXISTS", redisKey(id)).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
+// Create implements Storage.Create(). It stores the given Action object as a
+// new value in the Redis Storage and it returns an automatically generated ID.
+func (storage Redis) Create(action common.Action) (*int, error) {
+	if storage.client == nil {
+		return nil, errRedisUninitialized
+	}
+
+	// Set the CreatedAt field, if not yet set.
+	base, err := common.Base(action)
+	if err != nil {
+		return nil, err
+	}
+	if base.CreatedAt == nil {
+		now := time.Now()
+		base.CreatedAt = &now
+		err = common.SetBase(&action, *base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Generate an ID and store the Action.
+	id, err := storage.generateID()
+	if err != nil {
+		return nil, err
+	}
+	err = storage.set(*id, action)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the new Action to the Actions index set. Updates do not change the
+	// index, so it is only done when creating the Action.
+	err = storage.client.Cmd("ZADD", "actions", *id, redisKey(*id)).Err
+	if err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// CreateWithKey implements Storage.CreateWithKey(). The key is reserved before
+// creating the Action so that concurrent requests with the same key do not
+// create more than one Action; it is then set to the ID of the created Action
+// and it expires after the given TTL.
+func (storage Redis) CreateWithKey(key string, ttl time.Duration, action common.Action) (*int, bool, error) {
+	if storage.client == nil {
+		return nil, false, errRedisUninitialized
+	}
+
+	idempotencyKey := redisIdempotencyKey(key)
+	ttlMs := int(ttl / time.Millisecond)
+
+	// The key is not set if it already exists, in which case we get a Nil reply.
+	r := storage.client.Cmd("SET", idempotencyKey, redisIdempotencyKeyPending, "PX", ttlMs, "NX")
+	if r.Err != nil {
+		return nil, false, r.Err
+	}
+	if r.IsType(redis.Nil) {
+		id, err := storage.idempotencyKeyID(idempotencyKey)
+		return id, false, err
+	}
+
+	id, err := storage.Create(action)
+	if err != nil {
+		// Release the key so that the request can be retried.
+		storage.client.Cmd("DEL", idempotencyKey)
+		return nil, false, err
+	}
+
+	// If the ID cannot be recorded, the key stays reserved until it expires;
+	// requests retried with the same key fail rather than creating a duplicate
+	// Action.
+	err = storage.client.Cmd("SET", idempotencyKey, strconv.Itoa(*id), "PX", ttlMs, "XX").Err
+	if err != nil {
+		return nil, false, err
+	}
+
+	return id, true, nil
+}
+
+// Update implements Storage.Update(). It stores the given Action object as a
+// value in the Redis Storage, overriding the existing value with the given ID.
+func (storage Redis) Update(id int, action common.Action) error {
+	return storage.set(id, action)
+}
+
+// Ping implements Storage.Ping(). It checks whether the Redis server is
+// available by sending it a PING command.
+func (storage Redis) Ping() error {
+	if storage.client == nil {
+		return errRedisUninitialized
+	}
+
+	return storage.client.Cmd("PING").Err
+}
+
+// set stores an Action object as a Redis value at the key corresponding to the
+// given ID.
+func (storage Redis) set(id int, action common.Action) error {
 	// @I Consider using hashmaps instead of json values
-	// @I Investigate risk of an Action overriding another due to race conditions
-	//    when creating them
 
 	if storage.client == nil {
-		return nil, fmt.Errorf("the Redis client has not been initialized yet")
+		return errRedisUninitialized
+	}
+
+	// Update the UpdatedAt field.
+	base, err := common.Base(action)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	base.UpdatedAt = &now
+	err = common.SetBase(&action, *base)
+	if err != nil {
+		return err
 	}
 
 	// We'll be storing an ActionWrapper which contains the Action type as well.
 	wrapper, err := wrapper.Wrapper(action)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	jsonAction, err := json.Marshal(wrapper)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Generate an ID, store the Action, and update the Actions index set.
-	id := storage.generateID()
-	key := redisKey(id)
-	err = storage.client.Cmd("SET", key, jsonAction).Err
+	if storage.compress {
+		jsonAction, err = redisUtil.CompressValue(jsonAction)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Store the Action.
+	return storage.client.Cmd("SET", redisKey(id), jsonAction).Err
+}
+
+// ListSince implements Storage.ListSince(). It retrieves from Storage and
+// returns up to the given number of Actions (limit) with IDs greater than the
+// given ID (since), in the order of their IDs. The Actions are looked up by
+// their scores in the Actions index set, which hold their IDs, so that the cost
+// depends on the number of Actions returned only. It also returns the ID to be
+// given as the cursor for the next page, or 0 if there are no more Actions.
+// Actions that cannot be loaded, such as when their stored value is corrupted,
+// do not abort the listing; they are skipped and the corresponding errors are
+// returned in the third slice.
+func (storage Redis) ListSince(since int, limit int) ([]*common.Action, int, []error, error) {
+	if storage.client == nil {
+		return nil, 0, nil, errRedisUninitialized
+	}
+
+	if limit < 1 {
+		return []*common.Action{}, 0, nil, nil
+	}
+
+	// Request one more Action than the limit to find out whether there are more
+	// Actions after the page. The reply alternates the keys of the Actions with
+	// their scores.
+	reply, err := storage.client.Cmd(
+		"ZRANGEBYSCORE",
+		"actions",
+		"("+strconv.Itoa(since),
+		"+inf",
+		"WITHSCORES",
+		"LIMIT",
+		0,
+		limit+1,
+	).List()
 	if err != nil {
-		return nil, err
+		return nil, 0, nil, err
 	}
-	err = storage.client.Cmd("ZADD", "actions", id, key).Err
+
+	actions := make([]*common.Action, 0, limit)
+	next := 0
+	var errs []error
+	for index := 0; index+1 < len(reply); index += 2 {
+		if index/2 == limit {
+			break
+		}
+
+		next, err = strconv.Atoi(reply[index+1])
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("invalid score \"%s\" for the key \"%s\" in the Actions index set", reply[index+1], reply[index])
+		}
+
+		action, err := storage.Get(next)
+		if err == ErrNotFound {
+			err = fmt.Errorf("the ID is indexed but no value is stored")
+		}
+		if err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("failed to load the Action with ID \"%d\": %s", next, err.Error()),
+			)
+			continue
+		}
+
+		actions = append(actions, action)
+	}
+	if len(reply) <= 2*limit {
+		next = 0
+	}
+
+	return actions, next, errs, nil
+}
+
+// generateID generates an ID for a new Action by atomically incrementing the
+// Action ID counter, so that concurrent requests never get the same ID.
+func (storage Redis) generateID() (*int, error) {
+	if storage.client == nil {
+		return nil, errRedisUninitialized
+	}
+
+	newID, err := redisUtil.NextID(storage.client, redisActionIDCounter, "actions")
 	if err != nil {
 		return nil, err
 	}
 
-	return &id, nil
+	return &newID, nil
 }
 
-// generateID generates an ID for a new Action by incrementing the last known
-// Action ID.
-func (storage Redis) generateID() int {
-	// Get the last ID that exists on the Actions index set, so that we can generate
-	// the next one.
-	r, err := storage.client.Cmd("ZREVRANGE", "actions", 0, 0, "WITHSCORES").List()
-	if err != nil {
-		panic(err)
+// idempotencyKeyID returns the ID of the Action created for the given
+// idempotency key, or ErrKeyInUse if the Action is still being created.
+func (storage Redis) idempotencyKeyID(idempotencyKey string) (*int, error) {
+	r := storage.client.Cmd("GET", idempotencyKey)
+	if r.Err != nil {
+		return nil, r.Err
 	}
 
-	// If there are no actions yet, start with ID 1.
-	if len(r) == 0 {
-		return 1
+	// The key may have expired in the meantime; the request can be retried.
+	if r.IsType(redis.Nil) {
+		return nil, ErrKeyInUse
 	}
 
-	id, err := strconv.Atoi(r[1])
+	value, err := r.Str()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if value == redisIdempotencyKeyPending {
+		return nil, ErrKeyInUse
 	}
 
-	return id + 1
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
 }
 
 // NewRedisStorage implements the StorageFactory function type. It initiates a
-// connection to the Redis database defined in the given configuration, and it
-// returns the Storage engine object.
+// pool of connections to the Redis database defined in the given
+// configuration, and it returns the Storage engine object. The Storage engine
+// can be shared by concurrent requests. The "compress" option can optionally
+// enable compressing the stored Actions.
 var NewRedisStorage = func(config map[string]interface{}) (Storage, error) {
-	dsn, ok := config["dsn"]
-	if !ok {
-		err := fmt.Errorf("the DSN configuration option is required for the Redis storage")
+	compress, err := redisUtil.Compression(config)
+	if err != nil {
 		return nil, err
 	}
 
-	sDSN := dsn.(string)
-
-	client, err := redis.Dial("tcp", sDSN)
+	client, err := redisUtil.NewPool(config)
 	if err != nil {
-		err := fmt.Errorf("failed to connect to Redis: %s", err.Error())
 		return nil, err
 	}
 
 	storage := Redis{
-		dsn:    sDSN,
-		client: client,
+		dsn:      config["dsn"].(string),
+		client:   client,
+		compress: compress,
 	}
 
 	return storage, nil
@@ -161,3 +399,8 @@ var NewRedisStorage = func(config map[string]interface{}) (Storage, error) {
 func redisKey(id int) string {
 	return "action:" + strconv.Itoa(id)
 }
+
+// Generate a Redis key for the given idempotency key.
+func redisIdempotencyKey(key string) string {
+	return "action_idempotency_key:" + key
+}
@@ -13,11 +13,18 @@ import (
 	"github.com/mediocregopher/radix.v2/redis"
 
 	// Utilities.
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	// Internal dependencies.
 	chat "github.com/krystalcode/go-mantis-shrimp/actions/chat"
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	redisUtil "github.com/krystalcode/go-mantis-shrimp/util/redis"
+	redisTest "github.com/krystalcode/go-mantis-shrimp/util/redis/redistest"
 )
 
 /**
@@ -69,6 +76,24 @@ func TestGet_JSONError(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestGet_NotFound(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	pAction, err := storage.Get(1)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, pAction)
+
+	// Errors communicating with Redis should not be reported as a missing
+	// Action.
+	storage = Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	_, err = storage.Get(1)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNotFound, err)
+}
+
 func TestGet_Success(t *testing.T) {
 	// Create the expected Action object that matches the JSON returned by the
 	// Redis Client.
@@ -133,10 +158,439 @@ func TestGet_Success(t *testing.T) {
 	)
 }
 
+func TestNewRedisStorage_InvalidCompress(t *testing.T) {
+	config := map[string]interface{}{"type": "redis", "dsn": "localhost:6379", "compress": "yes"}
+	_, err := NewRedisStorage(config)
+	assert.EqualError(t, err, "the \"compress\" configuration option must be a boolean: invalid configuration")
+}
+
+func TestCompress_RoundTrip(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{client: client, compress: true}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+
+	// The Action should be stored compressed.
+	value, _ := client.Value(redisKey(*id))
+	assert.True(t, strings.HasPrefix(value, redisUtil.CompressedPrefix))
+	assert.NotContains(t, value, messageText)
+
+	pAction, err := storage.Get(*id)
+	assert.Nil(t, err)
+	assert.Equal(t, messageText, *(*pAction).(chat.Action).Message.Text)
+
+	// It should be read the same way when compression is disabled.
+	pAction, err = Redis{client: client}.Get(*id)
+	assert.Nil(t, err)
+	assert.Equal(t, messageText, *(*pAction).(chat.Action).Message.Text)
+}
+
+func TestCompress_Uncompressed(t *testing.T) {
+	client := redisTest.NewClient()
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	id, err := Redis{client: client}.Create(*action)
+	assert.Nil(t, err)
+
+	// Actions stored before compression was enabled should still be read.
+	value, _ := client.Value(redisKey(*id))
+	assert.True(t, strings.HasPrefix(value, `{"type":"chat_message"`))
+
+	storage := Redis{client: client, compress: true}
+	pAction, err := storage.Get(*id)
+	assert.Nil(t, err)
+	assert.Equal(t, messageText, *(*pAction).(chat.Action).Message.Text)
+
+	// They should be compressed when they are next updated.
+	err = storage.Update(*id, *pAction)
+	assert.Nil(t, err)
+	value, _ = client.Value(redisKey(*id))
+	assert.True(t, strings.HasPrefix(value, redisUtil.CompressedPrefix))
+}
+
+func TestCreate_SetsTimestamps(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+
+	pAction, err := storage.Get(*id)
+	assert.Nil(t, err)
+	base, err := common.Base(*pAction)
+	assert.Nil(t, err)
+	assert.NotNil(t, base.CreatedAt)
+	assert.NotNil(t, base.UpdatedAt)
+}
+
+func TestCreate_TimestampsRoundTrip(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	createdAt := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+	action.CreatedAt = &createdAt
+
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+
+	pAction, err := storage.Get(*id)
+	assert.Nil(t, err)
+	base, err := common.Base(*pAction)
+	assert.Nil(t, err)
+	assert.True(t, createdAt.Equal(*base.CreatedAt))
+	assert.False(t, base.UpdatedAt.Before(createdAt))
+}
+
+func TestCreate_NoClient(t *testing.T) {
+	storage := Redis{}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	_, err := storage.Create(*action)
+	assert.NotNil(t, err)
+}
+
+func TestCreate_GeneratesNewIDs(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	firstID, err := storage.Create(*action)
+	assert.Nil(t, err)
+	secondID, err := storage.Create(*action)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, *firstID)
+	assert.Equal(t, 2, *secondID)
+}
+
+func TestCreate_ConcurrentRequestsGetUniqueIDs(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+	count := 50
+
+	ids := make(chan int, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := storage.Create(*action)
+			assert.Nil(t, err)
+			if err == nil {
+				ids <- *id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	uniqueIDs := make(map[int]bool)
+	for id := range ids {
+		uniqueIDs[id] = true
+	}
+	assert.Len(t, uniqueIDs, count)
+}
+
+func TestCreate_SeedsIDCounterFromIndex(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+
+	// Simulate an Action created before the ID counter was introduced.
+	client.Cmd("ZADD", "actions", 5, redisKey(5))
+
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, *id)
+}
+
+func TestCreateWithKey_Success(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	id, created, err := storage.CreateWithKey("key-1", time.Hour, *action)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 1, *id)
+
+	// The same key yields the same Action.
+	repeatedID, created, err := storage.CreateWithKey("key-1", time.Hour, *action)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, *id, *repeatedID)
+	exists, err := storage.Exists(2)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	// A different key yields a new Action.
+	otherID, created, err := storage.CreateWithKey("key-2", time.Hour, *action)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 2, *otherID)
+}
+
+func TestCreateWithKey_Pending(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+
+	// Simulate a concurrent request creating an Action for the same key.
+	client.Cmd("SET", redisIdempotencyKey("key-1"), redisIdempotencyKeyPending)
+
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+	id, created, err := storage.CreateWithKey("key-1", time.Hour, *action)
+	assert.Equal(t, ErrKeyInUse, err)
+	assert.False(t, created)
+	assert.Nil(t, id)
+}
+
+func TestCreateWithKey_ReleasesKeyOnError(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+
+	// The Action cannot be stored because it does not embed an ActionBase.
+	_, _, err := storage.CreateWithKey("key-1", time.Hour, TestAction_NoBase{})
+	assert.NotNil(t, err)
+	_, ok := client.Value(redisIdempotencyKey("key-1"))
+	assert.False(t, ok)
+}
+
+func TestCreateWithKey_NoClient(t *testing.T) {
+	storage := Redis{}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	_, _, err := storage.CreateWithKey("key-1", time.Hour, *action)
+	assert.NotNil(t, err)
+}
+
+func TestUpdate_Success(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+	pCreated, err := storage.Get(*id)
+	assert.Nil(t, err)
+	created, _ := common.Base(*pCreated)
+
+	// Update the stored Action; it should keep its ID and creation time.
+	updatedAction := (*pCreated).(chat.Action)
+	updatedAction.Name = "Updated action name"
+	err = storage.Update(*id, updatedAction)
+	assert.Nil(t, err)
+
+	pUpdated, err := storage.Get(*id)
+	assert.Nil(t, err)
+	updated, _ := common.Base(*pUpdated)
+	assert.Equal(t, "Updated action name", updated.Name)
+	assert.True(t, created.CreatedAt.Equal(*updated.CreatedAt))
+	assert.False(t, updated.UpdatedAt.Before(*created.UpdatedAt))
+
+	// No new Action should have been created.
+	pAction, err := storage.Get(*id + 1)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, pAction)
+}
+
+func TestUpdate_IndexedOnlyOnCreate(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+	err = storage.Update(*id, *action)
+	assert.Nil(t, err)
+	err = storage.Update(*id, *action)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, client.ZAdds("actions"))
+	assert.Equal(t, map[string]int64{redisKey(*id): int64(*id)}, client.Scores("actions"))
+}
+
+func TestUpdate_NoClient(t *testing.T) {
+	storage := Redis{}
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+
+	err := storage.Update(1, *action)
+	assert.NotNil(t, err)
+}
+
+func TestExists_Success(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	exists, err := storage.Exists(1)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	messageText := "Chat message text"
+	action := chat.NewAction("Action name", "Chat webhook", chat.Message{Text: &messageText})
+	id, err := storage.Create(*action)
+	assert.Nil(t, err)
+
+	exists, err = storage.Exists(*id)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestExists_RedisError(t *testing.T) {
+	storage := Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	exists, err := storage.Exists(1)
+	assert.NotNil(t, err)
+	assert.False(t, exists)
+}
+
+func TestExists_NoClient(t *testing.T) {
+	storage := Redis{}
+	_, err := storage.Exists(1)
+	assert.NotNil(t, err)
+}
+
+func TestPing_Success(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	assert.Nil(t, storage.Ping())
+}
+
+func TestPing_RedisError(t *testing.T) {
+	storage := Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	assert.NotNil(t, storage.Ping())
+}
+
+func TestPing_NoClient(t *testing.T) {
+	storage := Redis{}
+	assert.NotNil(t, storage.Ping())
+}
+
+func TestListSince(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	testListSince(t, storage)
+}
+
+func TestListSince_RedisError(t *testing.T) {
+	storage := Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	_, _, _, err := storage.ListSince(0, 10)
+	assert.NotNil(t, err)
+}
+
+func TestListSince_NoClient(t *testing.T) {
+	storage := Redis{}
+	_, _, _, err := storage.ListSince(0, 10)
+	assert.NotNil(t, err)
+}
+
 /**
  * Functions/types for internal use.
  */
 
+// testListSince tests that iterating through the pages of the Actions stored in
+// the given Storage, using the returned cursors, returns every Action once.
+func testListSince(t *testing.T, storage Storage) {
+	// No Actions are stored yet.
+	actions, next, errs, err := storage.ListSince(0, 3)
+	assert.Nil(t, err)
+	assert.Len(t, actions, 0)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, 0, next)
+
+	// Actions do not hold their IDs; they are identified by their names.
+	var ids []int
+	var names []string
+	for i := 0; i < 7; i++ {
+		messageText := "Chat message text"
+		name := fmt.Sprintf("Action %d", i)
+		action := chat.NewAction(name, "Chat webhook", chat.Message{Text: &messageText})
+		id, err := storage.Create(*action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, *id)
+		names = append(names, name)
+	}
+
+	// Go through pages of 3 Actions; the last page is partial.
+	var listedNames []string
+	since := 0
+	for pages := 0; pages < 10; pages++ {
+		actions, next, errs, err = storage.ListSince(since, 3)
+		assert.Nil(t, err)
+		assert.Len(t, errs, 0)
+		for _, action := range actions {
+			base, _ := common.Base(*action)
+			listedNames = append(listedNames, base.Name)
+		}
+		if next == 0 {
+			break
+		}
+		assert.Len(t, actions, 3)
+		since = next
+	}
+	assert.Equal(t, names, listedNames)
+
+	// A page that ends with the last Action has no next page.
+	actions, next, _, err = storage.ListSince(ids[3], 3)
+	assert.Nil(t, err)
+	assert.Len(t, actions, 3)
+	assert.Equal(t, 0, next)
+
+	// A page that starts after the last Action is empty.
+	actions, next, _, err = storage.ListSince(ids[6], 3)
+	assert.Nil(t, err)
+	assert.Len(t, actions, 0)
+	assert.Equal(t, 0, next)
+}
+
+// TestAction_NoBase is an Action that does not embed an ActionBase and that
+// therefore cannot be stored.
+type TestAction_NoBase struct{}
+
+func (action TestAction_NoBase) Do(ctx context.Context, actionContext common.ActionContext) error {
+	return nil
+}
+
 type TestRedisClient_EmptyResponse struct{}
 
 func (c *TestRedisClient_EmptyResponse) Cmd(cmd string, args ...interface{}) *redis.Resp {
@@ -15,11 +15,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sync"
 
 	// Internal dependencies.
 	chat "github.com/krystalcode/go-mantis-shrimp/actions/chat"
 	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	execAction "github.com/krystalcode/go-mantis-shrimp/actions/exec"
 	mailgun "github.com/krystalcode/go-mantis-shrimp/actions/mailgun"
+	pagerduty "github.com/krystalcode/go-mantis-shrimp/actions/pagerduty"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
 )
 
 // ActionWrapper provides a structure that holds an Action together with its type.
@@ -44,6 +48,11 @@ func (wrapper *ActionWrapper) UnmarshalJSON(bytes []byte) error {
 		return fmt.Errorf("cannot decode ActionWrapper JSON object without given the Action's type")
 	}
 
+	// There is nothing to decode if neither is given.
+	if jsonMap["type"] == nil {
+		return nil
+	}
+
 	// Get the Action type from the corresponding field.
 	var actionType string
 	err = json.Unmarshal(*jsonMap["type"], &actionType)
@@ -75,10 +84,32 @@ func (wrapper *ActionWrapper) UnmarshalJSON(bytes []byte) error {
 		}
 		wrapper.Action = action
 		break
+	case "exec":
+		// Refuse to decode Exec Actions when they are not allowed, so that they
+		// cannot be created either.
+		if !execAction.Allowed() {
+			return execAction.ErrNotAllowed
+		}
+		var action execAction.Action
+		err = json.Unmarshal(*jsonMap["action"], &action)
+		if err != nil {
+			return err
+		}
+		wrapper.Action = action
+		break
+	case "pagerduty":
+		var action pagerduty.Action
+		err = json.Unmarshal(*jsonMap["action"], &action)
+		if err != nil {
+			return err
+		}
+		wrapper.Action = action
+		break
 	default:
 		return fmt.Errorf(
-			"unknown Action type \"%s\" while trying to decode an ActionWrapper JSON object",
+			"unknown Action type \"%s\" while trying to decode an ActionWrapper JSON object: %w",
 			actionType,
+			errorsUtil.ErrUnknownType,
 		)
 	}
 
@@ -98,10 +129,17 @@ func Wrapper(action common.Action) (*ActionWrapper, error) {
 	case "github.com/krystalcode/go-mantis-shrimp/actions/mailgun":
 		actionType = "mailgun_message"
 		break
+	case "github.com/krystalcode/go-mantis-shrimp/actions/exec":
+		actionType = "exec"
+		break
+	case "github.com/krystalcode/go-mantis-shrimp/actions/pagerduty":
+		actionType = "pagerduty"
+		break
 	default:
 		err := fmt.Errorf(
-			"unknown Action struct \"%s\" when trying to wrap an Action in a wrapper",
+			"unknown Action struct \"%s\" when trying to wrap an Action in a wrapper: %w",
 			structType,
+			errorsUtil.ErrUnknownType,
 		)
 		return nil, err
 	}
@@ -113,6 +151,31 @@ func Wrapper(action common.Action) (*ActionWrapper, error) {
 	return &wrapper, nil
 }
 
+// UnmarshalWrappers decodes the given JSON array of ActionWrapper objects, such
+// as when creating Actions in bulk. Each element is decoded the same way as by
+// ActionWrapper.UnmarshalJSON(), and it must contain an Action. Decoding stops
+// at the first element that is not valid; the error includes its index.
+func UnmarshalWrappers(bytes []byte) ([]ActionWrapper, error) {
+	var elements []json.RawMessage
+	err := json.Unmarshal(bytes, &elements)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappers := make([]ActionWrapper, len(elements))
+	for index, element := range elements {
+		err = json.Unmarshal(element, &wrappers[index])
+		if err == nil && wrappers[index].Action == nil {
+			err = fmt.Errorf("no Action was given")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the Action at index %d: %w", index, err)
+		}
+	}
+
+	return wrappers, nil
+}
+
 // ActionFactory is a function type that should be implemented by all Action
 // factories. It defines a function that receives the JSON-encoded Action object
 // (in raw bytes), and it returs the corresponding Action object, including any
@@ -122,14 +185,6 @@ type ActionFactory func(jsonAction *json.RawMessage) (common.Action, error)
 // Create creates and returns an initialized Action object that corresponds to
 // the type and holds the data defined to the given JSON-object byte slice.
 func Create(jsonAction []byte) (common.Action, error) {
-	// Register factories the first time we create an Action. We may create a more
-	// generic registration mechanism when we support more Action factories that
-	// may also be registered independently, but for now this is sufficient.
-	if len(actionFactories) == 0 {
-		actionFactories["chat_message"] = chat.NewChatMessageAction
-		actionFactories["mailgun_message"] = mailgun.NewMailgunMessageAction
-	}
-
 	var jsonMap map[string]*json.RawMessage
 	err := json.Unmarshal(jsonAction, &jsonMap)
 	if err != nil {
@@ -149,18 +204,51 @@ func Create(jsonAction []byte) (common.Action, error) {
 		return nil, err
 	}
 
-	factory, ok := actionFactories[actionType]
+	factory, ok := actionFactory(actionType)
 	if !ok {
-		err := fmt.Errorf("unknown Action factory for type \"%s\"", actionType)
+		err := fmt.Errorf("unknown Action factory for type \"%s\": %w", actionType, errorsUtil.ErrUnknownType)
 		return nil, err
 	}
 
 	return factory(jsonMap["action"])
 }
 
+// RegisterActionFactory registers the given factory for creating Actions of the
+// given type, replacing any factory already registered for it. It allows Action
+// types defined outside of this package to be created via Create(), and it is
+// safe to call concurrently with Create().
+func RegisterActionFactory(actionType string, factory ActionFactory) {
+	// @I Support registered Action types when decoding and creating ActionWrappers
+
+	actionFactoriesMutex.Lock()
+	defer actionFactoriesMutex.Unlock()
+	actionFactories[actionType] = factory
+}
+
 /**
  * For internal use.
  */
 
-// actionFactories holds a map of all known Action factories.
+// actionFactories holds a map of all known Action factories, keyed by their
+// type. It is only accessed while holding actionFactoriesMutex.
 var actionFactories = make(map[string]ActionFactory)
+
+// actionFactoriesMutex guards actionFactories so that factories can be
+// registered while others are looked up concurrently.
+var actionFactoriesMutex sync.RWMutex
+
+// Register the factories provided by this application.
+func init() {
+	RegisterActionFactory("chat_message", chat.NewChatMessageAction)
+	RegisterActionFactory("mailgun_message", mailgun.NewMailgunMessageAction)
+	RegisterActionFactory("exec", execAction.NewExecAction)
+	RegisterActionFactory("pagerduty", pagerduty.NewPagerDutyAction)
+}
+
+// actionFactory returns the factory registered for the given type, if any.
+func actionFactory(actionType string) (ActionFactory, bool) {
+	actionFactoriesMutex.RLock()
+	defer actionFactoriesMutex.RUnlock()
+	factory, ok := actionFactories[actionType]
+	return factory, ok
+}
@@ -0,0 +1,112 @@
+/**
+ * Tests for the msActionWrapper module.
+ */
+
+package msActionWrapper
+
+import (
+	// Utilities.
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	chat "github.com/krystalcode/go-mantis-shrimp/actions/chat"
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	pagerduty "github.com/krystalcode/go-mantis-shrimp/actions/pagerduty"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+)
+
+/**
+ * Tests.
+ */
+
+func TestCreate_UnknownType(t *testing.T) {
+	_, err := Create([]byte(`{"type":"unknown","action":{}}`))
+	assert.EqualError(t, err, "unknown Action factory for type \"unknown\": unknown type")
+	assert.True(t, errors.Is(err, errorsUtil.ErrUnknownType))
+
+	var wrapper ActionWrapper
+	err = json.Unmarshal([]byte(`{"type":"unknown","action":{}}`), &wrapper)
+	assert.True(t, errors.Is(err, errorsUtil.ErrUnknownType))
+}
+
+func TestRegisterActionFactory_Concurrent(t *testing.T) {
+	RegisterActionFactory("custom", newTestAction)
+
+	// Factories are registered while others are looked up, such as when Action
+	// types are registered while requests create Actions.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterActionFactory(fmt.Sprintf("custom_%d", i), newTestAction)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			action, err := Create([]byte(fmt.Sprintf(`{"type":"custom","action":{"name":"Action %d"}}`, i)))
+			assert.Nil(t, err)
+			assert.Equal(t, testAction{Name: fmt.Sprintf("Action %d", i)}, action)
+		}(i)
+	}
+	wg.Wait()
+
+	action, err := Create([]byte(`{"type":"custom_49","action":{"name":"Last"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, testAction{Name: "Last"}, action)
+}
+
+func TestUnmarshalWrappers(t *testing.T) {
+	wrappers, err := UnmarshalWrappers([]byte(`[
+		{"type":"chat_message","action":{"url":"https://chat.example.com/hook","message":{"text":"Down"}}},
+		{"type":"pagerduty","action":{"routing_key":"key","summary":"Down"}}
+	]`))
+	assert.Nil(t, err)
+	assert.Len(t, wrappers, 2)
+	assert.Equal(t, "chat_message", wrappers[0].Type)
+	assert.Equal(t, "https://chat.example.com/hook", wrappers[0].Action.(chat.Action).URL)
+	assert.Equal(t, "pagerduty", wrappers[1].Type)
+	assert.Equal(t, "Down", wrappers[1].Action.(pagerduty.Action).Summary)
+}
+
+func TestUnmarshalWrappers_InvalidElement(t *testing.T) {
+	wrappers, err := UnmarshalWrappers([]byte(`[{"type":"pagerduty","action":{"summary":"Down"}},{"type":"unknown","action":{}}]`))
+	assert.Nil(t, wrappers)
+	assert.Contains(t, err.Error(), "failed to decode the Action at index 1: ")
+
+	wrappers, err = UnmarshalWrappers([]byte(`[{"type":"pagerduty","action":{"summary":"Down"}},{"type":"pagerduty"}]`))
+	assert.Nil(t, wrappers)
+	assert.EqualError(t, err, "failed to decode the Action at index 1: no Action was given")
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testAction is an Action type defined outside of the Action packages, created
+// via a registered factory.
+type testAction struct {
+	Name string `json:"name"`
+}
+
+func (action testAction) Do(ctx context.Context, actionContext common.ActionContext) error {
+	return nil
+}
+
+// newTestAction implements the ActionFactory function type for testAction.
+func newTestAction(jsonAction *json.RawMessage) (common.Action, error) {
+	var action testAction
+	err := json.Unmarshal(*jsonAction, &action)
+	if err != nil {
+		return nil, err
+	}
+
+	return action, nil
+}
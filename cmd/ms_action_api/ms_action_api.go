@@ -6,17 +6,37 @@ package main
 
 import (
 	// Utilities.
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	// Gin.
 	gin "gopkg.in/gin-gonic/gin.v1"
 
+	// Prometheus.
+	"github.com/prometheus/client_golang/prometheus"
+
 	// Internal dependencies.
 	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
 	config "github.com/krystalcode/go-mantis-shrimp/actions/config"
+	execAction "github.com/krystalcode/go-mantis-shrimp/actions/exec"
 	storage "github.com/krystalcode/go-mantis-shrimp/actions/storage"
 	wrapper "github.com/krystalcode/go-mantis-shrimp/actions/wrapper"
 	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	metrics "github.com/krystalcode/go-mantis-shrimp/util/metrics"
+	pool "github.com/krystalcode/go-mantis-shrimp/util/pool"
 )
 
 /**
@@ -27,41 +47,231 @@ import (
 // configuration for the Action API.
 const ActionAPIConfigFile = "/etc/mantis-shrimp/action_api.config.json"
 
+// BulkLimitMax holds the maximum number of Actions that can be created by the
+// bulk endpoint in a single request.
+const BulkLimitMax = 100
+
+// ListLimitDefault holds the number of Actions returned by the list endpoint
+// when no limit is given in the request.
+const ListLimitDefault = 20
+
+// ListLimitMax holds the maximum number of Actions that can be requested from
+// the list endpoint in a single request.
+const ListLimitMax = 100
+
+// IdempotencyKeyTTL holds the time for which an idempotency key given when
+// creating an Action is remembered. Requests repeated with the same key within
+// that time return the Action created by the first request instead of creating
+// a new one.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKeyLengthMax holds the maximum length of idempotency keys.
+const IdempotencyKeyLengthMax = 255
+
 /**
  * Main program entry.
  */
 func main() {
-	// Load configuration.
-	// @I Support providing configuration file for Action API via cli options
-	// @I Validate Action API configuration when loading from JSON file
+	// Load configuration, from the file given via the command line or from the
+	// default location. Secrets can be given via environment variables
+	// referenced in the file.
+	configFile := flag.String(
+		"config",
+		"",
+		"Path to the configuration file (default \""+ActionAPIConfigFile+"\")",
+	)
+	// Optionally only check that the service can start, without serving.
+	checkOnly := flag.Bool(
+		"check",
+		false,
+		"Validate the configuration and the connection to the Storage, and exit without serving",
+	)
+	flag.Parse()
+
+	configPath := util.ConfigFilePath(*configFile, ActionAPIConfigFile)
+	if *checkOnly {
+		err := check(configPath, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	var actionAPIConfig config.Config
-	err := util.ReadJSONFile(ActionAPIConfigFile, &actionAPIConfig)
+	err := util.ReadJSONFileExpandEnv(configPath, &actionAPIConfig)
 	if err != nil {
-		panic(err)
+		log.Fatal("failed to read the configuration", "err", err)
+	}
+	err = actionAPIConfig.Validate()
+	if err != nil {
+		log.Fatal("invalid configuration", "err", err)
 	}
 
+	// Log as configured from now on.
+	logger, err := log.New(os.Stderr, actionAPIConfig.Log)
+	if err != nil {
+		log.Fatal("failed to initialize the logger", "err", err)
+	}
+	log.SetDefault(logger.With("service", "action_api"))
+
+	// Build the Storage engine once so that it is shared by all requests. We
+	// fail early if the Storage cannot be reached.
+	actionStorage, err := storage.Create(actionAPIConfig.Storage)
+	if err != nil {
+		log.Fatal("failed to initialize the Storage engine", "err", err)
+	}
+
+	// Allow Exec Actions only if explicitly enabled. This needs to happen before
+	// any Actions are loaded.
+	execAction.Allow(actionAPIConfig.AllowExecActions)
+
 	// Load Actions provided in the config, if we run on ephemeral storage mode.
-	loadEphemeralActions(&actionAPIConfig)
+	loadEphemeralActions(&actionAPIConfig, actionStorage)
+
+	// The patterns have already been validated together with the rest of the
+	// configuration.
+	allowList, err := util.NewURLAllowList(actionAPIConfig.AllowedURLPatterns)
+	if err != nil {
+		log.Fatal("invalid URL allow-list", "err", err)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
 
-	router := gin.Default()
+	// Log every request together with an ID that identifies it, and make a
+	// Logger that includes the ID available to the controllers.
+	router.Use(log.Middleware(log.Default()))
+
+	// Collect metrics for all requests, including the ones that fail
+	// authentication, and make them available to the controllers.
+	actionAPIMetrics := NewActionAPIMetrics()
+	router.Use(metrics.Middleware(actionAPIMetrics.requests))
+	router.Use(Metrics(actionAPIMetrics))
+
+	// Limit the size of the request bodies so that large payloads cannot exhaust
+	// the memory of the service. The options have already been validated
+	// together with the rest of the configuration.
+	maxRequestBytes, _, _, err := actionAPIConfig.Server.Parse()
+	if err != nil {
+		log.Fatal("invalid server configuration", "err", err)
+	}
+	router.Use(api.MaxRequestBytes(maxRequestBytes))
+
+	// Report whether the storage is available. It is registered before the
+	// authentication middleware so that it can be used by liveness and
+	// readiness probes without a token.
+	router.GET(api.PathHealth, api.Health(actionStorage))
+
+	// Report the build that is running, without requiring a token either.
+	router.GET(api.PathVersion, api.Version)
+
+	// Require callers to authenticate, unless no token is configured.
+	router.Use(api.Authentication(actionAPIConfig.AuthToken))
 
 	// Make storage available to the controllers.
-	router.Use(Storage(actionAPIConfig.Storage))
+	router.Use(Storage(actionStorage))
+
+	// Make available to the controllers the Group that tracks Action executions,
+	// so that they can finish before shutting down.
+	executions := &pool.Group{}
+	router.Use(Executions(executions))
+
+	// Make available to the controllers the maximum time that each execution of
+	// an Action can take. The option has already been validated together with
+	// the rest of the configuration.
+	executionTimeout, err := actionAPIConfig.ParseExecutionTimeout()
+	if err != nil {
+		log.Fatal("invalid execution timeout", "err", err)
+	}
+	router.Use(ExecutionTimeout(executionTimeout))
+
+	// Make available to the controllers the URLs that Actions are allowed to make
+	// requests to.
+	router.Use(AllowedURLs(allowList))
+
+	// Stop executing Actions that keep failing for a while, shared by all
+	// requests. The options have already been validated together with the rest
+	// of the configuration.
+	threshold, coolDown, coolDownMax, err := actionAPIConfig.CircuitBreaker.Parse()
+	if err != nil {
+		log.Fatal("invalid circuit breaker configuration", "err", err)
+	}
+	router.Use(CircuitBreakers(newCircuitBreakers(
+		threshold,
+		coolDown,
+		coolDownMax,
+		actionAPIMetrics.circuitBreakerState,
+	)))
+
+	// Expose the metrics, unless they are exposed by a separate server.
+	if actionAPIConfig.Metrics.Address == "" {
+		router.GET(
+			actionAPIConfig.Metrics.MetricsPath(),
+			gin.WrapH(metrics.Handler(actionAPIMetrics.registry)),
+		)
+	}
+
+	// Limit the rate of the requests that create Actions, shared by all such
+	// endpoints. Triggering Actions is not limited as it is requested by the other
+	// components.
+	rateLimit := api.RateLimit(actionAPIConfig.RateLimit)
 
 	// Version 1 of the Action API.
 	v1 := router.Group("/v1")
 	{
+		// List Actions.
+		v1.GET("/", v1List)
+
 		// Create a new Action.
-		v1.POST("/", v1Create)
+		v1.POST("/", rateLimit, v1Create)
+
+		// Create multiple Actions. The router does not allow a static path where
+		// the other endpoints have the ID parameter; the endpoint is therefore
+		// registered with the parameter and it responds to "bulk" only.
+		v1.POST("/:id", rateLimit, v1Bulk)
+
+		// Get an Action via its ID.
+		v1.GET("/:id", v1Get)
+
+		// Update an Action via its ID.
+		v1.PUT("/:id", v1Update)
 
 		// Trigger execution of the action via its ID.
-		v1.POST("/:ids/trigger", v1Trigger)
+		v1.POST("/:id/trigger", v1Trigger)
+	}
+
+	// Serve until we are asked to shut down, and then give the requests and
+	// Action executions in progress the configured grace period to finish.
+	ctx, cancel := util.ShutdownContext()
+	defer cancel()
+
+	gracePeriod, err := util.ParseGracePeriod(actionAPIConfig.ShutdownGracePeriod)
+	if err != nil {
+		log.Fatal("invalid shutdown grace period", "err", err)
+	}
+
+	if actionAPIConfig.Metrics.Address != "" {
+		go func() {
+			err := api.Serve(
+				ctx,
+				metrics.Mux(actionAPIConfig.Metrics, actionAPIMetrics.registry),
+				actionAPIConfig.Metrics.Address,
+				api.ServerConfig{},
+				gracePeriod,
+			)
+			if err != nil {
+				log.Fatal("failed to serve the metrics", "err", err)
+			}
+		}()
 	}
 
 	/**
 	 * @I Make the Action API port configurable
 	 */
-	router.Run(":8888")
+	err = api.Serve(ctx, router, ":8888", actionAPIConfig.Server, gracePeriod, executions.Wait)
+	if err != nil {
+		log.Fatal("failed to serve the Action API", "err", err)
+	}
 }
 
 /**
@@ -69,22 +279,35 @@ func main() {
  */
 
 // v1Create provides an endpoint that creates a new Action based on the JSON
-// object given in the request.
+// object given in the request. An idempotency key can optionally be given in
+// the "Idempotency-Key" header so that the request can be safely retried; if an
+// Action was already created with the same key, its ID is returned instead and
+// it is not triggered again.
 func v1Create(c *gin.Context) {
 	/**
-	 * @I Implement authentication of the caller
 	 * @I Validate parameters per Action type
 	 * @I Ensure the caller has the permissions to create Actions
-	 * @I Log errors and send a 500 response instead of panicking
-	 * @I Implement creating and triggering an Action in a single request
 	 */
 
+	// The Action can optionally be triggered right after it is created.
+	trigger, err := strconv.ParseBool(c.DefaultQuery("trigger", "false"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
 	// The parameters are provided as a JSON object in the request. Bind it to an
 	// object of the corresponding type.
 	var wrapper wrapper.ActionWrapper
-	err := c.BindJSON(&wrapper)
+	err = api.BindJSON(c, &wrapper)
 	if err != nil {
-		panic(err)
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
 	}
 	// @I Return 400 Bad Request if we are given no Action type in a Create request
 	if wrapper.Action == nil {
@@ -100,11 +323,276 @@ func v1Create(c *gin.Context) {
 	// Get the Action as an object of the appropriate type.
 	action := wrapper.Action
 
+	// Do not allow Actions to make requests to URLs that are not allowed, such
+	// as internal services.
+	err = checkTargetURL(c, action)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+
 	// Store the Action.
-	storage := c.MustGet("storage").(storage.Storage)
-	id, err := storage.Set(action)
+	actionStorage := c.MustGet("storage").(storage.Storage)
+	var id *int
+	created := true
+	key := c.Request.Header.Get("Idempotency-Key")
+	switch {
+	case key == "":
+		id, err = actionStorage.Create(action)
+	case len(key) > IdempotencyKeyLengthMax:
+		err = fmt.Errorf("the idempotency key cannot be longer than %d characters", IdempotencyKeyLengthMax)
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	default:
+		id, created, err = actionStorage.CreateWithKey(key, IdempotencyKeyTTL, action)
+	}
+	if err == storage.ErrKeyInUse {
+		api.RespondError(c, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
-		panic(err)
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	actionAPIMetrics := c.MustGet("metrics").(*ActionAPIMetrics)
+	if created {
+		actionAPIMetrics.actionsCreated.Inc()
+	}
+
+	// The Action was triggered, if requested, by the request that created it.
+	trigger = trigger && created
+
+	if trigger {
+		// Load the Action from storage so that it is initialized the same way as
+		// when it is triggered via the trigger endpoint e.g. with its
+		// dependencies injected.
+		createdAction, err := actionStorage.Get(*id)
+		if errors.Is(err, errorsUtil.ErrNotFound) {
+			err = fmt.Errorf("the Action with ID \"%d\" was not found right after being created", *id)
+		}
+		if err != nil {
+			api.RespondError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		// We only need to acknowledge that the Action was triggered; we don't
+		// have to wait for the execution to finish as this can take time.
+		actionAPIMetrics.triggersRequested.Inc()
+		logger := log.FromContext(c).With("action_id", *id)
+		actionContext := common.ActionContext{Timestamp: time.Now()}
+		breakers := c.MustGet("circuit_breakers").(*circuitBreakers)
+		ctx := executionContext(c)
+		timeout := c.MustGet("execution_timeout").(time.Duration)
+		c.MustGet("executions").(*pool.Group).Go(func() {
+			execute(ctx, timeout, *id, *createdAction, actionContext, breakers, actionAPIMetrics, logger)
+		})
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":    http.StatusOK,
+			"id":        id,
+			"triggered": trigger,
+		},
+	)
+}
+
+// v1Bulk provides an endpoint that creates multiple Actions based on the JSON
+// array of objects given in the request, each in the same structure that is
+// expected by the create endpoint. Every Action is created independently; the
+// response contains the ID of each created Action or the reason it failed,
+// keyed by its index in the request. It responds with status 207 when any of
+// the Actions fails.
+func v1Bulk(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to create Actions
+	 */
+
+	if c.Param("id") != "bulk" {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+
+	// Each element is decoded separately so that a malformed element fails
+	// only the corresponding Action.
+	var elements []json.RawMessage
+	err := api.BindJSON(c, &elements)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+	if len(elements) > BulkLimitMax {
+		err = fmt.Errorf("%d Actions were given while up to %d can be created at once", len(elements), BulkLimitMax)
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	actionStorage := c.MustGet("storage").(storage.Storage)
+	actionAPIMetrics := c.MustGet("metrics").(*ActionAPIMetrics)
+	logger := log.FromContext(c)
+
+	status := http.StatusOK
+	results := make([]bulkResult, len(elements))
+	for index, element := range elements {
+		results[index].Index = index
+
+		var wrapper wrapper.ActionWrapper
+		err := json.Unmarshal(element, &wrapper)
+		if err == nil && wrapper.Action == nil {
+			err = fmt.Errorf("no Action was given")
+		}
+		if err == nil {
+			err = checkTargetURL(c, wrapper.Action)
+		}
+		if err != nil {
+			status = http.StatusMultiStatus
+			results[index].Error = err.Error()
+			continue
+		}
+
+		// Storage errors are not exposed to the caller, same as when creating
+		// individual Actions.
+		id, err := actionStorage.Create(wrapper.Action)
+		if err != nil {
+			logger.Error("failed to create the Action", "index", index, "err", err)
+			status = http.StatusMultiStatus
+			results[index].Error = "the Action could not be stored"
+			continue
+		}
+		actionAPIMetrics.actionsCreated.Inc()
+		results[index].ID = id
+	}
+
+	c.JSON(
+		status,
+		gin.H{
+			"status":  status,
+			"results": results,
+		},
+	)
+}
+
+// v1List provides an endpoint that lists the stored Actions. The results are
+// paginated via the "since" and "limit" query parameters, where "since" is the
+// cursor returned as "next" by the previous page; "next" is null after the last
+// page.
+func v1List(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to list Actions
+	 */
+
+	since, err := strconv.Atoi(c.DefaultQuery("since", "0"))
+	if err != nil || since < 0 {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(ListLimitDefault)))
+	if err != nil || limit < 1 || limit > ListLimitMax {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// Get the Actions from storage. Actions that could not be loaded are
+	// reported in the response instead of failing the whole request.
+	actionStorage := c.MustGet("storage").(storage.Storage)
+	actions, nextID, listErrors, err := actionStorage.ListSince(since, limit)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	var next *int
+	if nextID != 0 {
+		next = &nextID
+	}
+
+	// Wrap the Actions so that their type is included in the response.
+	wrappers := make([]*wrapper.ActionWrapper, 0, len(actions))
+	for _, action := range actions {
+		actionWrapper, err := wrapper.Wrapper(*action)
+		if err != nil {
+			listErrors = append(listErrors, err)
+			continue
+		}
+		wrappers = append(wrappers, actionWrapper)
+	}
+
+	sErrors := make([]string, len(listErrors))
+	for i, listError := range listErrors {
+		sErrors[i] = listError.Error()
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":  http.StatusOK,
+			"actions": wrappers,
+			"next":    next,
+			"errors":  sErrors,
+		},
+	)
+}
+
+// v1Get provides an endpoint that returns the Action with the ID given in the
+// request. The Action is returned together with its type, in the same structure
+// that is expected by the create endpoint.
+func v1Get(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to view Actions
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	actionStorage := c.MustGet("storage").(storage.Storage)
+	action, err := actionStorage.Get(id)
+
+	// Return a Not Found response if there is no Action with such ID.
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Wrap the Action so that its type is included in the response.
+	actionWrapper, err := wrapper.Wrapper(*action)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
 	}
 
 	// All good.
@@ -113,15 +601,150 @@ func v1Create(c *gin.Context) {
 		gin.H{
 			"status": http.StatusOK,
 			"id":     id,
+			"type":   actionWrapper.Type,
+			"action": actionWrapper.Action,
+		},
+	)
+}
+
+// v1Update provides an endpoint that updates the Action with the ID given in
+// the request, based on the JSON object given in the request in the same
+// structure that is expected by the create endpoint. The Action keeps its ID so
+// that the Watches referencing it are not affected; its type cannot be changed.
+// The updated Action is returned in the same structure that is returned by the
+// get endpoint.
+func v1Update(c *gin.Context) {
+	/**
+	 * @I Validate parameters per Action type
+	 * @I Ensure the caller has the permissions to update Actions
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// The parameters are provided as a JSON object in the request. Bind it to an
+	// object of the corresponding type.
+	var actionWrapper wrapper.ActionWrapper
+	err = api.BindJSON(c, &actionWrapper)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+	if actionWrapper.Action == nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+	action := actionWrapper.Action
+
+	// Do not allow Actions to make requests to URLs that are not allowed, same as
+	// when creating Actions.
+	err = checkTargetURL(c, action)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Return a Not Found response if there is no Action with such ID.
+	actionStorage := c.MustGet("storage").(storage.Storage)
+	existingAction, err := actionStorage.Get(id)
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Watches trigger Actions expecting them to do a certain kind of thing; a new
+	// Action should be created instead of changing the type of an existing one.
+	existingWrapper, err := wrapper.Wrapper(*existingAction)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if actionWrapper.Type != existingWrapper.Type {
+		err = fmt.Errorf(
+			"the type of the Action with ID \"%d\" cannot be changed from \"%s\" to \"%s\"",
+			id,
+			existingWrapper.Type,
+			actionWrapper.Type,
+		)
+		api.RespondError(c, http.StatusConflict, err)
+		return
+	}
+
+	// The creation time is maintained by the system; keep the existing one
+	// unless given.
+	base, err := common.Base(action)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if base.CreatedAt == nil {
+		existingBase, err := common.Base(*existingAction)
+		if err != nil {
+			api.RespondError(c, http.StatusInternalServerError, err)
+			return
+		}
+		base.CreatedAt = existingBase.CreatedAt
+		err = common.SetBase(&action, *base)
+		if err != nil {
+			api.RespondError(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	err = actionStorage.Update(id, action)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Load the Action from storage so that the response includes the fields
+	// maintained by the Storage, such as the time it was updated.
+	updatedAction, err := actionStorage.Get(id)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status": http.StatusOK,
+			"id":     id,
+			"type":   actionWrapper.Type,
+			"action": *updatedAction,
 		},
 	)
 }
 
 // v1Trigger provides an endpoint that triggers the Actions given in the request
-// by their ID.
+// by their ID. The request body may contain the context in which the Actions
+// are triggered, such as the Watch that triggered them, which is passed on to
+// the Actions.
 func v1Trigger(c *gin.Context) {
 	/**
-	 * @I Implement authentication of the caller
 	 * @I Does the id need any escaping?
 	 * @I Ensure the caller has the permissions to trigger actions
 	 * @I Consider allowing the caller to pass on the actions as well for being
@@ -129,35 +752,40 @@ func v1Trigger(c *gin.Context) {
 	 * @I Investigate whether we need our own response status codes
 	 */
 
-	// The "ids" parameter is required. We allow for multiple comma-separated
+	// The "id" parameter is required. We allow for multiple comma-separated
 	// string IDs, so we need to convert them to an array of integer IDs.
 	// We want to make sure that the caller makes the request they want to without
 	// mistakes, so we do not trigger any Actions if there is any error, even in
 	// one of the IDs.
-	sIDs := c.Param("ids")
-	aIDsInt, err := util.StringToIntegers(sIDs, ",")
+	sIDs := c.Param("id")
+	// A malformed ID is a mistake of the caller rather than a missing resource,
+	// so we respond with a Bad Request.
+	aIDsInt, err := util.StringToIntSlice(sIDs, ",")
 	if err != nil {
 		c.JSON(
-			http.StatusNotFound,
+			http.StatusBadRequest,
 			gin.H{
-				"status": http.StatusNotFound,
+				"status": http.StatusBadRequest,
 			},
 		)
 		return
 	}
 
+	actionContext, err := triggerContext(c)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+
 	// Get the Actions with the requested IDs from storage.
-	storage := c.MustGet("storage").(storage.Storage)
+	actionStorage := c.MustGet("storage").(storage.Storage)
 
 	var actions []*common.Action
-	for iID := range aIDsInt {
-		action, err := storage.Get(iID)
-		if err != nil {
-			panic(err)
-		}
+	for _, iID := range aIDsInt {
+		action, err := actionStorage.Get(iID)
 
 		// Return a Not Found response if there is no Action with such ID.
-		if action == nil {
+		if errors.Is(err, errorsUtil.ErrNotFound) {
 			c.JSON(
 				http.StatusNotFound,
 				gin.H{
@@ -166,6 +794,10 @@ func v1Trigger(c *gin.Context) {
 			)
 			return
 		}
+		if err != nil {
+			api.RespondError(c, http.StatusInternalServerError, err)
+			return
+		}
 
 		// We could trigger the Action at this point, however we prefer to check
 		// that all Actions exist first.
@@ -175,36 +807,101 @@ func v1Trigger(c *gin.Context) {
 	// Trigger executions of the Actions.
 	// We only need to acknowledge that the Actions were triggered; we don't have
 	// to for the execution to finish as this can take time.
-	for _, pointer := range actions {
-		go func() {
-			action := *pointer
-			// @I Log errors occurring during execution of Actions
-			_ = action.Do()
-		}()
+	// The executions are tracked so that they can finish before shutting down.
+	// Each execution is given its own Action; the loop variable is reused across
+	// iterations and would otherwise be shared by all of them.
+	executions := c.MustGet("executions").(*pool.Group)
+	actionAPIMetrics := c.MustGet("metrics").(*ActionAPIMetrics)
+	breakers := c.MustGet("circuit_breakers").(*circuitBreakers)
+	ctx := executionContext(c)
+	timeout := c.MustGet("execution_timeout").(time.Duration)
+	actionAPIMetrics.triggersRequested.Add(float64(len(actions)))
+	shortCircuited := 0
+	for i, pointer := range actions {
+		action := *pointer
+		actionID := aIDsInt[i]
+		logger := log.FromContext(c).With("action_id", actionID)
+
+		// Actions that keep failing are not executed until their cool-down
+		// period is over.
+		if !breakers.allow(actionID) {
+			shortCircuited++
+			actionAPIMetrics.triggersShortCircuited.Inc()
+			logger.Warn("the Action was not executed because it keeps failing")
+			continue
+		}
+
+		executions.Go(func() {
+			execute(ctx, timeout, actionID, action, actionContext, breakers, actionAPIMetrics, logger)
+		})
 	}
 
-	// All good.
-	c.JSON(
-		http.StatusOK,
-		gin.H{
-			"status": http.StatusOK,
-		},
-	)
+	// All good. The number of Actions that were not executed because they keep
+	// failing is only included when there are any.
+	response := gin.H{
+		"status": http.StatusOK,
+	}
+	if shortCircuited != 0 {
+		response["short_circuited"] = shortCircuited
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 /**
  * Middleware.
  */
 
-// Storage is a Gin middleware that makes available the Storage engine to the
+// Storage is a Gin middleware that makes available the given Storage engine to
+// the endpoint controllers.
+func Storage(actionStorage storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("storage", actionStorage)
+		c.Next()
+	}
+}
+
+// Executions is a Gin middleware that makes available the given Group, used for
+// executing Actions, to the endpoint controllers.
+func Executions(executions *pool.Group) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("executions", executions)
+		c.Next()
+	}
+}
+
+// ExecutionTimeout is a Gin middleware that makes available the given maximum
+// time that each execution of an Action can take to the endpoint controllers.
+func ExecutionTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("execution_timeout", timeout)
+		c.Next()
+	}
+}
+
+// AllowedURLs is a Gin middleware that makes available the given URL allow-list
+// to the endpoint controllers.
+func AllowedURLs(allowList util.URLAllowList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("url_allow_list", allowList)
+		c.Next()
+	}
+}
+
+// CircuitBreakers is a Gin middleware that makes available the given circuit
+// breakers, used for stopping executions of Actions that keep failing, to the
 // endpoint controllers.
-func Storage(config map[string]interface{}) gin.HandlerFunc {
+func CircuitBreakers(breakers *circuitBreakers) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		storage, err := storage.Create(config)
-		if err != nil {
-			panic(err)
-		}
-		c.Set("storage", storage)
+		c.Set("circuit_breakers", breakers)
+		c.Next()
+	}
+}
+
+// Metrics is a Gin middleware that makes available the given metrics to the
+// endpoint controllers.
+func Metrics(actionAPIMetrics *ActionAPIMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("metrics", actionAPIMetrics)
 		c.Next()
 	}
 }
@@ -213,10 +910,334 @@ func Storage(config map[string]interface{}) gin.HandlerFunc {
  * Functions/types for internal use.
  */
 
+// check loads and validates the configuration from the given file, builds the
+// Storage engine and checks that it is available, writing the outcome of each
+// step to the given writer. It returns an error if any of the steps fails.
+func check(configPath string, out io.Writer) error {
+	var actionAPIConfig config.Config
+	var actionStorage storage.Storage
+
+	return api.Check(
+		out,
+		[]api.CheckStep{
+			{
+				Name: "configuration",
+				Run: func() error {
+					err := util.ReadJSONFileExpandEnv(configPath, &actionAPIConfig)
+					if err != nil {
+						return err
+					}
+					return actionAPIConfig.Validate()
+				},
+			},
+			{
+				Name: "storage",
+				Run: func() error {
+					var err error
+					actionStorage, err = storage.Create(actionAPIConfig.Storage)
+					return err
+				},
+			},
+			{
+				Name: "storage ping",
+				Run: func() error {
+					return actionStorage.Ping()
+				},
+			},
+		},
+	)
+}
+
+// bulkResult holds the outcome of creating one of the Actions given to the bulk
+// endpoint, that is either the ID of the created Action or the error that
+// prevented it from being created.
+type bulkResult struct {
+	Index int    `json:"index"`
+	ID    *int   `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// checkTargetURL returns an error if the given Action makes requests to a URL
+// that is not allowed by the URL allow-list made available to the controllers.
+// Actions that do not make requests to a URL given as part of them are always
+// allowed.
+func checkTargetURL(c *gin.Context, action common.Action) error {
+	target, ok := action.(common.URLTarget)
+	if !ok {
+		return nil
+	}
+
+	URL := target.TargetURL()
+	if !c.MustGet("url_allow_list").(util.URLAllowList).Allowed(URL) {
+		return fmt.Errorf("the URL \"%s\" is not allowed", URL)
+	}
+
+	return nil
+}
+
+// triggerContext returns the context given in the body of a trigger request.
+// The body is optional; the context's timestamp defaults to the current time.
+func triggerContext(c *gin.Context) (common.ActionContext, error) {
+	var actionContext common.ActionContext
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return actionContext, err
+	}
+	if len(body) != 0 {
+		err = json.Unmarshal(body, &actionContext)
+		if err != nil {
+			return actionContext, err
+		}
+	}
+
+	if actionContext.Timestamp.IsZero() {
+		actionContext.Timestamp = time.Now()
+	}
+
+	return actionContext, nil
+}
+
+// executionContext returns the context.Context that the Actions triggered by
+// the given request are executed with. The executions outlive the request since
+// we respond without waiting for them, so the context carries the request's
+// values but it is not cancelled when the request finishes; each execution is
+// instead given its own deadline by execute().
+func executionContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
+// execute executes the given Action with the given context, recording whether
+// it succeeded in the metrics and in the circuit breaker of the Action with the
+// given ID. The execution is cancelled if it does not finish within the given
+// timeout, and it then counts as a failure. Failures are logged using the given
+// Logger.
+func execute(
+	ctx context.Context,
+	timeout time.Duration,
+	actionID int,
+	action common.Action,
+	actionContext common.ActionContext,
+	breakers *circuitBreakers,
+	actionAPIMetrics *ActionAPIMetrics,
+	logger *log.Logger,
+) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := action.Do(ctx, actionContext)
+	breakers.record(actionID, err)
+	if err != nil {
+		actionAPIMetrics.actionExecutionFailures.Inc()
+		logger.Error("failed to execute the Action", "err", err)
+		return
+	}
+	actionAPIMetrics.actionsExecuted.Inc()
+}
+
+// The states of a circuit breaker. While closed, the Action is executed
+// normally. While open, the Action is not executed. While half-open, one
+// execution of the Action is in progress as a trial, and no other executions are
+// made until it finishes.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreakers keeps track of the consecutive failures of the Actions, and it
+// stops executing an Action after it fails the configured number of times in a
+// row. After a cool-down period one execution is allowed as a trial; the
+// executions resume if it succeeds, otherwise they are stopped again for double
+// the previous cool-down period, up to the configured maximum. It is shared by
+// all requests.
+type circuitBreakers struct {
+	sync.Mutex
+	threshold   int
+	coolDown    time.Duration
+	coolDownMax time.Duration
+	circuits    map[int]*circuit
+	state       *prometheus.GaugeVec
+	// now returns the current time. It is defined as a field so that it can be
+	// replaced in tests.
+	now func() time.Time
+}
+
+// circuit holds the state of the circuit breaker of an Action. Actions that
+// have succeeded since their last failure have no circuit.
+type circuit struct {
+	state     int
+	failures  int
+	coolDown  time.Duration
+	openUntil time.Time
+}
+
+// newCircuitBreakers creates circuit breakers with the given options, with all
+// circuits closed. The state of each circuit is recorded in the given gauge.
+func newCircuitBreakers(
+	threshold int,
+	coolDown time.Duration,
+	coolDownMax time.Duration,
+	state *prometheus.GaugeVec,
+) *circuitBreakers {
+	return &circuitBreakers{
+		threshold:   threshold,
+		coolDown:    coolDown,
+		coolDownMax: coolDownMax,
+		circuits:    map[int]*circuit{},
+		state:       state,
+		now:         time.Now,
+	}
+}
+
+// allow returns whether the Action with the given ID can be executed. When the
+// cool-down period of an open circuit is over, the circuit becomes half-open and
+// the call that made it so is allowed as the trial execution.
+func (breakers *circuitBreakers) allow(actionID int) bool {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	current, ok := breakers.circuits[actionID]
+	if !ok {
+		return true
+	}
+
+	switch current.state {
+	case circuitOpen:
+		if breakers.now().Before(current.openUntil) {
+			return false
+		}
+		breakers.setState(actionID, current, circuitHalfOpen)
+		return true
+	case circuitHalfOpen:
+		return false
+	}
+
+	return true
+}
+
+// record records the outcome of an execution of the Action with the given ID,
+// given as the error returned by the Action, if any.
+func (breakers *circuitBreakers) record(actionID int, err error) {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	// A success closes the circuit.
+	if err == nil {
+		if _, ok := breakers.circuits[actionID]; ok {
+			delete(breakers.circuits, actionID)
+			breakers.state.DeleteLabelValues(strconv.Itoa(actionID))
+		}
+		return
+	}
+
+	current, ok := breakers.circuits[actionID]
+	if !ok {
+		current = &circuit{coolDown: breakers.coolDown}
+		breakers.circuits[actionID] = current
+	}
+
+	switch current.state {
+	case circuitHalfOpen:
+		// The trial failed; stop the executions for longer.
+		current.coolDown *= 2
+		if current.coolDown > breakers.coolDownMax {
+			current.coolDown = breakers.coolDownMax
+		}
+	case circuitClosed:
+		current.failures++
+		if current.failures < breakers.threshold {
+			return
+		}
+	default:
+		// Executions that started before the circuit was opened do not extend
+		// the cool-down period.
+		return
+	}
+
+	current.openUntil = breakers.now().Add(current.coolDown)
+	breakers.setState(actionID, current, circuitOpen)
+}
+
+// setState changes the state of the given circuit of the Action with the given
+// ID, and it records it in the gauge.
+func (breakers *circuitBreakers) setState(actionID int, current *circuit, state int) {
+	current.state = state
+	breakers.state.WithLabelValues(strconv.Itoa(actionID)).Set(float64(state))
+}
+
+// ActionAPIMetrics holds the metrics collected by the Action API, and the
+// registry that exposes them.
+type ActionAPIMetrics struct {
+	registry *prometheus.Registry
+
+	requests                *prometheus.CounterVec
+	actionsCreated          prometheus.Counter
+	triggersRequested       prometheus.Counter
+	actionsExecuted         prometheus.Counter
+	actionExecutionFailures prometheus.Counter
+	triggersShortCircuited  prometheus.Counter
+	circuitBreakerState     *prometheus.GaugeVec
+}
+
+// NewActionAPIMetrics creates the metrics collected by the Action API and
+// registers them with a new registry.
+func NewActionAPIMetrics() *ActionAPIMetrics {
+	actionAPIMetrics := &ActionAPIMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: metrics.NewRequestsCounter("action_api"),
+		actionsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "actions_created_total",
+			Help:      "The number of Actions created.",
+		}),
+		triggersRequested: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "action_triggers_requested_total",
+			Help:      "The number of Action executions requested.",
+		}),
+		actionsExecuted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "actions_executed_total",
+			Help:      "The number of Actions executed successfully.",
+		}),
+		actionExecutionFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "action_execution_failures_total",
+			Help:      "The number of Actions that failed to execute.",
+		}),
+		triggersShortCircuited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "action_triggers_short_circuited_total",
+			Help:      "The number of Action executions not made because the Action keeps failing.",
+		}),
+		circuitBreakerState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: metrics.Namespace,
+				Name:      "action_circuit_breaker_state",
+				Help:      "The state of the circuit breaker of each Action that keeps failing; 1 when open, 2 when half-open.",
+			},
+			[]string{"action_id"},
+		),
+	}
+
+	actionAPIMetrics.registry.MustRegister(
+		actionAPIMetrics.requests,
+		actionAPIMetrics.actionsCreated,
+		actionAPIMetrics.triggersRequested,
+		actionAPIMetrics.actionsExecuted,
+		actionAPIMetrics.actionExecutionFailures,
+		actionAPIMetrics.triggersShortCircuited,
+		actionAPIMetrics.circuitBreakerState,
+	)
+
+	return actionAPIMetrics
+}
+
 // loadEphmeralActions checks if the storage engine is configured to run in
 // "ephemeral" mode, and if so, it loads into it any Actions contained in the
 // configuration file.
-func loadEphemeralActions(actionAPIConfig *config.Config) {
+func loadEphemeralActions(actionAPIConfig *config.Config, actionStorage storage.Storage) {
 	// @I Load init Actions directly in Redis via a script so that services don't
 	//    have to be restarted together
 	mode, ok := actionAPIConfig.Storage["mode"]
@@ -224,15 +1245,10 @@ func loadEphemeralActions(actionAPIConfig *config.Config) {
 		return
 	}
 
-	storage, err := storage.Create(actionAPIConfig.Storage)
-	if err != nil {
-		panic(err)
-	}
-
 	for _, wrapper := range actionAPIConfig.ActionWrappers {
-		_, err := storage.Set(wrapper.Action)
+		_, err := actionStorage.Create(wrapper.Action)
 		if err != nil {
-			panic(err)
+			log.Fatal("failed to load the ephemeral Actions", "err", err)
 		}
 	}
 }
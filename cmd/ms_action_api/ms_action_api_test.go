@@ -0,0 +1,991 @@
+/**
+ * Tests for the Action API.
+ */
+
+package main
+
+import (
+	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	chat "github.com/krystalcode/go-mantis-shrimp/actions/chat"
+	common "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	config "github.com/krystalcode/go-mantis-shrimp/actions/config"
+	actionStorage "github.com/krystalcode/go-mantis-shrimp/actions/storage"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/actions/wrapper"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	metrics "github.com/krystalcode/go-mantis-shrimp/util/metrics"
+	pool "github.com/krystalcode/go-mantis-shrimp/util/pool"
+)
+
+/**
+ * Tests.
+ */
+
+func TestV1Get_StorageError(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "GET", "/v1/1", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Get_NotFound(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "GET", "/v1/1", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+}
+
+func TestV1List_Cursor(t *testing.T) {
+	storage := newTestStorageMemory()
+	for i := 0; i < 5; i++ {
+		response := testRequest(storage, "POST", "/v1/", testActionJSON("https://hooks.example.com/abc"))
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+
+	// Go through pages of 2 Actions following the cursors.
+	var pages []int
+	url := "/v1/?limit=2"
+	for len(pages) < 5 {
+		response := testRequest(storage, "GET", url, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		var decoded struct {
+			Actions []json.RawMessage `json:"actions"`
+			Next    *int              `json:"next"`
+		}
+		err := json.Unmarshal(response.Body.Bytes(), &decoded)
+		assert.Nil(t, err)
+		pages = append(pages, len(decoded.Actions))
+		if decoded.Next == nil {
+			break
+		}
+		url = fmt.Sprintf("/v1/?limit=2&since=%d", *decoded.Next)
+	}
+	assert.Equal(t, []int{2, 2, 1}, pages)
+
+	for _, url := range []string{"/v1/?since=-1", "/v1/?since=abc", "/v1/?limit=0", "/v1/?limit=101"} {
+		response := testRequest(storage, "GET", url, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, url)
+	}
+}
+
+func TestV1List_StorageError(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "GET", "/v1/", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Create_StorageError(t *testing.T) {
+	response := testRequest(
+		TestStorage_Error{},
+		"POST",
+		"/v1/",
+		`{"type":"chat_message","action":{"name":"Test Action","url":"https://example.com"}}`,
+	)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Create_NoTrigger(t *testing.T) {
+	server, requests := testServer()
+	defer server.Close()
+
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/", testActionJSON(server.URL))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"triggered":false}`, response.Body.String())
+
+	// The Action should not be executed.
+	select {
+	case <-requests:
+		t.Error("the Action was executed without being triggered")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestV1Create_Trigger(t *testing.T) {
+	server, requests := testServer()
+	defer server.Close()
+
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/?trigger=true", testActionJSON(server.URL))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"triggered":true}`, response.Body.String())
+
+	// The Action should be executed i.e. the chat message should be posted.
+	select {
+	case <-requests:
+	case <-time.After(time.Second):
+		t.Error("the Action was not executed after being triggered")
+	}
+}
+
+func TestV1Create_InvalidTrigger(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/?trigger=maybe", testActionJSON("https://example.com"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestV1Trigger_MultipleActions(t *testing.T) {
+	server, requests := testServer()
+	defer server.Close()
+
+	// Each Action posts to a different path so that we can tell them apart.
+	storage := newTestStorageMemory()
+	for _, path := range []string{"/1", "/2", "/3"} {
+		response := testRequest(storage, "POST", "/v1/", testActionJSON(server.URL+path))
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := testRequest(storage, "POST", "/v1/1,2,3/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Every Action should be executed.
+	var paths []string
+	timeout := time.After(time.Second)
+	for len(paths) < 3 {
+		select {
+		case path := <-requests:
+			paths = append(paths, path)
+		case <-timeout:
+			t.Fatalf("only %d out of 3 Actions were executed", len(paths))
+		}
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{"/1", "/2", "/3"}, paths)
+}
+
+func TestV1Trigger_Context(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testActionJSON(server.URL))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// The context should be passed on to the Action i.e. the chat message should
+	// include the name of the Watch.
+	response = testRequest(
+		storage,
+		"POST",
+		"/v1/1/trigger",
+		`{"watch_name":"example.com health","status":"inaccessible","timestamp":"2017-05-01T10:30:00Z"}`,
+	)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	select {
+	case body := <-bodies:
+		assert.Contains(t, body, `"title":"example.com health"`)
+		assert.Contains(t, body, `"text":"Status: inaccessible"`)
+	case <-time.After(time.Second):
+		t.Error("the Action was not executed after being triggered")
+	}
+}
+
+func TestV1Trigger_InvalidContext(t *testing.T) {
+	// The Storage should not be reached when the context is invalid.
+	response := testRequest(TestStorage_Error{}, "POST", "/v1/1/trigger", `{"watch_name":`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.JSONEq(t, `{"status":400}`, response.Body.String())
+}
+
+func TestV1Bulk_Success(t *testing.T) {
+	storage := newTestStorageMemory()
+	body := "[" + testActionJSON("https://example.com") + "," + testActionJSON("https://example.org") + "]"
+	response := testRequest(storage, "POST", "/v1/bulk", body)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":200,"results":[{"index":0,"id":1},{"index":1,"id":2}]}`,
+		response.Body.String(),
+	)
+
+	exists, err := storage.Exists(2)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestV1Bulk_PartialFailure(t *testing.T) {
+	storage := newTestStorageMemory()
+	body := "[" +
+		testActionJSON("https://example.com") + "," +
+		`{"type":"unknown","action":{"name":"Test Action"}},` +
+		testActionJSON("https://example.org") +
+		"]"
+	response := testRequest(storage, "POST", "/v1/bulk", body)
+	assert.Equal(t, http.StatusMultiStatus, response.Code)
+
+	var decoded struct {
+		Status  int          `json:"status"`
+		Results []bulkResult `json:"results"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMultiStatus, decoded.Status)
+	assert.Len(t, decoded.Results, 3)
+	assert.Equal(t, 1, *decoded.Results[0].ID)
+	assert.Nil(t, decoded.Results[1].ID)
+	assert.NotEmpty(t, decoded.Results[1].Error)
+	assert.Equal(t, 2, *decoded.Results[2].ID)
+
+	// Storage errors are reported per Action without their details.
+	response = testRequest(TestStorage_Error{}, "POST", "/v1/bulk", "["+testActionJSON("https://example.com")+"]")
+	assert.Equal(t, http.StatusMultiStatus, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":207,"results":[{"index":0,"error":"the Action could not be stored"}]}`,
+		response.Body.String(),
+	)
+}
+
+func TestV1Bulk_MalformedElements(t *testing.T) {
+	storage := newTestStorageMemory()
+	body := `["chat_message",{},{"action":{"name":"Test Action"}},` + testActionJSON("https://example.com") + `]`
+	response := testRequest(storage, "POST", "/v1/bulk", body)
+	assert.Equal(t, http.StatusMultiStatus, response.Code)
+
+	var decoded struct {
+		Results []bulkResult `json:"results"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Len(t, decoded.Results, 4)
+	for index, result := range decoded.Results[:3] {
+		assert.Equal(t, index, result.Index)
+		assert.Nil(t, result.ID, "case %d", index)
+		assert.NotEmpty(t, result.Error, "case %d", index)
+	}
+	assert.Equal(t, 1, *decoded.Results[3].ID)
+}
+
+func TestV1Bulk_InvalidRequest(t *testing.T) {
+	storage := newTestStorageMemory()
+
+	// The Actions should be given as an array.
+	response := testRequest(storage, "POST", "/v1/bulk", testActionJSON("https://example.com"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	elements := make([]string, BulkLimitMax+1)
+	for index := range elements {
+		elements[index] = testActionJSON("https://example.com")
+	}
+	response = testRequest(storage, "POST", "/v1/bulk", "["+strings.Join(elements, ",")+"]")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	exists, _ := storage.Exists(1)
+	assert.False(t, exists)
+
+	// Only the "bulk" path is served by the endpoint.
+	response = testRequest(storage, "POST", "/v1/1", "[]")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestV1Create_AllowedURLs(t *testing.T) {
+	allowList, err := util.NewURLAllowList([]string{"^https://hooks\\.example\\.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := newTestStorageMemory()
+	router := testRouter(storage, NewActionAPIMetrics(), allowList)
+
+	// Allowed.
+	response := testServe(router, "POST", "/v1/", testActionJSON("https://hooks.example.com/abc"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Blocked; the Action should not be stored.
+	response = testServe(router, "POST", "/v1/", testActionJSON("http://169.254.169.254/latest/meta-data"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.JSONEq(t, `{"status":400}`, response.Body.String())
+	exists, _ := storage.Exists(2)
+	assert.False(t, exists)
+
+	// Blocked Actions fail individually when created in bulk.
+	body := "[" +
+		testActionJSON("https://internal.example.com/abc") + "," +
+		testActionJSON("https://hooks.example.com/def") +
+		"]"
+	response = testServe(router, "POST", "/v1/bulk", body)
+	assert.Equal(t, http.StatusMultiStatus, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":207,"results":[{"index":0,"error":"the URL \"https://internal.example.com/abc\" is not allowed"},{"index":1,"id":2}]}`,
+		response.Body.String(),
+	)
+}
+
+func TestV1Create_IdempotencyKey(t *testing.T) {
+	storage := newTestStorageMemory()
+	router := testRouter(storage, NewActionAPIMetrics(), nil)
+	create := func(key string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("POST", "/v1/", strings.NewReader(testActionJSON("https://example.com")))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Idempotency-Key", key)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	// Two requests with the same key yield one Action with the same ID.
+	response := create("key-1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"triggered":false}`, response.Body.String())
+	response = create("key-1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"triggered":false}`, response.Body.String())
+	assert.Len(t, storage.actions, 1)
+
+	// Different keys yield distinct Actions.
+	response = create("key-2")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":2,"triggered":false}`, response.Body.String())
+	assert.Len(t, storage.actions, 2)
+
+	// Keys that are too long are rejected.
+	response = create(strings.Repeat("k", IdempotencyKeyLengthMax+1))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Len(t, storage.actions, 2)
+}
+
+func TestV1Create_IdempotencyKeyTrigger(t *testing.T) {
+	server, requests := testServer()
+	defer server.Close()
+
+	storage := newTestStorageMemory()
+	router := testRouter(storage, NewActionAPIMetrics(), nil)
+	create := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("POST", "/v1/?trigger=true", strings.NewReader(testActionJSON(server.URL)))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Idempotency-Key", "key-1")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	response := create()
+	assert.JSONEq(t, `{"status":200,"id":1,"triggered":true}`, response.Body.String())
+	select {
+	case <-requests:
+	case <-time.After(time.Second):
+		t.Error("the Action was not executed after being created")
+	}
+
+	// The Action is not triggered again when the request is repeated.
+	response = create()
+	assert.JSONEq(t, `{"status":200,"id":1,"triggered":false}`, response.Body.String())
+	select {
+	case <-requests:
+		t.Error("the Action was executed again when the request was repeated")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestV1Create_IdempotencyKeyInUse(t *testing.T) {
+	request, _ := http.NewRequest("POST", "/v1/", strings.NewReader(testActionJSON("https://example.com")))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Idempotency-Key", "key-1")
+	response := httptest.NewRecorder()
+	testRouter(TestStorage_KeyInUse{}, NewActionAPIMetrics(), nil).ServeHTTP(response, request)
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.JSONEq(t, `{"status":409}`, response.Body.String())
+}
+
+func TestV1Update_Success(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testActionJSON("https://example.com"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	created, err := storage.Get(1)
+	assert.Nil(t, err)
+	createdBase, err := common.Base(*created)
+	assert.Nil(t, err)
+
+	// Rotate the webhook URL.
+	response = testRequest(storage, "PUT", "/v1/1", testActionJSON("https://example.org"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// The updated Action is returned.
+	var decoded struct {
+		Status int         `json:"status"`
+		ID     int         `json:"id"`
+		Type   string      `json:"type"`
+		Action chat.Action `json:"action"`
+	}
+	err = json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, decoded.Status)
+	assert.Equal(t, 1, decoded.ID)
+	assert.Equal(t, "chat_message", decoded.Type)
+	assert.Equal(t, "https://example.org", decoded.Action.URL)
+
+	// The Action is updated in place, keeping its creation time.
+	updated, err := storage.Get(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.org", (*updated).(chat.Action).URL)
+	updatedBase, err := common.Base(*updated)
+	assert.Nil(t, err)
+	assert.Equal(t, createdBase.CreatedAt, updatedBase.CreatedAt)
+	assert.Len(t, storage.actions, 1)
+}
+
+func TestV1Update_NotFound(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "PUT", "/v1/1", testActionJSON("https://example.org"))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+
+	// No Action should be created.
+	assert.Len(t, storage.actions, 0)
+}
+
+func TestV1Update_InvalidPayload(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testActionJSON("https://example.com"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	bodies := []string{
+		`{"type":`,
+		`{}`,
+		`{"action":{"name":"Test Action"}}`,
+		`{"type":"unknown","action":{"name":"Test Action"}}`,
+	}
+	for _, body := range bodies {
+		response = testRequest(storage, "PUT", "/v1/1", body)
+		assert.Equal(t, http.StatusBadRequest, response.Code, body)
+	}
+
+	response = testRequest(storage, "PUT", "/v1/abc", testActionJSON("https://example.org"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	// The type of the Action cannot be changed.
+	response = testRequest(
+		storage,
+		"PUT",
+		"/v1/1",
+		`{"type":"pagerduty","action":{"name":"Test Action","routing_key":"key"}}`,
+	)
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.JSONEq(t, `{"status":409}`, response.Body.String())
+
+	// The Action should be left unchanged.
+	stored, err := storage.Get(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", (*stored).(chat.Action).URL)
+}
+
+func TestV1Create_InvalidJSON(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "POST", "/v1/", `{"type":`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestV1Trigger_StorageError(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Trigger_InvalidID(t *testing.T) {
+	// The Storage should not be reached when the IDs are invalid; if it is, the
+	// response will be an Internal Server Error.
+	for _, ids := range []string{"abc", "1,abc", "1,,2"} {
+		response := testRequest(TestStorage_Error{}, "POST", "/v1/"+ids+"/trigger", "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, ids)
+		assert.JSONEq(t, `{"status":400}`, response.Body.String(), ids)
+	}
+}
+
+func TestV1Trigger_NotFound(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+}
+
+func TestHealth(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "GET", "/health", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+
+	response = testRequest(TestStorage_Error{}, "GET", "/health", "")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.JSONEq(t, `{"status":503,"error":"the Storage is not available"}`, response.Body.String())
+}
+
+func TestMetrics(t *testing.T) {
+	server, _ := testServer()
+	defer server.Close()
+
+	// A webhook that cannot be reached, so that the Action that posts to it
+	// fails.
+	failingServer, _ := testServer()
+	failingServer.Close()
+
+	actionAPIMetrics := NewActionAPIMetrics()
+	router := testRouter(newTestStorageMemory(), actionAPIMetrics, nil)
+
+	response := testServe(router, "POST", "/v1/?trigger=true", testActionJSON(server.URL))
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = testServe(router, "POST", "/v1/", testActionJSON(failingServer.URL))
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = testServe(router, "POST", "/v1/2/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Wait for both executions to be recorded; they finish in any order.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		body := testServe(router, "GET", "/metrics", "").Body.String()
+		if strings.Contains(body, "mantis_shrimp_actions_executed_total 1") &&
+			strings.Contains(body, "mantis_shrimp_action_execution_failures_total 1") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	response = testServe(router, "GET", "/metrics", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	assert.Contains(t, body, "mantis_shrimp_action_api_requests_total{")
+	assert.Contains(t, body, "mantis_shrimp_actions_created_total 2")
+	assert.Contains(t, body, "mantis_shrimp_action_triggers_requested_total 2")
+	assert.Contains(t, body, "mantis_shrimp_actions_executed_total 1")
+	assert.Contains(t, body, "mantis_shrimp_action_execution_failures_total 1")
+}
+
+func TestCircuitBreakers_Transitions(t *testing.T) {
+	actionAPIMetrics := NewActionAPIMetrics()
+	breakers := newCircuitBreakers(2, time.Minute, 3*time.Minute, actionAPIMetrics.circuitBreakerState)
+	now := time.Date(2017, 5, 1, 10, 30, 0, 0, time.UTC)
+	breakers.now = func() time.Time { return now }
+	failure := fmt.Errorf("the webhook is not available")
+
+	// Closed; one failure is below the threshold.
+	assert.True(t, breakers.allow(1))
+	breakers.record(1, failure)
+	assert.True(t, breakers.allow(1))
+
+	// Open after the second consecutive failure, only for the failing Action.
+	breakers.record(1, failure)
+	assert.False(t, breakers.allow(1))
+	assert.True(t, breakers.allow(2))
+	body := testServe(testRouter(newTestStorageMemory(), actionAPIMetrics, nil), "GET", "/metrics", "").Body.String()
+	assert.Contains(t, body, `mantis_shrimp_action_circuit_breaker_state{action_id="1"} 1`)
+
+	// Half-open after the cool-down; only one trial is allowed.
+	now = now.Add(time.Minute)
+	assert.True(t, breakers.allow(1))
+	assert.False(t, breakers.allow(1))
+
+	// Open again for double the cool-down after the trial fails.
+	breakers.record(1, failure)
+	now = now.Add(time.Minute)
+	assert.False(t, breakers.allow(1))
+	now = now.Add(time.Minute)
+	assert.True(t, breakers.allow(1))
+
+	// The cool-down does not exceed the maximum.
+	breakers.record(1, failure)
+	now = now.Add(3 * time.Minute)
+	assert.True(t, breakers.allow(1))
+
+	// Closed after the trial succeeds; the failures are counted from scratch.
+	breakers.record(1, nil)
+	assert.True(t, breakers.allow(1))
+	breakers.record(1, failure)
+	assert.True(t, breakers.allow(1))
+	body = testServe(testRouter(newTestStorageMemory(), actionAPIMetrics, nil), "GET", "/metrics", "").Body.String()
+	assert.NotContains(t, body, `mantis_shrimp_action_circuit_breaker_state{action_id="1"}`)
+}
+
+func TestExecute_Timeout(t *testing.T) {
+	actionAPIMetrics := NewActionAPIMetrics()
+	breakers := newCircuitBreakers(1, time.Minute, time.Minute, actionAPIMetrics.circuitBreakerState)
+	logger, _ := log.New(ioutil.Discard, log.Config{})
+
+	// The execution is cancelled once the timeout is exceeded, and it counts as
+	// a failure.
+	done := make(chan struct{})
+	go func() {
+		execute(
+			context.Background(),
+			10*time.Millisecond,
+			1,
+			testBlockingAction{},
+			common.ActionContext{},
+			breakers,
+			actionAPIMetrics,
+			logger,
+		)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the execution was not cancelled after the timeout")
+	}
+	assert.False(t, breakers.allowed(1))
+	body := testServe(testRouter(newTestStorageMemory(), actionAPIMetrics, nil), "GET", "/metrics", "").Body.String()
+	assert.Contains(t, body, "mantis_shrimp_action_execution_failures_total 1")
+}
+
+func TestV1Trigger_ShortCircuited(t *testing.T) {
+	server, requests := testServer()
+	defer server.Close()
+
+	// A webhook that cannot be reached, so that the Action that posts to it
+	// fails.
+	failingServer, _ := testServer()
+	failingServer.Close()
+
+	storage := newTestStorageMemory()
+	actionAPIMetrics := NewActionAPIMetrics()
+	breakers := newCircuitBreakers(1, time.Minute, time.Minute, actionAPIMetrics.circuitBreakerState)
+	router := testRouterWithCircuitBreakers(storage, actionAPIMetrics, nil, breakers)
+	for _, URL := range []string{failingServer.URL, server.URL} {
+		response := testServe(router, "POST", "/v1/", testActionJSON(URL))
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := testServe(router, "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+
+	// Wait for the failure to open the circuit.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && breakers.allowed(1) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The failing Action is not executed, while the other Action still is.
+	response = testServe(router, "POST", "/v1/1,2/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"short_circuited":1}`, response.Body.String())
+	select {
+	case <-requests:
+	case <-time.After(time.Second):
+		t.Error("the Action was not executed after being triggered")
+	}
+
+	body := testServe(router, "GET", "/metrics", "").Body.String()
+	assert.Contains(t, body, "mantis_shrimp_action_triggers_short_circuited_total 1")
+
+	// The Action is executed again, as a trial, after the cool-down.
+	breakers.now = func() time.Time { return time.Now().Add(time.Minute) }
+	response = testServe(router, "POST", "/v1/1/trigger", "")
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+}
+
+func TestCheck(t *testing.T) {
+	actionStorage.RegisterStorageFactory(
+		"test_check_memory",
+		func(config map[string]interface{}) (actionStorage.Storage, error) {
+			return newTestStorageMemory(), nil
+		},
+	)
+	actionStorage.RegisterStorageFactory(
+		"test_check_unavailable",
+		func(config map[string]interface{}) (actionStorage.Storage, error) {
+			return TestStorage_Error{}, nil
+		},
+	)
+
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{`{"storage":{"type":"test_check_memory"}}`, ""},
+		{`{"storage":{}}`, `the "configuration" step failed: invalid Action API configuration: the "storage.type" option is required`},
+		{`{"storage":{"type":"test_check_unknown"}}`, `the "storage" step failed: unknown storage engine "test_check_unknown": unknown type`},
+		{`{"storage":{"type":"test_check_unavailable"}}`, `the "storage ping" step failed: the Storage is not available`},
+	}
+	for index, c := range cases {
+		configPath, cleanup := testConfigFile(t, c.config)
+		var out bytes.Buffer
+		err := check(configPath, &out)
+		cleanup()
+
+		if c.err == "" {
+			assert.Nil(t, err, "case %d", index)
+			assert.Contains(t, out.String(), "all 3 steps passed", "case %d", index)
+			continue
+		}
+		assert.EqualError(t, err, c.err, "case %d", index)
+		assert.Contains(t, out.String(), "the check failed", "case %d", index)
+	}
+
+	// The configuration file must exist.
+	err := check("/nonexistent/config.json", ioutil.Discard)
+	assert.NotNil(t, err)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testConfigFile writes the given configuration to a temporary file. It returns
+// the path to the file and a function that removes it.
+func testConfigFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "ms_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(configPath, []byte(content), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return configPath, func() { os.RemoveAll(dir) }
+}
+
+// testRequest makes a request to a router that has the Action API endpoints
+// registered and that makes the given Storage available to them.
+func testRequest(storage interface{}, method string, url string, body string) *httptest.ResponseRecorder {
+	return testServe(testRouter(storage, NewActionAPIMetrics(), nil), method, url, body)
+}
+
+// testRouter creates a router that has the Action API endpoints registered and
+// that makes the given Storage, metrics and URL allow-list available to them,
+// together with circuit breakers with the default options.
+func testRouter(storage interface{}, actionAPIMetrics *ActionAPIMetrics, allowList util.URLAllowList) *gin.Engine {
+	breakers := newCircuitBreakers(
+		config.CircuitBreakerThresholdDefault,
+		config.CircuitBreakerCoolDownDefault,
+		config.CircuitBreakerCoolDownMaxDefault,
+		actionAPIMetrics.circuitBreakerState,
+	)
+	return testRouterWithCircuitBreakers(storage, actionAPIMetrics, allowList, breakers)
+}
+
+// testRouterWithCircuitBreakers creates a router same as testRouter does, that
+// makes the given circuit breakers available to the endpoints.
+func testRouterWithCircuitBreakers(
+	storage interface{},
+	actionAPIMetrics *ActionAPIMetrics,
+	allowList util.URLAllowList,
+	breakers *circuitBreakers,
+) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(metrics.Middleware(actionAPIMetrics.requests))
+	router.Use(Metrics(actionAPIMetrics))
+	router.Use(func(c *gin.Context) {
+		c.Set("storage", storage)
+		c.Next()
+	})
+	router.Use(Executions(&pool.Group{}))
+	router.Use(ExecutionTimeout(config.ExecutionTimeoutDefault))
+	router.Use(AllowedURLs(allowList))
+	router.Use(CircuitBreakers(breakers))
+
+	router.GET(metrics.PathDefault, gin.WrapH(metrics.Handler(actionAPIMetrics.registry)))
+	router.GET(api.PathHealth, api.Health(storage.(api.Pinger)))
+
+	v1 := router.Group("/v1")
+	{
+		v1.GET("/", v1List)
+		v1.POST("/", v1Create)
+		v1.POST("/:id", v1Bulk)
+		v1.GET("/:id", v1Get)
+		v1.PUT("/:id", v1Update)
+		v1.POST("/:id/trigger", v1Trigger)
+	}
+
+	return router
+}
+
+// testServe makes a request to the given router.
+func testServe(router *gin.Engine, method string, url string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+// testBlockingAction is an Action that does not finish until its context is
+// cancelled.
+type testBlockingAction struct{}
+
+func (action testBlockingAction) Do(ctx context.Context, actionContext common.ActionContext) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestStorage_Error is a Storage engine that fails on every operation.
+type TestStorage_Error struct{}
+
+func (storage TestStorage_Error) Create(action common.Action) (*int, error) {
+	return nil, fmt.Errorf("an error has occurred while creating the Action")
+}
+
+func (storage TestStorage_Error) CreateWithKey(key string, ttl time.Duration, action common.Action) (*int, bool, error) {
+	return nil, false, fmt.Errorf("an error has occurred while creating the Action")
+}
+
+func (storage TestStorage_Error) Get(id int) (*common.Action, error) {
+	return nil, fmt.Errorf("an error has occurred while getting the Action")
+}
+
+func (storage TestStorage_Error) Exists(id int) (bool, error) {
+	return false, fmt.Errorf("an error has occurred while checking whether the Action exists")
+}
+
+func (storage TestStorage_Error) Update(id int, action common.Action) error {
+	return fmt.Errorf("an error has occurred while updating the Action")
+}
+
+func (storage TestStorage_Error) ListSince(since int, limit int) ([]*common.Action, int, []error, error) {
+	return nil, 0, nil, fmt.Errorf("an error has occurred while listing the Actions")
+}
+
+func (storage TestStorage_Error) Ping() error {
+	return fmt.Errorf("the Storage is not available")
+}
+
+// TestStorage_KeyInUse is a Storage engine that reports every idempotency key
+// as being in use by a concurrent request.
+type TestStorage_KeyInUse struct {
+	TestStorage_Error
+}
+
+func (storage TestStorage_KeyInUse) CreateWithKey(key string, ttl time.Duration, action common.Action) (*int, bool, error) {
+	return nil, false, actionStorage.ErrKeyInUse
+}
+
+// TestStorage_Memory is a Storage engine that keeps Actions in memory. Actions
+// are stored as JSON and recreated when loaded, the same way as the Redis
+// Storage does.
+type TestStorage_Memory struct {
+	actions map[int][]byte
+	keys    map[string]int
+}
+
+func newTestStorageMemory() *TestStorage_Memory {
+	return &TestStorage_Memory{
+		actions: make(map[int][]byte),
+		keys:    make(map[string]int),
+	}
+}
+
+func (storage *TestStorage_Memory) Create(action common.Action) (*int, error) {
+	id := len(storage.actions) + 1
+	err := storage.Update(id, action)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (storage *TestStorage_Memory) CreateWithKey(key string, ttl time.Duration, action common.Action) (*int, bool, error) {
+	if id, ok := storage.keys[key]; ok {
+		return &id, false, nil
+	}
+	id, err := storage.Create(action)
+	if err != nil {
+		return nil, false, err
+	}
+	storage.keys[key] = *id
+	return id, true, nil
+}
+
+func (storage *TestStorage_Memory) Get(id int) (*common.Action, error) {
+	jsonAction, ok := storage.actions[id]
+	if !ok {
+		return nil, actionStorage.ErrNotFound
+	}
+	action, err := wrapper.Create(jsonAction)
+	if err != nil {
+		return nil, err
+	}
+	return &action, nil
+}
+
+func (storage *TestStorage_Memory) Exists(id int) (bool, error) {
+	_, ok := storage.actions[id]
+	return ok, nil
+}
+
+func (storage *TestStorage_Memory) Update(id int, action common.Action) error {
+	actionWrapper, err := wrapper.Wrapper(action)
+	if err != nil {
+		return err
+	}
+	jsonAction, err := json.Marshal(actionWrapper)
+	if err != nil {
+		return err
+	}
+	storage.actions[id] = jsonAction
+	return nil
+}
+
+func (storage *TestStorage_Memory) ListSince(since int, limit int) ([]*common.Action, int, []error, error) {
+	// Actions are never removed, so their IDs are consecutive.
+	actions := []*common.Action{}
+	for id := since + 1; id <= len(storage.actions) && len(actions) < limit; id++ {
+		action, err := storage.Get(id)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	next := since + len(actions)
+	if next == len(storage.actions) {
+		next = 0
+	}
+
+	return actions, next, nil, nil
+}
+
+func (storage *TestStorage_Memory) Ping() error {
+	return nil
+}
+
+// testServer starts an HTTP server that acts as the webhook of a chat
+// application. It returns the server and a channel that receives the path of
+// every request made to it.
+func testServer() (*httptest.Server, chan string) {
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, requests
+}
+
+// testActionJSON returns the JSON object of a chat message Action that posts to
+// the given webhook URL.
+func testActionJSON(URL string) string {
+	return `{"type":"chat_message","action":{"name":"Test Action","url":"` + URL + `","message":{"text":"Test message"}}}`
+}
+
+// allowed returns whether the Action with the given ID is allowed to be
+// executed, without changing the state of its circuit.
+func (breakers *circuitBreakers) allowed(actionID int) bool {
+	breakers.Lock()
+	defer breakers.Unlock()
+	current, ok := breakers.circuits[actionID]
+	return !ok || current.state == circuitClosed
+}
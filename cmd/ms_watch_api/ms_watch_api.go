@@ -6,17 +6,40 @@ package main
 
 import (
 	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	// Gin.
 	gin "gopkg.in/gin-gonic/gin.v1"
 
+	// Prometheus.
+	"github.com/prometheus/client_golang/prometheus"
+
 	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
 	sdk "github.com/krystalcode/go-mantis-shrimp/actions/sdk"
 	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	metrics "github.com/krystalcode/go-mantis-shrimp/util/metrics"
+	pool "github.com/krystalcode/go-mantis-shrimp/util/pool"
+	aggregate "github.com/krystalcode/go-mantis-shrimp/watches/aggregate"
 	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
 	config "github.com/krystalcode/go-mantis-shrimp/watches/config"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
 	storage "github.com/krystalcode/go-mantis-shrimp/watches/storage"
 	wrapper "github.com/krystalcode/go-mantis-shrimp/watches/wrapper"
 )
@@ -29,41 +52,272 @@ import (
 // configuration for the Watch API.
 const WatchAPIConfigFile = "/etc/mantis-shrimp/watch_api.config.json"
 
+// ListLimitDefault holds the number of Watches returned by the list endpoint
+// when no limit is given in the request.
+const ListLimitDefault = 20
+
+// ListLimitMax holds the maximum number of Watches that can be requested from
+// the list endpoint in a single request.
+const ListLimitMax = 100
+
+// BulkLimitMax holds the maximum number of Watches that can be created by the
+// bulk endpoint in a single request.
+const BulkLimitMax = 100
+
+// TriggerConcurrencyDefault holds the maximum number of Actions triggered at the
+// same time when no limit is given in the configuration.
+const TriggerConcurrencyDefault = 10
+
+// EvaluationConcurrencyDefault holds the maximum number of Watches evaluated at
+// the same time when no limit is given in the configuration.
+const EvaluationConcurrencyDefault = 10
+
+// ResultHistoryLengthDefault holds the number of the most recent Results kept in
+// the history of each Watch when no length is given in the configuration.
+const ResultHistoryLengthDefault = 100
+
+// MaxStoredBodyBytesDefault holds the maximum number of bytes of the response
+// bodies kept in the history of the Watches' Results when no maximum is given
+// in the configuration.
+const MaxStoredBodyBytesDefault = 4 * 1024
+
 /**
  * Main program entry.
  */
 func main() {
-	// Load configuration.
-	// @I Support providing configuration file for Watch API via cli options
-	// @I Validate Watch API configuration when loading from JSON file
+	// Load configuration, from the file given via the command line or from the
+	// default location. Secrets can be given via environment variables
+	// referenced in the file.
+	configFile := flag.String(
+		"config",
+		"",
+		"Path to the configuration file (default \""+WatchAPIConfigFile+"\")",
+	)
+	// Optionally only check that the service can start, without serving.
+	checkOnly := flag.Bool(
+		"check",
+		false,
+		"Validate the configuration and the connection to the Storage, and exit without serving",
+	)
+	flag.Parse()
+
+	configPath := util.ConfigFilePath(*configFile, WatchAPIConfigFile)
+	if *checkOnly {
+		err := check(configPath, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	var watchAPIConfig config.Config
-	err := util.ReadJSONFile(WatchAPIConfigFile, &watchAPIConfig)
+	err := util.ReadJSONFileExpandEnv(configPath, &watchAPIConfig)
 	if err != nil {
-		panic(err)
+		log.Fatal("failed to read the configuration", "err", err)
+	}
+	err = watchAPIConfig.Validate()
+	if err != nil {
+		log.Fatal("invalid configuration", "err", err)
+	}
+
+	// Log as configured from now on.
+	logger, err := log.New(os.Stderr, watchAPIConfig.Log)
+	if err != nil {
+		log.Fatal("failed to initialize the logger", "err", err)
+	}
+	log.SetDefault(logger.With("service", "watch_api"))
+
+	// Build the Storage engine once so that it is shared by all requests. We
+	// fail early if the Storage cannot be reached.
+	watchStorage, err := storage.Create(watchAPIConfig.Storage)
+	if err != nil {
+		log.Fatal("failed to initialize the Storage engine", "err", err)
+	}
+
+	// Aggregate Watches load the Watches that they aggregate from the Storage.
+	aggregate.SetLoader(watchStorage)
+
+	// Health Check Watches share the configured HTTP transport so that
+	// connections are reused between evaluations. It is configured before any
+	// Watches are created.
+	err = health.ConfigureTransport(watchAPIConfig.HealthCheckTransport)
+	if err != nil {
+		log.Fatal("invalid Health Check transport configuration", "err", err)
 	}
 
 	// Load Watches provided in the config, if we run on ephemeral storage mode.
-	loadEphemeralWatches(&watchAPIConfig)
+	loadEphemeralWatches(&watchAPIConfig, watchStorage)
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// Log every request together with an ID that identifies it, and make a
+	// Logger that includes the ID available to the controllers.
+	router.Use(log.Middleware(log.Default()))
+
+	// Collect metrics for all requests, including the ones that fail
+	// authentication, and make them available to the controllers.
+	watchAPIMetrics := NewWatchAPIMetrics()
+	router.Use(metrics.Middleware(watchAPIMetrics.requests))
+	router.Use(Metrics(watchAPIMetrics))
+
+	// Limit the size of the request bodies so that large payloads cannot exhaust
+	// the memory of the service. The options have already been validated
+	// together with the rest of the configuration.
+	maxRequestBytes, _, _, err := watchAPIConfig.Server.Parse()
+	if err != nil {
+		log.Fatal("invalid server configuration", "err", err)
+	}
+	router.Use(api.MaxRequestBytes(maxRequestBytes))
+
+	// Report whether the storage is available. It is registered before the
+	// authentication middleware so that it can be used by liveness and
+	// readiness probes without a token.
+	router.GET(api.PathHealth, api.Health(watchStorage))
+
+	// Report the build that is running, without requiring a token either.
+	router.GET(api.PathVersion, api.Version)
 
-	router := gin.Default()
+	// Require callers to authenticate, unless no token is configured.
+	router.Use(api.Authentication(watchAPIConfig.AuthToken))
 
 	// Make storage available to the controllers.
-	router.Use(Storage(watchAPIConfig.Storage))
+	router.Use(Storage(watchStorage))
+
+	// Make the configuration available to the controllers.
+	router.Use(Config(&watchAPIConfig))
+
+	// Make available to the controllers the pool that bounds the number of
+	// Actions triggered at the same time. It is shared by all requests.
+	triggerConcurrency := watchAPIConfig.TriggerConcurrency
+	if triggerConcurrency == 0 {
+		triggerConcurrency = TriggerConcurrencyDefault
+	}
+	triggerPool := pool.New(triggerConcurrency)
+	router.Use(TriggerPool(triggerPool))
+
+	// Make available to the controllers the pool that bounds the number of
+	// Watches evaluated at the same time. It is shared by all requests.
+	evaluationConcurrency := watchAPIConfig.EvaluationConcurrency
+	if evaluationConcurrency == 0 {
+		evaluationConcurrency = EvaluationConcurrencyDefault
+	}
+	evaluationPool := pool.New(evaluationConcurrency)
+	router.Use(EvaluationPool(evaluationPool))
+
+	// Keep track of the Watches being evaluated so that Singleton Watches are
+	// not evaluated again while they are still in progress.
+	router.Use(EvaluationGuard(newEvaluationGuard()))
+
+	// Keep the history of the Results of the Watches in the Storage engine.
+	resultStore, ok := watchStorage.(storage.ResultStore)
+	if !ok {
+		log.Fatal("the Storage engine cannot keep the history of the Results of the Watches")
+	}
+	resultHistoryLength := watchAPIConfig.ResultHistoryLength
+	if resultHistoryLength == 0 {
+		resultHistoryLength = ResultHistoryLengthDefault
+	}
+	maxStoredBodyBytes := watchAPIConfig.MaxStoredBodyBytes
+	if maxStoredBodyBytes == 0 {
+		maxStoredBodyBytes = MaxStoredBodyBytesDefault
+	}
+	router.Use(ResultHistory(newResultHistory(resultStore, resultHistoryLength, maxStoredBodyBytes)))
+
+	// Expose the metrics, unless they are exposed by a separate server.
+	if watchAPIConfig.Metrics.Address == "" {
+		router.GET(
+			watchAPIConfig.Metrics.MetricsPath(),
+			gin.WrapH(metrics.Handler(watchAPIMetrics.registry)),
+		)
+	}
+
+	// Limit the rate of the requests that create Watches, shared by all such
+	// endpoints. Triggering Watches is not limited as it is requested by the Cron
+	// component.
+	rateLimit := api.RateLimit(watchAPIConfig.RateLimit)
 
 	// Version 1 of the Watch API.
 	v1 := router.Group("/v1")
 	{
+		// List the stored Watches.
+		v1.GET("/", v1List)
+
 		// Create a new Watch.
-		v1.POST("/", v1Create)
+		v1.POST("/", rateLimit, v1Create)
+
+		// Create multiple Watches at "bulk", and pause or resume triggering
+		// Watches at "pause" and "resume". The router does not allow a static
+		// path where the other endpoints have the ID parameter; the endpoints are
+		// therefore registered with the parameter and dispatched by its value.
+		// Pausing and resuming therefore share the rate limit.
+		v1.POST("/:id", rateLimit, v1Post)
+
+		// Get a Watch via its ID. Whether triggering Watches is paused is
+		// reported at "pause" by the same route.
+		v1.GET("/:id", v1Get)
+
+		// Update a Watch via its ID.
+		v1.PUT("/:id", v1Update)
 
 		// Trigger execution of the Watch via its ID.
-		v1.POST("/:ids/trigger", v1Trigger)
+		v1.POST("/:id/trigger", v1Trigger)
+
+		// Evaluate the Watch against an event posted by an external system.
+		v1.POST("/:id/event", v1Event)
+
+		// Evaluate the Conditions of the Watch against a given Result.
+		v1.POST("/:id/replay", v1Replay)
+
+		// Get the most recent Results of the Watch via its ID.
+		v1.GET("/:id/history", v1History)
+
+		// Get the Actions that the Watch triggers via its ID.
+		v1.GET("/:id/actions", v1Actions)
+	}
+
+	// Serve until we are asked to shut down, and then give the requests, Watch
+	// evaluations and Action triggers in progress the configured grace period to
+	// finish. The evaluations are waited for first since they may trigger
+	// further Actions.
+	ctx, cancel := util.ShutdownContext()
+	defer cancel()
+
+	gracePeriod, err := util.ParseGracePeriod(watchAPIConfig.ShutdownGracePeriod)
+	if err != nil {
+		log.Fatal("invalid shutdown grace period", "err", err)
+	}
+
+	if watchAPIConfig.Metrics.Address != "" {
+		go func() {
+			err := api.Serve(
+				ctx,
+				metrics.Mux(watchAPIConfig.Metrics, watchAPIMetrics.registry),
+				watchAPIConfig.Metrics.Address,
+				api.ServerConfig{},
+				gracePeriod,
+			)
+			if err != nil {
+				log.Fatal("failed to serve the metrics", "err", err)
+			}
+		}()
 	}
 
 	/**
 	 * @I Make the trigger API port configurable
 	 */
-	router.Run(":8888")
+	err = api.Serve(
+		ctx,
+		router,
+		":8888",
+		watchAPIConfig.Server,
+		gracePeriod,
+		evaluationPool.Wait,
+		triggerPool.Wait,
+	)
+	if err != nil {
+		log.Fatal("failed to serve the Watch API", "err", err)
+	}
 }
 
 /**
@@ -74,19 +328,29 @@ func main() {
 // given in the request.
 func v1Create(c *gin.Context) {
 	/**
-	 * @I Implement authentication of the caller
 	 * @I Validate parameters per Watch type
 	 * @I Ensure the caller has the permissions to create Watches
-	 * @I Log errors and send a 500 response instead of panicking
-	 * @I Implement creating and triggering a Watch in a single request
 	 */
 
+	// The Watch can optionally be triggered right after it is created.
+	trigger, err := strconv.ParseBool(c.DefaultQuery("trigger", "false"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
 	// The parameters are provided as a JSON object in the request. Bind it to an
 	// object of the corresponding type.
 	var wrapper wrapper.WatchWrapper
-	err := c.BindJSON(&wrapper)
+	err = api.BindJSON(c, &wrapper)
 	if err != nil {
-		panic(err)
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
 	}
 	// @I Return 400 Bad Request if we are given no Watch type in a Create request
 	if wrapper.Watch == nil {
@@ -103,102 +367,218 @@ func v1Create(c *gin.Context) {
 	watch := wrapper.Watch
 
 	// Store the Watch.
-	storage := c.MustGet("storage").(storage.Storage)
-	id, err := storage.Create(&watch)
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	id, err := watchStorage.Create(&watch)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	watchAPIMetrics := c.MustGet("metrics").(*WatchAPIMetrics)
+	watchAPIMetrics.watchesCreated.Inc()
+
+	if !trigger {
+		// All good.
+		c.JSON(
+			http.StatusOK,
+			gin.H{
+				"status": http.StatusOK,
+				"id":     *id,
+			},
+		)
+		return
+	}
+
+	// The Watch is not triggered while triggering is paused.
+	paused, err := watchStorage.Paused()
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if paused {
+		c.JSON(
+			http.StatusOK,
+			gin.H{
+				"status": http.StatusOK,
+				"id":     *id,
+				"paused": true,
+			},
+		)
+		return
+	}
+
+	// Load the Watch from storage so that it is initialized the same way as
+	// when it is triggered via the trigger endpoint e.g. with its dependencies
+	// injected.
+	createdWatch, err := watchStorage.Get(*id)
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		err = fmt.Errorf("the Watch with ID \"%d\" was not found right after being created", *id)
+	}
 	if err != nil {
-		panic(err)
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
 	}
 
+	// Evaluate the Watch and trigger its Actions, if any. We wait for the
+	// evaluation so that we can respond with the IDs of the triggered Actions,
+	// but not for the Actions to be executed.
+	watchAPIMetrics.triggersRequested.Inc()
+	actionsIDs, actionContext := evaluate(c.Request.Context(), *createdWatch, watchAPIMetrics)
+	c.MustGet("result_history").(*resultHistory).record(*id, actionsIDs, actionContext, log.FromContext(c))
+	triggerActions(
+		newActionsPlan(*createdWatch, actionsIDs),
+		actionContext,
+		actionSDKConfig(c),
+		c.MustGet("trigger_pool").(*pool.Pool),
+		watchAPIMetrics,
+		log.FromContext(c),
+	)
+
 	// All good.
 	c.JSON(
 		http.StatusOK,
 		gin.H{
-			"status": http.StatusOK,
-			"id":     *id,
+			"status":      http.StatusOK,
+			"id":          *id,
+			"actions_ids": actionsIDs,
 		},
 	)
 }
 
-// v1Trigger provides an endpoint that triggers execution of the Action given in
-// the request by its ID, by making a call to the Action API.
-func v1Trigger(c *gin.Context) {
-	/**
-	 * @I Implement authentication of the caller
-	 * @I Does the id need any escaping?
-	 * @I Ensure the caller has the permissions to trigger evaluation of a Watch
-	 * @I Investigate whether we need our own response status codes
-	 */
-
-	// The "ids" parameter is required. We allow for multiple comma-separated
-	// string IDs, so we need to convert them to an array of integer IDs.
-	// We want to make sure that the caller makes the request they want to without
-	// mistakes, so we do not trigger any Watches if there is any error, even in
-	// one of the IDs.
-	// @I Refactor converting a comma-separated list of string IDs to an array of
-	//    integer IDs into a utility function
-	sIDs := c.Param("ids")
-	aIDsInt, err := util.StringToIntegers(sIDs, ",")
-	if err != nil {
+// v1Post dispatches the requests to the endpoints that are registered with the
+// ID parameter for the POST method, by the value of the parameter.
+func v1Post(c *gin.Context) {
+	switch c.Param("id") {
+	case "bulk":
+		v1Bulk(c)
+	case "pause":
+		v1SetPaused(c, true)
+	case "resume":
+		v1SetPaused(c, false)
+	default:
 		c.JSON(
 			http.StatusNotFound,
 			gin.H{
 				"status": http.StatusNotFound,
 			},
 		)
+	}
+}
+
+// v1Bulk provides an endpoint that creates multiple Watches based on the JSON
+// array of objects given in the request, each in the same structure that is
+// expected by the create endpoint. Every Watch is created independently; the
+// response contains the ID of each created Watch or the reason it failed, keyed
+// by its index in the request. It responds with status 207 when any of the
+// Watches fails.
+func v1Bulk(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to create Watches
+	 */
+
+	// Each element is decoded separately so that a malformed element fails
+	// only the corresponding Watch.
+	var elements []json.RawMessage
+	err := api.BindJSON(c, &elements)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+	if len(elements) > BulkLimitMax {
+		err = fmt.Errorf("%d Watches were given while up to %d can be created at once", len(elements), BulkLimitMax)
+		api.RespondError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	// Get the Watches with the requested IDs from storage.
-	storage := c.MustGet("storage").(storage.Storage)
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	watchAPIMetrics := c.MustGet("metrics").(*WatchAPIMetrics)
+	logger := log.FromContext(c)
 
-	var watches []*common.Watch
-	for iID := range aIDsInt {
-		watch, err := storage.Get(iID)
+	status := http.StatusOK
+	results := make([]bulkResult, len(elements))
+	for index, element := range elements {
+		results[index].Index = index
+
+		var wrapper wrapper.WatchWrapper
+		err := json.Unmarshal(element, &wrapper)
+		if err == nil && wrapper.Watch == nil {
+			err = fmt.Errorf("no Watch was given")
+		}
 		if err != nil {
-			// Return a Not Found response if there is no Watch with such ID.
-			if watch == nil {
-				c.JSON(
-					http.StatusNotFound,
-					gin.H{
-						"status": http.StatusNotFound,
-					},
-				)
-			}
-			return
+			status = http.StatusMultiStatus
+			results[index].Error = err.Error()
+			continue
 		}
 
-		// We could trigger the Watch at this point, however we prefer to check
-		// that all Watches exist first.
-		watches = append(watches, watch)
+		// Storage errors are not exposed to the caller, same as when creating
+		// individual Watches.
+		watch := wrapper.Watch
+		id, err := watchStorage.Create(&watch)
+		if err != nil {
+			logger.Error("failed to create the Watch", "index", index, "err", err)
+			status = http.StatusMultiStatus
+			results[index].Error = "the Watch could not be stored"
+			continue
+		}
+		watchAPIMetrics.watchesCreated.Inc()
+		results[index].ID = id
 	}
 
-	// Trigger execution of the Watches.
-	// We only need to acknowledge that the Watches were triggered; we don't have to
-	// for the execution to finish as this can take time.
-	watchAPIConfig := c.MustGet("config").(config.Config)
-	sdkConfig := sdk.Config{
-		watchAPIConfig.ActionAPI.BaseURL,
-		watchAPIConfig.ActionAPI.Version,
+	c.JSON(
+		status,
+		gin.H{
+			"status":  status,
+			"results": results,
+		},
+	)
+}
+
+// v1Get provides an endpoint that returns the Watch with the ID given in the
+// request. The Watch is returned together with its type, in the same structure
+// that is expected by the create endpoint.
+func v1Get(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to view Watches
+	 */
+
+	if c.Param("id") == "pause" {
+		v1Paused(c)
+		return
 	}
-	for _, pointer := range watches {
-		go func() {
-			watch := *pointer
-			actionsIds := watch.Do()
-			if len(actionsIds) == 0 {
-				return
-			}
 
-			// @I Trigger all Watch Actions in one request
-			for _, actionID := range actionsIds {
-				go func() {
-					err := sdk.TriggerByID(actionID, sdkConfig)
-					if err != nil {
-						// @I Investigate log management strategy for all services
-						fmt.Println(err)
-					}
-				}()
-			}
-		}()
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	watch, err := watchStorage.Get(id)
+
+	// Return a Not Found response if there is no Watch with such ID.
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Wrap the Watch so that its type is included in the response.
+	watchWrapper, err := wrapper.Wrapper(*watch)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
 	}
 
 	// All good.
@@ -206,60 +586,1430 @@ func v1Trigger(c *gin.Context) {
 		http.StatusOK,
 		gin.H{
 			"status": http.StatusOK,
+			"id":     id,
+			"type":   watchWrapper.Type,
+			"watch":  watchWrapper.Watch,
 		},
 	)
 }
 
-/**
- * Middleware.
- */
+// v1Update provides an endpoint that updates the Watch with the ID given in the
+// request, based on the JSON object given in the request in the same structure
+// that is expected by the create endpoint. The type of the Watch cannot be
+// changed. The updated Watch is returned in the same structure that is returned
+// by the get endpoint.
+func v1Update(c *gin.Context) {
+	/**
+	 * @I Validate parameters per Watch type
+	 * @I Ensure the caller has the permissions to update Watches
+	 */
 
-// Storage is a Gin middleware that makes available the Storage engine to the
-// endpoint controllers.
-func Storage(config map[string]interface{}) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		storage, err := storage.Create(config)
-		if err != nil {
-			panic(err)
-		}
-		c.Set("storage", storage)
-		c.Next()
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
 	}
-}
 
-// Config is a Gin middleware that makes available the Watch API configuration
-// to the endpoint controllers.
-func Config(watchAPIConfig *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Set("config", *watchAPIConfig)
-		c.Next()
+	// The parameters are provided as a JSON object in the request. Bind it to an
+	// object of the corresponding type.
+	var watchWrapper wrapper.WatchWrapper
+	err = api.BindJSON(c, &watchWrapper)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+	if watchWrapper.Watch == nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
 	}
-}
 
-/**
- * Functions/types for internal use.
- */
+	// Return a Not Found response if there is no Watch with such ID.
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	existingWatch, err := watchStorage.Get(id)
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
 
-// loadEphmeralWatches checks if the storage engine is configured to run in
-// "ephemeral" mode, and if so, it loads into it any Watches contained in the
-// configuration file.
-func loadEphemeralWatches(watchAPIConfig *config.Config) {
-	// @I Load init Watches directly in Redis via a script so that services
-	//    don't have to be restarted together
-	mode, ok := watchAPIConfig.Storage["mode"]
-	if !ok || mode.(string) != "ephemeral" || watchAPIConfig.WatchWrappers == nil {
+	// Changing the type of a Watch would leave any Schedules or other references
+	// to it evaluating a different kind of check; a new Watch should be created
+	// instead.
+	existingWrapper, err := wrapper.Wrapper(*existingWatch)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if watchWrapper.Type != existingWrapper.Type {
+		err = fmt.Errorf(
+			"the type of the Watch with ID \"%d\" cannot be changed from \"%s\" to \"%s\"",
+			id,
+			existingWrapper.Type,
+			watchWrapper.Type,
+		)
+		api.RespondError(c, http.StatusConflict, err)
 		return
 	}
 
-	storage, err := storage.Create(watchAPIConfig.Storage)
+	// The creation time is maintained by the system; keep the existing one
+	// unless given.
+	watch := watchWrapper.Watch
+	base, err := common.Base(watch)
 	if err != nil {
-		panic(err)
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if base.CreatedAt == nil {
+		existingBase, err := common.Base(*existingWatch)
+		if err != nil {
+			api.RespondError(c, http.StatusInternalServerError, err)
+			return
+		}
+		base.CreatedAt = existingBase.CreatedAt
+		err = common.SetBase(&watch, *base)
+		if err != nil {
+			api.RespondError(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	err = watchStorage.Update(id, &watch)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status": http.StatusOK,
+			"id":     id,
+			"type":   watchWrapper.Type,
+			"watch":  watch,
+		},
+	)
+}
+
+// v1List provides an endpoint that lists the stored Watches. The results are
+// paginated via the "since" and "limit" query parameters, where "since" is the
+// cursor returned as "next" by the previous page; "next" is null after the last
+// page. Pagination via the "offset" query parameter is supported as well, but it
+// gets slower the further into the Watches the page is.
+func v1List(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to list Watches
+	 */
+
+	_, offsetGiven := c.GetQuery("offset")
+	_, sinceGiven := c.GetQuery("since")
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 || (offsetGiven && sinceGiven) {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	since, err := strconv.Atoi(c.DefaultQuery("since", "0"))
+	if err != nil || since < 0 {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(ListLimitDefault)))
+	if err != nil || limit < 1 || limit > ListLimitMax {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// Get the Watches from storage. Watches that could not be loaded are
+	// reported in the response instead of failing the whole request.
+	storage := c.MustGet("storage").(storage.Storage)
+	var watches []*common.Watch
+	var next *int
+	var listErrors []error
+	if offsetGiven {
+		watches, listErrors, err = storage.List(offset, limit)
+	} else {
+		var nextID int
+		watches, nextID, listErrors, err = storage.ListSince(since, limit)
+		if nextID != 0 {
+			next = &nextID
+		}
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Wrap the Watches so that their type is included in the response.
+	wrappers := make([]*wrapper.WatchWrapper, 0, len(watches))
+	for _, watch := range watches {
+		watchWrapper, err := wrapper.Wrapper(*watch)
+		if err != nil {
+			listErrors = append(listErrors, err)
+			continue
+		}
+		wrappers = append(wrappers, watchWrapper)
+	}
+
+	sErrors := make([]string, len(listErrors))
+	for i, listError := range listErrors {
+		sErrors[i] = listError.Error()
+	}
+
+	// All good. The cursor is not included when paginating by offset.
+	response := gin.H{
+		"status":  http.StatusOK,
+		"watches": wrappers,
+		"errors":  sErrors,
+	}
+	if !offsetGiven {
+		response["next"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// v1Trigger provides an endpoint that triggers execution of the Action given in
+// the request by its ID, by making a call to the Action API.
+// The Watches are evaluated concurrently, bounded by the evaluation pool. By
+// default the endpoint responds as soon as the evaluations are submitted to the
+// pool; when the "wait" query parameter is true, it waits for all evaluations
+// to finish and it responds with the outcome of each of them, in the order of
+// the given IDs. The Actions are triggered without waiting for them in both
+// cases.
+// The request body can optionally hold a Result, as a JSON object in the
+// "result" field, that the Watches are evaluated against instead of preparing
+// one themselves e.g. without making a request to the URL of a Health Check
+// Watch. All Watches must support being evaluated against a given Result.
+func v1Trigger(c *gin.Context) {
+	/**
+	 * @I Does the id need any escaping?
+	 * @I Ensure the caller has the permissions to trigger evaluation of a Watch
+	 * @I Investigate whether we need our own response status codes
+	 */
+
+	// The "id" parameter is required. We allow for multiple comma-separated
+	// string IDs, so we need to convert them to an array of integer IDs.
+	// We want to make sure that the caller makes the request they want to without
+	// mistakes, so we do not trigger any Watches if there is any error, even in
+	// one of the IDs.
+	sIDs := c.Param("id")
+	// A malformed ID is a mistake of the caller rather than a missing resource,
+	// so we respond with a Bad Request.
+	aIDsInt, err := util.StringToIntSlice(sIDs, ",")
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// The caller can optionally wait for the evaluations to finish.
+	wait, err := strconv.ParseBool(c.DefaultQuery("wait", "false"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// The caller can optionally give the Result that the Watches are evaluated
+	// against. The request body is not required otherwise.
+	jsonResult, err := triggerResultJSON(c)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+
+	// Nothing is evaluated or triggered while triggering is paused e.g. during
+	// maintenance. That is not an error of the caller, such as the Cron
+	// component, so we still respond with a 200 status.
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	paused, err := watchStorage.Paused()
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if paused {
+		c.JSON(
+			http.StatusOK,
+			gin.H{
+				"status": http.StatusOK,
+				"paused": true,
+			},
+		)
+		return
+	}
+
+	// Get the Watches with the requested IDs from storage.
+	var watches []*common.Watch
+	var watchesIDs []int
+	for _, iID := range aIDsInt {
+		watch, err := watchStorage.Get(iID)
+
+		// Return a Not Found response if there is no Watch with such ID.
+		if errors.Is(err, errorsUtil.ErrNotFound) {
+			c.JSON(
+				http.StatusNotFound,
+				gin.H{
+					"status": http.StatusNotFound,
+				},
+			)
+			return
+		}
+		if err != nil {
+			api.RespondError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		// Not all Watch types can be evaluated against a given Result.
+		if jsonResult != nil {
+			resultWatch, ok := (*watch).(common.ResultWatch)
+			if !ok {
+				err = fmt.Errorf("the Watch with ID \"%d\" cannot be evaluated against a given Result", iID)
+				api.RespondError(c, http.StatusBadRequest, err)
+				return
+			}
+			withResult, err := resultWatch.WithResult(jsonResult)
+			if err != nil {
+				api.RespondError(c, http.StatusBadRequest, err)
+				return
+			}
+			watch = &withResult
+		}
+
+		// We could trigger the Watch at this point, however we prefer to check
+		// that all Watches exist first.
+		watches = append(watches, watch)
+		watchesIDs = append(watchesIDs, iID)
+	}
+
+	// Trigger execution of the Watches.
+	// Unless asked to wait, we only need to acknowledge that the Watches were
+	// triggered; we don't have to wait for the execution to finish as this can
+	// take time.
+	// The evaluations are submitted to the evaluation pool so that triggering
+	// many Watches together does not make an unbounded number of requests at
+	// the same time; submitting blocks while the pool is full, and the pool
+	// also lets them finish before shutting down.
+	// Each evaluation is given its own Watch; the loop variable is reused across
+	// iterations and would otherwise be shared by all of them.
+	sdkConfig := actionSDKConfig(c)
+	evaluationPool := c.MustGet("evaluation_pool").(*pool.Pool)
+	triggerPool := c.MustGet("trigger_pool").(*pool.Pool)
+	watchAPIMetrics := c.MustGet("metrics").(*WatchAPIMetrics)
+	guard := c.MustGet("evaluation_guard").(*evaluationGuard)
+	history := c.MustGet("result_history").(*resultHistory)
+	logger := log.FromContext(c)
+	// The evaluations are cancelled if the request is cancelled while we wait
+	// for them. Otherwise they outlive the request, so they are given a context
+	// that carries the request's values but that is not cancelled with it.
+	ctx := c.Request.Context()
+	if !wait {
+		ctx = context.WithoutCancel(ctx)
+	}
+	// Actions shared by more than one of the Watches are triggered only once,
+	// by the Watch whose evaluation finishes first.
+	claims := newActionClaims()
+	// The outcomes of the evaluations are collected by their position in the
+	// request. The channel is buffered so that evaluations never block on it,
+	// whether we wait for them or not.
+	collector := make(chan triggerOutcome, len(watches))
+	results := make([]triggerResult, len(watches))
+	pending := 0
+	watchAPIMetrics.triggersRequested.Add(float64(len(watches)))
+	skipped := 0
+	for index, pointer := range watches {
+		index := index
+		watch := *pointer
+		watchID := watchesIDs[index]
+		results[index] = triggerResult{ID: watchID, ActionsIDs: []int{}}
+
+		// Singleton Watches are skipped while a previous evaluation is still in
+		// progress.
+		singleton := false
+		if base, err := common.Base(watch); err == nil {
+			singleton = base.Singleton
+		}
+		if singleton && !guard.acquire(watchID) {
+			skipped++
+			watchAPIMetrics.triggersSkipped.Inc()
+			results[index].Error = "the Watch is already being evaluated"
+			continue
+		}
+
+		pending++
+		evaluationPool.Submit(func() {
+			result := triggerResult{ID: watchID, ActionsIDs: []int{}}
+			defer func() {
+				collector <- triggerOutcome{index: index, result: result}
+			}()
+			actionsIDs, actionContext, err := safeEvaluate(ctx, watch, watchAPIMetrics)
+			if singleton {
+				guard.release(watchID)
+			}
+			if err != nil {
+				logger.Error("failed to evaluate the Watch", "watch_id", watchID, "err", err)
+				result.Error = err.Error()
+				return
+			}
+			if len(actionsIDs) != 0 {
+				result.ActionsIDs = actionsIDs
+			}
+
+			history.record(watchID, actionsIDs, actionContext, logger)
+			actionsIDs = claims.claim(actionsIDs)
+			if len(actionsIDs) == 0 {
+				return
+			}
+
+			triggerActions(
+				newActionsPlan(watch, actionsIDs),
+				actionContext,
+				sdkConfig,
+				triggerPool,
+				watchAPIMetrics,
+				logger,
+			)
+		})
+	}
+
+	// All good. The number of skipped Watches is only included when there are
+	// any.
+	response := gin.H{
+		"status": http.StatusOK,
+	}
+	if skipped > 0 {
+		response["skipped"] = skipped
+	}
+	if wait {
+		for ; pending > 0; pending-- {
+			outcome := <-collector
+			results[outcome.index] = outcome.result
+		}
+		response["results"] = results
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// v1Paused provides an endpoint that responds with whether triggering Watches
+// is paused.
+func v1Paused(c *gin.Context) {
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	paused, err := watchStorage.Paused()
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status": http.StatusOK,
+			"paused": paused,
+		},
+	)
+}
+
+// v1SetPaused provides the endpoints that pause and resume triggering Watches,
+// depending on the given value. While paused, requests to trigger Watches are
+// acknowledged without evaluating the Watches or triggering any Actions. The
+// setting is kept in the Storage so that it applies to all instances of the
+// Watch API sharing the same Storage. Evaluations already in progress are not
+// affected.
+func v1SetPaused(c *gin.Context, paused bool) {
+	/**
+	 * @I Ensure the caller has the permissions to pause triggering Watches
+	 */
+
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	err := watchStorage.SetPaused(paused)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.FromContext(c).Info("set whether triggering Watches is paused", "paused", paused)
+
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status": http.StatusOK,
+			"paused": paused,
+		},
+	)
+}
+
+// v1Event provides an endpoint that evaluates the Watch with the ID given in the
+// request against the event given as a JSON document in the request body, and
+// triggers its Actions, if any. It is meant to be called by external systems
+// that push events to us instead of us polling them, such as for Inbound Event
+// Watches; other Watch types that can be evaluated against a given Result are
+// supported as well, with the body holding the Result.
+// The evaluation is waited for so that we can respond with the IDs of the
+// triggered Actions, but not the Actions themselves.
+func v1Event(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to push events to the Watch
+	 * @I Support verifying the signatures of events sent by common providers
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	jsonEvent, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	watch, err := watchStorage.Get(id)
+
+	// Return a Not Found response if there is no Watch with such ID.
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Not all Watch types can be evaluated against a given event.
+	resultWatch, ok := (*watch).(common.ResultWatch)
+	if !ok {
+		err = fmt.Errorf("the Watch with ID \"%d\" cannot be evaluated against a given event", id)
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+	eventWatch, err := resultWatch.WithResult(jsonEvent)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Events are acknowledged but not evaluated while triggering is paused, the
+	// same way as when triggering Watches.
+	paused, err := watchStorage.Paused()
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if paused {
+		c.JSON(
+			http.StatusOK,
+			gin.H{
+				"status": http.StatusOK,
+				"paused": true,
+			},
+		)
+		return
+	}
+
+	// Singleton Watches are not evaluated while a previous evaluation is still
+	// in progress.
+	singleton := false
+	if base, err := common.Base(eventWatch); err == nil {
+		singleton = base.Singleton
+	}
+	guard := c.MustGet("evaluation_guard").(*evaluationGuard)
+	if singleton && !guard.acquire(id) {
+		api.RespondError(c, http.StatusConflict, fmt.Errorf("the Watch is already being evaluated"))
+		return
+	}
+
+	watchAPIMetrics := c.MustGet("metrics").(*WatchAPIMetrics)
+	watchAPIMetrics.triggersRequested.Inc()
+	actionsIDs, actionContext, err := safeEvaluate(c.Request.Context(), eventWatch, watchAPIMetrics)
+	if singleton {
+		guard.release(id)
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if actionsIDs == nil {
+		actionsIDs = []int{}
+	}
+
+	logger := log.FromContext(c)
+	c.MustGet("result_history").(*resultHistory).record(id, actionsIDs, actionContext, logger)
+	triggerActions(
+		newActionsPlan(eventWatch, actionsIDs),
+		actionContext,
+		actionSDKConfig(c),
+		c.MustGet("trigger_pool").(*pool.Pool),
+		watchAPIMetrics,
+		logger,
+	)
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":      http.StatusOK,
+			"id":          id,
+			"actions_ids": actionsIDs,
+		},
+	)
+}
+
+// v1Replay provides an endpoint that evaluates the Conditions of the Watch with
+// the ID given in the request against the Result given as a JSON object in the
+// request body. No data is prepared by the Watch and no Actions are triggered;
+// it responds with whether each Condition is met.
+func v1Replay(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to view Watches
+	 * @I Support replaying Results by their ID once Results are persisted
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	watch, err := watchStorage.Get(id)
+
+	// Return a Not Found response if there is no Watch with such ID.
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Not all Watch types can evaluate their Conditions against a given Result.
+	replayableWatch, ok := (*watch).(common.ReplayableWatch)
+	if !ok {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	jsonResult, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+
+	conditions, err := replayableWatch.Replay(jsonResult)
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// The Watch's Actions would be triggered only if all Conditions are met.
+	ok = true
+	for _, condition := range conditions {
+		if !condition {
+			ok = false
+			break
+		}
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":     http.StatusOK,
+			"conditions": conditions,
+			"ok":         ok,
+		},
+	)
+}
+
+// v1History provides an endpoint that returns the most recent Results of the
+// Watch with the ID given in the request, starting from the most recent one.
+// The number of Results can be given in the "limit" query parameter.
+func v1History(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to view Watches
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(ListLimitDefault)))
+	if err != nil || limit < 1 || limit > ListLimitMax {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// Return a Not Found response if there is no Watch with such ID.
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	exists, err := watchStorage.Exists(id)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+
+	history := c.MustGet("result_history").(*resultHistory)
+	results, err := history.store.Results(id, limit)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":  http.StatusOK,
+			"id":      id,
+			"results": results,
+		},
+	)
+}
+
+// v1Actions provides an endpoint that returns the Actions triggered by the
+// Watch with the ID given in the request. The Actions are fetched from the
+// Action API and they are returned together with their IDs and types. Actions
+// that cannot be fetched, such as when they have been deleted, do not fail the
+// request; they are listed as unresolved instead.
+func v1Actions(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to view Watches and Actions
+	 * @I Include the Actions triggered on warnings in the response
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	watchStorage := c.MustGet("storage").(storage.Storage)
+	watch, err := watchStorage.Get(id)
+
+	// Return a Not Found response if there is no Watch with such ID.
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	base, err := common.Base(*watch)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger := log.FromContext(c)
+	jsonActions, errs := getActions(base.ActionsIDs, actionSDKConfig(c))
+	resolved := []resolvedAction{}
+	unresolved := []unresolvedAction{}
+	for index, actionID := range base.ActionsIDs {
+		action := resolvedAction{ID: actionID}
+		err := errs[index]
+		if err == nil {
+			err = json.Unmarshal(jsonActions[index], &action)
+		}
+		if err != nil {
+			message := "the Action could not be fetched"
+			if errors.Is(err, errorsUtil.ErrNotFound) {
+				message = "the Action was not found"
+			} else {
+				logger.Error("failed to get the Action of the Watch", "watch_id", id, "action_id", actionID, "err", err)
+			}
+			unresolved = append(unresolved, unresolvedAction{ID: actionID, Error: message})
+			continue
+		}
+
+		resolved = append(resolved, action)
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":     http.StatusOK,
+			"id":         id,
+			"actions":    resolved,
+			"unresolved": unresolved,
+		},
+	)
+}
+
+/**
+ * Middleware.
+ */
+
+// Storage is a Gin middleware that makes available the given Storage engine to
+// the endpoint controllers.
+func Storage(watchStorage storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("storage", watchStorage)
+		c.Next()
+	}
+}
+
+// Config is a Gin middleware that makes available the Watch API configuration
+// to the endpoint controllers.
+func Config(watchAPIConfig *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("config", *watchAPIConfig)
+		c.Next()
+	}
+}
+
+// TriggerPool is a Gin middleware that makes available the given pool, used for
+// triggering Actions, to the endpoint controllers.
+func TriggerPool(triggerPool *pool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("trigger_pool", triggerPool)
+		c.Next()
+	}
+}
+
+// EvaluationGuard is a Gin middleware that makes available the given guard,
+// which tracks the Singleton Watches being evaluated, to the endpoint
+// controllers.
+func EvaluationGuard(guard *evaluationGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("evaluation_guard", guard)
+		c.Next()
+	}
+}
+
+// EvaluationPool is a Gin middleware that makes available the given pool, used
+// for evaluating Watches, to the endpoint controllers.
+func EvaluationPool(evaluationPool *pool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("evaluation_pool", evaluationPool)
+		c.Next()
+	}
+}
+
+// ResultHistory is a Gin middleware that makes available the given history,
+// used for keeping the Results of the Watches, to the endpoint controllers.
+func ResultHistory(history *resultHistory) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("result_history", history)
+		c.Next()
+	}
+}
+
+// Metrics is a Gin middleware that makes available the given metrics to the
+// endpoint controllers.
+func Metrics(watchAPIMetrics *WatchAPIMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("metrics", watchAPIMetrics)
+		c.Next()
+	}
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// check loads and validates the configuration from the given file, builds the
+// Storage engine and checks that it is available, writing the outcome of each
+// step to the given writer. It returns an error if any of the steps fails.
+func check(configPath string, out io.Writer) error {
+	var watchAPIConfig config.Config
+	var watchStorage storage.Storage
+
+	return api.Check(
+		out,
+		[]api.CheckStep{
+			{
+				Name: "configuration",
+				Run: func() error {
+					err := util.ReadJSONFileExpandEnv(configPath, &watchAPIConfig)
+					if err != nil {
+						return err
+					}
+					return watchAPIConfig.Validate()
+				},
+			},
+			{
+				Name: "storage",
+				Run: func() error {
+					var err error
+					watchStorage, err = storage.Create(watchAPIConfig.Storage)
+					return err
+				},
+			},
+			{
+				Name: "storage ping",
+				Run: func() error {
+					return watchStorage.Ping()
+				},
+			},
+		},
+	)
+}
+
+// bulkResult holds the outcome of creating one of the Watches given to the bulk
+// endpoint, that is either the ID of the created Watch or the error that
+// prevented it from being created.
+type bulkResult struct {
+	Index int    `json:"index"`
+	ID    *int   `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// triggerResult holds the outcome of evaluating one of the Watches given to the
+// trigger endpoint, that is the IDs of the Actions to be triggered or the error
+// that prevented the Watch from being evaluated.
+type triggerResult struct {
+	ID         int    `json:"id"`
+	ActionsIDs []int  `json:"actions_ids"`
+	Error      string `json:"error,omitempty"`
+}
+
+// resolvedAction holds an Action returned by the endpoint that lists the
+// Actions of a Watch, together with its ID and type.
+type resolvedAction struct {
+	ID     int             `json:"id"`
+	Type   string          `json:"type"`
+	Action json.RawMessage `json:"action"`
+}
+
+// unresolvedAction holds the ID of an Action of a Watch that could not be
+// fetched from the Action API, together with the reason.
+type unresolvedAction struct {
+	ID    int    `json:"id"`
+	Error string `json:"error"`
+}
+
+// triggerOutcome holds the result of an evaluation together with the position
+// of the Watch in the request, as collected by the trigger endpoint.
+type triggerOutcome struct {
+	index  int
+	result triggerResult
+}
+
+// triggerResultJSON returns the JSON-encoded Result given in the "result" field
+// of the body of the given trigger request, or nil if the body is empty or it
+// does not give a Result.
+func triggerResultJSON(c *gin.Context) ([]byte, error) {
+	jsonBody, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(jsonBody)) == 0 {
+		return nil, nil
+	}
+
+	var body struct {
+		Result *json.RawMessage `json:"result"`
+	}
+	err = json.Unmarshal(jsonBody, &body)
+	if err != nil {
+		return nil, err
+	}
+	if body.Result == nil {
+		return nil, nil
+	}
+
+	return *body.Result, nil
+}
+
+// triggerAction makes the call to the Action API that triggers the Action with
+// the given ID. It is defined as a variable so that it can be replaced in tests.
+var triggerAction = sdk.TriggerByID
+
+// getActions makes the calls to the Action API that get the Actions with the
+// given IDs. It is defined as a variable so that it can be replaced in tests.
+var getActions = sdk.GetMulti
+
+// actionSDKConfig returns the configuration required by the Action API SDK,
+// based on the Watch API configuration made available to the controllers.
+func actionSDKConfig(c *gin.Context) sdk.Config {
+	watchAPIConfig := c.MustGet("config").(config.Config)
+	return sdk.Config{
+		BaseURL:   watchAPIConfig.ActionAPI.BaseURL,
+		Version:   watchAPIConfig.ActionAPI.Version,
+		AuthToken: watchAPIConfig.ActionAPI.AuthToken,
+		UserAgent: util.UserAgent("watch-api"),
+	}
+}
+
+// triggerActions triggers the Actions given in the plan by making calls to the
+// Action API, passing on the given context to them. The Actions are triggered
+// in groups of decreasing priority; each group is triggered only after the calls
+// triggering the previous group have returned. The Action API executes the
+// Actions asynchronously, so the Actions of a group may not have finished by
+// then; only the order that they are triggered in is guaranteed. The calls are
+// queued in the given pool so that a Watch with many Actions, or many Watches
+// triggered together, do not open an unbounded number of connections. The
+// function does not wait for the calls to finish, but it blocks while the pool
+// is full; failed calls are logged using the given Logger.
+//
+// Failed calls do not prevent the rest of the Actions from being triggered,
+// unless the plan stops on failures. The Actions are then triggered one after
+// the other, and the Actions following one that could not be triggered are not
+// triggered at all.
+func triggerActions(
+	plan actionsPlan,
+	actionContext actions.ActionContext,
+	sdkConfig sdk.Config,
+	triggerPool *pool.Pool,
+	watchAPIMetrics *WatchAPIMetrics,
+	logger *log.Logger,
+) {
+	trigger := func(actionID int) error {
+		err := triggerAction(actionID, actionContext, sdkConfig)
+		if err != nil {
+			watchAPIMetrics.actionTriggerFailures.Inc()
+			logger.Error("failed to trigger the Action", "action_id", actionID, "err", err)
+			return err
+		}
+		watchAPIMetrics.actionsTriggered.Inc()
+		return nil
+	}
+
+	// @I Trigger all Watch Actions in one request
+	if len(plan.prioritizedActionsIDs) == 0 {
+		return
+	}
+	if len(plan.prioritizedActionsIDs) == 1 && !plan.stopOnFailure {
+		for _, actionID := range plan.prioritizedActionsIDs[0] {
+			actionID := actionID
+			triggerPool.Submit(func() { trigger(actionID) })
+		}
+		return
+	}
+
+	// The groups are triggered one after the other in a goroutine tracked by
+	// the pool, so that we do not block the caller and so that shutting down
+	// waits for all groups. It does not occupy a slot in the pool itself, which
+	// would otherwise be unavailable to the Actions that it waits for.
+	if !plan.stopOnFailure {
+		triggerPool.Go(func() {
+			for _, actionsIDs := range plan.prioritizedActionsIDs {
+				var waitGroup sync.WaitGroup
+				waitGroup.Add(len(actionsIDs))
+				for _, actionID := range actionsIDs {
+					actionID := actionID
+					triggerPool.Submit(func() {
+						defer waitGroup.Done()
+						trigger(actionID)
+					})
+				}
+				waitGroup.Wait()
+			}
+		})
+		return
+	}
+
+	triggerPool.Go(func() {
+		var actionsIDs []int
+		for _, group := range plan.prioritizedActionsIDs {
+			actionsIDs = append(actionsIDs, group...)
+		}
+
+		for index, actionID := range actionsIDs {
+			actionID := actionID
+			done := make(chan error, 1)
+			triggerPool.Submit(func() { done <- trigger(actionID) })
+			if err := <-done; err != nil {
+				skipped := actionsIDs[index+1:]
+				if len(skipped) != 0 {
+					logger.Warn(
+						"stopped triggering the Actions after an Action that could not be triggered",
+						"action_id", actionID,
+						"skipped_actions_ids", skipped,
+					)
+				}
+				return
+			}
+		}
+	})
+}
+
+// actionsPlan describes how the Actions triggered by a Watch should be
+// triggered.
+type actionsPlan struct {
+	// The IDs of the Actions grouped by their priority, in order of decreasing
+	// priority.
+	prioritizedActionsIDs [][]int
+	// Whether the Actions should be triggered one after the other, stopping at
+	// the first Action that could not be triggered.
+	stopOnFailure bool
+}
+
+// newActionsPlan creates the plan for triggering the Actions with the given IDs
+// as a result of the given Watch, as defined by the Watch. All IDs are
+// triggered together for Watch types that do not embed a WatchBase.
+func newActionsPlan(watch common.Watch, actionsIDs []int) actionsPlan {
+	base, err := common.Base(watch)
+	if err != nil {
+		return actionsPlan{prioritizedActionsIDs: [][]int{actionsIDs}}
+	}
+
+	return actionsPlan{
+		prioritizedActionsIDs: base.PrioritizedActionsIDs(actionsIDs),
+		stopOnFailure:         base.StopOnActionFailure,
+	}
+}
+
+// evaluate evaluates the given Watch and returns the IDs of the Actions that
+// should be triggered together with the context that they should be triggered
+// with, recording the duration of the evaluation. Actions listed more than once
+// by the Watch are only returned once. The given context is passed on to the
+// Watch.
+func evaluate(
+	ctx context.Context,
+	watch common.Watch,
+	watchAPIMetrics *WatchAPIMetrics,
+) ([]int, actions.ActionContext) {
+	start := time.Now()
+	var actionsIDs []int
+	var actionContext actions.ActionContext
+	if contextWatch, ok := watch.(common.ContextWatch); ok {
+		actionsIDs, actionContext = contextWatch.DoWithContext(ctx)
+	} else {
+		// Watches that do not provide any details about their Result can still
+		// let the Actions know which Watch triggered them.
+		actionsIDs = watch.Do(ctx)
+		actionContext = actions.ActionContext{Timestamp: time.Now()}
+		if base, err := common.Base(watch); err == nil {
+			actionContext = base.ActionContext("", nil)
+		}
+	}
+	watchAPIMetrics.evaluationDuration.Observe(time.Since(start).Seconds())
+
+	if len(actionsIDs) != 0 {
+		actionsIDs = util.UniqueInts(actionsIDs)
+	}
+
+	return actionsIDs, actionContext
+}
+
+// safeEvaluate evaluates the given Watch the same way as evaluate() does, but it
+// recovers from a panic during the evaluation and returns it as an error, so
+// that a faulty Watch does not bring down the API.
+func safeEvaluate(
+	ctx context.Context,
+	watch common.Watch,
+	watchAPIMetrics *WatchAPIMetrics,
+) (actionsIDs []int, actionContext actions.ActionContext, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("the evaluation of the Watch failed: %v", recovered)
+		}
+	}()
+
+	actionsIDs, actionContext = evaluate(ctx, watch, watchAPIMetrics)
+	return actionsIDs, actionContext, nil
+}
+
+// resultHistory keeps the Results of the Watches in the given ResultStore, up to
+// the given number of the most recent Results per Watch and with their response
+// bodies truncated to the given number of bytes. It is shared by all requests.
+type resultHistory struct {
+	store        storage.ResultStore
+	length       int
+	maxBodyBytes int
+}
+
+// newResultHistory creates a history that keeps up to the given number of
+// Results per Watch in the given ResultStore, truncating their response bodies
+// to the given number of bytes.
+func newResultHistory(store storage.ResultStore, length int, maxBodyBytes int) *resultHistory {
+	return &resultHistory{store: store, length: length, maxBodyBytes: maxBodyBytes}
+}
+
+// record adds the Result of an evaluation of the Watch with the given ID, given
+// as the IDs of the Actions to be triggered and the context they are triggered
+// with, to the history of the Watch. Any response headers and body captured by
+// the Watch are kept together with the Result, the body truncated before it is
+// stored. The Actions are triggered regardless of whether the Result could be
+// kept; failures are logged using the given Logger.
+func (history *resultHistory) record(
+	watchID int,
+	actionsIDs []int,
+	actionContext actions.ActionContext,
+	logger *log.Logger,
+) {
+	result := storage.Result{
+		WatchID:    watchID,
+		Timestamp:  actionContext.Timestamp,
+		Status:     actionContext.Status,
+		ActionsIDs: actionsIDs,
+		Headers:    actionContext.Headers,
+	}
+	if result.ActionsIDs == nil {
+		result.ActionsIDs = []int{}
+	}
+	result.Body, result.BodyTruncated = truncateBody(actionContext.Body, history.maxBodyBytes)
+	result.BodyTruncated = result.BodyTruncated || actionContext.BodyTruncated
+
+	err := history.store.AddResult(result, history.length)
+	if err != nil {
+		logger.Error("failed to keep the Result of the Watch", "watch_id", watchID, "err", err)
+	}
+}
+
+// truncateBody returns the given body cut down to the given number of bytes,
+// together with whether it had to be cut. It is cut at the start of a UTF-8
+// character so that the stored body remains valid text.
+func truncateBody(body string, maxBytes int) (string, bool) {
+	if len(body) <= maxBytes {
+		return body, false
+	}
+
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return body[:end], true
+}
+
+// actionClaims keeps track of the IDs of the Actions that have been triggered
+// by the Watches evaluated in one request.
+type actionClaims struct {
+	sync.Mutex
+	claimed map[int]bool
+}
+
+// newActionClaims creates a set of claims with no Actions claimed.
+func newActionClaims() *actionClaims {
+	return &actionClaims{claimed: map[int]bool{}}
+}
+
+// claim marks the Actions with the given IDs as triggered, and it returns the
+// IDs of those that were not already claimed, in the given order.
+func (claims *actionClaims) claim(actionsIDs []int) []int {
+	claims.Lock()
+	defer claims.Unlock()
+	var unclaimed []int
+	for _, actionID := range actionsIDs {
+		if claims.claimed[actionID] {
+			continue
+		}
+		claims.claimed[actionID] = true
+		unclaimed = append(unclaimed, actionID)
+	}
+	return unclaimed
+}
+
+// evaluationGuard keeps track of the IDs of the Watches that are being
+// evaluated. It is shared by all requests.
+type evaluationGuard struct {
+	sync.Mutex
+	inFlight map[int]bool
+}
+
+// newEvaluationGuard creates a guard with no Watches being evaluated.
+func newEvaluationGuard() *evaluationGuard {
+	return &evaluationGuard{inFlight: map[int]bool{}}
+}
+
+// acquire marks the Watch with the given ID as being evaluated. It returns
+// false, without changing anything, if the Watch is already being evaluated.
+func (guard *evaluationGuard) acquire(watchID int) bool {
+	guard.Lock()
+	defer guard.Unlock()
+	if guard.inFlight[watchID] {
+		return false
+	}
+	guard.inFlight[watchID] = true
+	return true
+}
+
+// release marks the evaluation of the Watch with the given ID as finished.
+func (guard *evaluationGuard) release(watchID int) {
+	guard.Lock()
+	defer guard.Unlock()
+	delete(guard.inFlight, watchID)
+}
+
+// WatchAPIMetrics holds the metrics collected by the Watch API, and the registry
+// that exposes them.
+type WatchAPIMetrics struct {
+	registry *prometheus.Registry
+
+	requests              *prometheus.CounterVec
+	watchesCreated        prometheus.Counter
+	triggersRequested     prometheus.Counter
+	triggersSkipped       prometheus.Counter
+	evaluationDuration    prometheus.Histogram
+	actionsTriggered      prometheus.Counter
+	actionTriggerFailures prometheus.Counter
+}
+
+// NewWatchAPIMetrics creates the metrics collected by the Watch API and
+// registers them with a new registry.
+func NewWatchAPIMetrics() *WatchAPIMetrics {
+	watchAPIMetrics := &WatchAPIMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: metrics.NewRequestsCounter("watch_api"),
+		watchesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "watches_created_total",
+			Help:      "The number of Watches created.",
+		}),
+		triggersRequested: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "watch_triggers_requested_total",
+			Help:      "The number of Watch evaluations requested.",
+		}),
+		triggersSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "watch_triggers_skipped_total",
+			Help:      "The number of Watch evaluations skipped because the Singleton Watch was already being evaluated.",
+		}),
+		evaluationDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Name:      "watch_evaluation_duration_seconds",
+			Help:      "The time taken to evaluate Watches.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		actionsTriggered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "actions_triggered_total",
+			Help:      "The number of Actions successfully triggered via the Action API.",
+		}),
+		actionTriggerFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "action_trigger_failures_total",
+			Help:      "The number of Actions that failed to be triggered via the Action API.",
+		}),
+	}
+
+	watchAPIMetrics.registry.MustRegister(
+		watchAPIMetrics.requests,
+		watchAPIMetrics.watchesCreated,
+		watchAPIMetrics.triggersRequested,
+		watchAPIMetrics.triggersSkipped,
+		watchAPIMetrics.evaluationDuration,
+		watchAPIMetrics.actionsTriggered,
+		watchAPIMetrics.actionTriggerFailures,
+	)
+
+	return watchAPIMetrics
+}
+
+// loadEphmeralWatches checks if the storage engine is configured to run in
+// "ephemeral" mode, and if so, it loads into it any Watches contained in the
+// configuration file.
+func loadEphemeralWatches(watchAPIConfig *config.Config, watchStorage storage.Storage) {
+	// @I Load init Watches directly in Redis via a script so that services
+	//    don't have to be restarted together
+	mode, ok := watchAPIConfig.Storage["mode"]
+	if !ok || mode.(string) != "ephemeral" || watchAPIConfig.WatchWrappers == nil {
+		return
 	}
 
 	for _, wrapper := range watchAPIConfig.WatchWrappers {
-		_, err := storage.Create(&wrapper.Watch)
+		_, err := watchStorage.Create(&wrapper.Watch)
 		if err != nil {
-			panic(err)
+			log.Fatal("failed to load the ephemeral Watches", "err", err)
 		}
 	}
 }
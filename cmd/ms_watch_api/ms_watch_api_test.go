@@ -0,0 +1,1591 @@
+/**
+ * Tests for the Watch API.
+ */
+
+package main
+
+import (
+	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	sdk "github.com/krystalcode/go-mantis-shrimp/actions/sdk"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	metrics "github.com/krystalcode/go-mantis-shrimp/util/metrics"
+	pool "github.com/krystalcode/go-mantis-shrimp/util/pool"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	config "github.com/krystalcode/go-mantis-shrimp/watches/config"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
+	watchStorage "github.com/krystalcode/go-mantis-shrimp/watches/storage"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/watches/wrapper"
+)
+
+/**
+ * Tests.
+ */
+
+func TestV1Get_StorageError(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "GET", "/v1/1", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Get_NotFound(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "GET", "/v1/1", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+}
+
+func TestV1Create_StorageError(t *testing.T) {
+	response := testRequest(
+		TestStorage_Error{},
+		"POST",
+		"/v1/",
+		`{"type":"health_check","watch":{"name":"Test Watch","url":"https://example.com"}}`,
+	)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Create_NoTrigger(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/", testWatchJSON(server.URL, "[3,4]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1}`, response.Body.String())
+
+	// No Actions should be triggered.
+	assert.Empty(t, triggered(0))
+}
+
+func TestV1Create_Trigger(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/?trigger=true", testWatchJSON(server.URL, "[3,4]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"actions_ids":[3,4]}`, response.Body.String())
+
+	// The Actions of the Watch should be triggered.
+	assert.Equal(t, []int{3, 4}, triggered(2))
+}
+
+func TestV1Create_ActionsPriorities(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerActionInOrder()
+
+	watchJSON := `{"type":"health_check","watch":{"name":"Test Watch","url":"` + server.URL + `","statuses":[200],"timeout":1000000000,"actions_ids":[1,2,3],"actions_priorities":{"3":10,"1":5},"conditions":[{"type":"success"}]}}`
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/?trigger=true", watchJSON)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// The Actions should be triggered in order of decreasing priority; Actions
+	// without a priority last.
+	assert.Equal(t, []int{3, 1, 2}, triggered(3))
+}
+
+func TestV1Trigger_ActionContext(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	contexts := make(chan actions.ActionContext, 2)
+	original := triggerAction
+	defer func() { triggerAction = original }()
+	triggerAction = func(id int, actionContext actions.ActionContext, config sdk.Config) error {
+		contexts <- actionContext
+		return nil
+	}
+
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testWatchJSON(server.URL, "[3]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = testRequest(storage, "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// The Action should be given the details of the Watch that triggered it.
+	select {
+	case actionContext := <-contexts:
+		assert.Equal(t, "Test Watch", actionContext.WatchName)
+		assert.Equal(t, "success", actionContext.Status)
+		assert.Equal(t, map[string]string{"url": server.URL, "severity": "critical"}, actionContext.Values)
+		assert.False(t, actionContext.Timestamp.IsZero())
+	case <-time.After(time.Second):
+		t.Error("the Action was not triggered")
+	}
+}
+
+func TestV1Create_InvalidTrigger(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/?trigger=maybe", testWatchJSON("https://example.com", "[3,4]"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestV1Bulk_Success(t *testing.T) {
+	storage := newTestStorageMemory()
+	body := "[" + testWatchJSON("https://example.com", "[1]") + "," + testWatchJSON("https://example.org", "[2]") + "]"
+	response := testRequest(storage, "POST", "/v1/bulk", body)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":200,"results":[{"index":0,"id":1},{"index":1,"id":2}]}`,
+		response.Body.String(),
+	)
+
+	watch, err := storage.Get(2)
+	assert.Nil(t, err)
+	base, _ := common.Base(*watch)
+	assert.Equal(t, []int{2}, base.ActionsIDs)
+}
+
+func TestV1Bulk_PartialFailure(t *testing.T) {
+	storage := newTestStorageMemory()
+	body := "[" +
+		testWatchJSON("https://example.com", "[1]") + "," +
+		`{"type":"unknown","watch":{"name":"Test Watch"}},` +
+		testWatchJSON("https://example.org", "[2]") +
+		"]"
+	response := testRequest(storage, "POST", "/v1/bulk", body)
+	assert.Equal(t, http.StatusMultiStatus, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":207,"results":[
+			{"index":0,"id":1},
+			{"index":1,"error":"unknown Watch type \"unknown\" while trying to decode a WatchWrapper JSON object: unknown type"},
+			{"index":2,"id":2}
+		]}`,
+		response.Body.String(),
+	)
+
+	// Storage errors are reported per Watch without their details.
+	response = testRequest(TestStorage_Error{}, "POST", "/v1/bulk", "["+testWatchJSON("https://example.com", "[1]")+"]")
+	assert.Equal(t, http.StatusMultiStatus, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":207,"results":[{"index":0,"error":"the Watch could not be stored"}]}`,
+		response.Body.String(),
+	)
+}
+
+func TestV1Bulk_MalformedElements(t *testing.T) {
+	storage := newTestStorageMemory()
+	body := `[42,{},{"watch":{"name":"Test Watch"}},` + testWatchJSON("https://example.com", "[1]") + `]`
+	response := testRequest(storage, "POST", "/v1/bulk", body)
+	assert.Equal(t, http.StatusMultiStatus, response.Code)
+
+	var decoded struct {
+		Results []bulkResult `json:"results"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Len(t, decoded.Results, 4)
+	for index, result := range decoded.Results[:3] {
+		assert.Equal(t, index, result.Index)
+		assert.Nil(t, result.ID, "case %d", index)
+		assert.NotEmpty(t, result.Error, "case %d", index)
+	}
+	assert.Equal(t, 1, *decoded.Results[3].ID)
+	assert.Empty(t, decoded.Results[3].Error)
+}
+
+func TestV1Bulk_InvalidRequest(t *testing.T) {
+	storage := newTestStorageMemory()
+
+	// The Watches should be given as an array.
+	response := testRequest(storage, "POST", "/v1/bulk", testWatchJSON("https://example.com", "[1]"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	elements := make([]string, BulkLimitMax+1)
+	for index := range elements {
+		elements[index] = testWatchJSON("https://example.com", "[1]")
+	}
+	response = testRequest(storage, "POST", "/v1/bulk", "["+strings.Join(elements, ",")+"]")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	exists, _ := storage.Exists(1)
+	assert.False(t, exists)
+
+	// Only the "bulk" path is served by the endpoint.
+	response = testRequest(storage, "POST", "/v1/1", "[]")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestV1Update_Success(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testWatchJSON("https://example.com", "[1]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	created, err := storage.Get(1)
+	assert.Nil(t, err)
+	createdBase, err := common.Base(*created)
+	assert.Nil(t, err)
+
+	response = testRequest(storage, "PUT", "/v1/1", testWatchJSON("https://example.org", "[2,3]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// The updated Watch is returned.
+	var decoded struct {
+		Status int          `json:"status"`
+		ID     int          `json:"id"`
+		Type   string       `json:"type"`
+		Watch  health.Watch `json:"watch"`
+	}
+	err = json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, decoded.Status)
+	assert.Equal(t, 1, decoded.ID)
+	assert.Equal(t, "health_check", decoded.Type)
+	assert.Equal(t, "https://example.org", decoded.Watch.URL)
+	assert.Equal(t, []int{2, 3}, decoded.Watch.ActionsIDs)
+
+	// The Watch is stored, keeping its creation time.
+	updated, err := storage.Get(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.org", (*updated).(health.Watch).URL)
+	updatedBase, err := common.Base(*updated)
+	assert.Nil(t, err)
+	assert.Equal(t, createdBase.CreatedAt, updatedBase.CreatedAt)
+	exists, err := storage.Exists(2)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestV1Update_NotFound(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "PUT", "/v1/1", testWatchJSON("https://example.org", "[2]"))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+
+	// No Watch should be created.
+	exists, err := storage.Exists(1)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestV1Update_TypeMismatch(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testWatchJSON("https://example.com", "[1]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = testRequest(
+		storage,
+		"PUT",
+		"/v1/1",
+		`{"type":"dns_check","watch":{"name":"Test Watch","host":"example.com"}}`,
+	)
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.JSONEq(t, `{"status":409}`, response.Body.String())
+
+	// The Watch should be left unchanged.
+	stored, err := storage.Get(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", (*stored).(health.Watch).URL)
+}
+
+func TestV1Update_InvalidRequest(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "PUT", "/v1/abc", testWatchJSON("https://example.org", "[2]"))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = testRequest(storage, "PUT", "/v1/1", `{"type":`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = testRequest(storage, "PUT", "/v1/1", `{}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = testRequest(TestStorage_Error{}, "PUT", "/v1/1", testWatchJSON("https://example.org", "[2]"))
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestV1List_StorageError(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "GET", "/v1/", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1List_Cursor(t *testing.T) {
+	storage := newTestStorageMemory()
+	for i := 0; i < 5; i++ {
+		response := testRequest(storage, "POST", "/v1/", testWatchJSON("https://example.com", "[1]"))
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+
+	// Go through pages of 2 Watches following the cursors.
+	var pages []int
+	url := "/v1/?limit=2"
+	for len(pages) < 5 {
+		response := testRequest(storage, "GET", url, "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		var decoded struct {
+			Watches []json.RawMessage `json:"watches"`
+			Next    *int              `json:"next"`
+		}
+		err := json.Unmarshal(response.Body.Bytes(), &decoded)
+		assert.Nil(t, err)
+		pages = append(pages, len(decoded.Watches))
+		if decoded.Next == nil {
+			break
+		}
+		url = fmt.Sprintf("/v1/?limit=2&since=%d", *decoded.Next)
+	}
+	assert.Equal(t, []int{2, 2, 1}, pages)
+
+	// The cursor is not returned when paginating by offset.
+	response := testRequest(storage, "GET", "/v1/?offset=1&limit=2", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var decoded map[string]interface{}
+	err := json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Len(t, decoded["watches"], 2)
+	assert.NotContains(t, decoded, "next")
+
+	for _, url := range []string{"/v1/?since=-1", "/v1/?since=abc", "/v1/?since=1&offset=1"} {
+		response = testRequest(storage, "GET", url, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, url)
+	}
+}
+
+func TestV1Trigger_StorageError(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Trigger_MultipleWatches(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	storage := newTestStorageMemory()
+	for _, actionsIDs := range []string{"[1,2]", "[3]", "[4,5]"} {
+		response := testRequest(storage, "POST", "/v1/", testWatchJSON(server.URL, actionsIDs))
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := testRequest(storage, "POST", "/v1/1,2,3/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Every Watch should be evaluated and all of their Actions triggered.
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, triggered(5))
+}
+
+func TestV1Trigger_Wait(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+	triggered := mockTriggerAction()
+
+	storage := newTestStorageMemory()
+	watchesJSON := []string{
+		testWatchJSON(server.URL, "[1,2]"),
+		testWatchJSON(failingServer.URL, "[3]"),
+		testWatchJSON(server.URL, "[2,4]"),
+	}
+	for _, watchJSON := range watchesJSON {
+		response := testRequest(storage, "POST", "/v1/", watchJSON)
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+
+	// The results are given in the order of the requested IDs, including the
+	// Actions shared with other Watches.
+	response := testRequest(storage, "POST", "/v1/3,2,1/trigger?wait=true", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":200,"results":[{"id":3,"actions_ids":[2,4]},{"id":2,"actions_ids":[]},{"id":1,"actions_ids":[1,2]}]}`,
+		response.Body.String(),
+	)
+	assert.Equal(t, []int{1, 2, 4}, triggered(3))
+
+	response = testRequest(storage, "POST", "/v1/1/trigger?wait=maybe", "")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestV1Trigger_NoWait(t *testing.T) {
+	// A server that does not respond until it is released, so that the
+	// evaluation of the Watch is kept in progress.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	storage := newTestStorageMemory()
+	router := testRouter(storage, NewWatchAPIMetrics())
+	response := testServe(router, "POST", "/v1/", testWatchJSON(server.URL, "[1]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// The response is given while the evaluation is still in progress.
+	response = testServe(router, "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+
+	close(release)
+	assert.Equal(t, []int{1}, triggered(1))
+}
+
+func TestV1Trigger_Result(t *testing.T) {
+	// The Watch is evaluated against the given Result without making a request
+	// to its URL.
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	storage := newTestStorageMemory()
+	failureWatchJSON := strings.Replace(testWatchJSON(server.URL, "[1]"), `{"type":"success"}`, `{"type":"failure"}`, 1)
+	response := testRequest(storage, "POST", "/v1/", failureWatchJSON)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = testRequest(storage, "POST", "/v1/1/trigger?wait=true", `{"result":{"status":"inaccessible"}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"results":[{"id":1,"actions_ids":[1]}]}`, response.Body.String())
+	assert.Equal(t, []int{1}, triggered(1))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+
+	// A request body without a Result is the same as no request body.
+	triggered = mockTriggerAction()
+	response = testRequest(storage, "POST", "/v1/1/trigger?wait=true", `{}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"results":[{"id":1,"actions_ids":[]}]}`, response.Body.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Empty(t, triggered(0))
+}
+
+func TestV1Trigger_InvalidResult(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testWatchJSON(server.URL, "[1]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = testRequest(storage, "POST", "/v1/", `{"type":"dns_check","watch":{"name":"DNS Watch","hostname":"example.com","record_type":"A","actions_ids":[2]}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Nothing is triggered if the Result is not valid, or if any of the Watches
+	// cannot be evaluated against a given Result.
+	for _, c := range []struct{ url, body string }{
+		{"/v1/1/trigger", `{"result":`},
+		{"/v1/1/trigger", `{"result":"success"}`},
+		{"/v1/1,2/trigger", `{"result":{"status":"success"}}`},
+	} {
+		response = testRequest(storage, "POST", c.url, c.body)
+		assert.Equal(t, http.StatusBadRequest, response.Code, c.body)
+		assert.JSONEq(t, `{"status":400}`, response.Body.String(), c.body)
+	}
+	assert.Empty(t, triggered(0))
+}
+
+func TestV1Event(t *testing.T) {
+	storage := newTestStorageMemory()
+	watchJSON := `{"type":"inbound_event","watch":{"name":"Deployments","actions_ids":[1,2],"conditions":[{"type":"assertion","path":"$.status","operator":"==","value":"failed"}]}}`
+	response := testRequest(storage, "POST", "/v1/", watchJSON)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// An event matching the Conditions should trigger the Actions.
+	triggered := mockTriggerAction()
+	response = testRequest(storage, "POST", "/v1/1/event", `{"source":"deploy","status":"failed"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"actions_ids":[1,2]}`, response.Body.String())
+	assert.Equal(t, []int{1, 2}, triggered(2))
+
+	// An event that does not match the Conditions should not.
+	triggered = mockTriggerAction()
+	response = testRequest(storage, "POST", "/v1/1/event", `{"source":"deploy","status":"succeeded"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"actions_ids":[]}`, response.Body.String())
+	assert.Empty(t, triggered(0))
+
+	// Neither should triggering the Watch without an event.
+	triggered = mockTriggerAction()
+	response = testRequest(storage, "POST", "/v1/1/trigger?wait=true", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"results":[{"id":1,"actions_ids":[]}]}`, response.Body.String())
+	assert.Empty(t, triggered(0))
+}
+
+func TestV1Event_History(t *testing.T) {
+	store := newTestResultStoreMemory()
+	router := testRouterWithResultHistory(newTestStorageMemory(), NewWatchAPIMetrics(), newResultHistory(store, 10, MaxStoredBodyBytesDefault))
+	triggered := mockTriggerAction()
+
+	watchJSON := `{"type":"inbound_event","watch":{"name":"Deployments","actions_ids":[1]}}`
+	response := testServe(router, "POST", "/v1/", watchJSON)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Without Conditions, every event triggers the Actions.
+	response = testServe(router, "POST", "/v1/1/event", `{}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, []int{1}, triggered(1))
+
+	results, err := store.Results(1, 10)
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "received", results[0].Status)
+	assert.Equal(t, []int{1}, results[0].ActionsIDs)
+}
+
+func TestV1Event_InvalidRequest(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", `{"type":"inbound_event","watch":{"actions_ids":[1]}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = testRequest(storage, "POST", "/v1/", `{"type":"dns_check","watch":{"name":"DNS Watch","hostname":"example.com","record_type":"A","actions_ids":[2]}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	triggered := mockTriggerAction()
+	for _, c := range []struct {
+		url    string
+		body   string
+		status int
+	}{
+		{"/v1/abc/event", `{}`, http.StatusBadRequest},
+		{"/v1/3/event", `{}`, http.StatusNotFound},
+		// The event must be a JSON document.
+		{"/v1/1/event", `{"status":`, http.StatusBadRequest},
+		{"/v1/1/event", ``, http.StatusBadRequest},
+		// The Watch must support being evaluated against a given event.
+		{"/v1/2/event", `{}`, http.StatusBadRequest},
+	} {
+		response = testRequest(storage, "POST", c.url, c.body)
+		assert.Equal(t, c.status, response.Code, c.url+" "+c.body)
+	}
+	assert.Empty(t, triggered(0))
+
+	response = testRequest(TestStorage_Error{}, "POST", "/v1/1/event", `{}`)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestSafeEvaluate_Panic(t *testing.T) {
+	actionsIDs, _, err := safeEvaluate(context.Background(), testPanickingWatch{}, NewWatchAPIMetrics())
+	assert.Nil(t, actionsIDs)
+	assert.EqualError(t, err, "the evaluation of the Watch failed: cannot evaluate")
+}
+
+func TestV1Create_DuplicateActions(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/?trigger=true", testWatchJSON(server.URL, "[3,4,3]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":1,"actions_ids":[3,4]}`, response.Body.String())
+
+	// An Action listed twice by the Watch should be triggered once.
+	assert.Equal(t, []int{3, 4}, triggered(3))
+}
+
+func TestV1Trigger_SharedActions(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	storage := newTestStorageMemory()
+	for _, actionsIDs := range []string{"[1,2,1]", "[2,3]", "[3,1]"} {
+		response := testRequest(storage, "POST", "/v1/", testWatchJSON(server.URL, actionsIDs))
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := testRequest(storage, "POST", "/v1/1,2,3/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Every Action should be triggered once, even if it is listed by more than
+	// one of the Watches.
+	assert.Equal(t, []int{1, 2, 3}, triggered(4))
+}
+
+func TestActionClaims(t *testing.T) {
+	claims := newActionClaims()
+	assert.Equal(t, []int{2, 1}, claims.claim([]int{2, 1}))
+	assert.Equal(t, []int{3}, claims.claim([]int{1, 3, 2}))
+	assert.Empty(t, claims.claim([]int{3}))
+}
+
+func TestV1Pause(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testWatchJSON(server.URL, "[1]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = testRequest(storage, "POST", "/v1/pause", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"paused":true}`, response.Body.String())
+	response = testRequest(storage, "GET", "/v1/pause", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"paused":true}`, response.Body.String())
+
+	// No Actions should be triggered while paused, neither by triggering a Watch
+	// nor by creating one with triggering requested.
+	triggered := mockTriggerAction()
+	response = testRequest(storage, "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"paused":true}`, response.Body.String())
+	response = testRequest(storage, "POST", "/v1/?trigger=true", testWatchJSON(server.URL, "[2]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"id":2,"paused":true}`, response.Body.String())
+	assert.Empty(t, triggered(0))
+
+	// Triggering works as normal once resumed.
+	response = testRequest(storage, "POST", "/v1/resume", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"paused":false}`, response.Body.String())
+	response = testRequest(storage, "GET", "/v1/pause", "")
+	assert.JSONEq(t, `{"status":200,"paused":false}`, response.Body.String())
+
+	triggered = mockTriggerAction()
+	response = testRequest(storage, "POST", "/v1/1,2/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+	assert.Equal(t, []int{1, 2}, triggered(2))
+}
+
+func TestV1Pause_StorageError(t *testing.T) {
+	for _, path := range []string{"/v1/pause", "/v1/resume"} {
+		response := testRequest(TestStorage_Error{}, "POST", path, "")
+		assert.Equal(t, http.StatusInternalServerError, response.Code, path)
+	}
+	response := testRequest(TestStorage_Error{}, "GET", "/v1/pause", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestV1Post_NotFound(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/unknown", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+}
+
+func TestV1Trigger_Singleton(t *testing.T) {
+	// A server that does not respond until it is released, so that the
+	// evaluations of the Watches are kept in progress.
+	requests := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer unblock()
+	waitForRequest := func() {
+		select {
+		case <-requests:
+		case <-time.After(time.Second):
+			t.Fatal("the Watch was not evaluated")
+		}
+	}
+	triggered := mockTriggerAction()
+
+	storage := newTestStorageMemory()
+	router := testRouter(storage, NewWatchAPIMetrics())
+	singletonWatchJSON := strings.Replace(testWatchJSON(server.URL, "[1]"), `"name"`, `"singleton":true,"name"`, 1)
+	response := testServe(router, "POST", "/v1/", singletonWatchJSON)
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = testServe(router, "POST", "/v1/", testWatchJSON(server.URL, "[2]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = testServe(router, "POST", "/v1/1,2/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+	waitForRequest()
+	waitForRequest()
+
+	// While the first evaluations are in progress, only the Watch that is not a
+	// Singleton is evaluated again.
+	response = testServe(router, "POST", "/v1/1,2/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"skipped":1}`, response.Body.String())
+	waitForRequest()
+
+	unblock()
+	assert.Equal(t, []int{1, 2, 2}, triggered(3))
+
+	// The Singleton Watch can be triggered again once its evaluation finishes.
+	triggered = mockTriggerAction()
+	response = testServe(router, "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+	assert.Equal(t, []int{1}, triggered(1))
+}
+
+func TestTriggerActions_BoundedConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	var running, maxRunning int
+	var wg sync.WaitGroup
+
+	original := triggerAction
+	defer func() { triggerAction = original }()
+	triggerAction = func(id int, actionContext actions.ActionContext, config sdk.Config) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		wg.Done()
+		return nil
+	}
+
+	actionsIDs := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	wg.Add(len(actionsIDs))
+	triggerActions(actionsPlan{prioritizedActionsIDs: [][]int{actionsIDs}}, actions.ActionContext{}, sdk.Config{}, pool.New(2), NewWatchAPIMetrics(), log.Default())
+	wg.Wait()
+
+	// No more Actions than the size of the pool should be triggered at the same
+	// time.
+	assert.True(t, maxRunning <= 2, "%d Actions were triggered at the same time", maxRunning)
+}
+
+func TestTriggerActions_Priorities(t *testing.T) {
+	original := triggerAction
+	defer func() { triggerAction = original }()
+
+	// Record which Actions had finished when each Action was triggered.
+	var mutex sync.Mutex
+	finished := map[int]bool{}
+	finishedBefore := map[int][]int{}
+	triggerAction = func(id int, actionContext actions.ActionContext, config sdk.Config) error {
+		mutex.Lock()
+		for finishedID := range finished {
+			finishedBefore[id] = append(finishedBefore[id], finishedID)
+		}
+		sort.Ints(finishedBefore[id])
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		finished[id] = true
+		mutex.Unlock()
+
+		// Failures should not prevent lower priority Actions from being
+		// triggered.
+		if id == 1 {
+			return fmt.Errorf("the Action API is not available")
+		}
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	logger, _ := log.New(&buffer, log.Config{Format: log.FormatJSON})
+
+	triggerPool := pool.New(4)
+	triggerActions(actionsPlan{prioritizedActionsIDs: [][]int{{5}, {1, 3}, {2}}}, actions.ActionContext{}, sdk.Config{}, triggerPool, NewWatchAPIMetrics(), logger)
+	assert.Nil(t, triggerPool.Wait(context.Background()))
+
+	assert.Nil(t, finishedBefore[5])
+	assert.Equal(t, []int{5}, finishedBefore[1])
+	assert.Equal(t, []int{5}, finishedBefore[3])
+	assert.Equal(t, []int{1, 3, 5}, finishedBefore[2])
+}
+
+func TestTriggerActions_StopOnFailure(t *testing.T) {
+	cases := []struct {
+		stopOnFailure bool
+		triggered     []int
+	}{
+		// Best-effort; all Actions are triggered.
+		{false, []int{1, 2, 3, 4}},
+		// Fail-fast; the Actions following the failed one are not triggered.
+		{true, []int{1, 2}},
+	}
+	for _, c := range cases {
+		triggered := mockTriggerActionFailing(2)
+
+		var buffer bytes.Buffer
+		logger, _ := log.New(&buffer, log.Config{Format: log.FormatJSON})
+
+		plan := actionsPlan{
+			prioritizedActionsIDs: [][]int{{1, 2}, {3, 4}},
+			stopOnFailure:         c.stopOnFailure,
+		}
+		triggerPool := pool.New(4)
+		triggerActions(plan, actions.ActionContext{}, sdk.Config{}, triggerPool, NewWatchAPIMetrics(), logger)
+		assert.Nil(t, triggerPool.Wait(context.Background()))
+
+		ids := triggered()
+		if !c.stopOnFailure {
+			sort.Ints(ids)
+		}
+		assert.Equal(t, c.triggered, ids, "stop on failure: %t", c.stopOnFailure)
+
+		// The failed Action, and the Actions skipped because of it, should be
+		// logged.
+		assert.Contains(t, buffer.String(), `"action_id":2`)
+		if c.stopOnFailure {
+			assert.Contains(t, buffer.String(), `"skipped_actions_ids":[3,4]`)
+		} else {
+			assert.NotContains(t, buffer.String(), "skipped_actions_ids")
+		}
+	}
+}
+
+func TestNewActionsPlan(t *testing.T) {
+	watch := health.Watch{}
+	assert.Equal(t, actionsPlan{prioritizedActionsIDs: [][]int{{1, 2}}}, newActionsPlan(watch, []int{1, 2}))
+
+	watch.ActionsPriorities = map[int]int{2: 1}
+	watch.StopOnActionFailure = true
+	assert.Equal(
+		t,
+		actionsPlan{prioritizedActionsIDs: [][]int{{2}, {1}}, stopOnFailure: true},
+		newActionsPlan(watch, []int{1, 2}),
+	)
+
+	// Watches that do not embed a WatchBase have their Actions triggered
+	// together.
+	assert.Equal(
+		t,
+		actionsPlan{prioritizedActionsIDs: [][]int{{1, 2}}},
+		newActionsPlan(testPanickingWatch{}, []int{1, 2}),
+	)
+}
+
+func TestHealth(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "GET", "/health", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+
+	response = testRequest(TestStorage_Error{}, "GET", "/health", "")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.JSONEq(t, `{"status":503,"error":"the Storage is not available"}`, response.Body.String())
+}
+
+func TestMetrics(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	watchAPIMetrics := NewWatchAPIMetrics()
+	router := testRouter(newTestStorageMemory(), watchAPIMetrics)
+
+	response := testServe(router, "POST", "/v1/?trigger=true", testWatchJSON(server.URL, "[3,4]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	triggered(2)
+
+	// Wait for the triggers to be recorded, which happens right after the calls
+	// to the Action API return.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && !strings.Contains(testServe(router, "GET", "/metrics", "").Body.String(), "mantis_shrimp_actions_triggered_total 2") {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	response = testServe(router, "GET", "/metrics", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	assert.Contains(t, body, "mantis_shrimp_watch_api_requests_total{")
+	assert.Contains(t, body, "mantis_shrimp_watches_created_total 1")
+	assert.Contains(t, body, "mantis_shrimp_watch_triggers_requested_total 1")
+	assert.Contains(t, body, "mantis_shrimp_watch_evaluation_duration_seconds_count 1")
+	assert.Contains(t, body, "mantis_shrimp_actions_triggered_total 2")
+	assert.Contains(t, body, "mantis_shrimp_action_trigger_failures_total 0")
+}
+
+func TestTriggerActions_Failures(t *testing.T) {
+	original := triggerAction
+	defer func() { triggerAction = original }()
+	triggerAction = func(id int, actionContext actions.ActionContext, config sdk.Config) error {
+		return fmt.Errorf("the Action API is not available")
+	}
+
+	var buffer bytes.Buffer
+	logger, _ := log.New(&buffer, log.Config{Format: log.FormatJSON})
+
+	watchAPIMetrics := NewWatchAPIMetrics()
+	triggerPool := pool.New(2)
+	triggerActions(actionsPlan{prioritizedActionsIDs: [][]int{{1, 2, 3}}}, actions.ActionContext{}, sdk.Config{}, triggerPool, watchAPIMetrics, logger)
+	assert.Nil(t, triggerPool.Wait(context.Background()))
+
+	// Every failure should be logged at the "error" level.
+	var actionsIDs []int
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var entry map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "error", entry["level"])
+		assert.Equal(t, "the Action API is not available", entry["err"])
+		actionsIDs = append(actionsIDs, int(entry["action_id"].(float64)))
+	}
+	sort.Ints(actionsIDs)
+	assert.Equal(t, []int{1, 2, 3}, actionsIDs)
+
+	router := testRouter(newTestStorageMemory(), watchAPIMetrics)
+	body := testServe(router, "GET", "/metrics", "").Body.String()
+	assert.Contains(t, body, "mantis_shrimp_action_trigger_failures_total 3")
+	assert.Contains(t, body, "mantis_shrimp_actions_triggered_total 0")
+}
+
+func TestV1History(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	triggered := mockTriggerAction()
+
+	store := newTestResultStoreMemory()
+	router := testRouterWithResultHistory(newTestStorageMemory(), NewWatchAPIMetrics(), newResultHistory(store, 2, MaxStoredBodyBytesDefault))
+
+	// The Watch is evaluated when created, and then triggered twice.
+	response := testServe(router, "POST", "/v1/?trigger=true", testWatchJSON(server.URL, "[1]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 1, store.count(1))
+	for i := 0; i < 2; i++ {
+		response = testServe(router, "POST", "/v1/1/trigger", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+	triggered(3)
+
+	// Only the configured number of Results are kept.
+	response = testServe(router, "GET", "/v1/1/history", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var decoded struct {
+		Status  int                   `json:"status"`
+		ID      int                   `json:"id"`
+		Results []watchStorage.Result `json:"results"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, decoded.ID)
+	if assert.Len(t, decoded.Results, 2) {
+		assert.Equal(t, 1, decoded.Results[0].WatchID)
+		assert.Equal(t, "success", decoded.Results[0].Status)
+		assert.Equal(t, []int{1}, decoded.Results[0].ActionsIDs)
+		assert.False(t, decoded.Results[0].Timestamp.Before(decoded.Results[1].Timestamp))
+	}
+
+	// Up to the requested number of Results are returned.
+	response = testServe(router, "GET", "/v1/1/history?limit=1", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	err = json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Len(t, decoded.Results, 1)
+}
+
+func TestResultHistory_Body(t *testing.T) {
+	store := newTestResultStoreMemory()
+	history := newResultHistory(store, 10, 8)
+	logger, _ := log.New(ioutil.Discard, log.Config{})
+
+	// Bodies up to the maximum size are kept as they are.
+	history.record(1, []int{1}, actions.ActionContext{Body: "12345678"}, logger)
+	// Longer bodies are truncated and marked as such.
+	history.record(2, []int{1}, actions.ActionContext{Body: "0123456789abcdef"}, logger)
+	// Bodies that the Watch truncated when capturing them are marked as such
+	// even if they fit.
+	history.record(3, []int{1}, actions.ActionContext{Body: "0123", BodyTruncated: true}, logger)
+
+	cases := []struct {
+		watchID   int
+		body      string
+		truncated bool
+	}{
+		{1, "12345678", false},
+		{2, "01234567", true},
+		{3, "0123", true},
+	}
+	for _, c := range cases {
+		results, err := store.Results(c.watchID, 1)
+		assert.Nil(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, c.body, results[0].Body, "Watch %d", c.watchID)
+			assert.Equal(t, c.truncated, results[0].BodyTruncated, "Watch %d", c.watchID)
+		}
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	body, truncated := truncateBody("", 8)
+	assert.Equal(t, "", body)
+	assert.False(t, truncated)
+
+	body, truncated = truncateBody("0123456789", 4)
+	assert.Equal(t, "0123", body)
+	assert.True(t, truncated)
+
+	// Bodies are not cut in the middle of a multi-byte character; "é" takes two
+	// bytes.
+	body, truncated = truncateBody("abcé", 4)
+	assert.Equal(t, "abc", body)
+	assert.True(t, truncated)
+}
+
+func TestV1Actions(t *testing.T) {
+	original := getActions
+	defer func() { getActions = original }()
+	getActions = func(ids []int, config sdk.Config) ([]json.RawMessage, []error) {
+		jsonActions := make([]json.RawMessage, len(ids))
+		errs := make([]error, len(ids))
+		for index, id := range ids {
+			switch id {
+			case 3:
+				jsonActions[index] = json.RawMessage(`{"type":"chat_message","action":{"name":"Notify"}}`)
+			case 4:
+				errs[index] = fmt.Errorf("the Action with ID \"4\" was %w", errorsUtil.ErrNotFound)
+			default:
+				errs[index] = fmt.Errorf("the Action API is not available")
+			}
+		}
+		return jsonActions, errs
+	}
+
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "POST", "/v1/", testWatchJSON("https://example.com", "[3,4,5]"))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = testRequest(storage, "GET", "/v1/1/actions", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(
+		t,
+		`{
+			"status": 200,
+			"id": 1,
+			"actions": [{"id":3,"type":"chat_message","action":{"name":"Notify"}}],
+			"unresolved": [
+				{"id":4,"error":"the Action was not found"},
+				{"id":5,"error":"the Action could not be fetched"}
+			]
+		}`,
+		response.Body.String(),
+	)
+}
+
+func TestV1Actions_InvalidRequest(t *testing.T) {
+	storage := newTestStorageMemory()
+	response := testRequest(storage, "GET", "/v1/abc/actions", "")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = testRequest(storage, "GET", "/v1/1/actions", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = testRequest(TestStorage_Error{}, "GET", "/v1/1/actions", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestV1History_InvalidRequest(t *testing.T) {
+	storage := newTestStorageMemory()
+	for _, url := range []string{"/v1/abc/history", "/v1/1/history?limit=0", "/v1/1/history?limit=many"} {
+		response := testRequest(storage, "GET", url, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, url)
+	}
+
+	response := testRequest(storage, "GET", "/v1/1/history", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+
+	response = testRequest(TestStorage_Error{}, "GET", "/v1/1/history", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestV1Trigger_InvalidID(t *testing.T) {
+	// The Storage should not be reached when the IDs are invalid; if it is, the
+	// response will be an Internal Server Error.
+	for _, ids := range []string{"abc", "1,abc", "1,,2"} {
+		response := testRequest(TestStorage_Error{}, "POST", "/v1/"+ids+"/trigger", "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, ids)
+		assert.JSONEq(t, `{"status":400}`, response.Body.String(), ids)
+	}
+}
+
+func TestV1Trigger_NotFound(t *testing.T) {
+	response := testRequest(newTestStorageMemory(), "POST", "/v1/1/trigger", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+}
+
+func TestStorage_SharedAcrossRequests(t *testing.T) {
+	watchStorage := &TestStorage_Error{}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Storage(watchStorage))
+	var storages []interface{}
+	router.GET("/", func(c *gin.Context) {
+		storages = append(storages, c.MustGet("storage"))
+	})
+
+	for i := 0; i < 3; i++ {
+		request, _ := http.NewRequest("GET", "/", nil)
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	// The same Storage engine should be made available to all requests, instead
+	// of building one, and connecting to the database, per request.
+	assert.Len(t, storages, 3)
+	for _, storage := range storages {
+		assert.True(t, storage == watchStorage)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	watchStorage.RegisterStorageFactory(
+		"test_check_memory",
+		func(config map[string]interface{}) (watchStorage.Storage, error) {
+			return newTestStorageMemory(), nil
+		},
+	)
+	watchStorage.RegisterStorageFactory(
+		"test_check_unavailable",
+		func(config map[string]interface{}) (watchStorage.Storage, error) {
+			return TestStorage_Error{}, nil
+		},
+	)
+
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{`{"action_api":{"base_url":"http://ms-action-api:8888","version":"1"},"storage":{"type":"test_check_memory"}}`, ""},
+		{`{"action_api":{"version":"1"},"storage":{"type":"test_check_memory"}}`, `the "configuration" step failed: invalid Watch API configuration: the "action_api.base_url" option is required`},
+		{`{"action_api":{"base_url":"http://ms-action-api:8888","version":"1"},"storage":{"type":"test_check_unknown"}}`, `the "storage" step failed: unknown storage engine "test_check_unknown": unknown type`},
+		{`{"action_api":{"base_url":"http://ms-action-api:8888","version":"1"},"storage":{"type":"test_check_unavailable"}}`, `the "storage ping" step failed: the Storage is not available`},
+	}
+	for index, c := range cases {
+		configPath, cleanup := testConfigFile(t, c.config)
+		var out bytes.Buffer
+		err := check(configPath, &out)
+		cleanup()
+
+		if c.err == "" {
+			assert.Nil(t, err, "case %d", index)
+			assert.Contains(t, out.String(), "all 3 steps passed", "case %d", index)
+			continue
+		}
+		assert.EqualError(t, err, c.err, "case %d", index)
+		assert.Contains(t, out.String(), "the check failed", "case %d", index)
+	}
+
+	// The configuration file must exist.
+	err := check("/nonexistent/config.json", ioutil.Discard)
+	assert.NotNil(t, err)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testConfigFile writes the given configuration to a temporary file. It returns
+// the path to the file and a function that removes it.
+func testConfigFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "ms_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(configPath, []byte(content), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return configPath, func() { os.RemoveAll(dir) }
+}
+
+// testRequest makes a request to a router that has the Watch API endpoints
+// registered and that makes the given Storage available to them.
+func testRequest(storage interface{}, method string, url string, body string) *httptest.ResponseRecorder {
+	return testServe(testRouter(storage, NewWatchAPIMetrics()), method, url, body)
+}
+
+// testRouter creates a router that has the Watch API endpoints registered and
+// that makes the given Storage and metrics available to them, together with a
+// Result history kept in memory.
+func testRouter(storage interface{}, watchAPIMetrics *WatchAPIMetrics) *gin.Engine {
+	history := newResultHistory(newTestResultStoreMemory(), ResultHistoryLengthDefault, MaxStoredBodyBytesDefault)
+	return testRouterWithResultHistory(storage, watchAPIMetrics, history)
+}
+
+// testRouterWithResultHistory creates a router same as testRouter does, that
+// makes the given Result history available to the endpoints.
+func testRouterWithResultHistory(storage interface{}, watchAPIMetrics *WatchAPIMetrics, history *resultHistory) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(metrics.Middleware(watchAPIMetrics.requests))
+	router.Use(Metrics(watchAPIMetrics))
+	router.Use(func(c *gin.Context) {
+		c.Set("storage", storage)
+		c.Next()
+	})
+	router.Use(Config(&config.Config{}))
+	router.Use(TriggerPool(pool.New(TriggerConcurrencyDefault)))
+	router.Use(EvaluationPool(pool.New(EvaluationConcurrencyDefault)))
+	router.Use(EvaluationGuard(newEvaluationGuard()))
+	router.Use(ResultHistory(history))
+
+	router.GET(metrics.PathDefault, gin.WrapH(metrics.Handler(watchAPIMetrics.registry)))
+	router.GET(api.PathHealth, api.Health(storage.(api.Pinger)))
+
+	v1 := router.Group("/v1")
+	{
+		v1.GET("/", v1List)
+		v1.POST("/", v1Create)
+		v1.POST("/:id", v1Post)
+		v1.GET("/:id", v1Get)
+		v1.PUT("/:id", v1Update)
+		v1.POST("/:id/trigger", v1Trigger)
+		v1.POST("/:id/event", v1Event)
+		v1.POST("/:id/replay", v1Replay)
+		v1.GET("/:id/history", v1History)
+		v1.GET("/:id/actions", v1Actions)
+	}
+
+	return router
+}
+
+// testServe makes a request to the given router.
+func testServe(router *gin.Engine, method string, url string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+// TestStorage_Error is a Storage engine that fails on every operation.
+type TestStorage_Error struct{}
+
+func (storage TestStorage_Error) Create(watch *common.Watch) (*int, error) {
+	return nil, fmt.Errorf("an error has occurred while creating the Watch")
+}
+
+func (storage TestStorage_Error) CreateWithID(id int, watch *common.Watch) error {
+	return fmt.Errorf("an error has occurred while creating the Watch")
+}
+
+func (storage TestStorage_Error) Get(id int) (*common.Watch, error) {
+	return nil, fmt.Errorf("an error has occurred while getting the Watch")
+}
+
+func (storage TestStorage_Error) Exists(id int) (bool, error) {
+	return false, fmt.Errorf("an error has occurred while checking whether the Watch exists")
+}
+
+func (storage TestStorage_Error) Update(id int, watch *common.Watch) error {
+	return fmt.Errorf("an error has occurred while updating the Watch")
+}
+
+func (storage TestStorage_Error) Ping() error {
+	return fmt.Errorf("the Storage is not available")
+}
+
+func (storage TestStorage_Error) List(offset int, limit int) ([]*common.Watch, []error, error) {
+	return nil, nil, fmt.Errorf("an error has occurred while listing the Watches")
+}
+
+func (storage TestStorage_Error) ListSince(since int, limit int) ([]*common.Watch, int, []error, error) {
+	return nil, 0, nil, fmt.Errorf("an error has occurred while listing the Watches")
+}
+
+func (storage TestStorage_Error) Paused() (bool, error) {
+	return false, fmt.Errorf("an error has occurred while checking whether triggering is paused")
+}
+
+func (storage TestStorage_Error) SetPaused(paused bool) error {
+	return fmt.Errorf("an error has occurred while pausing triggering")
+}
+
+// TestStorage_Memory is a Storage engine that keeps Watches in memory. Watches
+// are stored as JSON and recreated when loaded, the same way as the Redis
+// Storage does.
+type TestStorage_Memory struct {
+	watches map[int][]byte
+	paused  bool
+}
+
+func newTestStorageMemory() *TestStorage_Memory {
+	return &TestStorage_Memory{
+		watches: make(map[int][]byte),
+	}
+}
+
+func (storage *TestStorage_Memory) Create(watch *common.Watch) (*int, error) {
+	id := len(storage.watches) + 1
+	err := storage.Update(id, watch)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (storage *TestStorage_Memory) CreateWithID(id int, watch *common.Watch) error {
+	return storage.Update(id, watch)
+}
+
+func (storage *TestStorage_Memory) Get(id int) (*common.Watch, error) {
+	jsonWatch, ok := storage.watches[id]
+	if !ok {
+		return nil, watchStorage.ErrNotFound
+	}
+	watch, err := wrapper.Create(jsonWatch)
+	if err != nil {
+		return nil, err
+	}
+	return &watch, nil
+}
+
+func (storage *TestStorage_Memory) Exists(id int) (bool, error) {
+	_, ok := storage.watches[id]
+	return ok, nil
+}
+
+func (storage *TestStorage_Memory) Update(id int, watch *common.Watch) error {
+	watchWrapper, err := wrapper.Wrapper(*watch)
+	if err != nil {
+		return err
+	}
+	jsonWatch, err := json.Marshal(watchWrapper)
+	if err != nil {
+		return err
+	}
+	storage.watches[id] = jsonWatch
+	return nil
+}
+
+func (storage *TestStorage_Memory) Ping() error {
+	return nil
+}
+
+func (storage *TestStorage_Memory) List(offset int, limit int) ([]*common.Watch, []error, error) {
+	// Watches are never removed, so the Watch at each offset has the next ID.
+	watches, _, errs, err := storage.ListSince(offset, limit)
+	return watches, errs, err
+}
+
+func (storage *TestStorage_Memory) ListSince(since int, limit int) ([]*common.Watch, int, []error, error) {
+	// Watches are never removed, so their IDs are consecutive.
+	watches := []*common.Watch{}
+	for id := since + 1; id <= len(storage.watches) && len(watches) < limit; id++ {
+		watch, err := storage.Get(id)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		watches = append(watches, watch)
+	}
+
+	next := since + len(watches)
+	if next == len(storage.watches) {
+		next = 0
+	}
+
+	return watches, next, nil, nil
+}
+
+func (storage *TestStorage_Memory) Paused() (bool, error) {
+	return storage.paused, nil
+}
+
+func (storage *TestStorage_Memory) SetPaused(paused bool) error {
+	storage.paused = paused
+	return nil
+}
+
+// TestResultStore_Memory is a ResultStore that keeps the history of Results in
+// memory.
+type TestResultStore_Memory struct {
+	mutex   sync.Mutex
+	results map[int][]watchStorage.Result
+}
+
+func newTestResultStoreMemory() *TestResultStore_Memory {
+	return &TestResultStore_Memory{
+		results: make(map[int][]watchStorage.Result),
+	}
+}
+
+func (store *TestResultStore_Memory) AddResult(result watchStorage.Result, length int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	results := append([]watchStorage.Result{result}, store.results[result.WatchID]...)
+	if len(results) > length {
+		results = results[:length]
+	}
+	store.results[result.WatchID] = results
+	return nil
+}
+
+func (store *TestResultStore_Memory) Results(watchID int, limit int) ([]watchStorage.Result, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	results := append([]watchStorage.Result{}, store.results[watchID]...)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// count returns the number of Results kept for the Watch with the given ID.
+func (store *TestResultStore_Memory) count(watchID int) int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return len(store.results[watchID])
+}
+
+// testServer starts an HTTP server that responds with status 200 to all
+// requests, to be used as the URL of health check Watches.
+func testServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+// testPanickingWatch is a Watch that panics when it is evaluated.
+type testPanickingWatch struct{}
+
+func (watch testPanickingWatch) Do(ctx context.Context) []int {
+	panic("cannot evaluate")
+}
+
+// testWatchJSON returns the JSON object of a health check Watch for the given
+// URL that triggers the Actions with the given IDs, as a JSON array, when the
+// URL is accessible.
+func testWatchJSON(URL string, actionsIDs string) string {
+	return `{"type":"health_check","watch":{"name":"Test Watch","url":"` + URL + `","statuses":[200],"timeout":1000000000,"actions_ids":` + actionsIDs + `,"conditions":[{"type":"success"}]}}`
+}
+
+// mockTriggerAction replaces the function that triggers Actions via the Action
+// API for the duration of the test. It returns a function that waits until the
+// given number of Actions are triggered, or until a timeout, and returns the
+// sorted IDs of the triggered Actions.
+// mockTriggerActionInOrder replaces the call to the Action API the same way as
+// mockTriggerAction() does, but the IDs of the triggered Actions are returned in
+// the order that the Actions were triggered in.
+func mockTriggerActionInOrder() func(int) []int {
+	var mutex sync.Mutex
+	var triggered []int
+
+	original := triggerAction
+	triggerAction = func(id int, actionContext actions.ActionContext, config sdk.Config) error {
+		mutex.Lock()
+		triggered = append(triggered, id)
+		mutex.Unlock()
+
+		// Take a bit of time so that Actions triggered concurrently would be
+		// recorded out of order.
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	return func(count int) []int {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			mutex.Lock()
+			done := len(triggered) >= count
+			mutex.Unlock()
+			if done {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		triggerAction = original
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]int{}, triggered...)
+	}
+}
+
+// mockTriggerActionFailing replaces the call to the Action API with one that
+// records the IDs of the triggered Actions and that fails for the Action with
+// the given ID. The returned function restores the original call and returns the
+// recorded IDs, in the order that the Actions were triggered in.
+func mockTriggerActionFailing(failingID int) func() []int {
+	var mutex sync.Mutex
+	var triggered []int
+
+	original := triggerAction
+	triggerAction = func(id int, actionContext actions.ActionContext, config sdk.Config) error {
+		mutex.Lock()
+		triggered = append(triggered, id)
+		mutex.Unlock()
+
+		if id == failingID {
+			return fmt.Errorf("the Action API is not available")
+		}
+		return nil
+	}
+
+	return func() []int {
+		triggerAction = original
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]int{}, triggered...)
+	}
+}
+
+func mockTriggerAction() func(int) []int {
+	var mutex sync.Mutex
+	var triggered []int
+
+	original := triggerAction
+	triggerAction = func(id int, actionContext actions.ActionContext, config sdk.Config) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		triggered = append(triggered, id)
+		return nil
+	}
+
+	return func(count int) []int {
+		// Wait a bit longer than needed if no Actions are expected so that we
+		// can detect Actions triggered unexpectedly.
+		deadline := time.Now().Add(time.Second)
+		if count == 0 {
+			deadline = time.Now().Add(100 * time.Millisecond)
+		}
+		for time.Now().Before(deadline) {
+			mutex.Lock()
+			done := count != 0 && len(triggered) >= count
+			mutex.Unlock()
+			if done {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		triggerAction = original
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		ids := append([]int{}, triggered...)
+		sort.Ints(ids)
+		return ids
+	}
+}
@@ -0,0 +1,16 @@
+/**
+ * Registers the "database/sql" drivers that SQL Check Watches can use.
+ *
+ * Drivers are registered here rather than by the SQL Check Watch so that only
+ * the programs that evaluate Watches depend on them. Adding a driver requires
+ * adding it to msWatchSQLCheck.SupportedDrivers as well.
+ */
+
+package main
+
+import (
+	// MySQL, registered as "mysql".
+	_ "github.com/go-sql-driver/mysql"
+	// PostgreSQL, registered as "postgres".
+	_ "github.com/lib/pq"
+)
@@ -2,14 +2,24 @@ package main
 
 import (
 	// Utilities.
+	"context"
+	"flag"
 	"fmt"
+	"math/rand"
+	"os"
 	"time"
 
+	// Redis.
+	"github.com/mediocregopher/radix.v2/pubsub"
+
 	// Internal dependencies.
 	config "github.com/krystalcode/go-mantis-shrimp/cron/config"
 	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
 	storage "github.com/krystalcode/go-mantis-shrimp/cron/storage"
 	util "github.com/krystalcode/go-mantis-shrimp/util"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	pool "github.com/krystalcode/go-mantis-shrimp/util/pool"
+	redisUtil "github.com/krystalcode/go-mantis-shrimp/util/redis"
 	sdk "github.com/krystalcode/go-mantis-shrimp/watches/sdk"
 )
 
@@ -21,6 +31,18 @@ import (
 // for the Cron component.
 const CronConfigFile = "/etc/mantis-shrimp/cron.config.json"
 
+// SourceSearch holds the name of the source that searches the Storage for
+// candidate Schedules at regular intervals.
+const SourceSearch = "search"
+
+// SourcePubSub holds the name of the source that receives the IDs of the
+// Watches to trigger from a Redis Pub/Sub channel.
+const SourcePubSub = "pubsub"
+
+// pubSubReconnectDelay holds the time to wait before reconnecting to the Redis
+// Pub/Sub server after connecting or receiving from it fails.
+const pubSubReconnectDelay = 5 * time.Second
+
 /**
  * Main program entry.
  *
@@ -30,92 +52,410 @@ const CronConfigFile = "/etc/mantis-shrimp/cron.config.json"
  * that we shouldn't). The IDs of the Watches of Schedules that pass the
  * evaluation are sent to another channel that executes the triggering.
  *
+ * Alternatively, when an external scheduler owns the timing, the IDs of the
+ * Watches are received from a Redis Pub/Sub channel and sent directly to the
+ * channel that executes the triggering.
+ *
  * @I Add a Cron API for accepting Schedule submissions
  */
 func main() {
-	// Load configuration.
-	// @I Support providing configuration file for Cron component via cli options
-	// @I Validate Cron component configuration when loading from JSON file
+	// Load configuration, from the file given via the command line or from the
+	// default location. Secrets can be given via environment variables
+	// referenced in the file.
+	configFile := flag.String(
+		"config",
+		"",
+		"Path to the configuration file (default \""+CronConfigFile+"\")",
+	)
+	flag.Parse()
+
 	var cronConfig config.Config
-	err := util.ReadJSONFile(CronConfigFile, &cronConfig)
+	err := util.ReadJSONFileExpandEnv(util.ConfigFilePath(*configFile, CronConfigFile), &cronConfig)
+	if err != nil {
+		log.Fatal("failed to read the configuration", "err", err)
+	}
+	err = cronConfig.Validate()
 	if err != nil {
-		panic(err)
+		log.Fatal("invalid configuration", "err", err)
+	}
+
+	// Log as configured from now on.
+	logger, err := log.New(os.Stderr, cronConfig.Log)
+	if err != nil {
+		log.Fatal("failed to initialize the logger", "err", err)
+	}
+	log.SetDefault(logger.With("service", "cron"))
+
+	// Build the Storage engine once so that it is shared by all searches and
+	// runs. We fail early if the Storage cannot be reached.
+	scheduleStorage, err := storage.Create(cronConfig.Storage)
+	if err != nil {
+		log.Fatal("failed to initialize the Storage engine", "err", err)
 	}
 
 	// Load Schedules provided in the config, if we run on ephemeral storage mode.
-	loadEphemeralSchedules(&cronConfig)
+	loadEphemeralSchedules(&cronConfig, scheduleStorage)
+
+	// Run until we are asked to shut down, and then give the Schedules being run
+	// the configured grace period to finish.
+	ctx, cancel := util.ShutdownContext()
+	defer cancel()
+
+	gracePeriod, err := util.ParseGracePeriod(cronConfig.ShutdownGracePeriod)
+	if err != nil {
+		log.Fatal("invalid shutdown grace period", "err", err)
+	}
+
+	err = start(ctx, &cronConfig, scheduleStorage, gracePeriod)
+	if err != nil {
+		log.Fatal("the Cron component stopped unexpectedly", "err", err)
+	}
+}
+
+// start starts the flow of the program described above, and it returns when the
+// given context is cancelled. Triggering of Watches stops at that point; the
+// Schedules being run are given the grace period to record their last trigger
+// time.
+func start(
+	ctx context.Context,
+	cronConfig *config.Config,
+	scheduleStorage storage.Storage,
+	gracePeriod time.Duration,
+) error {
+	// Configuration required by the Watch API SDK.
+	sdkConfig, err := watchSDKConfig(cronConfig)
+	if err != nil {
+		return err
+	}
 
 	// Channel that receives IDs of the Watches that are ready to be triggered.
 	triggers := make(chan int)
 
-	// Channel that receives Schedules that are candidate for triggering.
-	schedules := make(chan schedule.Schedule)
+	// Tracks the Schedules being run so that they can finish before returning.
+	runs := &pool.Group{}
+
+	switch cronConfig.Source {
+	case "", SourceSearch:
+		// The duration of the search interval.
+		interval, err := time.ParseDuration(cronConfig.SearchInterval)
+		if err != nil {
+			return err
+		}
+		backoffMax, err := config.ParseSearchBackoffMax(cronConfig.SearchBackoffMax)
+		if err != nil {
+			return err
+		}
+		backoff := searchBackoff{
+			max:    backoffMax,
+			jitter: cronConfig.SearchJitterFraction(),
+		}
 
-	// Search for candidate Schedules; it could be from a variety of sources.
-	go search(schedules, &cronConfig)
+		// Channel that receives Schedules that are candidate for triggering.
+		schedules := make(chan schedule.Schedule)
 
-	// Listen to candidate Schedules and send them for execution as they come. We
-	// do this in a goroutine so that we don't block the program yet.
-	go func() {
-		for schedule := range schedules {
-			go run(schedule, triggers, &cronConfig)
+		// Search for candidate Schedules, unless triggering Watches is paused on
+		// the Watch API.
+		paused := func() (bool, error) {
+			return sdk.Paused(sdkConfig)
 		}
-	}()
+		go search(ctx, schedules, scheduleStorage, interval, cronConfig.SearchBatchSize, backoff, paused)
 
-	// Configuration required by the Watch API SDK.
-	// @I Load Watch API SDK configuration from file or command line
-	sdkConfig := sdk.Config{
-		cronConfig.WatchAPI.BaseURL,
-		cronConfig.WatchAPI.Version,
+		// Listen to candidate Schedules and send them for execution as they come.
+		// We do this in a goroutine so that we don't block the program yet.
+		go func() {
+			for schedule := range schedules {
+				schedule := schedule
+				runs.Go(func() {
+					run(ctx, schedule, triggers, scheduleStorage)
+				})
+			}
+		}()
+	case SourcePubSub:
+		// Receive the IDs of the Watches to trigger as they are published.
+		go subscribe(ctx, triggers, redisSubscriber(cronConfig.PubSub), pubSubReconnectDelay)
+	default:
+		return fmt.Errorf("unknown source \"%s\" for the Watches to trigger", cronConfig.Source)
 	}
 
 	// Listen for IDs of Watches that are ready for triggering, and trigger them
-	// as they come. We keep the channel open and the program stays on perpetual.
-	for watchID := range triggers {
-		fmt.Printf("triggering Watch with ID \"%d\"\n", watchID)
-		err := sdk.TriggerByID(watchID, sdkConfig)
-		if err != nil {
-			fmt.Println(err)
+	// as they come, until we are asked to shut down.
+	for {
+		select {
+		case watchID := <-triggers:
+			log.Info("triggering Watch", "watch_id", watchID)
+			err := sdk.TriggerByID(watchID, sdkConfig)
+			if err != nil {
+				log.Error("failed to trigger the Watch", "watch_id", watchID, "err", err)
+			}
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+			defer cancel()
+			return runs.Wait(drainCtx)
 		}
 	}
 }
 
 // search looks for Schedules that are candidate for triggering at regular
 // intervals. It could be from a variety of sources, but for now we only
-// implement search via the Cron component.
-func search(schedules chan<- schedule.Schedule, cronConfig *config.Config) {
+// implement search via the Cron component. It keeps searching until the given
+// context is cancelled, at which point it closes the channel of Schedules.
+// Each search returns at most the given number of candidate Schedules, or all
+// of them if it is 0; the rest are returned by the following searches.
+// Failed searches are logged and retried with the given backoff. Candidate
+// Schedules are not sent while the given function reports that triggering
+// Watches is paused; they are found again as overdue once it is resumed.
+func search(
+	ctx context.Context,
+	schedules chan<- schedule.Schedule,
+	scheduleStorage storage.Storage,
+	interval time.Duration,
+	batchSize int,
+	backoff searchBackoff,
+	paused func() (bool, error),
+) {
 	// @I Support different sources of candidate Schedules configurable via JSON
 	//    or YAML
+	defer close(schedules)
 
-	// Create Redis Storage.
-	storage, err := storage.Create(cronConfig.Storage)
-	if err != nil {
-		panic(err)
+	// Each instance of the component should vary the time between searches
+	// differently.
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// The number of consecutive failed searches.
+	failures := 0
+
+	for {
+		candidateSchedules, err := scheduleStorage.Search(interval, batchSize)
+		if err != nil {
+			failures++
+			log.Error("failed to search for candidate Schedules", "failures", failures, "err", err)
+		} else {
+			failures = 0
+		}
+
+		// We would rather trigger Watches than miss them if we cannot tell
+		// whether triggering is paused; the Watch API does not evaluate them
+		// anyway while paused.
+		if len(candidateSchedules) != 0 {
+			isPaused, err := paused()
+			if err != nil {
+				log.Warn("failed to check whether triggering Watches is paused", "err", err)
+			}
+			if isPaused {
+				log.Info("triggering Watches is paused; skipping the candidate Schedules", "schedules", len(candidateSchedules))
+				candidateSchedules = nil
+			}
+		}
+
+		for _, schedule := range candidateSchedules {
+			select {
+			case schedules <- *schedule:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// Repeat the search after the defined search interval, or later if
+		// searches are failing. The search still covers only the search interval;
+		// Schedules that became due in the meantime are still found as they are
+		// overdue.
+		select {
+		case <-time.After(backoff.delay(interval, failures, random.Float64())):
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	// The duration of the search interval.
-	interval, err := time.ParseDuration(cronConfig.SearchInterval)
+// watchSDKConfig returns the configuration required by the Watch API SDK for
+// triggering Watches, based on the given configuration. Requests are given the
+// configured timeout so that a Watch API that does not respond does not stall
+// triggering the rest of the Watches.
+func watchSDKConfig(cronConfig *config.Config) (sdk.Config, error) {
+	timeout, err := config.ParseTriggerTimeout(cronConfig.TriggerTimeout)
 	if err != nil {
-		panic(err)
+		return sdk.Config{}, err
 	}
 
-	candidateSchedules, err := storage.Search(interval)
-	if err != nil {
-		panic(err)
+	return sdk.Config{
+		BaseURL:   cronConfig.WatchAPI.BaseURL,
+		Version:   cronConfig.WatchAPI.Version,
+		AuthToken: cronConfig.WatchAPI.AuthToken,
+		UserAgent: util.UserAgent("cron"),
+		Timeout:   timeout,
+	}, nil
+}
+
+// searchBackoff defines how the time between searches varies from the search
+// interval.
+type searchBackoff struct {
+	// The maximum time between searches while searches keep failing.
+	max time.Duration
+	// The fraction of the time between searches by which it is randomly varied.
+	jitter float64
+}
+
+// delay returns the time to wait before the next search, given the search
+// interval, the number of consecutive failed searches and a random number in
+// [0, 1). The interval doubles for every failed search up to the maximum
+// backoff, and it is then varied by up to the jitter fraction in either
+// direction.
+func (backoff searchBackoff) delay(interval time.Duration, failures int, random float64) time.Duration {
+	delay := interval
+	for i := 0; i < failures && delay < backoff.max; i++ {
+		delay *= 2
 	}
+	if failures > 0 && delay > backoff.max {
+		delay = backoff.max
+	}
+	// Never wait less than the interval because of the backoff maximum.
+	if delay < interval {
+		delay = interval
+	}
+
+	return time.Duration(float64(delay) * (1 + backoff.jitter*(2*random-1)))
+}
+
+// subscription is the subset of the Redis Pub/Sub client used for receiving
+// the published messages. It allows dependency injection of the subscription,
+// which is necessary for testing purposes.
+type subscription interface {
+	Receive() *pubsub.SubResp
+	Close() error
+}
+
+// subscriber connects to the Pub/Sub server and subscribes to the channel that
+// the Watches to trigger are published on.
+type subscriber func() (subscription, error)
+
+// redisSubscription is a subscription to a Redis Pub/Sub channel that closes
+// the underlying connection when it is closed.
+type redisSubscription struct {
+	*pubsub.SubClient
+}
+
+func (sub redisSubscription) Close() error {
+	return sub.Client.Close()
+}
+
+// redisSubscriber returns a subscriber to the Redis Pub/Sub channel given in
+// the configuration. Connections authenticate and select the database given in
+// the configuration, if any, in the same way as the Storage connections.
+func redisSubscriber(pubSubConfig config.ConfigPubSub) subscriber {
+	return func() (subscription, error) {
+		client, err := redisUtil.Dial(pubSubConfig.DSN, pubSubConfig.Password, pubSubConfig.DB)
+		if err != nil {
+			return nil, err
+		}
+
+		subClient := pubsub.NewSubClient(client)
+		subResp := subClient.Subscribe(pubSubConfig.Channel)
+		if subResp.Err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to subscribe to the Pub/Sub channel \"%s\": %s", pubSubConfig.Channel, subResp.Err.Error())
+		}
+
+		return redisSubscription{subClient}, nil
+	}
+}
+
+// subscribe listens to the Pub/Sub channel and sends the IDs of the Watches
+// contained in the published messages to the channel where they will be queued
+// for triggering. Messages should contain one or more comma-separated Watch
+// IDs; they are triggered in the order they are given, and only once if they
+// are given more than once. When connecting or receiving fails, it reconnects
+// after the given delay. It stops listening when the given context is
+// cancelled.
+func subscribe(ctx context.Context, triggers chan<- int, connect subscriber, reconnectDelay time.Duration) {
+	for {
+		err := listen(ctx, triggers, connect)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Error(
+			"failed to listen to the Pub/Sub channel; reconnecting",
+			"delay", reconnectDelay,
+			"err", err,
+		)
+
+		select {
+		case <-time.After(reconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-	for _, schedule := range candidateSchedules {
-		schedules <- *schedule
+// listen subscribes to the Pub/Sub channel and sends the IDs of the Watches
+// contained in the published messages to the given channel, until receiving
+// fails or the given context is cancelled.
+func listen(ctx context.Context, triggers chan<- int, connect subscriber) error {
+	sub, err := connect()
+	if err != nil {
+		return err
 	}
 
-	// Repeat the search after the defined search interval.
-	time.Sleep(interval)
-	search(schedules, cronConfig)
+	defer sub.Close()
+
+	// Closing the connection unblocks waiting for the next message.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		subResp := sub.Receive()
+		if subResp.Err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if subResp.Timeout() {
+				continue
+			}
+			return fmt.Errorf("failed to receive from the Pub/Sub channel: %s", subResp.Err.Error())
+		}
+
+		// We only care about messages; ignore subscription confirmations.
+		if subResp.Type != pubsub.Message {
+			continue
+		}
+
+		// Do not trigger any Watches if the message contains an invalid ID, in the
+		// same way that the Watch API does.
+		watchesIDs, err := util.StringToIntSlice(subResp.Message, ",")
+		if err != nil {
+			log.Warn(
+				"ignoring message with invalid Watch IDs",
+				"message", subResp.Message,
+				"channel", subResp.Channel,
+				"err", err,
+			)
+			continue
+		}
+
+		for _, watchID := range watchesIDs {
+			select {
+			case triggers <- watchID:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
 }
 
 // run sends the IDs of the Watches to the channel where they will be queued for
-// triggering.
-func run(schedule schedule.Schedule, triggers chan<- int, cronConfig *config.Config) {
+// triggering. It stops sending them if the given context is cancelled.
+func run(
+	ctx context.Context,
+	schedule schedule.Schedule,
+	triggers chan<- int,
+	scheduleStorage storage.Storage,
+) {
 	// @I Investigate throttling architecture and implementation
 
 	watchesIDs := schedule.Do()
@@ -123,31 +463,28 @@ func run(schedule schedule.Schedule, triggers chan<- int, cronConfig *config.Con
 	// If there are Watches to trigger, it means that the Schedule was successful.
 	// We update the current time to be the Schedule's last trigger time.
 	if len(watchesIDs) > 0 {
-		go func() {
-			// Create Redis Storage.
-			// @I Make Redis storage thread safe by using a connection pool instead of
-			//    creating a separate Redis instance
-			storage, err := storage.Create(cronConfig.Storage)
-			if err != nil {
-				panic(err)
-			}
-
-			// @I Update only the individual field instead of the full object.
-			now := time.Now()
-			schedule.Last = &now
-			storage.Update(&schedule, false)
-		}()
+		// @I Update only the individual field instead of the full object.
+		now := time.Now()
+		schedule.Last = &now
+		err := scheduleStorage.Update(&schedule, false)
+		if err != nil {
+			log.Error("failed to update the Schedule's last trigger time", "schedule_id", schedule.ID, "err", err)
+		}
 	}
 
 	for _, ID := range watchesIDs {
-		triggers <- ID
+		select {
+		case triggers <- ID:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
 // loadEphemeralSchedules checks if the storage engine is configured to run in
 // "ephemeral" mode, and if so, it loads into it any Schedules contained in the
 // configuration file.
-func loadEphemeralSchedules(cronConfig *config.Config) {
+func loadEphemeralSchedules(cronConfig *config.Config, scheduleStorage storage.Storage) {
 	// @I Load init Schedules directly in Redis via a script so that services
 	//    don't have to be restarted together
 	mode, ok := cronConfig.Storage["mode"]
@@ -155,15 +492,10 @@ func loadEphemeralSchedules(cronConfig *config.Config) {
 		return
 	}
 
-	storage, err := storage.Create(cronConfig.Storage)
-	if err != nil {
-		panic(err)
-	}
-
 	for _, schedule := range cronConfig.Schedules {
-		_, err := storage.Create(&schedule)
+		_, err := scheduleStorage.Create(&schedule)
 		if err != nil {
-			panic(err)
+			log.Fatal("failed to load the ephemeral Schedules", "err", err)
 		}
 	}
 }
@@ -0,0 +1,570 @@
+/**
+ * Tests for the Cron component.
+ */
+
+package main
+
+import (
+	// Utilities.
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	// Redis.
+	"github.com/mediocregopher/radix.v2/pubsub"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	config "github.com/krystalcode/go-mantis-shrimp/cron/config"
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	sdk "github.com/krystalcode/go-mantis-shrimp/watches/sdk"
+)
+
+/**
+ * Tests.
+ */
+
+func TestSearch_Repeats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scheduleStorage := &TestStorage_Search{
+		schedules: []*schedule.Schedule{{ID: 1}},
+	}
+	schedules := make(chan schedule.Schedule)
+	go search(ctx, schedules, scheduleStorage, 10*time.Millisecond, 0, searchBackoff{}, notPaused)
+
+	// The search should be repeated after every interval, sending the candidate
+	// Schedules found every time.
+	for i := 0; i < 3; i++ {
+		select {
+		case found := <-schedules:
+			assert.Equal(t, 1, found.ID)
+		case <-time.After(time.Second):
+			t.Fatal("the search was not repeated")
+		}
+	}
+	assert.True(t, atomic.LoadInt32(&scheduleStorage.searches) >= 3)
+}
+
+func TestSearch_BatchSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scheduleStorage := &TestStorage_Search{
+		schedules: []*schedule.Schedule{{ID: 1}},
+	}
+	schedules := make(chan schedule.Schedule)
+	go search(ctx, schedules, scheduleStorage, time.Hour, 100, searchBackoff{}, notPaused)
+
+	// The batch size is given to the Storage as the limit of the search.
+	select {
+	case <-schedules:
+	case <-time.After(time.Second):
+		t.Fatal("no Schedule was sent")
+	}
+	assert.Equal(t, int32(100), atomic.LoadInt32(&scheduleStorage.limit))
+}
+
+func TestSearch_ExitsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	scheduleStorage := &TestStorage_Search{}
+	schedules := make(chan schedule.Schedule)
+	go search(ctx, schedules, scheduleStorage, time.Hour, 0, searchBackoff{}, notPaused)
+
+	// Wait for the first search, then cancel while the loop waits for the next
+	// one.
+	for atomic.LoadInt32(&scheduleStorage.searches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	// The loop should exit promptly, closing the channel of Schedules, instead of
+	// waiting for the search interval to pass.
+	select {
+	case _, ok := <-schedules:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("the search loop did not exit after the context was cancelled")
+	}
+}
+
+func TestSearch_ExitsOnCancelWhileSending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Nobody receives the Schedules found, so the loop blocks while sending.
+	scheduleStorage := &TestStorage_Search{
+		schedules: []*schedule.Schedule{{ID: 1}, {ID: 2}},
+	}
+	schedules := make(chan schedule.Schedule)
+	done := make(chan struct{})
+	go func() {
+		search(ctx, schedules, scheduleStorage, time.Hour, 0, searchBackoff{}, notPaused)
+		close(done)
+	}()
+
+	for atomic.LoadInt32(&scheduleStorage.searches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the search loop did not exit after the context was cancelled")
+	}
+}
+
+func TestSearch_BacksOffOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scheduleStorage := &TestStorage_Search{err: fmt.Errorf("the Storage is not available")}
+	schedules := make(chan schedule.Schedule)
+	go search(ctx, schedules, scheduleStorage, 10*time.Millisecond, 0, searchBackoff{max: time.Hour}, notPaused)
+
+	// Without the backoff there would be 20 searches in the time given; with it,
+	// the searches are made after 10ms, 20ms, 40ms, 80ms.
+	time.Sleep(200 * time.Millisecond)
+	searches := atomic.LoadInt32(&scheduleStorage.searches)
+	assert.True(t, searches >= 3, "%d searches were made", searches)
+	assert.True(t, searches <= 6, "%d searches were made", searches)
+}
+
+func TestSearch_Paused(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A Watch API that reports whether triggering is paused.
+	var paused int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/pause", r.URL.Path)
+		fmt.Fprintf(w, `{"status":200,"paused":%t}`, atomic.LoadInt32(&paused) == 1)
+	}))
+	defer server.Close()
+	sdkConfig := sdk.Config{BaseURL: server.URL, Version: "1"}
+
+	scheduleStorage := &TestStorage_Search{
+		schedules: []*schedule.Schedule{{ID: 1}},
+	}
+	schedules := make(chan schedule.Schedule)
+	go search(
+		ctx,
+		schedules,
+		scheduleStorage,
+		10*time.Millisecond,
+		0,
+		searchBackoff{},
+		func() (bool, error) { return sdk.Paused(sdkConfig) },
+	)
+
+	// No Schedules should be sent while paused, even though they are found.
+	select {
+	case <-schedules:
+		t.Fatal("a Schedule was sent while triggering is paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.True(t, atomic.LoadInt32(&scheduleStorage.searches) >= 2)
+
+	// The Schedules should be sent again once resumed.
+	atomic.StoreInt32(&paused, 0)
+	select {
+	case found := <-schedules:
+		assert.Equal(t, 1, found.ID)
+	case <-time.After(time.Second):
+		t.Fatal("no Schedule was sent after triggering was resumed")
+	}
+}
+
+func TestSearch_PausedUnknown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scheduleStorage := &TestStorage_Search{
+		schedules: []*schedule.Schedule{{ID: 1}},
+	}
+	schedules := make(chan schedule.Schedule)
+	paused := func() (bool, error) {
+		return false, fmt.Errorf("the Watch API is not available")
+	}
+	go search(ctx, schedules, scheduleStorage, time.Hour, 0, searchBackoff{}, paused)
+
+	// Schedules are still sent when we cannot tell whether triggering is paused.
+	select {
+	case found := <-schedules:
+		assert.Equal(t, 1, found.ID)
+	case <-time.After(time.Second):
+		t.Fatal("no Schedule was sent")
+	}
+}
+
+func TestSearchBackoff_Escalation(t *testing.T) {
+	backoff := searchBackoff{max: time.Minute}
+	interval := 5 * time.Second
+
+	expected := []time.Duration{
+		5 * time.Second,
+		10 * time.Second,
+		20 * time.Second,
+		40 * time.Second,
+		time.Minute,
+		time.Minute,
+	}
+	for failures, delay := range expected {
+		assert.Equal(t, delay, backoff.delay(interval, failures, 0.5), "%d failures", failures)
+	}
+
+	// Many failures do not overflow the delay.
+	assert.Equal(t, time.Minute, backoff.delay(interval, 1000, 0.5))
+
+	// The delay is reset after a successful search, that is with no failures.
+	assert.Equal(t, interval, backoff.delay(interval, 0, 0.5))
+}
+
+func TestSearchBackoff_MaxBelowInterval(t *testing.T) {
+	backoff := searchBackoff{max: time.Second}
+	assert.Equal(t, 5*time.Second, backoff.delay(5*time.Second, 3, 0.5))
+
+	// No backoff at all.
+	backoff = searchBackoff{}
+	assert.Equal(t, 5*time.Second, backoff.delay(5*time.Second, 3, 0.5))
+}
+
+func TestSearchBackoff_Jitter(t *testing.T) {
+	backoff := searchBackoff{max: time.Minute, jitter: 0.1}
+	interval := 10 * time.Second
+
+	assert.Equal(t, 9*time.Second, backoff.delay(interval, 0, 0))
+	assert.Equal(t, interval, backoff.delay(interval, 0, 0.5))
+	assert.Equal(t, 10500*time.Millisecond, backoff.delay(interval, 0, 0.75))
+
+	// The jitter applies to the backed off delay as well.
+	assert.Equal(t, 54*time.Second, backoff.delay(interval, 5, 0))
+}
+
+func TestWatchSDKConfig_Timeout(t *testing.T) {
+	// A Watch API that does not respond until the test finishes.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cronConfig := &config.Config{
+		WatchAPI: config.ConfigWatchAPI{
+			BaseURL: server.URL,
+			Version: "1",
+		},
+		TriggerTimeout: "100ms",
+	}
+	sdkConfig, err := watchSDKConfig(cronConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, 100*time.Millisecond, sdkConfig.Timeout)
+
+	// The trigger should fail once the timeout passes.
+	started := time.Now()
+	err = sdk.TriggerByID(1, sdkConfig)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(started) < time.Second, "the trigger took %s", time.Since(started))
+}
+
+func TestWatchSDKConfig_DefaultTimeout(t *testing.T) {
+	sdkConfig, err := watchSDKConfig(&config.Config{})
+	assert.Nil(t, err)
+	assert.Equal(t, config.TriggerTimeoutDefault, sdkConfig.Timeout)
+	assert.Equal(t, util.UserAgent("cron"), sdkConfig.UserAgent)
+
+	_, err = watchSDKConfig(&config.Config{TriggerTimeout: "soon"})
+	assert.NotNil(t, err)
+}
+
+func TestStart_StopsOnSignal(t *testing.T) {
+	ctx, cancel := util.ShutdownContext()
+	defer cancel()
+
+	cronConfig := &config.Config{SearchInterval: "1h"}
+	scheduleStorage := &TestStorage_Search{}
+	done := make(chan error, 1)
+	go func() {
+		done <- start(ctx, cronConfig, scheduleStorage, time.Second)
+	}()
+
+	for atomic.LoadInt32(&scheduleStorage.searches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	assert.Nil(t, err)
+
+	// The program should stop cleanly when asked to shut down.
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the program did not stop after receiving a termination signal")
+	}
+}
+
+func TestStart_UnknownSource(t *testing.T) {
+	cronConfig := &config.Config{Source: "kafka"}
+	err := start(context.Background(), cronConfig, &TestStorage_Search{}, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestRun_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Nobody receives the IDs of the Watches to trigger.
+	triggers := make(chan int)
+	schedule := schedule.Schedule{
+		WatchesIDs: []int{1, 2},
+		Enabled:    true,
+	}
+	done := make(chan struct{})
+	go func() {
+		run(ctx, schedule, triggers, &TestStorage_Search{})
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("running the Schedule did not stop after the context was cancelled")
+	}
+}
+
+func TestSubscribe_Order(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := newTestSubscription()
+	triggers := make(chan int)
+	go subscribe(ctx, triggers, testSubscriber(sub), time.Millisecond)
+
+	// Subscription confirmations are ignored, and the Watches are triggered in
+	// the order they are given, only once.
+	sub.responses <- &pubsub.SubResp{Type: pubsub.Subscribe, Channel: "watches"}
+	sub.responses <- testMessage("3, 1,3,2")
+	sub.responses <- testMessage("4")
+	assert.Equal(t, []int{3, 1, 2, 4}, testReceiveTriggers(t, triggers, 4))
+}
+
+func TestSubscribe_InvalidMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := newTestSubscription()
+	triggers := make(chan int)
+	go subscribe(ctx, triggers, testSubscriber(sub), time.Millisecond)
+
+	// None of the Watches of a message with an invalid ID are triggered.
+	sub.responses <- testMessage("1,a")
+	sub.responses <- testMessage("")
+	sub.responses <- testMessage("2")
+	assert.Equal(t, []int{2}, testReceiveTriggers(t, triggers, 1))
+}
+
+func TestSubscribe_ReconnectsOnConnectFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Such as when the password is rejected by the server, until it is updated.
+	sub := newTestSubscription()
+	var connects int32
+	connect := func() (subscription, error) {
+		if atomic.AddInt32(&connects, 1) == 1 {
+			return nil, fmt.Errorf("failed to authenticate: ERR invalid password")
+		}
+		return sub, nil
+	}
+	triggers := make(chan int)
+	go subscribe(ctx, triggers, connect, time.Millisecond)
+
+	sub.responses <- testMessage("1")
+	assert.Equal(t, []int{1}, testReceiveTriggers(t, triggers, 1))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connects))
+}
+
+func TestSubscribe_ReconnectsOnReceiveFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := newTestSubscription()
+	second := newTestSubscription()
+	triggers := make(chan int)
+	go subscribe(ctx, triggers, testSubscriber(first, second), time.Millisecond)
+
+	first.responses <- testMessage("1")
+	assert.Equal(t, []int{1}, testReceiveTriggers(t, triggers, 1))
+
+	// The failed subscription should be closed before reconnecting.
+	first.responses <- &pubsub.SubResp{Type: pubsub.Error, Err: io.EOF}
+	second.responses <- testMessage("2")
+	assert.Equal(t, []int{2}, testReceiveTriggers(t, triggers, 1))
+	assert.True(t, first.isClosed())
+	assert.False(t, second.isClosed())
+}
+
+func TestSubscribe_ExitsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sub := newTestSubscription()
+	done := make(chan struct{})
+	go func() {
+		subscribe(ctx, make(chan int), testSubscriber(sub), time.Millisecond)
+		close(done)
+	}()
+
+	// The subscription is closed, which unblocks waiting for the next message,
+	// and it is not reconnected.
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the subscriber did not exit after the context was cancelled")
+	}
+	assert.True(t, sub.isClosed())
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// TestStorage_Search is a Storage engine that returns the same Schedules, or the
+// same error, on every search and counts the searches made. It records the
+// limit given to the last search.
+type TestStorage_Search struct {
+	schedules []*schedule.Schedule
+	err       error
+	searches  int32
+	limit     int32
+}
+
+func (storage *TestStorage_Search) Create(schedule *schedule.Schedule) (*int, error) {
+	return nil, fmt.Errorf("creating Schedules is not supported by the search Storage")
+}
+
+func (storage *TestStorage_Search) Get(id int) (*schedule.Schedule, error) {
+	return nil, fmt.Errorf("getting Schedules is not supported by the search Storage")
+}
+
+func (storage *TestStorage_Search) Exists(id int) (bool, error) {
+	return false, fmt.Errorf("checking whether Schedules exist is not supported by the search Storage")
+}
+
+func (storage *TestStorage_Search) Update(schedule *schedule.Schedule, updateTimestamp bool) error {
+	return fmt.Errorf("updating Schedules is not supported by the search Storage")
+}
+
+func (storage *TestStorage_Search) Delete(id int) error {
+	return fmt.Errorf("deleting Schedules is not supported by the search Storage")
+}
+
+func (storage *TestStorage_Search) Ping() error {
+	return nil
+}
+
+func (storage *TestStorage_Search) Search(pollInterval time.Duration, limit int) ([]*schedule.Schedule, error) {
+	atomic.AddInt32(&storage.searches, 1)
+	atomic.StoreInt32(&storage.limit, int32(limit))
+	if storage.err != nil {
+		return nil, storage.err
+	}
+	return storage.schedules, nil
+}
+
+// notPaused reports that triggering Watches is not paused.
+func notPaused() (bool, error) {
+	return false, nil
+}
+
+// testSubscription is a subscription that receives the responses sent to it,
+// buffering up to 10 of them, and that fails to receive once it is closed, in the same way as a
+// subscription to a Redis server whose connection is closed.
+type testSubscription struct {
+	responses chan *pubsub.SubResp
+	closed    chan struct{}
+	once      sync.Once
+}
+
+func newTestSubscription() *testSubscription {
+	return &testSubscription{
+		responses: make(chan *pubsub.SubResp, 10),
+		closed:    make(chan struct{}),
+	}
+}
+
+func (sub *testSubscription) Receive() *pubsub.SubResp {
+	select {
+	case subResp := <-sub.responses:
+		return subResp
+	case <-sub.closed:
+		return &pubsub.SubResp{Type: pubsub.Error, Err: fmt.Errorf("use of closed network connection")}
+	}
+}
+
+func (sub *testSubscription) Close() error {
+	sub.once.Do(func() {
+		close(sub.closed)
+	})
+	return nil
+}
+
+func (sub *testSubscription) isClosed() bool {
+	select {
+	case <-sub.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// testSubscriber returns a subscriber that returns the given subscriptions in
+// order, one per connection, and that fails once they are exhausted.
+func testSubscriber(subs ...*testSubscription) subscriber {
+	var mutex sync.Mutex
+	return func() (subscription, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(subs) == 0 {
+			return nil, fmt.Errorf("connection refused")
+		}
+		sub := subs[0]
+		subs = subs[1:]
+		return sub, nil
+	}
+}
+
+// testMessage returns a response holding the given message published on the
+// Pub/Sub channel.
+func testMessage(message string) *pubsub.SubResp {
+	return &pubsub.SubResp{Type: pubsub.Message, Channel: "watches", Message: message}
+}
+
+// testReceiveTriggers returns the given number of Watch IDs received on the
+// given channel, failing the test if they are not received in time.
+func testReceiveTriggers(t *testing.T, triggers <-chan int, count int) []int {
+	var watchesIDs []int
+	for len(watchesIDs) < count {
+		select {
+		case watchID := <-triggers:
+			watchesIDs = append(watchesIDs, watchID)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d Watch IDs instead of %d", len(watchesIDs), count)
+		}
+	}
+	return watchesIDs
+}
@@ -2,7 +2,14 @@ package main
 
 import (
 	// Utilities.
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	// Gin
 	gin "gopkg.in/gin-gonic/gin.v1"
@@ -12,6 +19,9 @@ import (
 	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
 	storage "github.com/krystalcode/go-mantis-shrimp/cron/storage"
 	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
 )
 
 /**
@@ -26,31 +36,120 @@ const CronConfigFile = "/etc/mantis-shrimp/cron.config.json"
  * Main program entry.
  */
 func main() {
-	// Load configuration.
-	// @I Support providing configuration file for Cron component via cli options
-	// @I Validate Cron component configuration when loading from JSON file
+	// Load configuration, from the file given via the command line or from the
+	// default location. Secrets can be given via environment variables
+	// referenced in the file.
+	configFile := flag.String(
+		"config",
+		"",
+		"Path to the configuration file (default \""+CronConfigFile+"\")",
+	)
+	// Optionally only check that the service can start, without serving.
+	checkOnly := flag.Bool(
+		"check",
+		false,
+		"Validate the configuration and the connection to the Storage, and exit without serving",
+	)
+	flag.Parse()
+
+	configPath := util.ConfigFilePath(*configFile, CronConfigFile)
+	if *checkOnly {
+		err := check(configPath, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	var cronConfig config.Config
-	err := util.ReadJSONFile(CronConfigFile, &cronConfig)
+	err := util.ReadJSONFileExpandEnv(configPath, &cronConfig)
+	if err != nil {
+		log.Fatal("failed to read the configuration", "err", err)
+	}
+	err = cronConfig.Validate()
 	if err != nil {
-		panic(err)
+		log.Fatal("invalid configuration", "err", err)
 	}
 
-	router := gin.Default()
+	// Log as configured from now on.
+	logger, err := log.New(os.Stderr, cronConfig.Log)
+	if err != nil {
+		log.Fatal("failed to initialize the logger", "err", err)
+	}
+	log.SetDefault(logger.With("service", "cron_api"))
+
+	// Build the Storage engine once so that it is shared by all requests. We
+	// fail early if the Storage cannot be reached.
+	scheduleStorage, err := storage.Create(cronConfig.Storage)
+	if err != nil {
+		log.Fatal("failed to initialize the Storage engine", "err", err)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// Log every request together with an ID that identifies it, and make a
+	// Logger that includes the ID available to the controllers.
+	router.Use(log.Middleware(log.Default()))
+
+	// Limit the size of the request bodies so that large payloads cannot exhaust
+	// the memory of the service. The options have already been validated
+	// together with the rest of the configuration.
+	maxRequestBytes, _, _, err := cronConfig.Server.Parse()
+	if err != nil {
+		log.Fatal("invalid server configuration", "err", err)
+	}
+	router.Use(api.MaxRequestBytes(maxRequestBytes))
+
+	// Report whether the storage is available. It is registered before the
+	// authentication middleware so that it can be used by liveness and
+	// readiness probes without a token.
+	router.GET(api.PathHealth, api.Health(scheduleStorage))
+
+	// Report the build that is running, without requiring a token either.
+	router.GET(api.PathVersion, api.Version)
+
+	// Require callers to authenticate, unless no token is configured.
+	router.Use(api.Authentication(cronConfig.AuthToken))
 
 	// Make storage available to the controllers.
-	router.Use(Storage(cronConfig.Storage))
+	router.Use(Storage(scheduleStorage))
 
 	// Version 1 of the Cron API.
 	v1 := router.Group("/v1")
 	{
 		// Create a new Schedule.
 		v1.POST("/", v1Create)
+
+		// Get a Schedule via its ID. The Schedules that are due within a given
+		// interval are listed at "due" by the same route, since the router does
+		// not allow a static path where the other endpoints have the ID parameter.
+		v1.GET("/:id", v1Get)
+
+		// Update a Schedule via its ID.
+		v1.PUT("/:id", v1Update)
+
+		// Delete a Schedule via its ID.
+		v1.DELETE("/:id", v1Delete)
+	}
+
+	// Serve until we are asked to shut down, and then give the requests in
+	// progress the configured grace period to finish.
+	ctx, cancel := util.ShutdownContext()
+	defer cancel()
+
+	gracePeriod, err := util.ParseGracePeriod(cronConfig.ShutdownGracePeriod)
+	if err != nil {
+		log.Fatal("invalid shutdown grace period", "err", err)
 	}
 
 	/**
 	 * @I Make the trigger API port configurable
 	 */
-	router.Run(":8888")
+	err = api.Serve(ctx, router, ":8888", cronConfig.Server, gracePeriod)
+	if err != nil {
+		log.Fatal("failed to serve the Cron API", "err", err)
+	}
 }
 
 /**
@@ -61,25 +160,30 @@ func main() {
 // object given in the request.
 func v1Create(c *gin.Context) {
 	/**
-	 * @I Implement authentication of the caller
 	 * @I Validate parameters
 	 * @I Ensure the caller has the permissions to create Schedules
-	 * @I Log errors and send a 500 response instead of panicking
 	 */
 
 	// The parameters are provided as a JSON object in the request. Bind it to an
 	// object of the corresponding type.
 	var schedule schedule.Schedule
-	err := c.BindJSON(&schedule)
+	err := api.BindJSON(c, &schedule)
 	if err != nil {
-		panic(err)
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+	err = schedule.Validate()
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
 	}
 
 	// Store the Watch.
 	storage := c.MustGet("storage").(storage.Storage)
 	scheduleID, err := storage.Create(&schedule)
 	if err != nil {
-		panic(err)
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
 	}
 
 	// All good.
@@ -92,19 +196,272 @@ func v1Create(c *gin.Context) {
 	)
 }
 
+// v1Get provides an endpoint that returns the Schedule with the ID given in the
+// request.
+func v1Get(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to view Schedules
+	 */
+
+	if c.Param("id") == "due" {
+		v1Due(c)
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	scheduleStorage := c.MustGet("storage").(storage.Storage)
+	schedule, err := scheduleStorage.Get(id)
+
+	// Return a Not Found response if there is no Schedule with such ID.
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":   http.StatusOK,
+			"schedule": schedule,
+		},
+	)
+}
+
+// v1Due provides an endpoint that lists the Schedules that are candidates for
+// triggering their Watches within the interval given in the request, starting
+// from now. The interval is given as a duration string e.g. "5m". The Schedules
+// are searched for the same way as by the Cron component, but all of them are
+// listed instead of a batch.
+func v1Due(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to view Schedules
+	 */
+
+	interval, err := time.ParseDuration(c.Query("interval"))
+	if err == nil && interval <= 0 {
+		err = fmt.Errorf("the interval must be positive, %s given", interval)
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	scheduleStorage := c.MustGet("storage").(storage.Storage)
+	schedules, err := scheduleStorage.Search(interval, 0)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	// Respond with an empty array rather than null when none is due.
+	if schedules == nil {
+		schedules = []*schedule.Schedule{}
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":    http.StatusOK,
+			"schedules": schedules,
+		},
+	)
+}
+
+// v1Update provides an endpoint that updates the Schedule with the ID given in
+// the request, based on the JSON object given in the request.
+func v1Update(c *gin.Context) {
+	/**
+	 * @I Validate parameters
+	 * @I Ensure the caller has the permissions to update Schedules
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	// The parameters are provided as a JSON object in the request. Bind it to an
+	// object of the corresponding type.
+	var schedule schedule.Schedule
+	err = api.BindJSON(c, &schedule)
+	if err != nil {
+		api.RespondError(c, api.BodyErrorStatus(err), err)
+		return
+	}
+	err = schedule.Validate()
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Return a Not Found response if there is no Schedule with such ID.
+	scheduleStorage := c.MustGet("storage").(storage.Storage)
+	existingSchedule, err := scheduleStorage.Get(id)
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The creation and last trigger times are maintained by the system; keep the
+	// existing ones unless given.
+	// @I Remove optional Schedule fields that are not given in an update request
+	//    instead of keeping their existing values
+	schedule.ID = id
+	if schedule.CreatedAt == nil {
+		schedule.CreatedAt = existingSchedule.CreatedAt
+	}
+	if schedule.Last == nil {
+		schedule.Last = existingSchedule.Last
+	}
+
+	err = scheduleStorage.Update(&schedule, true)
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status": http.StatusOK,
+			"id":     id,
+		},
+	)
+}
+
+// v1Delete provides an endpoint that deletes the Schedule with the ID given in
+// the request.
+func v1Delete(c *gin.Context) {
+	/**
+	 * @I Ensure the caller has the permissions to delete Schedules
+	 */
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"status": http.StatusBadRequest,
+			},
+		)
+		return
+	}
+
+	scheduleStorage := c.MustGet("storage").(storage.Storage)
+	err = scheduleStorage.Delete(id)
+
+	// Return a Not Found response if there is no Schedule with such ID.
+	if errors.Is(err, errorsUtil.ErrNotFound) {
+		c.JSON(
+			http.StatusNotFound,
+			gin.H{
+				"status": http.StatusNotFound,
+			},
+		)
+		return
+	}
+	if err != nil {
+		api.RespondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// All good.
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status": http.StatusOK,
+			"id":     id,
+		},
+	)
+}
+
 /**
  * Middleware.
  */
 
-// Storage is a Gin middleware that makes available the Storage engine to the
-// endpoint controllers.
-func Storage(config map[string]interface{}) gin.HandlerFunc {
+// Storage is a Gin middleware that makes available the given Storage engine to
+// the endpoint controllers.
+func Storage(scheduleStorage storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		storage, err := storage.Create(config)
-		if err != nil {
-			panic(err)
-		}
-		c.Set("storage", storage)
+		c.Set("storage", scheduleStorage)
 		c.Next()
 	}
 }
+
+/**
+ * Functions/types for internal use.
+ */
+
+// check loads and validates the configuration from the given file, builds the
+// Storage engine and checks that it is available, writing the outcome of each
+// step to the given writer. It returns an error if any of the steps fails.
+func check(configPath string, out io.Writer) error {
+	var cronConfig config.Config
+	var scheduleStorage storage.Storage
+
+	return api.Check(
+		out,
+		[]api.CheckStep{
+			{
+				Name: "configuration",
+				Run: func() error {
+					err := util.ReadJSONFileExpandEnv(configPath, &cronConfig)
+					if err != nil {
+						return err
+					}
+					return cronConfig.Validate()
+				},
+			},
+			{
+				Name: "storage",
+				Run: func() error {
+					var err error
+					scheduleStorage, err = storage.Create(cronConfig.Storage)
+					return err
+				},
+			},
+			{
+				Name: "storage ping",
+				Run: func() error {
+					return scheduleStorage.Ping()
+				},
+			},
+		},
+	)
+}
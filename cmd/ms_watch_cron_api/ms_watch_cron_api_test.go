@@ -0,0 +1,330 @@
+/**
+ * Tests for the Cron API.
+ */
+
+package main
+
+import (
+	// Utilities.
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	scheduleStorage "github.com/krystalcode/go-mantis-shrimp/cron/storage"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+)
+
+/**
+ * Tests.
+ */
+
+func TestV1Get_StorageError(t *testing.T) {
+	response := testRequest(TestStorage_Error{}, "GET", "/v1/1", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Create_StorageError(t *testing.T) {
+	response := testRequest(
+		TestStorage_Error{},
+		"POST",
+		"/v1/",
+		`{"interval":60000000000,"watches_ids":[1],"enabled":true}`,
+	)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Update_StorageError(t *testing.T) {
+	response := testRequest(
+		TestStorage_Error{},
+		"PUT",
+		"/v1/1",
+		`{"interval":60000000000,"watches_ids":[1],"enabled":true}`,
+	)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Create_InvalidCronExpr(t *testing.T) {
+	// The Schedule should be rejected before reaching the Storage.
+	response := testRequest(
+		TestStorage_Error{},
+		"POST",
+		"/v1/",
+		`{"cron_expr":"61 * * * *","watches_ids":[1],"enabled":true}`,
+	)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.JSONEq(t, `{"status":400}`, response.Body.String())
+}
+
+func TestV1Get_NotFound(t *testing.T) {
+	response := testRequest(TestStorage_Empty{}, "GET", "/v1/1", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+}
+
+func TestV1Update_NotFound(t *testing.T) {
+	response := testRequest(
+		TestStorage_Empty{},
+		"PUT",
+		"/v1/1",
+		`{"interval":60000000000,"watches_ids":[1],"enabled":true}`,
+	)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+}
+
+func TestV1Delete(t *testing.T) {
+	response := testRequest(TestStorage_Empty{}, "DELETE", "/v1/1", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"status":404}`, response.Body.String())
+
+	response = testRequest(TestStorage_Error{}, "DELETE", "/v1/1", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+
+	response = testRequest(TestStorage_Error{}, "DELETE", "/v1/schedule", "")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.JSONEq(t, `{"status":400}`, response.Body.String())
+}
+
+func TestV1Due(t *testing.T) {
+	start := time.Date(2017, 4, 12, 0, 0, 0, 0, time.UTC)
+	storage := &TestStorage_Due{
+		schedules: []*schedule.Schedule{
+			{ID: 3, Interval: util.Duration{Duration: time.Minute}, WatchesIDs: []int{1}, Enabled: true},
+			{ID: 7, Start: &start, Interval: util.Duration{Duration: time.Hour}, WatchesIDs: []int{2, 3}, Enabled: true},
+		},
+	}
+
+	response := testRequest(storage, "GET", "/v1/due?interval=5m", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 5*time.Minute, storage.interval)
+
+	var decoded struct {
+		Status    int                  `json:"status"`
+		Schedules []*schedule.Schedule `json:"schedules"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, decoded.Status)
+	assert.Len(t, decoded.Schedules, 2)
+	assert.Equal(t, 3, decoded.Schedules[0].ID)
+	assert.Equal(t, 7, decoded.Schedules[1].ID)
+	assert.Equal(t, []int{2, 3}, decoded.Schedules[1].WatchesIDs)
+	assert.True(t, start.Equal(*decoded.Schedules[1].Start))
+
+	// No Schedules are due.
+	response = testRequest(TestStorage_Empty{}, "GET", "/v1/due?interval=1s", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200,"schedules":[]}`, response.Body.String())
+
+	response = testRequest(TestStorage_Error{}, "GET", "/v1/due?interval=1s", "")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+}
+
+func TestV1Due_InvalidInterval(t *testing.T) {
+	for _, query := range []string{"", "?interval=", "?interval=5", "?interval=soon", "?interval=-5m"} {
+		response := testRequest(TestStorage_Empty{}, "GET", "/v1/due"+query, "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, query)
+		assert.JSONEq(t, `{"status":400}`, response.Body.String(), query)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	response := testRequest(TestStorage_Empty{}, "GET", "/health", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+
+	response = testRequest(TestStorage_Error{}, "GET", "/health", "")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.JSONEq(t, `{"status":503,"error":"the Storage is not available"}`, response.Body.String())
+}
+
+func TestCheck(t *testing.T) {
+	scheduleStorage.RegisterStorageFactory(
+		"test_check_memory",
+		func(config map[string]interface{}) (scheduleStorage.Storage, error) {
+			return TestStorage_Empty{}, nil
+		},
+	)
+	scheduleStorage.RegisterStorageFactory(
+		"test_check_unavailable",
+		func(config map[string]interface{}) (scheduleStorage.Storage, error) {
+			return TestStorage_Error{}, nil
+		},
+	)
+
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{`{"watch_api":{"base_url":"http://ms-watch-api:8888","version":"1"},"search_interval":"10s","storage":{"type":"test_check_memory"}}`, ""},
+		{`{"watch_api":{"base_url":"http://ms-watch-api:8888","version":"1"},"storage":{"type":"test_check_memory"}}`, `the "configuration" step failed: invalid Cron component configuration: the "search_interval" option is required`},
+		{`{"watch_api":{"base_url":"http://ms-watch-api:8888","version":"1"},"search_interval":"10s","storage":{"type":"test_check_unknown"}}`, `the "storage" step failed: unknown storage engine "test_check_unknown": unknown type`},
+		{`{"watch_api":{"base_url":"http://ms-watch-api:8888","version":"1"},"search_interval":"10s","storage":{"type":"test_check_unavailable"}}`, `the "storage ping" step failed: the Storage is not available`},
+	}
+	for index, c := range cases {
+		configPath, cleanup := testConfigFile(t, c.config)
+		var out bytes.Buffer
+		err := check(configPath, &out)
+		cleanup()
+
+		if c.err == "" {
+			assert.Nil(t, err, "case %d", index)
+			assert.Contains(t, out.String(), "all 3 steps passed", "case %d", index)
+			continue
+		}
+		assert.EqualError(t, err, c.err, "case %d", index)
+		assert.Contains(t, out.String(), "the check failed", "case %d", index)
+	}
+
+	// The configuration file must exist.
+	err := check("/nonexistent/config.json", ioutil.Discard)
+	assert.NotNil(t, err)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testConfigFile writes the given configuration to a temporary file. It returns
+// the path to the file and a function that removes it.
+func testConfigFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "ms_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(configPath, []byte(content), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return configPath, func() { os.RemoveAll(dir) }
+}
+
+// testRequest makes a request to a router that has the Cron API endpoints
+// registered and that makes the given Storage available to them.
+func testRequest(storage interface{}, method string, url string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("storage", storage)
+		c.Next()
+	})
+
+	router.GET(api.PathHealth, api.Health(storage.(api.Pinger)))
+
+	v1 := router.Group("/v1")
+	{
+		v1.POST("/", v1Create)
+		v1.GET("/:id", v1Get)
+		v1.PUT("/:id", v1Update)
+		v1.DELETE("/:id", v1Delete)
+	}
+
+	request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+// TestStorage_Error is a Storage engine that fails on every operation.
+type TestStorage_Error struct{}
+
+func (storage TestStorage_Error) Create(schedule *schedule.Schedule) (*int, error) {
+	return nil, fmt.Errorf("an error has occurred while creating the Schedule")
+}
+
+func (storage TestStorage_Error) Get(id int) (*schedule.Schedule, error) {
+	return nil, fmt.Errorf("an error has occurred while getting the Schedule")
+}
+
+func (storage TestStorage_Error) Exists(id int) (bool, error) {
+	return false, fmt.Errorf("an error has occurred while checking whether the Schedule exists")
+}
+
+func (storage TestStorage_Error) Update(schedule *schedule.Schedule, updateTimestamp bool) error {
+	return fmt.Errorf("an error has occurred while updating the Schedule")
+}
+
+func (storage TestStorage_Error) Delete(id int) error {
+	return fmt.Errorf("an error has occurred while deleting the Schedule")
+}
+
+func (storage TestStorage_Error) Ping() error {
+	return fmt.Errorf("the Storage is not available")
+}
+
+func (storage TestStorage_Error) Search(pollInterval time.Duration, limit int) ([]*schedule.Schedule, error) {
+	return nil, fmt.Errorf("an error has occurred while searching for Schedules")
+}
+
+// TestStorage_Empty is a Storage engine that holds no Schedules.
+type TestStorage_Empty struct{}
+
+func (storage TestStorage_Empty) Create(schedule *schedule.Schedule) (*int, error) {
+	id := 1
+	return &id, nil
+}
+
+func (storage TestStorage_Empty) Get(id int) (*schedule.Schedule, error) {
+	return nil, scheduleStorage.ErrNotFound
+}
+
+func (storage TestStorage_Empty) Exists(id int) (bool, error) {
+	return false, nil
+}
+
+func (storage TestStorage_Empty) Update(schedule *schedule.Schedule, updateTimestamp bool) error {
+	return nil
+}
+
+func (storage TestStorage_Empty) Delete(id int) error {
+	return scheduleStorage.ErrNotFound
+}
+
+func (storage TestStorage_Empty) Search(pollInterval time.Duration, limit int) ([]*schedule.Schedule, error) {
+	return []*schedule.Schedule{}, nil
+}
+
+func (storage TestStorage_Empty) Ping() error {
+	return nil
+}
+
+// TestStorage_Due is a Storage engine that returns the given Schedules when
+// searched, recording the interval that it was searched with.
+type TestStorage_Due struct {
+	TestStorage_Empty
+
+	schedules []*schedule.Schedule
+	interval  time.Duration
+}
+
+func (storage *TestStorage_Due) Search(pollInterval time.Duration, limit int) ([]*schedule.Schedule, error) {
+	storage.interval = pollInterval
+	return storage.schedules, nil
+}
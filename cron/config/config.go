@@ -5,22 +5,220 @@
 package msCronConfig
 
 import (
+	// Utilities.
+	"fmt"
+	"strings"
+	"time"
+
 	// Internal dependencies.
 	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
 )
 
+/**
+ * Constants.
+ */
+
+// SearchJitterDefault holds the fraction of the search interval by which the
+// time between searches is randomly varied, if none is given in the
+// configuration.
+const SearchJitterDefault = 0.1
+
+// TriggerTimeoutDefault holds the time given to requests that trigger Watches
+// via the Watch API to complete, if none is given in the configuration.
+const TriggerTimeoutDefault = 10 * time.Second
+
+// SearchBackoffMaxDefault holds the maximum time between searches while
+// searches keep failing, if none is given in the configuration.
+const SearchBackoffMaxDefault = time.Minute
+
+/**
+ * Types and their functions.
+ */
+
 // Config holds the configuration required for the Cron component.
 type Config struct {
 	// Configuration required for the Watch API SDK.
 	WatchAPI ConfigWatchAPI `json:"watch_api"`
+	// The source of the Watches to trigger; either "search" (default) for
+	// searching the Storage for candidate Schedules at regular intervals, or
+	// "pubsub" for triggering the Watches named in messages published by an
+	// external scheduler.
+	Source string `json:"source"`
 	// The search interval.
 	SearchInterval string `json:"search_interval"`
+	// The fraction of the search interval by which the time between searches is
+	// randomly varied e.g. 0.1 for ±10%, so that multiple instances of the
+	// component do not search in lockstep. Defaults to SearchJitterDefault; 0
+	// disables it.
+	SearchJitter *float64 `json:"search_jitter"`
+	// The maximum time between searches while searches keep failing, as a
+	// duration string e.g. "1m". The time between searches doubles after every
+	// failed search up to this maximum, and it is reset after a successful
+	// search. Defaults to SearchBackoffMaxDefault.
+	SearchBackoffMax string `json:"search_backoff_max"`
+	// The maximum number of candidate Schedules processed per search, so that a
+	// large number of Schedules becoming due together does not overwhelm the
+	// component. The rest of the Schedules are processed by the following
+	// searches. Defaults to 0, for no limit.
+	SearchBatchSize int `json:"search_batch_size"`
+	// The time given to requests that trigger Watches via the Watch API to
+	// complete, as a duration string e.g. "10s". Defaults to
+	// TriggerTimeoutDefault.
+	TriggerTimeout string `json:"trigger_timeout"`
+	// Configuration required for the "pubsub" source.
+	PubSub ConfigPubSub `json:"pubsub"`
+	// The token that callers of the API must provide as a bearer token for
+	// authentication. Authentication is disabled when empty.
+	AuthToken string `json:"auth_token"`
+	// The configuration for the HTTP server that serves the API, such as the
+	// maximum size of the request bodies. Defaults are used when not given.
+	Server api.ServerConfig `json:"server"`
+	// The time given to the service to finish any work in progress when asked to
+	// shut down, as a duration string e.g. "30s". Defaults to 10 seconds.
+	ShutdownGracePeriod string `json:"shutdown_grace_period"`
+	// The logging configuration.
+	Log log.Config `json:"log"`
 	// The Storage configuration.
 	Storage map[string]interface{} `json:"storage"`
 	// Schedules to be loaded in the case of using ephemeral storage.
 	Schedules []schedule.Schedule `json:"schedules"`
 }
 
+// Validate checks that all required configuration options are given and that
+// they have valid values. All problems found are reported together in the
+// returned error.
+func (config Config) Validate() error {
+	var errs []string
+
+	if config.WatchAPI.BaseURL == "" {
+		errs = append(errs, "the \"watch_api.base_url\" option is required")
+	}
+	if config.WatchAPI.Version == "" {
+		errs = append(errs, "the \"watch_api.version\" option is required")
+	}
+	if storageType, ok := config.Storage["type"].(string); !ok || storageType == "" {
+		errs = append(errs, "the \"storage.type\" option is required")
+	}
+	if err := config.Log.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"log\" options are not valid: %s", err.Error()))
+	}
+	if err := config.Server.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"server\" options are not valid: %s", err.Error()))
+	}
+	if _, err := ParseTriggerTimeout(config.TriggerTimeout); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"trigger_timeout\" option is not valid: %s", err.Error()),
+		)
+	}
+	if _, err := util.ParseGracePeriod(config.ShutdownGracePeriod); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"shutdown_grace_period\" option is not valid: %s", err.Error()),
+		)
+	}
+
+	switch config.Source {
+	case "", "search":
+		if config.SearchInterval == "" {
+			errs = append(errs, "the \"search_interval\" option is required")
+		} else if _, err := time.ParseDuration(config.SearchInterval); err != nil {
+			errs = append(
+				errs,
+				fmt.Sprintf("the \"search_interval\" option is not a valid duration: %s", err.Error()),
+			)
+		}
+		if jitter := config.SearchJitterFraction(); jitter < 0 || jitter >= 1 {
+			errs = append(errs, "the \"search_jitter\" option must be at least 0 and less than 1")
+		}
+		if _, err := ParseSearchBackoffMax(config.SearchBackoffMax); err != nil {
+			errs = append(
+				errs,
+				fmt.Sprintf("the \"search_backoff_max\" option is not valid: %s", err.Error()),
+			)
+		}
+		if config.SearchBatchSize < 0 {
+			errs = append(errs, "the \"search_batch_size\" option cannot be negative")
+		}
+	case "pubsub":
+		if config.PubSub.DSN == "" {
+			errs = append(errs, "the \"pubsub.dsn\" option is required")
+		}
+		if config.PubSub.Channel == "" {
+			errs = append(errs, "the \"pubsub.channel\" option is required")
+		}
+		if config.PubSub.DB < 0 {
+			errs = append(errs, "the \"pubsub.db\" option cannot be negative")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("unknown source \"%s\"", config.Source))
+	}
+
+	for i, schedule := range config.Schedules {
+		if err := schedule.Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("schedule %d: %s", i, err.Error()))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid Cron component configuration: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// SearchJitterFraction returns the configured fraction of the search interval by
+// which the time between searches is randomly varied, or the default fraction
+// if none is given.
+func (config Config) SearchJitterFraction() float64 {
+	if config.SearchJitter == nil {
+		return SearchJitterDefault
+	}
+
+	return *config.SearchJitter
+}
+
+// ParseSearchBackoffMax converts the maximum time between failed searches, as
+// given in the configuration, to a duration. The default maximum is returned if
+// none is given.
+func ParseSearchBackoffMax(value string) (time.Duration, error) {
+	if value == "" {
+		return SearchBackoffMaxDefault, nil
+	}
+
+	backoffMax, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if backoffMax < 0 {
+		return 0, fmt.Errorf("the maximum backoff cannot be negative")
+	}
+
+	return backoffMax, nil
+}
+
+// ParseTriggerTimeout converts the time given to requests that trigger Watches,
+// as given in the configuration, to a duration. The default timeout is returned
+// if none is given.
+func ParseTriggerTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return TriggerTimeoutDefault, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("the timeout must be positive")
+	}
+
+	return timeout, nil
+}
+
 // ConfigWatchAPI holds the configuration required for making calls to the Watch
 // API.
 type ConfigWatchAPI struct {
@@ -28,4 +226,21 @@ type ConfigWatchAPI struct {
 	BaseURL string `json:"base_url"`
 	// The API version.
 	Version string `json:"version"`
+	// The token used to authenticate with the API, if it requires
+	// authentication.
+	AuthToken string `json:"auth_token"`
+}
+
+// ConfigPubSub holds the configuration required for subscribing to the Redis
+// Pub/Sub channel where an external scheduler publishes the Watches to trigger.
+type ConfigPubSub struct {
+	// The DSN of the Redis server.
+	DSN string `json:"dsn"`
+	// The channel to subscribe to.
+	Channel string `json:"channel"`
+	// The password to authenticate with, if the server requires
+	// authentication.
+	Password string `json:"password"`
+	// The index of the database to select; defaults to 0.
+	DB int `json:"db"`
 }
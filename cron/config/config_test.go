@@ -0,0 +1,192 @@
+/**
+ * Tests for the msCronConfig module.
+ */
+
+package msCronConfig
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"time"
+
+	// Internal dependencies.
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+)
+
+/**
+ * Tests.
+ */
+
+func TestValidate_Success(t *testing.T) {
+	config := testConfig()
+	assert.Nil(t, config.Validate())
+}
+
+func TestValidate_MissingOptions(t *testing.T) {
+	config := Config{}
+	err := config.Validate()
+	assert.EqualError(
+		t,
+		err,
+		"invalid Cron component configuration: "+
+			"the \"watch_api.base_url\" option is required; "+
+			"the \"watch_api.version\" option is required; "+
+			"the \"storage.type\" option is required; "+
+			"the \"search_interval\" option is required",
+	)
+}
+
+func TestValidate_InvalidSearchInterval(t *testing.T) {
+	config := testConfig()
+	config.SearchInterval = "ten seconds"
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(
+		t,
+		err.Error(),
+		"invalid Cron component configuration: the \"search_interval\" option is not a valid duration",
+	)
+}
+
+func TestValidate_SearchBackoff(t *testing.T) {
+	config := testConfig()
+	jitter := 0.25
+	config.SearchJitter = &jitter
+	config.SearchBackoffMax = "5m"
+	assert.Nil(t, config.Validate())
+
+	jitter = 1
+	config.SearchBackoffMax = "-1m"
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the \"search_jitter\" option must be at least 0 and less than 1")
+	assert.Contains(t, err.Error(), "the \"search_backoff_max\" option is not valid")
+}
+
+func TestValidate_SearchBatchSize(t *testing.T) {
+	config := testConfig()
+	config.SearchBatchSize = 500
+	assert.Nil(t, config.Validate())
+
+	config.SearchBatchSize = -1
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the \"search_batch_size\" option cannot be negative")
+}
+
+func TestSearchJitterFraction(t *testing.T) {
+	config := testConfig()
+	assert.Equal(t, SearchJitterDefault, config.SearchJitterFraction())
+
+	// Jitter can be disabled.
+	jitter := 0.0
+	config.SearchJitter = &jitter
+	assert.Equal(t, 0.0, config.SearchJitterFraction())
+}
+
+func TestParseSearchBackoffMax(t *testing.T) {
+	backoffMax, err := ParseSearchBackoffMax("")
+	assert.Nil(t, err)
+	assert.Equal(t, SearchBackoffMaxDefault, backoffMax)
+
+	backoffMax, err = ParseSearchBackoffMax("30s")
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, backoffMax)
+
+	_, err = ParseSearchBackoffMax("soon")
+	assert.NotNil(t, err)
+}
+
+func TestParseTriggerTimeout(t *testing.T) {
+	timeout, err := ParseTriggerTimeout("")
+	assert.Nil(t, err)
+	assert.Equal(t, TriggerTimeoutDefault, timeout)
+
+	timeout, err = ParseTriggerTimeout("2s")
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, timeout)
+
+	for _, value := range []string{"soon", "0s", "-1s"} {
+		_, err = ParseTriggerTimeout(value)
+		assert.NotNil(t, err, value)
+	}
+
+	config := testConfig()
+	config.TriggerTimeout = "0s"
+	err = config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the \"trigger_timeout\" option is not valid")
+}
+
+func TestValidate_PubSub(t *testing.T) {
+	config := testConfig()
+	config.Source = "pubsub"
+	config.SearchInterval = ""
+	err := config.Validate()
+	assert.EqualError(
+		t,
+		err,
+		"invalid Cron component configuration: "+
+			"the \"pubsub.dsn\" option is required; "+
+			"the \"pubsub.channel\" option is required",
+	)
+
+	config.PubSub = ConfigPubSub{
+		DSN:     "redis:6379",
+		Channel: "watches",
+	}
+	assert.Nil(t, config.Validate())
+
+	config.PubSub.Password = "secret"
+	config.PubSub.DB = 2
+	assert.Nil(t, config.Validate())
+
+	config.PubSub.DB = -1
+	err = config.Validate()
+	assert.EqualError(t, err, "invalid Cron component configuration: the \"pubsub.db\" option cannot be negative")
+}
+
+func TestValidate_UnknownSource(t *testing.T) {
+	config := testConfig()
+	config.Source = "kafka"
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Cron component configuration: unknown source \"kafka\"")
+}
+
+func TestValidate_InvalidServer(t *testing.T) {
+	config := testConfig()
+	config.Server = api.ServerConfig{MaxRequestBytes: -1}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Cron component configuration: the \"server\" options are not valid: the maximum request size cannot be negative")
+}
+
+func TestValidate_InvalidSchedule(t *testing.T) {
+	config := testConfig()
+	config.Schedules = []schedule.Schedule{
+		{CronExpr: "*/5 * * * *"},
+		{CronExpr: "61 * * * *"},
+	}
+	err := config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "schedule 1: invalid cron expression \"61 * * * *\"")
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testConfig generates a valid configuration object.
+func testConfig() Config {
+	return Config{
+		WatchAPI: ConfigWatchAPI{
+			BaseURL: "http://ms-watch-api:8888",
+			Version: "1",
+		},
+		SearchInterval: "10s",
+		Storage:        map[string]interface{}{"type": "redis"},
+	}
+}
@@ -6,9 +6,35 @@ package msCronSchedule
 
 import (
 	// Utilities.
+	"fmt"
 	"time"
+
+	// Cron expressions.
+	"github.com/robfig/cron"
+
+	// Internal dependencies.
+	util "github.com/krystalcode/go-mantis-shrimp/util"
 )
 
+/**
+ * Constants.
+ */
+
+// MissedPolicySkip holds the policy of triggering the Watches only once when
+// the Schedule becomes due, no matter how many times they were missed since
+// they were last triggered e.g. while the cron was not running. It is the
+// default policy.
+const MissedPolicySkip = "skip"
+
+// MissedPolicyCatchUp holds the policy of triggering the Watches once for every
+// time they were missed since they were last triggered.
+const MissedPolicyCatchUp = "catchup"
+
+// MissedFiresMax holds the maximum number of times that the Watches are
+// triggered in one go when catching up, so that a long gap does not flood the
+// Watch API.
+const MissedFiresMax = 100
+
 /**
  * Public API.
  */
@@ -23,8 +49,19 @@ type Schedule struct {
 	Start *time.Time `json:"start"`
 	Stop  *time.Time `json:"stop"`
 
-	// How frequently the Watches should be triggered.
-	Interval time.Duration `json:"interval"`
+	// How frequently the Watches should be triggered. It can be given in JSON
+	// either as a duration string e.g. "5m" or as a number of nanoseconds; it is
+	// encoded as a number of nanoseconds.
+	Interval util.Duration `json:"interval"`
+
+	// When the Watches should be triggered, given as a standard cron expression
+	// with five fields e.g. "0 */5 * * *". It takes precedence over the Interval
+	// when given.
+	CronExpr string `json:"cron_expr"`
+
+	// What to do when the Watches were missed more than once since they were
+	// last triggered; one of "skip" or "catchup". Defaults to "skip".
+	MissedPolicy string `json:"missed_policy"`
 
 	// The last time the Watches were triggered.
 	Last *time.Time
@@ -41,7 +78,9 @@ type Schedule struct {
 }
 
 // Do ensures that any additional conditions are met before triggering the
-// Watches. It returns the IDs of the Watches that should be triggered.
+// Watches. It returns the IDs of the Watches that should be triggered. When
+// catching up on missed triggers, the IDs are repeated once for every time
+// that the Watches should be triggered.
 func (schedule Schedule) Do() []int {
 	// Make sure that we are within the time frame of the schedule.
 	// This filtering is also done by the search function that fetches the
@@ -50,9 +89,128 @@ func (schedule Schedule) Do() []int {
 	now := time.Now()
 	afterStart := schedule.Start == nil || now.After(*schedule.Start)
 	beforeEnd := schedule.Stop == nil || now.Before(*schedule.Stop)
-	if afterStart && beforeEnd && schedule.Enabled {
+	if !afterStart || !beforeEnd || !schedule.Enabled || !schedule.due(now) {
+		return nil
+	}
+
+	fires := schedule.fires(now)
+	if fires == 1 {
 		return schedule.WatchesIDs
 	}
 
+	watchesIDs := make([]int, 0, fires*len(schedule.WatchesIDs))
+	for i := 0; i < fires; i++ {
+		watchesIDs = append(watchesIDs, schedule.WatchesIDs...)
+	}
+	return watchesIDs
+}
+
+// Validate checks that the Schedule's fields hold valid values.
+func (schedule Schedule) Validate() error {
+	switch schedule.MissedPolicy {
+	case "", MissedPolicySkip, MissedPolicyCatchUp:
+	default:
+		return fmt.Errorf("invalid missed policy \"%s\"", schedule.MissedPolicy)
+	}
+
+	if schedule.CronExpr == "" {
+		return nil
+	}
+
+	_, err := cron.ParseStandard(schedule.CronExpr)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression \"%s\": %s", schedule.CronExpr, err.Error())
+	}
+
 	return nil
 }
+
+// Next returns the first time matching the Schedule's cron expression after
+// the Watches were last triggered. If they have never been triggered, the time
+// is calculated from when the Schedule was created, or from its start time,
+// or from now if neither is known. It returns nil if the Schedule does not
+// have a cron expression.
+func (schedule Schedule) Next() (*time.Time, error) {
+	if schedule.CronExpr == "" {
+		return nil, nil
+	}
+
+	expr, err := cron.ParseStandard(schedule.CronExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	var reference time.Time
+	switch {
+	case schedule.Last != nil:
+		reference = *schedule.Last
+	case schedule.CreatedAt != nil:
+		reference = *schedule.CreatedAt
+	case schedule.Start != nil:
+		reference = *schedule.Start
+	default:
+		reference = time.Now()
+	}
+
+	next := expr.Next(reference)
+	return &next, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// due checks whether the Watches should be triggered at the given time. For
+// Schedules with a cron expression, that is when a time matching the expression
+// has passed since the Watches were last triggered. Since Schedules are searched
+// for once per poll window, this means that the Watches are triggered within
+// the poll window following the time matching the expression. Schedules without
+// a cron expression are due when their Interval has passed since the Watches
+// were last triggered, or when they have never been triggered.
+func (schedule Schedule) due(now time.Time) bool {
+	if schedule.CronExpr == "" {
+		return schedule.Last == nil || now.Sub(*schedule.Last) >= schedule.Interval.Duration
+	}
+
+	next, err := schedule.Next()
+	if err != nil {
+		return false
+	}
+
+	return !next.After(now)
+}
+
+// fires calculates how many times the Watches should be triggered at the given
+// time, given that the Schedule is due. That is once, unless the Schedule
+// catches up on missed triggers; in that case, it is the number of Intervals,
+// or of times matching the cron expression, that have passed since the Watches
+// were last triggered, up to MissedFiresMax.
+func (schedule Schedule) fires(now time.Time) int {
+	if schedule.MissedPolicy != MissedPolicyCatchUp || schedule.Last == nil {
+		return 1
+	}
+
+	fires := 0
+	if schedule.CronExpr == "" {
+		if schedule.Interval.Duration <= 0 {
+			return 1
+		}
+		fires = int(now.Sub(*schedule.Last) / schedule.Interval.Duration)
+	} else {
+		expr, err := cron.ParseStandard(schedule.CronExpr)
+		if err != nil {
+			return 1
+		}
+		for next := expr.Next(*schedule.Last); !next.After(now) && fires < MissedFiresMax; next = expr.Next(next) {
+			fires++
+		}
+	}
+
+	switch {
+	case fires < 1:
+		return 1
+	case fires > MissedFiresMax:
+		return MissedFiresMax
+	}
+	return fires
+}
@@ -0,0 +1,301 @@
+/**
+ * Tests for the msCronSchedule module.
+ */
+
+package msCronSchedule
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"encoding/json"
+	"time"
+
+	// Internal dependencies.
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+)
+
+/**
+ * Tests.
+ */
+
+func TestNext_Expressions(t *testing.T) {
+	cases := []struct {
+		expr string
+		last string
+		next string
+	}{
+		// Every minute.
+		{"* * * * *", "2017-06-16T10:02:30Z", "2017-06-16T10:03:00Z"},
+		// Step.
+		{"*/5 * * * *", "2017-06-16T10:02:00Z", "2017-06-16T10:05:00Z"},
+		{"0 */6 * * *", "2017-06-16T10:02:00Z", "2017-06-16T12:00:00Z"},
+		// Range; Friday evening to Monday morning.
+		{"0 9-17 * * 1-5", "2017-06-16T17:30:00Z", "2017-06-19T09:00:00Z"},
+		// Step within a range.
+		{"0 0-12/4 * * *", "2017-06-16T04:10:00Z", "2017-06-16T08:00:00Z"},
+		// List.
+		{"15,45 * * * *", "2017-06-16T10:20:00Z", "2017-06-16T10:45:00Z"},
+		// Monthly.
+		{"30 2 1 * *", "2017-06-16T10:00:00Z", "2017-07-01T02:30:00Z"},
+	}
+
+	for _, c := range cases {
+		last := testTime(c.last)
+		schedule := Schedule{CronExpr: c.expr, Last: &last}
+
+		next, err := schedule.Next()
+		assert.Nil(t, err, c.expr)
+		if assert.NotNil(t, next, c.expr) {
+			assert.True(t, testTime(c.next).Equal(*next), "%s: expected %s, got %s", c.expr, c.next, next)
+		}
+	}
+}
+
+func TestNext_Reference(t *testing.T) {
+	createdAt := testTime("2017-06-16T10:02:00Z")
+	last := testTime("2017-06-16T11:02:00Z")
+
+	// The creation time is used if the Watches have never been triggered.
+	schedule := Schedule{CronExpr: "*/5 * * * *", CreatedAt: &createdAt}
+	next, err := schedule.Next()
+	assert.Nil(t, err)
+	assert.True(t, testTime("2017-06-16T10:05:00Z").Equal(*next))
+
+	// The last trigger time has priority.
+	schedule.Last = &last
+	next, err = schedule.Next()
+	assert.Nil(t, err)
+	assert.True(t, testTime("2017-06-16T11:05:00Z").Equal(*next))
+}
+
+func TestNext_NoCronExpr(t *testing.T) {
+	schedule := Schedule{Interval: util.Duration{Duration: time.Minute}}
+	next, err := schedule.Next()
+	assert.Nil(t, err)
+	assert.Nil(t, next)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Schedule{}.Validate())
+	assert.Nil(t, Schedule{CronExpr: "0 9-17 * * 1-5"}.Validate())
+	assert.NotNil(t, Schedule{CronExpr: "61 * * * *"}.Validate())
+	assert.NotNil(t, Schedule{CronExpr: "* * *"}.Validate())
+}
+
+func TestDue(t *testing.T) {
+	last := testTime("2017-06-16T10:02:00Z")
+	schedule := Schedule{CronExpr: "*/5 * * * *", Last: &last}
+
+	// Not due before the time matching the expression, due after it.
+	assert.False(t, schedule.due(testTime("2017-06-16T10:04:59Z")))
+	assert.True(t, schedule.due(testTime("2017-06-16T10:05:00Z")))
+	assert.True(t, schedule.due(testTime("2017-06-16T10:05:30Z")))
+
+	// Schedules without a cron expression that have never been triggered are
+	// due.
+	assert.True(t, Schedule{Interval: util.Duration{Duration: time.Minute}}.due(last))
+}
+
+func TestDue_Interval(t *testing.T) {
+	last := testTime("2017-06-16T10:02:00Z")
+	cases := []struct {
+		last     *time.Time
+		interval time.Duration
+		now      string
+		due      bool
+	}{
+		// First run.
+		{nil, time.Minute, "2017-06-16T10:02:00Z", true},
+		{nil, 0, "2017-06-16T10:02:00Z", true},
+		// The Interval has not passed yet.
+		{&last, time.Minute, "2017-06-16T10:02:00Z", false},
+		{&last, time.Minute, "2017-06-16T10:02:59Z", false},
+		{&last, time.Hour, "2017-06-16T10:59:00Z", false},
+		// The Interval has passed.
+		{&last, time.Minute, "2017-06-16T10:03:00Z", true},
+		{&last, time.Minute, "2017-06-16T10:10:00Z", true},
+		{&last, time.Hour, "2017-06-16T11:02:00Z", true},
+		// No Interval.
+		{&last, 0, "2017-06-16T10:02:00Z", true},
+	}
+
+	for index, c := range cases {
+		schedule := Schedule{Interval: util.Duration{Duration: c.interval}, Last: c.last}
+		assert.Equal(t, c.due, schedule.due(testTime(c.now)), "case %d", index)
+	}
+}
+
+func TestDo_Interval(t *testing.T) {
+	schedule := Schedule{
+		Interval:   util.Duration{Duration: time.Minute},
+		WatchesIDs: []int{1, 2},
+		Enabled:    true,
+	}
+	assert.Equal(t, []int{1, 2}, schedule.Do())
+
+	// The Interval has not passed since the last trigger.
+	last := time.Now().Add(-30 * time.Second)
+	schedule.Last = &last
+	assert.Nil(t, schedule.Do())
+
+	last = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, []int{1, 2}, schedule.Do())
+
+	// The start/stop window is still taken into account.
+	stop := time.Now().Add(-time.Second)
+	schedule.Stop = &stop
+	assert.Nil(t, schedule.Do())
+}
+
+func TestDo_CronExpr(t *testing.T) {
+	last := time.Now().Add(-2 * time.Minute)
+	schedule := Schedule{
+		CronExpr:   "* * * * *",
+		Last:       &last,
+		WatchesIDs: []int{1, 2},
+		Enabled:    true,
+	}
+	assert.Equal(t, []int{1, 2}, schedule.Do())
+
+	// A time matching the expression has not passed since the last trigger.
+	last = time.Now()
+	schedule.CronExpr = "0 0 1 1 *"
+	assert.Nil(t, schedule.Do())
+
+	// Disabled Schedules are never triggered.
+	last = time.Now().Add(-2 * time.Minute)
+	schedule.CronExpr = "* * * * *"
+	schedule.Enabled = false
+	assert.Nil(t, schedule.Do())
+}
+
+func TestDo_Enabled(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	schedule := Schedule{
+		Start:      &start,
+		Interval:   util.Duration{Duration: time.Minute},
+		WatchesIDs: []int{1, 2},
+		Enabled:    true,
+	}
+	assert.Equal(t, []int{1, 2}, schedule.Do())
+
+	// Disabled Schedules are never triggered, even when they are within their
+	// time frame.
+	schedule.Enabled = false
+	assert.Nil(t, schedule.Do())
+}
+
+func TestDo_MissedPolicy_Interval(t *testing.T) {
+	// The Watches were last triggered 10 Intervals ago and a half.
+	last := time.Now().Add(-10*time.Minute - 30*time.Second)
+	schedule := Schedule{
+		Interval:   util.Duration{Duration: time.Minute},
+		Last:       &last,
+		WatchesIDs: []int{1, 2},
+		Enabled:    true,
+	}
+
+	// Skipping is the default.
+	assert.Equal(t, []int{1, 2}, schedule.Do())
+	schedule.MissedPolicy = MissedPolicySkip
+	assert.Equal(t, []int{1, 2}, schedule.Do())
+
+	schedule.MissedPolicy = MissedPolicyCatchUp
+	watchesIDs := schedule.Do()
+	assert.Len(t, watchesIDs, 20)
+	assert.Equal(t, []int{1, 2, 1, 2}, watchesIDs[:4])
+
+	// Triggered once if they have never been triggered before.
+	schedule.Last = nil
+	assert.Equal(t, []int{1, 2}, schedule.Do())
+}
+
+func TestDo_MissedPolicy_CronExpr(t *testing.T) {
+	last := testTime("2017-06-16T10:02:00Z")
+	schedule := Schedule{CronExpr: "*/5 * * * *", Last: &last}
+
+	// 10:05, 10:10, ..., 11:00.
+	now := testTime("2017-06-16T11:03:00Z")
+	assert.Equal(t, 1, schedule.fires(now))
+	schedule.MissedPolicy = MissedPolicyCatchUp
+	assert.Equal(t, 12, schedule.fires(now))
+
+	// Exactly at a time matching the expression.
+	assert.Equal(t, 1, schedule.fires(testTime("2017-06-16T10:05:00Z")))
+}
+
+func TestDo_MissedPolicy_Max(t *testing.T) {
+	last := time.Now().Add(-24 * time.Hour)
+	schedule := Schedule{
+		Interval:     util.Duration{Duration: time.Minute},
+		Last:         &last,
+		MissedPolicy: MissedPolicyCatchUp,
+		WatchesIDs:   []int{1},
+		Enabled:      true,
+	}
+	assert.Len(t, schedule.Do(), MissedFiresMax)
+
+	schedule.Interval.Duration = 0
+	schedule.CronExpr = "* * * * *"
+	assert.Len(t, schedule.Do(), MissedFiresMax)
+}
+
+func TestValidate_MissedPolicy(t *testing.T) {
+	assert.Nil(t, Schedule{MissedPolicy: MissedPolicySkip}.Validate())
+	assert.Nil(t, Schedule{MissedPolicy: MissedPolicyCatchUp}.Validate())
+	assert.NotNil(t, Schedule{MissedPolicy: "all"}.Validate())
+}
+
+func TestUnmarshalJSON_Interval(t *testing.T) {
+	cases := map[string]time.Duration{
+		`"5m"`:         5 * time.Minute,
+		`"1h30m"`:      90 * time.Minute,
+		`300000000000`: 5 * time.Minute,
+	}
+	for interval, expected := range cases {
+		var schedule Schedule
+		err := json.Unmarshal([]byte(`{"id":1,"interval":`+interval+`,"watches_ids":[1,2],"enabled":true}`), &schedule)
+		assert.Nil(t, err, interval)
+		assert.Equal(t, expected, schedule.Interval.Duration, interval)
+
+		// The rest of the fields are decoded as usual.
+		assert.Equal(t, 1, schedule.ID)
+		assert.Equal(t, []int{1, 2}, schedule.WatchesIDs)
+		assert.True(t, schedule.Enabled)
+	}
+
+	var schedule Schedule
+	err := json.Unmarshal([]byte(`{"interval":"often"}`), &schedule)
+	assert.NotNil(t, err)
+}
+
+func TestMarshalJSON_Interval(t *testing.T) {
+	// The Interval is encoded as a number of nanoseconds, which can be decoded
+	// back.
+	original := Schedule{Interval: util.Duration{Duration: 90 * time.Minute}, CronExpr: "* * * * *"}
+	jsonSchedule, err := json.Marshal(original)
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonSchedule), `"interval":5400000000000`)
+
+	var decoded Schedule
+	err = json.Unmarshal(jsonSchedule, &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, original.Interval.Duration, decoded.Interval.Duration)
+	assert.Equal(t, original.CronExpr, decoded.CronExpr)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testTime parses the given time in RFC3339 format.
+func testTime(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -0,0 +1,290 @@
+/**
+ * Provides a BoltDB storage adapter for storing and retrieving Schedules.
+ *
+ * It stores Schedules in a file on the local filesystem, and it is intended for
+ * single-node deployments where running a Redis server is not necessary.
+ */
+
+package msCronStorage
+
+import (
+	// Utilities
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// BoltDB.
+	bolt "go.etcd.io/bbolt"
+
+	// Internal dependencies.
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	boltUtil "github.com/krystalcode/go-mantis-shrimp/util/bolt"
+)
+
+/**
+ * Constants.
+ */
+
+// boltSchedulesBucket holds the name of the bucket that Schedules are stored
+// in, keyed by their IDs.
+var boltSchedulesBucket = []byte("schedules")
+
+/**
+ * Bolt storage provider.
+ */
+
+// Bolt implements the Storage interface, allowing to use BoltDB as a Storage
+// engine.
+type Bolt struct {
+	db *bolt.DB
+
+	// Where the next batch of candidate Schedules starts from.
+	searchCursor *searchCursor
+}
+
+// Make sure that the Bolt storage engine conforms to the Storage interface.
+var _ Storage = Bolt{}
+
+// Create implements Storage.Create(). It stores the given Schedule object in
+// the Bolt Storage and it returns an automatically generated ID.
+func (storage Bolt) Create(schedule *schedule.Schedule) (*int, error) {
+	// Set the CreatedAt field, if not yet set.
+	now := time.Now()
+	if schedule.CreatedAt == nil {
+		schedule.CreatedAt = &now
+	}
+
+	// Generate the ID and store the Schedule in the same transaction, so that no
+	// ID is used up if the Schedule cannot be stored.
+	var scheduleID int
+	err := storage.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSchedulesBucket)
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		scheduleID = int(sequence)
+
+		// Set the new ID in the corresponding Schedule field.
+		schedule.ID = scheduleID
+
+		return storage.set(bucket, schedule, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduleID, nil
+}
+
+// Get implements Storage.Get(). It retrieves from Storage and returns the
+// Schedule for the given ID, or ErrNotFound if there is no Schedule with such
+// ID.
+func (storage Bolt) Get(scheduleID int) (*schedule.Schedule, error) {
+	var schedule *schedule.Schedule
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltSchedulesBucket).Get(boltUtil.Key(scheduleID))
+		if value == nil {
+			return ErrNotFound
+		}
+
+		var err error
+		schedule, err = fromBoltValue(scheduleID, value)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// Exists implements Storage.Exists(). It returns whether a Schedule with the
+// given ID exists in the Storage, without loading it.
+func (storage Bolt) Exists(scheduleID int) (bool, error) {
+	exists := false
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(boltSchedulesBucket).Get(boltUtil.Key(scheduleID)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Update implements Storage.Update(). It stores the given Schedule object in
+// the Bolt Storage, overriding the existing value with the Schedule's ID.
+func (storage Bolt) Update(schedule *schedule.Schedule, updateTimestamp bool) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		return storage.set(tx.Bucket(boltSchedulesBucket), schedule, updateTimestamp)
+	})
+}
+
+// Delete implements Storage.Delete(). It removes from the Storage the Schedule
+// with the given ID, or it returns ErrNotFound if there is no Schedule with
+// such ID.
+func (storage Bolt) Delete(scheduleID int) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSchedulesBucket)
+		key := boltUtil.Key(scheduleID)
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+// Ping implements Storage.Ping(). It checks whether the database is still open
+// by starting a read-only transaction.
+func (storage Bolt) Ping() error {
+	return storage.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// Search implements storage.Search(). It search for and returns Schedule
+// objects that are candidates for evaluating and triggering their Watches
+// within the time period starting from now (the moment the function is called)
+// and ending after the given interval. Disabled Schedules are never returned.
+// At most the given number of Schedules are returned, or all of them if the
+// limit is 0; the following searches continue with the rest of the Schedules.
+func (storage Bolt) Search(pollInterval time.Duration, limit int) ([]*schedule.Schedule, error) {
+	return storage.searchCursor.search(limit, func(after int) ([]*schedule.Schedule, error) {
+		return storage.search(time.Now(), pollInterval, after, limit)
+	})
+}
+
+// NewBoltStorage implements the StorageFactory function type. It opens the Bolt
+// database stored at the file defined in the given configuration, and it
+// returns the Storage engine object. The Storage engine can be shared by
+// concurrent requests.
+var NewBoltStorage = func(config map[string]interface{}) (Storage, error) {
+	db, err := boltUtil.Open(config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = boltUtil.CreateBucket(db, boltSchedulesBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return Bolt{db: db, searchCursor: &searchCursor{}}, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// set stores a Schedule object as a JSON value in the given bucket at the key
+// corresponding to the Schedule's ID.
+func (storage Bolt) set(bucket *bolt.Bucket, schedule *schedule.Schedule, updateTimestamp bool) error {
+	// Update the UpdatedAt field.
+	if updateTimestamp {
+		now := time.Now()
+		schedule.UpdatedAt = &now
+	}
+
+	jsonSchedule, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(boltUtil.Key(schedule.ID), jsonSchedule)
+}
+
+// search searches for and returns the Schedules that are candidates for
+// evaluating and triggering their Watches within the time period starting from
+// the given time and ending after the given interval. There are no indexes to
+// search with; all Schedules are loaded and filtered the same way as the Redis
+// search script does. At most the given number of Schedules are returned, or
+// all of them if the limit is 0, in the order of their IDs starting after the
+// given ID and continuing from the beginning.
+func (storage Bolt) search(
+	start time.Time,
+	pollInterval time.Duration,
+	after int,
+	limit int,
+) ([]*schedule.Schedule, error) {
+	// End time for the search.
+	stop := start.Add(pollInterval)
+
+	schedules := []*schedule.Schedule{}
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSchedulesBucket).ForEach(func(key []byte, value []byte) error {
+			schedule, err := fromBoltValue(boltUtil.ID(key), value)
+			if err != nil {
+				return err
+			}
+
+			if isCandidate(schedule, start, stop) {
+				schedules = append(schedules, schedule)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The Schedules are iterated in the order of their IDs since the keys are
+	// the big-endian encoded IDs. Continue with the Schedules after the given
+	// ID, and then with the Schedules from the beginning.
+	for index, candidate := range schedules {
+		if candidate.ID > after {
+			rotated := make([]*schedule.Schedule, 0, len(schedules))
+			rotated = append(rotated, schedules[index:]...)
+			schedules = append(rotated, schedules[:index]...)
+			break
+		}
+	}
+	if limit > 0 && len(schedules) > limit {
+		schedules = schedules[:limit]
+	}
+
+	return schedules, nil
+}
+
+// isCandidate returns whether the given Schedule is a candidate for triggering
+// its Watches within the polling interval between the given start and stop
+// times. That is when the Schedule:
+//   - is enabled,
+//   - has started before the end of the interval, if it has a start time,
+//   - has not stopped before the start of the interval, if it has a stop time,
+//   - has passed the next time matching its cron expression, if it has one,
+//   - otherwise, has its next trigger time, as indicated by its last trigger time
+//     and its trigger interval, within the interval.
+func isCandidate(schedule *schedule.Schedule, start time.Time, stop time.Time) bool {
+	if !schedule.Enabled {
+		return false
+	}
+	if schedule.Start != nil && !schedule.Start.Before(stop) {
+		return false
+	}
+	if schedule.Stop != nil && schedule.Stop.Before(start) {
+		return false
+	}
+
+	if schedule.CronExpr != "" {
+		next, err := schedule.Next()
+		return err == nil && !next.After(start)
+	}
+
+	return schedule.Last == nil || schedule.Last.Add(schedule.Interval.Duration).Before(stop)
+}
+
+// fromBoltValue converts the JSON value stored for the Schedule with the given
+// ID into a Schedule object.
+func fromBoltValue(scheduleID int, value []byte) (*schedule.Schedule, error) {
+	var schedule schedule.Schedule
+	err := json.Unmarshal(value, &schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the Schedule with ID %d: %s", scheduleID, err.Error())
+	}
+	schedule.ID = scheduleID
+
+	return &schedule, nil
+}
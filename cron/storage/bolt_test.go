@@ -0,0 +1,231 @@
+/**
+ * Tests for the Bolt storage engine of the msCronStorage module.
+ */
+
+package msCronStorage
+
+import (
+	// Utilities.
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+)
+
+// testBoltStorage creates a Bolt Storage engine stored in a new temporary file.
+// It returns a function that removes the file.
+func testBoltStorage(t *testing.T) (Bolt, func()) {
+	dir, err := ioutil.TempDir("", "ms_cron_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := Create(map[string]interface{}{
+		"type": "bolt",
+		"path": filepath.Join(dir, "schedules.db"),
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return storage.(Bolt), func() { os.RemoveAll(dir) }
+}
+
+/**
+ * Tests.
+ */
+
+func TestNewBoltStorage_MissingPath(t *testing.T) {
+	_, err := Create(map[string]interface{}{"type": "bolt"})
+	assert.NotNil(t, err)
+}
+
+func TestBolt_CRUD(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	assert.Nil(t, storage.Ping())
+
+	// Create.
+	start := time.Date(2017, 4, 12, 0, 0, 0, 0, time.UTC)
+	schedule := &schedule.Schedule{
+		Start:      &start,
+		Interval:   util.Duration{Duration: time.Minute},
+		WatchesIDs: []int{1, 2},
+		Enabled:    true,
+	}
+	scheduleID, err := storage.Create(schedule)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *scheduleID)
+	assert.Equal(t, 1, schedule.ID)
+	assert.NotNil(t, schedule.CreatedAt)
+	assert.NotNil(t, schedule.UpdatedAt)
+
+	// Get.
+	stored, err := storage.Get(*scheduleID)
+	assert.Nil(t, err)
+	assert.Equal(t, *scheduleID, stored.ID)
+	assert.Equal(t, []int{1, 2}, stored.WatchesIDs)
+	assert.Equal(t, time.Minute, stored.Interval.Duration)
+	assert.True(t, start.Equal(*stored.Start))
+	assert.True(t, stored.Enabled)
+
+	// Exists.
+	exists, err := storage.Exists(*scheduleID)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	// Update, without updating the timestamp.
+	updatedAt := *stored.UpdatedAt
+	stored.Enabled = false
+	err = storage.Update(stored, false)
+	assert.Nil(t, err)
+	stored, err = storage.Get(*scheduleID)
+	assert.Nil(t, err)
+	assert.False(t, stored.Enabled)
+	assert.True(t, updatedAt.Equal(*stored.UpdatedAt))
+
+	// Delete.
+	err = storage.Delete(*scheduleID)
+	assert.Nil(t, err)
+	_, err = storage.Get(*scheduleID)
+	assert.Equal(t, ErrNotFound, err)
+	exists, err = storage.Exists(*scheduleID)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	err = storage.Delete(*scheduleID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestBolt_Search(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	now := time.Unix(1497607200, 0)
+	at := func(offset time.Duration) *time.Time {
+		t := now.Add(offset)
+		return &t
+	}
+
+	schedules := map[string]*schedule.Schedule{
+		"no_start_stop":        {},
+		"started":              {Start: at(-time.Hour)},
+		"starts_at_now":        {Start: at(0)},
+		"starts_within_window": {Start: at(30 * time.Second)},
+		"starts_at_window_end": {Start: at(time.Minute)},
+		"starts_after_window":  {Start: at(time.Hour)},
+		"stopped":              {Start: at(-2 * time.Hour), Stop: at(-time.Hour)},
+		"stops_at_now":         {Stop: at(0)},
+		"stops_within_window":  {Stop: at(30 * time.Second)},
+		"disabled":             {Start: at(-time.Hour)},
+		"interval_due":         {Last: at(-30 * time.Second)},
+		"interval_not_due":     {Last: at(0), Interval: util.Duration{Duration: time.Hour}},
+		"cron_due":             {Last: at(-2 * time.Minute), CronExpr: "* * * * *"},
+		"cron_not_due":         {Last: at(0), CronExpr: "* * * * *"},
+	}
+	ids := map[string]int{}
+	for name, schedule := range schedules {
+		schedule.WatchesIDs = []int{1}
+		schedule.Enabled = name != "disabled"
+		if schedule.Interval.Duration == 0 {
+			schedule.Interval.Duration = time.Minute
+		}
+		scheduleID, err := storage.Create(schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = *scheduleID
+	}
+
+	cases := []struct {
+		start        time.Time
+		pollInterval time.Duration
+		expected     []string
+	}{
+		{
+			now,
+			time.Minute,
+			[]string{
+				"no_start_stop",
+				"started",
+				"starts_at_now",
+				"starts_within_window",
+				"stops_at_now",
+				"stops_within_window",
+				"interval_due",
+				"cron_due",
+			},
+		},
+		// A longer poll interval includes the Schedules starting later.
+		{
+			now,
+			2 * time.Hour,
+			[]string{
+				"no_start_stop",
+				"started",
+				"starts_at_now",
+				"starts_within_window",
+				"starts_at_window_end",
+				"starts_after_window",
+				"stops_at_now",
+				"stops_within_window",
+				"interval_due",
+				"interval_not_due",
+				"cron_due",
+			},
+		},
+		// Before any of the Schedules with a start time have started.
+		{
+			now.Add(-3 * time.Hour),
+			time.Minute,
+			[]string{
+				"no_start_stop",
+				"stops_at_now",
+				"stops_within_window",
+			},
+		},
+	}
+
+	for index, c := range cases {
+		found, err := storage.search(c.start, c.pollInterval, 0, 0)
+		assert.Nil(t, err, "case %d", index)
+
+		expectedIDs := []int{}
+		for _, name := range c.expected {
+			expectedIDs = append(expectedIDs, ids[name])
+		}
+		sort.Ints(expectedIDs)
+
+		foundIDs := []int{}
+		for _, schedule := range found {
+			foundIDs = append(foundIDs, schedule.ID)
+		}
+		sort.Ints(foundIDs)
+
+		assert.Equal(t, expectedIDs, foundIDs, "case %d", index)
+	}
+
+	// Deleted Schedules are not found.
+	err := storage.Delete(ids["no_start_stop"])
+	assert.Nil(t, err)
+	found, err := storage.search(now.Add(-3*time.Hour), time.Minute, 0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, found, 2)
+}
+
+func TestBolt_Search_Batches(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	testSearchBatches(t, storage)
+}
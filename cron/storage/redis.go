@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	// Redis.
@@ -19,6 +20,8 @@ import (
 
 	// Internal dependencies.
 	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	redisUtil "github.com/krystalcode/go-mantis-shrimp/util/redis"
 )
 
 /**
@@ -42,21 +45,66 @@ const redisScheduleStopIndex = "schedules_stop_index"
 // stores an index of the IDs for all Schedules.
 const redisScheduleIDIndex = "schedules"
 
+// redisScheduleIDCounter holds the key of the counter that is incremented to
+// generate the IDs of new Schedules.
+const redisScheduleIDCounter = "schedules_next_id"
+
 // redisScheduleSearchScript holds the name of the file that contains the Lua
 // script that searches for and returns Schedules candidate for triggering.
 const redisScheduleSearchScript = "search.lua"
 
+// redisScheduleOptionalFields holds the names of the Hash fields that are only
+// stored when the Schedule has a value for them. They are removed from the Hash
+// when a Schedule is updated without a value for them.
+var redisScheduleOptionalFields = []string{
+	"start",
+	"stop",
+	"last",
+	"cron_expr",
+	"next",
+	"missed_policy",
+}
+
+// errRedisUninitialized is returned when the Storage is used before its Redis
+// client has been initialized.
+var errRedisUninitialized = fmt.Errorf("the Redis client has not been initialized yet: %w", errorsUtil.ErrStorageUninitialized)
+
 /**
  * Redis storage provider.
  */
 
+// RedisClient is an interface that is used to allow dependency injection of the
+// Redis client that makes the requests to the Redis datastore. Dependency
+// injection is necessary for testing purposes.
+type RedisClient interface {
+	Cmd(string, ...interface{}) *redis.Resp
+}
+
 // Redis implements the Storage interface, allowing to use Redis as a Storage
 // engine.
 type Redis struct {
 	dsn    string
-	client *redis.Client
+	client RedisClient
+
+	// The Lua script that searches for Schedules, cached together with its SHA1
+	// hash as known to Redis. It is held by pointer so that it is shared between
+	// copies of the Storage engine.
+	searchScript *searchScript
+	// Where the next batch of candidate Schedules starts from.
+	searchCursor *searchCursor
+}
+
+// searchScript holds the Lua script that searches for Schedules, and the SHA1
+// hash that it can be invoked by after it has been loaded into Redis.
+type searchScript struct {
+	mutex sync.Mutex
+	body  []byte
+	sha   string
 }
 
+// Make sure that the Redis storage engine conforms to the Storage interface.
+var _ Storage = Redis{}
+
 // Create implements Storage.Create(). It stores the given Schedule object as a
 // new Hash in the Redis Storage and it returns an automatically generated ID.
 func (storage Redis) Create(schedule *schedule.Schedule) (*int, error) {
@@ -77,6 +125,13 @@ func (storage Redis) Create(schedule *schedule.Schedule) (*int, error) {
 		return nil, err
 	}
 
+	// Add the new Schedule to the Schedules index set. Updates do not change the
+	// index, so it is only done when creating the Schedule.
+	err = storage.client.Cmd("ZADD", redisScheduleIDIndex, *scheduleID, redisKey(*scheduleID)).Err
+	if err != nil {
+		return nil, err
+	}
+
 	// Set the new ID in the corresponding Schedule field.
 	schedule.ID = *scheduleID
 
@@ -84,10 +139,11 @@ func (storage Redis) Create(schedule *schedule.Schedule) (*int, error) {
 }
 
 // Get implements Storage.Get(). It retrieves from Storage and returns the
-// Schedule for the given ID.
+// Schedule for the given ID, or ErrNotFound if there is no Schedule with such
+// ID.
 func (storage Redis) Get(scheduleID int) (*schedule.Schedule, error) {
 	if storage.client == nil {
-		return nil, fmt.Errorf("trying to get a Schedule from the database while the Redis client has not been initialized yet")
+		return nil, errRedisUninitialized
 	}
 
 	key := redisKey(scheduleID)
@@ -97,17 +153,35 @@ func (storage Redis) Get(scheduleID int) (*schedule.Schedule, error) {
 		return nil, err
 	}
 
+	// There is no Schedule stored for the given ID.
+	if len(hashFields) == 0 {
+		return nil, ErrNotFound
+	}
+
 	// Convert the Redis hash into a Schedule object.
-	schedule, err := fromHashFields(&hashFields)
+	schedule, err := fromHashFields(&hashFields, scheduleID)
 	if err != nil {
 		return nil, err
 	}
 
-	schedule.ID = scheduleID
-
 	return schedule, nil
 }
 
+// Exists implements Storage.Exists(). It returns whether a Schedule with the
+// given ID exists in the Storage, without loading it.
+func (storage Redis) Exists(scheduleID int) (bool, error) {
+	if storage.client == nil {
+		return false, errRedisUninitialized
+	}
+
+	exists, err := storage.client.Cmd("EXISTS", redisKey(scheduleID)).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
 // Update implements Storage.Update(). It stores the given Schedule object as a Hash
 // in the Redis Storage, overriding the existing fields for the Hash with the
 // given ID.
@@ -115,83 +189,79 @@ func (storage Redis) Update(schedule *schedule.Schedule, updateTimestamp bool) e
 	return storage.set(schedule.ID, schedule, updateTimestamp)
 }
 
-// Search implements storage.Search(). It search for and returns Schedule
-// objects that are candidates for evaluating and triggering their Watches
-// within the time period starting from now (the moment the function is called)
-// and ending after the given interval.
-func (storage Redis) Search(pollInterval time.Duration) ([]*schedule.Schedule, error) {
-	script, err := loadSearchScript()
-	if err != nil {
-		return nil, err
+// Delete implements Storage.Delete(). It removes from the Storage the Schedule
+// with the given ID together with its entries in the index sets, or it returns
+// ErrNotFound if there is no Schedule with such ID.
+func (storage Redis) Delete(scheduleID int) error {
+	if storage.client == nil {
+		return errRedisUninitialized
 	}
 
-	// Start and end times for the search.
-	start := time.Now()
-	stop := start.Add(pollInterval)
-
-	// Get candidate Schedules using the Lua script.
-	// @I Store the Lua script in Redis and trigger it by its hash
-	rSchedules, err := storage.client.Cmd(
-		"EVAL",
-		script,
-		2,
-		redisScheduleStartIndex,
-		redisScheduleStopIndex,
-		redisScheduleHashPrefix,
-		start.UnixNano(),
-		stop.UnixNano(),
-	).Array()
+	key := redisKey(scheduleID)
+	deleted, err := storage.client.Cmd("DEL", key).Int()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var hashFields [][]string
-
-	// Unwrap fields from the Redis response.
-	for _, v := range rSchedules {
-		rSchedule, err := v.Array()
-		if err != nil {
-			return nil, err
-		}
+	// Remove the Schedule from the index sets even if its Hash did not exist,
+	// so that entries left behind by a previous failed deletion are cleaned up.
+	err = storage.client.Cmd("ZREM", redisScheduleIDIndex, key).Err
+	if err != nil {
+		return err
+	}
+	err = storage.client.Cmd("ZREM", redisScheduleStartIndex, scheduleID).Err
+	if err != nil {
+		return err
+	}
+	err = storage.client.Cmd("ZREM", redisScheduleStopIndex, scheduleID).Err
+	if err != nil {
+		return err
+	}
 
-		var tmpHashFields []string
+	if deleted == 0 {
+		return ErrNotFound
+	}
 
-		for _, vv := range rSchedule {
-			field, err := vv.Str()
-			if err != nil {
-				return nil, err
-			}
-			tmpHashFields = append(tmpHashFields, field)
-		}
+	return nil
+}
 
-		hashFields = append(hashFields, tmpHashFields)
+// Ping implements Storage.Ping(). It checks whether the Redis server is
+// available by sending it a PING command.
+func (storage Redis) Ping() error {
+	if storage.client == nil {
+		return errRedisUninitialized
 	}
 
-	// Convert the Hash fields into Schedule objects and return them.
-	return fromHashes(hashFields)
+	return storage.client.Cmd("PING").Err
+}
+
+// Search implements storage.Search(). It search for and returns Schedule
+// objects that are candidates for evaluating and triggering their Watches
+// within the time period starting from now (the moment the function is called)
+// and ending after the given interval. Disabled Schedules are never returned.
+// At most the given number of Schedules are returned, or all of them if the
+// limit is 0; the following searches continue with the rest of the Schedules.
+func (storage Redis) Search(pollInterval time.Duration, limit int) ([]*schedule.Schedule, error) {
+	return storage.searchCursor.search(limit, func(after int) ([]*schedule.Schedule, error) {
+		return storage.search(time.Now(), pollInterval, after, limit)
+	})
 }
 
 // NewRedisStorage implements the StorageFactory function type. It initiates a
-// connection to the Redis database defined in the given configuration, and it
-// returns the Storage engine object.
+// pool of connections to the Redis database defined in the given
+// configuration, and it returns the Storage engine object. The Storage engine
+// can be shared by concurrent requests.
 var NewRedisStorage = func(config map[string]interface{}) (Storage, error) {
-	dsn, ok := config["dsn"]
-	if !ok {
-		err := fmt.Errorf("the DSN configuration option is required for the Redis storage")
-		return nil, err
-	}
-
-	sDSN := dsn.(string)
-
-	client, err := redis.Dial("tcp", sDSN)
+	client, err := redisUtil.NewPool(config)
 	if err != nil {
-		err := fmt.Errorf("failed to connect to Redis: %s", err.Error())
 		return nil, err
 	}
 
 	storage := Redis{
-		dsn:    sDSN,
-		client: client,
+		dsn:          config["dsn"].(string),
+		client:       client,
+		searchScript: &searchScript{},
+		searchCursor: &searchCursor{},
 	}
 
 	return storage, nil
@@ -205,7 +275,7 @@ var NewRedisStorage = func(config map[string]interface{}) (Storage, error) {
 // the given ID.
 func (storage Redis) set(scheduleID int, schedule *schedule.Schedule, updateTimestamp bool) error {
 	if storage.client == nil {
-		return fmt.Errorf("the Redis client has not been initialized yet")
+		return errRedisUninitialized
 	}
 
 	// Update the UpdatedAt field.
@@ -215,11 +285,15 @@ func (storage Redis) set(scheduleID int, schedule *schedule.Schedule, updateTime
 	}
 
 	// Convert the Schedule object into the Hash fields that will be stored.
-	fields := toHashFields(schedule)
+	fields, err := toHashFields(schedule)
+	if err != nil {
+		return err
+	}
 
-	// Store the Schedule and update the index sets.
+	// Store the Schedule and update the start and stop time index sets, since
+	// the times may have changed.
 	key := redisKey(scheduleID)
-	err := storage.client.Cmd(
+	err = storage.client.Cmd(
 		"HMSET",
 		key,
 		*fields,
@@ -228,11 +302,15 @@ func (storage Redis) set(scheduleID int, schedule *schedule.Schedule, updateTime
 		return err
 	}
 
-	// Set the ID in the corresponding index.
-	// @I Add the Schedule's ID to the index only when creating it
-	err = storage.client.Cmd("ZADD", redisScheduleIDIndex, scheduleID, key).Err
-	if err != nil {
-		return err
+	// HMSET keeps the fields that it is not given. Remove the optional fields
+	// that the Schedule no longer has, such as the cron expression of a Schedule
+	// updated to use an interval, so that they are not read back.
+	emptyFields := emptyHashFields(fields)
+	if len(emptyFields) != 0 {
+		err = storage.client.Cmd("HDEL", key, emptyFields).Err
+		if err != nil {
+			return err
+		}
 	}
 
 	// Set the start time in the corresponding index.
@@ -252,36 +330,89 @@ func (storage Redis) set(scheduleID int, schedule *schedule.Schedule, updateTime
 	return nil
 }
 
-// generateID generates an ID for a new Schedule by incrementing the last known
-// Schedule ID.
-func (storage Redis) generateID() (*int, error) {
-	// @I Investigate risk of a Schedule overriding another due to race conditions
-	//    when creating them
+// search searches for and returns the Schedules that are candidates for
+// evaluating and triggering their Watches within the time period starting from
+// the given time and ending after the given interval. At most the given number
+// of Schedules are returned, or all of them if the limit is 0, in the order of
+// their IDs starting after the given ID and continuing from the beginning.
+func (storage Redis) search(
+	start time.Time,
+	pollInterval time.Duration,
+	after int,
+	limit int,
+) ([]*schedule.Schedule, error) {
+	// End time for the search.
+	stop := start.Add(pollInterval)
 
-	if storage.client == nil {
-		return nil, fmt.Errorf("the Redis client has not been initialized yet")
+	// Get candidate Schedules using the Lua script.
+	rSchedules, err := storage.evalSearchScript(
+		2,
+		redisScheduleStartIndex,
+		redisScheduleStopIndex,
+		redisScheduleHashPrefix,
+		start.UnixNano(),
+		stop.UnixNano(),
+		after,
+		limit,
+	).Array()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashFields [][]string
+
+	// Unwrap fields from the Redis response.
+	for _, v := range rSchedules {
+		rSchedule, err := v.Array()
+		if err != nil {
+			return nil, err
+		}
+
+		var tmpHashFields []string
+
+		for _, vv := range rSchedule {
+			field, err := vv.Str()
+			if err != nil {
+				return nil, err
+			}
+			tmpHashFields = append(tmpHashFields, field)
+		}
+
+		hashFields = append(hashFields, tmpHashFields)
 	}
 
-	// Get the last ID that exists on the Schedules index set, so that we can
-	// generate the next one.
-	r, err := storage.client.Cmd("ZREVRANGE", redisScheduleIDIndex, 0, 0, "WITHSCORES").List()
+	// Convert the Hash fields into Schedule objects.
+	schedules, err := fromHashes(hashFields)
 	if err != nil {
 		return nil, err
 	}
 
-	// If there are no Schedules yet, start with ID 1.
-	if len(r) == 0 {
-		newScheduleID := 1
-		return &newScheduleID, nil
+	// Disabled Schedules are already filtered out by the search script, but
+	// let's make sure that they are never returned since triggering them would
+	// not be expected.
+	enabledSchedules := []*schedule.Schedule{}
+	for _, schedule := range schedules {
+		if schedule.Enabled {
+			enabledSchedules = append(enabledSchedules, schedule)
+		}
+	}
+
+	return enabledSchedules, nil
+}
+
+// generateID generates an ID for a new Schedule by atomically incrementing the
+// Schedule ID counter, so that concurrent requests never get the same ID.
+func (storage Redis) generateID() (*int, error) {
+	if storage.client == nil {
+		return nil, errRedisUninitialized
 	}
 
-	latestScheduleID, err := strconv.Atoi(r[1])
+	newID, err := redisUtil.NextID(storage.client, redisScheduleIDCounter, redisScheduleIDIndex)
 	if err != nil {
 		return nil, err
 	}
 
-	newScheduleID := latestScheduleID + 1
-	return &newScheduleID, nil
+	return &newID, nil
 }
 
 // redisKey generates a Redis key for the given Schedule's ID.
@@ -291,7 +422,7 @@ func redisKey(scheduleID int) string {
 
 // toHashFields converts a Schedule object into an array of key/value fields
 // ready to be stored in a Redis Hash data structure.
-func toHashFields(schedule *schedule.Schedule) *[]interface{} {
+func toHashFields(schedule *schedule.Schedule) (*[]interface{}, error) {
 	var hashFields []interface{}
 
 	// Mandatory fields.
@@ -321,6 +452,23 @@ func toHashFields(schedule *schedule.Schedule) *[]interface{} {
 		hashFields = append(hashFields, "last")
 		hashFields = append(hashFields, schedule.Last.UnixNano())
 	}
+	// CronExpr. We also store the next time matching the expression, since it
+	// cannot be calculated by the search script.
+	if schedule.CronExpr != "" {
+		next, err := schedule.Next()
+		if err != nil {
+			return nil, err
+		}
+		hashFields = append(hashFields, "cron_expr")
+		hashFields = append(hashFields, schedule.CronExpr)
+		hashFields = append(hashFields, "next")
+		hashFields = append(hashFields, next.UnixNano())
+	}
+	// MissedPolicy.
+	if schedule.MissedPolicy != "" {
+		hashFields = append(hashFields, "missed_policy")
+		hashFields = append(hashFields, schedule.MissedPolicy)
+	}
 	// CreatedAt.
 	if schedule.CreatedAt != nil {
 		hashFields = append(hashFields, "created_at")
@@ -332,12 +480,32 @@ func toHashFields(schedule *schedule.Schedule) *[]interface{} {
 		hashFields = append(hashFields, schedule.UpdatedAt.UnixNano())
 	}
 
-	return &hashFields
+	return &hashFields, nil
+}
+
+// emptyHashFields returns the names of the optional Hash fields that are not
+// included in the given key/value fields, as produced by toHashFields().
+func emptyHashFields(fields *[]interface{}) []interface{} {
+	given := make(map[interface{}]bool)
+	for index := 0; index < len(*fields); index += 2 {
+		given[(*fields)[index]] = true
+	}
+
+	var empty []interface{}
+	for _, name := range redisScheduleOptionalFields {
+		if !given[name] {
+			empty = append(empty, name)
+		}
+	}
+
+	return empty
 }
 
 // fromHashFields converts an array holding the key/value fields of a Redis Hash
-// data structure into a Schedule object.
-func fromHashFields(hash *[]string) (*schedule.Schedule, error) {
+// data structure into a Schedule object. The ID of the Schedule should be given
+// when known, such as when getting an individual Schedule; it is otherwise
+// loaded from the Hash fields.
+func fromHashFields(hash *[]string, scheduleID int) (*schedule.Schedule, error) {
 	kvHash := make(map[string]string)
 	key := ""
 	for _, v := range *hash {
@@ -349,12 +517,12 @@ func fromHashFields(hash *[]string) (*schedule.Schedule, error) {
 		}
 	}
 
-	schedule := schedule.Schedule{}
+	schedule := schedule.Schedule{ID: scheduleID}
 	var err error
 
 	// ID. It is not available as a Hash field when we get the Hash individual,
 	// but we make it available in the Lua script where we return multiple Hashes.
-	if v, ok := kvHash["id"]; ok {
+	if v, ok := kvHash["id"]; ok && scheduleID == 0 {
 		schedule.ID, err = strconv.Atoi(v)
 		if err != nil {
 			return nil, err
@@ -372,11 +540,9 @@ func fromHashFields(hash *[]string) (*schedule.Schedule, error) {
 	if err != nil {
 		return nil, err
 	}
-	schedule.Interval = *interval
+	schedule.Interval.Duration = *interval
 	// Enabled.
-	enabled, err := boolFromHashField(kvHash["enabled"])
-	// @I Add the Schedule's ID to the error message when the enabled field holds
-	//    a wrong value in Redis
+	enabled, err := boolFromHashField(kvHash["enabled"], schedule.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -404,6 +570,14 @@ func fromHashFields(hash *[]string) (*schedule.Schedule, error) {
 			return nil, err
 		}
 	}
+	// CronExpr.
+	if v, ok := kvHash["cron_expr"]; ok {
+		schedule.CronExpr = v
+	}
+	// MissedPolicy.
+	if v, ok := kvHash["missed_policy"]; ok {
+		schedule.MissedPolicy = v
+	}
 	// CreatedAt.
 	if v, ok := kvHash["created_at"]; ok {
 		schedule.CreatedAt, err = timeFromHashField(v)
@@ -423,12 +597,13 @@ func fromHashFields(hash *[]string) (*schedule.Schedule, error) {
 }
 
 // fromHashes converts an array of Redis Hashes (given as an array of strings
-// i.e. array of array of strings) into an array of Schedule objects.
+// i.e. array of array of strings) into an array of Schedule objects. The Hashes
+// should contain the IDs of the Schedules, as returned by the search script.
 func fromHashes(hashes [][]string) ([]*schedule.Schedule, error) {
 	schedules := make([]*schedule.Schedule, len(hashes))
 
 	for i, hash := range hashes {
-		schedule, err := fromHashFields(&hash)
+		schedule, err := fromHashFields(&hash, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -480,15 +655,16 @@ func durationFromHashField(sDuration string) (*time.Duration, error) {
 
 // boolFromHashField converts a string that contains a boolean value as stored
 // in a Redis Hash field into a boolean primitive, as required for storing it as
-// a field in a Schedule object.
-func boolFromHashField(sBool string) (*bool, error) {
+// a field in a Schedule object. The ID of the Schedule is used for reporting
+// invalid values.
+func boolFromHashField(sBool string, scheduleID int) (*bool, error) {
 	var bBool bool
 	if sBool == "1" {
 		bBool = true
 	} else if sBool == "0" {
 		bBool = false
 	} else {
-		return nil, fmt.Errorf("non boolean value stored in the \"enabled\" field for the Schedule with ID")
+		return nil, fmt.Errorf("non boolean value stored in the \"enabled\" field for the Schedule with ID %d", scheduleID)
 	}
 
 	return &bBool, nil
@@ -520,9 +696,47 @@ func timeFromHashField(sTime string) (*time.Time, error) {
 	return &tTime, nil
 }
 
+// evalSearchScript runs the Lua script that searches for candidate Schedules
+// with the given arguments. The script is loaded into Redis the first time it is
+// run and it is invoked by its hash thereafter, so that we don't send the whole
+// script on every search. If Redis does not know the script any more, such as
+// after it has been restarted, the script is sent with EVAL which also loads it
+// again.
+func (storage Redis) evalSearchScript(args ...interface{}) *redis.Resp {
+	script := storage.searchScript
+	if script == nil {
+		script = &searchScript{}
+	}
+
+	script.mutex.Lock()
+	defer script.mutex.Unlock()
+
+	if script.body == nil {
+		body, err := loadSearchScript()
+		if err != nil {
+			return redis.NewResp(err)
+		}
+		script.body = body
+	}
+
+	if script.sha == "" {
+		sha, err := storage.client.Cmd("SCRIPT", "LOAD", script.body).Str()
+		if err != nil {
+			return redis.NewResp(err)
+		}
+		script.sha = sha
+	}
+
+	r := storage.client.Cmd("EVALSHA", append([]interface{}{script.sha}, args...)...)
+	if r.Err != nil && strings.HasPrefix(r.Err.Error(), "NOSCRIPT") {
+		r = storage.client.Cmd("EVAL", append([]interface{}{script.body}, args...)...)
+	}
+
+	return r
+}
+
 // loadSearchScript loads the Lua script that searches for candidate Schedules
-// from the containing file into a string that will be passed to the Redis EVAL
-// command.
+// from the containing file, so that it can be loaded into Redis.
 func loadSearchScript() ([]byte, error) {
 	_, thisFilename, _, _ := runtime.Caller(1)
 	filename := path.Join(path.Dir(thisFilename), redisScheduleSearchScript)
@@ -0,0 +1,256 @@
+//go:build integration
+// +build integration
+
+/**
+ * Integration tests for the Redis storage engine of the msCronStorage module.
+ *
+ * They require a Redis server, given by its DSN in the MS_TEST_REDIS_DSN
+ * environment variable, and they are run with the "integration" build tag:
+ *
+ *   MS_TEST_REDIS_DSN=localhost:6379 go test -tags integration \
+ *     github.com/krystalcode/go-mantis-shrimp/cron/storage
+ *
+ * All Schedules stored on the server are removed by the tests.
+ */
+
+package msCronStorage
+
+import (
+	// Utilities.
+	"os"
+	"sort"
+	"time"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+)
+
+/**
+ * Tests.
+ */
+
+func TestIntegration_Search(t *testing.T) {
+	storage := testIntegrationStorage(t)
+
+	// Timestamps are compared by the search script as floating point numbers;
+	// whole seconds are represented exactly.
+	now := time.Unix(1497607200, 0)
+	at := func(offset time.Duration) *time.Time {
+		t := now.Add(offset)
+		return &t
+	}
+
+	schedules := map[string]*schedule.Schedule{
+		"no_start_stop":        {},
+		"started":              {Start: at(-time.Hour)},
+		"starts_at_now":        {Start: at(0)},
+		"starts_within_window": {Start: at(30 * time.Second)},
+		"starts_at_window_end": {Start: at(time.Minute)},
+		"starts_after_window":  {Start: at(time.Hour)},
+		"stopped":              {Start: at(-2 * time.Hour), Stop: at(-time.Hour)},
+		"stops_at_now":         {Stop: at(0)},
+		"stops_within_window":  {Stop: at(30 * time.Second)},
+		"disabled":             {Start: at(-time.Hour)},
+		"interval_due":         {Last: at(-30 * time.Second)},
+		"interval_not_due":     {Last: at(0), Interval: util.Duration{Duration: time.Hour}},
+		"cron_due":             {Last: at(-2 * time.Minute), CronExpr: "* * * * *"},
+		"cron_not_due":         {Last: at(0), CronExpr: "* * * * *"},
+	}
+	ids := map[string]int{}
+	for name, schedule := range schedules {
+		schedule.WatchesIDs = []int{1}
+		schedule.Enabled = name != "disabled"
+		if schedule.Interval.Duration == 0 {
+			schedule.Interval.Duration = time.Minute
+		}
+		scheduleID, err := storage.Create(schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = *scheduleID
+	}
+
+	cases := []struct {
+		start        time.Time
+		pollInterval time.Duration
+		expected     []string
+	}{
+		{
+			now,
+			time.Minute,
+			[]string{
+				"no_start_stop",
+				"started",
+				"starts_at_now",
+				"starts_within_window",
+				"stops_at_now",
+				"stops_within_window",
+				"interval_due",
+				"cron_due",
+			},
+		},
+		// A longer poll interval includes the Schedules starting later.
+		{
+			now,
+			2 * time.Hour,
+			[]string{
+				"no_start_stop",
+				"started",
+				"starts_at_now",
+				"starts_within_window",
+				"starts_at_window_end",
+				"starts_after_window",
+				"stops_at_now",
+				"stops_within_window",
+				"interval_due",
+				"interval_not_due",
+				"cron_due",
+			},
+		},
+		// Later on, the Schedules that stopped in the meantime are excluded and
+		// the Schedules that were not due yet are included.
+		{
+			now.Add(2 * time.Hour),
+			time.Minute,
+			[]string{
+				"no_start_stop",
+				"started",
+				"starts_at_now",
+				"starts_within_window",
+				"starts_at_window_end",
+				"starts_after_window",
+				"interval_due",
+				"interval_not_due",
+				"cron_due",
+				"cron_not_due",
+			},
+		},
+		// Before any of the Schedules with a start time have started, and before
+		// the Schedules with a last trigger time are due again.
+		{
+			now.Add(-3 * time.Hour),
+			time.Minute,
+			[]string{
+				"no_start_stop",
+				"stops_at_now",
+				"stops_within_window",
+			},
+		},
+	}
+
+	for index, c := range cases {
+		found, err := storage.search(c.start, c.pollInterval, 0, 0)
+		assert.Nil(t, err, "case %d", index)
+
+		expectedIDs := []int{}
+		for _, name := range c.expected {
+			expectedIDs = append(expectedIDs, ids[name])
+		}
+		sort.Ints(expectedIDs)
+
+		foundIDs := []int{}
+		for _, schedule := range found {
+			foundIDs = append(foundIDs, schedule.ID)
+		}
+		sort.Ints(foundIDs)
+
+		assert.Equal(t, expectedIDs, foundIDs, "case %d", index)
+	}
+}
+
+func TestIntegration_Search_SkipsDeletedSchedules(t *testing.T) {
+	storage := testIntegrationStorage(t)
+
+	first := &schedule.Schedule{WatchesIDs: []int{1}, Interval: util.Duration{Duration: time.Minute}, Enabled: true}
+	second := &schedule.Schedule{WatchesIDs: []int{2}, Interval: util.Duration{Duration: time.Minute}, Enabled: true}
+	_, err := storage.Create(first)
+	assert.Nil(t, err)
+	_, err = storage.Create(second)
+	assert.Nil(t, err)
+
+	// Simulate a Schedule whose Hash was removed without its index entries.
+	err = storage.client.Cmd("DEL", redisKey(first.ID)).Err
+	assert.Nil(t, err)
+
+	found, err := storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, second.ID, found[0].ID)
+}
+
+func TestIntegration_Search_UpdatedToInterval(t *testing.T) {
+	storage := testIntegrationStorage(t)
+
+	// A cron Schedule that is not due within the next minute.
+	last := time.Now()
+	original := &schedule.Schedule{WatchesIDs: []int{1}, CronExpr: "0 0 1 1 *", Last: &last, Enabled: true}
+	_, err := storage.Create(original)
+	assert.Nil(t, err)
+	found, err := storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	assert.Len(t, found, 0)
+
+	// Once updated to an interval Schedule, it should be searched as such and
+	// be due.
+	last = time.Now().Add(-time.Hour)
+	original.CronExpr = ""
+	original.Interval = util.Duration{Duration: time.Minute}
+	err = storage.Update(original, true)
+	assert.Nil(t, err)
+
+	found, err = storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, original.ID, found[0].ID)
+		assert.Empty(t, found[0].CronExpr)
+	}
+}
+
+func TestIntegration_Search_Batches(t *testing.T) {
+	testSearchBatches(t, testIntegrationStorage(t))
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testIntegrationStorage returns a Redis Storage engine connected to the Redis
+// server given in the environment, after removing any stored Schedules. The
+// test is skipped if no server is given.
+func testIntegrationStorage(t *testing.T) Redis {
+	dsn := os.Getenv("MS_TEST_REDIS_DSN")
+	if dsn == "" {
+		t.Skip("the MS_TEST_REDIS_DSN environment variable is not set")
+	}
+
+	storage, err := NewRedisStorage(map[string]interface{}{"dsn": dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisStorage := storage.(Redis)
+
+	keys, err := redisStorage.client.Cmd("KEYS", redisScheduleHashPrefix+"*").List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = append(
+		keys,
+		redisScheduleIDIndex,
+		redisScheduleStartIndex,
+		redisScheduleStopIndex,
+		redisScheduleIDCounter,
+	)
+	for _, key := range keys {
+		err = redisStorage.client.Cmd("DEL", key).Err
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return redisStorage
+}
@@ -0,0 +1,611 @@
+/**
+ * Tests for the Redis storage engine of the msCronStorage module.
+ */
+
+package msCronStorage
+
+import (
+	// Utilities.
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	// Redis.
+	"github.com/mediocregopher/radix.v2/redis"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	redisTest "github.com/krystalcode/go-mantis-shrimp/util/redis/redistest"
+)
+
+/**
+ * Tests.
+ */
+
+func TestRedis_ImplementsStorage(t *testing.T) {
+	var storage Storage = Redis{}
+	assert.NotNil(t, storage)
+}
+
+func TestPing(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	assert.Nil(t, storage.Ping())
+
+	storage = Redis{}
+	assert.NotNil(t, storage.Ping())
+}
+
+func TestGet_NotFound(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	schedule, err := storage.Get(1)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, schedule)
+
+	// Errors communicating with Redis should not be reported as a missing
+	// Schedule.
+	storage = Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	_, err = storage.Get(1)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNotFound, err)
+}
+
+func TestExists(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	exists, err := storage.Exists(1)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	scheduleID, err := storage.Create(testSchedule())
+	assert.Nil(t, err)
+	exists, err = storage.Exists(*scheduleID)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	schedule, err := storage.Get(*scheduleID)
+	assert.Nil(t, err)
+	assert.Equal(t, *scheduleID, schedule.ID)
+
+	storage = Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	_, err = storage.Exists(1)
+	assert.NotNil(t, err)
+}
+
+func TestUpdate_IndexedOnlyOnCreate(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+	schedule := testSchedule()
+
+	scheduleID, err := storage.Create(schedule)
+	assert.Nil(t, err)
+	err = storage.Update(schedule, true)
+	assert.Nil(t, err)
+
+	// The start and stop times may change on update, so their index sets are
+	// updated every time.
+	stop := time.Now().Add(time.Hour)
+	schedule.Stop = &stop
+	err = storage.Update(schedule, true)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, client.ZAdds(redisScheduleIDIndex))
+	assert.Equal(t, 3, client.ZAdds(redisScheduleStartIndex))
+	assert.Equal(t, 3, client.ZAdds(redisScheduleStopIndex))
+	assert.Equal(t, stop.UnixNano(), client.Scores(redisScheduleStopIndex)[strconv.Itoa(*scheduleID)])
+	assert.Len(t, client.Scores(redisScheduleIDIndex), 1)
+}
+
+func TestDelete(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+
+	scheduleID, err := storage.Create(testSchedule())
+	assert.Nil(t, err)
+	otherScheduleID, err := storage.Create(testSchedule())
+	assert.Nil(t, err)
+
+	err = storage.Delete(*scheduleID)
+	assert.Nil(t, err)
+
+	exists, err := storage.Exists(*scheduleID)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, err = storage.Get(*scheduleID)
+	assert.Equal(t, ErrNotFound, err)
+
+	// The Schedule should be removed from all index sets, while the other
+	// Schedule should be left in place.
+	sScheduleID := strconv.Itoa(*scheduleID)
+	sOtherScheduleID := strconv.Itoa(*otherScheduleID)
+	assert.NotContains(t, client.Scores(redisScheduleIDIndex), redisKey(*scheduleID))
+	assert.NotContains(t, client.Scores(redisScheduleStartIndex), sScheduleID)
+	assert.NotContains(t, client.Scores(redisScheduleStopIndex), sScheduleID)
+	assert.Contains(t, client.Scores(redisScheduleIDIndex), redisKey(*otherScheduleID))
+	assert.Contains(t, client.Scores(redisScheduleStartIndex), sOtherScheduleID)
+	assert.Contains(t, client.Scores(redisScheduleStopIndex), sOtherScheduleID)
+
+	// Deleting it again should report that it does not exist.
+	err = storage.Delete(*scheduleID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestDelete_CleansUpIndexes(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+
+	// Index entries left behind without the Schedule's Hash are removed.
+	scheduleID, err := storage.Create(testSchedule())
+	assert.Nil(t, err)
+	client.Delete(redisKey(*scheduleID))
+
+	err = storage.Delete(*scheduleID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Empty(t, client.Scores(redisScheduleIDIndex))
+	assert.Empty(t, client.Scores(redisScheduleStartIndex))
+	assert.Empty(t, client.Scores(redisScheduleStopIndex))
+}
+
+func TestDelete_RedisError(t *testing.T) {
+	storage := Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	err := storage.Delete(1)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNotFound, err)
+
+	storage = Redis{}
+	assert.NotNil(t, storage.Delete(1))
+}
+
+func TestGet_Success(t *testing.T) {
+	// Make a stub request to get a Schedule from Redis.
+	storage := Redis{
+		client: &TestRedisClient_RightValueResponse{},
+	}
+	schedule, err := storage.Get(1)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, schedule.ID)
+	assert.Equal(t, []int{1, 2}, schedule.WatchesIDs)
+	assert.Equal(t, time.Minute, schedule.Interval.Duration)
+	assert.True(t, schedule.Enabled)
+	assert.Equal(t, int64(1497607200000000000), schedule.Start.UnixNano())
+	assert.Nil(t, schedule.Stop)
+	assert.Nil(t, schedule.Last)
+}
+
+func TestCreate_Success(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	original := testSchedule()
+
+	scheduleID, err := storage.Create(original)
+	assert.Nil(t, err)
+	assert.Equal(t, *scheduleID, original.ID)
+	assert.NotNil(t, original.CreatedAt)
+	assert.NotNil(t, original.UpdatedAt)
+
+	stored, err := storage.Get(*scheduleID)
+	assert.Nil(t, err)
+	assert.Equal(t, original.WatchesIDs, stored.WatchesIDs)
+	assert.Equal(t, original.Interval.Duration, stored.Interval.Duration)
+	assert.Equal(t, original.Enabled, stored.Enabled)
+	assert.True(t, original.Start.Equal(*stored.Start))
+}
+
+func TestCreate_RedisError(t *testing.T) {
+	storage := Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	scheduleID, err := storage.Create(testSchedule())
+	assert.NotNil(t, err)
+	assert.Nil(t, scheduleID)
+
+	storage = Redis{}
+	_, err = storage.Create(testSchedule())
+	assert.NotNil(t, err)
+}
+
+func TestUpdate_Success(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	original := testSchedule()
+	scheduleID, err := storage.Create(original)
+	assert.Nil(t, err)
+
+	// Update the stored Schedule; it should keep its ID.
+	original.Interval.Duration = time.Hour
+	original.Enabled = false
+	err = storage.Update(original, true)
+	assert.Nil(t, err)
+
+	stored, err := storage.Get(*scheduleID)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, stored.Interval.Duration)
+	assert.False(t, stored.Enabled)
+
+	// No new Schedule should have been created.
+	_, err = storage.Get(*scheduleID + 1)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestUpdate_RemovesEmptyFields(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+	original := testSchedule()
+	original.CronExpr = "*/5 * * * *"
+	original.MissedPolicy = schedule.MissedPolicyCatchUp
+	stop := time.Now().Add(time.Hour)
+	original.Stop = &stop
+	scheduleID, err := storage.Create(original)
+	assert.Nil(t, err)
+	hash := client.Hash(redisKey(*scheduleID))
+	for _, field := range []string{"cron_expr", "next", "missed_policy", "stop"} {
+		assert.Contains(t, hash, field)
+	}
+
+	// Update the cron Schedule to an interval Schedule.
+	original.CronExpr = ""
+	original.MissedPolicy = ""
+	original.Stop = nil
+	original.Interval.Duration = time.Hour
+	err = storage.Update(original, true)
+	assert.Nil(t, err)
+
+	hash = client.Hash(redisKey(*scheduleID))
+	for _, field := range []string{"cron_expr", "next", "missed_policy", "stop"} {
+		assert.NotContains(t, hash, field)
+	}
+	assert.Contains(t, hash, "start")
+
+	stored, err := storage.Get(*scheduleID)
+	assert.Nil(t, err)
+	assert.Empty(t, stored.CronExpr)
+	assert.Empty(t, stored.MissedPolicy)
+	assert.Nil(t, stored.Stop)
+	assert.Equal(t, time.Hour, stored.Interval.Duration)
+}
+
+func TestUpdate_RedisError(t *testing.T) {
+	storage := Redis{
+		client: &TestRedisClient_ErrorResponse{},
+	}
+	assert.NotNil(t, storage.Update(testSchedule(), true))
+
+	storage = Redis{}
+	assert.NotNil(t, storage.Update(testSchedule(), true))
+}
+
+func TestNewRedisStorage_MissingDSN(t *testing.T) {
+	config := map[string]interface{}{"type": "redis"}
+	_, err := Create(config)
+	assert.NotNil(t, err)
+}
+
+func TestCreate_ConcurrentRequestsGetUniqueIDs(t *testing.T) {
+	storage := Redis{
+		client: redisTest.NewClient(),
+	}
+	count := 50
+
+	ids := make(chan int, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduleID, err := storage.Create(testSchedule())
+			assert.Nil(t, err)
+			if err == nil {
+				ids <- *scheduleID
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	uniqueIDs := make(map[int]bool)
+	for id := range ids {
+		uniqueIDs[id] = true
+	}
+	assert.Len(t, uniqueIDs, count)
+}
+
+func TestCreate_SeedsIDCounterFromIndex(t *testing.T) {
+	client := redisTest.NewClient()
+	storage := Redis{
+		client: client,
+	}
+
+	// Simulate a Schedule created before the ID counter was introduced.
+	client.Cmd("ZADD", redisScheduleIDIndex, 5, redisKey(5))
+
+	scheduleID, err := storage.Create(testSchedule())
+	assert.Nil(t, err)
+	assert.Equal(t, 6, *scheduleID)
+}
+
+func TestHashFields_CronExpr(t *testing.T) {
+	createdAt := time.Unix(1497607320, 0)
+	original := testSchedule()
+	original.CronExpr = "*/5 * * * *"
+	original.CreatedAt = &createdAt
+
+	fields, err := toHashFields(original)
+	assert.Nil(t, err)
+
+	// The next time matching the expression should be stored so that the search
+	// script can use it.
+	kvHash := make(map[string]interface{})
+	for i := 0; i < len(*fields); i += 2 {
+		kvHash[(*fields)[i].(string)] = (*fields)[i+1]
+	}
+	next, _ := original.Next()
+	assert.Equal(t, "*/5 * * * *", kvHash["cron_expr"])
+	assert.Equal(t, next.UnixNano(), kvHash["next"])
+
+	// The expression should be loaded back from the Hash.
+	hash := []string{"watches_ids", "1", "interval", "0", "enabled", "1", "cron_expr", "*/5 * * * *"}
+	result, err := fromHashFields(&hash, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "*/5 * * * *", result.CronExpr)
+}
+
+func TestHashFields_MissedPolicy(t *testing.T) {
+	original := testSchedule()
+	original.MissedPolicy = "catchup"
+
+	fields, err := toHashFields(original)
+	assert.Nil(t, err)
+	kvHash := make(map[string]interface{})
+	for i := 0; i < len(*fields); i += 2 {
+		kvHash[(*fields)[i].(string)] = (*fields)[i+1]
+	}
+	assert.Equal(t, "catchup", kvHash["missed_policy"])
+
+	// The policy is not stored when the default is used.
+	fields, err = toHashFields(testSchedule())
+	assert.Nil(t, err)
+	assert.NotContains(t, *fields, "missed_policy")
+
+	hash := []string{"watches_ids", "1", "interval", "0", "enabled", "1", "missed_policy", "catchup"}
+	result, err := fromHashFields(&hash, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "catchup", result.MissedPolicy)
+}
+
+func TestHashFields_InvalidEnabled(t *testing.T) {
+	// The ID is given when getting an individual Schedule.
+	hash := []string{"watches_ids", "1", "interval", "0", "enabled", "x"}
+	_, err := fromHashFields(&hash, 42)
+	assert.EqualError(t, err, "non boolean value stored in the \"enabled\" field for the Schedule with ID 42")
+
+	// The ID is contained in the Hashes returned by the search script.
+	hashes := [][]string{
+		{"watches_ids", "1", "interval", "0", "enabled", "1", "id", "41"},
+		{"watches_ids", "1", "interval", "0", "enabled", "x", "id", "42"},
+	}
+	_, err = fromHashes(hashes)
+	assert.EqualError(t, err, "non boolean value stored in the \"enabled\" field for the Schedule with ID 42")
+}
+
+func TestGet_InvalidEnabled(t *testing.T) {
+	client := redisTest.NewClient()
+	client.SetHash(redisKey(42), map[string]string{"watches_ids": "1", "interval": "0", "enabled": "x"})
+	storage := Redis{
+		client: client,
+	}
+
+	_, err := storage.Get(42)
+	assert.EqualError(t, err, "non boolean value stored in the \"enabled\" field for the Schedule with ID 42")
+}
+
+func TestHashFields_InvalidCronExpr(t *testing.T) {
+	original := testSchedule()
+	original.CronExpr = "not an expression"
+
+	_, err := toHashFields(original)
+	assert.NotNil(t, err)
+}
+
+func TestSearch_LoadsScriptOnce(t *testing.T) {
+	client := &TestRedisClient_Script{}
+	storage := Redis{
+		client:       client,
+		searchScript: &searchScript{},
+	}
+
+	_, err := storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	_, err = storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+
+	// The script should be loaded once and invoked by its hash every time.
+	assert.Equal(t, []string{"SCRIPT", "EVALSHA", "EVALSHA"}, client.commands)
+}
+
+func TestSearch_ReloadsScriptOnNoScript(t *testing.T) {
+	client := &TestRedisClient_Script{noScript: true}
+	storage := Redis{
+		client:       client,
+		searchScript: &searchScript{},
+	}
+
+	_, err := storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	_, err = storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+
+	// When Redis does not know the script it should be sent with EVAL, which
+	// loads it again so that following searches can invoke it by its hash.
+	assert.Equal(t, []string{"SCRIPT", "EVALSHA", "EVAL", "EVALSHA"}, client.commands)
+}
+
+func TestSearch_SkipsDisabledSchedules(t *testing.T) {
+	client := &TestRedisClient_Script{
+		schedules: [][]string{
+			{"watches_ids", "1", "interval", "60000000000", "enabled", "1", "id", "1"},
+			{"watches_ids", "2", "interval", "60000000000", "enabled", "0", "id", "2"},
+			{"watches_ids", "3", "interval", "60000000000", "enabled", "1", "id", "3"},
+		},
+	}
+	storage := Redis{
+		client:       client,
+		searchScript: &searchScript{},
+	}
+
+	schedules, err := storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	assert.Len(t, schedules, 2)
+	for _, schedule := range schedules {
+		assert.True(t, schedule.Enabled)
+		assert.NotEqual(t, 2, schedule.ID)
+	}
+}
+
+func TestSearch_Batches(t *testing.T) {
+	client := &TestRedisClient_Script{
+		schedules: [][]string{
+			{"watches_ids", "1", "interval", "60000000000", "enabled", "1", "id", "1"},
+			{"watches_ids", "2", "interval", "60000000000", "enabled", "1", "id", "2"},
+			{"watches_ids", "3", "interval", "60000000000", "enabled", "1", "id", "3"},
+		},
+	}
+	storage := Redis{
+		client:       client,
+		searchScript: &searchScript{},
+		searchCursor: &searchCursor{},
+	}
+
+	// The limit is given to the search script, and the following search
+	// continues after the last Schedule of a full batch.
+	schedules, err := storage.Search(time.Minute, 2)
+	assert.Nil(t, err)
+	assert.Len(t, schedules, 2)
+	_, err = storage.Search(time.Minute, 2)
+	assert.Nil(t, err)
+
+	// Searches without a limit neither use nor advance the cursor.
+	schedules, err = storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	assert.Len(t, schedules, 3)
+
+	// The search starts from the beginning after a batch that is not full.
+	client.schedules = client.schedules[2:]
+	_, err = storage.Search(time.Minute, 2)
+	assert.Nil(t, err)
+	_, err = storage.Search(time.Minute, 2)
+	assert.Nil(t, err)
+
+	expected := [][]interface{}{{0, 2}, {2, 2}, {0, 0}, {2, 2}, {0, 2}}
+	assert.Equal(t, expected, client.batches)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testSchedule generates a Schedule object with some defaults.
+func testSchedule() *schedule.Schedule {
+	start := time.Now()
+	return &schedule.Schedule{
+		Start:      &start,
+		Interval:   util.Duration{Duration: time.Minute},
+		WatchesIDs: []int{1},
+		Enabled:    true,
+	}
+}
+
+// TestRedisClient_ErrorResponse fails every command, as when Redis cannot be
+// reached.
+type TestRedisClient_ErrorResponse struct{}
+
+func (c *TestRedisClient_ErrorResponse) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	return redis.NewResp(fmt.Errorf("an error has occurred while executing the Redis command"))
+}
+
+// TestRedisClient_RightValueResponse returns the fields of a stored Schedule
+// for every command.
+type TestRedisClient_RightValueResponse struct{}
+
+func (c *TestRedisClient_RightValueResponse) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	return redis.NewResp([]string{
+		"watches_ids", "1,2",
+		"interval", "60000000000",
+		"enabled", "1",
+		"start", "1497607200000000000",
+	})
+}
+
+// TestRedisClient_Script records the commands it receives and simulates the
+// behavior of Redis for the commands related to running Lua scripts. If
+// noScript is set, the first EVALSHA command fails with a NOSCRIPT error. The
+// script returns the given Schedule hashes.
+type TestRedisClient_Script struct {
+	noScript  bool
+	commands  []string
+	schedules [][]string
+	// The cursor and the limit given to each search, in pairs.
+	batches [][]interface{}
+}
+
+func (c *TestRedisClient_Script) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	c.commands = append(c.commands, cmd)
+	if cmd == "EVALSHA" || cmd == "EVAL" {
+		c.batches = append(c.batches, args[len(args)-2:])
+	}
+
+	switch cmd {
+	case "SCRIPT":
+		return redis.NewResp("b4dba3f6a5a4a6a2c5e2f9a7e1e3d1b2c4d5e6f7")
+	case "EVALSHA":
+		if c.noScript {
+			c.noScript = false
+			return redis.NewResp(fmt.Errorf("NOSCRIPT No matching script. Please use EVAL."))
+		}
+		return c.searchResp()
+	case "EVAL":
+		return c.searchResp()
+	}
+
+	return redis.NewResp(fmt.Errorf("unsupported command \"%s\"", cmd))
+}
+
+// searchResp returns the Schedules, up to the limit given to the last search if
+// any.
+func (c *TestRedisClient_Script) searchResp() *redis.Resp {
+	limit := c.batches[len(c.batches)-1][1].(int)
+	schedules := []interface{}{}
+	for _, schedule := range c.schedules {
+		if limit > 0 && len(schedules) == limit {
+			break
+		}
+		schedules = append(schedules, schedule)
+	}
+	return redis.NewResp(schedules)
+}
@@ -1,15 +1,7 @@
--- Get the Schedules that have a start time before the polling interval's start
--- time.
+-- Get the Schedules that have a start time before the polling interval's end
+-- time. Schedules without a start time are indexed with a start time of 0.
 local start_index = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", "("..ARGV[3])
--- Get the Schedules that have a stop time after the polling interval's end
--- time.
-local stop_index = redis.call("ZRANGEBYSCORE", KEYS[2], ARGV[2], "+inf")
 
--- @I Take into account Schedules without start and stop times.
-
--- Temporary table that will be holding all candidate Schedules, which is the
--- union of the tables defined above
-local schedules = {}
 -- Table where the final, filtered schedules that meet all conditions will be
 -- held.
 local filteredSchedules = {}
@@ -19,63 +11,96 @@ local filteredSchedules = {}
 local start = tonumber(ARGV[2])
 local stop  = tonumber(ARGV[3])
 
--- Get the union of the Schedule candidates that meet the start and end times
--- criteria. At the same time we're creating the union of the tables, we're
--- loading the Schedules' hashes since they are values that we will be
--- returning.
--- @I Look if there's a more efficient way to get the union of two tables in Lua
+-- Temporary variables that hold the ID of the Schedule that the previous batch
+-- ended with, and the maximum number of Schedules to return; 0 for no limit.
+local cursor = tonumber(ARGV[4])
+local limit  = tonumber(ARGV[5])
+
+-- Go through the Schedules in the order of their IDs, starting from the
+-- Schedules that follow the cursor and continuing from the beginning, so that
+-- consecutive batches advance through all Schedules.
+local ids = {}
 for k, v in pairs(start_index) do
-   local i = tonumber(v)
-   schedules[i] = redis.call("HGETALL", ARGV[1]..v)
-   -- Add the ID field to the returned values so that we know which Schedule the
-   -- rest of the fields correspond to.
-   schedules[i][#schedules[i]+1] = "id"
-   schedules[i][#schedules[i]+1] = v
+   ids[#ids+1] = tonumber(v)
 end
-for k, v in pairs(stop_index) do
-   local i = tonumber(v)
-   if schedules[i] == nil then
-      schedules[i] = redis.call("HGETALL", ARGV[1]..v)
-      -- Add the ID field to the returned values.
-      schedules[i][#schedules[i]+1] = "id"
-      schedules[i][#schedules[i]+1] = v
+table.sort(ids)
+
+local orderedIDs = {}
+for k, v in ipairs(ids) do
+   if v > cursor then
+      orderedIDs[#orderedIDs+1] = v
+   end
+end
+for k, v in ipairs(ids) do
+   if v <= cursor then
+      orderedIDs[#orderedIDs+1] = v
    end
 end
 
-
--- Filter the candidate Schedules:
+-- Out of the Schedules that have started, keep the ones that have a stop time
+-- after the polling interval's start time. Schedules without a stop time are
+-- indexed with a stop time of 0. At the same time, we're loading the Schedules'
+-- hashes since they are values that we will be returning.
+--
+-- Then filter the candidate Schedules:
 -- - Remove disabled Schedules.
--- - Remove Schedules that their next trigger time (as indicated by their last
---   trigger time and their trigger interval) falls outside of the current
---   polling interval.
-for k, v in pairs(schedules) do
-   -- We copy the Schedule to a new array regardless of whether it meets the
-   -- criteria, and we remove it later if it doesn't. This is not optimum, but
-   -- we do it because ideally we do not need a new array to hold the filtered
-   -- Schedules. Instead, we should be simply removing the Schedule from the
-   -- original array, but for some reason associative arrays always return an
-   -- empty value. We therefore keep the structure of the program and use an
-   -- intermediary array until we find out what is wrong and fix the problem.
-   -- @I Find out why associative arrays in Lua always return as empty
-   filteredSchedules[#filteredSchedules+1] = schedules[k]
-   local i = #filteredSchedules
+-- - Remove Schedules that have a cron expression, if the next time matching the
+--   expression (as calculated when the Schedule was last stored) has not passed
+--   yet.
+-- - Remove Schedules without a cron expression that their next trigger time (as
+--   indicated by their last trigger time and their trigger interval) falls
+--   outside of the current polling interval.
+for k, id in ipairs(orderedIDs) do
+   local scheduleID = tostring(id)
+   local scheduleStop = tonumber(redis.call("ZSCORE", KEYS[2], scheduleID))
+   if scheduleStop == nil or scheduleStop == 0 or scheduleStop >= start then
+      local v = redis.call("HGETALL", ARGV[1]..scheduleID)
+      -- Skip index entries left behind by Schedules that no longer exist.
+      if #v ~= 0 then
+         -- Create an associative array for the schedule so that we can easily
+         -- get the value by key.
+         local schedule = {}
+         local key = ""
+         for kk, vv in pairs(v) do
+            if key == "" then
+               key = vv
+            else
+               schedule[key] = vv
+               key = ""
+            end
+         end
 
-   -- Create an associative array for the schedule so that we can easily get the
-   -- value by key.
-   local schedule = {}
-   local key = ""
-   for kk, vv in pairs(v) do
-      if key == "" then
-         key = vv
-      else
-         schedule[key] = vv
-         key = ""
-      end
-   end
+         -- Filter the Schedules based on the criteria described above.
+         local include = true
+         if schedule["enabled"] == "0" then
+            include = false
+         elseif schedule["cron_expr"] ~= nil then
+            if schedule["next"] == nil or tonumber(schedule["next"]) > start then
+               include = false
+            end
+         elseif (schedule["last"] ~= nil and tonumber(schedule["last"])+tonumber(schedule["interval"]) >= stop) then
+            include = false
+         end
 
-   -- Filter the Schedules based on the criteria described above.
-   if (schedule["enabled"] == "0" or (schedule["last"] ~= nil and tonumber(schedule["last"])+tonumber(schedule["interval"]) >= stop)) then
-      filteredSchedules[i] = nil
+         -- Only append the Schedules that meet the criteria. Redis converts Lua
+         -- tables to replies up to their first nil value; removing Schedules by
+         -- setting them to nil would therefore drop all Schedules that follow a
+         -- removed one, and tables keyed by the Schedule IDs would be returned
+         -- empty.
+         if include then
+            -- Add the ID field to the returned values so that we know which
+            -- Schedule the rest of the fields correspond to.
+            v[#v+1] = "id"
+            v[#v+1] = scheduleID
+            filteredSchedules[#filteredSchedules+1] = v
+
+            -- Stop when the batch is full; the rest of the Schedules are left
+            -- for the following searches.
+            if limit > 0 and #filteredSchedules >= limit then
+               break
+            end
+         end
+      end
    end
 end
 
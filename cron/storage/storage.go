@@ -7,25 +7,33 @@ package msCronStorage
 import (
 	// Utilities.
 	"fmt"
+	"sync"
 	"time"
 
 	// Internal dependencies.
 	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
 )
 
 /**
  * Public API.
  */
 
+// ErrNotFound is returned when trying to get or delete a Schedule that does not
+// exist in the Storage.
+var ErrNotFound = fmt.Errorf("the Schedule was %w", errorsUtil.ErrNotFound)
+
 // Storage is an interface that should be implemented by all Storage engines.
-// It defines an API for storing and retrieving Schedule objects.
+// It defines an API for storing, retrieving and deleting Schedule objects, and
+// for checking whether the Storage is available.
 type Storage interface {
-	// @I Implement Delete function in the Storage API
-
 	Create(*schedule.Schedule) (*int, error)
 	Get(int) (*schedule.Schedule, error)
+	Exists(int) (bool, error)
 	Update(*schedule.Schedule, bool) error
-	Search(time.Duration) ([]*schedule.Schedule, error)
+	Delete(int) error
+	Search(time.Duration, int) ([]*schedule.Schedule, error)
+	Ping() error
 }
 
 // StorageFactory is a function type that should be implemented by all Storage
@@ -38,28 +46,21 @@ type StorageFactory func(confing map[string]interface{}) (Storage, error)
 // Create creates and returns a Storage provider, given the configuration that
 // includes configuration required by the provider.
 func Create(config map[string]interface{}) (Storage, error) {
-	// Register providers the first time we create a storage. We may create a more
-	// generic registration mechanism when we support more storage providers that
-	// may also be registered independently, but for now this is sufficient.
-	if len(storageFactories) == 0 {
-		storageFactories["redis"] = NewRedisStorage
-	}
-
 	storageType, ok := config["type"]
 	if !ok {
-		err := fmt.Errorf("the \"type\" configuration option is required for defining the storage engine")
+		err := fmt.Errorf("the \"type\" configuration option is required for defining the storage engine: %w", errorsUtil.ErrInvalidConfig)
 		return nil, err
 	}
 
 	sStorageType := storageType.(string)
 	if sStorageType == "" {
-		err := fmt.Errorf("no storage engine provided")
+		err := fmt.Errorf("no storage engine provided: %w", errorsUtil.ErrInvalidConfig)
 		return nil, err
 	}
 
-	factory, ok := storageFactories[sStorageType]
+	factory, ok := storageFactory(sStorageType)
 	if !ok {
-		err := fmt.Errorf("unknown storage engine \"%s\"", sStorageType)
+		err := fmt.Errorf("unknown storage engine \"%s\": %w", sStorageType, errorsUtil.ErrUnknownType)
 		return nil, err
 	}
 
@@ -71,9 +72,77 @@ func Create(config map[string]interface{}) (Storage, error) {
 	return storage, nil
 }
 
+// RegisterStorageFactory registers the given factory for creating Storage
+// engines of the given type, replacing any factory already registered for it.
+// It allows Storage engines defined outside of this package to be created via
+// Create(), and it is safe to call concurrently with Create().
+func RegisterStorageFactory(storageType string, factory StorageFactory) {
+	storageFactoriesMutex.Lock()
+	defer storageFactoriesMutex.Unlock()
+	storageFactories[storageType] = factory
+}
+
 /**
  * For internal use.
  */
 
-// storageFactories holds a map of all known Storage factories.
+// storageFactories holds a map of all known Storage factories, keyed by their
+// type. It is only accessed while holding storageFactoriesMutex.
 var storageFactories = make(map[string]StorageFactory)
+
+// storageFactoriesMutex guards storageFactories so that factories can be
+// registered while others are looked up concurrently.
+var storageFactoriesMutex sync.RWMutex
+
+// Register the factories provided by this application.
+func init() {
+	RegisterStorageFactory("redis", NewRedisStorage)
+	RegisterStorageFactory("bolt", NewBoltStorage)
+}
+
+// searchCursor holds the ID of the Schedule that the last batch of candidate
+// Schedules ended with, so that the following search continues with the
+// Schedules after it. It is held by the Storage engines by pointer so that it
+// is shared between their copies.
+type searchCursor struct {
+	mutex sync.Mutex
+	id    int
+}
+
+// search calls the given function for searching for a batch of at most the
+// given number of candidate Schedules, continuing after the Schedule that the
+// previous batch ended with. The cursor is advanced to the last Schedule of the
+// batch if the batch is full; otherwise all candidates were found and the next
+// search starts from the beginning. Searches without a limit, or without a
+// cursor, always start from the beginning and they do not advance the cursor.
+func (cursor *searchCursor) search(
+	limit int,
+	fn func(after int) ([]*schedule.Schedule, error),
+) ([]*schedule.Schedule, error) {
+	if cursor == nil || limit <= 0 {
+		return fn(0)
+	}
+
+	cursor.mutex.Lock()
+	defer cursor.mutex.Unlock()
+
+	schedules, err := fn(cursor.id)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor.id = 0
+	if len(schedules) >= limit {
+		cursor.id = schedules[len(schedules)-1].ID
+	}
+
+	return schedules, nil
+}
+
+// storageFactory returns the factory registered for the given type, if any.
+func storageFactory(storageType string) (StorageFactory, bool) {
+	storageFactoriesMutex.RLock()
+	defer storageFactoriesMutex.RUnlock()
+	factory, ok := storageFactories[storageType]
+	return factory, ok
+}
@@ -0,0 +1,163 @@
+/**
+ * Tests for the msCronStorage module.
+ */
+
+package msCronStorage
+
+import (
+	// Utilities.
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	schedule "github.com/krystalcode/go-mantis-shrimp/cron/schedule"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+)
+
+/**
+ * Tests.
+ */
+
+func TestCreate_Concurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ms_cron_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Storage engines are created, and factories are registered, at the same
+	// time, such as by concurrent requests.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			storage, err := Create(map[string]interface{}{
+				"type": "bolt",
+				"path": filepath.Join(dir, fmt.Sprintf("%d_schedules.db", i)),
+			})
+			if assert.Nil(t, err) {
+				storage.(Bolt).db.Close()
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := Create(map[string]interface{}{"type": "mysql"})
+			assert.EqualError(t, err, "unknown storage engine \"mysql\": unknown type")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			RegisterStorageFactory(fmt.Sprintf("test_%d", i), NewBoltStorage)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCreate_SentinelErrors(t *testing.T) {
+	_, err := Create(map[string]interface{}{})
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+	_, err = Create(map[string]interface{}{"type": "mysql"})
+	assert.True(t, errors.Is(err, errorsUtil.ErrUnknownType))
+	_, err = Create(map[string]interface{}{"type": "redis"})
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+	_, err = Create(map[string]interface{}{"type": "bolt"})
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+}
+
+func TestStorage_SentinelErrors(t *testing.T) {
+	// Redis clients that have not been initialized.
+	uninitialized := Redis{}
+	_, err := uninitialized.Get(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrStorageUninitialized))
+	err = uninitialized.Delete(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrStorageUninitialized))
+
+	// Schedules that do not exist.
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+	_, err = storage.Get(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrNotFound))
+	err = storage.Delete(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrNotFound))
+	assert.EqualError(t, err, "the Schedule was not found")
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testSearchBatches asserts that searching the given Storage, which should be
+// empty, returns at most the batch size of candidate Schedules every time, and
+// that all candidate Schedules are processed across consecutive searches.
+func testSearchBatches(t *testing.T, storage Storage) {
+	// The Schedules have never been triggered so they are all candidates.
+	var ids []int
+	for i := 1; i <= 5; i++ {
+		candidate := &schedule.Schedule{
+			WatchesIDs: []int{i},
+			Interval:   util.Duration{Duration: time.Hour},
+			Enabled:    true,
+		}
+		id, err := storage.Create(candidate)
+		assert.Nil(t, err)
+		ids = append(ids, *id)
+	}
+
+	// Each search continues after the Schedule that the previous one ended
+	// with, and it continues from the beginning after the last Schedule.
+	expected := [][]int{
+		{ids[0], ids[1]},
+		{ids[2], ids[3]},
+		{ids[4], ids[0]},
+	}
+	for index, expectedIDs := range expected {
+		found, err := storage.Search(time.Minute, 2)
+		assert.Nil(t, err, "search %d", index)
+		foundIDs := []int{}
+		for _, candidate := range found {
+			foundIDs = append(foundIDs, candidate.ID)
+		}
+		assert.Equal(t, expectedIDs, foundIDs, "search %d", index)
+	}
+
+	// Searches without a limit return all Schedules.
+	found, err := storage.Search(time.Minute, 0)
+	assert.Nil(t, err)
+	assert.Len(t, found, 5)
+
+	// Process the Schedules the same way as the Cron component does i.e. by
+	// updating their last trigger time, until none is a candidate any more.
+	processed := map[int]bool{}
+	for searches := 0; len(processed) < len(ids); searches++ {
+		if searches == len(ids) {
+			t.Fatalf("only %d of %d Schedules were processed", len(processed), len(ids))
+		}
+
+		found, err := storage.Search(time.Minute, 2)
+		assert.Nil(t, err)
+		assert.True(t, len(found) <= 2, "%d Schedules were found", len(found))
+		for _, candidate := range found {
+			assert.False(t, processed[candidate.ID], "the Schedule %d was processed twice", candidate.ID)
+			processed[candidate.ID] = true
+
+			now := time.Now()
+			candidate.Last = &now
+			err = storage.Update(candidate, false)
+			assert.Nil(t, err)
+		}
+	}
+
+	found, err = storage.Search(time.Minute, 2)
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+}
@@ -0,0 +1,548 @@
+/**
+ * Provides functionality shared by the APIs of all components.
+ */
+
+package msUtilAPI
+
+import (
+	// Utilities.
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+
+	// Internal dependencies.
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	version "github.com/krystalcode/go-mantis-shrimp/util/version"
+)
+
+/**
+ * Constants.
+ */
+
+// PathHealth holds the path that the health endpoint is served on.
+const PathHealth = "/health"
+
+// PathVersion holds the path that the version endpoint is served on.
+const PathVersion = "/version"
+
+// MaxRequestBytesDefault holds the maximum size of the body of the requests
+// made to the APIs, in bytes, when none is given in the configuration.
+const MaxRequestBytesDefault = 1 << 20
+
+// ReadTimeoutDefault holds the maximum duration for reading a request made to
+// the APIs, including its body, when none is given in the configuration.
+const ReadTimeoutDefault = 30 * time.Second
+
+// rateLimitSweepInterval holds how often the rate limiter forgets the clients
+// that have not made requests for long enough to be allowed their full burst
+// again, so that the memory it uses does not grow with every client ever seen.
+const rateLimitSweepInterval = time.Minute
+
+/**
+ * Public API.
+ */
+
+// Pinger is an interface that should be implemented by dependencies whose
+// availability can be checked, such as Storage engines.
+type Pinger interface {
+	Ping() error
+}
+
+// RespondError logs the given error and responds to the request with the given
+// status, stopping the execution of any following handlers. The error itself is
+// not included in the response so that internal details are not exposed to the
+// caller. Server errors are logged at the "error" level, while errors caused by
+// the caller are logged at the "warn" level.
+func RespondError(c *gin.Context, status int, err error) {
+	logger := log.FromContext(c)
+	logFunc := logger.Warn
+	if status >= http.StatusInternalServerError {
+		logFunc = logger.Error
+	}
+	logFunc(
+		"responding with an error",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"status", status,
+		"err", err,
+	)
+	c.JSON(
+		status,
+		gin.H{
+			"status": status,
+		},
+	)
+	c.Abort()
+}
+
+// BindJSON decodes the JSON body of the request into the given object. Unlike
+// the Context.BindJSON() method provided by Gin, it does not abort the request
+// with a 400 Bad Request response when the body cannot be decoded, leaving it
+// to the caller to respond via RespondError() so that the error is logged and
+// only one response is written. The status to respond with is given by
+// BodyErrorStatus().
+func BindJSON(c *gin.Context, obj interface{}) error {
+	err := json.NewDecoder(c.Request.Body).Decode(obj)
+	if err != nil {
+		return fmt.Errorf("failed to decode the request body: %w", err)
+	}
+
+	return nil
+}
+
+// RateLimitConfig holds the configuration for limiting the rate of the requests
+// made by each client.
+type RateLimitConfig struct {
+	// The number of requests per second that each client can make on average.
+	// Rate limiting is disabled when zero.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// The number of requests that each client can make at once, before being
+	// limited to the rate. Defaults to the rate rounded up.
+	Burst int `json:"burst"`
+}
+
+// Validate checks that the configuration options have valid values.
+func (config RateLimitConfig) Validate() error {
+	if config.RequestsPerSecond < 0 {
+		return fmt.Errorf("the requests per second cannot be negative")
+	}
+	if config.Burst < 0 {
+		return fmt.Errorf("the burst cannot be negative")
+	}
+
+	return nil
+}
+
+// ServerConfig holds the configuration for the HTTP server that serves an API.
+type ServerConfig struct {
+	// The maximum size of the body of a request, in bytes. Defaults to
+	// MaxRequestBytesDefault.
+	MaxRequestBytes int64 `json:"max_request_bytes"`
+	// The maximum duration for reading a request, including its body, in a
+	// format supported by time.ParseDuration(). Defaults to ReadTimeoutDefault;
+	// the requests are not timed out when it is zero.
+	ReadTimeout string `json:"read_timeout"`
+	// The maximum duration for reading a request and writing its response, in a
+	// format supported by time.ParseDuration(). The responses are not timed out
+	// when it is not given, since some requests wait for Watches to be evaluated
+	// or Actions to be executed before responding.
+	WriteTimeout string `json:"write_timeout"`
+}
+
+// Validate checks that the configuration options have valid values.
+func (config ServerConfig) Validate() error {
+	_, _, _, err := config.Parse()
+	return err
+}
+
+// Parse returns the maximum size of the body of a request, the read timeout and
+// the write timeout as given in the configuration, or their defaults if they
+// are not given.
+func (config ServerConfig) Parse() (int64, time.Duration, time.Duration, error) {
+	if config.MaxRequestBytes < 0 {
+		return 0, 0, 0, fmt.Errorf("the maximum request size cannot be negative")
+	}
+	maxRequestBytes := config.MaxRequestBytes
+	if maxRequestBytes == 0 {
+		maxRequestBytes = MaxRequestBytesDefault
+	}
+
+	readTimeout, err := parseTimeout(config.ReadTimeout, ReadTimeoutDefault)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("the read timeout is not valid: %s", err.Error())
+	}
+	writeTimeout, err := parseTimeout(config.WriteTimeout, 0)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("the write timeout is not valid: %s", err.Error())
+	}
+
+	return maxRequestBytes, readTimeout, writeTimeout, nil
+}
+
+// Health returns an endpoint controller that checks whether the given
+// dependency is available. It responds with a 200 status when it is, and with a
+// 503 status together with the error otherwise, so that it can be used by
+// liveness and readiness probes.
+func Health(pinger Pinger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := pinger.Ping()
+		if err != nil {
+			log.FromContext(c).Error("the health check failed", "err", err)
+			c.JSON(
+				http.StatusServiceUnavailable,
+				gin.H{
+					"status": http.StatusServiceUnavailable,
+					"error":  err.Error(),
+				},
+			)
+			return
+		}
+
+		c.JSON(
+			http.StatusOK,
+			gin.H{
+				"status": http.StatusOK,
+			},
+		)
+	}
+}
+
+// Version is an endpoint controller that responds with the details of the
+// build that the program was made from i.e. its version, git commit and build
+// date, so that changes in behavior can be correlated to deployments.
+func Version(c *gin.Context) {
+	info := version.Get()
+	c.JSON(
+		http.StatusOK,
+		gin.H{
+			"status":  http.StatusOK,
+			"version": info.Version,
+			"commit":  info.Commit,
+			"date":    info.Date,
+		},
+	)
+}
+
+// CheckStep is a step of the self-test run by Check().
+type CheckStep struct {
+	// The name of the step, as printed in the summary e.g. "configuration".
+	Name string
+	// The function that runs the step. It returns an error if the step fails.
+	Run func() error
+}
+
+// Check runs the given steps of a self-test in order, such as validating the
+// configuration and connecting to the Storage, and it writes the outcome of
+// each step to the given writer followed by a summary. It stops at the first
+// step that fails, since the following steps usually depend on it, and it
+// returns its error. It allows checking a component before it is deployed
+// without serving any requests.
+func Check(out io.Writer, steps []CheckStep) error {
+	for index, step := range steps {
+		err := step.Run()
+		if err == nil {
+			fmt.Fprintf(out, "ok    %s\n", step.Name)
+			continue
+		}
+
+		fmt.Fprintf(out, "FAIL  %s: %s\n", step.Name, err.Error())
+		for _, skipped := range steps[index+1:] {
+			fmt.Fprintf(out, "skip  %s\n", skipped.Name)
+		}
+		fmt.Fprintf(out, "the check failed at the \"%s\" step\n", step.Name)
+		return fmt.Errorf("the \"%s\" step failed: %w", step.Name, err)
+	}
+
+	fmt.Fprintf(out, "all %d steps passed\n", len(steps))
+	return nil
+}
+
+// Serve serves the given handler on the given address until the given context
+// is cancelled. The server then stops accepting requests and waits for the
+// requests in progress to finish. It then waits for any given drain functions
+// to return e.g. for waiting on executions triggered by earlier requests. All
+// of them have to finish within the grace period, otherwise an error is
+// returned. The server times out reading requests and writing responses as
+// given in the configuration; the size of the request bodies is limited
+// separately by the MaxRequestBytes() middleware.
+func Serve(
+	ctx context.Context,
+	handler http.Handler,
+	address string,
+	config ServerConfig,
+	gracePeriod time.Duration,
+	drains ...func(context.Context) error,
+) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return serveListener(ctx, handler, listener, config, gracePeriod, drains...)
+}
+
+/**
+ * Middleware.
+ */
+
+// Authentication is a Gin middleware that requires callers to authenticate with
+// the given token, provided as a bearer token in the "Authorization" header.
+// Requests that do not carry the right token are responded with a 401 status.
+// Authentication is disabled when the token is empty, which can be useful for
+// local development.
+func Authentication(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		header := c.Request.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			unauthorized(c)
+			return
+		}
+
+		givenToken := strings.TrimPrefix(header, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(givenToken), []byte(token)) != 1 {
+			unauthorized(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MaxRequestBytes returns a Gin middleware that limits the size of the request
+// bodies to the given number of bytes. Requests whose length is known in
+// advance to exceed the limit are responded with a 413 status right away.
+// Otherwise the body is not read by the middleware; reading more than the limit
+// fails instead, and handlers that read the body should respond with the status
+// given by BodyErrorStatus() for the error.
+func MaxRequestBytes(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			RespondError(
+				c,
+				http.StatusRequestEntityTooLarge,
+				fmt.Errorf("the request body of %d bytes exceeds the limit of %d bytes", c.Request.ContentLength, limit),
+			)
+			return
+		}
+
+		// The length is not known in advance for chunked requests.
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+		c.Next()
+	}
+}
+
+// BodyErrorStatus returns the status that a request should be responded with
+// when reading its body fails with the given error; 413 when the body exceeds
+// the limit set by the MaxRequestBytes() middleware, and 400 otherwise, such as
+// when reading it times out or when it cannot be decoded.
+func BodyErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
+// RateLimit returns a Gin middleware that limits the rate of the requests made
+// by each client, identified by its IP address, as given in the configuration.
+// Every client has a bucket of tokens that holds up to the burst and that is
+// refilled at the configured rate; every request takes a token, and requests
+// made when the bucket is empty are responded with a 429 status and a
+// "Retry-After" header holding the seconds until a token is available. The same
+// middleware should be used for all routes that share the limit. Requests are
+// not limited when the rate is zero.
+func RateLimit(config RateLimitConfig) gin.HandlerFunc {
+	if config.RequestsPerSecond == 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	limiter := newRateLimiter(config)
+	return func(c *gin.Context) {
+		client := c.ClientIP()
+		wait := limiter.take(client)
+		if wait == 0 {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		RespondError(
+			c,
+			http.StatusTooManyRequests,
+			fmt.Errorf("the client \"%s\" exceeded the rate limit", client),
+		)
+	}
+}
+
+/**
+ * For internal use.
+ */
+
+// rateLimiter holds the token buckets of the clients limited by the RateLimit
+// middleware.
+type rateLimiter struct {
+	sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	// now returns the current time. It is defined as a field so that it can be
+	// replaced in tests.
+	now func() time.Time
+}
+
+// tokenBucket holds the tokens available to a client when it last made a
+// request.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a rate limiter with the rate and burst given in the
+// configuration, and with no clients seen yet.
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	burst := float64(config.Burst)
+	if burst == 0 {
+		burst = math.Ceil(config.RequestsPerSecond)
+	}
+
+	return &rateLimiter{
+		rate:      config.RequestsPerSecond,
+		burst:     burst,
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// take takes a token from the bucket of the given client. It returns zero if a
+// token was available, otherwise the time until one will be.
+func (limiter *rateLimiter) take(client string) time.Duration {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	bucket, ok := limiter.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: limiter.burst, last: now}
+		limiter.buckets[client] = bucket
+	}
+	bucket.tokens = limiter.refill(bucket, now)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - bucket.tokens) / limiter.rate * float64(time.Second))
+}
+
+// refill returns the tokens in the given bucket at the given time.
+func (limiter *rateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	tokens := bucket.tokens + now.Sub(bucket.last).Seconds()*limiter.rate
+	if tokens > limiter.burst {
+		tokens = limiter.burst
+	}
+
+	return tokens
+}
+
+// sweep forgets the clients whose buckets are full at the given time, since
+// they would be given a full bucket anyway, if the sweep interval has passed
+// since the last sweep.
+func (limiter *rateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+
+	for client, bucket := range limiter.buckets {
+		if limiter.refill(bucket, now) >= limiter.burst {
+			delete(limiter.buckets, client)
+		}
+	}
+}
+
+// serveListener implements Serve() for the given listener.
+func serveListener(
+	ctx context.Context,
+	handler http.Handler,
+	listener net.Listener,
+	config ServerConfig,
+	gracePeriod time.Duration,
+	drains ...func(context.Context) error,
+) error {
+	_, readTimeout, writeTimeout, err := config.Parse()
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+
+	for _, drain := range drains {
+		err = drain(shutdownCtx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseTimeout converts a timeout, as given in the configuration, to a
+// duration. The given default is returned if none is given.
+func parseTimeout(value string, defaultTimeout time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("the timeout cannot be negative")
+	}
+
+	return timeout, nil
+}
+
+// unauthorized responds to the request with a 401 status and stops the
+// execution of any following handlers.
+func unauthorized(c *gin.Context) {
+	c.JSON(
+		http.StatusUnauthorized,
+		gin.H{
+			"status": http.StatusUnauthorized,
+		},
+	)
+	c.Abort()
+}
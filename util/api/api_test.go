@@ -0,0 +1,590 @@
+/**
+ * Tests for the msUtilAPI module.
+ */
+
+package msUtilAPI
+
+import (
+	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	version "github.com/krystalcode/go-mantis-shrimp/util/version"
+)
+
+/**
+ * Tests.
+ */
+
+func TestAuthentication_Authorized(t *testing.T) {
+	response := testRequest("secret", "Bearer secret")
+	assert.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestAuthentication_MissingHeader(t *testing.T) {
+	response := testRequest("secret", "")
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestAuthentication_WrongToken(t *testing.T) {
+	response := testRequest("secret", "Bearer wrong")
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestAuthentication_WrongScheme(t *testing.T) {
+	response := testRequest("secret", "Basic secret")
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestAuthentication_Disabled(t *testing.T) {
+	response := testRequest("", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestRateLimit(t *testing.T) {
+	router := testRateLimitRouter(RateLimitConfig{RequestsPerSecond: 20, Burst: 2})
+
+	// Requests up to the burst pass, while further rapid requests are limited.
+	for i := 0; i < 2; i++ {
+		response := testRateLimitRequest(router, "192.0.2.1:1234")
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+	response := testRateLimitRequest(router, "192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.JSONEq(t, `{"status":429}`, response.Body.String())
+	assert.Equal(t, "1", response.Header().Get("Retry-After"))
+
+	// Other clients are limited separately.
+	response = testRateLimitRequest(router, "192.0.2.2:1234")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Requests made slower than the rate pass.
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		response = testRateLimitRequest(router, "192.0.2.1:1234")
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	router := testRateLimitRouter(RateLimitConfig{})
+	for i := 0; i < 100; i++ {
+		response := testRateLimitRequest(router, "192.0.2.1:1234")
+		assert.Equal(t, http.StatusOK, response.Code)
+	}
+}
+
+func TestRateLimiter_Take(t *testing.T) {
+	limiter := newRateLimiter(RateLimitConfig{RequestsPerSecond: 0.5})
+	now := time.Date(2017, 5, 1, 10, 30, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+
+	// The burst defaults to the rate rounded up.
+	assert.Equal(t, time.Duration(0), limiter.take("client"))
+	assert.Equal(t, 2*time.Second, limiter.take("client"))
+
+	// A token is available again after 2 seconds.
+	now = now.Add(time.Second)
+	assert.Equal(t, time.Second, limiter.take("client"))
+	now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), limiter.take("client"))
+
+	// Clients with full buckets are forgotten.
+	now = now.Add(rateLimitSweepInterval)
+	assert.Equal(t, time.Duration(0), limiter.take("other"))
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestRateLimitConfig_Validate(t *testing.T) {
+	assert.Nil(t, RateLimitConfig{}.Validate())
+	assert.Nil(t, RateLimitConfig{RequestsPerSecond: 1.5, Burst: 10}.Validate())
+	assert.NotNil(t, RateLimitConfig{RequestsPerSecond: -1}.Validate())
+	assert.NotNil(t, RateLimitConfig{RequestsPerSecond: 1, Burst: -1}.Validate())
+}
+
+func TestMaxRequestBytes(t *testing.T) {
+	router := testMaxRequestBytesRouter(10)
+
+	response := testMaxRequestBytesRequest(router, strings.NewReader("0123456789"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "0123456789", response.Body.String())
+
+	response = testMaxRequestBytesRequest(router, strings.NewReader("0123456789a"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.JSONEq(t, `{"status":413}`, response.Body.String())
+}
+
+func TestMaxRequestBytes_UnknownLength(t *testing.T) {
+	router := testMaxRequestBytesRouter(10)
+
+	// The length of the body is not known in advance when it is not given as a
+	// bytes or strings reader.
+	response := testMaxRequestBytesRequest(router, ioutil.NopCloser(strings.NewReader("0123456789")))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	response = testMaxRequestBytesRequest(router, ioutil.NopCloser(strings.NewReader("0123456789a")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.JSONEq(t, `{"status":413}`, response.Body.String())
+}
+
+func TestMaxRequestBytes_BodyNotRead(t *testing.T) {
+	router := testMaxRequestBytesRouter(10)
+
+	// The body is only limited when it is read by the handler, unless its length
+	// is known to exceed the limit in advance.
+	request, _ := http.NewRequest("POST", "/ignored", ioutil.NopCloser(strings.NewReader("0123456789a")))
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+
+	request, _ = http.NewRequest("POST", "/ignored", strings.NewReader("0123456789a"))
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+}
+
+func TestBodyErrorStatus(t *testing.T) {
+	router := testMaxRequestBytesRouter(10)
+	router.POST("/json", func(c *gin.Context) {
+		var obj map[string]interface{}
+		err := BindJSON(c, &obj)
+		if err != nil {
+			RespondError(c, BodyErrorStatus(err), err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	cases := []struct {
+		body     string
+		expected int
+	}{
+		{`{"a":1}`, http.StatusNoContent},
+		// The error is still recognised after being wrapped by BindJSON().
+		{`{"a":"0123456789"}`, http.StatusRequestEntityTooLarge},
+		{`{"a":`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest("POST", "/json", ioutil.NopCloser(strings.NewReader(c.body)))
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		assert.Equal(t, c.expected, response.Code, c.body)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, BodyErrorStatus(fmt.Errorf("i/o timeout")))
+}
+
+func TestServerConfig_Parse(t *testing.T) {
+	maxRequestBytes, readTimeout, writeTimeout, err := ServerConfig{}.Parse()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(MaxRequestBytesDefault), maxRequestBytes)
+	assert.Equal(t, ReadTimeoutDefault, readTimeout)
+	assert.Equal(t, time.Duration(0), writeTimeout)
+
+	maxRequestBytes, readTimeout, writeTimeout, err = ServerConfig{
+		MaxRequestBytes: 1024,
+		ReadTimeout:     "0s",
+		WriteTimeout:    "1m",
+	}.Parse()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1024), maxRequestBytes)
+	assert.Equal(t, time.Duration(0), readTimeout)
+	assert.Equal(t, time.Minute, writeTimeout)
+
+	assert.NotNil(t, ServerConfig{MaxRequestBytes: -1}.Validate())
+	assert.NotNil(t, ServerConfig{ReadTimeout: "soon"}.Validate())
+	assert.NotNil(t, ServerConfig{WriteTimeout: "-1s"}.Validate())
+}
+
+func TestRespondError(t *testing.T) {
+	response, entry := testRespondError(t, http.StatusInternalServerError, fmt.Errorf("storage failure"))
+
+	// The error should not be exposed to the caller.
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.JSONEq(t, `{"status":500}`, response.Body.String())
+
+	// The error should be logged at the "error" level, together with the ID of
+	// the request.
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "storage failure", entry["err"])
+	assert.Equal(t, float64(http.StatusInternalServerError), entry["status"])
+	assert.Equal(t, "abc", entry["request_id"])
+}
+
+func TestRespondError_ClientError(t *testing.T) {
+	response, entry := testRespondError(t, http.StatusBadRequest, fmt.Errorf("invalid ID"))
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "invalid ID", entry["err"])
+}
+
+func TestBindJSON(t *testing.T) {
+	var obj map[string]interface{}
+	response := testBindJSON(`{"id":1}`, func(c *gin.Context) {
+		assert.Nil(t, BindJSON(c, &obj))
+		c.Status(http.StatusNoContent)
+	})
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Equal(t, float64(1), obj["id"])
+}
+
+func TestBindJSON_Invalid(t *testing.T) {
+	response := testBindJSON(`{"id":`, func(c *gin.Context) {
+		var obj map[string]interface{}
+		assert.NotNil(t, BindJSON(c, &obj))
+
+		// The request should be left to the caller to respond to.
+		assert.False(t, c.IsAborted())
+		assert.Empty(t, c.Errors)
+		assert.False(t, c.Writer.Written())
+
+		RespondError(c, http.StatusBadRequest, fmt.Errorf("invalid body"))
+	})
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.JSONEq(t, `{"status":400}`, response.Body.String())
+}
+
+func TestHealth_Healthy(t *testing.T) {
+	response := testHealth(testPinger{})
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":200}`, response.Body.String())
+}
+
+func TestHealth_Unhealthy(t *testing.T) {
+	response := testHealth(testPinger{fmt.Errorf("connection refused")})
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.JSONEq(t, `{"status":503,"error":"connection refused"}`, response.Body.String())
+}
+
+func TestVersion_Default(t *testing.T) {
+	response := testVersion()
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":200,"version":"dev","commit":"dev","date":"dev"}`,
+		response.Body.String(),
+	)
+}
+
+func TestVersion_Injected(t *testing.T) {
+	original := version.Get()
+	defer func() {
+		version.Version = original.Version
+		version.Commit = original.Commit
+		version.Date = original.Date
+	}()
+	version.Version = "1.2.3"
+	version.Commit = "aba4de7"
+	version.Date = "2017-06-16T10:00:00Z"
+
+	response := testVersion()
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(
+		t,
+		`{"status":200,"version":"1.2.3","commit":"aba4de7","date":"2017-06-16T10:00:00Z"}`,
+		response.Body.String(),
+	)
+}
+
+func TestCheck(t *testing.T) {
+	var out bytes.Buffer
+	runs := []string{}
+	step := func(name string, err error) CheckStep {
+		return CheckStep{
+			Name: name,
+			Run: func() error {
+				runs = append(runs, name)
+				return err
+			},
+		}
+	}
+
+	err := Check(&out, []CheckStep{step("configuration", nil), step("storage", nil)})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok    configuration\nok    storage\nall 2 steps passed\n", out.String())
+
+	// The steps following a failed step are skipped.
+	out.Reset()
+	runs = []string{}
+	err = Check(
+		&out,
+		[]CheckStep{
+			step("configuration", nil),
+			step("storage", fmt.Errorf("connection refused")),
+			step("storage ping", nil),
+		},
+	)
+	assert.EqualError(t, err, "the \"storage\" step failed: connection refused")
+	assert.Equal(t, []string{"configuration", "storage"}, runs)
+	assert.Equal(
+		t,
+		"ok    configuration\n"+
+			"FAIL  storage: connection refused\n"+
+			"skip  storage ping\n"+
+			"the check failed at the \"storage\" step\n",
+		out.String(),
+	)
+}
+
+func TestServe_WaitsForRequestsInProgress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	drained := false
+	drain := func(ctx context.Context) error {
+		drained = true
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serveListener(ctx, handler, listener, ServerConfig{}, time.Second, drain)
+	}()
+
+	// Shut down while a request is in progress; it should still succeed.
+	responses := make(chan int, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- 0
+			return
+		}
+		response.Body.Close()
+		responses <- response.StatusCode
+	}()
+	<-started
+	cancel()
+
+	assert.Equal(t, http.StatusOK, <-responses)
+	assert.Nil(t, <-served)
+	assert.True(t, drained)
+}
+
+func TestServe_GracePeriodExceeded(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// A drain function that does not finish within the grace period.
+	drain := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = serveListener(ctx, http.NotFoundHandler(), listener, ServerConfig{}, 10*time.Millisecond, drain)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestServe_ReadTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	readErrs := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		readErrs <- err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveListener(ctx, handler, listener, ServerConfig{ReadTimeout: "50ms"}, time.Second)
+
+	// Send only part of the body and then stall.
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\n01234"))
+	assert.Nil(t, err)
+
+	select {
+	case err := <-readErrs:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read timeout did not fire")
+	}
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testRespondError makes a request to a router that responds with the given
+// status and error. It returns the response and the entry logged for the
+// error.
+func testRespondError(t *testing.T, status int, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var buffer bytes.Buffer
+	logger, _ := log.New(&buffer, log.Config{Format: log.FormatJSON})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("logger", logger.With("request_id", "abc"))
+		c.Next()
+	})
+	router.GET("/", func(c *gin.Context) {
+		RespondError(c, status, err)
+	})
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), &entry))
+
+	return response, entry
+}
+
+// testBindJSON makes a request with the given body to a router that handles
+// it with the given handler.
+func testBindJSON(body string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", handler)
+
+	request, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+// testPinger is a dependency that is available unless it is given an error.
+type testPinger struct {
+	err error
+}
+
+func (pinger testPinger) Ping() error {
+	return pinger.err
+}
+
+// testHealth makes a request to the health endpoint for the given dependency.
+func testHealth(pinger Pinger) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET(PathHealth, Health(pinger))
+
+	request, _ := http.NewRequest("GET", PathHealth, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func testVersion() *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET(PathVersion, Version)
+
+	request, _ := http.NewRequest("GET", PathVersion, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+// testRateLimitRouter creates a router that limits the rate of the requests as
+// given in the configuration.
+func testRateLimitRouter(config RateLimitConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", RateLimit(config), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+	})
+
+	return router
+}
+
+// testRateLimitRequest makes a request to the given router from the client with
+// the given address.
+func testRateLimitRequest(router *gin.Engine, address string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest("POST", "/", nil)
+	request.RemoteAddr = address
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+// testRequest makes a request with the given "Authorization" header to a router
+// that requires the given token.
+// testMaxRequestBytesRouter creates a router that limits the size of the request
+// bodies to the given number of bytes. It responds with the body on "/", and
+// without reading the body on "/ignored".
+func testMaxRequestBytesRouter(limit int64) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MaxRequestBytes(limit))
+	router.POST("/", func(c *gin.Context) {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			RespondError(c, BodyErrorStatus(err), err)
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	})
+	router.POST("/ignored", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	return router
+}
+
+// testMaxRequestBytesRequest makes a request with the given body to the given
+// router.
+func testMaxRequestBytesRequest(router *gin.Engine, body io.Reader) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest("POST", "/", body)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func testRequest(token string, header string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Authentication(token))
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+	})
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	if header != "" {
+		request.Header.Set("Authorization", header)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
@@ -0,0 +1,102 @@
+/**
+ * Provides functionality for opening BoltDB databases that is shared by the
+ * Bolt storage engines of all components.
+ */
+
+package msUtilBolt
+
+import (
+	// Utilities.
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	// BoltDB.
+	bolt "go.etcd.io/bbolt"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+)
+
+/**
+ * Constants.
+ */
+
+// OpenTimeout holds how long opening a database waits for the lock on its file
+// before failing. The lock is held by the program that has the database open,
+// so that a second program using the same file fails instead of hanging.
+const OpenTimeout = time.Second
+
+/**
+ * Public API.
+ */
+
+// Open opens the BoltDB database stored at the file defined in the given
+// storage configuration, creating the file if it does not exist. The "path"
+// option is required. Bolt allows a file to be opened only once, while the
+// Storage engines of more than one component may be configured with the same
+// file when they run in the same program; the database is therefore opened the
+// first time it is requested, and the same handle is returned thereafter. A
+// handle can safely be used by concurrent requests.
+func Open(config map[string]interface{}) (*bolt.DB, error) {
+	path, ok := config["path"].(string)
+	if !ok || path == "" {
+		err := fmt.Errorf("the \"path\" configuration option is required for the Bolt storage: %w", errorsUtil.ErrInvalidConfig)
+		return nil, err
+	}
+	path = filepath.Clean(path)
+
+	databases.Lock()
+	defer databases.Unlock()
+
+	if db, ok := databases.handles[path]; ok {
+		return db, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: OpenTimeout})
+	if err != nil {
+		err := fmt.Errorf("failed to open the Bolt database \"%s\": %s", path, err.Error())
+		return nil, err
+	}
+	databases.handles[path] = db
+
+	return db, nil
+}
+
+// CreateBucket creates the bucket with the given name in the given database,
+// if it does not exist yet.
+func CreateBucket(db *bolt.DB, name []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(name)
+		return err
+	})
+}
+
+// Key converts the given ID into the key that it is stored at in a bucket.
+// Keys are big endian so that iterating over a bucket follows the order of the
+// IDs.
+func Key(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// ID converts the given bucket key back into the ID that it was generated for.
+func ID(key []byte) int {
+	return int(binary.BigEndian.Uint64(key))
+}
+
+/**
+ * For internal use.
+ */
+
+// databases holds the databases that have been opened, keyed by the path of
+// their file.
+var databases = struct {
+	sync.Mutex
+	handles map[string]*bolt.DB
+}{
+	handles: make(map[string]*bolt.DB),
+}
@@ -0,0 +1,52 @@
+/**
+ * Tests for the msUtilBolt module.
+ */
+
+package msUtilBolt
+
+import (
+	// Utilities.
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/**
+ * Tests.
+ */
+
+func TestOpen_MissingPath(t *testing.T) {
+	_, err := Open(map[string]interface{}{"type": "bolt"})
+	assert.NotNil(t, err)
+}
+
+func TestOpen_SharedHandle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ms_util_bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mantis-shrimp.db")
+	db, err := Open(map[string]interface{}{"path": path})
+	assert.Nil(t, err)
+
+	// Opening the same file again, even given by a different path, should not
+	// wait for the lock held by the first handle.
+	otherDB, err := Open(map[string]interface{}{"path": dir + "/./mantis-shrimp.db"})
+	assert.Nil(t, err)
+	assert.True(t, db == otherDB)
+}
+
+func TestKey(t *testing.T) {
+	for _, id := range []int{1, 255, 256, 1 << 40} {
+		assert.Equal(t, id, ID(Key(id)))
+	}
+
+	// Keys should sort in the same order as the IDs.
+	assert.True(t, string(Key(255)) < string(Key(256)))
+}
@@ -0,0 +1,34 @@
+/**
+ * Provides errors shared by the Storage engines, the wrappers and the APIs.
+ *
+ * The errors returned by the packages that use them wrap one of the errors
+ * defined here, so that callers can tell what went wrong via errors.Is() instead
+ * of matching error messages e.g. for responding with the right HTTP status.
+ */
+
+package msUtilErrors
+
+import (
+	// Utilities.
+	"fmt"
+)
+
+/**
+ * Public API.
+ */
+
+// ErrNotFound is wrapped by the errors returned when trying to get, update or
+// delete an object that does not exist in a Storage.
+var ErrNotFound = fmt.Errorf("not found")
+
+// ErrStorageUninitialized is wrapped by the errors returned when trying to use
+// a Storage engine that has not been initialized yet.
+var ErrStorageUninitialized = fmt.Errorf("uninitialized storage")
+
+// ErrInvalidConfig is wrapped by the errors returned when a configuration
+// option is missing or it holds an invalid value.
+var ErrInvalidConfig = fmt.Errorf("invalid configuration")
+
+// ErrUnknownType is wrapped by the errors returned when a Storage engine, a
+// Watch or an Action of an unknown type is requested.
+var ErrUnknownType = fmt.Errorf("unknown type")
@@ -0,0 +1,402 @@
+/**
+ * Provides a leveled, structured logger shared by all components.
+ */
+
+package msUtilLog
+
+import (
+	// Utilities.
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+)
+
+/**
+ * Constants.
+ */
+
+// Level indicates the severity of a log entry.
+type Level int
+
+// The available levels, from the least to the most severe.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// FormatText holds the name of the format that writes entries as "key=value"
+// pairs.
+const FormatText = "text"
+
+// FormatJSON holds the name of the format that writes entries as JSON objects.
+const FormatJSON = "json"
+
+// RequestIDHeader holds the name of the header that carries the ID of a
+// request. A request ID given by the caller is used as is; a new one is
+// generated otherwise.
+const RequestIDHeader = "X-Request-ID"
+
+/**
+ * Public API.
+ */
+
+// Config holds the configuration of a Logger.
+type Config struct {
+	// The minimum level of the entries that are written; one of "debug",
+	// "info", "warn" or "error". Defaults to "info".
+	Level string `json:"level"`
+	// The format that entries are written in; either "text" or "json". Defaults
+	// to "text".
+	Format string `json:"format"`
+}
+
+// Validate checks that the configuration options have valid values.
+func (config Config) Validate() error {
+	if _, err := ParseLevel(config.Level); err != nil {
+		return err
+	}
+
+	switch config.Format {
+	case "", FormatText, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown log format \"%s\"", config.Format)
+	}
+}
+
+// ParseLevel returns the Level with the given name. An empty name results in the
+// "info" level.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level \"%s\"", name)
+	}
+}
+
+// String returns the name of the Level.
+func (level Level) String() string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return strconv.Itoa(int(level))
+	}
+}
+
+// Logger writes entries that consist of a message and a list of key/value
+// pairs, as long as their level is not lower than the Logger's level. It is
+// safe for concurrent use.
+type Logger struct {
+	output *output
+	level  Level
+	format string
+	// Key/value pairs included in every entry, as given to With().
+	fields []interface{}
+}
+
+// New creates a Logger that writes to the given writer as configured.
+func New(writer io.Writer, config Config) (*Logger, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	level, _ := ParseLevel(config.Level)
+	format := config.Format
+	if format == "" {
+		format = FormatText
+	}
+
+	return &Logger{
+		output: &output{writer: writer},
+		level:  level,
+		format: format,
+	}, nil
+}
+
+// With returns a Logger that includes the given key/value pairs in every entry,
+// in addition to the pairs included by the current Logger.
+func (logger *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(logger.fields)+len(keyvals))
+	fields = append(fields, logger.fields...)
+	fields = append(fields, keyvals...)
+
+	return &Logger{
+		output: logger.output,
+		level:  logger.level,
+		format: logger.format,
+		fields: fields,
+	}
+}
+
+// Debug writes an entry at the "debug" level.
+func (logger *Logger) Debug(msg string, keyvals ...interface{}) {
+	logger.log(LevelDebug, msg, keyvals)
+}
+
+// Info writes an entry at the "info" level.
+func (logger *Logger) Info(msg string, keyvals ...interface{}) {
+	logger.log(LevelInfo, msg, keyvals)
+}
+
+// Warn writes an entry at the "warn" level.
+func (logger *Logger) Warn(msg string, keyvals ...interface{}) {
+	logger.log(LevelWarn, msg, keyvals)
+}
+
+// Error writes an entry at the "error" level.
+func (logger *Logger) Error(msg string, keyvals ...interface{}) {
+	logger.log(LevelError, msg, keyvals)
+}
+
+// Fatal writes an entry at the "error" level and exits the program. It is meant
+// for errors that the program cannot recover from, such as invalid
+// configuration.
+func (logger *Logger) Fatal(msg string, keyvals ...interface{}) {
+	logger.log(LevelError, msg, keyvals)
+	exit(1)
+}
+
+// Default returns the Logger used by the package-level logging functions.
+func Default() *Logger {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+
+	return defaultLogger
+}
+
+// SetDefault sets the Logger used by the package-level logging functions. It is
+// meant to be called once, after the program's configuration is loaded.
+func SetDefault(logger *Logger) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	defaultLogger = logger
+}
+
+// Debug writes an entry at the "debug" level using the default Logger.
+func Debug(msg string, keyvals ...interface{}) {
+	Default().log(LevelDebug, msg, keyvals)
+}
+
+// Info writes an entry at the "info" level using the default Logger.
+func Info(msg string, keyvals ...interface{}) {
+	Default().log(LevelInfo, msg, keyvals)
+}
+
+// Warn writes an entry at the "warn" level using the default Logger.
+func Warn(msg string, keyvals ...interface{}) {
+	Default().log(LevelWarn, msg, keyvals)
+}
+
+// Error writes an entry at the "error" level using the default Logger.
+func Error(msg string, keyvals ...interface{}) {
+	Default().log(LevelError, msg, keyvals)
+}
+
+// Fatal writes an entry at the "error" level using the default Logger and exits
+// the program.
+func Fatal(msg string, keyvals ...interface{}) {
+	Default().log(LevelError, msg, keyvals)
+	exit(1)
+}
+
+// FromContext returns the Logger of the request that the given Gin context
+// belongs to, as made available by the Middleware. The default Logger is
+// returned if there is none.
+func FromContext(c *gin.Context) *Logger {
+	if logger, ok := c.Get("logger"); ok {
+		if logger, ok := logger.(*Logger); ok {
+			return logger
+		}
+	}
+
+	return Default()
+}
+
+/**
+ * Middleware.
+ */
+
+// Middleware is a Gin middleware that assigns an ID to every request and makes
+// available to the controllers a Logger that includes the ID in its entries.
+// The ID is returned to the caller in the "X-Request-ID" header. Every request
+// is logged when it completes, together with its response status and duration.
+func Middleware(logger *Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.Request.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		requestLogger := logger.With("request_id", requestID)
+		c.Set("logger", requestLogger)
+
+		c.Next()
+
+		requestLogger.Info(
+			"request served",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start).String(),
+		)
+	}
+}
+
+/**
+ * For internal use.
+ */
+
+// The Logger used by the package-level logging functions until another one is
+// set. It writes text entries at the "info" level to the standard error.
+var defaultLogger = &Logger{
+	output: &output{writer: os.Stderr},
+	level:  LevelInfo,
+	format: FormatText,
+}
+
+// Protects the default Logger from concurrent changes.
+var defaultMutex sync.RWMutex
+
+// exit is the function called by Fatal() to exit the program; it is replaced
+// in tests.
+var exit = os.Exit
+
+// output serializes the writes of all Loggers that share the same writer, so
+// that entries are not interleaved.
+type output struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// log writes an entry with the given level, message and key/value pairs, if the
+// level is enabled.
+func (logger *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < logger.level {
+		return
+	}
+
+	fields := make([]interface{}, 0, 6+len(logger.fields)+len(keyvals))
+	fields = append(
+		fields,
+		"time", time.Now().UTC().Format(time.RFC3339Nano),
+		"level", level.String(),
+		"msg", msg,
+	)
+	fields = append(fields, logger.fields...)
+	fields = append(fields, keyvals...)
+	// A key without a value is an error in the calling code; we still log it so
+	// that it can be noticed.
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(MISSING)")
+	}
+
+	var buffer bytes.Buffer
+	if logger.format == FormatJSON {
+		writeJSON(&buffer, fields)
+	} else {
+		writeText(&buffer, fields)
+	}
+	buffer.WriteByte('\n')
+
+	logger.output.mutex.Lock()
+	defer logger.output.mutex.Unlock()
+	logger.output.writer.Write(buffer.Bytes())
+}
+
+// writeText writes the given key/value pairs to the buffer as space-separated
+// "key=value" pairs. Values containing spaces, quotes or equal signs are quoted.
+func writeText(buffer *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buffer.WriteByte(' ')
+		}
+		buffer.WriteString(fmt.Sprint(fields[i]))
+		buffer.WriteByte('=')
+
+		value := stringValue(fields[i+1])
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		buffer.WriteString(value)
+	}
+}
+
+// writeJSON writes the given key/value pairs to the buffer as a JSON object,
+// keeping the order of the keys.
+func writeJSON(buffer *bytes.Buffer, fields []interface{}) {
+	buffer.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		buffer.Write(key)
+		buffer.WriteByte(':')
+
+		value := fields[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		jsonValue, err := json.Marshal(value)
+		if err != nil {
+			jsonValue, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buffer.Write(jsonValue)
+	}
+	buffer.WriteByte('}')
+}
+
+// stringValue returns the text representation of a value.
+func stringValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case error:
+		return value.Error()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// newRequestID generates a random ID for a request.
+func newRequestID() string {
+	bytes := make([]byte, 8)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(bytes)
+}
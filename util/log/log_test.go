@@ -0,0 +1,182 @@
+/**
+ * Tests for the msUtilLog module.
+ */
+
+package msUtilLog
+
+import (
+	// Utilities.
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/**
+ * Tests.
+ */
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]Level{
+		"":        LevelInfo,
+		"debug":   LevelDebug,
+		"info":    LevelInfo,
+		"WARN":    LevelWarn,
+		"warning": LevelWarn,
+		"error":   LevelError,
+	}
+	for name, expected := range cases {
+		level, err := ParseLevel(name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.NotNil(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.Nil(t, Config{}.Validate())
+	assert.Nil(t, Config{Level: "debug", Format: "json"}.Validate())
+	assert.NotNil(t, Config{Level: "verbose"}.Validate())
+	assert.NotNil(t, Config{Format: "xml"}.Validate())
+}
+
+func TestLogger_Level(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, err := New(&buffer, Config{Level: "warn"})
+	assert.Nil(t, err)
+
+	logger.Debug("debug message")
+	logger.Info("info message")
+	logger.Warn("warn message")
+	logger.Error("error message")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `level=warn msg="warn message"`)
+	assert.Contains(t, lines[1], `level=error msg="error message"`)
+}
+
+func TestLogger_Text(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, _ := New(&buffer, Config{})
+
+	logger.With("component", "cron").Error(
+		"failed",
+		"id", 1,
+		"err", fmt.Errorf("connection refused"),
+		"empty", "",
+	)
+
+	assert.True(t, strings.HasPrefix(buffer.String(), "time="))
+	assert.Contains(
+		t,
+		buffer.String(),
+		` level=error msg=failed component=cron id=1 err="connection refused" empty=""`+"\n",
+	)
+}
+
+func TestLogger_JSON(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, _ := New(&buffer, Config{Format: "json"})
+
+	logger.Error("failed", "id", 1, "err", fmt.Errorf("connection refused"), "missing")
+
+	var entry map[string]interface{}
+	err := json.Unmarshal(buffer.Bytes(), &entry)
+	assert.Nil(t, err)
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "failed", entry["msg"])
+	assert.Equal(t, float64(1), entry["id"])
+	assert.Equal(t, "connection refused", entry["err"])
+	assert.Equal(t, "(MISSING)", entry["missing"])
+	assert.NotEmpty(t, entry["time"])
+}
+
+func TestFatal(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, _ := New(&buffer, Config{Format: "json"})
+
+	exitCode := -1
+	exit = func(code int) { exitCode = code }
+	defer func() { exit = osExit }()
+
+	logger.Fatal("invalid configuration")
+
+	entry := testEntries(t, &buffer)[0]
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, 1, exitCode)
+}
+
+func TestMiddleware(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, _ := New(&buffer, Config{Format: "json"})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(logger))
+	router.GET("/", func(c *gin.Context) {
+		FromContext(c).Warn("handling request")
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+	})
+
+	// A request ID given by the caller should be used.
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIDHeader, "abc")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, "abc", response.Header().Get(RequestIDHeader))
+	entries := testEntries(t, &buffer)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "handling request", entries[0]["msg"])
+	assert.Equal(t, "abc", entries[0]["request_id"])
+	assert.Equal(t, "request served", entries[1]["msg"])
+	assert.Equal(t, "abc", entries[1]["request_id"])
+	assert.Equal(t, float64(http.StatusOK), entries[1]["status"])
+
+	// A request ID should be generated otherwise.
+	buffer.Reset()
+	request, _ = http.NewRequest("GET", "/", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	requestID := response.Header().Get(RequestIDHeader)
+	assert.NotEmpty(t, requestID)
+	assert.Equal(t, requestID, testEntries(t, &buffer)[0]["request_id"])
+}
+
+func TestFromContext_Default(t *testing.T) {
+	c := &gin.Context{}
+	assert.Equal(t, Default(), FromContext(c))
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// The original exit function, restored after tests that replace it.
+var osExit = exit
+
+// testEntries decodes the JSON entries written to the given buffer.
+func testEntries(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var entry map[string]interface{}
+		err := json.Unmarshal([]byte(line), &entry)
+		assert.Nil(t, err, line)
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
@@ -0,0 +1,110 @@
+/**
+ * Provides functionality for exposing Prometheus metrics that is shared by the
+ * APIs of all components.
+ */
+
+package msUtilMetrics
+
+import (
+	// Utilities.
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	// Prometheus.
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+)
+
+/**
+ * Constants.
+ */
+
+// Namespace holds the prefix of the names of all metrics.
+const Namespace = "mantis_shrimp"
+
+// PathDefault holds the path that metrics are exposed at when no path is given
+// in the configuration.
+const PathDefault = "/metrics"
+
+/**
+ * Public API.
+ */
+
+// Config holds the configuration for exposing metrics.
+type Config struct {
+	// The address of a separate server that exposes the metrics e.g. ":9090".
+	// The metrics are exposed by the API server itself when empty.
+	Address string `json:"address"`
+	// The path that the metrics are exposed at. Defaults to "/metrics".
+	Path string `json:"path"`
+}
+
+// MetricsPath returns the path that the metrics should be exposed at.
+func (config Config) MetricsPath() string {
+	if config.Path == "" {
+		return PathDefault
+	}
+
+	return config.Path
+}
+
+// Validate checks that the configuration options have valid values.
+func (config Config) Validate() error {
+	if config.Path != "" && !strings.HasPrefix(config.Path, "/") {
+		return fmt.Errorf("the metrics path must start with a slash")
+	}
+
+	return nil
+}
+
+// Handler returns an HTTP handler that exposes the metrics collected by the
+// given registry in the Prometheus format.
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Mux returns an HTTP handler that exposes the metrics collected by the given
+// registry at the configured path, to be served by a separate server.
+func Mux(config Config, registry *prometheus.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(config.MetricsPath(), Handler(registry))
+	return mux
+}
+
+// NewRequestsCounter creates a counter of the requests served by an API,
+// labelled by request method, handler and response status. The given subsystem
+// identifies the API e.g. "watch_api".
+func NewRequestsCounter(subsystem string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: subsystem,
+			Name:      "requests_total",
+			Help:      "The number of requests served, by method, handler and status.",
+		},
+		[]string{"method", "handler", "status"},
+	)
+}
+
+/**
+ * Middleware.
+ */
+
+// Middleware is a Gin middleware that counts the requests served using the
+// given counter, as created by NewRequestsCounter().
+func Middleware(requests *prometheus.CounterVec) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		requests.WithLabelValues(
+			c.Request.Method,
+			c.HandlerName(),
+			strconv.Itoa(c.Writer.Status()),
+		).Inc()
+	}
+}
@@ -0,0 +1,69 @@
+/**
+ * Tests for the msUtilMetrics module.
+ */
+
+package msUtilMetrics
+
+import (
+	// Utilities.
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	// Gin.
+	gin "gopkg.in/gin-gonic/gin.v1"
+
+	// Prometheus.
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/**
+ * Tests.
+ */
+
+func TestMetricsPath(t *testing.T) {
+	assert.Equal(t, PathDefault, Config{}.MetricsPath())
+	assert.Equal(t, "/internal/metrics", Config{Path: "/internal/metrics"}.MetricsPath())
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Config{}.Validate())
+	assert.Nil(t, Config{Path: "/metrics"}.Validate())
+	assert.NotNil(t, Config{Path: "metrics"}.Validate())
+}
+
+func TestMiddleware(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	requests := NewRequestsCounter("test_api")
+	registry.MustRegister(requests)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(requests))
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest("GET", "/", nil)
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	// The requests should be counted by method and status.
+	server := httptest.NewServer(Mux(Config{}, registry))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + PathDefault)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "mantis_shrimp_test_api_requests_total{")
+	assert.Contains(t, string(body), `method="GET"`)
+	assert.Contains(t, string(body), `status="204"`)
+	assert.Contains(t, string(body), "} 2")
+}
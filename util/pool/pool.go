@@ -0,0 +1,94 @@
+/**
+ * Provides a pool that bounds the number of jobs running concurrently.
+ */
+
+package msUtilPool
+
+import (
+	// Utilities.
+	"context"
+	"sync"
+)
+
+/**
+ * Public API.
+ */
+
+// Group runs jobs in their own goroutines and keeps track of them, so that the
+// caller can wait for all running jobs to finish e.g. before shutting down.
+type Group struct {
+	waitGroup sync.WaitGroup
+}
+
+// Go runs the given job in a new goroutine. It does not block the caller.
+func (group *Group) Go(job func()) {
+	group.waitGroup.Add(1)
+	go func() {
+		defer group.waitGroup.Done()
+		job()
+	}()
+}
+
+// Wait blocks until all jobs run by the Group have finished, or until the given
+// context is done in which case the context's error is returned.
+func (group *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		group.waitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pool runs jobs concurrently, while making sure that no more than a fixed
+// number of them run at the same time. Submitting a job while that number of
+// jobs are running blocks the caller until a running job finishes, so that
+// callers feel back-pressure instead of piling up an unbounded number of
+// waiting goroutines. It is implemented as a semaphore i.e. a buffered channel
+// that holds a slot for each running job.
+//
+// A Pool is also a Group; jobs given to Go are tracked but are not bounded by
+// the size of the Pool, and Wait waits for both kinds of jobs.
+type Pool struct {
+	Group
+	semaphore chan struct{}
+}
+
+// New creates a Pool that runs at most the given number of jobs at the same
+// time. A size smaller than 1 is treated as 1 so that jobs are always run.
+func New(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Pool{
+		semaphore: make(chan struct{}, size),
+	}
+}
+
+// Submit runs the given job in a new goroutine as soon as a slot is available
+// in the Pool. It blocks the caller while all slots are taken; the slot is
+// taken before the goroutine is started so that no goroutines are created for
+// jobs that cannot run yet.
+//
+// Jobs must not submit other jobs to the same Pool and wait for them, as they
+// would otherwise hold slots that the jobs they wait for need.
+func (pool *Pool) Submit(job func()) {
+	pool.semaphore <- struct{}{}
+	pool.Go(func() {
+		defer func() { <-pool.semaphore }()
+
+		job()
+	})
+}
+
+// Size returns the maximum number of jobs that the Pool runs at the same time.
+func (pool *Pool) Size() int {
+	return cap(pool.semaphore)
+}
@@ -0,0 +1,128 @@
+/**
+ * Tests for the msUtilPool module.
+ */
+
+package msUtilPool
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Tests.
+ */
+
+func TestNew_Size(t *testing.T) {
+	assert.Equal(t, 5, New(5).Size())
+}
+
+func TestNew_InvalidSize(t *testing.T) {
+	assert.Equal(t, 1, New(0).Size())
+	assert.Equal(t, 1, New(-3).Size())
+}
+
+func TestSubmit_BoundsConcurrency(t *testing.T) {
+	pool := New(3)
+
+	var running int32
+	var maxRunning int32
+	var completed int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		pool.Submit(func() {
+			defer wg.Done()
+
+			current := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&completed, 1)
+		})
+	}
+	wg.Wait()
+
+	// All jobs should be run, but never more than the size of the pool at the
+	// same time.
+	assert.Equal(t, int32(20), completed)
+	assert.True(t, maxRunning <= 3, "%d jobs ran at the same time", maxRunning)
+	assert.True(t, maxRunning > 1, "jobs did not run concurrently")
+}
+
+func TestSubmit_BlocksWhenFull(t *testing.T) {
+	pool := New(1)
+	release := make(chan struct{})
+	pool.Submit(func() { <-release })
+
+	// Submitting a job to a full pool should block the caller until a slot is
+	// released.
+	submitted := make(chan struct{})
+	go func() {
+		pool.Submit(func() {})
+		close(submitted)
+	}()
+
+	select {
+	case <-submitted:
+		t.Fatal("submitting a job to a full pool did not block the caller")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Error("the job was not submitted after a slot was released")
+	}
+	assert.Nil(t, pool.Wait(context.Background()))
+}
+
+func TestWait_Finished(t *testing.T) {
+	pool := New(2)
+
+	var completed int32
+	for i := 0; i < 5; i++ {
+		pool.Submit(func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&completed, 1)
+		})
+	}
+	pool.Go(func() {
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&completed, 1)
+	})
+
+	// Both queued and unbounded jobs should be waited for.
+	err := pool.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&completed))
+}
+
+func TestWait_Timeout(t *testing.T) {
+	var group Group
+	release := make(chan struct{})
+	defer close(release)
+	group.Go(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// The jobs should be abandoned when the context is done.
+	err := group.Wait(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
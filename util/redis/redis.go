@@ -0,0 +1,309 @@
+/**
+ * Provides functionality for connecting to Redis that is shared by the Redis
+ * storage engines of all components.
+ */
+
+package msUtilRedis
+
+import (
+	// Utilities.
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	// Redis.
+	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/mediocregopher/radix.v2/redis"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+)
+
+/**
+ * Constants.
+ */
+
+// PoolSizeDefault holds the number of connections kept in a pool when no size
+// is given in the configuration.
+const PoolSizeDefault = 10
+
+// CompressedPrefix holds the bytes that values compressed by CompressValue()
+// start with. JSON documents cannot start with a null byte, so compressed values
+// can be told apart from values stored uncompressed, such as before compression
+// was enabled.
+const CompressedPrefix = "\x00gz"
+
+/**
+ * Public API.
+ */
+
+// Client is an interface that is satisfied by single Redis connections and by
+// pools of connections alike. It allows dependency injection of the client that
+// the functions of this package make requests with, which is necessary for
+// testing purposes.
+type Client interface {
+	Cmd(string, ...interface{}) *redis.Resp
+}
+
+// NewPool creates a pool of connections to the Redis server defined in the
+// given storage configuration. The "dsn" option is required, while the
+// "pool_size" option can optionally define the number of connections kept in
+// the pool. The "password" and "db" options can optionally define the password
+// that connections authenticate with and the index of the database that they
+// select. A pool can safely be used by concurrent requests, contrary to a
+// single connection.
+func NewPool(config map[string]interface{}) (*pool.Pool, error) {
+	dsn, ok := config["dsn"].(string)
+	if !ok || dsn == "" {
+		err := fmt.Errorf("the DSN configuration option is required for the Redis storage: %w", errorsUtil.ErrInvalidConfig)
+		return nil, err
+	}
+
+	size, err := poolSize(config)
+	if err != nil {
+		return nil, err
+	}
+
+	password, db, err := connectionOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := pool.NewCustom("tcp", dsn, size, dialFunc(password, db))
+	if err != nil {
+		err := fmt.Errorf("failed to connect to Redis: %s", err.Error())
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Dial opens a single connection to the Redis server at the given DSN, and
+// prepares it with the given password and database index in the same way as
+// the connections of the pools created by NewPool(). It is meant for
+// connections that cannot be shared in a pool, such as Pub/Sub subscriptions.
+// No password and the database with index 0 are used when not given.
+func Dial(dsn string, password string, db int) (*redis.Client, error) {
+	if db < 0 {
+		return nil, fmt.Errorf("the database index cannot be negative: %w", errorsUtil.ErrInvalidConfig)
+	}
+
+	client, err := dialFunc(password, db)("tcp", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %s", err.Error())
+	}
+
+	return client, nil
+}
+
+// NextID generates the ID of a new item, such as a Watch, by atomically
+// incrementing the counter stored at the given key, so that concurrent requests
+// never get the same ID. The given index key holds the sorted set of the
+// existing items scored by their IDs.
+//
+// Items created before the counters were introduced only exist on their index
+// set. The counter is seeded with the highest ID on the index set the first
+// time it is used; SETNX makes sure that a counter seeded in the meantime by a
+// concurrent request is not overridden.
+func NextID(client Client, counterKey string, indexKey string) (int, error) {
+	exists, err := client.Cmd("EXISTS", counterKey).Int()
+	if err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		r, err := client.Cmd("ZREVRANGE", indexKey, 0, 0, "WITHSCORES").List()
+		if err != nil {
+			return 0, err
+		}
+
+		latestID := 0
+		if len(r) != 0 {
+			latestID, err = strconv.Atoi(r[1])
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		err = client.Cmd("SETNX", counterKey, latestID).Err
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return client.Cmd("INCR", counterKey).Int()
+}
+
+// Compression returns whether the Redis storage engines should compress the
+// values that they store, as defined by the "compress" option of the given
+// storage configuration. Values are not compressed by default.
+func Compression(config map[string]interface{}) (bool, error) {
+	value, ok := config["compress"]
+	if !ok {
+		return false, nil
+	}
+
+	compress, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("the \"compress\" configuration option must be a boolean: %w", errorsUtil.ErrInvalidConfig)
+	}
+
+	return compress, nil
+}
+
+// CompressValue compresses the given value with gzip and prefixes it with
+// CompressedPrefix, so that DecompressValue() can detect it.
+func CompressValue(value []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(CompressedPrefix)
+
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write(value)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// DecompressValue returns the original value of the given stored value. Values
+// compressed by CompressValue() are decompressed, while any other values are
+// returned as they are so that values stored uncompressed can still be read.
+func DecompressValue(value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, []byte(CompressedPrefix)) {
+		return value, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(value[len(CompressedPrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the stored value: %s", err.Error())
+	}
+	defer reader.Close()
+
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the stored value: %s", err.Error())
+	}
+
+	return decompressed, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// dialFunc returns a function that connects to Redis and prepares every new
+// connection of a pool with the given password and database index.
+func dialFunc(password string, db int) pool.DialFunc {
+	return func(network string, addr string) (*redis.Client, error) {
+		client, err := redis.Dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		err = prepare(client, password, db)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+
+		return client, nil
+	}
+}
+
+// prepare authenticates the given connection with the given password and it
+// selects the database with the given index, when given. It then checks that
+// the connection can be used, so that a server that requires a password is
+// reported when none is given.
+func prepare(client Client, password string, db int) error {
+	if password != "" {
+		err := client.Cmd("AUTH", password).Err
+		if err != nil {
+			return fmt.Errorf("failed to authenticate: %s", err.Error())
+		}
+	}
+
+	if db != 0 {
+		err := client.Cmd("SELECT", db).Err
+		if err != nil {
+			return noAuthError(fmt.Errorf("failed to select the database %d: %s", db, err.Error()), password)
+		}
+	}
+
+	return noAuthError(client.Cmd("PING").Err, password)
+}
+
+// noAuthError returns a clearer error than the one returned by the server when
+// it requires authentication and no password was given. Other errors are
+// returned as they are.
+func noAuthError(err error, password string) error {
+	if err == nil || password != "" || !strings.Contains(err.Error(), "NOAUTH") {
+		return err
+	}
+
+	return fmt.Errorf("the Redis server requires authentication but the \"password\" configuration option was not given: %w", errorsUtil.ErrInvalidConfig)
+}
+
+// connectionOptions returns the password and the database index defined in the
+// given storage configuration. No password and the database with index 0 are
+// used by default.
+func connectionOptions(config map[string]interface{}) (string, int, error) {
+	var password string
+	if value, ok := config["password"]; ok {
+		password, ok = value.(string)
+		if !ok {
+			return "", 0, fmt.Errorf("the \"password\" configuration option must be a string: %w", errorsUtil.ErrInvalidConfig)
+		}
+	}
+
+	var db int
+	switch v := config["db"].(type) {
+	case nil:
+	case int:
+		db = v
+	case float64:
+		db = int(v)
+		if float64(db) != v {
+			return "", 0, fmt.Errorf("the \"db\" configuration option must be an integer: %w", errorsUtil.ErrInvalidConfig)
+		}
+	default:
+		return "", 0, fmt.Errorf("the \"db\" configuration option must be a number: %w", errorsUtil.ErrInvalidConfig)
+	}
+	if db < 0 {
+		return "", 0, fmt.Errorf("the \"db\" configuration option cannot be negative: %w", errorsUtil.ErrInvalidConfig)
+	}
+
+	return password, db, nil
+}
+
+// poolSize returns the pool size defined in the given storage configuration,
+// or the default size if none is defined. Numbers decoded from JSON are
+// float64, while numbers given in code are usually int; both are accepted.
+func poolSize(config map[string]interface{}) (int, error) {
+	value, ok := config["pool_size"]
+	if !ok {
+		return PoolSizeDefault, nil
+	}
+
+	var size int
+	switch v := value.(type) {
+	case int:
+		size = v
+	case float64:
+		size = int(v)
+	default:
+		return 0, fmt.Errorf("the \"pool_size\" configuration option must be a number: %w", errorsUtil.ErrInvalidConfig)
+	}
+
+	if size < 1 {
+		return 0, fmt.Errorf("the \"pool_size\" configuration option must be a positive number: %w", errorsUtil.ErrInvalidConfig)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,246 @@
+/**
+ * Tests for the msUtilRedis module.
+ */
+
+package msUtilRedis
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"errors"
+	"fmt"
+	"strings"
+
+	// Redis.
+	"github.com/mediocregopher/radix.v2/redis"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	redisTest "github.com/krystalcode/go-mantis-shrimp/util/redis/redistest"
+)
+
+/**
+ * Tests.
+ */
+
+func TestNewPool_MissingDSN(t *testing.T) {
+	config := map[string]interface{}{"type": "redis"}
+	_, err := NewPool(config)
+	assert.NotNil(t, err)
+}
+
+func TestDial_NegativeDB(t *testing.T) {
+	client, err := Dial("localhost:6379", "", -1)
+	assert.Nil(t, client)
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+}
+
+func TestNextID(t *testing.T) {
+	client := redisTest.NewClient()
+	for expected := 1; expected <= 2; expected++ {
+		id, err := NextID(client, "watches_next_id", "watches")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, id)
+	}
+}
+
+func TestNextID_SeedsCounterFromIndex(t *testing.T) {
+	client := redisTest.NewClient()
+
+	// Simulate items created before the counter was introduced.
+	client.Cmd("ZADD", "watches", 3, "watch:3")
+	client.Cmd("ZADD", "watches", 5, "watch:5")
+
+	id, err := NextID(client, "watches_next_id", "watches")
+	assert.Nil(t, err)
+	assert.Equal(t, 6, id)
+
+	// The counter is seeded only once; items later added to the index set by
+	// their ID do not change it.
+	client.Cmd("ZADD", "watches", 10, "watch:10")
+	id, err = NextID(client, "watches_next_id", "watches")
+	assert.Nil(t, err)
+	assert.Equal(t, 7, id)
+}
+
+func TestNextID_RedisError(t *testing.T) {
+	_, err := NextID(&TestClient{password: "secret"}, "watches_next_id", "watches")
+	assert.NotNil(t, err)
+}
+
+func TestCompression(t *testing.T) {
+	compress, err := Compression(map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.False(t, compress)
+
+	compress, err = Compression(map[string]interface{}{"compress": true})
+	assert.Nil(t, err)
+	assert.True(t, compress)
+
+	_, err = Compression(map[string]interface{}{"compress": "yes"})
+	assert.True(t, errors.Is(err, errorsUtil.ErrInvalidConfig))
+}
+
+func TestCompressValue(t *testing.T) {
+	value := []byte(`{"type":"health_check","watch":{"name":"` + strings.Repeat("Test Watch ", 100) + `"}}`)
+
+	compressed, err := CompressValue(value)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(compressed), CompressedPrefix))
+	assert.True(t, len(compressed) < len(value))
+
+	decompressed, err := DecompressValue(compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, value, decompressed)
+}
+
+func TestDecompressValue_Uncompressed(t *testing.T) {
+	value := []byte(`{"type":"health_check","watch":{}}`)
+	decompressed, err := DecompressValue(value)
+	assert.Nil(t, err)
+	assert.Equal(t, value, decompressed)
+}
+
+func TestDecompressValue_Corrupted(t *testing.T) {
+	_, err := DecompressValue([]byte(CompressedPrefix + "not gzip"))
+	assert.NotNil(t, err)
+}
+
+/**
+ * Tests for functions/types for internal use.
+ */
+
+func TestPoolSize_Default(t *testing.T) {
+	size, err := poolSize(map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.Equal(t, PoolSizeDefault, size)
+}
+
+func TestPoolSize_JSON(t *testing.T) {
+	size, err := poolSize(map[string]interface{}{"pool_size": float64(20)})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, size)
+}
+
+func TestPoolSize_Invalid(t *testing.T) {
+	_, err := poolSize(map[string]interface{}{"pool_size": "20"})
+	assert.NotNil(t, err)
+
+	_, err = poolSize(map[string]interface{}{"pool_size": 0})
+	assert.NotNil(t, err)
+}
+
+func TestConnectionOptions_Default(t *testing.T) {
+	password, db, err := connectionOptions(map[string]interface{}{"dsn": "redis:6379"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", password)
+	assert.Equal(t, 0, db)
+}
+
+func TestConnectionOptions_Success(t *testing.T) {
+	password, db, err := connectionOptions(map[string]interface{}{
+		"password": "secret",
+		"db":       float64(2),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, 2, db)
+
+	_, db, err = connectionOptions(map[string]interface{}{"db": 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, db)
+}
+
+func TestConnectionOptions_Invalid(t *testing.T) {
+	configs := []map[string]interface{}{
+		{"password": 1234},
+		{"db": "2"},
+		{"db": float64(1.5)},
+		{"db": -1},
+	}
+	for index, config := range configs {
+		_, _, err := connectionOptions(config)
+		assert.NotNil(t, err, "case %d", index)
+	}
+}
+
+func TestPrepare_Success(t *testing.T) {
+	client := &TestClient{password: "secret"}
+	err := prepare(client, "secret", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"AUTH", "SELECT", "PING"}, client.commands)
+	assert.Equal(t, 2, client.db)
+
+	// Nothing but a check is needed when there are no options.
+	client = &TestClient{}
+	err = prepare(client, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PING"}, client.commands)
+}
+
+func TestPrepare_WrongPassword(t *testing.T) {
+	client := &TestClient{password: "secret"}
+	err := prepare(client, "wrong", 0)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to authenticate")
+}
+
+func TestPrepare_MissingPassword(t *testing.T) {
+	client := &TestClient{password: "secret"}
+	err := prepare(client, "", 0)
+	assert.EqualError(
+		t,
+		err,
+		"the Redis server requires authentication but the \"password\" configuration option was not given: invalid configuration",
+	)
+
+	// The same when selecting a database.
+	err = prepare(client, "", 2)
+	assert.EqualError(
+		t,
+		err,
+		"the Redis server requires authentication but the \"password\" configuration option was not given: invalid configuration",
+	)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// TestClient is a Redis client that requires the given password, if any, before
+// accepting other commands, similarly to a Redis server.
+type TestClient struct {
+	password      string
+	authenticated bool
+	db            int
+	commands      []string
+}
+
+func (c *TestClient) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	c.commands = append(c.commands, cmd)
+
+	if cmd == "AUTH" {
+		if args[0] != c.password {
+			return redis.NewResp(fmt.Errorf("WRONGPASS invalid username-password pair"))
+		}
+		c.authenticated = true
+		return redis.NewResp("OK")
+	}
+
+	if c.password != "" && !c.authenticated {
+		return redis.NewResp(fmt.Errorf("NOAUTH Authentication required."))
+	}
+
+	switch cmd {
+	case "SELECT":
+		c.db = args[0].(int)
+		return redis.NewResp("OK")
+	case "PING":
+		return redis.NewResp("PONG")
+	}
+
+	return redis.NewResp(fmt.Errorf("unsupported command \"%s\"", cmd))
+}
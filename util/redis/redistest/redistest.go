@@ -0,0 +1,400 @@
+/**
+ * Provides an in-memory Redis client for testing the Redis storage engines of
+ * all components without a Redis server.
+ */
+
+package msUtilRedisTest
+
+import (
+	// Utilities.
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	// Redis.
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+/**
+ * Public API.
+ */
+
+// Script emulates a Lua script given to EVAL. It is given the client and the
+// arguments that follow the script, starting with the number of keys. It is
+// called without the client being locked, so that it can use the client's
+// methods.
+type Script func(client *Client, args []interface{}) *redis.Resp
+
+// Client is an in-memory implementation of the subset of Redis commands used by
+// the Redis storage engines. Scripts are not evaluated; EVAL runs the Script
+// emulating them, if one is given via HandleScript(). It can be shared by
+// concurrent requests.
+type Client struct {
+	mutex  sync.Mutex
+	values map[string]string
+	hashes map[string]map[string]string
+	lists  map[string][]string
+	scores map[string]map[string]int64
+	// The number of ZADD commands received per sorted set.
+	zadds   map[string]int
+	scripts map[string]Script
+}
+
+// NewClient creates a client that holds no keys.
+func NewClient() *Client {
+	return &Client{
+		values:  make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		lists:   make(map[string][]string),
+		scores:  make(map[string]map[string]int64),
+		zadds:   make(map[string]int),
+		scripts: make(map[string]Script),
+	}
+}
+
+// HandleScript makes EVAL run the given Script when it is given the source of
+// the given Lua script.
+func (client *Client) HandleScript(script string, handler Script) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.scripts[script] = handler
+}
+
+// Value returns the string value stored at the given key, and whether there is
+// one.
+func (client *Client) Value(key string) (string, bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	value, ok := client.values[key]
+	return value, ok
+}
+
+// SetValue stores the given string value at the given key.
+func (client *Client) SetValue(key string, value string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.values[key] = value
+}
+
+// Hash returns a copy of the fields of the Hash stored at the given key.
+func (client *Client) Hash(key string) map[string]string {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	hash := make(map[string]string, len(client.hashes[key]))
+	for field, value := range client.hashes[key] {
+		hash[field] = value
+	}
+	return hash
+}
+
+// SetHash replaces the Hash stored at the given key with the given fields.
+func (client *Client) SetHash(key string, fields map[string]string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.hashes[key] = make(map[string]string, len(fields))
+	for field, value := range fields {
+		client.hashes[key][field] = value
+	}
+}
+
+// Scores returns a copy of the members of the sorted set stored at the given
+// key, together with their scores.
+func (client *Client) Scores(key string) map[string]int64 {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	scores := make(map[string]int64, len(client.scores[key]))
+	for member, score := range client.scores[key] {
+		scores[member] = score
+	}
+	return scores
+}
+
+// ZAdds returns the number of ZADD commands received for the sorted set stored
+// at the given key.
+func (client *Client) ZAdds(key string) int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.zadds[key]
+}
+
+// Delete removes the given key, whatever the type of the value stored at it.
+func (client *Client) Delete(key string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.delete(key)
+}
+
+// Cmd implements the Cmd() function of the Redis clients that the storage
+// engines are given. Unsupported commands fail with an error.
+func (client *Client) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	if cmd == "EVAL" {
+		return client.eval(args)
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	switch cmd {
+	case "PING":
+		return redis.NewResp("PONG")
+	case "EXISTS":
+		return redis.NewResp(client.exists(args[0].(string)))
+	case "GET":
+		value, ok := client.values[args[0].(string)]
+		if !ok {
+			return redis.NewResp(nil)
+		}
+		return redis.NewResp(value)
+	case "SET":
+		// Only the NX and XX options are supported.
+		key := args[0].(string)
+		_, exists := client.values[key]
+		for _, option := range args[2:] {
+			switch option {
+			case "NX":
+				if exists {
+					return redis.NewResp(nil)
+				}
+			case "XX":
+				if !exists {
+					return redis.NewResp(nil)
+				}
+			}
+		}
+		client.values[key] = format(args[1])
+		return redis.NewResp("OK")
+	case "SETNX":
+		key := args[0].(string)
+		if _, ok := client.values[key]; ok {
+			return redis.NewResp(0)
+		}
+		client.values[key] = format(args[1])
+		return redis.NewResp(1)
+	case "INCR":
+		key := args[0].(string)
+		value, _ := strconv.Atoi(client.values[key])
+		client.values[key] = strconv.Itoa(value + 1)
+		return redis.NewResp(value + 1)
+	case "DEL":
+		deleted := 0
+		for _, key := range flatten(args) {
+			if client.exists(key) {
+				deleted++
+			}
+			client.delete(key)
+		}
+		return redis.NewResp(deleted)
+	case "HMSET":
+		// Fields are added to the Hash, or replace the existing ones; fields that
+		// are not given are kept.
+		key := args[0].(string)
+		fields := flatten(args[1:])
+		if client.hashes[key] == nil {
+			client.hashes[key] = make(map[string]string)
+		}
+		for index := 0; index+1 < len(fields); index += 2 {
+			client.hashes[key][fields[index]] = fields[index+1]
+		}
+		return redis.NewResp("OK")
+	case "HDEL":
+		key := args[0].(string)
+		deleted := 0
+		for _, field := range flatten(args[1:]) {
+			if _, ok := client.hashes[key][field]; ok {
+				deleted++
+			}
+			delete(client.hashes[key], field)
+		}
+		if len(client.hashes[key]) == 0 {
+			delete(client.hashes, key)
+		}
+		return redis.NewResp(deleted)
+	case "HGETALL":
+		// The fields are returned in the order of their names, so that tests are
+		// deterministic.
+		hash := client.hashes[args[0].(string)]
+		names := make([]string, 0, len(hash))
+		for name := range hash {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields := []string{}
+		for _, name := range names {
+			fields = append(fields, name, hash[name])
+		}
+		return redis.NewResp(fields)
+	case "LPUSH":
+		key := args[0].(string)
+		for _, value := range flatten(args[1:]) {
+			client.lists[key] = append([]string{value}, client.lists[key]...)
+		}
+		return redis.NewResp(len(client.lists[key]))
+	case "LTRIM", "LRANGE":
+		// Only non-negative starts are supported.
+		key := args[0].(string)
+		list := client.lists[key]
+		start, stop := args[1].(int), args[2].(int)
+		if stop < 0 || stop >= len(list) {
+			stop = len(list) - 1
+		}
+		result := []string{}
+		if start <= stop {
+			result = append(result, list[start:stop+1]...)
+		}
+		if cmd == "LRANGE" {
+			return redis.NewResp(result)
+		}
+		client.lists[key] = result
+		return redis.NewResp("OK")
+	case "ZADD":
+		key := args[0].(string)
+		client.zadds[key]++
+		if client.scores[key] == nil {
+			client.scores[key] = make(map[string]int64)
+		}
+		score, err := strconv.ParseInt(format(args[1]), 10, 64)
+		if err != nil {
+			return redis.NewResp(fmt.Errorf("ERR value is not an integer or out of range"))
+		}
+		member := format(args[2])
+		_, exists := client.scores[key][member]
+		client.scores[key][member] = score
+		if exists {
+			return redis.NewResp(0)
+		}
+		return redis.NewResp(1)
+	case "ZREM":
+		key := args[0].(string)
+		member := format(args[1])
+		if _, ok := client.scores[key][member]; !ok {
+			return redis.NewResp(0)
+		}
+		delete(client.scores[key], member)
+		return redis.NewResp(1)
+	case "ZRANGE", "ZREVRANGE":
+		// Only non-negative starts are supported.
+		key := args[0].(string)
+		members := client.sortedMembers(key, cmd == "ZREVRANGE")
+		start, stop := args[1].(int), args[2].(int)
+		if stop < 0 || stop >= len(members) {
+			stop = len(members) - 1
+		}
+		withScores := len(args) > 3 && args[3] == "WITHSCORES"
+		result := []string{}
+		for index := start; index <= stop; index++ {
+			result = append(result, members[index])
+			if withScores {
+				result = append(result, strconv.FormatInt(client.scores[key][members[index]], 10))
+			}
+		}
+		return redis.NewResp(result)
+	case "ZRANGEBYSCORE":
+		// Only exclusive minimums, an infinite maximum and a limit from the start
+		// are supported e.g. "(3" "+inf" "WITHSCORES" "LIMIT" 0 10.
+		key := args[0].(string)
+		min, _ := strconv.ParseInt(strings.TrimPrefix(args[1].(string), "("), 10, 64)
+		count := args[6].(int)
+		result := []string{}
+		for _, member := range client.sortedMembers(key, false) {
+			score := client.scores[key][member]
+			if score <= min || len(result) == 2*count {
+				continue
+			}
+			result = append(result, member, strconv.FormatInt(score, 10))
+		}
+		return redis.NewResp(result)
+	}
+
+	return redis.NewResp(fmt.Errorf("unsupported command \"%s\"", cmd))
+}
+
+/**
+ * For internal use.
+ */
+
+// eval runs the Script emulating the Lua script given as the first argument.
+func (client *Client) eval(args []interface{}) *redis.Resp {
+	client.mutex.Lock()
+	handler, ok := client.scripts[format(args[0])]
+	client.mutex.Unlock()
+	if !ok {
+		return redis.NewResp(fmt.Errorf("unsupported script \"%s\"", format(args[0])))
+	}
+
+	return handler(client, args[1:])
+}
+
+// exists returns whether a value of any type is stored at the given key. The
+// client must be locked.
+func (client *Client) exists(key string) bool {
+	_, isValue := client.values[key]
+	_, isHash := client.hashes[key]
+	_, isList := client.lists[key]
+	_, isSortedSet := client.scores[key]
+	return isValue || isHash || isList || isSortedSet
+}
+
+// delete removes the value of any type stored at the given key. The client must
+// be locked.
+func (client *Client) delete(key string) {
+	delete(client.values, key)
+	delete(client.hashes, key)
+	delete(client.lists, key)
+	delete(client.scores, key)
+}
+
+// sortedMembers returns the members of the sorted set stored at the given key in
+// the order of their scores, or in the reverse order. The client must be
+// locked.
+func (client *Client) sortedMembers(key string, reverse bool) []string {
+	scores := client.scores[key]
+	members := make([]string, 0, len(scores))
+	for member := range scores {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if scores[members[i]] == scores[members[j]] {
+			return members[i] < members[j]
+		}
+		if reverse {
+			return scores[members[i]] > scores[members[j]]
+		}
+		return scores[members[i]] < scores[members[j]]
+	})
+	return members
+}
+
+// flatten formats the given arguments as Redis does, expanding slices into
+// their elements the same way that the Redis client does.
+func flatten(args []interface{}) []string {
+	var flattened []string
+	for _, arg := range args {
+		switch value := arg.(type) {
+		case []interface{}:
+			flattened = append(flattened, flatten(value)...)
+		case []string:
+			flattened = append(flattened, value...)
+		default:
+			flattened = append(flattened, format(value))
+		}
+	}
+	return flattened
+}
+
+// format formats the given argument as the string that Redis stores for it;
+// booleans are stored as integers.
+func format(arg interface{}) string {
+	switch value := arg.(type) {
+	case []byte:
+		return string(value)
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,87 @@
+/**
+ * Tests for the msUtilRedisTest module.
+ */
+
+package msUtilRedisTest
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Redis.
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+/**
+ * Tests.
+ */
+
+func TestHash(t *testing.T) {
+	client := NewClient()
+
+	// Fields are given as a single slice, as the storage engines do, and
+	// booleans are stored as integers.
+	err := client.Cmd("HMSET", "schedule:1", []interface{}{"interval", 60, "enabled", true, "cron_expr", "* * * * *"}).Err
+	assert.Nil(t, err)
+
+	// Fields that are not given again are kept.
+	err = client.Cmd("HMSET", "schedule:1", []interface{}{"interval", 120}).Err
+	assert.Nil(t, err)
+	fields, err := client.Cmd("HGETALL", "schedule:1").List()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cron_expr", "* * * * *", "enabled", "1", "interval", "120"}, fields)
+
+	deleted, err := client.Cmd("HDEL", "schedule:1", "cron_expr", "next").Int()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, map[string]string{"enabled": "1", "interval": "120"}, client.Hash("schedule:1"))
+
+	// Deleting the key deletes the whole Hash.
+	deleted, err = client.Cmd("DEL", "schedule:1").Int()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	exists, err := client.Cmd("EXISTS", "schedule:1").Int()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exists)
+}
+
+func TestSortedSet(t *testing.T) {
+	client := NewClient()
+	client.Cmd("ZADD", "watches", 2, "watch:2")
+	client.Cmd("ZADD", "watches", 1, "watch:1")
+	client.Cmd("ZADD", "watches", 3, "watch:3")
+
+	members, err := client.Cmd("ZREVRANGE", "watches", 0, 0, "WITHSCORES").List()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"watch:3", "3"}, members)
+
+	members, err = client.Cmd("ZRANGEBYSCORE", "watches", "(1", "+inf", "WITHSCORES", "LIMIT", 0, 1).List()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"watch:2", "2"}, members)
+
+	assert.Equal(t, 3, client.ZAdds("watches"))
+	assert.Equal(t, map[string]int64{"watch:1": 1, "watch:2": 2, "watch:3": 3}, client.Scores("watches"))
+}
+
+func TestEval(t *testing.T) {
+	client := NewClient()
+
+	// Scripts fail unless they are emulated.
+	assert.NotNil(t, client.Cmd("EVAL", "return 1", 0).Err)
+
+	client.HandleScript("return ARGV[1]", func(client *Client, args []interface{}) *redis.Resp {
+		client.SetValue("called", "1")
+		return redis.NewResp(args[1])
+	})
+	value, err := client.Cmd("EVAL", "return ARGV[1]", 0, "value").Str()
+	assert.Nil(t, err)
+	assert.Equal(t, "value", value)
+	called, ok := client.Value("called")
+	assert.True(t, ok)
+	assert.Equal(t, "1", called)
+}
+
+func TestCmd_Unsupported(t *testing.T) {
+	assert.NotNil(t, NewClient().Cmd("SUBSCRIBE", "channel").Err)
+}
@@ -2,12 +2,34 @@ package msUtil
 
 import (
 	// Utilities.
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	// Internal dependencies.
+	version "github.com/krystalcode/go-mantis-shrimp/util/version"
 )
 
+// ShutdownGracePeriodDefault holds the time that programs are given to finish
+// any work in progress when asked to shut down, if no grace period is given in
+// their configuration.
+const ShutdownGracePeriodDefault = 10 * time.Second
+
+// UserAgent returns the value of the User-Agent header sent with the HTTP
+// requests made by the given component e.g. "mantis-shrimp/cron/1.0.0", so that
+// they can be identified in the logs of the servers that receive them.
+func UserAgent(component string) string {
+	return "mantis-shrimp/" + component + "/" + version.Version
+}
+
 // StringToIntegers converts an input of comma-separated string values to
 // a map where the keys are the input values converted to integers. We return
 // them as the keys to keep the algorithm more efficient. Since we will be
@@ -31,6 +53,41 @@ func StringToIntegers(input string, delimiter string) (map[int]struct{}, error)
 	return aInt, nil
 }
 
+// UniqueInts returns the given integers with the values given more than once
+// only included once, at the position they first appear.
+func UniqueInts(values []int) []int {
+	unique := make([]int, 0, len(values))
+	seen := make(map[int]struct{}, len(values))
+	for _, value := range values {
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		unique = append(unique, value)
+	}
+
+	return unique
+}
+
+// StringToIntSlice converts an input of delimiter-separated string values to a
+// slice of integers. The integers are returned in the order they are given in
+// the input; values given more than once are only included once, at the
+// position they first appear.
+func StringToIntSlice(input string, delimiter string) ([]int, error) {
+	aString := strings.Split(input, delimiter)
+	aInt := make([]int, 0, len(aString))
+
+	for _, s := range aString {
+		i, err := strconv.Atoi(strings.Trim(s, " "))
+		if err != nil {
+			return nil, err
+		}
+		aInt = append(aInt, i)
+	}
+
+	return UniqueInts(aInt), nil
+}
+
 // ReadJSONFile loads a file containing JSON data into the given struct pointer.
 // Note that the compiler cannot check whether the provided value is a pointer
 // and not giving a pointer to a struct will throw a runtime error.
@@ -46,3 +103,228 @@ func ReadJSONFile(filepath string, object interface{}) error {
 
 	return nil
 }
+
+// ReadJSONFileExpandEnv loads a file containing JSON data into the given struct
+// pointer, same as ReadJSONFile does, after expanding references to
+// environment variables in the form "$VAR" or "${VAR}" in the string values of
+// the data. It is meant for configuration files, so that secrets such as API
+// keys and passwords can be given via the environment; values are expanded only
+// while loading the file, and not when they are later used e.g. in messages.
+//
+// Referencing a variable that is not set is an error, so that a missing secret
+// is detected when the program starts rather than when it is first needed. A
+// variable that is set to an empty string expands to an empty string. A literal
+// dollar sign can be given as "$$".
+func ReadJSONFileExpandEnv(filepath string, object interface{}) error {
+	bytes, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	// Decode the data generically so that only the string values are expanded,
+	// and the values of the variables cannot change the structure of the data.
+	// Numbers are kept as they are given.
+	decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+	decoder.UseNumber()
+	var data interface{}
+	err = decoder.Decode(&data)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	data = expandEnv(data, &missing)
+	if len(missing) != 0 {
+		return fmt.Errorf(
+			"the environment variables referenced in \"%s\" are not set: %s",
+			filepath,
+			strings.Join(missing, ", "),
+		)
+	}
+
+	bytes, err = json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, object)
+}
+
+// ConfigFilePath returns the path to the configuration file that should be
+// loaded by a program. The path given via the command line has priority; if it
+// is empty, the program's default path is used instead.
+func ConfigFilePath(flagPath string, defaultPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+
+	return defaultPath
+}
+
+// ShutdownContext returns a context that is cancelled when the program receives
+// an interrupt or a termination signal, so that long-running loops and servers
+// can stop gracefully. The returned function cancels the context, and stops
+// listening for signals, as well.
+func ShutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+
+	return ctx, cancel
+}
+
+// ParseGracePeriod converts the shutdown grace period, as given in the
+// configuration, to a duration. The default grace period is returned if none is
+// given.
+func ParseGracePeriod(value string) (time.Duration, error) {
+	if value == "" {
+		return ShutdownGracePeriodDefault, nil
+	}
+
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if gracePeriod < 0 {
+		return 0, fmt.Errorf("the grace period cannot be negative")
+	}
+
+	return gracePeriod, nil
+}
+
+// Duration wraps time.Duration so that durations can be given in JSON either
+// as strings e.g. "30s" or as numbers of nanoseconds, as decoded by
+// DecodeDuration(). Durations are encoded as numbers of nanoseconds so that
+// they remain readable by clients that expect them as such.
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler. It encodes the duration as a number of
+// nanoseconds.
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(duration.Nanoseconds())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It decodes the duration from a
+// string or from a number of nanoseconds. A null value leaves the duration
+// unchanged.
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	decoded, err := DecodeDuration(data)
+	if err != nil {
+		return err
+	}
+	duration.Duration = decoded
+
+	return nil
+}
+
+// DecodeDuration decodes a duration given in JSON either as a string that can
+// be parsed by time.ParseDuration() e.g. "5m" or "1h30m", or as an integer
+// holding the number of nanoseconds e.g. 300000000000.
+func DecodeDuration(data []byte) (time.Duration, error) {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return time.ParseDuration(v)
+	case float64:
+		var nanoseconds int64
+		err = json.Unmarshal(data, &nanoseconds)
+		if err != nil {
+			return 0, fmt.Errorf("the duration must be given in whole nanoseconds: %s", string(data))
+		}
+		return time.Duration(nanoseconds), nil
+	default:
+		return 0, fmt.Errorf("the duration must be given as a string or as a number of nanoseconds: %s", string(data))
+	}
+}
+
+// URLAllowList holds the regular expressions that URLs are required to match,
+// such as the URLs that Actions make requests to. An empty list allows all URLs.
+type URLAllowList []*regexp.Regexp
+
+// NewURLAllowList compiles the given patterns into a URLAllowList. The patterns
+// are not anchored i.e. they match any part of the URL, unless they start with
+// "^" and end with "$" e.g. "^https://hooks\.example\.com/".
+func NewURLAllowList(patterns []string) (URLAllowList, error) {
+	list := make(URLAllowList, 0, len(patterns))
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern \"%s\": %s", pattern, err.Error())
+		}
+		list = append(list, regex)
+	}
+
+	return list, nil
+}
+
+// Allowed returns whether the given URL matches any of the patterns in the
+// list, or whether the list is empty.
+func (list URLAllowList) Allowed(URL string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, regex := range list {
+		if regex.MatchString(URL) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandEnv expands the references to environment variables in the string
+// values contained in the given generically decoded JSON data. The names of the
+// referenced variables that are not set are appended to the given slice, once
+// each.
+func expandEnv(data interface{}, missing *[]string) interface{} {
+	switch value := data.(type) {
+	case string:
+		return os.Expand(value, func(name string) string {
+			if name == "$" {
+				return "$"
+			}
+			envValue, ok := os.LookupEnv(name)
+			if !ok {
+				for _, missingName := range *missing {
+					if missingName == name {
+						return ""
+					}
+				}
+				*missing = append(*missing, name)
+			}
+			return envValue
+		})
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = expandEnv(element, missing)
+		}
+	case []interface{}:
+		for index, element := range value {
+			value[index] = expandEnv(element, missing)
+		}
+	}
+
+	return data
+}
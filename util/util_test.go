@@ -10,8 +10,17 @@ import (
 	"testing"
 
 	// Utilities.
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	// Internal dependencies.
+	version "github.com/krystalcode/go-mantis-shrimp/util/version"
 )
 
 /**
@@ -45,6 +54,44 @@ func TestStringToIntegers_ContainsString(t *testing.T) {
 	assert.Nil(t, aIDsIntResult)
 }
 
+func TestStringToIntSlice_Order(t *testing.T) {
+	aIDsIntResult, err := StringToIntSlice("3, 1,2 ", ",")
+	assert.Nil(t, err)
+
+	// The integers should be in the order they are given.
+	assert.Equal(t, []int{3, 1, 2}, aIDsIntResult)
+}
+
+func TestStringToIntSlice_Duplicates(t *testing.T) {
+	aIDsIntResult, err := StringToIntSlice("2,1,2,3,1", ",")
+	assert.Nil(t, err)
+
+	// Duplicates should be removed, keeping the position of their first
+	// appearance.
+	assert.Equal(t, []int{2, 1, 3}, aIDsIntResult)
+}
+
+func TestUserAgent(t *testing.T) {
+	original := version.Version
+	defer func() { version.Version = original }()
+	version.Version = "1.2.3"
+
+	assert.Equal(t, "mantis-shrimp/cron/1.2.3", UserAgent("cron"))
+}
+
+func TestUniqueInts(t *testing.T) {
+	assert.Equal(t, []int{4, 1, 3}, UniqueInts([]int{4, 1, 4, 3, 1}))
+	assert.Equal(t, []int{}, UniqueInts(nil))
+}
+
+func TestStringToIntSlice_ContainsString(t *testing.T) {
+	aIDsIntResult, err := StringToIntSlice("1, 2,h ", ",")
+
+	// There should be an error and no result.
+	assert.NotNil(t, err)
+	assert.Nil(t, aIDsIntResult)
+}
+
 func TestReadJSONFile_Success(t *testing.T) {
 	structDesired := CorrectJSONStruct{"A"}
 	var structResult CorrectJSONStruct
@@ -73,10 +120,79 @@ func TestReadJSONFile_Failure(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestReadJSONFileExpandEnv(t *testing.T) {
+	os.Setenv("MS_TEST_SECRET", "s3cr\"et")
+	defer os.Unsetenv("MS_TEST_SECRET")
+	os.Setenv("MS_TEST_EMPTY", "")
+	defer os.Unsetenv("MS_TEST_EMPTY")
+
+	filename := testJSONFile(t, `{
+		"some_string": "key-${MS_TEST_SECRET}",
+		"nested": {"values": ["$MS_TEST_SECRET", "[$MS_TEST_EMPTY]", "costs $$5", "$"]},
+		"number": 12345678901234567890
+	}`)
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	var result struct {
+		SomeString string `json:"some_string"`
+		Nested     struct {
+			Values []string `json:"values"`
+		} `json:"nested"`
+		Number json.Number `json:"number"`
+	}
+	err := ReadJSONFileExpandEnv(filename, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "key-s3cr\"et", result.SomeString)
+	assert.Equal(t, []string{"s3cr\"et", "[]", "costs $5", "$"}, result.Nested.Values)
+	assert.Equal(t, json.Number("12345678901234567890"), result.Number)
+}
+
+func TestReadJSONFileExpandEnv_Unset(t *testing.T) {
+	os.Unsetenv("MS_TEST_UNSET")
+	filename := testJSONFile(t, `{"some_string":"${MS_TEST_UNSET}/$MS_TEST_UNSET"}`)
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	var result CorrectJSONStruct
+	err := ReadJSONFileExpandEnv(filename, &result)
+	assert.EqualError(
+		t,
+		err,
+		"the environment variables referenced in \""+filename+"\" are not set: MS_TEST_UNSET",
+	)
+}
+
+func TestReadJSONFileExpandEnv_Failure(t *testing.T) {
+	var structResult WrongJSONStruct
+
+	err := ReadJSONFileExpandEnv("/file/that/does/not/exist", &structResult)
+	assert.NotNil(t, err)
+
+	currentDir, err := os.Getwd()
+	assert.Nil(t, err)
+	err = ReadJSONFileExpandEnv(path.Join(currentDir, "struct_test.json"), &structResult)
+	assert.NotNil(t, err)
+}
+
 /**
  * Functions/types for internal use.
  */
 
+// testJSONFile writes the given JSON data to a file in a new temporary
+// directory, and it returns the path to the file.
+func testJSONFile(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "ms_util")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(filename, []byte(data), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return filename
+}
+
 type CorrectJSONStruct struct {
 	SomeString string `json:"some_string"`
 }
@@ -84,3 +200,132 @@ type CorrectJSONStruct struct {
 type WrongJSONStruct struct {
 	SomeInteger int `json:"some_string"`
 }
+
+func TestConfigFilePath_Flag(t *testing.T) {
+	path := ConfigFilePath("/tmp/watch_api.config.json", "/etc/mantis-shrimp/watch_api.config.json")
+	assert.Equal(t, "/tmp/watch_api.config.json", path)
+}
+
+func TestConfigFilePath_Default(t *testing.T) {
+	path := ConfigFilePath("", "/etc/mantis-shrimp/watch_api.config.json")
+	assert.Equal(t, "/etc/mantis-shrimp/watch_api.config.json", path)
+}
+
+func TestShutdownContext_Signal(t *testing.T) {
+	ctx, cancel := ShutdownContext()
+	defer cancel()
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	assert.Nil(t, err)
+
+	// The context should be cancelled when the signal is received.
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("the context was not cancelled after receiving a termination signal")
+	}
+}
+
+func TestShutdownContext_Cancel(t *testing.T) {
+	ctx, cancel := ShutdownContext()
+	cancel()
+	assert.NotNil(t, ctx.Err())
+}
+
+func TestParseGracePeriod(t *testing.T) {
+	gracePeriod, err := ParseGracePeriod("")
+	assert.Nil(t, err)
+	assert.Equal(t, ShutdownGracePeriodDefault, gracePeriod)
+
+	gracePeriod, err = ParseGracePeriod("30s")
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, gracePeriod)
+
+	_, err = ParseGracePeriod("soon")
+	assert.NotNil(t, err)
+
+	_, err = ParseGracePeriod("-1s")
+	assert.NotNil(t, err)
+}
+
+func TestDecodeDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		`"5m"`:         5 * time.Minute,
+		`"1h30m"`:      90 * time.Minute,
+		`"0s"`:         0,
+		`300000000000`: 5 * time.Minute,
+		`0`:            0,
+	}
+	for data, expected := range cases {
+		duration, err := DecodeDuration([]byte(data))
+		assert.Nil(t, err, data)
+		assert.Equal(t, expected, duration, data)
+	}
+
+	for _, data := range []string{`"5 minutes"`, `""`, `1.5`, `true`, `null`, `{`} {
+		_, err := DecodeDuration([]byte(data))
+		assert.NotNil(t, err, data)
+	}
+}
+
+func TestDuration_JSON(t *testing.T) {
+	type holder struct {
+		Timeout Duration `json:"timeout"`
+	}
+
+	// Both forms are decoded, and they are encoded back as nanoseconds.
+	cases := map[string]time.Duration{
+		`{"timeout":"30s"}`:         30 * time.Second,
+		`{"timeout":"1h30m"}`:       90 * time.Minute,
+		`{"timeout":30000000000}`:   30 * time.Second,
+		`{"timeout":5400000000000}`: 90 * time.Minute,
+	}
+	for data, expected := range cases {
+		var decoded holder
+		err := json.Unmarshal([]byte(data), &decoded)
+		assert.Nil(t, err, data)
+		assert.Equal(t, expected, decoded.Timeout.Duration, data)
+
+		encoded, err := json.Marshal(decoded)
+		assert.Nil(t, err, data)
+		assert.JSONEq(t, fmt.Sprintf(`{"timeout":%d}`, expected.Nanoseconds()), string(encoded), data)
+
+		var roundTripped holder
+		err = json.Unmarshal(encoded, &roundTripped)
+		assert.Nil(t, err, data)
+		assert.Equal(t, decoded, roundTripped, data)
+	}
+
+	// Null leaves the duration unchanged.
+	decoded := holder{Timeout: Duration{time.Second}}
+	err := json.Unmarshal([]byte(`{"timeout":null}`), &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, decoded.Timeout.Duration)
+
+	err = json.Unmarshal([]byte(`{"timeout":"soon"}`), &decoded)
+	assert.NotNil(t, err)
+}
+
+func TestNewURLAllowList_InvalidPattern(t *testing.T) {
+	_, err := NewURLAllowList([]string{"^https://example\\.com/", "(unclosed"})
+	assert.NotNil(t, err)
+}
+
+func TestURLAllowList_Allowed(t *testing.T) {
+	// An empty list allows everything.
+	list, err := NewURLAllowList(nil)
+	assert.Nil(t, err)
+	assert.True(t, list.Allowed("http://169.254.169.254/latest/meta-data"))
+
+	list, err = NewURLAllowList([]string{
+		"^https://hooks\\.slack\\.com/",
+		"^https://chat\\.example\\.com/hooks/",
+	})
+	assert.Nil(t, err)
+	assert.True(t, list.Allowed("https://hooks.slack.com/services/T0/B0/X"))
+	assert.True(t, list.Allowed("https://chat.example.com/hooks/abc"))
+	assert.False(t, list.Allowed("https://chat.example.com/api/v1/users"))
+	assert.False(t, list.Allowed("http://hooks.slack.com/services/T0/B0/X"))
+	assert.False(t, list.Allowed("http://169.254.169.254/?https://hooks.slack.com/"))
+	assert.False(t, list.Allowed(""))
+}
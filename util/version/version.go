@@ -0,0 +1,42 @@
+/**
+ * Provides the details of the build that the programs of all components were
+ * made from.
+ *
+ * The details are injected when building the programs e.g.
+ *   go build -ldflags "-X github.com/krystalcode/go-mantis-shrimp/util/version.Version=1.0.0 -X github.com/krystalcode/go-mantis-shrimp/util/version.Commit=$(git rev-parse HEAD) -X github.com/krystalcode/go-mantis-shrimp/util/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+ */
+
+package msUtilVersion
+
+/**
+ * Build details; they are "dev" when not injected.
+ */
+
+// Version holds the semantic version of the build.
+var Version = "dev"
+
+// Commit holds the git commit that the build was made from.
+var Commit = "dev"
+
+// Date holds the date that the build was made on.
+var Date = "dev"
+
+/**
+ * Public API.
+ */
+
+// Info holds the details of a build.
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// Get returns the details of the build that the running program was made from.
+func Get() Info {
+	return Info{
+		Version: Version,
+		Commit:  Commit,
+		Date:    Date,
+	}
+}
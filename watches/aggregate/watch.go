@@ -0,0 +1,367 @@
+/**
+ * Provides a Watch that aggregates the results of other Watches.
+ *
+ * The child Watches are referenced by their IDs and they are loaded from the
+ * Storage every time the Aggregate Watch is evaluated. The Storage cannot be
+ * imported here since it depends on this package via the Watch wrapper; it has
+ * to be given via SetLoader() by the programs that evaluate Watches.
+ */
+
+package msWatchAggregate
+
+import (
+	// Utilities.
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Public API.
+ */
+
+// Loader is an interface that is used to load the child Watches by their IDs.
+// It is implemented by the Storage engines of the msWatchStorage package.
+type Loader interface {
+	Get(int) (*common.Watch, error)
+}
+
+// SetLoader sets the Loader that child Watches are loaded with.
+func SetLoader(loader Loader) {
+	watchLoader.Lock()
+	defer watchLoader.Unlock()
+	watchLoader.loader = loader
+}
+
+/**
+ * Types and their functions.
+ */
+
+// Watch implements the common.Watch interface. It provides a Watch that
+// evaluates the Watches with the given IDs, and triggers its Actions when
+// enough of them fail.
+//
+// A child Watch is considered failed when its Conditions are met, that is, when
+// it would trigger its Actions; the children should therefore be configured
+// with Conditions that are met when what they watch is failing, the same way
+// they would be configured for alerting. The children's own Actions are not
+// triggered.
+type Watch struct {
+	// Common fields and functions for all Watches.
+	common.WatchBase
+
+	// The IDs of the child Watches.
+	WatchesIDs []int `json:"watches_ids"`
+	// The Actions are triggered when at least this number of children fail. It
+	// is not taken into account when 0.
+	MinFailures int `json:"min_failures"`
+	// The Actions are triggered when fewer than this number of children succeed.
+	// It is not taken into account when 0.
+	MinSuccesses int `json:"min_successes"`
+
+	// The result of the data operation.
+	result Result
+}
+
+// Do implements common.Watch.Do(). It evaluates the child Watches, and returns
+// the IDs of the Actions that should be triggered as a result of the Watch, if
+// any. The given context is passed on to the child Watches.
+func (watch Watch) Do(ctx context.Context) []int {
+	actionsIDs, _ := watch.DoWithContext(ctx)
+	return actionsIDs
+}
+
+// DoWithContext implements common.ContextWatch.DoWithContext(). It does the
+// same as Do(), and it additionally returns the context that the Actions should
+// be triggered with i.e. the status of the Result and the number of children
+// that failed and succeeded.
+func (watch Watch) DoWithContext(ctx context.Context) ([]int, actions.ActionContext) {
+	watch.data(ctx, map[int]bool{})
+	actionContext := watch.ActionContext(
+		watch.result.Status,
+		map[string]string{
+			"failures":  strconv.Itoa(watch.result.Failures),
+			"successes": strconv.Itoa(watch.result.Successes),
+		},
+	)
+
+	if watch.result.Status != "threshold_reached" {
+		return []int{}, actionContext
+	}
+
+	return watch.ActionsIDs, actionContext
+}
+
+// Evaluates the child Watches and determines the Result. The given set holds
+// the IDs of the Aggregate Watches that are being evaluated further up the
+// hierarchy, so that cycles are detected instead of recursing infinitely.
+func (watch *Watch) data(ctx context.Context, ancestors map[int]bool) {
+	for _, watchID := range watch.WatchesIDs {
+		if ancestors[watchID] {
+			watch.result = Result{
+				Status: "error",
+				Error:  fmt.Sprintf("the Watch with ID \"%d\" is included in itself", watchID),
+			}
+			return
+		}
+	}
+
+	loader := getLoader()
+	if loader == nil {
+		watch.result = Result{Status: "error", Error: "no loader has been set for the child Watches"}
+		return
+	}
+
+	// Load all children first, so that none is evaluated if any of them cannot
+	// be loaded.
+	children := make([]common.Watch, len(watch.WatchesIDs))
+	for index, watchID := range watch.WatchesIDs {
+		child, err := loader.Get(watchID)
+		if err != nil {
+			watch.result = Result{
+				Status: "error",
+				Error:  fmt.Sprintf("failed to load the Watch with ID \"%d\": %s", watchID, err.Error()),
+			}
+			return
+		}
+		children[index] = *child
+	}
+
+	// Evaluate the children concurrently.
+	failed := make([]bool, len(children))
+	errs := make([]error, len(children))
+	var wg sync.WaitGroup
+	for index := range children {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			failed[index], errs[index] = evaluateChild(ctx, watch.WatchesIDs[index], children[index], ancestors)
+		}(index)
+	}
+	wg.Wait()
+
+	result := Result{}
+	for index := range children {
+		if errs[index] != nil {
+			watch.result = Result{Status: "error", Error: errs[index].Error()}
+			return
+		}
+		if failed[index] {
+			result.Failures++
+		} else {
+			result.Successes++
+		}
+	}
+
+	result.Status = "below_threshold"
+	if watch.MinFailures > 0 && result.Failures >= watch.MinFailures {
+		result.Status = "threshold_reached"
+	}
+	if watch.MinSuccesses > 0 && result.Successes < watch.MinSuccesses {
+		result.Status = "threshold_reached"
+	}
+
+	watch.result = result
+}
+
+// Result holds the result of an aggregation. Its status is a string that can
+// hold one of the following values:
+// - threshold_reached (the Actions should be triggered)
+// - below_threshold
+// - error (the children could not be loaded or evaluated)
+// It also holds the number of children that failed and succeeded, and the
+// reason of the error, if any.
+type Result struct {
+	Status    string `json:"status"`
+	Failures  int    `json:"failures"`
+	Successes int    `json:"successes"`
+	Error     string `json:"error,omitempty"`
+}
+
+/**
+ * JSON.
+ */
+
+// UnmarshalJSON provides decoding of a JSON-encoded Watch object.
+func (watch *Watch) UnmarshalJSON(bytes []byte) error {
+	// Deserialize everything into a map of json.RawMessage; its indices would
+	// correspond to the Watch struct's fields.
+	var jsonMap map[string]*json.RawMessage
+	err := json.Unmarshal(bytes, &jsonMap)
+	if err != nil {
+		return err
+	}
+
+	if jsonMap["name"] != nil {
+		var name string
+		err = json.Unmarshal(*jsonMap["name"], &name)
+		if err != nil {
+			return err
+		}
+		watch.Name = name
+	}
+	if jsonMap["actions_ids"] != nil {
+		var actionsIds []int
+		err = json.Unmarshal(*jsonMap["actions_ids"], &actionsIds)
+		if err != nil {
+			return err
+		}
+		watch.ActionsIDs = actionsIds
+	}
+	if jsonMap["created_at"] != nil {
+		var createdAt *time.Time
+		err = json.Unmarshal(*jsonMap["created_at"], &createdAt)
+		if err != nil {
+			return err
+		}
+		watch.CreatedAt = createdAt
+	}
+	if jsonMap["updated_at"] != nil {
+		var updatedAt *time.Time
+		err = json.Unmarshal(*jsonMap["updated_at"], &updatedAt)
+		if err != nil {
+			return err
+		}
+		watch.UpdatedAt = updatedAt
+	}
+	if jsonMap["singleton"] != nil {
+		var singleton bool
+		err = json.Unmarshal(*jsonMap["singleton"], &singleton)
+		if err != nil {
+			return err
+		}
+		watch.Singleton = singleton
+	}
+	if jsonMap["warning_actions_ids"] != nil {
+		var warningActionsIDs []int
+		err = json.Unmarshal(*jsonMap["warning_actions_ids"], &warningActionsIDs)
+		if err != nil {
+			return err
+		}
+		watch.WarningActionsIDs = warningActionsIDs
+	}
+	if jsonMap["actions_priorities"] != nil {
+		var actionsPriorities map[int]int
+		err = json.Unmarshal(*jsonMap["actions_priorities"], &actionsPriorities)
+		if err != nil {
+			return err
+		}
+		watch.ActionsPriorities = actionsPriorities
+	}
+	if jsonMap["stop_on_action_failure"] != nil {
+		var stopOnActionFailure bool
+		err = json.Unmarshal(*jsonMap["stop_on_action_failure"], &stopOnActionFailure)
+		if err != nil {
+			return err
+		}
+		watch.StopOnActionFailure = stopOnActionFailure
+	}
+	if jsonMap["watches_ids"] != nil {
+		var watchesIDs []int
+		err = json.Unmarshal(*jsonMap["watches_ids"], &watchesIDs)
+		if err != nil {
+			return err
+		}
+		watch.WatchesIDs = watchesIDs
+	}
+	if jsonMap["min_failures"] != nil {
+		var minFailures int
+		err = json.Unmarshal(*jsonMap["min_failures"], &minFailures)
+		if err != nil {
+			return err
+		}
+		watch.MinFailures = minFailures
+	}
+	if jsonMap["min_successes"] != nil {
+		var minSuccesses int
+		err = json.Unmarshal(*jsonMap["min_successes"], &minSuccesses)
+		if err != nil {
+			return err
+		}
+		watch.MinSuccesses = minSuccesses
+	}
+
+	return nil
+}
+
+// NewAggregateWatch implements the WatchFactory function type. It creates an
+// Aggregate Watch based on the given JSON-object.
+var NewAggregateWatch = func(jsonWatch *json.RawMessage) (common.Watch, error) {
+	// Create a Watch object from JSON.
+	var watch Watch
+	err := json.Unmarshal(*jsonWatch, &watch)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(watch.WatchesIDs) == 0 {
+		return nil, fmt.Errorf("an Aggregate Watch requires the IDs of the Watches that it aggregates")
+	}
+	if watch.MinFailures <= 0 && watch.MinSuccesses <= 0 {
+		return nil, fmt.Errorf("an Aggregate Watch requires a minimum number of failures or successes")
+	}
+	if watch.MinFailures > len(watch.WatchesIDs) || watch.MinSuccesses > len(watch.WatchesIDs) {
+		return nil, fmt.Errorf("the minimum number of failures or successes of an Aggregate Watch cannot exceed the number of its Watches")
+	}
+
+	return watch, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// watchLoader holds the Loader that child Watches are loaded with.
+var watchLoader struct {
+	sync.RWMutex
+	loader Loader
+}
+
+// getLoader returns the Loader that child Watches are loaded with.
+func getLoader() Loader {
+	watchLoader.RLock()
+	defer watchLoader.RUnlock()
+	return watchLoader.loader
+}
+
+// evaluateChild evaluates the given child Watch, which has the given ID, and
+// returns whether it failed. Child Aggregate Watches are evaluated with the
+// given ancestors plus the child itself, so that cycles can be detected.
+func evaluateChild(ctx context.Context, watchID int, child common.Watch, ancestors map[int]bool) (bool, error) {
+	if aggregate, ok := child.(Watch); ok {
+		childAncestors := make(map[int]bool, len(ancestors)+1)
+		for ancestorID := range ancestors {
+			childAncestors[ancestorID] = true
+		}
+		childAncestors[watchID] = true
+
+		aggregate.data(ctx, childAncestors)
+		if aggregate.result.Status == "error" {
+			return false, fmt.Errorf("the Watch with ID \"%d\" failed: %s", watchID, aggregate.result.Error)
+		}
+		return aggregate.result.Status == "threshold_reached", nil
+	}
+
+	// Watches return the IDs of their Actions when their Conditions are met.
+	// Replace them with a placeholder so that children without Actions are
+	// detected as well, and so that it is clear that the children's own Actions
+	// are not triggered.
+	base, err := common.Base(child)
+	if err != nil {
+		return false, err
+	}
+	base.ActionsIDs = []int{0}
+	err = common.SetBase(&child, *base)
+	if err != nil {
+		return false, err
+	}
+
+	return len(child.Do(ctx)) != 0, nil
+}
@@ -0,0 +1,250 @@
+/**
+ * Tests for the Aggregate Watch.
+ */
+
+package msWatchAggregate
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"context"
+	"encoding/json"
+	"fmt"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Helper types and functions reused in various tests.
+ */
+
+// testChildWatch implements the common.Watch interface. It fails i.e. it
+// returns its Actions IDs, depending on its configuration.
+type testChildWatch struct {
+	common.WatchBase
+
+	fails bool
+}
+
+func (watch testChildWatch) Do(ctx context.Context) []int {
+	if watch.fails {
+		return watch.ActionsIDs
+	}
+	return []int{}
+}
+
+// testLoader implements the Loader interface, loading Watches from a map.
+type testLoader map[int]common.Watch
+
+func (loader testLoader) Get(id int) (*common.Watch, error) {
+	watch, ok := loader[id]
+	if !ok {
+		return nil, fmt.Errorf("the Watch was not found")
+	}
+	return &watch, nil
+}
+
+// testChildren sets a Loader that provides the given number of failing
+// children with IDs starting from 1, followed by the given number of succeeding
+// children, and it returns their IDs. The children have no Actions, so that it
+// is tested that they are detected as failed regardless.
+func testChildren(failing int, succeeding int) []int {
+	loader := testLoader{}
+	watchesIDs := []int{}
+	for i := 1; i <= failing+succeeding; i++ {
+		loader[i] = testChildWatch{fails: i <= failing}
+		watchesIDs = append(watchesIDs, i)
+	}
+	SetLoader(loader)
+
+	return watchesIDs
+}
+
+// testWatch generates a Watch object with some defaults.
+func testWatch(watchesIDs []int, minFailures int, minSuccesses int) Watch {
+	return Watch{
+		WatchBase: common.WatchBase{
+			Name:       "Test Watch",
+			ActionsIDs: []int{1, 2},
+		},
+		WatchesIDs:   watchesIDs,
+		MinFailures:  minFailures,
+		MinSuccesses: minSuccesses,
+	}
+}
+
+/**
+ * Tests.
+ */
+
+func TestDo_Thresholds(t *testing.T) {
+	cases := []struct {
+		failing      int
+		succeeding   int
+		minFailures  int
+		minSuccesses int
+		triggered    bool
+	}{
+		// Minimum failures.
+		{0, 3, 1, 0, false},
+		{1, 2, 1, 0, true},
+		{1, 2, 2, 0, false},
+		{2, 1, 2, 0, true},
+		{3, 0, 2, 0, true},
+		{3, 0, 3, 0, true},
+		// Minimum successes.
+		{0, 3, 0, 3, false},
+		{1, 2, 0, 3, true},
+		{1, 2, 0, 2, false},
+		{2, 1, 0, 2, true},
+		{3, 0, 0, 1, true},
+		// Either threshold triggers the Actions.
+		{1, 2, 2, 2, false},
+		{2, 1, 2, 1, true},
+		{1, 2, 2, 3, true},
+	}
+
+	for index, c := range cases {
+		watch := testWatch(testChildren(c.failing, c.succeeding), c.minFailures, c.minSuccesses)
+
+		actionsIDs, actionContext := watch.DoWithContext(context.Background())
+		if c.triggered {
+			assert.Equal(t, []int{1, 2}, actionsIDs, "case %d", index)
+			assert.Equal(t, "threshold_reached", actionContext.Status, "case %d", index)
+		} else {
+			assert.Equal(t, []int{}, actionsIDs, "case %d", index)
+			assert.Equal(t, "below_threshold", actionContext.Status, "case %d", index)
+		}
+		assert.Equal(
+			t,
+			map[string]string{
+				"failures":  fmt.Sprintf("%d", c.failing),
+				"successes": fmt.Sprintf("%d", c.succeeding),
+			},
+			actionContext.Values,
+			"case %d",
+			index,
+		)
+	}
+}
+
+func TestDo_NestedAggregate(t *testing.T) {
+	SetLoader(testLoader{
+		1: testChildWatch{fails: true},
+		2: testChildWatch{fails: true},
+		3: testChildWatch{fails: false},
+		4: testWatch([]int{1, 2}, 2, 0),
+		5: testWatch([]int{1, 3}, 2, 0),
+	})
+
+	watch := testWatch([]int{4, 5}, 1, 0)
+	watch.data(context.Background(), map[int]bool{})
+	assert.Equal(t, Result{Status: "threshold_reached", Failures: 1, Successes: 1}, watch.result)
+
+	watch = testWatch([]int{5}, 1, 0)
+	assert.Equal(t, []int{}, watch.Do(context.Background()))
+}
+
+func TestDo_Cycle(t *testing.T) {
+	// An Aggregate Watch that includes itself.
+	SetLoader(testLoader{
+		1: testChildWatch{fails: true},
+		2: testWatch([]int{1, 2}, 1, 0),
+	})
+	loader := getLoader()
+	watch, _ := loader.Get(2)
+	actionsIDs, actionContext := (*watch).(Watch).DoWithContext(context.Background())
+	assert.Equal(t, []int{}, actionsIDs)
+	assert.Equal(t, "error", actionContext.Status)
+
+	// Aggregate Watches that include each other.
+	SetLoader(testLoader{
+		1: testChildWatch{fails: true},
+		2: testWatch([]int{1, 3}, 1, 0),
+		3: testWatch([]int{2}, 1, 0),
+	})
+	aggregateWatch := testWatch([]int{2}, 1, 0)
+	aggregateWatch.data(context.Background(), map[int]bool{})
+	assert.Equal(t, "error", aggregateWatch.result.Status)
+	assert.Equal(
+		t,
+		"the Watch with ID \"2\" failed: the Watch with ID \"3\" failed: the Watch with ID \"2\" is included in itself",
+		aggregateWatch.result.Error,
+	)
+
+	// The same Watch included twice at different branches is not a cycle.
+	SetLoader(testLoader{
+		1: testChildWatch{fails: true},
+		2: testWatch([]int{1}, 1, 0),
+		3: testWatch([]int{1, 2}, 2, 0),
+	})
+	aggregateWatch = testWatch([]int{1, 2, 3}, 3, 0)
+	assert.Equal(t, []int{1, 2}, aggregateWatch.Do(context.Background()))
+}
+
+func TestDo_LoaderErrors(t *testing.T) {
+	SetLoader(nil)
+	watch := testWatch([]int{1}, 1, 0)
+	actionsIDs, actionContext := watch.DoWithContext(context.Background())
+	assert.Equal(t, []int{}, actionsIDs)
+	assert.Equal(t, "error", actionContext.Status)
+
+	testChildren(1, 0)
+	watch = testWatch([]int{1, 2}, 1, 0)
+	watch.data(context.Background(), map[int]bool{})
+	assert.Equal(t, "error", watch.result.Status)
+	assert.Equal(t, "failed to load the Watch with ID \"2\": the Watch was not found", watch.result.Error)
+}
+
+func TestDo_ChildActionsNotTriggered(t *testing.T) {
+	child := testChildWatch{
+		WatchBase: common.WatchBase{ActionsIDs: []int{7}},
+		fails:     true,
+	}
+	SetLoader(testLoader{1: child})
+
+	watch := testWatch([]int{1}, 1, 0)
+	assert.Equal(t, []int{1, 2}, watch.Do(context.Background()))
+	// The stored child is left unmodified.
+	assert.Equal(t, []int{7}, child.Do(context.Background()))
+}
+
+/**
+ * Test JSON encoding/decoding.
+ */
+
+func TestJSON(t *testing.T) {
+	watch := testWatch([]int{3, 4, 5}, 2, 1)
+
+	jsonWatch, err := json.Marshal(watch)
+	assert.Nil(t, err)
+
+	var decodedWatch Watch
+	err = json.Unmarshal(jsonWatch, &decodedWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, watch, decodedWatch)
+}
+
+func TestNewAggregateWatch(t *testing.T) {
+	jsonWatch := json.RawMessage(`{"name":"Test Watch","actions_ids":[1],"watches_ids":[2,3],"min_failures":2}`)
+	watch, err := NewAggregateWatch(&jsonWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 3}, watch.(Watch).WatchesIDs)
+	assert.Equal(t, 2, watch.(Watch).MinFailures)
+
+	invalid := []string{
+		`{"watches_ids":[],"min_failures":1}`,
+		`{"watches_ids":[2,3]}`,
+		`{"watches_ids":[2,3],"min_failures":3}`,
+		`{"watches_ids":[2,3],"min_successes":3}`,
+	}
+	for index, jsonString := range invalid {
+		jsonWatch = json.RawMessage(jsonString)
+		_, err = NewAggregateWatch(&jsonWatch)
+		assert.NotNil(t, err, "case %d", index)
+	}
+}
@@ -0,0 +1,466 @@
+/**
+ * Provides a Watch that checks the expiry of the TLS certificate of a service.
+ */
+
+package msWatchCertCheck
+
+import (
+	// Utilities.
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Constants.
+ */
+
+// PortDefault holds the port that is dialed when no port is given.
+const PortDefault = 443
+
+/**
+ * Types and their functions.
+ */
+
+// Watch implements the common.Watch interface. It provides a Watch that dials
+// the defined host over TLS and checks the expiry of its certificate. Its
+// evaluation of whether the included Actions will be executed depend on the
+// evaluation of its Conditions.
+type Watch struct {
+	// Common fields and functions for all Watches.
+	common.WatchBase
+
+	// The host that will be dialed.
+	Host string `json:"host"`
+	// The port that will be dialed. Defaults to 443.
+	Port int `json:"port"`
+	// The server name that the certificate is requested and verified for.
+	// Defaults to the host.
+	ServerName string `json:"server_name"`
+	// How much to wait for the connection before considering the host
+	// inaccessible.
+	Timeout util.Duration `json:"timeout"`
+	// Whether to skip verifying the certificate chain and the server name, for
+	// checking the expiry of self-signed certificates.
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// The Conditions that will evaluate the results to determine whether the
+	// Actions should be triggered or not.
+	Conditions []Condition `json:"conditions"`
+
+	// The root certificates that the chain is verified against; the system's
+	// root certificates are used when nil.
+	rootCAs *x509.CertPool
+	// The result of the data operation.
+	result Result
+}
+
+// Do implements common.Watch.Do(). It prepares the Result of the Watch, it
+// evaluates the Conditions, and returns the IDs of the Actions that should be
+// triggered as a result of the Watch, if any.
+func (watch Watch) Do(ctx context.Context) []int {
+	actionsIDs, _ := watch.DoWithContext(ctx)
+	return actionsIDs
+}
+
+// DoWithContext implements common.ContextWatch.DoWithContext(). It does the
+// same as Do(), and it additionally returns the context that the Actions should
+// be triggered with i.e. the status of the Result and the host.
+func (watch Watch) DoWithContext(ctx context.Context) ([]int, actions.ActionContext) {
+	watch.data(ctx)
+	ok := watch.evaluate()
+	actionContext := watch.ActionContext(watch.result.Status, map[string]string{"host": watch.Host})
+
+	if !ok {
+		return []int{}, actionContext
+	}
+
+	// If all conditions pass, return the IDs of the Actions that should be
+	// triggered.
+	return watch.ActionsIDs, actionContext
+}
+
+// Replay implements common.ReplayableWatch.Replay(). It evaluates each of the
+// Watch's Conditions against the given JSON-encoded Result, without dialing
+// the Watch's host.
+func (watch Watch) Replay(jsonResult []byte) ([]bool, error) {
+	var result Result
+	err := json.Unmarshal(jsonResult, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]bool, len(watch.Conditions))
+	for index, condition := range watch.Conditions {
+		outcomes[index] = condition.Do(result)
+	}
+
+	return outcomes, nil
+}
+
+// Dials the host defined in the Watch, reads its certificate and determines the
+// Result.
+func (watch *Watch) data(ctx context.Context) {
+	port := watch.Port
+	if port == 0 {
+		port = PortDefault
+	}
+	serverName := watch.ServerName
+	if serverName == "" {
+		serverName = watch.Host
+	}
+
+	// We always complete the handshake without verification so that we can
+	// read expired certificates as well; the chain is verified separately
+	// below.
+	dialer := tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: watch.Timeout.Duration},
+		Config: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(watch.Host, strconv.Itoa(port)))
+	if err != nil {
+		watch.result = Result{Status: "inaccessible"}
+		return
+	}
+	defer conn.Close()
+
+	certificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		watch.result = Result{Status: "inaccessible"}
+		return
+	}
+
+	leaf := certificates[0]
+	notAfter := leaf.NotAfter
+	result := Result{
+		Status:        "success",
+		NotAfter:      &notAfter,
+		DaysRemaining: daysRemaining(notAfter),
+	}
+
+	if !watch.InsecureSkipVerify && !watch.verify(certificates, serverName) {
+		result.Status = "invalid"
+	}
+
+	watch.result = result
+}
+
+// verify checks that the given certificate chain is trusted and that it is
+// valid for the given server name. Expiry is not taken into account; that is
+// left to the Conditions.
+func (watch *Watch) verify(certificates []*x509.Certificate, serverName string) bool {
+	leaf := certificates[0]
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	currentTime := time.Now()
+	if currentTime.After(leaf.NotAfter) {
+		currentTime = leaf.NotAfter
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		Roots:         watch.rootCAs,
+		CurrentTime:   currentTime,
+	})
+
+	return err == nil
+}
+
+// Go through all Conditions defined in the Watch and evaluate them. The
+// Conditions are successful in their entirety when all Conditions evaluate
+// successfully.
+func (watch *Watch) evaluate() bool {
+	allOk := true
+	for _, condition := range watch.Conditions {
+		ok := condition.Do(watch.result)
+		if !ok {
+			allOk = false
+			break
+		}
+	}
+
+	return allOk
+}
+
+// daysRemaining returns the number of full days until the given time; it is
+// negative if the time has passed.
+func daysRemaining(notAfter time.Time) int {
+	return int(math.Floor(time.Until(notAfter).Hours() / 24))
+}
+
+// Result holds the result of a certificate check. Its status is a string that
+// can hold one of the following values:
+// - success
+// - inaccessible
+// - invalid (the chain is not trusted or not valid for the server name)
+// It also holds the expiry time of the leaf certificate and the number of full
+// days remaining until then, if the certificate could be read.
+type Result struct {
+	Status        string     `json:"status"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	DaysRemaining int        `json:"days_remaining"`
+}
+
+// Condition is an interface that should be implemented by all Condition types
+// for the Certificate Check Watch. It simply defines a function that, given the
+// Result of a Certificate Check operation, it decides whether the Condition is
+// met.
+type Condition interface {
+	Do(Result) bool
+}
+
+// ConditionExpiresWithin implements the Condition interface, providing a
+// Condition that is met when the certificate expires within the given number of
+// days, or it has already expired.
+type ConditionExpiresWithin struct {
+	Days int `json:"days"`
+}
+
+// Do implements Condition.Do(), determining whether the certificate expires
+// within the Condition's number of days.
+func (condition ConditionExpiresWithin) Do(result Result) bool {
+	if result.NotAfter == nil {
+		return false
+	}
+
+	return result.DaysRemaining < condition.Days
+}
+
+// ConditionExpired implements the Condition interface, providing a Condition
+// that is met when the certificate has expired.
+type ConditionExpired struct{}
+
+// Do implements Condition.Do(), determining whether the certificate has
+// expired.
+func (condition ConditionExpired) Do(result Result) bool {
+	if result.NotAfter == nil {
+		return false
+	}
+
+	return time.Now().After(*result.NotAfter)
+}
+
+/**
+ * JSON.
+ */
+
+// MarshalJSON encodes a ConditionExpiresWithin object into a JSON object that
+// contains its type together with its number of days. This is desired so that
+// a JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionExpiresWithin) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"type":"expires_within","days":%d}`, condition.Days)), nil
+}
+
+// MarshalJSON encodes a ConditionExpired object into a JSON object that
+// contains a single field, indicating its type. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionExpired) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"expired"}`), nil
+}
+
+// UnmarshalJSON provides decoding of a JSON-encoded Watch object so that the
+// Conditions held in the "conditions" field are properly constructed based on
+// their type.
+func (watch *Watch) UnmarshalJSON(bytes []byte) error {
+	// Deserialize everything into a map of json.RawMessage; its indices would
+	// correspond to the Watch struct's fields.
+	var jsonMap map[string]*json.RawMessage
+	err := json.Unmarshal(bytes, &jsonMap)
+	if err != nil {
+		return err
+	}
+
+	// Decode all other fields first.
+	if jsonMap["name"] != nil {
+		var name string
+		err = json.Unmarshal(*jsonMap["name"], &name)
+		if err != nil {
+			return err
+		}
+		watch.Name = name
+	}
+	if jsonMap["actions_ids"] != nil {
+		var actionsIds []int
+		err = json.Unmarshal(*jsonMap["actions_ids"], &actionsIds)
+		if err != nil {
+			return err
+		}
+		watch.ActionsIDs = actionsIds
+	}
+	if jsonMap["created_at"] != nil {
+		var createdAt *time.Time
+		err = json.Unmarshal(*jsonMap["created_at"], &createdAt)
+		if err != nil {
+			return err
+		}
+		watch.CreatedAt = createdAt
+	}
+	if jsonMap["updated_at"] != nil {
+		var updatedAt *time.Time
+		err = json.Unmarshal(*jsonMap["updated_at"], &updatedAt)
+		if err != nil {
+			return err
+		}
+		watch.UpdatedAt = updatedAt
+	}
+	if jsonMap["singleton"] != nil {
+		var singleton bool
+		err = json.Unmarshal(*jsonMap["singleton"], &singleton)
+		if err != nil {
+			return err
+		}
+		watch.Singleton = singleton
+	}
+	if jsonMap["warning_actions_ids"] != nil {
+		var warningActionsIDs []int
+		err = json.Unmarshal(*jsonMap["warning_actions_ids"], &warningActionsIDs)
+		if err != nil {
+			return err
+		}
+		watch.WarningActionsIDs = warningActionsIDs
+	}
+	if jsonMap["actions_priorities"] != nil {
+		var actionsPriorities map[int]int
+		err = json.Unmarshal(*jsonMap["actions_priorities"], &actionsPriorities)
+		if err != nil {
+			return err
+		}
+		watch.ActionsPriorities = actionsPriorities
+	}
+	if jsonMap["stop_on_action_failure"] != nil {
+		var stopOnActionFailure bool
+		err = json.Unmarshal(*jsonMap["stop_on_action_failure"], &stopOnActionFailure)
+		if err != nil {
+			return err
+		}
+		watch.StopOnActionFailure = stopOnActionFailure
+	}
+	if jsonMap["host"] != nil {
+		var host string
+		err = json.Unmarshal(*jsonMap["host"], &host)
+		if err != nil {
+			return err
+		}
+		watch.Host = host
+	}
+	if jsonMap["port"] != nil {
+		var port int
+		err = json.Unmarshal(*jsonMap["port"], &port)
+		if err != nil {
+			return err
+		}
+		watch.Port = port
+	}
+	if jsonMap["server_name"] != nil {
+		var serverName string
+		err = json.Unmarshal(*jsonMap["server_name"], &serverName)
+		if err != nil {
+			return err
+		}
+		watch.ServerName = serverName
+	}
+	if jsonMap["timeout"] != nil {
+		var timeout util.Duration
+		err = json.Unmarshal(*jsonMap["timeout"], &timeout)
+		if err != nil {
+			return err
+		}
+		watch.Timeout = timeout
+	}
+	if jsonMap["insecure_skip_verify"] != nil {
+		var insecureSkipVerify bool
+		err = json.Unmarshal(*jsonMap["insecure_skip_verify"], &insecureSkipVerify)
+		if err != nil {
+			return err
+		}
+		watch.InsecureSkipVerify = insecureSkipVerify
+	}
+
+	// If no conditions are given, there's nothing to do; return or we'll get an
+	// error.
+	if jsonMap["conditions"] == nil {
+		return nil
+	}
+
+	var rawConditions []*json.RawMessage
+	err = json.Unmarshal(*jsonMap["conditions"], &rawConditions)
+	if err != nil {
+		return err
+	}
+
+	// Create a slice of the right size that will hold the Conditions.
+	watch.Conditions = make([]Condition, len(rawConditions))
+
+	// Decode the Conditions from their JSON structure and put them in the
+	// corresponding field slice.
+	for index, rawCondition := range rawConditions {
+		var conditionInnerJSON map[string]*json.RawMessage
+		err = json.Unmarshal(*rawCondition, &conditionInnerJSON)
+		if err != nil {
+			return err
+		}
+
+		// Get the type of the Condition.
+		if conditionInnerJSON["type"] == nil {
+			return fmt.Errorf("a Condition was given without its type")
+		}
+		var conditionType string
+		err = json.Unmarshal(*conditionInnerJSON["type"], &conditionType)
+		if err != nil {
+			return err
+		}
+
+		switch conditionType {
+		case "expires_within":
+			var condition ConditionExpiresWithin
+			err = json.Unmarshal(*rawCondition, &condition)
+			if err != nil {
+				return err
+			}
+			watch.Conditions[index] = condition
+		case "expired":
+			watch.Conditions[index] = ConditionExpired{}
+		default:
+			return fmt.Errorf("unknown Condition type \"%s\"", conditionType)
+		}
+	}
+
+	return nil
+}
+
+// NewCertCheckWatch implements the WatchFactory function type. It creates a
+// Certificate Check Watch based on the given JSON-object.
+var NewCertCheckWatch = func(jsonWatch *json.RawMessage) (common.Watch, error) {
+	// Create a Watch object from JSON.
+	var watch Watch
+	err := json.Unmarshal(*jsonWatch, &watch)
+	if err != nil {
+		return nil, err
+	}
+
+	if watch.Host == "" {
+		return nil, fmt.Errorf("a Certificate Check Watch requires a host")
+	}
+
+	return watch, nil
+}
@@ -0,0 +1,260 @@
+/**
+ * Tests for the Certificate Check Watch.
+ */
+
+package msWatchCertCheck
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net"
+	"strconv"
+	"time"
+
+	// Internal dependencies.
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Helper types and functions reused in various tests.
+ */
+
+// testWatch generates a Watch object that dials the given address.
+func testWatch(address string) Watch {
+	host, port, _ := net.SplitHostPort(address)
+	portNumber, _ := strconv.Atoi(port)
+
+	watch := Watch{
+		WatchBase: common.WatchBase{
+			Name:       "Test Watch",
+			ActionsIDs: []int{1},
+		},
+		Host:       host,
+		Port:       portNumber,
+		ServerName: "example.com",
+		Timeout:    util.Duration{Duration: time.Second},
+		Conditions: []Condition{},
+	}
+	return watch
+}
+
+// testCertificate generates a self-signed certificate for "example.com" that
+// expires after the given duration, which can be negative.
+func testCertificate(t *testing.T, expiresIn time.Duration) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com"},
+		NotBefore:             now.Add(-30 * 24 * time.Hour),
+		NotAfter:              now.Add(expiresIn),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+// testListener starts a TLS listener on a local port that serves the given
+// certificate. It returns the listener, which should be closed by the caller.
+func testListener(t *testing.T, certificate tls.Certificate) net.Listener {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+	})
+	assert.Nil(t, err)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Complete the handshake and close the connection.
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	return listener
+}
+
+/**
+ * Test Result preparation.
+ */
+
+func TestResultPreparation_Success(t *testing.T) {
+	certificate := testCertificate(t, 36*time.Hour)
+	listener := testListener(t, certificate)
+	defer listener.Close()
+
+	// Trust the self-signed certificate so that its chain can be verified.
+	watch := testWatch(listener.Addr().String())
+	watch.rootCAs = x509.NewCertPool()
+	watch.rootCAs.AddCert(certificate.Leaf)
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.True(t, certificate.Leaf.NotAfter.Equal(*watch.result.NotAfter))
+	assert.Equal(t, 1, watch.result.DaysRemaining)
+}
+
+func TestResultPreparation_SelfSigned(t *testing.T) {
+	certificate := testCertificate(t, 36*time.Hour)
+	listener := testListener(t, certificate)
+	defer listener.Close()
+
+	// The self-signed certificate is not trusted.
+	watch := testWatch(listener.Addr().String())
+	watch.data(context.Background())
+	assert.Equal(t, "invalid", watch.result.Status)
+	assert.Equal(t, 1, watch.result.DaysRemaining)
+
+	// Unless verification is skipped.
+	watch.InsecureSkipVerify = true
+	watch.data(context.Background())
+	assert.Equal(t, "success", watch.result.Status)
+}
+
+func TestResultPreparation_ServerNameMismatch(t *testing.T) {
+	certificate := testCertificate(t, 36*time.Hour)
+	listener := testListener(t, certificate)
+	defer listener.Close()
+
+	watch := testWatch(listener.Addr().String())
+	watch.ServerName = "example.org"
+	watch.rootCAs = x509.NewCertPool()
+	watch.rootCAs.AddCert(certificate.Leaf)
+	watch.data(context.Background())
+
+	assert.Equal(t, "invalid", watch.result.Status)
+}
+
+func TestResultPreparation_Expired(t *testing.T) {
+	certificate := testCertificate(t, -time.Hour)
+	listener := testListener(t, certificate)
+	defer listener.Close()
+
+	// Expired certificates should still be read, and their chain verified.
+	watch := testWatch(listener.Addr().String())
+	watch.rootCAs = x509.NewCertPool()
+	watch.rootCAs.AddCert(certificate.Leaf)
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(t, -1, watch.result.DaysRemaining)
+}
+
+func TestResultPreparation_Inaccessible(t *testing.T) {
+	// Close the listener so that dialing it fails.
+	listener := testListener(t, testCertificate(t, time.Hour))
+	listener.Close()
+
+	watch := testWatch(listener.Addr().String())
+	watch.data(context.Background())
+
+	assert.Equal(t, "inaccessible", watch.result.Status)
+	assert.Nil(t, watch.result.NotAfter)
+}
+
+/**
+ * Test evaluating the Conditions.
+ */
+
+func TestConditionExpiresWithin(t *testing.T) {
+	notAfter := time.Now().Add(10 * 24 * time.Hour)
+	result := Result{Status: "success", NotAfter: &notAfter, DaysRemaining: 9}
+
+	assert.True(t, ConditionExpiresWithin{Days: 10}.Do(result))
+	assert.False(t, ConditionExpiresWithin{Days: 9}.Do(result))
+
+	// The Condition cannot be met if the certificate could not be read.
+	assert.False(t, ConditionExpiresWithin{Days: 10}.Do(Result{Status: "inaccessible"}))
+}
+
+func TestConditionExpired(t *testing.T) {
+	notAfter := time.Now().Add(-time.Minute)
+	assert.True(t, ConditionExpired{}.Do(Result{Status: "success", NotAfter: &notAfter, DaysRemaining: -1}))
+
+	notAfter = time.Now().Add(time.Minute)
+	assert.False(t, ConditionExpired{}.Do(Result{Status: "success", NotAfter: &notAfter}))
+
+	assert.False(t, ConditionExpired{}.Do(Result{Status: "inaccessible"}))
+}
+
+func TestDo(t *testing.T) {
+	listener := testListener(t, testCertificate(t, 36*time.Hour))
+	defer listener.Close()
+
+	watch := testWatch(listener.Addr().String())
+	watch.InsecureSkipVerify = true
+
+	watch.Conditions = []Condition{ConditionExpiresWithin{Days: 7}}
+	assert.Equal(t, []int{1}, watch.Do(context.Background()))
+
+	watch.Conditions = []Condition{ConditionExpired{}}
+	assert.Equal(t, []int{}, watch.Do(context.Background()))
+}
+
+func TestReplay(t *testing.T) {
+	watch := testWatch("127.0.0.1:443")
+	watch.Conditions = []Condition{ConditionExpiresWithin{Days: 30}, ConditionExpired{}}
+
+	outcomes, err := watch.Replay([]byte(`{"status":"success","not_after":"2100-01-01T00:00:00Z","days_remaining":20}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false}, outcomes)
+}
+
+/**
+ * Test JSON encoding/decoding.
+ */
+
+func TestJSON(t *testing.T) {
+	watch := testWatch("127.0.0.1:8443")
+	watch.InsecureSkipVerify = true
+	watch.Conditions = []Condition{ConditionExpiresWithin{Days: 14}, ConditionExpired{}}
+
+	jsonWatch, err := json.Marshal(watch)
+	assert.Nil(t, err)
+
+	var decodedWatch Watch
+	err = json.Unmarshal(jsonWatch, &decodedWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, watch, decodedWatch)
+}
+
+func TestNewCertCheckWatch(t *testing.T) {
+	jsonWatch := json.RawMessage(`{"host":"example.com","conditions":[{"type":"expires_within","days":30}]}`)
+	watch, err := NewCertCheckWatch(&jsonWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, []Condition{ConditionExpiresWithin{Days: 30}}, watch.(Watch).Conditions)
+
+	jsonWatch = json.RawMessage(`{"port":443}`)
+	_, err = NewCertCheckWatch(&jsonWatch)
+	assert.NotNil(t, err)
+}
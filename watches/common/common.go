@@ -1,25 +1,204 @@
 package msWatchCommon
 
 import (
+	// Utilities.
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
 	// Internal dependencies.
 	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
 )
 
+// The severities of the Results of Watches. Watch types that support
+// severities trigger different Actions depending on the severity of their
+// Result: "critical" triggers the Actions given in ActionsIDs, "warning" the
+// Actions given in WarningActionsIDs, while "ok" does not trigger any Actions.
+const (
+	SeverityOK       = "ok"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
 // Watch is an interface that should be implemented by all Watch types.
 // It simply defines a Do() function that prepares any data and evaluates any
 // conditions. It returns a list of the IDs of the Actions that should be
-// triggered as a result of the Watch, if any.
+// triggered as a result of the Watch, if any. Watches should abort any
+// outbound requests made while preparing their data when the given context is
+// cancelled.
 type Watch interface {
-	Do() []int
+	Do(context.Context) []int
+}
+
+// ContextWatch is an interface that should be implemented by Watch types that
+// provide details about their Result to the Actions that they trigger.
+type ContextWatch interface {
+	// DoWithContext does the same as Do(), and it additionally returns the
+	// context that the Actions should be triggered with.
+	DoWithContext(context.Context) ([]int, actions.ActionContext)
+}
+
+// ReplayableWatch is an interface that should be implemented by Watch types
+// that can evaluate their Conditions against a Result supplied externally, such
+// as a Result recorded in the past, instead of preparing one themselves. It is
+// useful for testing new Conditions against real data.
+type ReplayableWatch interface {
+	// Replay receives a JSON-encoded Result and returns whether each of the
+	// Watch's Conditions is met, in the order that the Conditions are defined.
+	Replay([]byte) ([]bool, error)
+}
+
+// ResultWatch is an interface that should be implemented by Watch types that
+// can be evaluated against a Result supplied externally, such as a Result
+// pushed to the API, instead of preparing one themselves.
+type ResultWatch interface {
+	// WithResult receives a JSON-encoded Result and returns a copy of the Watch
+	// that is evaluated against it when it is triggered.
+	WithResult([]byte) (Watch, error)
 }
 
 // WatchBase should be included by all Watch types as an embedded struct
 // (anonymous field). It provides all fields that should be present in all
 // Watch implementations.
 type WatchBase struct {
-	// @I Add CreatedAt and UpdatedAt fields in Watches
-
 	Name       string           `json:"name"`
 	ActionsIDs []int            `json:"actions_ids"`
 	Actions    []actions.Action `json:"actions"`
+	CreatedAt  *time.Time       `json:"created_at"`
+	UpdatedAt  *time.Time       `json:"updated_at"`
+	// Singleton Watches are not evaluated again while an evaluation is still in
+	// progress, such as when the Watch is triggered again before a slow
+	// evaluation finishes.
+	Singleton bool `json:"singleton"`
+	// The IDs of the Actions triggered when the Result of the Watch has the
+	// "warning" severity, for Watch types that support severities.
+	WarningActionsIDs []int `json:"warning_actions_ids"`
+	// The priorities of the Watch's Actions, keyed by the Actions' IDs. Actions
+	// with a higher priority are triggered before Actions with a lower priority;
+	// Actions without a priority have a priority of 0. The Action API executes
+	// triggered Actions asynchronously, so the order that they finish in is not
+	// guaranteed.
+	ActionsPriorities map[int]int `json:"actions_priorities,omitempty"`
+	// Whether the Watch's Actions should be triggered one after the other,
+	// stopping at the first Action that could not be triggered, instead of all
+	// together. Only failed calls to the Action API stop the triggering, such as
+	// when the Action does not exist; Actions that fail while being executed do
+	// not, as they are executed asynchronously.
+	StopOnActionFailure bool `json:"stop_on_action_failure"`
+}
+
+// ActionContext returns the context that the Watch's Actions should be
+// triggered with, given the status of the Watch's Result and any further
+// details about it.
+func (base WatchBase) ActionContext(status string, values map[string]string) actions.ActionContext {
+	return actions.ActionContext{
+		WatchName: base.Name,
+		Status:    status,
+		Timestamp: time.Now(),
+		Values:    values,
+	}
+}
+
+// SeverityActionsIDs returns the IDs of the Actions that should be triggered
+// for a Result of the given severity.
+func (base WatchBase) SeverityActionsIDs(severity string) []int {
+	switch severity {
+	case SeverityCritical:
+		return base.ActionsIDs
+	case SeverityWarning:
+		return base.WarningActionsIDs
+	}
+
+	return []int{}
+}
+
+// PrioritizedActionsIDs groups the given Action IDs by their priority, in order
+// of decreasing priority. The IDs within each group keep the order that they
+// are given in. All IDs are returned in a single group when the Watch does not
+// define any priorities.
+func (base WatchBase) PrioritizedActionsIDs(actionsIDs []int) [][]int {
+	if len(actionsIDs) == 0 {
+		return [][]int{}
+	}
+	if len(base.ActionsPriorities) == 0 {
+		return [][]int{actionsIDs}
+	}
+
+	groups := map[int][]int{}
+	var priorities []int
+	for _, actionID := range actionsIDs {
+		priority := base.ActionsPriorities[actionID]
+		if _, ok := groups[priority]; !ok {
+			priorities = append(priorities, priority)
+		}
+		groups[priority] = append(groups[priority], actionID)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+
+	prioritized := make([][]int, len(priorities))
+	for index, priority := range priorities {
+		prioritized[index] = groups[priority]
+	}
+
+	return prioritized
+}
+
+// Base returns a copy of the WatchBase embedded in the given Watch. It returns
+// an error if the Watch type does not embed a WatchBase.
+func Base(watch Watch) (*WatchBase, error) {
+	field, err := baseField(reflect.ValueOf(watch))
+	if err != nil {
+		return nil, err
+	}
+
+	base := field.Interface().(WatchBase)
+	return &base, nil
+}
+
+// SetBase replaces the WatchBase embedded in the Watch that the given pointer
+// points to. Watches are usually held in the Watch interface by value, which
+// cannot be modified in place; in that case the Watch is replaced by a copy
+// that contains the given WatchBase.
+func SetBase(watchPointer *Watch, base WatchBase) error {
+	value := reflect.ValueOf(*watchPointer)
+
+	// Watches held by pointer can be modified in place.
+	if value.Kind() == reflect.Ptr {
+		field, err := baseField(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(base))
+		return nil
+	}
+
+	copyValue := reflect.New(value.Type()).Elem()
+	copyValue.Set(value)
+	field, err := baseField(copyValue)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(base))
+
+	*watchPointer = copyValue.Interface().(Watch)
+	return nil
+}
+
+// baseField returns the WatchBase field of the given Watch value.
+func baseField(value reflect.Value) (reflect.Value, error) {
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("the Watch of type \"%s\" is not a struct", value.Type())
+	}
+
+	field := value.FieldByName("WatchBase")
+	if !field.IsValid() || field.Type() != reflect.TypeOf(WatchBase{}) {
+		return reflect.Value{}, fmt.Errorf("the Watch of type \"%s\" does not embed a WatchBase", value.Type())
+	}
+
+	return field, nil
 }
@@ -5,7 +5,16 @@
 package msWatchConfig
 
 import (
+	// Utilities.
+	"fmt"
+	"strings"
+
 	// Internal dependencies.
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	log "github.com/krystalcode/go-mantis-shrimp/util/log"
+	metrics "github.com/krystalcode/go-mantis-shrimp/util/metrics"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
 	wrapper "github.com/krystalcode/go-mantis-shrimp/watches/wrapper"
 )
 
@@ -13,8 +22,43 @@ import (
 type Config struct {
 	// Configuration required for the Action API SDK.
 	ActionAPI ConfigActionAPI `json:"action_api"`
+	// The token that callers of the API must provide as a bearer token for
+	// authentication. Authentication is disabled when empty.
+	AuthToken string `json:"auth_token"`
+	// The time given to the service to finish any work in progress when asked to
+	// shut down, as a duration string e.g. "30s". Defaults to 10 seconds.
+	ShutdownGracePeriod string `json:"shutdown_grace_period"`
+	// The configuration of the HTTP transport shared by all Health Check
+	// Watches, such as how many idle connections are kept open for reuse.
+	// Defaults are used when not given.
+	HealthCheckTransport health.TransportConfig `json:"health_check_transport"`
+	// The logging configuration.
+	Log log.Config `json:"log"`
+	// The configuration for exposing metrics.
+	Metrics metrics.Config `json:"metrics"`
+	// The configuration for limiting the rate of the requests that create
+	// Watches made by each client. Requests are not limited by default.
+	RateLimit api.RateLimitConfig `json:"rate_limit"`
+	// The configuration for the HTTP server that serves the API, such as the
+	// maximum size of the request bodies. Defaults are used when not given.
+	Server api.ServerConfig `json:"server"`
+	// The maximum number of Watches evaluated at the same time; further Watches
+	// are queued until earlier ones finish. A default is used when not given.
+	EvaluationConcurrency int `json:"evaluation_concurrency"`
+	// The number of the most recent Results kept in the history of each Watch.
+	// A default is used when not given.
+	ResultHistoryLength int `json:"result_history_length"`
+	// The maximum number of bytes of the response bodies kept in the history of
+	// the Watches' Results; longer bodies are truncated and marked as such, so
+	// that together with the history length they bound the memory used by the
+	// history. Stored bodies are for display only and they are never used for
+	// evaluating the Watches again. A default is used when not given.
+	MaxStoredBodyBytes int `json:"max_stored_body_bytes"`
 	// The Storage configuration.
 	Storage map[string]interface{} `json:"storage"`
+	// The maximum number of Actions triggered at the same time; further Actions
+	// are queued until earlier ones finish. A default is used when not given.
+	TriggerConcurrency int `json:"trigger_concurrency"`
 	// Watches to be loaded in the case of using ephemeral storage.
 	WatchWrappers []wrapper.WatchWrapper `json:"watches"`
 }
@@ -26,4 +70,65 @@ type ConfigActionAPI struct {
 	BaseURL string `json:"base_url"`
 	// The API version.
 	Version string `json:"version"`
+	// The token used to authenticate with the API, if it requires
+	// authentication.
+	AuthToken string `json:"auth_token"`
+}
+
+// Validate checks that all required configuration options are given. All
+// problems found are reported together in the returned error.
+func (config Config) Validate() error {
+	var errs []string
+
+	if config.ActionAPI.BaseURL == "" {
+		errs = append(errs, "the \"action_api.base_url\" option is required")
+	}
+	if config.ActionAPI.Version == "" {
+		errs = append(errs, "the \"action_api.version\" option is required")
+	}
+	if storageType, ok := config.Storage["type"].(string); !ok || storageType == "" {
+		errs = append(errs, "the \"storage.type\" option is required")
+	}
+	if err := config.Metrics.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"metrics\" options are not valid: %s", err.Error()))
+	}
+	if err := config.Log.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"log\" options are not valid: %s", err.Error()))
+	}
+	if err := config.RateLimit.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"rate_limit\" options are not valid: %s", err.Error()))
+	}
+	if err := config.Server.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("the \"server\" options are not valid: %s", err.Error()))
+	}
+	if err := config.HealthCheckTransport.Validate(); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"health_check_transport\" options are not valid: %s", err.Error()),
+		)
+	}
+	if _, err := util.ParseGracePeriod(config.ShutdownGracePeriod); err != nil {
+		errs = append(
+			errs,
+			fmt.Sprintf("the \"shutdown_grace_period\" option is not valid: %s", err.Error()),
+		)
+	}
+	if config.TriggerConcurrency < 0 {
+		errs = append(errs, "the \"trigger_concurrency\" option cannot be negative")
+	}
+	if config.EvaluationConcurrency < 0 {
+		errs = append(errs, "the \"evaluation_concurrency\" option cannot be negative")
+	}
+	if config.ResultHistoryLength < 0 {
+		errs = append(errs, "the \"result_history_length\" option cannot be negative")
+	}
+	if config.MaxStoredBodyBytes < 0 {
+		errs = append(errs, "the \"max_stored_body_bytes\" option cannot be negative")
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid Watch API configuration: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
 }
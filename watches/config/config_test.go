@@ -0,0 +1,163 @@
+/**
+ * Tests for the msWatchConfig module.
+ */
+
+package msWatchConfig
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	api "github.com/krystalcode/go-mantis-shrimp/util/api"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
+)
+
+/**
+ * Tests.
+ */
+
+func TestValidate_Success(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage: map[string]interface{}{"type": "redis"},
+	}
+	assert.Nil(t, config.Validate())
+}
+
+func TestValidate_MissingOptions(t *testing.T) {
+	config := Config{}
+	err := config.Validate()
+	assert.EqualError(
+		t,
+		err,
+		"invalid Watch API configuration: "+
+			"the \"action_api.base_url\" option is required; "+
+			"the \"action_api.version\" option is required; "+
+			"the \"storage.type\" option is required",
+	)
+}
+
+func TestValidate_WrongStorageType(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage: map[string]interface{}{"type": 1},
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"storage.type\" option is required")
+}
+
+func TestValidate_NegativeTriggerConcurrency(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage:            map[string]interface{}{"type": "redis"},
+		TriggerConcurrency: -1,
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"trigger_concurrency\" option cannot be negative")
+}
+
+func TestValidate_NegativeEvaluationConcurrency(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage:               map[string]interface{}{"type": "redis"},
+		EvaluationConcurrency: -1,
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"evaluation_concurrency\" option cannot be negative")
+}
+
+func TestValidate_NegativeResultHistoryLength(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage:             map[string]interface{}{"type": "redis"},
+		ResultHistoryLength: -1,
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"result_history_length\" option cannot be negative")
+}
+
+func TestValidate_NegativeMaxStoredBodyBytes(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage:            map[string]interface{}{"type": "redis"},
+		MaxStoredBodyBytes: -1,
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"max_stored_body_bytes\" option cannot be negative")
+}
+
+func TestValidate_InvalidRateLimit(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage:   map[string]interface{}{"type": "redis"},
+		RateLimit: api.RateLimitConfig{RequestsPerSecond: -1},
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"rate_limit\" options are not valid: the requests per second cannot be negative")
+}
+
+func TestValidate_InvalidServer(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage: map[string]interface{}{"type": "redis"},
+		Server:  api.ServerConfig{WriteTimeout: "-1s"},
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"server\" options are not valid: the write timeout is not valid: the timeout cannot be negative")
+}
+
+func TestValidate_InvalidHealthCheckTransport(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage:              map[string]interface{}{"type": "redis"},
+		HealthCheckTransport: health.TransportConfig{KeepAlive: "often"},
+	}
+	err := config.Validate()
+	assert.EqualError(t, err, "invalid Watch API configuration: the \"health_check_transport\" options are not valid: the keep-alive interval is not valid: time: invalid duration \"often\"")
+}
+
+func TestValidate_InvalidLog(t *testing.T) {
+	config := Config{
+		ActionAPI: ConfigActionAPI{
+			BaseURL: "http://ms-action-api:8888",
+			Version: "1",
+		},
+		Storage: map[string]interface{}{"type": "redis"},
+	}
+	config.Log.Level = "verbose"
+	err := config.Validate()
+	assert.EqualError(
+		t,
+		err,
+		"invalid Watch API configuration: the \"log\" options are not valid: unknown log level \"verbose\"",
+	)
+}
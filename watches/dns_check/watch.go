@@ -0,0 +1,490 @@
+/**
+ * Provides a Watch that checks the DNS resolution of a hostname.
+ */
+
+package msWatchDNSCheck
+
+import (
+	// Utilities.
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Constants.
+ */
+
+// The DNS record types that can be checked.
+const (
+	RecordTypeA     = "A"
+	RecordTypeAAAA  = "AAAA"
+	RecordTypeCNAME = "CNAME"
+	RecordTypeMX    = "MX"
+	RecordTypeTXT   = "TXT"
+)
+
+/**
+ * Types and their functions.
+ */
+
+// Resolver is an interface that is used to allow dependency injection of the
+// resolver that looks up the Watch's hostname. Dependency injection is
+// necessary for testing purposes. It is implemented by net.Resolver.
+type Resolver interface {
+	LookupIPAddr(context.Context, string) ([]net.IPAddr, error)
+	LookupCNAME(context.Context, string) (string, error)
+	LookupMX(context.Context, string) ([]*net.MX, error)
+	LookupTXT(context.Context, string) ([]string, error)
+}
+
+// Watch implements the common.Watch interface. It provides a Watch that
+// resolves the defined hostname and checks the resolved records. Its evaluation
+// of whether the included Actions will be executed depend on the evaluation of
+// its Conditions.
+type Watch struct {
+	// Common fields and functions for all Watches.
+	common.WatchBase
+
+	// The hostname that will be resolved.
+	Hostname string `json:"hostname"`
+	// The type of the DNS records that will be looked up; one of "A", "AAAA",
+	// "CNAME", "MX" or "TXT". Defaults to "A".
+	RecordType string `json:"record_type"`
+	// The values that the hostname is expected to resolve to. All of them have
+	// to be among the resolved records for the resolution to be successful; the
+	// hostname may resolve to additional records. Any records are accepted when
+	// no values are given.
+	ExpectedValues []string `json:"expected_values"`
+	// How much to wait for the resolution before considering it failed.
+	Timeout util.Duration `json:"timeout"`
+	// The Conditions that will evaluate the results to determine whether the
+	// Actions should be triggered or not.
+	Conditions []Condition `json:"conditions"`
+
+	// The resolver used to look up the hostname.
+	resolver Resolver
+	// The result of the data operation.
+	result Result
+}
+
+// Do implements common.Watch.Do(). It prepares the Result of the Watch, it
+// evaluates the Conditions, and returns the IDs of the Actions that should be
+// triggered as a result of the Watch, if any.
+func (watch Watch) Do(ctx context.Context) []int {
+	actionsIDs, _ := watch.DoWithContext(ctx)
+	return actionsIDs
+}
+
+// DoWithContext implements common.ContextWatch.DoWithContext(). It does the
+// same as Do(), and it additionally returns the context that the Actions should
+// be triggered with i.e. the status of the Result and the hostname.
+func (watch Watch) DoWithContext(ctx context.Context) ([]int, actions.ActionContext) {
+	watch.data(ctx)
+	ok := watch.evaluate()
+	actionContext := watch.ActionContext(watch.result.Status, map[string]string{"hostname": watch.Hostname})
+
+	if !ok {
+		return []int{}, actionContext
+	}
+
+	// If all conditions pass, return the IDs of the Actions that should be
+	// triggered.
+	return watch.ActionsIDs, actionContext
+}
+
+// Replay implements common.ReplayableWatch.Replay(). It evaluates each of the
+// Watch's Conditions against the given JSON-encoded Result, without resolving
+// the Watch's hostname.
+func (watch Watch) Replay(jsonResult []byte) ([]bool, error) {
+	var result Result
+	err := json.Unmarshal(jsonResult, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]bool, len(watch.Conditions))
+	for index, condition := range watch.Conditions {
+		outcomes[index] = condition.Do(result)
+	}
+
+	return outcomes, nil
+}
+
+// SetResolver allows to inject a resolver into the corresponding field.
+func (watch *Watch) SetResolver(resolver Resolver) {
+	watch.resolver = resolver
+}
+
+// Resolves the hostname defined in the Watch and determines the Result.
+func (watch *Watch) data(ctx context.Context) {
+	if watch.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, watch.Timeout.Duration)
+		defer cancel()
+	}
+
+	records, err := watch.lookup(ctx)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.Err == "no such host" {
+			watch.result = Result{Status: "not_found"}
+			return
+		}
+		watch.result = Result{Status: "failure"}
+		return
+	}
+
+	if len(records) == 0 {
+		watch.result = Result{Status: "not_found"}
+		return
+	}
+
+	// Check whether all expected values are among the resolved records.
+	resolved := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		resolved[normalize(watch.recordType(), record)] = struct{}{}
+	}
+	for _, value := range watch.ExpectedValues {
+		if _, ok := resolved[normalize(watch.recordType(), value)]; !ok {
+			watch.result = Result{Status: "value_mismatch", Records: records}
+			return
+		}
+	}
+
+	watch.result = Result{Status: "success", Records: records}
+}
+
+// lookup looks up the records of the Watch's type for its hostname.
+func (watch *Watch) lookup(ctx context.Context) ([]string, error) {
+	var records []string
+
+	switch watch.recordType() {
+	case RecordTypeA, RecordTypeAAAA:
+		addresses, err := watch.resolver.LookupIPAddr(ctx, watch.Hostname)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			isIPv4 := address.IP.To4() != nil
+			if isIPv4 == (watch.recordType() == RecordTypeA) {
+				records = append(records, address.IP.String())
+			}
+		}
+	case RecordTypeCNAME:
+		cname, err := watch.resolver.LookupCNAME(ctx, watch.Hostname)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, cname)
+	case RecordTypeMX:
+		mxs, err := watch.resolver.LookupMX(ctx, watch.Hostname)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			records = append(records, mx.Host)
+		}
+	case RecordTypeTXT:
+		txts, err := watch.resolver.LookupTXT(ctx, watch.Hostname)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, txts...)
+	default:
+		return nil, fmt.Errorf("unknown DNS record type \"%s\"", watch.RecordType)
+	}
+
+	return records, nil
+}
+
+// recordType returns the type of the DNS records that the Watch looks up.
+func (watch *Watch) recordType() string {
+	if watch.RecordType == "" {
+		return RecordTypeA
+	}
+
+	return strings.ToUpper(watch.RecordType)
+}
+
+// Go through all Conditions defined in the Watch and evaluate them. The
+// Conditions are successful in their entirety when all Conditions evaluate
+// successfully.
+func (watch *Watch) evaluate() bool {
+	allOk := true
+	for _, condition := range watch.Conditions {
+		ok := condition.Do(watch.result)
+		if !ok {
+			allOk = false
+			break
+		}
+	}
+
+	return allOk
+}
+
+// normalize converts a record of the given type to a form that can be compared
+// with other records of the same type. IP addresses are converted to their
+// canonical form and hostnames are lowercased without the trailing dot; TXT
+// records are compared as they are.
+func normalize(recordType string, record string) string {
+	switch recordType {
+	case RecordTypeA, RecordTypeAAAA:
+		if ip := net.ParseIP(record); ip != nil {
+			return ip.String()
+		}
+	case RecordTypeCNAME, RecordTypeMX:
+		return strings.TrimSuffix(strings.ToLower(record), ".")
+	}
+
+	return record
+}
+
+// Result holds the result of a DNS check. Its status is a string that can hold
+// one of the following values:
+// - success
+// - not_found
+// - value_mismatch
+// - failure
+// It also holds the resolved records, if any.
+type Result struct {
+	Status  string   `json:"status"`
+	Records []string `json:"records,omitempty"`
+}
+
+// Condition is an interface that should be implemented by all Condition types
+// for the DNS Check Watch. It simply defines a function that, given the Result
+// of a DNS Check operation, it decides whether the Condition is met.
+type Condition interface {
+	Do(Result) bool
+}
+
+// ConditionResolvesTo implements the Condition interface, providing a Condition
+// that is met when the hostname resolves to the expected values ("success").
+type ConditionResolvesTo struct{}
+
+// Do implements Condition.Do(), determining whether the hostname resolved to
+// the expected values.
+func (condition ConditionResolvesTo) Do(result Result) bool {
+	return result.Status == "success"
+}
+
+// ConditionResolutionFails implements the Condition interface, providing a
+// Condition that is met when the hostname does not resolve, or when it does not
+// resolve to the expected values (any other result apart from "success").
+type ConditionResolutionFails struct{}
+
+// Do implements Condition.Do(), determining whether the hostname failed to
+// resolve to the expected values.
+func (condition ConditionResolutionFails) Do(result Result) bool {
+	return result.Status != "success"
+}
+
+/**
+ * JSON.
+ */
+
+// MarshalJSON encodes a ConditionResolvesTo object into a JSON object that
+// contains a single field, indicating its type. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionResolvesTo) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"resolves_to"}`), nil
+}
+
+// MarshalJSON encodes a ConditionResolutionFails object into a JSON object that
+// contains a single field, indicating its type. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionResolutionFails) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"resolution_fails"}`), nil
+}
+
+// UnmarshalJSON provides decoding of a JSON-encoded Watch object so that the
+// Conditions held in the "conditions" field are properly constructed based on
+// their type.
+func (watch *Watch) UnmarshalJSON(bytes []byte) error {
+	// Deserialize everything into a map of json.RawMessage; its indices would
+	// correspond to the Watch struct's fields.
+	var jsonMap map[string]*json.RawMessage
+	err := json.Unmarshal(bytes, &jsonMap)
+	if err != nil {
+		return err
+	}
+
+	// Decode all other fields first.
+	if jsonMap["name"] != nil {
+		var name string
+		err = json.Unmarshal(*jsonMap["name"], &name)
+		if err != nil {
+			return err
+		}
+		watch.Name = name
+	}
+	if jsonMap["actions_ids"] != nil {
+		var actionsIds []int
+		err = json.Unmarshal(*jsonMap["actions_ids"], &actionsIds)
+		if err != nil {
+			return err
+		}
+		watch.ActionsIDs = actionsIds
+	}
+	if jsonMap["created_at"] != nil {
+		var createdAt *time.Time
+		err = json.Unmarshal(*jsonMap["created_at"], &createdAt)
+		if err != nil {
+			return err
+		}
+		watch.CreatedAt = createdAt
+	}
+	if jsonMap["updated_at"] != nil {
+		var updatedAt *time.Time
+		err = json.Unmarshal(*jsonMap["updated_at"], &updatedAt)
+		if err != nil {
+			return err
+		}
+		watch.UpdatedAt = updatedAt
+	}
+	if jsonMap["singleton"] != nil {
+		var singleton bool
+		err = json.Unmarshal(*jsonMap["singleton"], &singleton)
+		if err != nil {
+			return err
+		}
+		watch.Singleton = singleton
+	}
+	if jsonMap["warning_actions_ids"] != nil {
+		var warningActionsIDs []int
+		err = json.Unmarshal(*jsonMap["warning_actions_ids"], &warningActionsIDs)
+		if err != nil {
+			return err
+		}
+		watch.WarningActionsIDs = warningActionsIDs
+	}
+	if jsonMap["actions_priorities"] != nil {
+		var actionsPriorities map[int]int
+		err = json.Unmarshal(*jsonMap["actions_priorities"], &actionsPriorities)
+		if err != nil {
+			return err
+		}
+		watch.ActionsPriorities = actionsPriorities
+	}
+	if jsonMap["stop_on_action_failure"] != nil {
+		var stopOnActionFailure bool
+		err = json.Unmarshal(*jsonMap["stop_on_action_failure"], &stopOnActionFailure)
+		if err != nil {
+			return err
+		}
+		watch.StopOnActionFailure = stopOnActionFailure
+	}
+	if jsonMap["hostname"] != nil {
+		var hostname string
+		err = json.Unmarshal(*jsonMap["hostname"], &hostname)
+		if err != nil {
+			return err
+		}
+		watch.Hostname = hostname
+	}
+	if jsonMap["record_type"] != nil {
+		var recordType string
+		err = json.Unmarshal(*jsonMap["record_type"], &recordType)
+		if err != nil {
+			return err
+		}
+		watch.RecordType = recordType
+	}
+	if jsonMap["expected_values"] != nil {
+		var expectedValues []string
+		err = json.Unmarshal(*jsonMap["expected_values"], &expectedValues)
+		if err != nil {
+			return err
+		}
+		watch.ExpectedValues = expectedValues
+	}
+	if jsonMap["timeout"] != nil {
+		var timeout util.Duration
+		err = json.Unmarshal(*jsonMap["timeout"], &timeout)
+		if err != nil {
+			return err
+		}
+		watch.Timeout = timeout
+	}
+
+	// If no conditions are given, there's nothing to do; return or we'll get an
+	// error.
+	if jsonMap["conditions"] == nil {
+		return nil
+	}
+
+	var rawConditions []*json.RawMessage
+	err = json.Unmarshal(*jsonMap["conditions"], &rawConditions)
+	if err != nil {
+		return err
+	}
+
+	// Create a slice of the right size that will hold the Conditions.
+	watch.Conditions = make([]Condition, len(rawConditions))
+
+	// Decode the Conditions from their JSON structure and put them in the
+	// corresponding field slice.
+	for index, rawCondition := range rawConditions {
+		var conditionInnerJSON map[string]*json.RawMessage
+		err = json.Unmarshal(*rawCondition, &conditionInnerJSON)
+		if err != nil {
+			return err
+		}
+
+		// Get the type of the Condition.
+		if conditionInnerJSON["type"] == nil {
+			return fmt.Errorf("a Condition was given without its type")
+		}
+		var conditionType string
+		err = json.Unmarshal(*conditionInnerJSON["type"], &conditionType)
+		if err != nil {
+			return err
+		}
+
+		switch conditionType {
+		case "resolves_to":
+			watch.Conditions[index] = ConditionResolvesTo{}
+		case "resolution_fails":
+			watch.Conditions[index] = ConditionResolutionFails{}
+		default:
+			return fmt.Errorf("unknown Condition type \"%s\"", conditionType)
+		}
+	}
+
+	return nil
+}
+
+// NewDNSCheckWatch implements the WatchFactory function type. It creates a DNS
+// Check Watch based on the given JSON-object, and initializes it by injecting
+// the system's resolver.
+var NewDNSCheckWatch = func(jsonWatch *json.RawMessage) (common.Watch, error) {
+	// Create a Watch object from JSON.
+	var watch Watch
+	err := json.Unmarshal(*jsonWatch, &watch)
+	if err != nil {
+		return nil, err
+	}
+
+	if watch.Hostname == "" {
+		return nil, fmt.Errorf("a DNS Check Watch requires a hostname")
+	}
+	switch watch.recordType() {
+	case RecordTypeA, RecordTypeAAAA, RecordTypeCNAME, RecordTypeMX, RecordTypeTXT:
+	default:
+		return nil, fmt.Errorf("unknown DNS record type \"%s\"", watch.RecordType)
+	}
+
+	watch.SetResolver(&net.Resolver{})
+
+	return watch, nil
+}
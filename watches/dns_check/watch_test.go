@@ -0,0 +1,228 @@
+/**
+ * Tests for the DNS Check Watch.
+ */
+
+package msWatchDNSCheck
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Helper types and functions reused in various tests.
+ */
+
+// testWatch generates a Watch object with some defaults.
+func testWatch(recordType string, expectedValues ...string) Watch {
+	watch := Watch{
+		WatchBase: common.WatchBase{
+			Name:       "Test Watch",
+			ActionsIDs: []int{1},
+		},
+		Hostname:       "example.com",
+		RecordType:     recordType,
+		ExpectedValues: expectedValues,
+		Conditions:     []Condition{},
+	}
+	return watch
+}
+
+// A resolver that returns a fixed set of records for every hostname.
+type MockResolver struct{}
+
+func (resolver MockResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return []net.IPAddr{
+		{IP: net.ParseIP("93.184.216.34")},
+		{IP: net.ParseIP("2606:2800:220:1:248:1893:25c8:1946")},
+	}, nil
+}
+
+func (resolver MockResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return "Alias.Example.com.", nil
+}
+
+func (resolver MockResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return []*net.MX{{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}}, nil
+}
+
+func (resolver MockResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return []string{"v=spf1 -all"}, nil
+}
+
+// A resolver that does not know any hostnames, simulating an NXDOMAIN
+// response.
+type MockResolverNotFound struct{}
+
+func (resolver MockResolverNotFound) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host}
+}
+
+func (resolver MockResolverNotFound) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return "", &net.DNSError{Err: "no such host", Name: host}
+}
+
+func (resolver MockResolverNotFound) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name}
+}
+
+func (resolver MockResolverNotFound) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name}
+}
+
+// A resolver that returns an error, simulating an unreachable DNS server.
+type MockResolverError struct{}
+
+func (resolver MockResolverError) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, fmt.Errorf("the DNS server is not reachable")
+}
+
+func (resolver MockResolverError) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return "", fmt.Errorf("the DNS server is not reachable")
+}
+
+func (resolver MockResolverError) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return nil, fmt.Errorf("the DNS server is not reachable")
+}
+
+func (resolver MockResolverError) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, fmt.Errorf("the DNS server is not reachable")
+}
+
+/**
+ * Test Result preparation depending on the resolved records.
+ */
+
+func TestResultPreparation_Success(t *testing.T) {
+	cases := []struct {
+		recordType     string
+		expectedValues []string
+		records        []string
+	}{
+		{"", []string{"93.184.216.34"}, []string{"93.184.216.34"}},
+		{"A", nil, []string{"93.184.216.34"}},
+		{"aaaa", []string{"2606:2800:0220:0001:0248:1893:25c8:1946"}, []string{"2606:2800:220:1:248:1893:25c8:1946"}},
+		{"CNAME", []string{"alias.example.com"}, []string{"Alias.Example.com."}},
+		{"MX", []string{"mx2.example.com."}, []string{"mx1.example.com.", "mx2.example.com."}},
+		{"TXT", []string{"v=spf1 -all"}, []string{"v=spf1 -all"}},
+	}
+
+	for _, c := range cases {
+		watch := testWatch(c.recordType, c.expectedValues...)
+		watch.SetResolver(MockResolver{})
+		watch.data(context.Background())
+
+		assert.Equal(t, "success", watch.result.Status, c.recordType)
+		assert.Equal(t, c.records, watch.result.Records, c.recordType)
+	}
+}
+
+func TestResultPreparation_NotFound(t *testing.T) {
+	watch := testWatch("A", "93.184.216.34")
+	watch.SetResolver(MockResolverNotFound{})
+	watch.data(context.Background())
+
+	assert.Equal(t, "not_found", watch.result.Status)
+	assert.Nil(t, watch.result.Records)
+}
+
+func TestResultPreparation_ValueMismatch(t *testing.T) {
+	watch := testWatch("A", "93.184.216.34", "10.0.0.1")
+	watch.SetResolver(MockResolver{})
+	watch.data(context.Background())
+
+	assert.Equal(t, "value_mismatch", watch.result.Status)
+	assert.Equal(t, []string{"93.184.216.34"}, watch.result.Records)
+}
+
+func TestResultPreparation_Failure(t *testing.T) {
+	watch := testWatch("MX")
+	watch.SetResolver(MockResolverError{})
+	watch.data(context.Background())
+
+	assert.Equal(t, "failure", watch.result.Status)
+}
+
+/**
+ * Test evaluating the Conditions.
+ */
+
+func TestDo(t *testing.T) {
+	cases := []struct {
+		resolver   Resolver
+		condition  Condition
+		actionsIDs []int
+	}{
+		{MockResolver{}, ConditionResolvesTo{}, []int{1}},
+		{MockResolver{}, ConditionResolutionFails{}, []int{}},
+		{MockResolverNotFound{}, ConditionResolvesTo{}, []int{}},
+		{MockResolverNotFound{}, ConditionResolutionFails{}, []int{1}},
+	}
+
+	for index, c := range cases {
+		watch := testWatch("A", "93.184.216.34")
+		watch.Conditions = []Condition{c.condition}
+		watch.SetResolver(c.resolver)
+
+		assert.Equal(t, c.actionsIDs, watch.Do(context.Background()), "case %d", index)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	watch := testWatch("A")
+	watch.Conditions = []Condition{ConditionResolvesTo{}, ConditionResolutionFails{}}
+
+	// The Watch has no resolver injected; replaying must not resolve the
+	// hostname.
+	outcomes, err := watch.Replay([]byte(`{"status":"value_mismatch","records":["10.0.0.1"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, true}, outcomes)
+}
+
+/**
+ * Test JSON encoding/decoding.
+ */
+
+func TestJSON(t *testing.T) {
+	watch := testWatch("MX", "mx1.example.com")
+	watch.Conditions = []Condition{ConditionResolvesTo{}, ConditionResolutionFails{}}
+
+	jsonWatch, err := json.Marshal(watch)
+	assert.Nil(t, err)
+
+	var decodedWatch Watch
+	err = json.Unmarshal(jsonWatch, &decodedWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, watch, decodedWatch)
+}
+
+func TestUnmarshalJSON_UnknownCondition(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"hostname":"example.com","conditions":[{"type":"success"}]}`), &watch)
+	assert.EqualError(t, err, "unknown Condition type \"success\"")
+}
+
+func TestNewDNSCheckWatch(t *testing.T) {
+	jsonWatch := json.RawMessage(`{"hostname":"example.com","record_type":"TXT"}`)
+	watch, err := NewDNSCheckWatch(&jsonWatch)
+	assert.Nil(t, err)
+	assert.IsType(t, Watch{}, watch)
+
+	jsonWatch = json.RawMessage(`{"hostname":"example.com","record_type":"SRV"}`)
+	_, err = NewDNSCheckWatch(&jsonWatch)
+	assert.EqualError(t, err, "unknown DNS record type \"SRV\"")
+
+	jsonWatch = json.RawMessage(`{"record_type":"A"}`)
+	_, err = NewDNSCheckWatch(&jsonWatch)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,170 @@
+/**
+ * Provides the HTTP transport shared by all Health Check Watches.
+ *
+ * Watches are created every time they are loaded from storage, such as every
+ * time they are triggered. Sharing the transport allows connections to the
+ * checked URLs to be kept alive and reused between evaluations, avoiding
+ * resolving the hostnames and opening new connections on every evaluation.
+ */
+
+package msWatchHealthCheck
+
+import (
+	// Utilities.
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+ * Constants.
+ */
+
+// MaxIdleConnsDefault holds the maximum number of idle connections kept open
+// across all hosts when no limit is given in the configuration.
+const MaxIdleConnsDefault = 100
+
+// MaxIdleConnsPerHostDefault holds the maximum number of idle connections kept
+// open to each host when no limit is given in the configuration.
+const MaxIdleConnsPerHostDefault = 10
+
+// IdleConnTimeoutDefault holds how long idle connections are kept open when no
+// timeout is given in the configuration.
+const IdleConnTimeoutDefault = 90 * time.Second
+
+// KeepAliveDefault holds the interval between the keep-alive probes of open
+// connections when no interval is given in the configuration.
+const KeepAliveDefault = 30 * time.Second
+
+/**
+ * Public API.
+ */
+
+// TransportConfig holds the configuration of the HTTP transport shared by all
+// Health Check Watches. Defaults are used for the options that are not given.
+type TransportConfig struct {
+	// The maximum number of idle connections kept open across all hosts.
+	MaxIdleConns int `json:"max_idle_conns"`
+	// The maximum number of idle connections kept open to each host.
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+	// How long idle connections are kept open before they are closed, as a
+	// duration string e.g. "90s".
+	IdleConnTimeout string `json:"idle_conn_timeout"`
+	// The interval between the keep-alive probes of open connections, as a
+	// duration string e.g. "30s".
+	KeepAlive string `json:"keep_alive"`
+	// Whether connections are closed after each request instead of being
+	// reused.
+	DisableKeepAlives bool `json:"disable_keep_alives"`
+}
+
+// Validate checks that the configuration options are valid.
+func (config TransportConfig) Validate() error {
+	_, err := config.Transport()
+	return err
+}
+
+// Transport creates a new HTTP transport based on the configuration.
+func (config TransportConfig) Transport() (*http.Transport, error) {
+	if config.MaxIdleConns < 0 {
+		return nil, fmt.Errorf("the maximum number of idle connections cannot be negative")
+	}
+	maxIdleConns := config.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = MaxIdleConnsDefault
+	}
+
+	if config.MaxIdleConnsPerHost < 0 {
+		return nil, fmt.Errorf("the maximum number of idle connections per host cannot be negative")
+	}
+	maxIdleConnsPerHost := config.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost == 0 {
+		maxIdleConnsPerHost = MaxIdleConnsPerHostDefault
+	}
+
+	idleConnTimeout, err := parseDuration(config.IdleConnTimeout, IdleConnTimeoutDefault)
+	if err != nil {
+		return nil, fmt.Errorf("the idle connection timeout is not valid: %s", err.Error())
+	}
+	keepAlive, err := parseDuration(config.KeepAlive, KeepAliveDefault)
+	if err != nil {
+		return nil, fmt.Errorf("the keep-alive interval is not valid: %s", err.Error())
+	}
+
+	// The rest of the options are the same as for the default transport.
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: keepAlive,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		DisableKeepAlives:     config.DisableKeepAlives,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
+
+// ConfigureTransport replaces the HTTP transport shared by all Health Check
+// Watches with one created based on the given configuration. It should be
+// called before any Watches are created; Watches already created keep using
+// the previous transport.
+func ConfigureTransport(config TransportConfig) error {
+	transport, err := config.Transport()
+	if err != nil {
+		return err
+	}
+
+	sharedTransportMutex.Lock()
+	defer sharedTransportMutex.Unlock()
+	sharedTransport = transport
+
+	return nil
+}
+
+/**
+ * For internal use.
+ */
+
+// sharedTransport holds the HTTP transport shared by all Health Check Watches.
+// It is created with the default configuration the first time it is needed,
+// unless it is configured earlier.
+var sharedTransport *http.Transport
+
+// sharedTransportMutex guards sharedTransport.
+var sharedTransportMutex sync.Mutex
+
+// transport returns the HTTP transport shared by all Health Check Watches.
+func transport() *http.Transport {
+	sharedTransportMutex.Lock()
+	defer sharedTransportMutex.Unlock()
+	if sharedTransport == nil {
+		// The default configuration is always valid.
+		sharedTransport, _ = TransportConfig{}.Transport()
+	}
+
+	return sharedTransport
+}
+
+// parseDuration converts a duration, as given in the configuration, to a
+// duration. The given default is returned if none is given.
+func parseDuration(value string, defaultDuration time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultDuration, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("the duration cannot be negative")
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,136 @@
+/**
+ * Tests for the HTTP transport shared by the Health Check Watches.
+ */
+
+package msWatchHealthCheck
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Tests.
+ */
+
+func TestTransportConfig_Transport(t *testing.T) {
+	transport, err := TransportConfig{}.Transport()
+	assert.Nil(t, err)
+	assert.Equal(t, MaxIdleConnsDefault, transport.MaxIdleConns)
+	assert.Equal(t, MaxIdleConnsPerHostDefault, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, IdleConnTimeoutDefault, transport.IdleConnTimeout)
+	assert.False(t, transport.DisableKeepAlives)
+
+	transport, err = TransportConfig{
+		MaxIdleConns:        20,
+		MaxIdleConnsPerHost: 5,
+		IdleConnTimeout:     "1m",
+		KeepAlive:           "15s",
+		DisableKeepAlives:   true,
+	}.Transport()
+	assert.Nil(t, err)
+	assert.Equal(t, 20, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.True(t, transport.DisableKeepAlives)
+}
+
+func TestTransportConfig_Invalid(t *testing.T) {
+	configs := []TransportConfig{
+		{MaxIdleConns: -1},
+		{MaxIdleConnsPerHost: -1},
+		{IdleConnTimeout: "soon"},
+		{IdleConnTimeout: "-1s"},
+		{KeepAlive: "-30s"},
+	}
+	for _, config := range configs {
+		assert.NotNil(t, config.Validate(), "%+v", config)
+	}
+}
+
+func TestNewHealthCheckWatch_SharedTransport(t *testing.T) {
+	// Count the connections opened to the server.
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// Watches are created for every evaluation, the same way as when they are
+	// loaded from storage every time they are triggered.
+	jsonWatch := json.RawMessage(`{"url":"` + server.URL + `","statuses":[200],"timeout":1000000000,"actions_ids":[1]}`)
+	var transports []http.RoundTripper
+	for i := 0; i < 5; i++ {
+		watch, err := NewHealthCheckWatch(&jsonWatch)
+		assert.Nil(t, err)
+		assert.Equal(t, []int{1}, watch.Do(context.Background()))
+		transports = append(transports, watch.(Watch).httpClient.(*http.Client).Transport)
+	}
+
+	// The same transport is used by all Watches, and the connection is reused
+	// between the evaluations.
+	for _, transport := range transports {
+		assert.True(t, transport == transports[0])
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+}
+
+/**
+ * Benchmarks.
+ */
+
+func BenchmarkDo_SharedTransport(b *testing.B) {
+	server := testBenchmarkServer()
+	defer server.Close()
+
+	watch := testWatch()
+	watch.URL = server.URL
+	watch.SetHTTPClient(&http.Client{Transport: transport()})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		watch.Do(context.Background())
+	}
+}
+
+func BenchmarkDo_TransportPerCall(b *testing.B) {
+	server := testBenchmarkServer()
+	defer server.Close()
+
+	watch := testWatch()
+	watch.URL = server.URL
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		transport, _ := TransportConfig{}.Transport()
+		watch.SetHTTPClient(&http.Client{Transport: transport})
+		watch.Do(context.Background())
+		transport.CloseIdleConnections()
+	}
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testBenchmarkServer starts a server that responds successfully to every
+// request.
+func testBenchmarkServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+}
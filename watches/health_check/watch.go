@@ -6,15 +6,42 @@ package msWatchHealthCheck
 
 import (
 	// Utilities.
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
 	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
 )
 
+/**
+ * Constants.
+ */
+
+// MaxBodyBytesDefault holds the maximum number of bytes of the response body
+// that are recorded in the Result, when the Watch is configured to capture the
+// body without giving a limit.
+const MaxBodyBytesDefault = 64 * 1024
+
+// The default Conditions that Watches without Conditions can be evaluated
+// against. "success" evaluates the Watch against the ConditionSuccess
+// Condition, "failure" against the ConditionFailure Condition, while "always"
+// evaluates it as passing regardless of the Result, triggering its Actions
+// every time it runs.
+const (
+	DefaultConditionSuccess = "success"
+	DefaultConditionFailure = "failure"
+	DefaultConditionAlways  = "always"
+)
+
 /**
  * Types and their functions.
  */
@@ -23,7 +50,7 @@ import (
 // HTTP client that makes the request to the Watch's URL. Dependency injection
 // is necessary for testing purposes.
 type HTTPClient interface {
-	Get(string) (*http.Response, error)
+	Do(*http.Request) (*http.Response, error)
 }
 
 // Watch implements the common.Watch interface. It provides a Watch that checks
@@ -35,35 +62,124 @@ type Watch struct {
 
 	// The URL that will be checked.
 	URL string `json:"url"`
+	// The HTTP method of the request made to the URL e.g. "HEAD" or "POST".
+	// Defaults to "GET".
+	Method string `json:"method"`
+	// The headers sent with the request, such as the credentials required by an
+	// authenticated API. A "User-Agent" header overrides the User-Agent of all
+	// Watches e.g. "mantis-shrimp/watch/1.0.0".
+	Headers map[string]string `json:"headers"`
+	// The body sent with the request, if any.
+	Body string `json:"body"`
 	// The HTTP Status codes that are considered successful.
 	Statuses []int `json:"statuses"`
+	// Ranges of HTTP Status codes that are considered successful, in addition to
+	// the codes given in Statuses. They can be given either as objects e.g.
+	// {"min":200,"max":299} or as strings e.g. "2xx".
+	StatusRanges []StatusRange `json:"status_ranges"`
 	// How much to wait for the response before considering the URL inaccessible.
-	Timeout time.Duration `json:"timeout"`
+	Timeout util.Duration `json:"timeout"`
+	// Whether redirects are followed, in which case the status of the final
+	// response is evaluated. Otherwise, the status of the redirect response
+	// itself e.g. 301 is evaluated. Defaults to true when decoded from JSON.
+	FollowRedirects bool `json:"follow_redirects"`
+	// The names of the response headers that will be recorded in the Result.
+	// Only the given headers are recorded so that we don't keep sensitive or
+	// unnecessarily large data. The headers evaluated by the Conditions are
+	// recorded as well.
+	CaptureHeaders []string `json:"capture_headers"`
+	// Whether the response body is recorded in the Result, so that Conditions
+	// can evaluate it.
+	CaptureBody bool `json:"capture_body"`
+	// The maximum number of bytes of the response body that are recorded; the
+	// rest of the body is discarded. Defaults to MaxBodyBytesDefault.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
 	// The Conditions that will evaluate the results to determine whether the
 	// Actions should be triggered or not.
 	Conditions []Condition `json:"conditions"`
+	// The Condition that the Watch is evaluated against when it has no
+	// Conditions; one of the DefaultCondition* values. Defaults to
+	// DefaultConditionSuccess. It is ignored when Conditions are given.
+	DefaultCondition string `json:"default_condition,omitempty"`
+	// The Conditions that are evaluated when the Conditions above are not met,
+	// to determine whether the Result has the "warning" severity and the
+	// Actions given in WarningActionsIDs should be triggered. No warnings are
+	// raised when none are given.
+	WarningConditions []Condition `json:"warning_conditions"`
 
 	// The HTTP client used to make the request to the URL.
 	httpClient HTTPClient
+	// The Result that the Watch is evaluated against instead of making the
+	// request to the URL, if one was given via WithResult().
+	givenResult *Result
 	// The result of the data operation.
 	result Result
 }
 
-// Do implements common.Watch.Do(). It prepares the Result of the Watch, it
-// evalutes the Conditions, and returns the IDs of the Actions that should be
-// triggered as a result of the Watch, if any.
-func (watch Watch) Do() []int {
-	watch.data()
-	ok := watch.evaluate()
+// Do implements common.Watch.Do(). It prepares the Result of the Watch, unless
+// one was given via WithResult(), it evalutes the Conditions, and returns the
+// IDs of the Actions that should be triggered as a result of the Watch, if any.
+func (watch Watch) Do(ctx context.Context) []int {
+	actionsIDs, _ := watch.DoWithContext(ctx)
+	return actionsIDs
+}
 
-	if !ok {
-		return []int{}
+// DoWithContext implements common.ContextWatch.DoWithContext(). It does the
+// same as Do(), and it additionally returns the context that the Actions should
+// be triggered with i.e. the status and the severity of the Result and the URL,
+// together with the response headers that the Watch captured.
+func (watch Watch) DoWithContext(ctx context.Context) ([]int, actions.ActionContext) {
+	if watch.givenResult != nil {
+		watch.result = *watch.givenResult
+	} else {
+		watch.data(ctx)
 	}
-
-	// If all conditions pass, return the IDs of the Actions that should be
-	// triggered.
+	watch.result.Severity = watch.severity()
+	actionContext := watch.ActionContext(
+		watch.result.Status,
+		map[string]string{"url": watch.URL, "severity": watch.result.Severity},
+	)
+	actionContext.Headers = watch.result.Headers
+	actionContext.Body = watch.result.Body
+	actionContext.BodyTruncated = watch.result.BodyTruncated
+
+	// Return the IDs of the Actions that should be triggered for the severity of
+	// the Result, if any.
 	// Store any Actions given in the Actions field and return their IDs as well.
-	return watch.ActionsIDs
+	return watch.SeverityActionsIDs(watch.result.Severity), actionContext
+}
+
+// Replay implements common.ReplayableWatch.Replay(). It evaluates each of the
+// Watch's Conditions, or its default Condition if it has none, against the
+// given JSON-encoded Result, without making a request to the Watch's URL.
+func (watch Watch) Replay(jsonResult []byte) ([]bool, error) {
+	var result Result
+	err := json.Unmarshal(jsonResult, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := watch.conditions()
+	outcomes := make([]bool, len(conditions))
+	for index, condition := range conditions {
+		outcomes[index] = condition.Do(result)
+	}
+
+	return outcomes, nil
+}
+
+// WithResult implements common.ResultWatch.WithResult(). It returns a copy of
+// the Watch that is evaluated against the given JSON-encoded Result, without
+// making a request to the Watch's URL.
+func (watch Watch) WithResult(jsonResult []byte) (common.Watch, error) {
+	var result Result
+	err := json.Unmarshal(jsonResult, &result)
+	if err != nil {
+		return nil, err
+	}
+	watch.givenResult = &result
+
+	return watch, nil
 }
 
 // SetHTTPClient allows to inject an HTTP client into the corresponding field.
@@ -71,33 +187,156 @@ func (watch *Watch) SetHTTPClient(client HTTPClient) {
 	watch.httpClient = client
 }
 
-// Makes a GET call to the URL defined in the Watch and determines the Result.
-func (watch *Watch) data() {
-	res, err := watch.httpClient.Get(watch.URL)
+// Makes a call to the URL defined in the Watch and determines the Result.
+func (watch *Watch) data(ctx context.Context) {
+	req, err := watch.request(ctx)
+	if err != nil {
+		watch.result = Result{Status: "inaccessible"}
+		return
+	}
+
+	res, err := watch.httpClient.Do(req)
 	if err != nil {
 		// @I Differentiate between lack of accessibility and timeout in health
 		//    check watch
 		watch.result = Result{Status: "inaccessible"}
 		return
 	}
-
-	// Check whether the Response Status is one that is considered successful.
-	statusMatch := false
-	for _, status := range watch.Statuses {
-		if res.StatusCode == status {
-			statusMatch = true
-			break
+	defer closeBody(res.Body)
+
+	// Record the requested response headers and body, if any. A body that
+	// cannot be read is considered the same as a response that cannot be
+	// received.
+	result := Result{
+		StatusCode: res.StatusCode,
+		Headers:    watch.captureHeaders(res.Header),
+	}
+	if watch.CaptureBody {
+		result.Body, result.BodyTruncated, err = watch.captureBody(res.Body)
+		if err != nil {
+			watch.result = Result{Status: "inaccessible"}
+			return
 		}
 	}
 
-	if !statusMatch {
-		watch.result = Result{Status: "status_mismatch"}
+	// Check whether the Response Status is one that is considered successful.
+	if !watch.statusMatches(res.StatusCode) {
+		result.Status = "status_mismatch"
+		watch.result = result
 		return
 	}
 
 	// If we got a response with one of the successful statuses, the result is
 	// "success".
-	watch.result = Result{Status: "success"}
+	result.Status = "success"
+	watch.result = result
+}
+
+// statusMatches returns whether the given HTTP Status code is one of the
+// successful codes or falls in one of the successful ranges.
+func (watch *Watch) statusMatches(code int) bool {
+	for _, status := range watch.Statuses {
+		if code == status {
+			return true
+		}
+	}
+	for _, statusRange := range watch.StatusRanges {
+		if code >= statusRange.Min && code <= statusRange.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// request builds the request that is made to the URL defined in the Watch.
+func (watch *Watch) request(ctx context.Context) (*http.Request, error) {
+	method := watch.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, watch.URL, strings.NewReader(watch.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", util.UserAgent("watch"))
+	for name, value := range watch.Headers {
+		// The Host header is taken from the request's Host field only.
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+// captureHeaders returns the response headers that the Watch is configured to
+// record, together with the headers that its Conditions evaluate. Headers not
+// present in the response are omitted.
+func (watch *Watch) captureHeaders(header http.Header) http.Header {
+	names := append([]string{}, watch.CaptureHeaders...)
+	conditions := append(append([]Condition{}, watch.Conditions...), watch.WarningConditions...)
+	for _, condition := range conditions {
+		switch condition := condition.(type) {
+		case ConditionHeaderEquals:
+			names = append(names, condition.Name)
+		case ConditionHeaderPresent:
+			names = append(names, condition.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	headers := make(http.Header)
+	for _, name := range names {
+		values, ok := header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			continue
+		}
+		headers[http.CanonicalHeaderKey(name)] = values
+	}
+
+	return headers
+}
+
+// captureBody reads and returns the given response body up to the maximum
+// number of bytes that the Watch is configured to record, together with whether
+// the body was longer than that. The rest of the body is not read so that huge
+// responses do not exhaust the memory.
+func (watch *Watch) captureBody(body io.Reader) (string, bool, error) {
+	maxBytes := watch.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = MaxBodyBytesDefault
+	}
+
+	// Read one more byte than the limit to find out whether the body is longer.
+	content, err := ioutil.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return "", false, err
+	}
+	if int64(len(content)) > maxBytes {
+		return string(content[:maxBytes]), true, nil
+	}
+
+	return string(content), false, nil
+}
+
+// severity evaluates the Conditions of the Watch and, if they are not met, its
+// warning Conditions, and it returns the severity of the Result accordingly.
+func (watch *Watch) severity() string {
+	if watch.evaluate() {
+		return common.SeverityCritical
+	}
+	if len(watch.WarningConditions) != 0 && watch.evaluateAll(watch.WarningConditions) {
+		return common.SeverityWarning
+	}
+
+	return common.SeverityOK
 }
 
 // Go through all Conditions defined in the Watch and evaluate them. The
@@ -107,10 +346,94 @@ func (watch *Watch) evaluate() bool {
 	// @I Support Condition operators in Watches that would allow combining
 	//    Conditions in flexible ways
 	// @I Consider abstracting the Watch.evalute() function so that it is reusable
-	// @I Consider using Goroutines to evaluate multiple Conditions in a Watch
 
+	return watch.evaluateAll(watch.conditions())
+}
+
+// evaluateAll evaluates the given Conditions against the Result, and it returns
+// whether all of them are met.
+// The Conditions are evaluated concurrently; the evaluation finishes as soon as
+// a Condition fails, without waiting for the rest of the Conditions.
+func (watch *Watch) evaluateAll(conditions []Condition) bool {
+	// There is nothing to gain by evaluating a single Condition concurrently.
+	if len(conditions) < 2 {
+		return watch.evaluateAllSerially(conditions)
+	}
+
+	// The Conditions are given a copy of the Result so that Conditions still
+	// running after the evaluation finishes never read a Result that changes.
+	result := watch.result
+
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	wg.Add(len(conditions))
+	for _, condition := range conditions {
+		condition := condition
+		go func() {
+			defer wg.Done()
+
+			// Don't bother if another Condition has already failed.
+			select {
+			case <-failed:
+				return
+			default:
+			}
+
+			if !condition.Do(result) {
+				failOnce.Do(func() { close(failed) })
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-failed:
+		return false
+	case <-done:
+		// A Condition may have failed right before all of them finished.
+		select {
+		case <-failed:
+			return false
+		default:
+			return true
+		}
+	}
+}
+
+// conditions returns the Conditions that the Watch is evaluated against i.e.
+// its Conditions, or its default Condition if it has none.
+func (watch *Watch) conditions() []Condition {
+	if len(watch.Conditions) != 0 {
+		return watch.Conditions
+	}
+
+	switch watch.DefaultCondition {
+	case DefaultConditionFailure:
+		return []Condition{ConditionFailure{}}
+	case DefaultConditionAlways:
+		return nil
+	}
+
+	return []Condition{ConditionSuccess{}}
+}
+
+// evaluateSerially does the same as evaluate(), but it evaluates the Conditions
+// one after the other.
+func (watch *Watch) evaluateSerially() bool {
+	return watch.evaluateAllSerially(watch.conditions())
+}
+
+// evaluateAllSerially does the same as evaluateAll(), but it evaluates the
+// given Conditions one after the other.
+func (watch *Watch) evaluateAllSerially(conditions []Condition) bool {
 	allOk := true
-	for _, condition := range watch.Conditions {
+	for _, condition := range conditions {
 		ok := condition.Do(watch.result)
 		if !ok {
 			allOk = false
@@ -121,14 +444,29 @@ func (watch *Watch) evaluate() bool {
 	return allOk
 }
 
-// Result holds the result of a URL health check. It is simply a string that can
-// hold one of the following values:
+// StatusRange holds a range of HTTP Status codes, inclusive of its limits.
+type StatusRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Result holds the result of a URL health check. Its status is a string that
+// can hold one of the following values:
 // - success
 // - inaccessible
 // - timeout
 // - status_mismatch
+// It also holds the severity of the Result, once the Conditions have been
+// evaluated, and the HTTP Status code of the response, if a response was
+// received, the response headers and body that the Watch is configured to
+// capture, and whether the body was truncated to the configured limit.
 type Result struct {
-	Status string
+	Status        string      `json:"status"`
+	Severity      string      `json:"severity,omitempty"`
+	StatusCode    int         `json:"status_code,omitempty"`
+	Headers       http.Header `json:"headers,omitempty"`
+	Body          string      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
 }
 
 // Condition is an interface that should be implemented by all Condition types
@@ -167,6 +505,63 @@ func (condition ConditionFailure) Do(result Result) bool {
 	return false
 }
 
+// ConditionStatusIn implements the Condition interface, providing a Condition
+// that is met when the response has one of the given HTTP Status codes e.g. to
+// trigger Actions on a 503 response but not on a 404 one. It is never met when
+// no response was received.
+type ConditionStatusIn struct {
+	Codes []int `json:"codes"`
+}
+
+// Do implements Condition.Do(), determining whether the HTTP Status code of the
+// response is one of the Condition's codes.
+func (condition ConditionStatusIn) Do(result Result) bool {
+	for _, code := range condition.Codes {
+		if result.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConditionHeaderEquals implements the Condition interface, providing a
+// Condition that is met when the response has the header with the given name
+// set to the given value e.g. a "Content-Type" of "application/json". The name
+// is matched case-insensitively, while the value is matched exactly against
+// each of the header's values. It is never met when no response was received.
+type ConditionHeaderEquals struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Do implements Condition.Do(), determining whether the response header has the
+// Condition's value.
+func (condition ConditionHeaderEquals) Do(result Result) bool {
+	for _, value := range result.Headers[http.CanonicalHeaderKey(condition.Name)] {
+		if value == condition.Value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConditionHeaderPresent implements the Condition interface, providing a
+// Condition that is met when the response has the header with the given name,
+// with any value. The name is matched case-insensitively. It is never met when
+// no response was received.
+type ConditionHeaderPresent struct {
+	Name string `json:"name"`
+}
+
+// Do implements Condition.Do(), determining whether the response has the
+// Condition's header.
+func (condition ConditionHeaderPresent) Do(result Result) bool {
+	_, ok := result.Headers[http.CanonicalHeaderKey(condition.Name)]
+	return ok
+}
+
 /**
  * JSON.
  */
@@ -187,6 +582,70 @@ func (condition ConditionFailure) MarshalJSON() ([]byte, error) {
 	return []byte(`{"type":"failure"}`), nil
 }
 
+// MarshalJSON encodes a ConditionStatusIn object into a JSON object that
+// contains its type together with its HTTP Status codes. This is desired so
+// that a JSON-encoded Watch object containing such a Condition can be then
+// decoded based on the Condition type.
+func (condition ConditionStatusIn) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Codes []int  `json:"codes"`
+	}{"status_in", condition.Codes})
+}
+
+// MarshalJSON encodes a ConditionHeaderEquals object into a JSON object that
+// contains its type together with the header's name and value. This is desired
+// so that a JSON-encoded Watch object containing such a Condition can be then
+// decoded based on the Condition type.
+func (condition ConditionHeaderEquals) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}{"header_equals", condition.Name, condition.Value})
+}
+
+// MarshalJSON encodes a ConditionHeaderPresent object into a JSON object that
+// contains its type together with the header's name. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionHeaderPresent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}{"header_present", condition.Name})
+}
+
+// UnmarshalJSON decodes a StatusRange given either as an object with the
+// range's limits e.g. {"min":200,"max":299}, or as a class of HTTP Status codes
+// e.g. "2xx".
+func (statusRange *StatusRange) UnmarshalJSON(bytes []byte) error {
+	var class string
+	if json.Unmarshal(bytes, &class) == nil {
+		if len(class) != 3 || class[0] < '1' || class[0] > '5' || strings.ToLower(class[1:]) != "xx" {
+			return fmt.Errorf("invalid HTTP Status class \"%s\"; it should be one of \"1xx\" to \"5xx\"", class)
+		}
+		statusRange.Min = int(class[0]-'0') * 100
+		statusRange.Max = statusRange.Min + 99
+		return nil
+	}
+
+	// Decode the object into a type without the UnmarshalJSON method, otherwise
+	// we would end up in an infinite loop.
+	type statusRangeLimits StatusRange
+	var limits statusRangeLimits
+	err := json.Unmarshal(bytes, &limits)
+	if err != nil {
+		return err
+	}
+	if limits.Min > limits.Max {
+		return fmt.Errorf("invalid HTTP Status range; the minimum %d is greater than the maximum %d", limits.Min, limits.Max)
+	}
+	*statusRange = StatusRange(limits)
+
+	return nil
+}
+
 // UnmarshalJSON provides decoding of a JSON-encoded Watch object so that the
 // Conditions held in the "conditions" field are properly constructed based on
 // their type.
@@ -218,6 +677,54 @@ func (watch *Watch) UnmarshalJSON(bytes []byte) error {
 		}
 		watch.ActionsIDs = actionsIds
 	}
+	if jsonMap["created_at"] != nil {
+		var createdAt *time.Time
+		err = json.Unmarshal(*jsonMap["created_at"], &createdAt)
+		if err != nil {
+			return err
+		}
+		watch.CreatedAt = createdAt
+	}
+	if jsonMap["updated_at"] != nil {
+		var updatedAt *time.Time
+		err = json.Unmarshal(*jsonMap["updated_at"], &updatedAt)
+		if err != nil {
+			return err
+		}
+		watch.UpdatedAt = updatedAt
+	}
+	if jsonMap["singleton"] != nil {
+		var singleton bool
+		err = json.Unmarshal(*jsonMap["singleton"], &singleton)
+		if err != nil {
+			return err
+		}
+		watch.Singleton = singleton
+	}
+	if jsonMap["warning_actions_ids"] != nil {
+		var warningActionsIDs []int
+		err = json.Unmarshal(*jsonMap["warning_actions_ids"], &warningActionsIDs)
+		if err != nil {
+			return err
+		}
+		watch.WarningActionsIDs = warningActionsIDs
+	}
+	if jsonMap["actions_priorities"] != nil {
+		var actionsPriorities map[int]int
+		err = json.Unmarshal(*jsonMap["actions_priorities"], &actionsPriorities)
+		if err != nil {
+			return err
+		}
+		watch.ActionsPriorities = actionsPriorities
+	}
+	if jsonMap["stop_on_action_failure"] != nil {
+		var stopOnActionFailure bool
+		err = json.Unmarshal(*jsonMap["stop_on_action_failure"], &stopOnActionFailure)
+		if err != nil {
+			return err
+		}
+		watch.StopOnActionFailure = stopOnActionFailure
+	}
 	if jsonMap["url"] != nil {
 		var URL string
 		err = json.Unmarshal(*jsonMap["url"], &URL)
@@ -226,6 +733,30 @@ func (watch *Watch) UnmarshalJSON(bytes []byte) error {
 		}
 		watch.URL = URL
 	}
+	if jsonMap["method"] != nil {
+		var method string
+		err = json.Unmarshal(*jsonMap["method"], &method)
+		if err != nil {
+			return err
+		}
+		watch.Method = method
+	}
+	if jsonMap["headers"] != nil {
+		var headers map[string]string
+		err = json.Unmarshal(*jsonMap["headers"], &headers)
+		if err != nil {
+			return err
+		}
+		watch.Headers = headers
+	}
+	if jsonMap["body"] != nil {
+		var body string
+		err = json.Unmarshal(*jsonMap["body"], &body)
+		if err != nil {
+			return err
+		}
+		watch.Body = body
+	}
 	if jsonMap["statuses"] != nil {
 		var statuses []int
 		err = json.Unmarshal(*jsonMap["statuses"], &statuses)
@@ -234,56 +765,83 @@ func (watch *Watch) UnmarshalJSON(bytes []byte) error {
 		}
 		watch.Statuses = statuses
 	}
+	if jsonMap["status_ranges"] != nil {
+		var statusRanges []StatusRange
+		err = json.Unmarshal(*jsonMap["status_ranges"], &statusRanges)
+		if err != nil {
+			return err
+		}
+		watch.StatusRanges = statusRanges
+	}
 	if jsonMap["timeout"] != nil {
-		var timeout time.Duration
+		var timeout util.Duration
 		err = json.Unmarshal(*jsonMap["timeout"], &timeout)
 		if err != nil {
 			return err
 		}
 		watch.Timeout = timeout
 	}
-
-	// If no conditions are given, there's nothing to do; return or we'll get an
-	// error.
-	if jsonMap["conditions"] == nil {
-		return nil
+	// Redirects are followed unless explicitly disabled.
+	watch.FollowRedirects = true
+	if jsonMap["follow_redirects"] != nil {
+		var followRedirects bool
+		err = json.Unmarshal(*jsonMap["follow_redirects"], &followRedirects)
+		if err != nil {
+			return err
+		}
+		watch.FollowRedirects = followRedirects
 	}
-
-	var rawConditions []*json.RawMessage
-	err = json.Unmarshal(*jsonMap["conditions"], &rawConditions)
-	if err != nil {
-		return err
+	if jsonMap["capture_headers"] != nil {
+		var captureHeaders []string
+		err = json.Unmarshal(*jsonMap["capture_headers"], &captureHeaders)
+		if err != nil {
+			return err
+		}
+		watch.CaptureHeaders = captureHeaders
 	}
-
-	// Create a slice of the right size that will hold the Conditions.
-	watch.Conditions = make([]Condition, len(rawConditions))
-
-	// Decode the Conditions from their JSON structure and put them in the
-	// corresponding field slice.
-	for index, rawCondition := range rawConditions {
-		var conditionInnerJSON map[string]*json.RawMessage
-		err = json.Unmarshal(*rawCondition, &conditionInnerJSON)
+	if jsonMap["capture_body"] != nil {
+		var captureBody bool
+		err = json.Unmarshal(*jsonMap["capture_body"], &captureBody)
 		if err != nil {
 			return err
 		}
-
-		// Get the type of the Condition.
-		var conditionType string
-		err = json.Unmarshal(*conditionInnerJSON["type"], &conditionType)
+		watch.CaptureBody = captureBody
+	}
+	if jsonMap["default_condition"] != nil {
+		var defaultCondition string
+		err = json.Unmarshal(*jsonMap["default_condition"], &defaultCondition)
 		if err != nil {
 			return err
 		}
-
-		switch conditionType {
-		case "success":
-			watch.Conditions[index] = ConditionSuccess{}
-			break
-		case "failure":
-			watch.Conditions[index] = ConditionFailure{}
-			break
+		switch defaultCondition {
+		case "", DefaultConditionSuccess, DefaultConditionFailure, DefaultConditionAlways:
 		default:
-			return fmt.Errorf("unknown Condition type \"%s\"", conditionType)
+			return fmt.Errorf("unknown default Condition \"%s\"", defaultCondition)
 		}
+		watch.DefaultCondition = defaultCondition
+	}
+	if jsonMap["max_body_bytes"] != nil {
+		var maxBodyBytes int64
+		err = json.Unmarshal(*jsonMap["max_body_bytes"], &maxBodyBytes)
+		if err != nil {
+			return err
+		}
+		watch.MaxBodyBytes = maxBodyBytes
+	}
+
+	if jsonMap["conditions"] != nil {
+		conditions, err := decodeConditions(*jsonMap["conditions"])
+		if err != nil {
+			return err
+		}
+		watch.Conditions = conditions
+	}
+	if jsonMap["warning_conditions"] != nil {
+		conditions, err := decodeConditions(*jsonMap["warning_conditions"])
+		if err != nil {
+			return err
+		}
+		watch.WarningConditions = conditions
 	}
 
 	return nil
@@ -300,11 +858,110 @@ var NewHealthCheckWatch = func(jsonWatch *json.RawMessage) (common.Watch, error)
 		return nil, err
 	}
 
-	// Inject an HTTP client with the Watch's timeout.
+	// Inject an HTTP client with the Watch's timeout. The client uses the
+	// transport shared by all Watches so that connections are reused between
+	// evaluations. If redirects should not be followed, the client returns the
+	// redirect response itself.
 	client := &http.Client{
-		Timeout: watch.Timeout,
+		Transport: transport(),
+		Timeout:   watch.Timeout.Duration,
+	}
+	if !watch.FollowRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
 	}
 	watch.SetHTTPClient(client)
 
 	return watch, nil
 }
+
+/**
+ * For internal use.
+ */
+
+// maxDrainBytes holds the maximum number of bytes of a response body that are
+// read and discarded before closing it, so that the connection can be reused.
+// Connections with longer bodies are closed instead.
+const maxDrainBytes = 64 * 1024
+
+// closeBody reads the rest of the given response body, up to a limit, and it
+// closes it. The connection is only kept alive for reuse if the body was read
+// in full.
+func closeBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
+
+// decodeConditions decodes the given JSON array of Conditions, creating each
+// Condition based on the value of its "type" field.
+func decodeConditions(jsonConditions json.RawMessage) ([]Condition, error) {
+	var rawConditions []*json.RawMessage
+	err := json.Unmarshal(jsonConditions, &rawConditions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a slice of the right size that will hold the Conditions.
+	conditions := make([]Condition, len(rawConditions))
+
+	// Decode the Conditions from their JSON structure and put them in the
+	// corresponding slice.
+	for index, rawCondition := range rawConditions {
+		var conditionInnerJSON map[string]*json.RawMessage
+		err = json.Unmarshal(*rawCondition, &conditionInnerJSON)
+		if err != nil {
+			return nil, err
+		}
+
+		// Get the type of the Condition.
+		var conditionType string
+		err = json.Unmarshal(*conditionInnerJSON["type"], &conditionType)
+		if err != nil {
+			return nil, err
+		}
+
+		switch conditionType {
+		case "success":
+			conditions[index] = ConditionSuccess{}
+			break
+		case "failure":
+			conditions[index] = ConditionFailure{}
+			break
+		case "status_in":
+			var condition ConditionStatusIn
+			err = json.Unmarshal(*rawCondition, &condition)
+			if err != nil {
+				return nil, err
+			}
+			if len(condition.Codes) == 0 {
+				return nil, fmt.Errorf("a \"status_in\" Condition requires at least one HTTP Status code")
+			}
+			conditions[index] = condition
+		case "header_equals":
+			var condition ConditionHeaderEquals
+			err = json.Unmarshal(*rawCondition, &condition)
+			if err != nil {
+				return nil, err
+			}
+			if condition.Name == "" {
+				return nil, fmt.Errorf("a \"header_equals\" Condition requires the name of the header")
+			}
+			conditions[index] = condition
+		case "header_present":
+			var condition ConditionHeaderPresent
+			err = json.Unmarshal(*rawCondition, &condition)
+			if err != nil {
+				return nil, err
+			}
+			if condition.Name == "" {
+				return nil, fmt.Errorf("a \"header_present\" Condition requires the name of the header")
+			}
+			conditions[index] = condition
+		default:
+			return nil, fmt.Errorf("unknown Condition type \"%s\"", conditionType)
+		}
+	}
+
+	return conditions, nil
+}
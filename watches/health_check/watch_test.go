@@ -11,13 +11,18 @@ import (
 
 	// Utilities.
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"time"
 
 	// Internal dependencies.
 	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
 	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
 )
 
@@ -28,17 +33,15 @@ import (
 // testWatch generates a Watch object with some defaults.
 func testWatch() Watch {
 	watch := Watch{
-		common.WatchBase{
-			"Test Watch",
-			[]int{},
-			[]actions.Action{},
+		WatchBase: common.WatchBase{
+			Name:       "Test Watch",
+			ActionsIDs: []int{},
+			Actions:    []actions.Action{},
 		},
-		"https://golang.org/pkg/testing/",
-		[]int{200},
-		30 * time.Second,
-		[]Condition{},
-		nil,
-		Result{},
+		URL:        "https://golang.org/pkg/testing/",
+		Statuses:   []int{200},
+		Timeout:    util.Duration{Duration: 30 * time.Second},
+		Conditions: []Condition{},
 	}
 	return watch
 }
@@ -46,7 +49,7 @@ func testWatch() Watch {
 // An HTTP client that returns a response with status 200.
 type MockHTTPClient200 struct{}
 
-func (client MockHTTPClient200) Get(url string) (*http.Response, error) {
+func (client MockHTTPClient200) Do(req *http.Request) (*http.Response, error) {
 	response := &http.Response{
 		StatusCode: 200,
 		Body:       ioutil.NopCloser(bytes.NewBuffer([]byte{})),
@@ -58,7 +61,7 @@ func (client MockHTTPClient200) Get(url string) (*http.Response, error) {
 // An HTTP client that returns a response with status 400.
 type MockHTTPClient400 struct{}
 
-func (client MockHTTPClient400) Get(url string) (*http.Response, error) {
+func (client MockHTTPClient400) Do(req *http.Request) (*http.Response, error) {
 	response := &http.Response{
 		StatusCode: 400,
 		Body:       ioutil.NopCloser(bytes.NewBuffer([]byte{})),
@@ -67,14 +70,148 @@ func (client MockHTTPClient400) Get(url string) (*http.Response, error) {
 	return response, nil
 }
 
+// An HTTP client that returns a response with the given status.
+type MockHTTPClientStatus struct {
+	status int
+}
+
+func (client MockHTTPClientStatus) Do(req *http.Request) (*http.Response, error) {
+	response := &http.Response{
+		StatusCode: client.status,
+		Body:       ioutil.NopCloser(bytes.NewBuffer([]byte{})),
+	}
+
+	return response, nil
+}
+
+// An HTTP client that returns a response with status 200 and a few headers.
+type MockHTTPClientHeaders struct{}
+
+func (client MockHTTPClientHeaders) Do(req *http.Request) (*http.Response, error) {
+	header := make(http.Header)
+	header.Set("Server", "nginx")
+	header.Set("X-Cache", "HIT")
+	header.Set("Set-Cookie", "session=secret")
+	response := &http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewBuffer([]byte{})),
+	}
+
+	return response, nil
+}
+
+// An HTTP client that returns a response with status 200 and the given body.
+type MockHTTPClientBody struct {
+	body string
+}
+
+func (client MockHTTPClientBody) Do(req *http.Request) (*http.Response, error) {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	response := &http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(client.body)),
+	}
+
+	return response, nil
+}
+
+// An HTTP client that returns a response with status 200 and a body that fails
+// to be read.
+type MockHTTPClientBodyError struct{}
+
+func (client MockHTTPClientBodyError) Do(req *http.Request) (*http.Response, error) {
+	response := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(&errorReader{}),
+	}
+
+	return response, nil
+}
+
+// errorReader is a reader that always fails.
+type errorReader struct{}
+
+func (reader *errorReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("the connection was reset")
+}
+
+// An HTTP client that records the request made to it and returns a response
+// with status 200.
+type MockHTTPClientRecorder struct {
+	method string
+	URL    string
+	header http.Header
+	host   string
+	body   []byte
+}
+
+func (client *MockHTTPClientRecorder) Do(req *http.Request) (*http.Response, error) {
+	client.method = req.Method
+	client.URL = req.URL.String()
+	client.header = req.Header
+	client.host = req.Host
+	client.body, _ = ioutil.ReadAll(req.Body)
+
+	response := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBuffer([]byte{})),
+	}
+
+	return response, nil
+}
+
 // An HTTP client that returns an error, simulating an unresponsive URL or a
 // network error.
 type MockHTTPClientError struct{}
 
-func (client MockHTTPClientError) Get(url string) (*http.Response, error) {
+func (client MockHTTPClientError) Do(req *http.Request) (*http.Response, error) {
 	return nil, fmt.Errorf("cannot reach the given URL within the given timeout")
 }
 
+// A Condition that is met depending on the given value, after the given delay.
+type testCondition struct {
+	ok    bool
+	delay time.Duration
+}
+
+func (condition testCondition) Do(result Result) bool {
+	time.Sleep(condition.delay)
+	return condition.ok
+}
+
+// testBenchmarkWatch generates a Watch with many Conditions that take a bit of
+// time to be evaluated, all of which are met.
+func testBenchmarkWatch() Watch {
+	watch := testWatch()
+	watch.result = Result{Status: "success"}
+	for i := 0; i < 20; i++ {
+		watch.Conditions = append(watch.Conditions, testCondition{ok: true, delay: time.Millisecond})
+	}
+	return watch
+}
+
+// A transport that responds with a permanent redirect to "/new" for every
+// path other than "/new", and with status 200 for "/new".
+type MockRedirectTransport struct{}
+
+func (transport MockRedirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	response := &http.Response{
+		StatusCode: 200,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(bytes.NewBuffer([]byte{})),
+		Request:    req,
+	}
+	if req.URL.Path != "/new" {
+		response.StatusCode = 301
+		response.Header.Set("Location", "/new")
+	}
+
+	return response, nil
+}
+
 /**
  * Test Result preparation depending on the HTTP Response.
  */
@@ -83,29 +220,430 @@ func TestResultPreparation_Success(t *testing.T) {
 	watch := testWatch()
 	client := MockHTTPClient200{}
 	watch.SetHTTPClient(client)
-	watch.data()
+	watch.data(context.Background())
 
 	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(t, 200, watch.result.StatusCode)
 }
 
 func TestResultPreparation_StatusMismatch(t *testing.T) {
 	watch := testWatch()
 	client := MockHTTPClient400{}
 	watch.SetHTTPClient(client)
-	watch.data()
+	watch.data(context.Background())
 
 	assert.Equal(t, "status_mismatch", watch.result.Status)
+	assert.Equal(t, 400, watch.result.StatusCode)
+}
+
+func TestResultPreparation_StatusRanges(t *testing.T) {
+	cases := []struct {
+		statuses     []int
+		statusRanges []StatusRange
+		code         int
+		status       string
+	}{
+		// Exact codes only.
+		{[]int{200, 204}, nil, 204, "success"},
+		{[]int{200, 204}, nil, 201, "status_mismatch"},
+		// Ranges only, including their limits.
+		{nil, []StatusRange{{200, 299}}, 200, "success"},
+		{nil, []StatusRange{{200, 299}}, 299, "success"},
+		{nil, []StatusRange{{200, 299}}, 301, "status_mismatch"},
+		// Exact codes and ranges combined.
+		{[]int{401}, []StatusRange{{200, 299}, {300, 302}}, 401, "success"},
+		{[]int{401}, []StatusRange{{200, 299}, {300, 302}}, 302, "success"},
+		{[]int{401}, []StatusRange{{200, 299}, {300, 302}}, 404, "status_mismatch"},
+	}
+
+	for index, c := range cases {
+		watch := testWatch()
+		watch.Statuses = c.statuses
+		watch.StatusRanges = c.statusRanges
+		watch.SetHTTPClient(MockHTTPClientStatus{c.code})
+		watch.data(context.Background())
+
+		assert.Equal(t, c.status, watch.result.Status, "case %d", index)
+	}
 }
 
 func TestResultPreparation_Inaccessible(t *testing.T) {
 	watch := testWatch()
 	client := MockHTTPClientError{}
 	watch.SetHTTPClient(client)
-	watch.data()
+	watch.data(context.Background())
 
 	assert.Equal(t, "inaccessible", watch.result.Status)
 }
 
+func TestResultPreparation_DefaultRequest(t *testing.T) {
+	watch := testWatch()
+	client := &MockHTTPClientRecorder{}
+	watch.SetHTTPClient(client)
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(t, "GET", client.method)
+	assert.Equal(t, "https://golang.org/pkg/testing/", client.URL)
+	assert.Equal(t, http.Header{"User-Agent": {util.UserAgent("watch")}}, client.header)
+	assert.Empty(t, client.body)
+}
+
+func TestResultPreparation_CustomRequest(t *testing.T) {
+	watch := testWatch()
+	watch.Method = "POST"
+	watch.Headers = map[string]string{
+		"Authorization": "Bearer secret",
+		"content-type":  "application/json",
+		"Host":          "api.example.com",
+	}
+	watch.Body = `{"ping":true}`
+	client := &MockHTTPClientRecorder{}
+	watch.SetHTTPClient(client)
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(t, "POST", client.method)
+	assert.Equal(t, "Bearer secret", client.header.Get("Authorization"))
+	assert.Equal(t, "application/json", client.header.Get("Content-Type"))
+	assert.Equal(t, "api.example.com", client.host)
+	assert.Equal(t, `{"ping":true}`, string(client.body))
+}
+
+func TestResultPreparation_UserAgent(t *testing.T) {
+	watch := testWatch()
+	watch.Headers = map[string]string{"user-agent": "example-monitoring/1.0"}
+	client := &MockHTTPClientRecorder{}
+	watch.SetHTTPClient(client)
+	watch.data(context.Background())
+
+	// The User-Agent given in the headers should override the default.
+	assert.Equal(t, []string{"example-monitoring/1.0"}, client.header["User-Agent"])
+}
+
+func TestResultPreparation_InvalidMethod(t *testing.T) {
+	watch := testWatch()
+	watch.Method = "BAD METHOD"
+	client := &MockHTTPClientRecorder{}
+	watch.SetHTTPClient(client)
+	watch.data(context.Background())
+
+	// The request cannot be built, so it should never be made.
+	assert.Equal(t, "inaccessible", watch.result.Status)
+	assert.Empty(t, client.method)
+}
+
+func TestResultPreparation_CaptureHeaders(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureHeaders = []string{"server", "X-Cache", "X-Request-ID"}
+	client := MockHTTPClientHeaders{}
+	watch.SetHTTPClient(client)
+	watch.data(context.Background())
+
+	// Only the requested headers that are present in the response should be
+	// recorded.
+	expectedHeaders := http.Header{
+		"Server":  []string{"nginx"},
+		"X-Cache": []string{"HIT"},
+	}
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(t, expectedHeaders, watch.result.Headers)
+}
+
+func TestResultPreparation_ConditionHeaders(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureHeaders = []string{"X-Cache"}
+	watch.Conditions = []Condition{ConditionHeaderPresent{Name: "server"}}
+	watch.SetHTTPClient(MockHTTPClientHeaders{})
+	watch.data(context.Background())
+
+	// The headers evaluated by the Conditions are recorded together with the
+	// requested ones.
+	expectedHeaders := http.Header{
+		"Server":  []string{"nginx"},
+		"X-Cache": []string{"HIT"},
+	}
+	assert.Equal(t, expectedHeaders, watch.result.Headers)
+	assert.Equal(t, []string{"X-Cache"}, watch.CaptureHeaders)
+}
+
+func TestResultPreparation_NoCaptureHeaders(t *testing.T) {
+	watch := testWatch()
+	client := MockHTTPClientHeaders{}
+	watch.SetHTTPClient(client)
+	watch.data(context.Background())
+
+	assert.Nil(t, watch.result.Headers)
+}
+
+func TestResultPreparation_CaptureBody(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureBody = true
+	watch.CaptureHeaders = []string{"Content-Type"}
+	watch.SetHTTPClient(MockHTTPClientBody{body: `{"status":"ok"}`})
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(t, `{"status":"ok"}`, watch.result.Body)
+	assert.False(t, watch.result.BodyTruncated)
+	assert.Equal(t, http.Header{"Content-Type": []string{"application/json"}}, watch.result.Headers)
+}
+
+func TestResultPreparation_CaptureBodyTruncated(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureBody = true
+	watch.MaxBodyBytes = 10
+	watch.SetHTTPClient(MockHTTPClientBody{body: "0123456789abcdef"})
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(t, "0123456789", watch.result.Body)
+	assert.True(t, watch.result.BodyTruncated)
+
+	// A body exactly at the limit is not truncated.
+	watch.SetHTTPClient(MockHTTPClientBody{body: "0123456789"})
+	watch.data(context.Background())
+	assert.Equal(t, "0123456789", watch.result.Body)
+	assert.False(t, watch.result.BodyTruncated)
+}
+
+func TestResultPreparation_CaptureBodyDefaultLimit(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureBody = true
+	watch.SetHTTPClient(MockHTTPClientBody{body: strings.Repeat("a", MaxBodyBytesDefault+1)})
+	watch.data(context.Background())
+
+	assert.Len(t, watch.result.Body, MaxBodyBytesDefault)
+	assert.True(t, watch.result.BodyTruncated)
+}
+
+func TestResultPreparation_NoCaptureBody(t *testing.T) {
+	watch := testWatch()
+	watch.SetHTTPClient(MockHTTPClientBody{body: `{"status":"ok"}`})
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Empty(t, watch.result.Body)
+}
+
+func TestResultPreparation_CaptureBodyError(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureBody = true
+	watch.SetHTTPClient(MockHTTPClientBodyError{})
+	watch.data(context.Background())
+
+	assert.Equal(t, "inaccessible", watch.result.Status)
+}
+
+func TestUnmarshalJSON_CaptureBody(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","capture_body":true,"max_body_bytes":1024}`), &watch)
+
+	assert.Nil(t, err)
+	assert.True(t, watch.CaptureBody)
+	assert.Equal(t, int64(1024), watch.MaxBodyBytes)
+}
+
+func TestUnmarshalJSON_CaptureHeaders(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","capture_headers":["Server"]}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Server"}, watch.CaptureHeaders)
+}
+
+func TestUnmarshalJSON_Timeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		`"5m"`:        5 * time.Minute,
+		`"1h30m"`:     90 * time.Minute,
+		`30000000000`: 30 * time.Second,
+	}
+	for timeout, expected := range cases {
+		var watch Watch
+		err := json.Unmarshal([]byte(`{"url":"https://example.com","timeout":`+timeout+`}`), &watch)
+		assert.Nil(t, err, timeout)
+		assert.Equal(t, expected, watch.Timeout.Duration, timeout)
+	}
+
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","timeout":"soon"}`), &watch)
+	assert.NotNil(t, err)
+}
+
+func TestUnmarshalJSON_Request(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","method":"HEAD","headers":{"Authorization":"Bearer secret"},"body":"ping"}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "HEAD", watch.Method)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer secret"}, watch.Headers)
+	assert.Equal(t, "ping", watch.Body)
+}
+
+func TestUnmarshalJSON_StatusRanges(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","statuses":[401],"status_ranges":["2xx",{"min":300,"max":302},"5XX"]}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{401}, watch.Statuses)
+	assert.Equal(t, []StatusRange{{200, 299}, {300, 302}, {500, 599}}, watch.StatusRanges)
+
+	for _, statusRanges := range []string{`["6xx"]`, `["20x"]`, `["2xxx"]`, `[{"min":299,"max":200}]`, `[200]`} {
+		watch = Watch{}
+		err = json.Unmarshal([]byte(`{"url":"https://example.com","status_ranges":`+statusRanges+`}`), &watch)
+		assert.NotNil(t, err, statusRanges)
+	}
+}
+
+func TestUnmarshalJSON_StatusIn(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","conditions":[{"type":"status_in","codes":[502,503]},{"type":"failure"}]}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Condition{ConditionStatusIn{Codes: []int{502, 503}}, ConditionFailure{}}, watch.Conditions)
+
+	// The Condition should be encoded so that it can be decoded again.
+	jsonWatch, err := json.Marshal(watch)
+	assert.Nil(t, err)
+	var decoded Watch
+	err = json.Unmarshal(jsonWatch, &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, watch.Conditions, decoded.Conditions)
+
+	for _, condition := range []string{`{"type":"status_in"}`, `{"type":"status_in","codes":[]}`, `{"type":"status_in","codes":"503"}`} {
+		watch = Watch{}
+		err = json.Unmarshal([]byte(`{"url":"https://example.com","conditions":[`+condition+`]}`), &watch)
+		assert.NotNil(t, err, condition)
+	}
+}
+
+func TestUnmarshalJSON_HeaderConditions(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","conditions":[{"type":"header_equals","name":"Content-Type","value":"application/json"},{"type":"header_present","name":"X-Health"}]}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]Condition{
+			ConditionHeaderEquals{Name: "Content-Type", Value: "application/json"},
+			ConditionHeaderPresent{Name: "X-Health"},
+		},
+		watch.Conditions,
+	)
+
+	// The Conditions should be encoded so that they can be decoded again.
+	jsonWatch, err := json.Marshal(watch)
+	assert.Nil(t, err)
+	var decoded Watch
+	err = json.Unmarshal(jsonWatch, &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, watch.Conditions, decoded.Conditions)
+
+	for _, condition := range []string{`{"type":"header_equals","value":"application/json"}`, `{"type":"header_present"}`, `{"type":"header_present","name":1}`} {
+		watch = Watch{}
+		err = json.Unmarshal([]byte(`{"url":"https://example.com","conditions":[`+condition+`]}`), &watch)
+		assert.NotNil(t, err, condition)
+	}
+}
+
+func TestUnmarshalJSON_DefaultCondition(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","default_condition":"failure"}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultConditionFailure, watch.DefaultCondition)
+
+	for _, defaultCondition := range []string{`"sometimes"`, `1`} {
+		watch = Watch{}
+		err = json.Unmarshal([]byte(`{"url":"https://example.com","default_condition":`+defaultCondition+`}`), &watch)
+		assert.NotNil(t, err, defaultCondition)
+	}
+}
+
+func TestUnmarshalJSON_WarningConditions(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","actions_ids":[1],"warning_actions_ids":[2],"conditions":[{"type":"failure"}],"warning_conditions":[{"type":"status_in","codes":[429]}]}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, watch.ActionsIDs)
+	assert.Equal(t, []int{2}, watch.WarningActionsIDs)
+	assert.Equal(t, []Condition{ConditionFailure{}}, watch.Conditions)
+	assert.Equal(t, []Condition{ConditionStatusIn{Codes: []int{429}}}, watch.WarningConditions)
+
+	watch = Watch{}
+	err = json.Unmarshal([]byte(`{"url":"https://example.com","warning_conditions":[{"type":"unknown"}]}`), &watch)
+	assert.NotNil(t, err)
+}
+
+func TestUnmarshalJSON_ActionsPriorities(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","actions_ids":[1,2,3],"actions_priorities":{"2":10,"3":-1}}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]int{2: 10, 3: -1}, watch.ActionsPriorities)
+	assert.Equal(t, [][]int{{2}, {1}, {3}}, watch.PrioritizedActionsIDs(watch.ActionsIDs))
+
+	watch = Watch{}
+	err = json.Unmarshal([]byte(`{"url":"https://example.com","actions_priorities":{"first":10}}`), &watch)
+	assert.NotNil(t, err)
+}
+
+func TestUnmarshalJSON_StopOnActionFailure(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","stop_on_action_failure":true}`), &watch)
+	assert.Nil(t, err)
+	assert.True(t, watch.StopOnActionFailure)
+
+	watch = Watch{}
+	err = json.Unmarshal([]byte(`{"url":"https://example.com"}`), &watch)
+	assert.Nil(t, err)
+	assert.False(t, watch.StopOnActionFailure)
+}
+
+func TestUnmarshalJSON_Timestamps(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com","created_at":"2017-01-01T00:00:00Z","updated_at":"2017-01-02T00:00:00Z"}`), &watch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), *watch.CreatedAt)
+	assert.Equal(t, time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC), *watch.UpdatedAt)
+}
+
+func TestUnmarshalJSON_FollowRedirects(t *testing.T) {
+	var watch Watch
+	err := json.Unmarshal([]byte(`{"url":"https://example.com"}`), &watch)
+	assert.Nil(t, err)
+	assert.True(t, watch.FollowRedirects)
+
+	watch = Watch{}
+	err = json.Unmarshal([]byte(`{"url":"https://example.com","follow_redirects":false}`), &watch)
+	assert.Nil(t, err)
+	assert.False(t, watch.FollowRedirects)
+}
+
+func TestNewHealthCheckWatch_Redirects(t *testing.T) {
+	cases := map[string]string{
+		// The status of the page that the URL redirects to is evaluated.
+		`{"url":"https://example.com/old","statuses":[200]}`:                         "success",
+		`{"url":"https://example.com/old","statuses":[200],"follow_redirects":true}`: "success",
+		// The status of the redirect response is evaluated.
+		`{"url":"https://example.com/old","statuses":[200],"follow_redirects":false}`: "status_mismatch",
+		`{"url":"https://example.com/old","statuses":[301],"follow_redirects":false}`: "success",
+	}
+
+	for jsonString, status := range cases {
+		jsonWatch := json.RawMessage(jsonString)
+		watch, err := NewHealthCheckWatch(&jsonWatch)
+		assert.Nil(t, err, jsonString)
+
+		healthCheckWatch := watch.(Watch)
+		healthCheckWatch.httpClient.(*http.Client).Transport = MockRedirectTransport{}
+		healthCheckWatch.data(context.Background())
+
+		assert.Equal(t, status, healthCheckWatch.result.Status, jsonString)
+	}
+}
+
 /**
  * Test combinations of Results (success, failure, inaccessible) and Conditions
  * (ConditionSuccess, ConditionFailure).
@@ -114,7 +652,7 @@ func TestResultPreparation_Inaccessible(t *testing.T) {
 func TestEvaluateConditionsOnSuccess_Success(t *testing.T) {
 	watch := testWatch()
 	condition := ConditionSuccess{}
-	watch.result = Result{"success"}
+	watch.result = Result{Status: "success"}
 	watch.Conditions = []Condition{condition}
 
 	ok := watch.evaluate()
@@ -124,7 +662,7 @@ func TestEvaluateConditionsOnSuccess_Success(t *testing.T) {
 func TestEvaluateConditionsOnSuccess_Failure(t *testing.T) {
 	watch := testWatch()
 	condition := ConditionFailure{}
-	watch.result = Result{"success"}
+	watch.result = Result{Status: "success"}
 	watch.Conditions = []Condition{condition}
 
 	ok := watch.evaluate()
@@ -134,7 +672,7 @@ func TestEvaluateConditionsOnSuccess_Failure(t *testing.T) {
 func TestEvaluateConditionsOnFailure_Success(t *testing.T) {
 	watch := testWatch()
 	condition := ConditionSuccess{}
-	watch.result = Result{"failure"}
+	watch.result = Result{Status: "failure"}
 	watch.Conditions = []Condition{condition}
 
 	ok := watch.evaluate()
@@ -144,7 +682,7 @@ func TestEvaluateConditionsOnFailure_Success(t *testing.T) {
 func TestEvaluateConditionsOnFailure_Failure(t *testing.T) {
 	watch := testWatch()
 	condition := ConditionFailure{}
-	watch.result = Result{"failure"}
+	watch.result = Result{Status: "failure"}
 	watch.Conditions = []Condition{condition}
 
 	ok := watch.evaluate()
@@ -154,7 +692,7 @@ func TestEvaluateConditionsOnFailure_Failure(t *testing.T) {
 func TestEvaluateConditionsOnInaccessible_Success(t *testing.T) {
 	watch := testWatch()
 	condition := ConditionSuccess{}
-	watch.result = Result{"Inaccessible"}
+	watch.result = Result{Status: "Inaccessible"}
 	watch.Conditions = []Condition{condition}
 
 	ok := watch.evaluate()
@@ -164,9 +702,330 @@ func TestEvaluateConditionsOnInaccessible_Success(t *testing.T) {
 func TestEvaluateConditionsOnInaccessible_Failure(t *testing.T) {
 	watch := testWatch()
 	condition := ConditionFailure{}
-	watch.result = Result{"Inaccessible"}
+	watch.result = Result{Status: "Inaccessible"}
 	watch.Conditions = []Condition{condition}
 
 	ok := watch.evaluate()
 	assert.True(t, ok)
 }
+
+func TestEvaluateConditions_MatchesSerial(t *testing.T) {
+	cases := [][]Condition{
+		{},
+		{testCondition{ok: true}},
+		{testCondition{ok: false}},
+		{testCondition{ok: true}, testCondition{ok: true}, testCondition{ok: true}},
+		{testCondition{ok: false}, testCondition{ok: true}, testCondition{ok: true}},
+		{testCondition{ok: true}, testCondition{ok: true}, testCondition{ok: false}},
+		{testCondition{ok: false}, testCondition{ok: false}},
+		{ConditionSuccess{}, ConditionFailure{}},
+		{ConditionSuccess{}, ConditionSuccess{}, testCondition{ok: true, delay: 10 * time.Millisecond}},
+		{ConditionSuccess{}, testCondition{ok: false, delay: 10 * time.Millisecond}},
+	}
+
+	for _, status := range []string{"success", "inaccessible"} {
+		for index, conditions := range cases {
+			watch := testWatch()
+			watch.result = Result{Status: status}
+			watch.Conditions = conditions
+
+			assert.Equal(t, watch.evaluateSerially(), watch.evaluate(), "case %d, status %s", index, status)
+		}
+	}
+}
+
+func TestEvaluateConditions_ShortCircuit(t *testing.T) {
+	watch := testWatch()
+	watch.Conditions = []Condition{
+		testCondition{ok: true, delay: time.Second},
+		testCondition{ok: false},
+	}
+
+	// The evaluation should not wait for the slow Condition once the other one
+	// fails.
+	start := time.Now()
+	ok := watch.evaluate()
+	assert.False(t, ok)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+/**
+ * Benchmarks.
+ */
+
+func BenchmarkEvaluate(b *testing.B) {
+	watch := testBenchmarkWatch()
+	for i := 0; i < b.N; i++ {
+		watch.evaluate()
+	}
+}
+
+func BenchmarkEvaluateSerially(b *testing.B) {
+	watch := testBenchmarkWatch()
+	for i := 0; i < b.N; i++ {
+		watch.evaluateSerially()
+	}
+}
+
+func TestEvaluateConditions_StatusIn(t *testing.T) {
+	statusIn := ConditionStatusIn{Codes: []int{503}}
+	cases := []struct {
+		conditions []Condition
+		result     Result
+		ok         bool
+	}{
+		{[]Condition{statusIn}, Result{Status: "status_mismatch", StatusCode: 503}, true},
+		{[]Condition{statusIn}, Result{Status: "status_mismatch", StatusCode: 404}, false},
+		// No response was received.
+		{[]Condition{statusIn}, Result{Status: "inaccessible"}, false},
+		// Combined with the success and failure Conditions.
+		{[]Condition{statusIn, ConditionFailure{}}, Result{Status: "status_mismatch", StatusCode: 503}, true},
+		{[]Condition{statusIn, ConditionFailure{}}, Result{Status: "status_mismatch", StatusCode: 404}, false},
+		{[]Condition{statusIn, ConditionSuccess{}}, Result{Status: "status_mismatch", StatusCode: 503}, false},
+		// A 503 response may be considered successful by the Watch's statuses.
+		{[]Condition{statusIn, ConditionSuccess{}}, Result{Status: "success", StatusCode: 503}, true},
+	}
+
+	for index, c := range cases {
+		watch := testWatch()
+		watch.result = c.result
+		watch.Conditions = c.conditions
+		assert.Equal(t, c.ok, watch.evaluate(), "case %d", index)
+	}
+}
+
+func TestDo_StatusIn(t *testing.T) {
+	watch := testWatch()
+	watch.ActionsIDs = []int{1}
+	watch.Conditions = []Condition{ConditionStatusIn{Codes: []int{503}}}
+
+	watch.SetHTTPClient(MockHTTPClientStatus{503})
+	assert.Equal(t, []int{1}, watch.Do(context.Background()))
+
+	watch.SetHTTPClient(MockHTTPClientStatus{404})
+	assert.Empty(t, watch.Do(context.Background()))
+}
+
+func TestDo_HeaderConditions(t *testing.T) {
+	// Header names are matched case-insensitively.
+	cases := []struct {
+		condition Condition
+		ok        bool
+	}{
+		{ConditionHeaderEquals{Name: "x-cache", Value: "HIT"}, true},
+		{ConditionHeaderEquals{Name: "X-Cache", Value: "MISS"}, false},
+		{ConditionHeaderEquals{Name: "X-Request-ID", Value: "HIT"}, false},
+		{ConditionHeaderPresent{Name: "SERVER"}, true},
+		{ConditionHeaderPresent{Name: "X-Request-ID"}, false},
+	}
+
+	for index, c := range cases {
+		watch := testWatch()
+		watch.ActionsIDs = []int{1}
+		watch.Conditions = []Condition{c.condition}
+		watch.SetHTTPClient(MockHTTPClientHeaders{})
+
+		actionsIDs := watch.Do(context.Background())
+		assert.Equal(t, c.ok, len(actionsIDs) == 1, "case %d", index)
+	}
+}
+
+func TestDo_HeaderConditionsInaccessible(t *testing.T) {
+	watch := testWatch()
+	watch.ActionsIDs = []int{1}
+	watch.Conditions = []Condition{ConditionHeaderPresent{Name: "Server"}}
+	watch.SetHTTPClient(MockHTTPClientError{})
+
+	assert.Empty(t, watch.Do(context.Background()))
+}
+
+func TestDo_DefaultCondition(t *testing.T) {
+	cases := []struct {
+		defaultCondition string
+		client           HTTPClient
+		ok               bool
+	}{
+		{"", MockHTTPClient200{}, true},
+		{"", MockHTTPClient400{}, false},
+		{"", MockHTTPClientError{}, false},
+		{DefaultConditionSuccess, MockHTTPClient200{}, true},
+		{DefaultConditionFailure, MockHTTPClient200{}, false},
+		{DefaultConditionFailure, MockHTTPClient400{}, true},
+		{DefaultConditionFailure, MockHTTPClientError{}, true},
+		{DefaultConditionAlways, MockHTTPClient400{}, true},
+		{DefaultConditionAlways, MockHTTPClientError{}, true},
+	}
+
+	for index, c := range cases {
+		watch := testWatch()
+		watch.ActionsIDs = []int{1}
+		watch.DefaultCondition = c.defaultCondition
+		watch.SetHTTPClient(c.client)
+
+		actionsIDs := watch.Do(context.Background())
+		assert.Equal(t, c.ok, len(actionsIDs) == 1, "case %d", index)
+	}
+}
+
+func TestDo_DefaultConditionIgnored(t *testing.T) {
+	watch := testWatch()
+	watch.ActionsIDs = []int{1}
+	watch.DefaultCondition = DefaultConditionAlways
+	watch.Conditions = []Condition{ConditionSuccess{}}
+	watch.SetHTTPClient(MockHTTPClient400{})
+
+	assert.Empty(t, watch.Do(context.Background()))
+}
+
+func TestDo_Cancel(t *testing.T) {
+	// The server holds the request until it is cancelled, or until the test
+	// finishes.
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	watch := testWatch()
+	watch.URL = server.URL
+	watch.SetHTTPClient(&http.Client{})
+
+	// Cancelling the context aborts the request that is in progress.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	watch.data(ctx)
+	assert.Equal(t, "inaccessible", watch.result.Status)
+}
+
+func TestDoWithContext_Severity(t *testing.T) {
+	cases := []struct {
+		status     int
+		severity   string
+		actionsIDs []int
+	}{
+		{503, common.SeverityCritical, []int{1}},
+		{404, common.SeverityWarning, []int{2, 3}},
+		{200, common.SeverityOK, []int{}},
+	}
+
+	for _, c := range cases {
+		watch := testWatch()
+		watch.ActionsIDs = []int{1}
+		watch.WarningActionsIDs = []int{2, 3}
+		watch.Conditions = []Condition{ConditionStatusIn{Codes: []int{503}}}
+		watch.WarningConditions = []Condition{ConditionFailure{}}
+		watch.SetHTTPClient(MockHTTPClientStatus{c.status})
+
+		actionsIDs, actionContext := watch.DoWithContext(context.Background())
+		assert.Equal(t, c.actionsIDs, actionsIDs, "status %d", c.status)
+		assert.Equal(t, c.severity, actionContext.Values["severity"], "status %d", c.status)
+	}
+}
+
+func TestDoWithContext_Headers(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureHeaders = []string{"X-Cache"}
+	watch.SetHTTPClient(MockHTTPClientHeaders{})
+
+	// The captured headers should be given together with the context, so that
+	// they can be kept in the history of the Watch's Results.
+	_, actionContext := watch.DoWithContext(context.Background())
+	assert.Equal(t, http.Header{"X-Cache": []string{"HIT"}}, actionContext.Headers)
+}
+
+func TestDoWithContext_Body(t *testing.T) {
+	watch := testWatch()
+	watch.CaptureBody = true
+	watch.MaxBodyBytes = 10
+	watch.SetHTTPClient(MockHTTPClientBody{body: "0123456789abcdef"})
+
+	// The captured body should be given together with the context, marked as
+	// truncated, so that it can be kept in the history of the Watch's Results.
+	_, actionContext := watch.DoWithContext(context.Background())
+	assert.Equal(t, "0123456789", actionContext.Body)
+	assert.True(t, actionContext.BodyTruncated)
+}
+
+func TestDoWithContext_NoWarningConditions(t *testing.T) {
+	watch := testWatch()
+	watch.ActionsIDs = []int{1}
+	watch.WarningActionsIDs = []int{2}
+	watch.Conditions = []Condition{ConditionFailure{}}
+	watch.SetHTTPClient(MockHTTPClient200{})
+
+	// No warnings are raised without warning Conditions.
+	actionsIDs, actionContext := watch.DoWithContext(context.Background())
+	assert.Empty(t, actionsIDs)
+	assert.Equal(t, common.SeverityOK, actionContext.Values["severity"])
+}
+
+func TestResultPreparation_WarningConditionHeaders(t *testing.T) {
+	watch := testWatch()
+	watch.WarningConditions = []Condition{ConditionHeaderPresent{Name: "x-cache"}}
+	watch.SetHTTPClient(MockHTTPClientHeaders{})
+	watch.data(context.Background())
+
+	// The headers evaluated by the warning Conditions are recorded as well.
+	assert.Equal(t, "HIT", watch.result.Headers.Get("X-Cache"))
+}
+
+/**
+ * Test replaying Results against the Conditions.
+ */
+
+func TestReplay_Success(t *testing.T) {
+	watch := testWatch()
+	watch.Conditions = []Condition{ConditionSuccess{}, ConditionFailure{}}
+
+	// The Watch has no HTTP client injected; replaying must not make a request.
+	outcomes, err := watch.Replay([]byte(`{"status":"status_mismatch"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, true}, outcomes)
+}
+
+func TestReplay_StatusCode(t *testing.T) {
+	watch := testWatch()
+	watch.Conditions = []Condition{ConditionStatusIn{Codes: []int{503}}, ConditionFailure{}}
+
+	outcomes, err := watch.Replay([]byte(`{"status":"status_mismatch","status_code":503}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, true}, outcomes)
+}
+
+func TestWithResult(t *testing.T) {
+	watch := testWatch()
+	watch.ActionsIDs = []int{1}
+	watch.Conditions = []Condition{ConditionStatusIn{Codes: []int{503}}}
+	recorder := &MockHTTPClientRecorder{}
+	watch.SetHTTPClient(recorder)
+
+	withResult, err := watch.WithResult([]byte(`{"status":"status_mismatch","status_code":503}`))
+	assert.Nil(t, err)
+	actionsIDs, actionContext := withResult.(common.ContextWatch).DoWithContext(context.Background())
+	assert.Equal(t, []int{1}, actionsIDs)
+	assert.Equal(t, "status_mismatch", actionContext.Status)
+
+	// The request to the URL is not made.
+	assert.Equal(t, "", recorder.method)
+
+	_, err = watch.WithResult([]byte(`{"status":`))
+	assert.NotNil(t, err)
+}
+
+func TestReplay_InvalidResult(t *testing.T) {
+	watch := testWatch()
+	watch.Conditions = []Condition{ConditionSuccess{}}
+
+	outcomes, err := watch.Replay([]byte(`{"status":`))
+	assert.NotNil(t, err)
+	assert.Nil(t, outcomes)
+}
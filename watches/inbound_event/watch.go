@@ -0,0 +1,322 @@
+/**
+ * Provides a Watch that is evaluated against events pushed to it by external
+ * systems.
+ */
+
+package msWatchInboundEvent
+
+import (
+	// Utilities.
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	jsonCheck "github.com/krystalcode/go-mantis-shrimp/watches/json_check"
+)
+
+/**
+ * Types and their functions.
+ */
+
+// The statuses of the Result of an Inbound Event Watch.
+const (
+	StatusReceived = "received"
+	StatusNoEvent  = "no_event"
+)
+
+// Watch implements the common.Watch interface. It provides a Watch that does
+// not prepare any data itself; it is instead given an event, as a JSON document
+// posted by an external system, and it evaluates its Conditions against it.
+// Its evaluation of whether the included Actions will be executed depend on the
+// evaluation of its Conditions. Without Conditions, the Actions are triggered
+// for every event.
+//
+// The Result of the Watch is the event itself. Triggering the Watch without
+// giving it an event does not trigger any Actions.
+type Watch struct {
+	// Common fields and functions for all Watches.
+	common.WatchBase
+
+	// The Conditions that will evaluate the event to determine whether the
+	// Actions should be triggered or not.
+	Conditions []Condition `json:"conditions"`
+
+	// The event that the Watch is evaluated against, as decoded by the
+	// "encoding/json" package into an empty interface.
+	event interface{}
+	// Whether the Watch was given an event.
+	received bool
+}
+
+// Do implements common.Watch.Do(). It evaluates the Conditions against the
+// event given to the Watch, and returns the IDs of the Actions that should be
+// triggered as a result of the Watch, if any.
+func (watch Watch) Do(ctx context.Context) []int {
+	actionsIDs, _ := watch.DoWithContext(ctx)
+	return actionsIDs
+}
+
+// DoWithContext implements common.ContextWatch.DoWithContext(). It does the
+// same as Do(), and it additionally returns the context that the Actions should
+// be triggered with i.e. whether an event was received.
+func (watch Watch) DoWithContext(ctx context.Context) ([]int, actions.ActionContext) {
+	watch.data()
+	status := StatusNoEvent
+	if watch.received {
+		status = StatusReceived
+	}
+	actionContext := watch.ActionContext(status, nil)
+
+	if !watch.received || !watch.evaluate() {
+		return []int{}, actionContext
+	}
+
+	// If all conditions pass, return the IDs of the Actions that should be
+	// triggered.
+	return watch.ActionsIDs, actionContext
+}
+
+// Replay implements common.ReplayableWatch.Replay(). It evaluates each of the
+// Watch's Conditions against the given JSON-encoded event.
+func (watch Watch) Replay(jsonEvent []byte) ([]bool, error) {
+	var event interface{}
+	err := json.Unmarshal(jsonEvent, &event)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]bool, len(watch.Conditions))
+	for index, condition := range watch.Conditions {
+		outcomes[index] = condition.Do(event)
+	}
+
+	return outcomes, nil
+}
+
+// WithResult implements common.ResultWatch.WithResult(). It returns a copy of
+// the Watch that is evaluated against the given JSON-encoded event.
+func (watch Watch) WithResult(jsonEvent []byte) (common.Watch, error) {
+	var event interface{}
+	err := json.Unmarshal(jsonEvent, &event)
+	if err != nil {
+		return nil, err
+	}
+	watch.event = event
+	watch.received = true
+
+	return watch, nil
+}
+
+// The Watch is given its event instead of preparing it; there is no data to
+// prepare.
+func (watch *Watch) data() {}
+
+// Go through all Conditions defined in the Watch and evaluate them. The
+// Conditions are successful in their entirety when all Conditions evaluate
+// successfully.
+func (watch *Watch) evaluate() bool {
+	allOk := true
+	for _, condition := range watch.Conditions {
+		ok := condition.Do(watch.event)
+		if !ok {
+			allOk = false
+			break
+		}
+	}
+
+	return allOk
+}
+
+// Condition is an interface that should be implemented by all Condition types
+// for the Inbound Event Watch. It simply defines a function that, given the
+// event received by the Watch, it decides whether the Condition is met.
+type Condition interface {
+	Do(event interface{}) bool
+}
+
+// ConditionAssertion implements the Condition interface, providing a Condition
+// that is met when the given Assertion passes against the event. The Assertion
+// is defined the same way as the Assertions of the JSON Check Watch.
+type ConditionAssertion struct {
+	jsonCheck.Assertion
+}
+
+// Do implements Condition.Do(), determining whether the Assertion passes.
+func (condition ConditionAssertion) Do(event interface{}) bool {
+	return condition.Evaluate(event).Passed
+}
+
+/**
+ * JSON.
+ */
+
+// MarshalJSON encodes a ConditionAssertion object into a JSON object that
+// contains its type together with the fields of its Assertion. This is desired
+// so that a JSON-encoded Watch object containing such a Condition can be then
+// decoded based on the Condition type.
+func (condition ConditionAssertion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		jsonCheck.Assertion
+	}{
+		Type:      "assertion",
+		Assertion: condition.Assertion,
+	})
+}
+
+// UnmarshalJSON provides decoding of a JSON-encoded Watch object so that the
+// Conditions held in the "conditions" field are properly constructed based on
+// their type.
+func (watch *Watch) UnmarshalJSON(bytes []byte) error {
+	// Deserialize everything into a map of json.RawMessage; its indices would
+	// correspond to the Watch struct's fields.
+	var jsonMap map[string]*json.RawMessage
+	err := json.Unmarshal(bytes, &jsonMap)
+	if err != nil {
+		return err
+	}
+
+	// Decode all other fields first.
+	if jsonMap["name"] != nil {
+		var name string
+		err = json.Unmarshal(*jsonMap["name"], &name)
+		if err != nil {
+			return err
+		}
+		watch.Name = name
+	}
+	if jsonMap["actions_ids"] != nil {
+		var actionsIds []int
+		err = json.Unmarshal(*jsonMap["actions_ids"], &actionsIds)
+		if err != nil {
+			return err
+		}
+		watch.ActionsIDs = actionsIds
+	}
+	if jsonMap["created_at"] != nil {
+		var createdAt *time.Time
+		err = json.Unmarshal(*jsonMap["created_at"], &createdAt)
+		if err != nil {
+			return err
+		}
+		watch.CreatedAt = createdAt
+	}
+	if jsonMap["updated_at"] != nil {
+		var updatedAt *time.Time
+		err = json.Unmarshal(*jsonMap["updated_at"], &updatedAt)
+		if err != nil {
+			return err
+		}
+		watch.UpdatedAt = updatedAt
+	}
+	if jsonMap["singleton"] != nil {
+		var singleton bool
+		err = json.Unmarshal(*jsonMap["singleton"], &singleton)
+		if err != nil {
+			return err
+		}
+		watch.Singleton = singleton
+	}
+	if jsonMap["warning_actions_ids"] != nil {
+		var warningActionsIDs []int
+		err = json.Unmarshal(*jsonMap["warning_actions_ids"], &warningActionsIDs)
+		if err != nil {
+			return err
+		}
+		watch.WarningActionsIDs = warningActionsIDs
+	}
+	if jsonMap["actions_priorities"] != nil {
+		var actionsPriorities map[int]int
+		err = json.Unmarshal(*jsonMap["actions_priorities"], &actionsPriorities)
+		if err != nil {
+			return err
+		}
+		watch.ActionsPriorities = actionsPriorities
+	}
+	if jsonMap["stop_on_action_failure"] != nil {
+		var stopOnActionFailure bool
+		err = json.Unmarshal(*jsonMap["stop_on_action_failure"], &stopOnActionFailure)
+		if err != nil {
+			return err
+		}
+		watch.StopOnActionFailure = stopOnActionFailure
+	}
+
+	// If no conditions are given, there's nothing to do; return or we'll get an
+	// error.
+	if jsonMap["conditions"] == nil {
+		return nil
+	}
+
+	var rawConditions []*json.RawMessage
+	err = json.Unmarshal(*jsonMap["conditions"], &rawConditions)
+	if err != nil {
+		return err
+	}
+
+	// Create a slice of the right size that will hold the Conditions.
+	watch.Conditions = make([]Condition, len(rawConditions))
+
+	// Decode the Conditions from their JSON structure and put them in the
+	// corresponding field slice.
+	for index, rawCondition := range rawConditions {
+		var conditionInnerJSON map[string]*json.RawMessage
+		err = json.Unmarshal(*rawCondition, &conditionInnerJSON)
+		if err != nil {
+			return err
+		}
+
+		// Get the type of the Condition.
+		if conditionInnerJSON["type"] == nil {
+			return fmt.Errorf("a Condition was given without its type")
+		}
+		var conditionType string
+		err = json.Unmarshal(*conditionInnerJSON["type"], &conditionType)
+		if err != nil {
+			return err
+		}
+
+		switch conditionType {
+		case "assertion":
+			var assertion jsonCheck.Assertion
+			err = json.Unmarshal(*rawCondition, &assertion)
+			if err != nil {
+				return err
+			}
+			watch.Conditions[index] = ConditionAssertion{Assertion: assertion}
+		default:
+			return fmt.Errorf("unknown Condition type \"%s\"", conditionType)
+		}
+	}
+
+	return nil
+}
+
+// NewInboundEventWatch implements the WatchFactory function type. It creates an
+// Inbound Event Watch based on the given JSON-object. There are no dependencies
+// to inject.
+var NewInboundEventWatch = func(jsonWatch *json.RawMessage) (common.Watch, error) {
+	// Create a Watch object from JSON.
+	var watch Watch
+	err := json.Unmarshal(*jsonWatch, &watch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the paths early so that mistakes are reported when the Watch is
+	// created rather than when it is evaluated.
+	for _, condition := range watch.Conditions {
+		if assertionCondition, ok := condition.(ConditionAssertion); ok {
+			err = assertionCondition.Validate()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return watch, nil
+}
@@ -0,0 +1,150 @@
+/**
+ * Tests for the Inbound Event Watch.
+ */
+
+package msWatchInboundEvent
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"context"
+	"encoding/json"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	jsonCheck "github.com/krystalcode/go-mantis-shrimp/watches/json_check"
+)
+
+/**
+ * Helper types and functions reused in various tests.
+ */
+
+// The event given to the Watch in the tests.
+const testEvent = `{
+	"source": "deploy",
+	"status": "failed",
+	"attempts": 3
+}`
+
+// testWatch generates a Watch object with the given Conditions.
+func testWatch(conditions ...Condition) Watch {
+	watch := Watch{
+		WatchBase: common.WatchBase{
+			Name:       "Test Watch",
+			ActionsIDs: []int{1},
+		},
+		Conditions: conditions,
+	}
+	return watch
+}
+
+/**
+ * Tests.
+ */
+
+func TestDo_Conditions(t *testing.T) {
+	cases := []struct {
+		conditions []Condition
+		actionsIDs []int
+	}{
+		// Every event triggers the Actions without Conditions.
+		{[]Condition{}, []int{1}},
+		{
+			[]Condition{
+				ConditionAssertion{jsonCheck.Assertion{Path: "$.status", Operator: "==", Value: "failed"}},
+				ConditionAssertion{jsonCheck.Assertion{Path: "$.attempts", Operator: ">=", Value: 3}},
+			},
+			[]int{1},
+		},
+		{
+			[]Condition{
+				ConditionAssertion{jsonCheck.Assertion{Path: "$.status", Operator: "==", Value: "failed"}},
+				ConditionAssertion{jsonCheck.Assertion{Path: "$.source", Operator: "==", Value: "backup"}},
+			},
+			[]int{},
+		},
+		{
+			[]Condition{
+				ConditionAssertion{jsonCheck.Assertion{Path: "$.missing", Operator: "exists"}},
+			},
+			[]int{},
+		},
+	}
+	for index, c := range cases {
+		watch, err := testWatch(c.conditions...).WithResult([]byte(testEvent))
+		assert.Nil(t, err)
+
+		actionsIDs, actionContext := watch.(common.ContextWatch).DoWithContext(context.Background())
+		assert.Equal(t, c.actionsIDs, actionsIDs, "case %d", index)
+		assert.Equal(t, StatusReceived, actionContext.Status, "case %d", index)
+		assert.Equal(t, "Test Watch", actionContext.WatchName, "case %d", index)
+	}
+}
+
+func TestDo_NoEvent(t *testing.T) {
+	watch := testWatch()
+
+	actionsIDs, actionContext := watch.DoWithContext(context.Background())
+	assert.Equal(t, []int{}, actionsIDs)
+	assert.Equal(t, StatusNoEvent, actionContext.Status)
+
+	// The event should be given to a copy of the Watch only.
+	_, err := watch.WithResult([]byte(testEvent))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{}, watch.Do(context.Background()))
+}
+
+func TestWithResult_InvalidEvent(t *testing.T) {
+	_, err := testWatch().WithResult([]byte(`{"status":`))
+	assert.NotNil(t, err)
+}
+
+func TestReplay(t *testing.T) {
+	watch := testWatch(
+		ConditionAssertion{jsonCheck.Assertion{Path: "$.status", Operator: "==", Value: "failed"}},
+		ConditionAssertion{jsonCheck.Assertion{Path: "$.attempts", Operator: "<", Value: 3}},
+	)
+
+	outcomes, err := watch.Replay([]byte(testEvent))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false}, outcomes)
+
+	_, err = watch.Replay([]byte(`not json`))
+	assert.NotNil(t, err)
+}
+
+func TestJSON(t *testing.T) {
+	watch := testWatch(
+		ConditionAssertion{jsonCheck.Assertion{Path: "$.status", Operator: "==", Value: "failed"}},
+	)
+
+	jsonWatch, err := json.Marshal(watch)
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonWatch), `"conditions":[{"type":"assertion","path":"$.status","operator":"==","value":"failed"}]`)
+
+	var decodedWatch Watch
+	err = json.Unmarshal(jsonWatch, &decodedWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, watch, decodedWatch)
+
+	err = json.Unmarshal([]byte(`{"conditions":[{"type":"unknown"}]}`), &decodedWatch)
+	assert.EqualError(t, err, "unknown Condition type \"unknown\"")
+}
+
+func TestNewInboundEventWatch(t *testing.T) {
+	jsonWatch := json.RawMessage(`{"actions_ids":[1],"conditions":[{"type":"assertion","path":"$.status","operator":"==","value":"failed"}]}`)
+	watch, err := NewInboundEventWatch(&jsonWatch)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]Condition{ConditionAssertion{jsonCheck.Assertion{Path: "$.status", Operator: "==", Value: "failed"}}},
+		watch.(Watch).Conditions,
+	)
+
+	jsonWatch = json.RawMessage(`{"conditions":[{"type":"assertion","path":"$.attempts[x]","operator":"exists"}]}`)
+	_, err = NewInboundEventWatch(&jsonWatch)
+	assert.EqualError(t, err, "the path \"$.attempts[x]\" contains an invalid array index")
+}
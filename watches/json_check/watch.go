@@ -0,0 +1,640 @@
+/**
+ * Provides a Watch that checks the values of fields in a JSON response.
+ */
+
+package msWatchJSONCheck
+
+import (
+	// Utilities.
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Types and their functions.
+ */
+
+// HTTPClient is an interface that is used to allow dependency injection of the
+// HTTP client that makes the request to the Watch's URL. Dependency injection
+// is necessary for testing purposes.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Watch implements the common.Watch interface. It provides a Watch that makes a
+// request to the defined URL and evaluates the defined Assertions against the
+// JSON document in the response body. Its evaluation of whether the included
+// Actions will be executed depend on the evaluation of its Conditions.
+type Watch struct {
+	// Common fields and functions for all Watches.
+	common.WatchBase
+
+	// The URL that will be requested.
+	URL string `json:"url"`
+	// How much to wait for the response before considering the URL inaccessible.
+	Timeout util.Duration `json:"timeout"`
+	// The Assertions that will be evaluated against the response body.
+	Assertions []Assertion `json:"assertions"`
+	// The Conditions that will evaluate the results to determine whether the
+	// Actions should be triggered or not.
+	Conditions []Condition `json:"conditions"`
+
+	// The HTTP client used to make the request to the URL.
+	httpClient HTTPClient
+	// The result of the data operation.
+	result Result
+}
+
+// Do implements common.Watch.Do(). It prepares the Result of the Watch, it
+// evaluates the Conditions, and returns the IDs of the Actions that should be
+// triggered as a result of the Watch, if any.
+func (watch Watch) Do(ctx context.Context) []int {
+	actionsIDs, _ := watch.DoWithContext(ctx)
+	return actionsIDs
+}
+
+// DoWithContext implements common.ContextWatch.DoWithContext(). It does the
+// same as Do(), and it additionally returns the context that the Actions should
+// be triggered with i.e. the status of the Result and the URL.
+func (watch Watch) DoWithContext(ctx context.Context) ([]int, actions.ActionContext) {
+	watch.data(ctx)
+	ok := watch.evaluate()
+	actionContext := watch.ActionContext(watch.result.Status, map[string]string{"url": watch.URL})
+
+	if !ok {
+		return []int{}, actionContext
+	}
+
+	// If all conditions pass, return the IDs of the Actions that should be
+	// triggered.
+	return watch.ActionsIDs, actionContext
+}
+
+// Replay implements common.ReplayableWatch.Replay(). It evaluates each of the
+// Watch's Conditions against the given JSON-encoded Result, without making a
+// request to the Watch's URL.
+func (watch Watch) Replay(jsonResult []byte) ([]bool, error) {
+	var result Result
+	err := json.Unmarshal(jsonResult, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]bool, len(watch.Conditions))
+	for index, condition := range watch.Conditions {
+		outcomes[index] = condition.Do(result)
+	}
+
+	return outcomes, nil
+}
+
+// SetHTTPClient allows to inject an HTTP client into the corresponding field.
+func (watch *Watch) SetHTTPClient(client HTTPClient) {
+	watch.httpClient = client
+}
+
+// Makes a GET call to the URL defined in the Watch, evaluates the Assertions
+// against the response body and determines the Result.
+func (watch *Watch) data(ctx context.Context) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, watch.URL, nil)
+	if err != nil {
+		watch.result = Result{Status: "inaccessible"}
+		return
+	}
+	req.Header.Set("User-Agent", util.UserAgent("watch"))
+	res, err := watch.httpClient.Do(req)
+	if err != nil {
+		watch.result = Result{Status: "inaccessible"}
+		return
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		watch.result = Result{Status: "inaccessible"}
+		return
+	}
+
+	var document interface{}
+	err = json.Unmarshal(body, &document)
+	if err != nil {
+		watch.result = Result{Status: "invalid_json"}
+		return
+	}
+
+	assertions := make([]AssertionResult, len(watch.Assertions))
+	for index, assertion := range watch.Assertions {
+		assertions[index] = assertion.Evaluate(document)
+	}
+
+	watch.result = Result{Status: "success", Assertions: assertions}
+}
+
+// Go through all Conditions defined in the Watch and evaluate them. The
+// Conditions are successful in their entirety when all Conditions evaluate
+// successfully.
+func (watch *Watch) evaluate() bool {
+	allOk := true
+	for _, condition := range watch.Conditions {
+		ok := condition.Do(watch.result)
+		if !ok {
+			allOk = false
+			break
+		}
+	}
+
+	return allOk
+}
+
+// Assertion defines a comparison of the value found at a path of a JSON
+// document with a given value.
+//
+// The path consists of object keys separated by dots, optionally starting with
+// "$." for the root of the document; array elements are selected by their index
+// in brackets e.g. "$.services[0].status".
+//
+// The supported operators are "==", "!=", "<", "<=", ">", ">=" and "exists".
+// Values of different types are never equal. The ordering operators compare
+// numbers with numbers and strings with strings. The "exists" operator only
+// requires that the path is present, and it ignores the value.
+type Assertion struct {
+	Path     string      `json:"path"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+// Evaluate evaluates the Assertion against the given JSON document, as decoded
+// by the "encoding/json" package into an empty interface.
+func (assertion Assertion) Evaluate(document interface{}) AssertionResult {
+	result := AssertionResult{Path: assertion.Path}
+
+	actual, found, err := resolve(document, assertion.Path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if assertion.Operator == "exists" {
+		result.Passed = found
+		return result
+	}
+
+	if !found {
+		result.Error = "the path was not found"
+		return result
+	}
+	result.Actual = actual
+
+	expected := normalizeNumber(assertion.Value)
+
+	switch assertion.Operator {
+	case "==":
+		result.Passed = reflect.DeepEqual(actual, expected)
+	case "!=":
+		result.Passed = !reflect.DeepEqual(actual, expected)
+	case "<", "<=", ">", ">=":
+		comparison, err := compare(actual, expected)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		switch assertion.Operator {
+		case "<":
+			result.Passed = comparison < 0
+		case "<=":
+			result.Passed = comparison <= 0
+		case ">":
+			result.Passed = comparison > 0
+		case ">=":
+			result.Passed = comparison >= 0
+		}
+	default:
+		result.Error = fmt.Sprintf("unknown operator \"%s\"", assertion.Operator)
+	}
+
+	return result
+}
+
+// Validate returns an error if the Assertion's path is not valid. It allows
+// mistakes to be reported when a Watch is created rather than when it is
+// evaluated.
+func (assertion Assertion) Validate() error {
+	_, err := parsePath(assertion.Path)
+	return err
+}
+
+// AssertionResult holds the outcome of evaluating an Assertion. It includes the
+// value found at the Assertion's path, if any, and the reason that the
+// Assertion could not be evaluated, if any.
+type AssertionResult struct {
+	Path   string      `json:"path"`
+	Passed bool        `json:"passed"`
+	Actual interface{} `json:"actual,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Result holds the result of a JSON check. Its status is a string that can hold
+// one of the following values:
+// - success (the response body was parsed and the Assertions were evaluated)
+// - inaccessible
+// - invalid_json
+// It also holds the outcome of each Assertion, in the order they are defined.
+type Result struct {
+	Status     string            `json:"status"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+}
+
+// Condition is an interface that should be implemented by all Condition types
+// for the JSON Check Watch. It simply defines a function that, given the Result
+// of a JSON Check operation, it decides whether the Condition is met.
+type Condition interface {
+	Do(Result) bool
+}
+
+// ConditionAllAssertionsPass implements the Condition interface, providing a
+// Condition that is met when the response body was parsed and all Assertions
+// passed.
+type ConditionAllAssertionsPass struct{}
+
+// Do implements Condition.Do(), determining whether all Assertions passed.
+func (condition ConditionAllAssertionsPass) Do(result Result) bool {
+	if result.Status != "success" {
+		return false
+	}
+
+	for _, assertion := range result.Assertions {
+		if !assertion.Passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ConditionAnyAssertionFails implements the Condition interface, providing a
+// Condition that is met when the response body could not be parsed or any
+// Assertion failed; it is the opposite of ConditionAllAssertionsPass.
+type ConditionAnyAssertionFails struct{}
+
+// Do implements Condition.Do(), determining whether any Assertion failed.
+func (condition ConditionAnyAssertionFails) Do(result Result) bool {
+	return !ConditionAllAssertionsPass{}.Do(result)
+}
+
+/**
+ * JSON.
+ */
+
+// MarshalJSON encodes a ConditionAllAssertionsPass object into a JSON object
+// that contains a single field, indicating its type. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionAllAssertionsPass) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"all_assertions_pass"}`), nil
+}
+
+// MarshalJSON encodes a ConditionAnyAssertionFails object into a JSON object
+// that contains a single field, indicating its type. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionAnyAssertionFails) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"any_assertion_fails"}`), nil
+}
+
+// UnmarshalJSON provides decoding of a JSON-encoded Watch object so that the
+// Conditions held in the "conditions" field are properly constructed based on
+// their type.
+func (watch *Watch) UnmarshalJSON(bytes []byte) error {
+	// Deserialize everything into a map of json.RawMessage; its indices would
+	// correspond to the Watch struct's fields.
+	var jsonMap map[string]*json.RawMessage
+	err := json.Unmarshal(bytes, &jsonMap)
+	if err != nil {
+		return err
+	}
+
+	// Decode all other fields first.
+	if jsonMap["name"] != nil {
+		var name string
+		err = json.Unmarshal(*jsonMap["name"], &name)
+		if err != nil {
+			return err
+		}
+		watch.Name = name
+	}
+	if jsonMap["actions_ids"] != nil {
+		var actionsIds []int
+		err = json.Unmarshal(*jsonMap["actions_ids"], &actionsIds)
+		if err != nil {
+			return err
+		}
+		watch.ActionsIDs = actionsIds
+	}
+	if jsonMap["created_at"] != nil {
+		var createdAt *time.Time
+		err = json.Unmarshal(*jsonMap["created_at"], &createdAt)
+		if err != nil {
+			return err
+		}
+		watch.CreatedAt = createdAt
+	}
+	if jsonMap["updated_at"] != nil {
+		var updatedAt *time.Time
+		err = json.Unmarshal(*jsonMap["updated_at"], &updatedAt)
+		if err != nil {
+			return err
+		}
+		watch.UpdatedAt = updatedAt
+	}
+	if jsonMap["singleton"] != nil {
+		var singleton bool
+		err = json.Unmarshal(*jsonMap["singleton"], &singleton)
+		if err != nil {
+			return err
+		}
+		watch.Singleton = singleton
+	}
+	if jsonMap["warning_actions_ids"] != nil {
+		var warningActionsIDs []int
+		err = json.Unmarshal(*jsonMap["warning_actions_ids"], &warningActionsIDs)
+		if err != nil {
+			return err
+		}
+		watch.WarningActionsIDs = warningActionsIDs
+	}
+	if jsonMap["actions_priorities"] != nil {
+		var actionsPriorities map[int]int
+		err = json.Unmarshal(*jsonMap["actions_priorities"], &actionsPriorities)
+		if err != nil {
+			return err
+		}
+		watch.ActionsPriorities = actionsPriorities
+	}
+	if jsonMap["stop_on_action_failure"] != nil {
+		var stopOnActionFailure bool
+		err = json.Unmarshal(*jsonMap["stop_on_action_failure"], &stopOnActionFailure)
+		if err != nil {
+			return err
+		}
+		watch.StopOnActionFailure = stopOnActionFailure
+	}
+	if jsonMap["url"] != nil {
+		var URL string
+		err = json.Unmarshal(*jsonMap["url"], &URL)
+		if err != nil {
+			return err
+		}
+		watch.URL = URL
+	}
+	if jsonMap["timeout"] != nil {
+		var timeout util.Duration
+		err = json.Unmarshal(*jsonMap["timeout"], &timeout)
+		if err != nil {
+			return err
+		}
+		watch.Timeout = timeout
+	}
+	if jsonMap["assertions"] != nil {
+		var assertions []Assertion
+		err = json.Unmarshal(*jsonMap["assertions"], &assertions)
+		if err != nil {
+			return err
+		}
+		watch.Assertions = assertions
+	}
+
+	// If no conditions are given, there's nothing to do; return or we'll get an
+	// error.
+	if jsonMap["conditions"] == nil {
+		return nil
+	}
+
+	var rawConditions []*json.RawMessage
+	err = json.Unmarshal(*jsonMap["conditions"], &rawConditions)
+	if err != nil {
+		return err
+	}
+
+	// Create a slice of the right size that will hold the Conditions.
+	watch.Conditions = make([]Condition, len(rawConditions))
+
+	// Decode the Conditions from their JSON structure and put them in the
+	// corresponding field slice.
+	for index, rawCondition := range rawConditions {
+		var conditionInnerJSON map[string]*json.RawMessage
+		err = json.Unmarshal(*rawCondition, &conditionInnerJSON)
+		if err != nil {
+			return err
+		}
+
+		// Get the type of the Condition.
+		if conditionInnerJSON["type"] == nil {
+			return fmt.Errorf("a Condition was given without its type")
+		}
+		var conditionType string
+		err = json.Unmarshal(*conditionInnerJSON["type"], &conditionType)
+		if err != nil {
+			return err
+		}
+
+		switch conditionType {
+		case "all_assertions_pass":
+			watch.Conditions[index] = ConditionAllAssertionsPass{}
+		case "any_assertion_fails":
+			watch.Conditions[index] = ConditionAnyAssertionFails{}
+		default:
+			return fmt.Errorf("unknown Condition type \"%s\"", conditionType)
+		}
+	}
+
+	return nil
+}
+
+// NewJSONCheckWatch implements the WatchFactory function type. It creates a JSON
+// Check Watch based on the given JSON-object, and initializes it by injecting
+// the required HTTP client.
+var NewJSONCheckWatch = func(jsonWatch *json.RawMessage) (common.Watch, error) {
+	// Create a Watch object from JSON.
+	var watch Watch
+	err := json.Unmarshal(*jsonWatch, &watch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the paths early so that mistakes are reported when the Watch is
+	// created rather than when it is evaluated.
+	for _, assertion := range watch.Assertions {
+		err = assertion.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Inject an HTTP client with the Watch's timeout.
+	client := &http.Client{
+		Timeout: watch.Timeout.Duration,
+	}
+	watch.SetHTTPClient(client)
+
+	return watch, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// pathSegment is an element of a parsed path; either an object key or, if key
+// is empty, an array index.
+type pathSegment struct {
+	key   string
+	index int
+}
+
+// parsePath splits the given path into its segments.
+func parsePath(path string) ([]pathSegment, error) {
+	trimmedPath := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmedPath == "" {
+		return nil, nil
+	}
+
+	var segments []pathSegment
+	for _, part := range strings.Split(trimmedPath, ".") {
+		// Separate the key from any array indexes that follow it e.g.
+		// "services[0][1]".
+		key := part
+		indexes := ""
+		if position := strings.Index(part, "["); position != -1 {
+			key = part[:position]
+			indexes = part[position:]
+		}
+
+		if key == "" && indexes == "" {
+			return nil, fmt.Errorf("the path \"%s\" contains an empty key", path)
+		}
+		if key != "" {
+			segments = append(segments, pathSegment{key: key})
+		}
+
+		for indexes != "" {
+			end := strings.Index(indexes, "]")
+			if indexes[0] != '[' || end == -1 {
+				return nil, fmt.Errorf("the path \"%s\" contains an invalid array index", path)
+			}
+			index, err := strconv.Atoi(indexes[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("the path \"%s\" contains an invalid array index", path)
+			}
+			segments = append(segments, pathSegment{index: index})
+			indexes = indexes[end+1:]
+		}
+	}
+
+	return segments, nil
+}
+
+// resolve returns the value found at the given path of the given document, and
+// whether the path was found. An error is returned if the path is not valid.
+func resolve(document interface{}, path string) (interface{}, bool, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value := document
+	for _, segment := range segments {
+		if segment.key != "" {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			value, ok = object[segment.key]
+			if !ok {
+				return nil, false, nil
+			}
+			continue
+		}
+
+		array, ok := value.([]interface{})
+		if !ok || segment.index >= len(array) {
+			return nil, false, nil
+		}
+		value = array[segment.index]
+	}
+
+	return value, true, nil
+}
+
+// compare returns a negative number, zero or a positive number if the first
+// value is lower than, equal to or greater than the second value respectively.
+// Only numbers and strings can be compared, and only with values of the same
+// type.
+func compare(a interface{}, b interface{}) (int, error) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %s value with %s value", jsonType(a), jsonType(b))
+}
+
+// normalizeNumber converts numbers of any Go type to float64, which is the type
+// that the "encoding/json" package decodes JSON numbers to.
+func normalizeNumber(value interface{}) interface{} {
+	switch value := value.(type) {
+	case int:
+		return float64(value)
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case float32:
+		return float64(value)
+	default:
+		return value
+	}
+}
+
+// jsonType returns the name of the JSON type of the given decoded value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,275 @@
+/**
+ * Tests for the JSON Check Watch.
+ */
+
+package msWatchJSONCheck
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Utilities.
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Helper types and functions reused in various tests.
+ */
+
+// The document returned by the mock HTTP client.
+const testDocument = `{
+	"status": "ok",
+	"uptime": 3600,
+	"db": {"status": "up", "replicas": 2},
+	"services": [
+		{"name": "cache", "status": "up"},
+		{"name": "queue", "status": "down"}
+	],
+	"maintenance": null
+}`
+
+// testWatch generates a Watch object with the given Assertions.
+func testWatch(assertions ...Assertion) Watch {
+	watch := Watch{
+		WatchBase: common.WatchBase{
+			Name:       "Test Watch",
+			ActionsIDs: []int{1},
+		},
+		URL:        "https://example.com/health",
+		Assertions: assertions,
+		Conditions: []Condition{},
+	}
+	return watch
+}
+
+// An HTTP client that returns a response with the given body.
+type MockHTTPClient struct {
+	body string
+}
+
+func (client MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	response := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(client.body)),
+	}
+
+	return response, nil
+}
+
+// An HTTP client that returns an error, simulating an unresponsive URL or a
+// network error.
+type MockHTTPClientError struct{}
+
+func (client MockHTTPClientError) Do(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("cannot reach the given URL within the given timeout")
+}
+
+// testEvaluate evaluates the given Assertion against the test document.
+func testEvaluate(assertion Assertion) AssertionResult {
+	var document interface{}
+	json.Unmarshal([]byte(testDocument), &document)
+	return assertion.Evaluate(document)
+}
+
+/**
+ * Test Assertions.
+ */
+
+func TestAssertion_Paths(t *testing.T) {
+	cases := map[string]interface{}{
+		"$.status":            "ok",
+		"status":              "ok",
+		"$.db.status":         "up",
+		"$.services[1].name":  "queue",
+		"services[0].status":  "up",
+		"$.db.replicas":       float64(2),
+		"$.maintenance":       nil,
+		"$.services[1]":       map[string]interface{}{"name": "queue", "status": "down"},
+		"$.db":                map[string]interface{}{"status": "up", "replicas": float64(2)},
+		"$.services[0]['x']":  nil,
+		"$.services[-1].name": nil,
+	}
+
+	for path, expected := range cases {
+		result := testEvaluate(Assertion{Path: path, Operator: "==", Value: expected})
+		switch path {
+		case "$.services[0]['x']", "$.services[-1].name":
+			// Invalid paths should be reported.
+			assert.False(t, result.Passed, path)
+			assert.NotEmpty(t, result.Error, path)
+		default:
+			assert.True(t, result.Passed, path)
+			assert.Empty(t, result.Error, path)
+		}
+	}
+}
+
+func TestAssertion_MissingPaths(t *testing.T) {
+	for _, path := range []string{"$.version", "$.db.primary", "$.services[2]", "$.status.code", "$.db[0]"} {
+		result := testEvaluate(Assertion{Path: path, Operator: "==", Value: "up"})
+		assert.False(t, result.Passed, path)
+		assert.Equal(t, "the path was not found", result.Error, path)
+
+		result = testEvaluate(Assertion{Path: path, Operator: "exists"})
+		assert.True(t, result.Error == "" && !result.Passed, path)
+	}
+
+	// A path holding a null value exists.
+	result := testEvaluate(Assertion{Path: "$.maintenance", Operator: "exists"})
+	assert.True(t, result.Passed)
+}
+
+func TestAssertion_Operators(t *testing.T) {
+	cases := []struct {
+		assertion Assertion
+		passed    bool
+	}{
+		{Assertion{"$.db.status", "==", "up"}, true},
+		{Assertion{"$.db.status", "==", "down"}, false},
+		{Assertion{"$.db.status", "!=", "down"}, true},
+		{Assertion{"$.uptime", "==", 3600}, true},
+		{Assertion{"$.uptime", ">", 60}, true},
+		{Assertion{"$.uptime", ">=", 3600.0}, true},
+		{Assertion{"$.uptime", "<", 3600}, false},
+		{Assertion{"$.uptime", "<=", 3600}, true},
+		{Assertion{"$.status", "<", "up"}, true},
+	}
+
+	for _, c := range cases {
+		result := testEvaluate(c.assertion)
+		assert.Equal(t, c.passed, result.Passed, "%v", c.assertion)
+		assert.Empty(t, result.Error, "%v", c.assertion)
+	}
+
+	result := testEvaluate(Assertion{"$.status", "~=", "ok"})
+	assert.False(t, result.Passed)
+	assert.Equal(t, "unknown operator \"~=\"", result.Error)
+}
+
+func TestAssertion_TypeMismatch(t *testing.T) {
+	// Values of different types are never equal.
+	result := testEvaluate(Assertion{"$.uptime", "==", "3600"})
+	assert.False(t, result.Passed)
+	assert.Empty(t, result.Error)
+	result = testEvaluate(Assertion{"$.uptime", "!=", "3600"})
+	assert.True(t, result.Passed)
+
+	// Values of different types cannot be ordered.
+	result = testEvaluate(Assertion{"$.uptime", ">", "60"})
+	assert.False(t, result.Passed)
+	assert.Equal(t, "cannot compare number value with string value", result.Error)
+	result = testEvaluate(Assertion{"$.db", ">", 1})
+	assert.False(t, result.Passed)
+	assert.Equal(t, "cannot compare object value with number value", result.Error)
+}
+
+/**
+ * Test Result preparation and Conditions.
+ */
+
+func TestResultPreparation_Success(t *testing.T) {
+	watch := testWatch(
+		Assertion{"$.db.status", "==", "up"},
+		Assertion{"$.services[1].status", "==", "up"},
+	)
+	watch.SetHTTPClient(MockHTTPClient{testDocument})
+	watch.data(context.Background())
+
+	assert.Equal(t, "success", watch.result.Status)
+	assert.Equal(
+		t,
+		[]AssertionResult{
+			{Path: "$.db.status", Passed: true, Actual: "up"},
+			{Path: "$.services[1].status", Passed: false, Actual: "down"},
+		},
+		watch.result.Assertions,
+	)
+}
+
+func TestResultPreparation_InvalidJSON(t *testing.T) {
+	watch := testWatch(Assertion{"$.status", "==", "ok"})
+	watch.SetHTTPClient(MockHTTPClient{"<html></html>"})
+	watch.data(context.Background())
+
+	assert.Equal(t, "invalid_json", watch.result.Status)
+}
+
+func TestResultPreparation_Inaccessible(t *testing.T) {
+	watch := testWatch(Assertion{"$.status", "==", "ok"})
+	watch.SetHTTPClient(MockHTTPClientError{})
+	watch.data(context.Background())
+
+	assert.Equal(t, "inaccessible", watch.result.Status)
+}
+
+func TestDo(t *testing.T) {
+	passing := Assertion{"$.status", "==", "ok"}
+	failing := Assertion{"$.services[1].status", "==", "up"}
+
+	cases := []struct {
+		assertions []Assertion
+		client     HTTPClient
+		condition  Condition
+		actionsIDs []int
+	}{
+		{[]Assertion{passing}, MockHTTPClient{testDocument}, ConditionAllAssertionsPass{}, []int{1}},
+		{[]Assertion{passing, failing}, MockHTTPClient{testDocument}, ConditionAllAssertionsPass{}, []int{}},
+		{[]Assertion{passing, failing}, MockHTTPClient{testDocument}, ConditionAnyAssertionFails{}, []int{1}},
+		{[]Assertion{passing}, MockHTTPClientError{}, ConditionAllAssertionsPass{}, []int{}},
+		{[]Assertion{passing}, MockHTTPClientError{}, ConditionAnyAssertionFails{}, []int{1}},
+	}
+
+	for index, c := range cases {
+		watch := testWatch(c.assertions...)
+		watch.Conditions = []Condition{c.condition}
+		watch.SetHTTPClient(c.client)
+
+		assert.Equal(t, c.actionsIDs, watch.Do(context.Background()), "case %d", index)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	watch := testWatch()
+	watch.Conditions = []Condition{ConditionAllAssertionsPass{}, ConditionAnyAssertionFails{}}
+
+	outcomes, err := watch.Replay([]byte(`{"status":"success","assertions":[{"path":"$.status","passed":true}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false}, outcomes)
+}
+
+/**
+ * Test JSON encoding/decoding.
+ */
+
+func TestJSON(t *testing.T) {
+	watch := testWatch(Assertion{"$.db.status", "==", "up"}, Assertion{"$.uptime", ">", float64(60)})
+	watch.Conditions = []Condition{ConditionAllAssertionsPass{}, ConditionAnyAssertionFails{}}
+
+	jsonWatch, err := json.Marshal(watch)
+	assert.Nil(t, err)
+
+	var decodedWatch Watch
+	err = json.Unmarshal(jsonWatch, &decodedWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, watch, decodedWatch)
+}
+
+func TestNewJSONCheckWatch(t *testing.T) {
+	jsonWatch := json.RawMessage(`{"url":"https://example.com","assertions":[{"path":"$.db.status","operator":"==","value":"up"}],"conditions":[{"type":"all_assertions_pass"}]}`)
+	watch, err := NewJSONCheckWatch(&jsonWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, []Assertion{{"$.db.status", "==", "up"}}, watch.(Watch).Assertions)
+
+	jsonWatch = json.RawMessage(`{"url":"https://example.com","assertions":[{"path":"$.services[x]","operator":"exists"}]}`)
+	_, err = NewJSONCheckWatch(&jsonWatch)
+	assert.EqualError(t, err, "the path \"$.services[x]\" contains an invalid array index")
+}
@@ -7,31 +7,111 @@ package msWatchSDK
 import (
 	// Utilities.
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
+
+	// Internal dependencies.
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/watches/wrapper"
 )
 
+// HTTPClient is an interface that is used to allow dependency injection of the
+// HTTP client that makes the requests to the Watch API. Dependency injection is
+// necessary for testing purposes.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
 // Config holds any configuration required to perform calls to the Watch API.
 type Config struct {
 	BaseURL string
 	Version string
+	// The token used to authenticate with the API, if it requires
+	// authentication.
+	AuthToken string
+	// The User-Agent header sent with the requests, identifying the component
+	// that makes them e.g. "mantis-shrimp/cron/1.0.0". Defaults to the
+	// User-Agent of the SDK.
+	UserAgent string
+	// The time given to requests to the API to complete, including reading the
+	// response. Requests do not time out when zero. It does not apply when an
+	// HTTP client is given.
+	Timeout time.Duration
+	// The HTTP client that makes the requests. Defaults to a client with the
+	// configured timeout.
+	HTTPClient HTTPClient
+}
+
+// Create makes a POST request that creates the Watch held in the given
+// WatchWrapper, and it returns the ID of the new Watch.
+func Create(watchWrapper wrapper.WatchWrapper, config Config) (int, error) {
+	// Prepare the URL and the request body.
+	url := config.BaseURL + "/v" + config.Version + "/"
+	body, err := json.Marshal(watchWrapper)
+	if err != nil {
+		return 0, err
+	}
+
+	// Make the request.
+	req, err := request("POST", url, body, config)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client(config).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Response status should always be 200.
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf(
+			"response Status not \"200 OK\" when creating a Watch; Status: \"%d\", Headers: \"%s\", Body: \"%s\"",
+			res.StatusCode,
+			res.Header,
+			resBody,
+		)
+		return 0, err
+	}
+
+	var response struct {
+		ID *int `json:"id"`
+	}
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.ID == nil {
+		return 0, fmt.Errorf("the response does not contain the ID of the created Watch; Body: \"%s\"", resBody)
+	}
+
+	return *response.ID, nil
 }
 
 // TriggerByID makes a POST request that triggers the Watch that corresponds to
 // the given ID.
 func TriggerByID(id int, config Config) error {
-	// @I Inject HTTP client to Watch SDK functions
-
 	// Prepare the URL and the request body.
 	idString := strconv.Itoa(id)
 	url := config.BaseURL + "/v" + config.Version + "/" + idString + "/trigger"
 	body := []byte{}
 
 	// Make the request.
-	client := &http.Client{}
-	res, err := client.Post(url, "application/json", bytes.NewBuffer(body))
+	req, err := request("POST", url, body, config)
+	if err != nil {
+		return err
+	}
+	res, err := client(config).Do(req)
 	if err != nil {
 		return err
 	}
@@ -43,7 +123,7 @@ func TriggerByID(id int, config Config) error {
 		if ioErr != nil {
 			err = fmt.Errorf(
 				"response Status not \"200 OK\" when triggering a Watch by its ID; Status: \"%d\", Headers: \"%s\", Body: An error occurred while decoding the body: \"%s\"",
-				res.Status,
+				res.StatusCode,
 				res.Header,
 				ioErr,
 			)
@@ -51,7 +131,7 @@ func TriggerByID(id int, config Config) error {
 		}
 		err = fmt.Errorf(
 			"response Status not \"200 OK\" when triggering a Watch by its ID; Status: \"%d\", Headers: \"%s\", Body: \"%s\"",
-			res.Status,
+			res.StatusCode,
 			res.Header,
 			resBody,
 		)
@@ -60,3 +140,139 @@ func TriggerByID(id int, config Config) error {
 
 	return nil
 }
+
+// Paused makes a GET request that returns whether triggering Watches is paused
+// e.g. during maintenance.
+func Paused(config Config) (bool, error) {
+	// Make the request.
+	url := config.BaseURL + "/v" + config.Version + "/pause"
+	req, err := request("GET", url, nil, config)
+	if err != nil {
+		return false, err
+	}
+	res, err := client(config).Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	// Response status should always be 200.
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return false, err
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf(
+			"response Status not \"200 OK\" when checking whether triggering Watches is paused; Status: \"%d\", Headers: \"%s\", Body: \"%s\"",
+			res.StatusCode,
+			res.Header,
+			resBody,
+		)
+		return false, err
+	}
+
+	var response struct {
+		Paused bool `json:"paused"`
+	}
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return false, err
+	}
+
+	return response.Paused, nil
+}
+
+// GetByID makes a GET request that retrieves the Watch that corresponds to the
+// given ID. It returns the Watch together with its type, as a JSON-encoded
+// WatchWrapper that can be given to wrapper.Create() or decoded into a
+// WatchWrapper. The returned error wraps errorsUtil.ErrNotFound if there is no
+// Watch with such ID.
+func GetByID(id int, config Config) (json.RawMessage, error) {
+	// Make the request.
+	url := config.BaseURL + "/v" + config.Version + "/" + strconv.Itoa(id)
+	req, err := request("GET", url, nil, config)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client(config).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("the Watch with ID \"%d\" was %w", id, errorsUtil.ErrNotFound)
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf(
+			"response Status not \"200 OK\" when getting a Watch by its ID; Status: \"%d\", Headers: \"%s\", Body: \"%s\"",
+			res.StatusCode,
+			res.Header,
+			resBody,
+		)
+		return nil, err
+	}
+
+	// The Watch is returned together with its type, in the same structure as
+	// the WatchWrapper.
+	var response struct {
+		Type  *string          `json:"type"`
+		Watch *json.RawMessage `json:"watch"`
+	}
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the response when getting a Watch by its ID: %s", err.Error())
+	}
+	if response.Type == nil || response.Watch == nil {
+		return nil, fmt.Errorf("the response does not contain the requested Watch; Body: \"%s\"", resBody)
+	}
+
+	return json.Marshal(struct {
+		Type  string          `json:"type"`
+		Watch json.RawMessage `json:"watch"`
+	}{*response.Type, *response.Watch})
+}
+
+/**
+ * For internal use.
+ */
+
+// request builds a request to the Watch API with the headers required by the
+// given configuration. A request with a body is sent as JSON.
+func request(method string, url string, body []byte, config Config) (*http.Request, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewBuffer(body)
+	}
+	req, err := http.NewRequest(method, url, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if config.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.AuthToken)
+	}
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = util.UserAgent("sdk")
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	return req, nil
+}
+
+// client returns the HTTP client given in the configuration, or a client with
+// the configured timeout if none is given.
+func client(config Config) HTTPClient {
+	if config.HTTPClient != nil {
+		return config.HTTPClient
+	}
+
+	return &http.Client{Timeout: config.Timeout}
+}
@@ -0,0 +1,191 @@
+/**
+ * Tests for the msWatchSDK module.
+ */
+
+package msWatchSDK
+
+import (
+	// Utilities.
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/watches/wrapper"
+)
+
+/**
+ * Tests.
+ */
+
+func TestCreate(t *testing.T) {
+	var method, path, authorization string
+	var decoded wrapper.WatchWrapper
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &decoded)
+		w.Write([]byte(`{"status":200,"id":3}`))
+	}))
+	defer server.Close()
+
+	config := testConfig(server.URL)
+	id, err := Create(testWatchWrapper(), config)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, id)
+	assert.Equal(t, "POST", method)
+	assert.Equal(t, "/v1/", path)
+	assert.Equal(t, "Bearer secret", authorization)
+	assert.Equal(t, "health_check", decoded.Type)
+	assert.Equal(t, "https://example.com", decoded.Watch.(health.Watch).URL)
+}
+
+func TestCreate_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":400}`))
+	}))
+	defer server.Close()
+
+	_, err := Create(testWatchWrapper(), testConfig(server.URL))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Status: \"400\"")
+}
+
+func TestCreate_MissingID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":200}`))
+	}))
+	defer server.Close()
+
+	_, err := Create(testWatchWrapper(), testConfig(server.URL))
+	assert.NotNil(t, err)
+}
+
+func TestCreate_HTTPClient(t *testing.T) {
+	client := &testHTTPClient{}
+	config := testConfig("http://ms-watch-api:8888")
+	config.HTTPClient = client
+
+	id, err := Create(testWatchWrapper(), config)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "http://ms-watch-api:8888/v1/", client.url)
+}
+
+func TestGetByID(t *testing.T) {
+	var method, path, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`{"status":200,"id":3,"type":"health_check","watch":{"url":"https://example.com"}}`))
+	}))
+	defer server.Close()
+
+	jsonWatch, err := GetByID(3, testConfig(server.URL))
+	assert.Nil(t, err)
+	assert.Equal(t, "GET", method)
+	assert.Equal(t, "/v1/3", path)
+	assert.Equal(t, "Bearer secret", authorization)
+	assert.JSONEq(t, `{"type":"health_check","watch":{"url":"https://example.com"}}`, string(jsonWatch))
+
+	// The Watch can be created from the returned JSON.
+	watch, err := wrapper.Create(jsonWatch)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", watch.(health.Watch).URL)
+}
+
+func TestGetByID_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"status":404}`))
+	}))
+	defer server.Close()
+
+	_, err := GetByID(3, testConfig(server.URL))
+	assert.True(t, errors.Is(err, errorsUtil.ErrNotFound))
+	assert.EqualError(t, err, "the Watch with ID \"3\" was not found")
+}
+
+func TestGetByID_InvalidResponse(t *testing.T) {
+	responses := map[string]int{
+		`{"status":200`:                   http.StatusOK,
+		`{"status":200,"id":3}`:           http.StatusOK,
+		`{"status":200,"type":"unknown"}`: http.StatusOK,
+		`{"status":500}`:                  http.StatusInternalServerError,
+	}
+
+	for body, status := range responses {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+
+		jsonWatch, err := GetByID(3, testConfig(server.URL))
+		assert.Nil(t, jsonWatch, body)
+		assert.NotNil(t, err, body)
+		assert.False(t, errors.Is(err, errorsUtil.ErrNotFound), body)
+		server.Close()
+	}
+}
+
+func TestGetByID_HTTPClient(t *testing.T) {
+	client := &testHTTPClient{}
+	config := testConfig("http://ms-watch-api:8888")
+	config.HTTPClient = client
+
+	// The test client does not return a Watch.
+	_, err := GetByID(3, config)
+	assert.NotNil(t, err)
+	assert.Equal(t, "http://ms-watch-api:8888/v1/3", client.url)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testHTTPClient is an HTTP client that records the URL of the request and
+// responds with the ID of a created Watch, without making the request.
+type testHTTPClient struct {
+	url string
+}
+
+func (client *testHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	client.url = req.URL.String()
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(`{"status":200,"id":1}`)),
+	}
+
+	return response, nil
+}
+
+// testConfig returns the configuration for the Watch API at the given URL.
+func testConfig(baseURL string) Config {
+	return Config{
+		BaseURL:   baseURL,
+		Version:   "1",
+		AuthToken: "secret",
+	}
+}
+
+// testWatchWrapper returns a WatchWrapper holding a Health Check Watch.
+func testWatchWrapper() wrapper.WatchWrapper {
+	return wrapper.WatchWrapper{
+		Type:  "health_check",
+		Watch: health.Watch{URL: "https://example.com"},
+	}
+}
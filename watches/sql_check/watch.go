@@ -0,0 +1,613 @@
+/**
+ * Provides a Watch that runs an SQL query and checks its result.
+ *
+ * The database drivers are not registered by this package; programs that
+ * evaluate SQL Check Watches need to import the drivers that they support. Only
+ * the drivers listed in SupportedDrivers can be used.
+ */
+
+package msWatchSQLCheck
+
+import (
+	// Utilities.
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	// Internal dependencies.
+	actions "github.com/krystalcode/go-mantis-shrimp/actions/common"
+	util "github.com/krystalcode/go-mantis-shrimp/util"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Constants.
+ */
+
+// The operators that the result of the query can be compared with the expected
+// value with.
+const (
+	OperatorEqual          = "=="
+	OperatorNotEqual       = "!="
+	OperatorLess           = "<"
+	OperatorLessOrEqual    = "<="
+	OperatorGreater        = ">"
+	OperatorGreaterOrEqual = ">="
+)
+
+/**
+ * Public API.
+ */
+
+// SupportedDrivers holds the names of the "database/sql" drivers that SQL Check
+// Watches can use. A driver also needs to be registered by the program that
+// evaluates the Watch, otherwise Watches using it cannot be created.
+var SupportedDrivers = []string{"mysql", "postgres"}
+
+/**
+ * Types and their functions.
+ */
+
+// DB is an interface that is used to allow dependency injection of the database
+// handle that runs the Watch's query. Dependency injection is necessary for
+// testing purposes. It is implemented by sql.DB.
+type DB interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+// Watch implements the common.Watch interface. It provides a Watch that runs
+// the defined query and compares its result with the expected value. Its
+// evaluation of whether the included Actions will be executed depend on the
+// evaluation of its Conditions.
+type Watch struct {
+	// Common fields and functions for all Watches.
+	common.WatchBase
+
+	// The name of the "database/sql" driver that connects to the database; one
+	// of SupportedDrivers.
+	Driver string `json:"driver"`
+	// The Data Source Name that the driver connects to the database with. Its
+	// format depends on the driver. It may contain credentials; it is therefore
+	// not included in the context that Actions are triggered with.
+	// @I Avoid exposing the DSN of SQL Check Watches in API responses
+	DSN string `json:"dsn"`
+	// The query that will be run. It should return a single column; only the
+	// first row is taken into account.
+	Query string `json:"query"`
+	// The operator that the result is compared with the expected value with; one
+	// of "==", "!=", "<", "<=", ">" or ">=". Defaults to "==".
+	Operator string `json:"operator"`
+	// The value that the result is expected to have; either a number or a
+	// string. Numbers are compared numerically and strings lexicographically.
+	ExpectedValue interface{} `json:"expected_value"`
+	// How much to wait for the query to finish before considering it failed.
+	Timeout util.Duration `json:"timeout"`
+	// The Conditions that will evaluate the results to determine whether the
+	// Actions should be triggered or not.
+	Conditions []Condition `json:"conditions"`
+
+	// The database handle used to run the query.
+	db DB
+	// The result of the data operation.
+	result Result
+}
+
+// Do implements common.Watch.Do(). It prepares the Result of the Watch, it
+// evaluates the Conditions, and returns the IDs of the Actions that should be
+// triggered as a result of the Watch, if any.
+func (watch Watch) Do(ctx context.Context) []int {
+	actionsIDs, _ := watch.DoWithContext(ctx)
+	return actionsIDs
+}
+
+// DoWithContext implements common.ContextWatch.DoWithContext(). It does the
+// same as Do(), and it additionally returns the context that the Actions should
+// be triggered with i.e. the status of the Result and the value returned by the
+// query.
+func (watch Watch) DoWithContext(ctx context.Context) ([]int, actions.ActionContext) {
+	watch.data(ctx)
+	ok := watch.evaluate()
+	actionContext := watch.ActionContext(watch.result.Status, map[string]string{"value": watch.result.Value})
+
+	if !ok {
+		return []int{}, actionContext
+	}
+
+	// If all conditions pass, return the IDs of the Actions that should be
+	// triggered.
+	return watch.ActionsIDs, actionContext
+}
+
+// Replay implements common.ReplayableWatch.Replay(). It evaluates each of the
+// Watch's Conditions against the given JSON-encoded Result, without running the
+// Watch's query.
+func (watch Watch) Replay(jsonResult []byte) ([]bool, error) {
+	var result Result
+	err := json.Unmarshal(jsonResult, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]bool, len(watch.Conditions))
+	for index, condition := range watch.Conditions {
+		outcomes[index] = condition.Do(result)
+	}
+
+	return outcomes, nil
+}
+
+// SetDB allows to inject a database handle into the corresponding field.
+func (watch *Watch) SetDB(db DB) {
+	watch.db = db
+}
+
+// Runs the query defined in the Watch and determines the Result.
+func (watch *Watch) data(ctx context.Context) {
+	if watch.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, watch.Timeout.Duration)
+		defer cancel()
+	}
+
+	rows, err := watch.db.QueryContext(ctx, watch.Query)
+	if err != nil {
+		watch.result = Result{Status: "failure"}
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if rows.Err() != nil {
+			watch.result = Result{Status: "failure"}
+			return
+		}
+		watch.result = Result{Status: "no_rows"}
+		return
+	}
+
+	var value interface{}
+	err = rows.Scan(&value)
+	if err != nil {
+		watch.result = Result{Status: "failure"}
+		return
+	}
+
+	// Drivers may return text values as bytes.
+	if bytes, ok := value.([]byte); ok {
+		value = string(bytes)
+	}
+	sValue := fmt.Sprint(value)
+
+	if !watch.matches(value) {
+		watch.result = Result{Status: "value_mismatch", Value: sValue}
+		return
+	}
+
+	watch.result = Result{Status: "success", Value: sValue}
+}
+
+// matches returns whether the given value, as returned by the query, compares
+// successfully with the expected value using the Watch's operator. Values that
+// cannot be compared, such as a string that is not a number when a number is
+// expected, do not match.
+func (watch *Watch) matches(value interface{}) bool {
+	var comparison int
+
+	switch expected := watch.ExpectedValue.(type) {
+	case float64:
+		actual, err := toFloat(value)
+		if err != nil {
+			return false
+		}
+		switch {
+		case actual < expected:
+			comparison = -1
+		case actual > expected:
+			comparison = 1
+		}
+	case string:
+		actual := fmt.Sprint(value)
+		switch {
+		case actual < expected:
+			comparison = -1
+		case actual > expected:
+			comparison = 1
+		}
+	default:
+		return false
+	}
+
+	switch watch.operator() {
+	case OperatorEqual:
+		return comparison == 0
+	case OperatorNotEqual:
+		return comparison != 0
+	case OperatorLess:
+		return comparison < 0
+	case OperatorLessOrEqual:
+		return comparison <= 0
+	case OperatorGreater:
+		return comparison > 0
+	case OperatorGreaterOrEqual:
+		return comparison >= 0
+	}
+
+	return false
+}
+
+// operator returns the operator that the result is compared with.
+func (watch *Watch) operator() string {
+	if watch.Operator == "" {
+		return OperatorEqual
+	}
+
+	return watch.Operator
+}
+
+// Go through all Conditions defined in the Watch and evaluate them. The
+// Conditions are successful in their entirety when all Conditions evaluate
+// successfully.
+func (watch *Watch) evaluate() bool {
+	allOk := true
+	for _, condition := range watch.Conditions {
+		ok := condition.Do(watch.result)
+		if !ok {
+			allOk = false
+			break
+		}
+	}
+
+	return allOk
+}
+
+// Result holds the result of an SQL check. Its status is a string that can hold
+// one of the following values:
+// - success
+// - value_mismatch
+// - no_rows
+// - failure (the query could not be run, including when it timed out)
+// It also holds the value returned by the query, if any.
+type Result struct {
+	Status string `json:"status"`
+	Value  string `json:"value,omitempty"`
+}
+
+// Condition is an interface that should be implemented by all Condition types
+// for the SQL Check Watch. It simply defines a function that, given the Result
+// of an SQL Check operation, it decides whether the Condition is met.
+type Condition interface {
+	Do(Result) bool
+}
+
+// ConditionQueryMatches implements the Condition interface, providing a
+// Condition that is met when the query returns a value that compares
+// successfully with the expected value ("success").
+type ConditionQueryMatches struct{}
+
+// Do implements Condition.Do(), determining whether the query returned the
+// expected value.
+func (condition ConditionQueryMatches) Do(result Result) bool {
+	return result.Status == "success"
+}
+
+// ConditionQueryFails implements the Condition interface, providing a Condition
+// that is met when the query fails, returns no rows or returns a value that
+// does not compare successfully with the expected value (any other result apart
+// from "success").
+type ConditionQueryFails struct{}
+
+// Do implements Condition.Do(), determining whether the query did not return
+// the expected value.
+func (condition ConditionQueryFails) Do(result Result) bool {
+	return result.Status != "success"
+}
+
+/**
+ * JSON.
+ */
+
+// MarshalJSON encodes a ConditionQueryMatches object into a JSON object that
+// contains a single field, indicating its type. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionQueryMatches) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"query_matches"}`), nil
+}
+
+// MarshalJSON encodes a ConditionQueryFails object into a JSON object that
+// contains a single field, indicating its type. This is desired so that a
+// JSON-encoded Watch object containing such a Condition can be then decoded
+// based on the Condition type.
+func (condition ConditionQueryFails) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"query_fails"}`), nil
+}
+
+// UnmarshalJSON provides decoding of a JSON-encoded Watch object so that the
+// Conditions held in the "conditions" field are properly constructed based on
+// their type.
+func (watch *Watch) UnmarshalJSON(bytes []byte) error {
+	// Deserialize everything into a map of json.RawMessage; its indices would
+	// correspond to the Watch struct's fields.
+	var jsonMap map[string]*json.RawMessage
+	err := json.Unmarshal(bytes, &jsonMap)
+	if err != nil {
+		return err
+	}
+
+	// Decode all other fields first.
+	if jsonMap["name"] != nil {
+		var name string
+		err = json.Unmarshal(*jsonMap["name"], &name)
+		if err != nil {
+			return err
+		}
+		watch.Name = name
+	}
+	if jsonMap["actions_ids"] != nil {
+		var actionsIds []int
+		err = json.Unmarshal(*jsonMap["actions_ids"], &actionsIds)
+		if err != nil {
+			return err
+		}
+		watch.ActionsIDs = actionsIds
+	}
+	if jsonMap["created_at"] != nil {
+		var createdAt *time.Time
+		err = json.Unmarshal(*jsonMap["created_at"], &createdAt)
+		if err != nil {
+			return err
+		}
+		watch.CreatedAt = createdAt
+	}
+	if jsonMap["updated_at"] != nil {
+		var updatedAt *time.Time
+		err = json.Unmarshal(*jsonMap["updated_at"], &updatedAt)
+		if err != nil {
+			return err
+		}
+		watch.UpdatedAt = updatedAt
+	}
+	if jsonMap["singleton"] != nil {
+		var singleton bool
+		err = json.Unmarshal(*jsonMap["singleton"], &singleton)
+		if err != nil {
+			return err
+		}
+		watch.Singleton = singleton
+	}
+	if jsonMap["warning_actions_ids"] != nil {
+		var warningActionsIDs []int
+		err = json.Unmarshal(*jsonMap["warning_actions_ids"], &warningActionsIDs)
+		if err != nil {
+			return err
+		}
+		watch.WarningActionsIDs = warningActionsIDs
+	}
+	if jsonMap["actions_priorities"] != nil {
+		var actionsPriorities map[int]int
+		err = json.Unmarshal(*jsonMap["actions_priorities"], &actionsPriorities)
+		if err != nil {
+			return err
+		}
+		watch.ActionsPriorities = actionsPriorities
+	}
+	if jsonMap["stop_on_action_failure"] != nil {
+		var stopOnActionFailure bool
+		err = json.Unmarshal(*jsonMap["stop_on_action_failure"], &stopOnActionFailure)
+		if err != nil {
+			return err
+		}
+		watch.StopOnActionFailure = stopOnActionFailure
+	}
+	if jsonMap["driver"] != nil {
+		var driver string
+		err = json.Unmarshal(*jsonMap["driver"], &driver)
+		if err != nil {
+			return err
+		}
+		watch.Driver = driver
+	}
+	if jsonMap["dsn"] != nil {
+		var dsn string
+		err = json.Unmarshal(*jsonMap["dsn"], &dsn)
+		if err != nil {
+			return err
+		}
+		watch.DSN = dsn
+	}
+	if jsonMap["query"] != nil {
+		var query string
+		err = json.Unmarshal(*jsonMap["query"], &query)
+		if err != nil {
+			return err
+		}
+		watch.Query = query
+	}
+	if jsonMap["operator"] != nil {
+		var operator string
+		err = json.Unmarshal(*jsonMap["operator"], &operator)
+		if err != nil {
+			return err
+		}
+		watch.Operator = operator
+	}
+	if jsonMap["expected_value"] != nil {
+		var expectedValue interface{}
+		err = json.Unmarshal(*jsonMap["expected_value"], &expectedValue)
+		if err != nil {
+			return err
+		}
+		watch.ExpectedValue = expectedValue
+	}
+	if jsonMap["timeout"] != nil {
+		var timeout util.Duration
+		err = json.Unmarshal(*jsonMap["timeout"], &timeout)
+		if err != nil {
+			return err
+		}
+		watch.Timeout = timeout
+	}
+
+	// If no conditions are given, there's nothing to do; return or we'll get an
+	// error.
+	if jsonMap["conditions"] == nil {
+		return nil
+	}
+
+	var rawConditions []*json.RawMessage
+	err = json.Unmarshal(*jsonMap["conditions"], &rawConditions)
+	if err != nil {
+		return err
+	}
+
+	// Create a slice of the right size that will hold the Conditions.
+	watch.Conditions = make([]Condition, len(rawConditions))
+
+	// Decode the Conditions from their JSON structure and put them in the
+	// corresponding field slice.
+	for index, rawCondition := range rawConditions {
+		var conditionInnerJSON map[string]*json.RawMessage
+		err = json.Unmarshal(*rawCondition, &conditionInnerJSON)
+		if err != nil {
+			return err
+		}
+
+		// Get the type of the Condition.
+		if conditionInnerJSON["type"] == nil {
+			return fmt.Errorf("a Condition was given without its type")
+		}
+		var conditionType string
+		err = json.Unmarshal(*conditionInnerJSON["type"], &conditionType)
+		if err != nil {
+			return err
+		}
+
+		switch conditionType {
+		case "query_matches":
+			watch.Conditions[index] = ConditionQueryMatches{}
+		case "query_fails":
+			watch.Conditions[index] = ConditionQueryFails{}
+		default:
+			return fmt.Errorf("unknown Condition type \"%s\"", conditionType)
+		}
+	}
+
+	return nil
+}
+
+// NewSQLCheckWatch implements the WatchFactory function type. It creates an SQL
+// Check Watch based on the given JSON-object, and initializes it by injecting a
+// handle to the Watch's database. Handles are shared by all Watches that use
+// the same driver and DSN.
+var NewSQLCheckWatch = func(jsonWatch *json.RawMessage) (common.Watch, error) {
+	// Create a Watch object from JSON.
+	var watch Watch
+	err := json.Unmarshal(*jsonWatch, &watch)
+	if err != nil {
+		return nil, err
+	}
+
+	if watch.DSN == "" || watch.Query == "" {
+		return nil, fmt.Errorf("an SQL Check Watch requires a DSN and a query")
+	}
+	switch watch.ExpectedValue.(type) {
+	case float64, string:
+	default:
+		return nil, fmt.Errorf("the expected value of an SQL Check Watch must be a number or a string")
+	}
+	switch watch.operator() {
+	case OperatorEqual, OperatorNotEqual, OperatorLess, OperatorLessOrEqual, OperatorGreater, OperatorGreaterOrEqual:
+	default:
+		return nil, fmt.Errorf("unknown operator \"%s\"", watch.Operator)
+	}
+
+	db, err := open(watch.Driver, watch.DSN)
+	if err != nil {
+		return nil, err
+	}
+	watch.SetDB(db)
+
+	return watch, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// databases holds the database handles opened so far, keyed by driver and DSN.
+// Handles maintain their own pool of connections and they are meant to be
+// long-lived; Watches are created every time they are loaded from storage,
+// and opening a new handle every time would leak connections.
+var databases = struct {
+	mutex   sync.Mutex
+	handles map[string]*sql.DB
+}{handles: make(map[string]*sql.DB)}
+
+// open returns a handle to the database with the given DSN, using the given
+// driver. The driver has to be supported and registered.
+func open(driver string, dsn string) (*sql.DB, error) {
+	if !isSupported(driver) {
+		return nil, fmt.Errorf("unsupported SQL driver \"%s\"; supported drivers are %v", driver, SupportedDrivers)
+	}
+	if !isRegistered(driver) {
+		return nil, fmt.Errorf("the SQL driver \"%s\" is not registered", driver)
+	}
+
+	databases.mutex.Lock()
+	defer databases.mutex.Unlock()
+
+	key := driver + "\x00" + dsn
+	if db, ok := databases.handles[key]; ok {
+		return db, nil
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		// Errors may include the DSN, which may contain credentials.
+		return nil, fmt.Errorf("failed to open a connection to the database using the SQL driver \"%s\"", driver)
+	}
+	databases.handles[key] = db
+
+	return db, nil
+}
+
+// isSupported returns whether the given driver is one of the supported ones.
+func isSupported(driver string) bool {
+	for _, supportedDriver := range SupportedDrivers {
+		if driver == supportedDriver {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isRegistered returns whether the given driver has been registered with the
+// "database/sql" package.
+func isRegistered(driver string) bool {
+	for _, registeredDriver := range sql.Drivers() {
+		if driver == registeredDriver {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toFloat converts a value returned by a query into a number.
+func toFloat(value interface{}) (float64, error) {
+	switch typedValue := value.(type) {
+	case int64:
+		return float64(typedValue), nil
+	case float64:
+		return typedValue, nil
+	case string:
+		return strconv.ParseFloat(typedValue, 64)
+	}
+
+	return 0, fmt.Errorf("the value \"%v\" is not a number", value)
+}
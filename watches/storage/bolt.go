@@ -0,0 +1,423 @@
+/**
+ * Provides a BoltDB storage adapter for storing and retrieving Watches.
+ *
+ * It stores Watches in a file on the local filesystem, and it is intended for
+ * single-node deployments where running a Redis server is not necessary.
+ */
+
+package msWatchStorage
+
+import (
+	// Utilities
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// BoltDB.
+	bolt "go.etcd.io/bbolt"
+
+	// Internal dependencies.
+	boltUtil "github.com/krystalcode/go-mantis-shrimp/util/bolt"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	wrapper "github.com/krystalcode/go-mantis-shrimp/watches/wrapper"
+)
+
+/**
+ * Constants.
+ */
+
+// boltWatchesBucket holds the name of the bucket that Watches are stored in,
+// keyed by their IDs.
+var boltWatchesBucket = []byte("watches")
+
+// boltSettingsBucket holds the name of the bucket that settings applying to all
+// Watches are stored in, such as whether triggering Watches is paused.
+var boltSettingsBucket = []byte("watch_settings")
+
+// boltPausedKey holds the key that is set in the settings bucket while
+// triggering Watches is paused.
+var boltPausedKey = []byte("paused")
+
+// boltResultsBucket holds the name of the bucket that the history of the
+// Results of each Watch is stored in, keyed by the IDs of the Watches. The
+// history is stored as a JSON array, most recent Result first.
+var boltResultsBucket = []byte("watch_results")
+
+/**
+ * Bolt storage provider.
+ */
+
+// Bolt implements the Storage interface, allowing to use BoltDB as a Storage
+// engine.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// Make sure that the Bolt storage engine conforms to the Storage and the
+// ResultStore interfaces.
+var _ Storage = Bolt{}
+var _ ResultStore = Bolt{}
+
+// Create implements Storage.Create(). It stores the given Watch object in the
+// Bolt Storage and it returns an automatically generated ID.
+func (storage Bolt) Create(watchPointer *common.Watch) (*int, error) {
+	err := setCreatedAt(watchPointer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate the ID and store the Watch in the same transaction, so that no
+	// ID is used up if the Watch cannot be stored.
+	var watchID int
+	err = storage.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWatchesBucket)
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		watchID = int(sequence)
+
+		return storage.set(bucket, watchID, watchPointer)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &watchID, nil
+}
+
+// CreateWithID implements Storage.CreateWithID(). It stores the given Watch
+// object with the given ID in the Bolt Storage, and it raises the sequence that
+// IDs are generated from to the given ID if it is lower, in the same
+// transaction, so that Watches created afterwards do not get the same ID.
+func (storage Bolt) CreateWithID(watchID int, watchPointer *common.Watch) error {
+	err := setCreatedAt(watchPointer)
+	if err != nil {
+		return err
+	}
+
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWatchesBucket)
+		if bucket.Sequence() < uint64(watchID) {
+			err := bucket.SetSequence(uint64(watchID))
+			if err != nil {
+				return err
+			}
+		}
+
+		return storage.set(bucket, watchID, watchPointer)
+	})
+}
+
+// Get implements Storage.Get(). It retrieves from Storage and returns the Watch
+// for the given ID, or ErrNotFound if there is no Watch with such ID.
+func (storage Bolt) Get(id int) (*common.Watch, error) {
+	var jsonWatch []byte
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltWatchesBucket).Get(boltUtil.Key(id))
+		if value == nil {
+			return ErrNotFound
+		}
+
+		// Values are only valid during the transaction.
+		jsonWatch = append([]byte{}, value...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	watch, err := wrapper.Create(jsonWatch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &watch, nil
+}
+
+// Exists implements Storage.Exists(). It returns whether a Watch with the
+// given ID exists in the Storage, without loading it.
+func (storage Bolt) Exists(id int) (bool, error) {
+	exists := false
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(boltWatchesBucket).Get(boltUtil.Key(id)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Update implements Storage.Update(). It stores the given Watch object in the
+// Bolt Storage, overriding the existing value with the given ID.
+func (storage Bolt) Update(watchID int, watchPointer *common.Watch) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		return storage.set(tx.Bucket(boltWatchesBucket), watchID, watchPointer)
+	})
+}
+
+// Paused implements Storage.Paused(). It returns whether triggering Watches is
+// paused, that is whether the corresponding key is set.
+func (storage Bolt) Paused() (bool, error) {
+	paused := false
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		paused = tx.Bucket(boltSettingsBucket).Get(boltPausedKey) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return paused, nil
+}
+
+// SetPaused implements Storage.SetPaused(). It pauses triggering Watches by
+// setting the corresponding key, or it resumes it by deleting the key.
+func (storage Bolt) SetPaused(paused bool) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSettingsBucket)
+		if !paused {
+			return bucket.Delete(boltPausedKey)
+		}
+
+		return bucket.Put(boltPausedKey, []byte("1"))
+	})
+}
+
+// Ping implements Storage.Ping(). It checks whether the database is still open
+// by starting a read-only transaction.
+func (storage Bolt) Ping() error {
+	return storage.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// List implements Storage.List(). It retrieves from Storage and returns up to
+// the given number of Watches (limit), starting from the given position in the
+// order of their IDs (offset). Watches that cannot be loaded, such as when their
+// stored value is corrupted, do not abort the listing; they are skipped and the
+// corresponding errors are returned in the second slice.
+func (storage Bolt) List(offset int, limit int) ([]*common.Watch, []error, error) {
+	if limit < 1 {
+		return []*common.Watch{}, nil, nil
+	}
+
+	jsonWatches := map[int][]byte{}
+	var watchesIDs []int
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltWatchesBucket).Cursor()
+		position := 0
+		for key, value := cursor.First(); key != nil && len(watchesIDs) < limit; key, value = cursor.Next() {
+			if position < offset {
+				position++
+				continue
+			}
+
+			watchID := boltUtil.ID(key)
+			watchesIDs = append(watchesIDs, watchID)
+			jsonWatches[watchID] = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watches := make([]*common.Watch, 0, len(watchesIDs))
+	var errs []error
+	for _, watchID := range watchesIDs {
+		watch, err := wrapper.Create(jsonWatches[watchID])
+		if err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("failed to load the Watch with ID \"%d\": %s", watchID, err.Error()),
+			)
+			continue
+		}
+
+		watches = append(watches, &watch)
+	}
+
+	return watches, errs, nil
+}
+
+// ListSince implements Storage.ListSince(). It retrieves from Storage and
+// returns up to the given number of Watches (limit) with IDs greater than the
+// given ID (since), in the order of their IDs, seeking directly to the first of
+// them. It also returns the ID to be given as the cursor for the next page, or 0
+// if there are no more Watches. Watches that cannot be loaded are handled the
+// same way as by List().
+func (storage Bolt) ListSince(since int, limit int) ([]*common.Watch, int, []error, error) {
+	if limit < 1 {
+		return []*common.Watch{}, 0, nil, nil
+	}
+
+	jsonWatches := map[int][]byte{}
+	var watchesIDs []int
+	more := false
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltWatchesBucket).Cursor()
+		for key, value := cursor.Seek(boltUtil.Key(since + 1)); key != nil; key, value = cursor.Next() {
+			if len(watchesIDs) == limit {
+				more = true
+				break
+			}
+
+			watchID := boltUtil.ID(key)
+			watchesIDs = append(watchesIDs, watchID)
+			jsonWatches[watchID] = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	watches := make([]*common.Watch, 0, len(watchesIDs))
+	var errs []error
+	for _, watchID := range watchesIDs {
+		watch, err := wrapper.Create(jsonWatches[watchID])
+		if err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("failed to load the Watch with ID \"%d\": %s", watchID, err.Error()),
+			)
+			continue
+		}
+
+		watches = append(watches, &watch)
+	}
+
+	next := 0
+	if more {
+		next = watchesIDs[len(watchesIDs)-1]
+	}
+
+	return watches, next, errs, nil
+}
+
+// AddResult implements ResultStore.AddResult(). It adds the given Result at the
+// start of the history of the Watch's Results, and it drops the oldest Results
+// that exceed the given length, in the same transaction.
+func (storage Bolt) AddResult(result Result, length int) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltResultsBucket)
+		key := boltUtil.Key(result.WatchID)
+
+		results, err := boltResults(result.WatchID, bucket.Get(key))
+		if err != nil {
+			return err
+		}
+		results = append([]Result{result}, results...)
+		if len(results) > length {
+			results = results[:length]
+		}
+
+		jsonResults, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(key, jsonResults)
+	})
+}
+
+// Results implements ResultStore.Results(). It retrieves up to the given number
+// of the most recent Results of the Watch with the given ID.
+func (storage Bolt) Results(watchID int, limit int) ([]Result, error) {
+	var results []Result
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		var err error
+		results, err = boltResults(watchID, tx.Bucket(boltResultsBucket).Get(boltUtil.Key(watchID)))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if limit < 1 {
+		return []Result{}, nil
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// set stores a Watch object in the given bucket at the key corresponding to the
+// given ID.
+func (storage Bolt) set(bucket *bolt.Bucket, watchID int, watchPointer *common.Watch) error {
+	// Update the UpdatedAt field.
+	base, err := common.Base(*watchPointer)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	base.UpdatedAt = &now
+	err = common.SetBase(watchPointer, *base)
+	if err != nil {
+		return err
+	}
+
+	// We'll be storing a WatchWrapper which contains the Watch type as well.
+	watchWrapper, err := wrapper.Wrapper(*watchPointer)
+	if err != nil {
+		return err
+	}
+	jsonWatch, err := json.Marshal(watchWrapper)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(boltUtil.Key(watchID), jsonWatch)
+}
+
+// NewBoltStorage implements the StorageFactory function type. It opens the Bolt
+// database stored at the file defined in the given configuration, and it
+// returns the Storage engine object. The Storage engine can be shared by
+// concurrent requests.
+var NewBoltStorage = func(config map[string]interface{}) (Storage, error) {
+	db, err := boltUtil.Open(config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = boltUtil.CreateBucket(db, boltWatchesBucket)
+	if err != nil {
+		return nil, err
+	}
+	err = boltUtil.CreateBucket(db, boltSettingsBucket)
+	if err != nil {
+		return nil, err
+	}
+	err = boltUtil.CreateBucket(db, boltResultsBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return Bolt{db: db}, nil
+}
+
+/**
+ * For internal use.
+ */
+
+// boltResults converts the JSON value stored for the history of the Results of
+// the Watch with the given ID into Result objects. There are no Results when no
+// value is stored.
+func boltResults(watchID int, value []byte) ([]Result, error) {
+	results := []Result{}
+	if value == nil {
+		return results, nil
+	}
+
+	err := json.Unmarshal(value, &results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the Results of the Watch with ID \"%d\": %s", watchID, err.Error())
+	}
+
+	return results, nil
+}
@@ -0,0 +1,235 @@
+/**
+ * Tests for the Bolt storage engine of the msWatchStorage module.
+ */
+
+package msWatchStorage
+
+import (
+	// Utilities.
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	// BoltDB.
+	bolt "go.etcd.io/bbolt"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	boltUtil "github.com/krystalcode/go-mantis-shrimp/util/bolt"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
+)
+
+// testBoltStorage creates a Bolt Storage engine stored in a new temporary file.
+// It returns a function that removes the file.
+func testBoltStorage(t *testing.T) (Bolt, func()) {
+	dir, err := ioutil.TempDir("", "ms_watch_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := Create(map[string]interface{}{
+		"type": "bolt",
+		"path": filepath.Join(dir, "watches.db"),
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return storage.(Bolt), func() { os.RemoveAll(dir) }
+}
+
+/**
+ * Tests.
+ */
+
+func TestNewBoltStorage_MissingPath(t *testing.T) {
+	_, err := Create(map[string]interface{}{"type": "bolt"})
+	assert.NotNil(t, err)
+}
+
+func TestBolt_CRUD(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	assert.Nil(t, storage.Ping())
+
+	// Create.
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *watchID)
+	watch = testWatch()
+	otherWatchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *otherWatchID)
+
+	// Get.
+	stored, err := storage.Get(*watchID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", (*stored).(health.Watch).URL)
+	base, err := common.Base(*stored)
+	assert.Nil(t, err)
+	assert.NotNil(t, base.CreatedAt)
+	assert.NotNil(t, base.UpdatedAt)
+
+	// Exists.
+	exists, err := storage.Exists(*watchID)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = storage.Exists(3)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	// Update.
+	healthWatch := (*stored).(health.Watch)
+	healthWatch.URL = "https://example.org"
+	watch = healthWatch
+	err = storage.Update(*watchID, &watch)
+	assert.Nil(t, err)
+	stored, err = storage.Get(*watchID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.org", (*stored).(health.Watch).URL)
+
+	// Not found.
+	_, err = storage.Get(3)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestBolt_CreateWithID(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	watch := testWatch()
+	err := storage.CreateWithID(5, &watch)
+	assert.Nil(t, err)
+	stored, err := storage.Get(5)
+	assert.Nil(t, err)
+	base, err := common.Base(*stored)
+	assert.Nil(t, err)
+	assert.NotNil(t, base.CreatedAt)
+
+	// IDs generated afterwards follow the given ID, and lower IDs do not lower
+	// the sequence.
+	watch = testWatch()
+	err = storage.CreateWithID(3, &watch)
+	assert.Nil(t, err)
+	watch = testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, *watchID)
+
+	watches, _, err := storage.List(0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 3)
+}
+
+func TestBolt_List(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		watch := testWatch()
+		_, err := storage.Create(&watch)
+		assert.Nil(t, err)
+	}
+
+	// Corrupt the value of the third Watch.
+	err := storage.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltWatchesBucket).Put(boltUtil.Key(3), []byte("{"))
+	})
+	assert.Nil(t, err)
+
+	watches, errs, err := storage.List(1, 3)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 2)
+	assert.Len(t, errs, 1)
+
+	watches, errs, err = storage.List(4, 10)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 1)
+	assert.Len(t, errs, 0)
+
+	watches, _, err = storage.List(0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 0)
+}
+
+func TestBolt_ListSince(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	testListSince(t, storage)
+
+	// Corrupt the value of the second Watch; it is reported and skipped.
+	err := storage.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltWatchesBucket).Put(boltUtil.Key(2), []byte("{"))
+	})
+	assert.Nil(t, err)
+
+	watches, next, errs, err := storage.ListSince(0, 3)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 2)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, 3, next)
+}
+
+func TestBolt_Paused(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	paused, err := storage.Paused()
+	assert.Nil(t, err)
+	assert.False(t, paused)
+
+	assert.Nil(t, storage.SetPaused(true))
+	paused, err = storage.Paused()
+	assert.Nil(t, err)
+	assert.True(t, paused)
+
+	assert.Nil(t, storage.SetPaused(false))
+	paused, err = storage.Paused()
+	assert.Nil(t, err)
+	assert.False(t, paused)
+}
+
+func TestBolt_Results(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	testResultStore(t, storage)
+}
+
+func TestBolt_Persistence(t *testing.T) {
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+
+	// Reopen the file as a separate program would.
+	path := storage.db.Path()
+	err = storage.db.Close()
+	assert.Nil(t, err)
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	reopened := Bolt{db: db}
+	exists, err := reopened.Exists(*watchID)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	// The sequence continues from the last ID.
+	watch = testWatch()
+	newWatchID, err := reopened.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, *watchID+1, *newWatchID)
+}
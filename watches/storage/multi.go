@@ -0,0 +1,254 @@
+/**
+ * Provides a storage adapter that stores Watches in multiple Storage engines at
+ * the same time.
+ *
+ * It is intended for migrating from one Storage engine to another, or for
+ * keeping a copy of the Watches in a more durable Storage engine than the one
+ * used for serving them.
+ */
+
+package msWatchStorage
+
+import (
+	// Utilities.
+	"fmt"
+	"strings"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+)
+
+/**
+ * Multi storage provider.
+ */
+
+// Multi implements the Storage and the ResultStore interfaces by wrapping an
+// ordered list of Storage engines. Writes are made to all of them, in order,
+// while reads are made from the first one only, the primary.
+//
+// The configuration holds the configuration of each wrapped Storage engine in
+// the "storages" array, e.g.
+//
+//	{"type":"multi","storages":[{"type":"redis","dsn":"redis:6379"},{"type":"bolt","path":"/var/lib/mantis-shrimp/watches.db"}]}
+type Multi struct {
+	storages []Storage
+	types    []string
+}
+
+// Make sure that the Multi storage engine conforms to the Storage and the
+// ResultStore interfaces.
+var _ Storage = Multi{}
+var _ ResultStore = Multi{}
+
+// MultiWriteError is returned by the Multi storage engine when a write fails in
+// some of the wrapped Storage engines, after it has been made to the primary.
+// The write is not rolled back in the Storage engines where it succeeded.
+type MultiWriteError struct {
+	Failures []MultiWriteFailure
+}
+
+// MultiWriteFailure holds the error returned by one of the Storage engines
+// wrapped by the Multi storage engine, together with its position in the
+// configuration, starting from 0 for the primary, and its type.
+type MultiWriteFailure struct {
+	Position int
+	Type     string
+	Err      error
+}
+
+// Error implements the error interface. It lists the Storage engines that
+// failed together with their errors.
+func (err MultiWriteError) Error() string {
+	failures := make([]string, len(err.Failures))
+	for index, failure := range err.Failures {
+		failures[index] = fmt.Sprintf(
+			"the \"%s\" Storage at position %d failed: %s",
+			failure.Type,
+			failure.Position,
+			failure.Err.Error(),
+		)
+	}
+
+	return "failed to write to all Storage engines; " + strings.Join(failures, "; ")
+}
+
+// Create implements Storage.Create(). It creates the Watch in the primary
+// Storage engine, which generates its ID, and it then creates it with the same
+// ID in the other Storage engines. The other Storage engines index the Watch and
+// keep track of its ID as well, so that any of them can become the primary. If
+// creating it in any of the other Storage engines fails, the ID is returned
+// together with a MultiWriteError.
+func (storage Multi) Create(watchPointer *common.Watch) (*int, error) {
+	watchID, err := storage.storages[0].Create(watchPointer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.secondaries(func(secondary Storage) error {
+		return secondary.CreateWithID(*watchID, watchPointer)
+	})
+	if err != nil {
+		return watchID, err
+	}
+
+	return watchID, nil
+}
+
+// CreateWithID implements Storage.CreateWithID(). It creates the Watch with the
+// given ID in all Storage engines, in order.
+func (storage Multi) CreateWithID(watchID int, watchPointer *common.Watch) error {
+	return storage.all(func(child Storage) error {
+		return child.CreateWithID(watchID, watchPointer)
+	})
+}
+
+// Get implements Storage.Get(). It retrieves the Watch from the primary Storage
+// engine.
+func (storage Multi) Get(id int) (*common.Watch, error) {
+	return storage.storages[0].Get(id)
+}
+
+// Exists implements Storage.Exists(). It checks whether the Watch exists in the
+// primary Storage engine.
+func (storage Multi) Exists(id int) (bool, error) {
+	return storage.storages[0].Exists(id)
+}
+
+// Update implements Storage.Update(). It stores the Watch in all Storage
+// engines, in order.
+func (storage Multi) Update(watchID int, watchPointer *common.Watch) error {
+	return storage.all(func(child Storage) error {
+		return child.Update(watchID, watchPointer)
+	})
+}
+
+// List implements Storage.List(). It lists the Watches stored in the primary
+// Storage engine.
+func (storage Multi) List(offset int, limit int) ([]*common.Watch, []error, error) {
+	return storage.storages[0].List(offset, limit)
+}
+
+// ListSince implements Storage.ListSince(). It lists the Watches stored in the
+// primary Storage engine after the given cursor.
+func (storage Multi) ListSince(since int, limit int) ([]*common.Watch, int, []error, error) {
+	return storage.storages[0].ListSince(since, limit)
+}
+
+// Paused implements Storage.Paused(). It returns whether triggering Watches is
+// paused according to the primary Storage engine.
+func (storage Multi) Paused() (bool, error) {
+	return storage.storages[0].Paused()
+}
+
+// SetPaused implements Storage.SetPaused(). It pauses or resumes triggering
+// Watches in all Storage engines, in order.
+func (storage Multi) SetPaused(paused bool) error {
+	return storage.all(func(child Storage) error {
+		return child.SetPaused(paused)
+	})
+}
+
+// Ping implements Storage.Ping(). It checks whether all Storage engines are
+// available, since writes fail when any of them is not.
+func (storage Multi) Ping() error {
+	for position, child := range storage.storages {
+		err := child.Ping()
+		if err != nil {
+			return fmt.Errorf(
+				"the \"%s\" Storage at position %d is not available: %s",
+				storage.types[position],
+				position,
+				err.Error(),
+			)
+		}
+	}
+
+	return nil
+}
+
+// AddResult implements ResultStore.AddResult(). It adds the Result to the
+// history kept in all Storage engines, in order.
+func (storage Multi) AddResult(result Result, length int) error {
+	return storage.all(func(child Storage) error {
+		return child.(ResultStore).AddResult(result, length)
+	})
+}
+
+// Results implements ResultStore.Results(). It retrieves the Results from the
+// history kept in the primary Storage engine.
+func (storage Multi) Results(watchID int, limit int) ([]Result, error) {
+	return storage.storages[0].(ResultStore).Results(watchID, limit)
+}
+
+// all makes the given write to all Storage engines, in order. If the write to
+// the primary fails, it is not made to the others and its error is returned as
+// it is. Otherwise, it is made to every other Storage engine and any failures
+// are returned together as a MultiWriteError.
+func (storage Multi) all(write func(Storage) error) error {
+	err := write(storage.storages[0])
+	if err != nil {
+		return err
+	}
+
+	return storage.secondaries(write)
+}
+
+// secondaries makes the given write to all Storage engines other than the
+// primary, in order, and it returns any failures together as a
+// MultiWriteError.
+func (storage Multi) secondaries(write func(Storage) error) error {
+	var failures []MultiWriteFailure
+	for position := 1; position < len(storage.storages); position++ {
+		err := write(storage.storages[position])
+		if err != nil {
+			failures = append(failures, MultiWriteFailure{
+				Position: position,
+				Type:     storage.types[position],
+				Err:      err,
+			})
+		}
+	}
+	if len(failures) != 0 {
+		return MultiWriteError{Failures: failures}
+	}
+
+	return nil
+}
+
+// NewMultiStorage implements the StorageFactory function type. It creates each
+// of the Storage engines given in the "storages" array of the configuration, in
+// order, and it returns the Storage engine object that wraps them. It is
+// declared as a function rather than as a variable, unlike the other factories,
+// since it creates the wrapped Storage engines via Create().
+func NewMultiStorage(config map[string]interface{}) (Storage, error) {
+	configs, ok := config["storages"].([]interface{})
+	if !ok || len(configs) == 0 {
+		return nil, fmt.Errorf("the \"storages\" configuration option is required for the \"multi\" Storage engine: %w", errorsUtil.ErrInvalidConfig)
+	}
+
+	storage := Multi{}
+	for position, childConfig := range configs {
+		childConfigMap, ok := childConfig.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the configuration of the Storage at position %d is not an object: %w", position, errorsUtil.ErrInvalidConfig)
+		}
+
+		child, err := Create(childConfigMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the Storage at position %d: %w", position, err)
+		}
+		if _, ok := child.(ResultStore); !ok {
+			return nil, fmt.Errorf("the Storage at position %d cannot keep the history of the Results of the Watches", position)
+		}
+
+		storage.storages = append(storage.storages, child)
+		storage.types = append(storage.types, childConfigMap["type"].(string))
+	}
+
+	return storage, nil
+}
+
+// Make sure that the Multi storage engine factory conforms to the
+// StorageFactory function type.
+var _ StorageFactory = NewMultiStorage
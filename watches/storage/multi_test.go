@@ -0,0 +1,238 @@
+/**
+ * Tests for the Multi storage engine of the msWatchStorage module.
+ */
+
+package msWatchStorage
+
+import (
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
+)
+
+// testMultiStorage creates a Multi Storage engine that wraps the given Storage
+// engines, registered for the duration of the test under the "memory" type.
+func testMultiStorage(t *testing.T, children ...Storage) (Storage, func()) {
+	next := 0
+	RegisterStorageFactory("memory", func(config map[string]interface{}) (Storage, error) {
+		child := children[next]
+		next++
+		return child, nil
+	})
+	cleanup := func() {
+		storageFactoriesMutex.Lock()
+		defer storageFactoriesMutex.Unlock()
+		delete(storageFactories, "memory")
+	}
+
+	configs := make([]interface{}, len(children))
+	for index := range children {
+		configs[index] = map[string]interface{}{"type": "memory"}
+	}
+	storage, err := NewMultiStorage(map[string]interface{}{"type": "multi", "storages": configs})
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return storage, cleanup
+}
+
+/**
+ * Tests.
+ */
+
+func TestNewMultiStorage_InvalidConfig(t *testing.T) {
+	configs := []map[string]interface{}{
+		{"type": "multi"},
+		{"type": "multi", "storages": []interface{}{}},
+		{"type": "multi", "storages": []interface{}{"redis"}},
+		{"type": "multi", "storages": []interface{}{map[string]interface{}{"type": "unknown"}}},
+	}
+	for index, config := range configs {
+		_, err := NewMultiStorage(config)
+		assert.NotNil(t, err, "case %d", index)
+	}
+}
+
+func TestMulti_Writes(t *testing.T) {
+	primary := Redis{client: newTestRedisClient()}
+	secondary := Redis{client: newTestRedisClient()}
+	storage, cleanup := testMultiStorage(t, primary, secondary)
+	defer cleanup()
+
+	// Created in both, with the ID generated by the primary.
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	for _, child := range []Storage{primary, secondary} {
+		stored, err := child.Get(*watchID)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://example.com", (*stored).(health.Watch).URL)
+	}
+
+	// Updated in both.
+	watch = testWatch()
+	healthWatch := watch.(health.Watch)
+	healthWatch.URL = "https://example.org"
+	watch = healthWatch
+	err = storage.Update(*watchID, &watch)
+	assert.Nil(t, err)
+	for _, child := range []Storage{primary, secondary} {
+		stored, err := child.Get(*watchID)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://example.org", (*stored).(health.Watch).URL)
+	}
+
+	// Paused in both.
+	assert.Nil(t, storage.SetPaused(true))
+	for _, child := range []Storage{primary, secondary} {
+		paused, err := child.Paused()
+		assert.Nil(t, err)
+		assert.True(t, paused)
+	}
+
+	// Results kept in both.
+	err = storage.(ResultStore).AddResult(Result{WatchID: *watchID, Status: "success"}, 10)
+	assert.Nil(t, err)
+	for _, child := range []Storage{primary, secondary} {
+		results, err := child.(ResultStore).Results(*watchID, 10)
+		assert.Nil(t, err)
+		assert.Len(t, results, 1)
+	}
+}
+
+func TestMulti_Reads(t *testing.T) {
+	primary := Redis{client: newTestRedisClient()}
+	secondary := Redis{client: newTestRedisClient()}
+	storage, cleanup := testMultiStorage(t, primary, secondary)
+	defer cleanup()
+
+	// Watches that exist only in a secondary are not read.
+	watch := testWatch()
+	_, err := secondary.Create(&watch)
+	assert.Nil(t, err)
+	_, err = storage.Get(1)
+	assert.Equal(t, ErrNotFound, err)
+	exists, err := storage.Exists(1)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, secondary.SetPaused(true))
+	paused, err := storage.Paused()
+	assert.Nil(t, err)
+	assert.False(t, paused)
+
+	// Watches that exist in the primary are read from it.
+	watch = testWatch()
+	_, err = primary.Create(&watch)
+	assert.Nil(t, err)
+	stored, err := storage.Get(1)
+	assert.Nil(t, err)
+	base, err := common.Base(*stored)
+	assert.Nil(t, err)
+	assert.Equal(t, "Test Watch", base.Name)
+	watches, _, err := storage.List(0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 1)
+	watches, next, _, err := storage.ListSince(0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 1)
+	assert.Equal(t, 0, next)
+}
+
+func TestMulti_PromotedSecondary(t *testing.T) {
+	primary := Redis{client: newTestRedisClient()}
+	secondary, cleanupBolt := testBoltStorage(t)
+	defer cleanupBolt()
+	storage, cleanup := testMultiStorage(t, primary, secondary)
+	for i := 0; i < 2; i++ {
+		watch := testWatch()
+		_, err := storage.Create(&watch)
+		assert.Nil(t, err)
+	}
+	cleanup()
+
+	// The secondary becomes the primary; the Watches created while it was a
+	// secondary are listed, and new Watches do not reuse their IDs.
+	storage, cleanup = testMultiStorage(t, secondary, primary)
+	defer cleanup()
+	watches, _, err := storage.List(0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 2)
+	watches, _, _, err = storage.ListSince(0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 2)
+
+	watch := testWatch()
+	healthWatch := watch.(health.Watch)
+	healthWatch.URL = "https://example.org"
+	watch = healthWatch
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, *watchID)
+	for _, id := range []int{1, 2} {
+		stored, err := storage.Get(id)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://example.com", (*stored).(health.Watch).URL)
+	}
+
+	// The former primary keeps up with the new one.
+	stored, err := primary.Get(3)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.org", (*stored).(health.Watch).URL)
+	watches, _, err = primary.List(0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 3)
+}
+
+func TestMulti_PartialWriteFailure(t *testing.T) {
+	primary := Redis{client: newTestRedisClient()}
+	secondary := Redis{client: newTestRedisClient()}
+	failing := Redis{client: &TestRedisClient_ErrorResponse{}}
+	storage, cleanup := testMultiStorage(t, primary, secondary, failing)
+	defer cleanup()
+
+	// The Watch is created in the Storage engines that did not fail, and the
+	// failing one is reported.
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	if assert.NotNil(t, watchID) {
+		for _, child := range []Storage{primary, secondary} {
+			exists, _ := child.Exists(*watchID)
+			assert.True(t, exists)
+		}
+	}
+	if assert.IsType(t, MultiWriteError{}, err) {
+		failures := err.(MultiWriteError).Failures
+		assert.Len(t, failures, 1)
+		assert.Equal(t, 2, failures[0].Position)
+		assert.Equal(t, "memory", failures[0].Type)
+		assert.Contains(t, err.Error(), "the \"memory\" Storage at position 2 failed")
+	}
+
+	assert.IsType(t, MultiWriteError{}, storage.SetPaused(true))
+	assert.NotNil(t, storage.Ping())
+}
+
+func TestMulti_PrimaryWriteFailure(t *testing.T) {
+	failing := Redis{client: &TestRedisClient_ErrorResponse{}}
+	secondary := Redis{client: newTestRedisClient()}
+	storage, cleanup := testMultiStorage(t, failing, secondary)
+	defer cleanup()
+
+	// Writes are not made to the secondaries when the primary fails.
+	watch := testWatch()
+	_, err := storage.Create(&watch)
+	assert.NotNil(t, err)
+	_, partial := err.(MultiWriteError)
+	assert.False(t, partial)
+	err = storage.SetPaused(true)
+	assert.NotNil(t, err)
+	paused, err := secondary.Paused()
+	assert.Nil(t, err)
+	assert.False(t, paused)
+}
@@ -9,26 +9,76 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	// Redis.
 	"github.com/mediocregopher/radix.v2/redis"
 
 	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	redisUtil "github.com/krystalcode/go-mantis-shrimp/util/redis"
 	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
 	wrapper "github.com/krystalcode/go-mantis-shrimp/watches/wrapper"
 )
 
+/**
+ * Constants.
+ */
+
+// redisWatchIDCounter holds the key of the counter that is incremented to
+// generate the IDs of new Watches.
+const redisWatchIDCounter = "watches_next_id"
+
+// redisRaiseWatchIDCounterScript holds the Lua script that raises the Watch ID
+// counter to the given ID, if it is lower. A counter that does not exist yet is
+// left as it is, since it is seeded from the Watches index set when first used.
+const redisRaiseWatchIDCounterScript = `
+local current = redis.call("GET", KEYS[1])
+if current and tonumber(current) < tonumber(ARGV[1]) then
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 0
+`
+
+// redisPausedKey holds the key that is set while triggering Watches is paused.
+// It is shared by all instances of the Watch API using the same datastore.
+const redisPausedKey = "watches_paused"
+
+// redisResultsKeyPrefix holds the prefix of the keys of the lists that hold the
+// history of the Results of each Watch, most recent first.
+const redisResultsKeyPrefix = "watch_results:"
+
+// errRedisUninitialized is returned when the Storage is used before its Redis
+// client has been initialized.
+var errRedisUninitialized = fmt.Errorf("the Redis client has not been initialized yet: %w", errorsUtil.ErrStorageUninitialized)
+
 /**
  * Redis storage provider.
  */
 
+// RedisClient is an interface that is used to allow dependency injection of the
+// Redis client that makes the requests to the Redis datastore. Dependency
+// injection is necessary for testing purposes.
+type RedisClient interface {
+	Cmd(string, ...interface{}) *redis.Resp
+}
+
 // Redis implements the Storage interface, allowing to use Redis as a Storage
 // engine.
 type Redis struct {
 	dsn    string
-	client *redis.Client
+	client RedisClient
+	// Whether Watches are compressed when they are written, which mostly pays
+	// off for Watches with large definitions such as Health Check request
+	// bodies. Watches written before the option was changed are still read.
+	compress bool
 }
 
+// Make sure that the Redis storage engine conforms to the Storage and the
+// ResultStore interfaces.
+var _ Storage = Redis{}
+var _ ResultStore = Redis{}
+
 // Create implements Storage.Create(). It stores the given Watch object as a new
 // value in the Redis Storage and it returns an automatically generated ID.
 func (storage Redis) Create(watchPointer *common.Watch) (*int, error) {
@@ -38,7 +88,7 @@ func (storage Redis) Create(watchPointer *common.Watch) (*int, error) {
 		return nil, err
 	}
 
-	err = storage.set(*watchID, watchPointer)
+	err = storage.create(*watchID, watchPointer)
 	if err != nil {
 		return nil, err
 	}
@@ -46,22 +96,277 @@ func (storage Redis) Create(watchPointer *common.Watch) (*int, error) {
 	return watchID, nil
 }
 
+// CreateWithID implements Storage.CreateWithID(). It stores the given Watch
+// object as a new value with the given ID in the Redis Storage, and it raises
+// the Watch ID counter to the given ID if it is lower, so that Watches created
+// afterwards do not get the same ID.
+func (storage Redis) CreateWithID(watchID int, watchPointer *common.Watch) error {
+	if storage.client == nil {
+		return errRedisUninitialized
+	}
+
+	err := storage.create(watchID, watchPointer)
+	if err != nil {
+		return err
+	}
+
+	// The counter is raised after the Watch is added to the index set, so that a
+	// counter seeded from the index set in the meantime includes its ID.
+	return storage.client.Cmd(
+		"EVAL",
+		redisRaiseWatchIDCounterScript,
+		1,
+		redisWatchIDCounter,
+		watchID,
+	).Err
+}
+
 // Get implements Storage.Get(). It retrieves from Storage and returns the Watch
-// for the given ID.
+// for the given ID, or ErrNotFound if there is no Watch with such ID.
 func (storage Redis) Get(id int) (*common.Watch, error) {
 	// @I Delegate error handling to the caller in Storage API functions
 
 	if storage.client == nil {
-		return nil, fmt.Errorf("the Redis client has not been initialized yet")
+		return nil, errRedisUninitialized
+	}
+
+	return storage.get(redisKey(id))
+}
+
+// Exists implements Storage.Exists(). It returns whether a Watch with the
+// given ID exists in the Storage, without loading it.
+func (storage Redis) Exists(id int) (bool, error) {
+	if storage.client == nil {
+		return false, errRedisUninitialized
+	}
+
+	exists, err := storage.client.Cmd("EXISTS", redisKey(id)).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
+// Update implements Storage.Update(). It stores the given Watch object as a
+// value in the Redis Storage, overriding the existing value with the given ID.
+func (storage Redis) Update(watchID int, watchPointer *common.Watch) error {
+	return storage.set(watchID, watchPointer)
+}
+
+// Paused implements Storage.Paused(). It returns whether triggering Watches is
+// paused, that is whether the corresponding key exists.
+func (storage Redis) Paused() (bool, error) {
+	if storage.client == nil {
+		return false, errRedisUninitialized
 	}
 
-	key := redisKey(id)
+	exists, err := storage.client.Cmd("EXISTS", redisPausedKey).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
+// SetPaused implements Storage.SetPaused(). It pauses triggering Watches by
+// setting the corresponding key, or it resumes it by deleting the key.
+func (storage Redis) SetPaused(paused bool) error {
+	if storage.client == nil {
+		return errRedisUninitialized
+	}
+
+	if !paused {
+		return storage.client.Cmd("DEL", redisPausedKey).Err
+	}
+
+	return storage.client.Cmd("SET", redisPausedKey, "1").Err
+}
+
+// Ping implements Storage.Ping(). It checks whether the Redis server is
+// available by sending it a PING command.
+func (storage Redis) Ping() error {
+	if storage.client == nil {
+		return errRedisUninitialized
+	}
+
+	return storage.client.Cmd("PING").Err
+}
+
+// List implements Storage.List(). It retrieves from Storage and returns up to
+// the given number of Watches (limit), starting from the given position of the
+// Watches index set (offset). Watches that cannot be loaded, such as when their
+// stored value is corrupted, do not abort the listing; they are skipped and the
+// corresponding errors are returned in the second slice.
+func (storage Redis) List(offset int, limit int) ([]*common.Watch, []error, error) {
+	if storage.client == nil {
+		return nil, nil, errRedisUninitialized
+	}
+
+	if limit < 1 {
+		return []*common.Watch{}, nil, nil
+	}
+
+	// The members of the Watches index set are the keys of the Watches.
+	keys, err := storage.client.Cmd("ZRANGE", "watches", offset, offset+limit-1).List()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watches := make([]*common.Watch, 0, len(keys))
+	var errs []error
+	for _, key := range keys {
+		watch, err := storage.get(key)
+		if err == ErrNotFound {
+			err = fmt.Errorf("the key is indexed but no value is stored")
+		}
+		if err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("failed to load the Watch stored at key \"%s\": %s", key, err.Error()),
+			)
+			continue
+		}
+
+		watches = append(watches, watch)
+	}
+
+	return watches, errs, nil
+}
+
+// ListSince implements Storage.ListSince(). It retrieves from Storage and
+// returns up to the given number of Watches (limit) with IDs greater than the
+// given ID (since), in the order of their IDs. The Watches are looked up by
+// their scores in the Watches index set, which hold their IDs, so that the cost
+// depends on the number of Watches returned only. It also returns the ID to be
+// given as the cursor for the next page, or 0 if there are no more Watches.
+// Watches that cannot be loaded are handled the same way as by List().
+func (storage Redis) ListSince(since int, limit int) ([]*common.Watch, int, []error, error) {
+	if storage.client == nil {
+		return nil, 0, nil, errRedisUninitialized
+	}
+
+	if limit < 1 {
+		return []*common.Watch{}, 0, nil, nil
+	}
+
+	// Request one more Watch than the limit to find out whether there are more
+	// Watches after the page. The reply alternates the keys of the Watches with
+	// their scores.
+	reply, err := storage.client.Cmd(
+		"ZRANGEBYSCORE",
+		"watches",
+		"("+strconv.Itoa(since),
+		"+inf",
+		"WITHSCORES",
+		"LIMIT",
+		0,
+		limit+1,
+	).List()
+	if err != nil {
+		return nil, 0, nil, err
+	}
 
+	watches := make([]*common.Watch, 0, limit)
+	next := 0
+	var errs []error
+	for index := 0; index+1 < len(reply); index += 2 {
+		if index/2 == limit {
+			break
+		}
+
+		key := reply[index]
+		next, err = strconv.Atoi(reply[index+1])
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("invalid score \"%s\" for the key \"%s\" in the Watches index set", reply[index+1], key)
+		}
+
+		watch, err := storage.get(key)
+		if err == ErrNotFound {
+			err = fmt.Errorf("the key is indexed but no value is stored")
+		}
+		if err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("failed to load the Watch stored at key \"%s\": %s", key, err.Error()),
+			)
+			continue
+		}
+
+		watches = append(watches, watch)
+	}
+	if len(reply) <= 2*limit {
+		next = 0
+	}
+
+	return watches, next, errs, nil
+}
+
+// AddResult implements ResultStore.AddResult(). It adds the given Result at the
+// head of the list that holds the history of the Watch's Results, and it trims
+// the list down to the given length.
+func (storage Redis) AddResult(result Result, length int) error {
+	if storage.client == nil {
+		return errRedisUninitialized
+	}
+
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	// Concurrent evaluations of the same Watch may push their Results between
+	// the two commands; the list is then trimmed by the last one of them.
+	key := redisResultsKey(result.WatchID)
+	err = storage.client.Cmd("LPUSH", key, jsonResult).Err
+	if err != nil {
+		return err
+	}
+
+	return storage.client.Cmd("LTRIM", key, 0, length-1).Err
+}
+
+// Results implements ResultStore.Results(). It retrieves up to the given number
+// of the most recent Results of the Watch with the given ID.
+func (storage Redis) Results(watchID int, limit int) ([]Result, error) {
+	if storage.client == nil {
+		return nil, errRedisUninitialized
+	}
+
+	if limit < 1 {
+		return []Result{}, nil
+	}
+
+	jsonResults, err := storage.client.Cmd("LRANGE", redisResultsKey(watchID), 0, limit-1).ListBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(jsonResults))
+	for index, jsonResult := range jsonResults {
+		err = json.Unmarshal(jsonResult, &results[index])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode a Result of the Watch with ID \"%d\": %s", watchID, err.Error())
+		}
+	}
+
+	return results, nil
+}
+
+// get retrieves the JSON value stored at the given key and creates the Watch
+// object that it corresponds to. It returns ErrNotFound if there is no value
+// stored at the key.
+func (storage Redis) get(key string) (*common.Watch, error) {
 	r := storage.client.Cmd("GET", key)
 	if r.Err != nil {
 		return nil, r.Err
 	}
 
+	// There is no Watch stored at the given key.
+	if r.IsType(redis.Nil) {
+		return nil, ErrNotFound
+	}
+
 	jsonWatch, err := r.Bytes()
 	// If an error happens here, it should be because there is no value for this
 	// key. It could be the case that the data is corrupted or the wrong data is
@@ -70,6 +375,10 @@ func (storage Redis) Get(id int) (*common.Watch, error) {
 	if err != nil {
 		return nil, err
 	}
+	jsonWatch, err = redisUtil.DecompressValue(jsonWatch)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create and initialize a Watch object based on the given JSON object.
 	watch, err := wrapper.Create(jsonWatch)
@@ -80,10 +389,22 @@ func (storage Redis) Get(id int) (*common.Watch, error) {
 	return &watch, nil
 }
 
-// Update implements Storage.Update(). It stores the given Watch object as a
-// value in the Redis Storage, overriding the existing value with the given ID.
-func (storage Redis) Update(watchID int, watchPointer *common.Watch) error {
-	return storage.set(watchID, watchPointer)
+// create stores a new Watch object as a Redis value at the key corresponding to
+// the given ID, and it adds it to the Watches index set.
+func (storage Redis) create(watchID int, watchPointer *common.Watch) error {
+	err := setCreatedAt(watchPointer)
+	if err != nil {
+		return err
+	}
+
+	err = storage.set(watchID, watchPointer)
+	if err != nil {
+		return err
+	}
+
+	// Add the new Watch to the Watches index set. Updates do not change the
+	// index, so it is only done when creating the Watch.
+	return storage.client.Cmd("ZADD", "watches", watchID, redisKey(watchID)).Err
 }
 
 // set stores a Watch object as a Redis value at the key corresponding to the
@@ -92,88 +413,79 @@ func (storage Redis) set(watchID int, watchPointer *common.Watch) error {
 	// @I Consider using hashmaps instead of json values when storing Watches
 
 	if storage.client == nil {
-		return fmt.Errorf("the Redis client has not been initialized yet")
+		return errRedisUninitialized
 	}
 
-	// We'll be storing a WatchWrapper which contains the Watch type as well.
-	watch := *watchPointer
-	wrapper, err := wrapper.Wrapper(watch)
+	// Update the UpdatedAt field.
+	base, err := common.Base(*watchPointer)
 	if err != nil {
 		return err
 	}
-	jsonWatch, err := json.Marshal(wrapper)
+	now := time.Now()
+	base.UpdatedAt = &now
+	err = common.SetBase(watchPointer, *base)
 	if err != nil {
 		return err
 	}
 
-	// Store the Watch, and update the Watches index set.
-	key := redisKey(watchID)
-	err = storage.client.Cmd("SET", key, jsonWatch).Err
+	// We'll be storing a WatchWrapper which contains the Watch type as well.
+	watch := *watchPointer
+	wrapper, err := wrapper.Wrapper(watch)
 	if err != nil {
 		return err
 	}
-	// @I Add the Watch's ID to the index only when creating it
-	err = storage.client.Cmd("ZADD", "watches", watchID, key).Err
+	jsonWatch, err := json.Marshal(wrapper)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if storage.compress {
+		jsonWatch, err = redisUtil.CompressValue(jsonWatch)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Store the Watch.
+	return storage.client.Cmd("SET", redisKey(watchID), jsonWatch).Err
 }
 
-// generateID generates an ID for a new Watch by incrementing the last known
-// Watch ID.
+// generateID generates an ID for a new Watch by atomically incrementing the
+// Watch ID counter, so that concurrent requests never get the same ID.
 func (storage Redis) generateID() (*int, error) {
-	// @I Investigate risk of a Watch overriding another due to race conditions when
-	//    creating them
-
 	if storage.client == nil {
-		return nil, fmt.Errorf("the Redis client has not been initialized yet")
+		return nil, errRedisUninitialized
 	}
 
-	// Get the last ID that exists on the Watches index set, so that we can generate
-	// the next one.
-	r, err := storage.client.Cmd("ZREVRANGE", "watches", 0, 0, "WITHSCORES").List()
+	newID, err := redisUtil.NextID(storage.client, redisWatchIDCounter, "watches")
 	if err != nil {
 		return nil, err
 	}
 
-	// If there are no Watches yet, start with ID 1.
-	if len(r) == 0 {
-		newWatchID := 1
-		return &newWatchID, nil
-	}
-
-	latestWatchID, err := strconv.Atoi(r[1])
-	if err != nil {
-		return nil, err
-	}
-
-	newWatchID := latestWatchID + 1
-	return &newWatchID, nil
+	return &newID, nil
 }
 
 // NewRedisStorage implements the StorageFactory function type. It initiates a
-// connection to the Redis database defined in the given configuration, and it
-// returns the Storage engine object.
+// pool of connections to the Redis database defined in the given
+// configuration, and it returns the Storage engine object. The Storage engine
+// can be shared by concurrent requests. The "compress" option can optionally
+// enable compressing the stored Watches; the Results kept in their history are
+// stored uncompressed.
 var NewRedisStorage = func(config map[string]interface{}) (Storage, error) {
-	dsn, ok := config["dsn"]
-	if !ok {
-		err := fmt.Errorf("the DSN configuration option is required for the Redis storage")
+	compress, err := redisUtil.Compression(config)
+	if err != nil {
 		return nil, err
 	}
 
-	sDSN := dsn.(string)
-
-	client, err := redis.Dial("tcp", sDSN)
+	client, err := redisUtil.NewPool(config)
 	if err != nil {
-		err := fmt.Errorf("failed to connect to Redis: %s", err.Error())
 		return nil, err
 	}
 
 	storage := Redis{
-		dsn:    sDSN,
-		client: client,
+		dsn:      config["dsn"].(string),
+		client:   client,
+		compress: compress,
 	}
 
 	return storage, nil
@@ -187,3 +499,9 @@ var NewRedisStorage = func(config map[string]interface{}) (Storage, error) {
 func redisKey(id int) string {
 	return "watch:" + strconv.Itoa(id)
 }
+
+// Generate the Redis key of the history of the Results of the Watch with the
+// given ID.
+func redisResultsKey(id int) string {
+	return redisResultsKeyPrefix + strconv.Itoa(id)
+}
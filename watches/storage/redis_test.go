@@ -5,11 +5,59 @@
 package msWatchStorage
 
 import (
+	// Utilities.
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Redis.
+	"github.com/mediocregopher/radix.v2/redis"
+
 	// Testing packages.
 	"github.com/stretchr/testify/assert"
 	"testing"
+
+	// Internal dependencies.
+	redisUtil "github.com/krystalcode/go-mantis-shrimp/util/redis"
+	redisTest "github.com/krystalcode/go-mantis-shrimp/util/redis/redistest"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
 )
 
+// newTestRedisClient creates an in-memory Redis client that emulates the script
+// raising the Watch ID counter.
+func newTestRedisClient() *redisTest.Client {
+	client := redisTest.NewClient()
+	client.HandleScript(
+		redisRaiseWatchIDCounterScript,
+		func(client *redisTest.Client, args []interface{}) *redis.Resp {
+			key, id := args[1].(string), args[2].(int)
+			if current, ok := client.Value(key); ok {
+				value, _ := strconv.Atoi(current)
+				if value < id {
+					client.SetValue(key, strconv.Itoa(id))
+				}
+			}
+			return redis.NewResp(0)
+		},
+	)
+	return client
+}
+
+func testRedisStorage() Redis {
+	return Redis{client: newTestRedisClient()}
+}
+
+func testWatch() common.Watch {
+	return health.Watch{
+		WatchBase: common.WatchBase{Name: "Test Watch"},
+		URL:       "https://example.com",
+		Statuses:  []int{200},
+	}
+}
+
 /**
  * Tests.
  */
@@ -20,12 +68,404 @@ func TestNewRedisStorage_MissingDSN(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestNewRedisStorage_InvalidCompress(t *testing.T) {
+	config := map[string]interface{}{"type": "redis", "dsn": "localhost:6379", "compress": "yes"}
+	_, err := NewRedisStorage(config)
+	assert.EqualError(t, err, "the \"compress\" configuration option must be a boolean: invalid configuration")
+}
+
+func TestCompress_RoundTrip(t *testing.T) {
+	client := newTestRedisClient()
+	storage := Redis{client: client, compress: true}
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+
+	// The Watch should be stored compressed.
+	value, _ := client.Value(redisKey(*watchID))
+	assert.True(t, strings.HasPrefix(value, redisUtil.CompressedPrefix))
+	assert.NotContains(t, value, "https://example.com")
+
+	stored, err := storage.Get(*watchID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", (*stored).(health.Watch).URL)
+
+	// It should be read the same way when compression is disabled.
+	stored, err = Redis{client: client}.Get(*watchID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", (*stored).(health.Watch).URL)
+}
+
+func TestCompress_Uncompressed(t *testing.T) {
+	client := newTestRedisClient()
+	watch := testWatch()
+	watchID, err := Redis{client: client}.Create(&watch)
+	assert.Nil(t, err)
+
+	// Watches stored before compression was enabled should still be read.
+	value, _ := client.Value(redisKey(*watchID))
+	assert.True(t, strings.HasPrefix(value, `{"type":"health_check"`))
+
+	storage := Redis{client: client, compress: true}
+	stored, err := storage.Get(*watchID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", (*stored).(health.Watch).URL)
+
+	// They should be compressed when they are next updated.
+	err = storage.Update(*watchID, stored)
+	assert.Nil(t, err)
+	value, _ = client.Value(redisKey(*watchID))
+	assert.True(t, strings.HasPrefix(value, redisUtil.CompressedPrefix))
+}
+
+func TestCreate_SetsTimestamps(t *testing.T) {
+	storage := testRedisStorage()
+	watch := testWatch()
+
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+
+	stored, err := storage.Get(*watchID)
+	assert.Nil(t, err)
+	base, err := common.Base(*stored)
+	assert.Nil(t, err)
+	assert.NotNil(t, base.CreatedAt)
+	assert.NotNil(t, base.UpdatedAt)
+}
+
+func TestCreate_KeepsExistingCreatedAt(t *testing.T) {
+	storage := testRedisStorage()
+	watch := testWatch()
+	createdAt := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	base, _ := common.Base(watch)
+	base.CreatedAt = &createdAt
+	common.SetBase(&watch, *base)
+
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+
+	stored, err := storage.Get(*watchID)
+	assert.Nil(t, err)
+	base, err = common.Base(*stored)
+	assert.Nil(t, err)
+	assert.True(t, createdAt.Equal(*base.CreatedAt))
+}
+
+func TestUpdate_RefreshesUpdatedAt(t *testing.T) {
+	storage := testRedisStorage()
+	watch := testWatch()
+
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	created, _ := common.Base(watch)
+
+	err = storage.Update(*watchID, &watch)
+	assert.Nil(t, err)
+	updated, _ := common.Base(watch)
+
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.False(t, updated.UpdatedAt.Before(*created.UpdatedAt))
+}
+
+func TestUpdate_IndexedOnlyOnCreate(t *testing.T) {
+	client := newTestRedisClient()
+	storage := Redis{
+		client: client,
+	}
+	watch := testWatch()
+
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	err = storage.Update(*watchID, &watch)
+	assert.Nil(t, err)
+	err = storage.Update(*watchID, &watch)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, client.ZAdds("watches"))
+	assert.Equal(t, map[string]int64{redisKey(*watchID): int64(*watchID)}, client.Scores("watches"))
+}
+
+func TestCreate_ConcurrentRequestsGetUniqueIDs(t *testing.T) {
+	storage := testRedisStorage()
+	count := 50
+
+	ids := make(chan int, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watch := testWatch()
+			watchID, err := storage.Create(&watch)
+			assert.Nil(t, err)
+			if err == nil {
+				ids <- *watchID
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	uniqueIDs := make(map[int]bool)
+	for id := range ids {
+		uniqueIDs[id] = true
+	}
+	assert.Len(t, uniqueIDs, count)
+}
+
+func TestCreate_SeedsIDCounterFromIndex(t *testing.T) {
+	client := newTestRedisClient()
+	storage := Redis{client: client}
+
+	// Simulate a Watch created before the ID counter was introduced.
+	client.Cmd("ZADD", "watches", 5, redisKey(5))
+
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, *watchID)
+}
+
+func TestCreateWithID(t *testing.T) {
+	client := newTestRedisClient()
+	storage := Redis{client: client}
+	for i := 0; i < 2; i++ {
+		watch := testWatch()
+		_, err := storage.Create(&watch)
+		assert.Nil(t, err)
+	}
+
+	// The Watch is stored and indexed with the given ID.
+	watch := testWatch()
+	err := storage.CreateWithID(5, &watch)
+	assert.Nil(t, err)
+	stored, err := storage.Get(5)
+	assert.Nil(t, err)
+	base, err := common.Base(*stored)
+	assert.Nil(t, err)
+	assert.NotNil(t, base.CreatedAt)
+	assert.Equal(t, int64(5), client.Scores("watches")[redisKey(5)])
+
+	// IDs generated afterwards follow the given ID, and lower IDs do not lower
+	// the counter.
+	watch = testWatch()
+	err = storage.CreateWithID(3, &watch)
+	assert.Nil(t, err)
+	watch = testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, *watchID)
+}
+
+func TestCreateWithID_UnseededCounter(t *testing.T) {
+	storage := testRedisStorage()
+
+	// The counter does not exist yet; it is seeded from the index set which
+	// includes the given ID.
+	watch := testWatch()
+	err := storage.CreateWithID(4, &watch)
+	assert.Nil(t, err)
+	watch = testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, *watchID)
+}
+
+func TestCreate_RedisError(t *testing.T) {
+	storage := Redis{client: &TestRedisClient_ErrorResponse{}}
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.NotNil(t, err)
+	assert.Nil(t, watchID)
+
+	storage = Redis{}
+	_, err = storage.Create(&watch)
+	assert.NotNil(t, err)
+}
+
+func TestUpdate_Success(t *testing.T) {
+	storage := testRedisStorage()
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+
+	// Update the stored Watch; it should keep its ID.
+	updatedWatch := watch.(health.Watch)
+	updatedWatch.URL = "https://example.com/health"
+	watch = updatedWatch
+	err = storage.Update(*watchID, &watch)
+	assert.Nil(t, err)
+
+	stored, err := storage.Get(*watchID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/health", (*stored).(health.Watch).URL)
+
+	// No new Watch should have been created.
+	_, err = storage.Get(*watchID + 1)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestUpdate_RedisError(t *testing.T) {
+	storage := Redis{client: &TestRedisClient_ErrorResponse{}}
+	watch := testWatch()
+	assert.NotNil(t, storage.Update(1, &watch))
+
+	storage = Redis{}
+	assert.NotNil(t, storage.Update(1, &watch))
+}
+
+func TestGet_Success(t *testing.T) {
+	// Make a stub request to get a Watch from Redis.
+	storage := Redis{client: &TestRedisClient_RightValueResponse{}}
+	watch, err := storage.Get(1)
+	assert.Nil(t, err)
+
+	// The JSON data should be converted to a Watch of the right type, with the
+	// expected field values.
+	healthWatch, ok := (*watch).(health.Watch)
+	assert.True(t, ok)
+	assert.Equal(t, "Watch name", healthWatch.Name)
+	assert.Equal(t, []int{1, 2}, healthWatch.ActionsIDs)
+	assert.Equal(t, "https://example.com", healthWatch.URL)
+	assert.Equal(t, []int{200}, healthWatch.Statuses)
+}
+
+func TestGet_JSONError(t *testing.T) {
+	storage := Redis{client: &TestRedisClient_WrongValueResponse{}}
+	_, err := storage.Get(1)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNotFound, err)
+}
+
 /**
  * Tests for functions/types for internal use.
  */
 
+func TestGet_NotFound(t *testing.T) {
+	storage := testRedisStorage()
+	watch, err := storage.Get(1)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, watch)
+
+	// Errors communicating with Redis should not be reported as a missing Watch.
+	storage = Redis{client: &TestRedisClient_ErrorResponse{}}
+	_, err = storage.Get(1)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNotFound, err)
+}
+
+func TestExists(t *testing.T) {
+	storage := testRedisStorage()
+	exists, err := storage.Exists(1)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	watch := testWatch()
+	watchID, err := storage.Create(&watch)
+	assert.Nil(t, err)
+	exists, err = storage.Exists(*watchID)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	storage = Redis{client: &TestRedisClient_ErrorResponse{}}
+	_, err = storage.Exists(1)
+	assert.NotNil(t, err)
+
+	storage = Redis{}
+	_, err = storage.Exists(1)
+	assert.NotNil(t, err)
+}
+
+func TestPing(t *testing.T) {
+	storage := testRedisStorage()
+	assert.Nil(t, storage.Ping())
+
+	storage = Redis{}
+	assert.NotNil(t, storage.Ping())
+}
+
+func TestPaused(t *testing.T) {
+	storage := Redis{client: newTestRedisClient()}
+
+	paused, err := storage.Paused()
+	assert.Nil(t, err)
+	assert.False(t, paused)
+
+	assert.Nil(t, storage.SetPaused(true))
+	paused, err = storage.Paused()
+	assert.Nil(t, err)
+	assert.True(t, paused)
+
+	assert.Nil(t, storage.SetPaused(false))
+	paused, err = storage.Paused()
+	assert.Nil(t, err)
+	assert.False(t, paused)
+
+	// Resuming is allowed when not paused.
+	assert.Nil(t, storage.SetPaused(false))
+}
+
+func TestPaused_RedisError(t *testing.T) {
+	storage := Redis{client: &TestRedisClient_ErrorResponse{}}
+
+	_, err := storage.Paused()
+	assert.NotNil(t, err)
+	assert.NotNil(t, storage.SetPaused(true))
+}
+
+func TestResults(t *testing.T) {
+	storage := testRedisStorage()
+	testResultStore(t, storage)
+}
+
+func TestListSince(t *testing.T) {
+	testListSince(t, testRedisStorage())
+}
+
+func TestListSince_RedisError(t *testing.T) {
+	storage := Redis{client: &TestRedisClient_ErrorResponse{}}
+	_, _, _, err := storage.ListSince(0, 10)
+	assert.NotNil(t, err)
+}
+
+func TestResults_RedisError(t *testing.T) {
+	storage := Redis{client: &TestRedisClient_ErrorResponse{}}
+	err := storage.AddResult(Result{WatchID: 1}, 10)
+	assert.NotNil(t, err)
+	_, err = storage.Results(1, 10)
+	assert.NotNil(t, err)
+}
+
 func TestRedisKey(t *testing.T) {
 	sIDResult := redisKey(1)
 	sIDDesired := "watch:1"
 	assert.Equal(t, sIDDesired, sIDResult)
 }
+
+/**
+ * Functions/types for internal use.
+ */
+
+// TestRedisClient_ErrorResponse fails every command, as when Redis cannot be
+// reached.
+type TestRedisClient_ErrorResponse struct{}
+
+func (client *TestRedisClient_ErrorResponse) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	return redis.NewResp(fmt.Errorf("an error has occurred while executing the Redis command"))
+}
+
+// TestRedisClient_WrongValueResponse returns a value that is not a valid
+// WatchWrapper for every command.
+type TestRedisClient_WrongValueResponse struct{}
+
+func (client *TestRedisClient_WrongValueResponse) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	return redis.NewResp("{}")
+}
+
+// TestRedisClient_RightValueResponse returns a stored Health Check Watch for
+// every command.
+type TestRedisClient_RightValueResponse struct{}
+
+func (client *TestRedisClient_RightValueResponse) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	return redis.NewResp("{\"type\":\"health_check\",\"watch\":{\"name\":\"Watch name\",\"actions_ids\":[1,2],\"url\":\"https://example.com\",\"statuses\":[200]}}")
+}
@@ -0,0 +1,51 @@
+/**
+ * Provides a storage API for keeping the history of the Results of Watches.
+ */
+
+package msWatchStorage
+
+import (
+	// Utilities.
+	"net/http"
+	"time"
+)
+
+/**
+ * Public API.
+ */
+
+// Result holds the outcome of an evaluation of a Watch, as kept in the history
+// of the Watch's Results.
+type Result struct {
+	// The ID of the Watch that was evaluated.
+	WatchID int `json:"watch_id"`
+	// When the Watch was evaluated.
+	Timestamp time.Time `json:"timestamp"`
+	// The status of the Watch's Result e.g. "success" or "inaccessible". Watches
+	// that do not provide any details about their Result have no status.
+	Status string `json:"status"`
+	// The IDs of the Actions that the evaluation triggered, if any.
+	ActionsIDs []int `json:"actions_ids"`
+	// The response headers that the Watch captured, if any e.g. the headers that
+	// a Health Check Watch is configured to capture.
+	Headers http.Header `json:"headers,omitempty"`
+	// The response body that the Watch captured, if any, truncated to the
+	// maximum size of the stored bodies. It is kept for display only; Results
+	// are never evaluated again from their stored body, since it may not be
+	// complete.
+	Body string `json:"body,omitempty"`
+	// Whether the stored body is not the complete response body, either because
+	// the Watch captured only part of it or because it was longer than the
+	// maximum size of the stored bodies.
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+}
+
+// ResultStore is an interface that should be implemented by all engines that
+// keep the history of the Results of Watches. It defines an API for adding a
+// Result to the history of a Watch, keeping up to the given number of the most
+// recent Results, and for retrieving up to the given number of the most recent
+// Results of a Watch, starting from the most recent one.
+type ResultStore interface {
+	AddResult(Result, int) error
+	Results(int, int) ([]Result, error)
+}
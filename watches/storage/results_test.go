@@ -0,0 +1,74 @@
+/**
+ * Tests for the Result history API of the msWatchStorage module.
+ */
+
+package msWatchStorage
+
+import (
+	// Utilities.
+	"net/http"
+	"time"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testResultStore tests that the given ResultStore keeps a bounded history of
+// the Results of each Watch, most recent first.
+func testResultStore(t *testing.T, store ResultStore) {
+	// No Results are stored yet.
+	results, err := store.Results(1, 10)
+	assert.Nil(t, err)
+	assert.Len(t, results, 0)
+
+	start := time.Date(2017, 5, 1, 10, 30, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		result := Result{
+			WatchID:       1,
+			Timestamp:     start.Add(time.Duration(i) * time.Minute),
+			Status:        "success",
+			ActionsIDs:    []int{i},
+			Headers:       http.Header{"X-Cache": []string{"HIT"}},
+			Body:          `{"status":"ok"}`,
+			BodyTruncated: true,
+		}
+		err = store.AddResult(result, 3)
+		assert.Nil(t, err)
+	}
+	err = store.AddResult(Result{WatchID: 2, Timestamp: start, Status: "inaccessible"}, 3)
+	assert.Nil(t, err)
+
+	// Only the most recent Results are kept, up to the given length.
+	results, err = store.Results(1, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, []int{4}, results[0].ActionsIDs)
+		assert.Equal(t, []int{2}, results[2].ActionsIDs)
+		assert.True(t, start.Add(4*time.Minute).Equal(results[0].Timestamp))
+		assert.Equal(t, "success", results[0].Status)
+		assert.Equal(t, 1, results[0].WatchID)
+		assert.Equal(t, http.Header{"X-Cache": []string{"HIT"}}, results[0].Headers)
+		assert.Equal(t, `{"status":"ok"}`, results[0].Body)
+		assert.True(t, results[0].BodyTruncated)
+	}
+
+	// Up to the given limit is returned.
+	results, err = store.Results(1, 2)
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+
+	// The history of each Watch is kept separately.
+	results, err = store.Results(2, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "inaccessible", results[0].Status)
+		assert.Nil(t, results[0].Headers)
+		assert.Empty(t, results[0].Body)
+		assert.False(t, results[0].BodyTruncated)
+	}
+}
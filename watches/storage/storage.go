@@ -7,8 +7,11 @@ package msWatchStorage
 import (
 	// Utilities.
 	"fmt"
+	"sync"
+	"time"
 
 	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
 	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
 )
 
@@ -16,12 +19,30 @@ import (
  * Public API.
  */
 
+// ErrNotFound is returned when trying to get a Watch that does not exist
+// in the Storage.
+var ErrNotFound = fmt.Errorf("the Watch was %w", errorsUtil.ErrNotFound)
+
 // Storage is an interface that should be implemented by all Storage engines.
-// It defines an API for storing and retrieving Watch objects.
+// It defines an API for storing and retrieving Watch objects, for storing
+// whether triggering Watches is paused e.g. during maintenance, and for checking
+// whether the Storage is available.
+//
+// CreateWithID stores a new Watch with an ID generated elsewhere, such as by
+// another Storage engine. It should store the Watch the same way as Create does,
+// including it in listings, and make sure that the IDs generated afterwards by
+// Create are greater than the given one.
 type Storage interface {
 	Create(*common.Watch) (*int, error)
+	CreateWithID(int, *common.Watch) error
 	Get(int) (*common.Watch, error)
+	Exists(int) (bool, error)
 	Update(int, *common.Watch) error
+	List(int, int) ([]*common.Watch, []error, error)
+	ListSince(int, int) ([]*common.Watch, int, []error, error)
+	Paused() (bool, error)
+	SetPaused(bool) error
+	Ping() error
 }
 
 // StorageFactory is a function type that should be implemented by all Storage
@@ -34,28 +55,21 @@ type StorageFactory func(confing map[string]interface{}) (Storage, error)
 // Create creates and returns a Storage provider, given the configuration that
 // includes configuration required by the provider.
 func Create(config map[string]interface{}) (Storage, error) {
-	// Register providers the first time we create a storage. We may create a more
-	// generic registration mechanism when we support more storage providers that
-	// may also be registered independently, but for now this is sufficient.
-	if len(storageFactories) == 0 {
-		storageFactories["redis"] = NewRedisStorage
-	}
-
 	storageType, ok := config["type"]
 	if !ok {
-		err := fmt.Errorf("the \"type\" configuration option is required for defining the storage engine")
+		err := fmt.Errorf("the \"type\" configuration option is required for defining the storage engine: %w", errorsUtil.ErrInvalidConfig)
 		return nil, err
 	}
 
 	sStorageType := storageType.(string)
 	if sStorageType == "" {
-		err := fmt.Errorf("no storage engine provided")
+		err := fmt.Errorf("no storage engine provided: %w", errorsUtil.ErrInvalidConfig)
 		return nil, err
 	}
 
-	factory, ok := storageFactories[sStorageType]
+	factory, ok := storageFactory(sStorageType)
 	if !ok {
-		err := fmt.Errorf("unknown storage engine \"%s\"", sStorageType)
+		err := fmt.Errorf("unknown storage engine \"%s\": %w", sStorageType, errorsUtil.ErrUnknownType)
 		return nil, err
 	}
 
@@ -67,9 +81,55 @@ func Create(config map[string]interface{}) (Storage, error) {
 	return storage, nil
 }
 
+// RegisterStorageFactory registers the given factory for creating Storage
+// engines of the given type, replacing any factory already registered for it.
+// It allows Storage engines defined outside of this package to be created via
+// Create(), and it is safe to call concurrently with Create().
+func RegisterStorageFactory(storageType string, factory StorageFactory) {
+	storageFactoriesMutex.Lock()
+	defer storageFactoriesMutex.Unlock()
+	storageFactories[storageType] = factory
+}
+
 /**
  * For internal use.
  */
 
-// storageFactories holds a map of all known Storage factories.
+// storageFactories holds a map of all known Storage factories, keyed by their
+// type. It is only accessed while holding storageFactoriesMutex.
 var storageFactories = make(map[string]StorageFactory)
+
+// storageFactoriesMutex guards storageFactories so that factories can be
+// registered while others are looked up concurrently.
+var storageFactoriesMutex sync.RWMutex
+
+// Register the factories provided by this application.
+func init() {
+	RegisterStorageFactory("redis", NewRedisStorage)
+	RegisterStorageFactory("bolt", NewBoltStorage)
+	RegisterStorageFactory("multi", NewMultiStorage)
+}
+
+// setCreatedAt sets the time that the given Watch was created at to the current
+// time, unless it is already set.
+func setCreatedAt(watchPointer *common.Watch) error {
+	base, err := common.Base(*watchPointer)
+	if err != nil {
+		return err
+	}
+	if base.CreatedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	base.CreatedAt = &now
+	return common.SetBase(watchPointer, *base)
+}
+
+// storageFactory returns the factory registered for the given type, if any.
+func storageFactory(storageType string) (StorageFactory, bool) {
+	storageFactoriesMutex.RLock()
+	defer storageFactoriesMutex.RUnlock()
+	factory, ok := storageFactories[storageType]
+	return factory, ok
+}
@@ -5,6 +5,15 @@
 package msWatchStorage
 
 import (
+	// Utilities.
+	"errors"
+	"fmt"
+	"sync"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+
 	// Testing packages.
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -19,7 +28,7 @@ var NewTestStorage = func(config map[string]interface{}) (Storage, error) {
  */
 
 func TestCreate_Success(t *testing.T) {
-	storageFactories["test"] = NewTestStorage
+	RegisterStorageFactory("test", NewTestStorage)
 
 	config := make(map[string]interface{})
 	config["type"] = "test"
@@ -46,3 +55,137 @@ func TestCreate_WrongConfig_WrongType(t *testing.T) {
 	_, err := Create(config)
 	assert.NotNil(t, err)
 }
+
+func TestCreate_SentinelErrors(t *testing.T) {
+	cases := []struct {
+		config   map[string]interface{}
+		sentinel error
+	}{
+		{map[string]interface{}{}, errorsUtil.ErrInvalidConfig},
+		{map[string]interface{}{"type": ""}, errorsUtil.ErrInvalidConfig},
+		{map[string]interface{}{"type": "mysql"}, errorsUtil.ErrUnknownType},
+		{map[string]interface{}{"type": "redis"}, errorsUtil.ErrInvalidConfig},
+		{map[string]interface{}{"type": "bolt"}, errorsUtil.ErrInvalidConfig},
+		{map[string]interface{}{"type": "multi"}, errorsUtil.ErrInvalidConfig},
+		{map[string]interface{}{"type": "multi", "storages": []interface{}{"redis"}}, errorsUtil.ErrInvalidConfig},
+		{
+			map[string]interface{}{"type": "multi", "storages": []interface{}{map[string]interface{}{"type": "mysql"}}},
+			errorsUtil.ErrUnknownType,
+		},
+	}
+
+	for _, c := range cases {
+		_, err := Create(c.config)
+		assert.True(t, errors.Is(err, c.sentinel), "%v: %v", c.config, err)
+	}
+}
+
+func TestStorage_SentinelErrors(t *testing.T) {
+	// Redis clients that have not been initialized.
+	uninitialized := Redis{}
+	watch := testWatch()
+	_, err := uninitialized.Get(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrStorageUninitialized))
+	_, err = uninitialized.Create(&watch)
+	assert.True(t, errors.Is(err, errorsUtil.ErrStorageUninitialized))
+	_, err = uninitialized.Paused()
+	assert.True(t, errors.Is(err, errorsUtil.ErrStorageUninitialized))
+
+	// Watches that do not exist.
+	storage, cleanup := testBoltStorage(t)
+	defer cleanup()
+	_, err = storage.Get(1)
+	assert.True(t, errors.Is(err, errorsUtil.ErrNotFound))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.EqualError(t, err, "the Watch was not found")
+}
+
+func TestRegisterStorageFactory_Concurrent(t *testing.T) {
+	custom := Multi{types: []string{"custom"}}
+	RegisterStorageFactory("custom", func(config map[string]interface{}) (Storage, error) {
+		return custom, nil
+	})
+
+	// Factories are registered while others are looked up, such as when Storage
+	// engines are registered while requests create them.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterStorageFactory(fmt.Sprintf("custom_%d", i), NewTestStorage)
+		}(i)
+		go func() {
+			defer wg.Done()
+			storage, err := Create(map[string]interface{}{"type": "custom"})
+			assert.Nil(t, err)
+			assert.Equal(t, custom, storage)
+		}()
+	}
+	wg.Wait()
+
+	_, err := Create(map[string]interface{}{"type": "custom_49"})
+	assert.Nil(t, err)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testListSince tests that iterating through the pages of the Watches stored in
+// the given Storage, using the returned cursors, returns every Watch once.
+func testListSince(t *testing.T, storage Storage) {
+	// No Watches are stored yet.
+	watches, next, errs, err := storage.ListSince(0, 3)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 0)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, 0, next)
+
+	// Watches do not hold their IDs; they are identified by their names.
+	var createdIDs []int
+	var createdNames []string
+	for i := 0; i < 7; i++ {
+		watch := testWatch()
+		base, _ := common.Base(watch)
+		base.Name = fmt.Sprintf("Watch %d", i)
+		common.SetBase(&watch, *base)
+		watchID, err := storage.Create(&watch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		createdIDs = append(createdIDs, *watchID)
+		createdNames = append(createdNames, base.Name)
+	}
+
+	// Go through pages of 3 Watches; the last page is partial.
+	var listedNames []string
+	since := 0
+	for pages := 0; pages < 10; pages++ {
+		watches, next, errs, err = storage.ListSince(since, 3)
+		assert.Nil(t, err)
+		assert.Len(t, errs, 0)
+		for _, watch := range watches {
+			base, _ := common.Base(*watch)
+			listedNames = append(listedNames, base.Name)
+		}
+		if next == 0 {
+			break
+		}
+		assert.Len(t, watches, 3)
+		since = next
+	}
+	assert.Equal(t, createdNames, listedNames)
+
+	// A page that ends with the last Watch has no next page.
+	watches, next, _, err = storage.ListSince(createdIDs[3], 3)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 3)
+	assert.Equal(t, 0, next)
+
+	// A page that starts after the last Watch is empty.
+	watches, next, _, err = storage.ListSince(createdIDs[6], 3)
+	assert.Nil(t, err)
+	assert.Len(t, watches, 0)
+	assert.Equal(t, 0, next)
+}
@@ -15,10 +15,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sync"
 
 	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	aggregate "github.com/krystalcode/go-mantis-shrimp/watches/aggregate"
+	cert "github.com/krystalcode/go-mantis-shrimp/watches/cert_check"
 	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	dns "github.com/krystalcode/go-mantis-shrimp/watches/dns_check"
 	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
+	inboundEvent "github.com/krystalcode/go-mantis-shrimp/watches/inbound_event"
+	jsonCheck "github.com/krystalcode/go-mantis-shrimp/watches/json_check"
+	sqlCheck "github.com/krystalcode/go-mantis-shrimp/watches/sql_check"
 )
 
 // WatchWrapper provides a structure that holds a Watch together with its type.
@@ -43,6 +51,11 @@ func (wrapper *WatchWrapper) UnmarshalJSON(bytes []byte) error {
 		return fmt.Errorf("cannot decode WatchWrapper JSON object without given the Watch's type")
 	}
 
+	// There is nothing to decode if neither is given.
+	if jsonMap["type"] == nil {
+		return nil
+	}
+
 	// Get the Watch type from the corresponding field.
 	var watchType string
 	err = json.Unmarshal(*jsonMap["type"], &watchType)
@@ -66,10 +79,59 @@ func (wrapper *WatchWrapper) UnmarshalJSON(bytes []byte) error {
 		}
 		wrapper.Watch = watch
 		break
+	case "cert_check":
+		var watch cert.Watch
+		err = json.Unmarshal(*jsonMap["watch"], &watch)
+		if err != nil {
+			return err
+		}
+		wrapper.Watch = watch
+		break
+	case "dns_check":
+		var watch dns.Watch
+		err = json.Unmarshal(*jsonMap["watch"], &watch)
+		if err != nil {
+			return err
+		}
+		wrapper.Watch = watch
+		break
+	case "json_check":
+		var watch jsonCheck.Watch
+		err = json.Unmarshal(*jsonMap["watch"], &watch)
+		if err != nil {
+			return err
+		}
+		wrapper.Watch = watch
+		break
+	case "sql_check":
+		var watch sqlCheck.Watch
+		err = json.Unmarshal(*jsonMap["watch"], &watch)
+		if err != nil {
+			return err
+		}
+		wrapper.Watch = watch
+		break
+	case "aggregate":
+		var watch aggregate.Watch
+		err = json.Unmarshal(*jsonMap["watch"], &watch)
+		if err != nil {
+			return err
+		}
+		wrapper.Watch = watch
+		break
+	case "inbound_event":
+		var watch inboundEvent.Watch
+		err = json.Unmarshal(*jsonMap["watch"], &watch)
+		if err != nil {
+			return err
+		}
+		wrapper.Watch = watch
+		break
 	default:
 		return fmt.Errorf(
-			"unknown Watch type \"%s\" while trying to decode a WatchWrapper JSON object",
+			"unknown Watch type \"%s\" while trying to decode a WatchWrapper JSON object: %w",
 			watchType,
+			errorsUtil.ErrUnknownType,
 		)
 	}
 
@@ -86,10 +148,29 @@ func Wrapper(watch common.Watch) (*WatchWrapper, error) {
 	case "github.com/krystalcode/go-mantis-shrimp/watches/health_check":
 		watchType = "health_check"
 		break
+	case "github.com/krystalcode/go-mantis-shrimp/watches/cert_check":
+		watchType = "cert_check"
+		break
+	case "github.com/krystalcode/go-mantis-shrimp/watches/dns_check":
+		watchType = "dns_check"
+		break
+	case "github.com/krystalcode/go-mantis-shrimp/watches/json_check":
+		watchType = "json_check"
+		break
+	case "github.com/krystalcode/go-mantis-shrimp/watches/sql_check":
+		watchType = "sql_check"
+		break
+	case "github.com/krystalcode/go-mantis-shrimp/watches/aggregate":
+		watchType = "aggregate"
+		break
+	case "github.com/krystalcode/go-mantis-shrimp/watches/inbound_event":
+		watchType = "inbound_event"
+		break
 	default:
 		err := fmt.Errorf(
-			"unknown Watch struct \"%s\" when trying to wrap a Watch in a wrapper",
+			"unknown Watch struct \"%s\" when trying to wrap a Watch in a wrapper: %w",
 			structType,
+			errorsUtil.ErrUnknownType,
 		)
 		return nil, err
 	}
@@ -101,6 +182,31 @@ func Wrapper(watch common.Watch) (*WatchWrapper, error) {
 	return &wrapper, nil
 }
 
+// UnmarshalWrappers decodes the given JSON array of WatchWrapper objects, such
+// as when creating Watches in bulk. Each element is decoded the same way as by
+// WatchWrapper.UnmarshalJSON(), and it must contain a Watch. Decoding stops at
+// the first element that is not valid; the error includes its index.
+func UnmarshalWrappers(bytes []byte) ([]WatchWrapper, error) {
+	var elements []json.RawMessage
+	err := json.Unmarshal(bytes, &elements)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappers := make([]WatchWrapper, len(elements))
+	for index, element := range elements {
+		err = json.Unmarshal(element, &wrappers[index])
+		if err == nil && wrappers[index].Watch == nil {
+			err = fmt.Errorf("no Watch was given")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the Watch at index %d: %w", index, err)
+		}
+	}
+
+	return wrappers, nil
+}
+
 // WatchFactory is a function type that should be implemented by all Watch
 // factories. It defines a function that receives the JSON-encoded Watch object
 // (in raw bytes), and it returs the corresponding Watch object, including any
@@ -110,13 +216,6 @@ type WatchFactory func(jsonWatch *json.RawMessage) (common.Watch, error)
 // Create creates and returns an initialized Watch object that corresponds to
 // the type and holds the data defined to the given JSON-object byte slice.
 func Create(jsonWatch []byte) (common.Watch, error) {
-	// Register factories the first time we create a Watch. We may create a more
-	// generic registration mechanism when we support more Watch factories that
-	// may also be registered independently, but for now this is sufficient.
-	if len(watchFactories) == 0 {
-		watchFactories["health_check"] = health.NewHealthCheckWatch
-	}
-
 	var jsonMap map[string]*json.RawMessage
 	err := json.Unmarshal(jsonWatch, &jsonMap)
 	if err != nil {
@@ -136,18 +235,54 @@ func Create(jsonWatch []byte) (common.Watch, error) {
 		return nil, err
 	}
 
-	factory, ok := watchFactories[watchType]
+	factory, ok := watchFactory(watchType)
 	if !ok {
-		err := fmt.Errorf("unknown Watch factory for type \"%s\"", watchType)
+		err := fmt.Errorf("unknown Watch factory for type \"%s\": %w", watchType, errorsUtil.ErrUnknownType)
 		return nil, err
 	}
 
 	return factory(jsonMap["watch"])
 }
 
+// RegisterWatchFactory registers the given factory for creating Watches of the
+// given type, replacing any factory already registered for it. It allows Watch
+// types defined outside of this package to be created via Create(), and it is
+// safe to call concurrently with Create().
+func RegisterWatchFactory(watchType string, factory WatchFactory) {
+	// @I Support registered Watch types when decoding and creating WatchWrappers
+
+	watchFactoriesMutex.Lock()
+	defer watchFactoriesMutex.Unlock()
+	watchFactories[watchType] = factory
+}
+
 /**
  * For internal use.
  */
 
-// watchFactories holds a map of all known Watch factories.
+// watchFactories holds a map of all known Watch factories, keyed by their
+// type. It is only accessed while holding watchFactoriesMutex.
 var watchFactories = make(map[string]WatchFactory)
+
+// watchFactoriesMutex guards watchFactories so that factories can be registered
+// while others are looked up concurrently.
+var watchFactoriesMutex sync.RWMutex
+
+// Register the factories provided by this application.
+func init() {
+	RegisterWatchFactory("health_check", health.NewHealthCheckWatch)
+	RegisterWatchFactory("cert_check", cert.NewCertCheckWatch)
+	RegisterWatchFactory("dns_check", dns.NewDNSCheckWatch)
+	RegisterWatchFactory("json_check", jsonCheck.NewJSONCheckWatch)
+	RegisterWatchFactory("sql_check", sqlCheck.NewSQLCheckWatch)
+	RegisterWatchFactory("aggregate", aggregate.NewAggregateWatch)
+	RegisterWatchFactory("inbound_event", inboundEvent.NewInboundEventWatch)
+}
+
+// watchFactory returns the factory registered for the given type, if any.
+func watchFactory(watchType string) (WatchFactory, bool) {
+	watchFactoriesMutex.RLock()
+	defer watchFactoriesMutex.RUnlock()
+	factory, ok := watchFactories[watchType]
+	return factory, ok
+}
@@ -0,0 +1,134 @@
+/**
+ * Tests for the msWatchWrapper module.
+ */
+
+package msWatchWrapper
+
+import (
+	// Utilities.
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	// Testing packages.
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	// Internal dependencies.
+	errorsUtil "github.com/krystalcode/go-mantis-shrimp/util/errors"
+	common "github.com/krystalcode/go-mantis-shrimp/watches/common"
+	dns "github.com/krystalcode/go-mantis-shrimp/watches/dns_check"
+	health "github.com/krystalcode/go-mantis-shrimp/watches/health_check"
+)
+
+/**
+ * Tests.
+ */
+
+func TestCreate_BuiltIn(t *testing.T) {
+	watch, err := Create([]byte(`{"type":"health_check","watch":{"url":"https://example.com"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", watch.(health.Watch).URL)
+}
+
+func TestCreate_UnknownType(t *testing.T) {
+	_, err := Create([]byte(`{"type":"unknown","watch":{}}`))
+	assert.EqualError(t, err, "unknown Watch factory for type \"unknown\": unknown type")
+	assert.True(t, errors.Is(err, errorsUtil.ErrUnknownType))
+
+	var wrapper WatchWrapper
+	err = json.Unmarshal([]byte(`{"type":"unknown","watch":{}}`), &wrapper)
+	assert.True(t, errors.Is(err, errorsUtil.ErrUnknownType))
+}
+
+func TestRegisterWatchFactory_Concurrent(t *testing.T) {
+	RegisterWatchFactory("custom", newTestWatch)
+
+	// Factories are registered while others are looked up, such as when Watch
+	// types are registered while requests create Watches.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterWatchFactory(fmt.Sprintf("custom_%d", i), newTestWatch)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			watch, err := Create([]byte(fmt.Sprintf(`{"type":"custom","watch":{"name":"Watch %d"}}`, i)))
+			assert.Nil(t, err)
+			assert.Equal(t, testWatch{Name: fmt.Sprintf("Watch %d", i)}, watch)
+		}(i)
+	}
+	wg.Wait()
+
+	watch, err := Create([]byte(`{"type":"custom_49","watch":{"name":"Last"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, testWatch{Name: "Last"}, watch)
+}
+
+func TestUnmarshalWrappers(t *testing.T) {
+	wrappers, err := UnmarshalWrappers([]byte(`[
+		{"type":"health_check","watch":{"url":"https://example.com"}},
+		{"type":"dns_check","watch":{"hostname":"example.com","record_type":"A"}}
+	]`))
+	assert.Nil(t, err)
+	assert.Len(t, wrappers, 2)
+	assert.Equal(t, "health_check", wrappers[0].Type)
+	assert.Equal(t, "https://example.com", wrappers[0].Watch.(health.Watch).URL)
+	assert.Equal(t, "dns_check", wrappers[1].Type)
+	assert.Equal(t, "example.com", wrappers[1].Watch.(dns.Watch).Hostname)
+
+	wrappers, err = UnmarshalWrappers([]byte(`[]`))
+	assert.Nil(t, err)
+	assert.Len(t, wrappers, 0)
+}
+
+func TestUnmarshalWrappers_InvalidElement(t *testing.T) {
+	cases := map[string]string{
+		`[{"type":"health_check","watch":{}},{"type":"unknown","watch":{}}]`:         "failed to decode the Watch at index 1: unknown Watch type \"unknown\" while trying to decode a WatchWrapper JSON object: unknown type",
+		`[{"watch":{"url":"https://example.com"}}]`:                                  "failed to decode the Watch at index 0: cannot decode WatchWrapper JSON object without given the Watch's type",
+		`[{"type":"health_check","watch":{}},{"type":"health_check","watch":{}},{}]`: "failed to decode the Watch at index 2: no Watch was given",
+		`[{"type":"health_check","watch":{"url":1}}]`:                                "",
+	}
+
+	for jsonWrappers, message := range cases {
+		wrappers, err := UnmarshalWrappers([]byte(jsonWrappers))
+		assert.Nil(t, wrappers, jsonWrappers)
+		if message == "" {
+			assert.Contains(t, err.Error(), "failed to decode the Watch at index 0: ", jsonWrappers)
+			continue
+		}
+		assert.EqualError(t, err, message, jsonWrappers)
+	}
+
+	_, err := UnmarshalWrappers([]byte(`{"type":"health_check","watch":{}}`))
+	assert.NotNil(t, err)
+}
+
+/**
+ * Functions/types for internal use.
+ */
+
+// testWatch is a Watch type defined outside of the Watch packages, created via
+// a registered factory.
+type testWatch struct {
+	Name string `json:"name"`
+}
+
+func (watch testWatch) Do(ctx context.Context) []int {
+	return nil
+}
+
+// newTestWatch implements the WatchFactory function type for testWatch.
+func newTestWatch(jsonWatch *json.RawMessage) (common.Watch, error) {
+	var watch testWatch
+	err := json.Unmarshal(*jsonWatch, &watch)
+	if err != nil {
+		return nil, err
+	}
+
+	return watch, nil
+}